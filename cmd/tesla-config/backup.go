@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/backup"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"golang.org/x/term"
+)
+
+// passphraseEnv supplies the archive passphrase for unattended use
+const passphraseEnv = "TESLA_BACKUP_PASSPHRASE"
+
+// collectBackup gathers the config file, token, key reference and every file
+// in the data directory
+func collectBackup(config *tesla.Config) ([]backup.Entry, error) {
+	data, err := os.ReadFile(config.ConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	entries := []backup.Entry{{Name: "config.json", Kind: backup.KindConfig, Path: config.ConfigPath, Mode: 0600, Data: data}}
+
+	if tokenFile := config.Tesla.OAuthTokenFile; tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+		if err == nil {
+			entries = append(entries, backup.Entry{Name: "token", Kind: backup.KindToken, Path: tokenFile, Mode: 0600, Data: data})
+		}
+	}
+
+	// Private keys stay on their own media; only the reference is kept
+	if keyFile := config.Tesla.PrivateKeyFile; keyFile != "" {
+		entries = append(entries, backup.Entry{Name: "private_key", Kind: backup.KindKeyReference, Path: keyFile})
+	}
+
+	dataDir := config.DataPath()
+	err = filepath.WalkDir(dataDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == dataDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dataDir, file)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entries = append(entries, backup.Entry{
+			Name: path.Join("data", rel),
+			Kind: backup.KindData,
+			Path: rel,
+			Mode: int64(info.Mode().Perm()),
+			Data: data,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	return entries, nil
+}
+
+// restoreFile is a file to be written by a restore
+type restoreFile struct {
+	path string
+	mode os.FileMode
+	data []byte
+}
+
+// planRestore decides where each archived file goes. The config is restored
+// to configPath, and data files to the restored config's data directory.
+func planRestore(archive *backup.Archive, configPath string) ([]restoreFile, *tesla.Config, error) {
+	configs := archive.Find(backup.KindConfig)
+	if len(configs) != 1 {
+		return nil, nil, fmt.Errorf("archive has no config file")
+	}
+
+	config := tesla.DefaultConfig()
+	if err := json.Unmarshal(configs[0].Data, config); err != nil {
+		return nil, nil, fmt.Errorf("archived config is invalid: %w", err)
+	}
+	config.ConfigPath = configPath
+
+	files := []restoreFile{{path: configPath, mode: 0600, data: configs[0].Data}}
+	for _, token := range archive.Find(backup.KindToken) {
+		tokenFile := config.Tesla.OAuthTokenFile
+		if tokenFile == "" {
+			tokenFile = token.Path
+		}
+		files = append(files, restoreFile{path: tokenFile, mode: 0600, data: token.Data})
+	}
+
+	dataDir := config.DataPath()
+	for _, entry := range archive.Find(backup.KindData) {
+		rel := filepath.FromSlash(entry.Path)
+		if !filepath.IsLocal(rel) {
+			return nil, nil, fmt.Errorf("archive entry %s escapes the data directory", entry.Name)
+		}
+		mode := os.FileMode(entry.Mode).Perm()
+		if mode == 0 {
+			mode = 0600
+		}
+		files = append(files, restoreFile{path: filepath.Join(dataDir, rel), mode: mode, data: entry.Data})
+	}
+	return files, config, nil
+}
+
+// runBackup writes an encrypted archive of the local state
+func runBackup(configPath, archivePath string) error {
+	if archivePath == "" {
+		return fmt.Errorf("-archive is required")
+	}
+
+	config, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	entries, err := collectBackup(config)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := backup.Write(&buf, passphrase, entries); err != nil {
+		return err
+	}
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	fmt.Printf("Backup written to %s:\n", archivePath)
+	for _, entry := range entries {
+		fmt.Printf("  %-14s %s\n", entry.Kind, entry.Path)
+	}
+	return nil
+}
+
+// runRestore unpacks an archive over the local state. Existing files are
+// only replaced with force.
+func runRestore(configPath, archivePath string, force bool) error {
+	if archivePath == "" {
+		return fmt.Errorf("-archive is required")
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return err
+	}
+	archive, err := backup.Read(f, passphrase)
+	if err != nil {
+		return err
+	}
+
+	files, config, err := planRestore(archive, configPath)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		var existing []string
+		for _, file := range files {
+			if _, err := os.Stat(file.path); err == nil {
+				existing = append(existing, file.path)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("refusing to overwrite existing files without -force: %s", strings.Join(existing, ", "))
+		}
+	}
+
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0700); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", file.path, err)
+		}
+		if err := os.WriteFile(file.path, file.data, file.mode); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.path, err)
+		}
+		fmt.Printf("Restored %s\n", file.path)
+	}
+
+	for _, key := range archive.Find(backup.KindKeyReference) {
+		if _, err := os.Stat(key.Path); err != nil {
+			fmt.Printf("Warning: private key %s is not present; copy it back or pair a new key\n", key.Path)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Printf("Warning: restored configuration is invalid: %v\n", err)
+	}
+	fmt.Printf("Backup from %s restored.\n", archive.CreatedAt.Local().Format("2006-01-02 15:04"))
+	return nil
+}
+
+// readPassphrase reads the archive passphrase from the environment or the
+// terminal. New archives ask for it twice.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no terminal to read the passphrase from; set %s", passphraseEnv)
+	}
+
+	passphrase, err := promptPassword("Backup passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase is required")
+	}
+	if confirm {
+		again, err := promptPassword("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+// promptPassword reads a line from the terminal without echo
+func promptPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(b), nil
+}
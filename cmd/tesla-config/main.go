@@ -1,26 +1,49 @@
 package main
 
 import (
+	"context"
+	"crypto/ecdh"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
 )
 
 func main() {
 	var (
 		configPath = flag.String("config", tesla.GetDefaultConfigPath(), "Path to configuration file")
-		action     = flag.String("action", "show", "Action to perform: show, create, validate, set-vin, set-key")
+		action     = flag.String("action", "show", "Action to perform: show, create, validate, set-vin, set-key, set-token, enroll, list-keys, remove-key, login, env, get, set, diff, backup, restore, rollback")
 		vin        = flag.String("vin", "", "Vehicle VIN (for set-vin action)")
 		keyFile    = flag.String("key-file", "", "Private key file path (for set-key action)")
 		tokenFile  = flag.String("token-file", "", "OAuth token file path (for set-token action)")
+		archive    = flag.String("archive", "", "Backup archive path (for backup and restore actions)")
+		force      = flag.Bool("force", false, "Overwrite existing files (for restore action)")
+		to         = flag.String("to", "", "Config backup to restore; defaults to the newest (for rollback action)")
+		dryRun     = flag.Bool("dry-run", false, "Check the file alone, strictly and without creating it (for validate action)")
+		role       = flag.String("role", "driver", "Role of the enrolled key: owner or driver (for enroll action)")
+		publicKey  = flag.String("public-key", "", "Hex public key, or a file holding one, to remove (for remove-key action)")
+		timeout    = flag.Duration("timeout", 2*time.Minute, "How long to wait for a key card tap or a login (for enroll and login actions)")
+		tokenName  = flag.String("token-name", "default", "Keyring item to store the token under: default or a VIN (for login action)")
 		help       = flag.Bool("help", false, "Show help")
 	)
 	flag.Parse()
 
+	// The action may also be given as the first argument, e.g.
+	// "tesla-config backup -archive state.tbk"
+	if flag.NArg() > 0 {
+		*action = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
 	if *help {
 		showHelp()
 		return
@@ -32,7 +55,15 @@ func main() {
 	case "create":
 		createConfig(*configPath)
 	case "validate":
-		validateConfig(*configPath)
+		if *dryRun {
+			checkConfigFile(*configPath)
+		} else {
+			validateConfig(*configPath)
+		}
+	case "diff":
+		if err := diffConfig(*configPath); err != nil {
+			log.Fatalf("Diff failed: %v", err)
+		}
 	case "set-vin":
 		if *vin == "" {
 			fmt.Fprintf(os.Stderr, "Error: VIN is required for set-vin action\n")
@@ -51,6 +82,50 @@ func main() {
 			os.Exit(1)
 		}
 		setTokenFile(*configPath, *tokenFile)
+	case "enroll":
+		if err := enrollKey(*configPath, *keyFile, *role, *timeout); err != nil {
+			log.Fatalf("Enrollment failed: %v", err)
+		}
+	case "list-keys":
+		if err := listKeys(*configPath); err != nil {
+			log.Fatalf("Listing keys failed: %v", err)
+		}
+	case "remove-key":
+		if *publicKey == "" {
+			fmt.Fprintf(os.Stderr, "Error: public-key is required for remove-key action\n")
+			os.Exit(1)
+		}
+		if err := removeKey(*configPath, *publicKey); err != nil {
+			log.Fatalf("Removing key failed: %v", err)
+		}
+	case "login":
+		if err := login(*configPath, *tokenName, *timeout); err != nil {
+			log.Fatalf("Login failed: %v", err)
+		}
+	case "env":
+		listEnvVars()
+	case "get":
+		if err := getFields(*configPath, flag.Args()); err != nil {
+			log.Fatalf("Get failed: %v", err)
+		}
+	case "set":
+		if err := setFields(*configPath, flag.Args()); err != nil {
+			log.Fatalf("Set failed: %v", err)
+		}
+	case "backup":
+		if err := runBackup(*configPath, *archive); err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+	case "restore":
+		if err := runRestore(*configPath, *archive, *force); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+	case "rollback":
+		backup, err := tesla.RollbackConfig(*configPath, *to)
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		fmt.Printf("Restored %s from %s\n", *configPath, backup)
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown action '%s'\n", *action)
 		showHelp()
@@ -63,34 +138,72 @@ func showHelp() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Println("  tesla-config [flags]")
+	fmt.Println("  tesla-config <action> [flags]")
 	fmt.Println()
 	fmt.Println("Flags:")
 	fmt.Println("  -config string")
 	fmt.Println("        Path to configuration file (default: ~/.config/tesla-hvac/config.json)")
 	fmt.Println("  -action string")
-	fmt.Println("        Action to perform: show, create, validate, set-vin, set-key, set-token (default: show)")
+	fmt.Println("        Action to perform: show, create, validate, set-vin, set-key, set-token, enroll, list-keys, remove-key, login, env, backup, restore (default: show)")
 	fmt.Println("  -vin string")
 	fmt.Println("        Vehicle VIN (for set-vin action)")
 	fmt.Println("  -key-file string")
-	fmt.Println("        Private key file path (for set-key action)")
+	fmt.Println("        Private key file path (for set-key and enroll actions)")
 	fmt.Println("  -token-file string")
 	fmt.Println("        OAuth token file path (for set-token action)")
+	fmt.Println("  -role string")
+	fmt.Println("        Role of the enrolled key: owner or driver (for enroll action) (default: driver)")
+	fmt.Println("  -timeout duration")
+	fmt.Println("        How long to wait for a key card tap or a login (for enroll and login actions) (default: 2m)")
+	fmt.Println("  -token-name string")
+	fmt.Println("        Keyring item to store the token under: default or a VIN (for login action) (default: default)")
+	fmt.Println("  -public-key string")
+	fmt.Println("        Hex public key, or a file holding one, to remove (for remove-key action)")
+	fmt.Println("  -archive string")
+	fmt.Println("        Backup archive path (for backup and restore actions)")
+	fmt.Println("  -force")
+	fmt.Println("        Overwrite existing files (for restore action)")
+	fmt.Println("  -to string")
+	fmt.Println("        Config backup to restore; defaults to the newest (for rollback action)")
+	fmt.Println("  -dry-run")
+	fmt.Println("        Check the file alone, strictly and without creating it (for validate action)")
 	fmt.Println("  -help")
 	fmt.Println("        Show this help message")
 	fmt.Println()
 	fmt.Println("Actions:")
 	fmt.Println("  show      - Display current configuration")
 	fmt.Println("  create    - Create a new configuration file with defaults")
-	fmt.Println("  validate  - Validate the configuration file")
+	fmt.Println("  validate  - Validate the configuration file, with the environment's overrides")
+	fmt.Println("  diff      - Show how the file differs from the defaults, and what the environment overrides")
 	fmt.Println("  set-vin   - Set the vehicle VIN")
 	fmt.Println("  set-key   - Set the private key file path")
 	fmt.Println("  set-token - Set the OAuth token file path")
+	fmt.Println("  enroll    - Add the private key's public key to the vehicle over BLE")
+	fmt.Println("  list-keys - List the keys that can command the vehicle")
+	fmt.Println("  remove-key - Remove a key from the vehicle; needs an owner key")
+	fmt.Println("  login     - Log in to Tesla and store the Fleet API token in the keyring")
+	fmt.Println("  env       - List the environment variables that override config fields")
+	fmt.Println("  get       - Print config values by dotted path, e.g. get retry.max_retries")
+	fmt.Println("  set       - Set config values by dotted path, e.g. set retry.max_retries=5 logging.level=debug")
+	fmt.Println("  backup    - Write config, token and data files to an encrypted archive")
+	fmt.Println("  restore   - Restore an encrypted archive")
+	fmt.Println("  rollback  - Restore an earlier version of the config file that saving kept")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  tesla-config -action create")
 	fmt.Println("  tesla-config -action set-vin -vin 5YJ3E1EA4KF123456")
 	fmt.Println("  tesla-config -action set-key -key-file ~/.tesla/private_key.pem")
 	fmt.Println("  tesla-config -action validate")
+	fmt.Println("  tesla-config validate -dry-run -config deploy/config.json")
+	fmt.Println("  tesla-config set retry.initial_delay=2s notifications.smtp.host=smtp.example.com")
+	fmt.Println("  tesla-config enroll -role driver")
+	fmt.Println("  tesla-config remove-key -public-key 04a1b2...")
+	fmt.Println("  TESLA_CLIENT_ID=... tesla-config login")
+	fmt.Println("  tesla-config backup -archive tesla-hvac.tbk")
+	fmt.Println("  tesla-config rollback")
+	fmt.Println()
+	fmt.Println("The backup passphrase is read from the terminal, or from TESLA_BACKUP_PASSPHRASE.")
+	fmt.Println("An encrypted private key's passphrase is read from TESLA_KEY_PASSPHRASE.")
 }
 
 func showConfig(configPath string) {
@@ -102,7 +215,9 @@ func showConfig(configPath string) {
 	fmt.Printf("Configuration loaded from: %s\n", configPath)
 	fmt.Println()
 	fmt.Printf("Tesla Configuration:\n")
-	fmt.Printf("  VIN: %s\n", config.Tesla.VIN)
+	if len(config.Vehicles) == 0 {
+		fmt.Printf("  VIN: %s\n", config.Tesla.VIN)
+	}
 	fmt.Printf("  Private Key File: %s\n", config.Tesla.PrivateKeyFile)
 	fmt.Printf("  OAuth Token File: %s\n", config.Tesla.OAuthTokenFile)
 	fmt.Printf("  Connection Timeout: %v\n", config.Tesla.ConnectionTimeout)
@@ -111,6 +226,26 @@ func showConfig(configPath string) {
 	fmt.Printf("  Request Timeout: %v\n", config.Tesla.RequestTimeout)
 	fmt.Printf("  Scan Retries: %d\n", config.Tesla.ScanRetries)
 	fmt.Printf("  Scan Delay: %v\n", config.Tesla.ScanDelay)
+	fmt.Printf("  Direct Connect Timeout: %v\n", config.Tesla.DirectConnectTimeout)
+	for _, vehicle := range config.Vehicles {
+		fmt.Printf("  Vehicle %s", vehicle.VIN)
+		if vehicle.Name != "" {
+			fmt.Printf(" (%s)", vehicle.Name)
+		}
+		fmt.Println()
+		if vehicle.Transport != "" {
+			fmt.Printf("    Transport: %s\n", vehicle.Transport)
+		}
+		if vehicle.PrivateKeyFile != "" {
+			fmt.Printf("    Private Key File: %s\n", vehicle.PrivateKeyFile)
+		}
+		if vehicle.Retry != nil {
+			fmt.Printf("    Max Retries: %d\n", vehicle.Retry.MaxRetries)
+		}
+		if vehicle.CircuitBreaker != nil {
+			fmt.Printf("    Circuit Breaker Max Failures: %d\n", vehicle.CircuitBreaker.MaxFailures)
+		}
+	}
 	fmt.Println()
 	fmt.Printf("Client Configuration:\n")
 	fmt.Printf("  Client Name: %s\n", config.Client.ClientName)
@@ -120,6 +255,7 @@ func showConfig(configPath string) {
 	fmt.Printf("  Enable Auto Reconnect: %t\n", config.Client.EnableAutoReconnect)
 	fmt.Printf("  Enable Health Checks: %t\n", config.Client.EnableHealthChecks)
 	fmt.Printf("  Enable Metrics: %t\n", config.Client.EnableMetrics)
+	fmt.Printf("  Enable Session Cache: %t\n", config.Client.EnableSessionCache)
 	fmt.Println()
 	fmt.Printf("Retry Configuration:\n")
 	fmt.Printf("  Max Retries: %d\n", config.Retry.MaxRetries)
@@ -127,12 +263,39 @@ func showConfig(configPath string) {
 	fmt.Printf("  Max Delay: %v\n", config.Retry.MaxDelay)
 	fmt.Printf("  Backoff Factor: %.2f\n", config.Retry.BackoffFactor)
 	fmt.Printf("  Jitter: %t\n", config.Retry.Jitter)
+	if config.Retry.Jitter && config.Retry.JitterStrategy != "" {
+		fmt.Printf("  Jitter Strategy: %s\n", config.Retry.JitterStrategy)
+	}
 	fmt.Println()
 	fmt.Printf("Circuit Breaker Configuration:\n")
 	fmt.Printf("  Max Failures: %d\n", config.CircuitBreaker.MaxFailures)
 	fmt.Printf("  Reset Timeout: %v\n", config.CircuitBreaker.ResetTimeout)
 	fmt.Printf("  Half Open Max Calls: %d\n", config.CircuitBreaker.HalfOpenMaxCalls)
 	fmt.Println()
+	fmt.Printf("Metrics Configuration:\n")
+	fmt.Printf("  Interval: %v\n", config.Metrics.Interval)
+	fmt.Printf("  Tags: %v\n", config.Metrics.Tags)
+	fmt.Printf("  InfluxDB URL: %s\n", config.Metrics.InfluxDB.URL)
+	fmt.Printf("  Statsd Address: %s\n", config.Metrics.Statsd.Address)
+	fmt.Println()
+	fmt.Printf("Update Configuration:\n")
+	fmt.Printf("  Manifest URL: %s\n", config.Update.ManifestURL)
+	fmt.Printf("  Check Interval: %v\n", config.Update.CheckInterval)
+	fmt.Println()
+	fmt.Printf("Macros:\n")
+	for _, macro := range config.Macros {
+		fmt.Printf("  %s: %d steps, %v of delays\n", macro.Name, len(macro.Steps), macro.Duration())
+	}
+	fmt.Println()
+	fmt.Printf("Profiles (switch with set profile=<name>):\n")
+	for _, name := range config.ProfileNames() {
+		if name == config.Profile {
+			fmt.Printf("  %s (active)\n", name)
+		} else {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	fmt.Println()
 	fmt.Printf("Logging Configuration:\n")
 	fmt.Printf("  Level: %s\n", config.Logging.Level)
 	fmt.Printf("  Format: %s\n", config.Logging.Format)
@@ -141,6 +304,12 @@ func showConfig(configPath string) {
 	fmt.Printf("  Max Size: %d MB\n", config.Logging.MaxSize)
 	fmt.Printf("  Max Backups: %d\n", config.Logging.MaxBackups)
 	fmt.Printf("  Max Age: %d days\n", config.Logging.MaxAge)
+	fmt.Println()
+	fmt.Printf("Config Backups (restore with rollback -to):\n")
+	backups, _ := tesla.ConfigBackups(configPath)
+	for _, backup := range backups {
+		fmt.Printf("  %s\n", backup)
+	}
 }
 
 func createConfig(configPath string) {
@@ -161,7 +330,9 @@ func createConfig(configPath string) {
 	config.ConfigPath = configPath
 
 	// Load environment variables
-	config.LoadFromEnv()
+	if err := config.LoadFromEnv(); err != nil {
+		log.Fatalf("Invalid environment: %v", err)
+	}
 
 	// Save config
 	if err := config.Save(); err != nil {
@@ -178,6 +349,11 @@ func validateConfig(configPath string) {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Check the config the server would run with
+	if err := config.LoadFromEnv(); err != nil {
+		fmt.Printf("Environment validation failed: %v\n", err)
+		os.Exit(1)
+	}
 	if err := config.Validate(); err != nil {
 		fmt.Printf("Configuration validation failed: %v\n", err)
 		os.Exit(1)
@@ -186,12 +362,96 @@ func validateConfig(configPath string) {
 	fmt.Println("Configuration is valid.")
 }
 
+// checkConfigFile validates the file as it is, for CI: a missing file isn't
+// created, unknown fields are errors and the environment isn't applied
+func checkConfigFile(configPath string) {
+	if _, err := tesla.CheckConfigFile(configPath); err != nil {
+		fmt.Printf("Configuration validation failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Configuration is valid.")
+}
+
+// diffConfig prints the fields the file changes from the defaults, then the
+// fields environment variables override in the config the server would run
+// with
+func diffConfig(configPath string) error {
+	if _, err := os.Stat(configPath); err != nil {
+		return err
+	}
+	file, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	effective, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := effective.LoadFromEnv(); err != nil {
+		return fmt.Errorf("invalid environment: %w", err)
+	}
+
+	changes, err := tesla.DiffConfigs(tesla.DefaultConfig(), file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Changed from the defaults by %s:\n", configPath)
+	printChanges(changes, nil)
+
+	overrides, err := tesla.DiffConfigs(file, effective)
+	if err != nil {
+		return err
+	}
+	envNames := make(map[string]string)
+	for _, v := range tesla.EnvVars() {
+		envNames[v.Path] = v.Name
+	}
+	fmt.Println()
+	fmt.Printf("Overridden by the environment:\n")
+	printChanges(overrides, envNames)
+	return nil
+}
+
+// printChanges prints each change as path: old -> new, naming the set
+// variable in envNames that sets it if there is one
+func printChanges(changes []tesla.ConfigChange, envNames map[string]string) {
+	if len(changes) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, change := range changes {
+		old, new := change.Old, change.New
+		if old == "" {
+			old = "(unset)"
+		}
+		if new == "" {
+			new = "(unset)"
+		}
+		fmt.Printf("  %s: %s -> %s", change.Path, old, new)
+		// A list item or map entry is set by its field's variable
+		for path := change.Path; path != ""; {
+			if name := envNames[path]; name != "" && os.Getenv(name) != "" {
+				fmt.Printf(" (%s)", name)
+				break
+			}
+			i := strings.LastIndex(path, ".")
+			if i < 0 {
+				break
+			}
+			path = path[:i]
+		}
+		fmt.Println()
+	}
+}
+
 func setVIN(configPath string, vin string) {
 	config, err := tesla.LoadConfig(configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if len(config.Vehicles) > 0 {
+		log.Fatalf("The config lists several vehicles; edit the vehicles list instead")
+	}
 	config.Tesla.VIN = vin
 
 	if err := config.Save(); err != nil {
@@ -240,3 +500,236 @@ func setTokenFile(configPath string, tokenFile string) {
 
 	fmt.Printf("OAuth token file set to: %s\n", tokenFile)
 }
+
+// listEnvVars prints each environment variable that overrides a config
+// field, marking those that are set
+func listEnvVars() {
+	for _, v := range tesla.EnvVars() {
+		marker := ""
+		if os.Getenv(v.Name) != "" {
+			marker = "\t(set)"
+		}
+		fmt.Printf("%s\t%s\t%s%s\n", v.Name, v.Type, v.Path, marker)
+	}
+}
+
+// getFields prints the values at dotted paths, as the file has them: one
+// value alone, or path=value lines for several
+func getFields(configPath string, paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("give one or more paths, such as retry.max_retries")
+	}
+	config, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	for _, path := range paths {
+		value, err := config.GetField(path)
+		if err != nil {
+			return err
+		}
+		text, ok := value.(string)
+		if !ok && value != nil {
+			var data []byte
+			if len(paths) == 1 {
+				data, err = json.MarshalIndent(value, "", "  ")
+			} else {
+				data, err = json.Marshal(value)
+			}
+			if err != nil {
+				return err
+			}
+			text = string(data)
+		}
+		if len(paths) == 1 {
+			fmt.Println(text)
+		} else {
+			fmt.Printf("%s=%s\n", path, text)
+		}
+	}
+	return nil
+}
+
+// setFields sets path=value pairs, and saves the config once they're all
+// set and it's valid
+func setFields(configPath string, assignments []string) error {
+	if len(assignments) == 0 {
+		return fmt.Errorf("give one or more path=value pairs, such as retry.max_retries=5")
+	}
+	config, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	for _, assignment := range assignments {
+		path, value, ok := strings.Cut(assignment, "=")
+		if !ok {
+			return fmt.Errorf("%q is not path=value", assignment)
+		}
+		if err := config.SetField(path, value); err != nil {
+			return err
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	for _, assignment := range assignments {
+		fmt.Println("Set", assignment)
+	}
+	return nil
+}
+
+// enrollKey adds the configured private key, or keyFile, to the vehicle over
+// BLE and waits for it to be approved with a key card
+func enrollKey(configPath, keyFile, roleName string, timeout time.Duration) error {
+	config, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	role, err := tesla.ParseKeyRole(roleName)
+	if err != nil {
+		return err
+	}
+	if keyFile == "" {
+		keyFile = config.Tesla.PrivateKeyFile
+	}
+
+	client := tesla.NewClientFromConfig(config, log.New(io.Discard, "", 0))
+	client.SetPrivateKeyFile(keyFile)
+	publicKey, err := client.PublicKey()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	fmt.Printf("Sending an add-key request for a %s key to %s over BLE...\n", role, client.GetVIN())
+	err = client.EnrollKey(ctx, publicKey, role, func() {
+		fmt.Println("Tap a key card on the center console, then approve the new key on the vehicle's touchscreen.")
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Key enrolled.")
+	return nil
+}
+
+// connectVehicle connects to the configured vehicle
+func connectVehicle(ctx context.Context, configPath string) (*tesla.Client, error) {
+	config, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	client := tesla.NewClientFromConfig(config, log.New(io.Discard, "", 0))
+	if err := client.ConnectWithConfig(ctx, config); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// listKeys prints the keys on the vehicle's whitelist
+func listKeys(configPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client, err := connectVehicle(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	keys, err := client.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		marker := ""
+		if key.ServerKey {
+			marker = "\t(this server)"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s%s\n", key.Slot, key.Role, key.FormFactor, key.PublicKey, marker)
+	}
+	return nil
+}
+
+// removeKey removes a key, given in hex or as a file, from the vehicle
+func removeKey(configPath, value string) error {
+	var publicKey *ecdh.PublicKey
+	var err error
+	if _, statErr := os.Stat(value); statErr == nil {
+		publicKey, err = protocol.LoadPublicKey(value)
+	} else {
+		publicKey, err = tesla.ParseVehiclePublicKey(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client, err := connectVehicle(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	if err := client.RemoveKey(ctx, publicKey); err != nil {
+		return err
+	}
+	fmt.Println("Key removed.")
+	return nil
+}
+
+// login stores a Fleet API token obtained by logging in to Tesla in a browser
+func login(configPath, tokenName string, timeout time.Duration) error {
+	config, err := tesla.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	oauth, err := tesla.OpenOAuthManager(config.Keyring, log.New(io.Discard, "", 0))
+	if err != nil {
+		return err
+	}
+	oauth.SetConfig(config.OAuth)
+
+	host := config.Tesla.FleetAPIHost
+	if host == "" {
+		host = tesla.DefaultFleetAPIHost
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	token, err := oauth.Login(ctx, tesla.LoginOptions{
+		TokenName: tokenName,
+		Audience:  "https://" + host,
+		Open: func(authURL string) error {
+			fmt.Println("Log in to Tesla at:")
+			fmt.Println()
+			fmt.Println("  " + authURL)
+			fmt.Println()
+			if err := openBrowser(authURL); err != nil {
+				fmt.Println("Open the link in a browser on this machine to continue.")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Logged in. Token %q stored in the keyring, valid until %s.\n", tokenName, token.ExpiresAt.Format(time.RFC1123))
+	return nil
+}
+
+// openBrowser opens a URL in the desktop's browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
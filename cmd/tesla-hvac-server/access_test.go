@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	logs, err := logging.NewWriter(logging.Config{Level: logging.LevelInfo, Format: logging.FormatJSON}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downstream := logs.Std()
+	handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.ForContext(r.Context(), downstream).Printf("Failed to set temperature: timeout")
+		writeError(w, http.StatusInternalServerError, ErrCodeVehicleError, "timeout")
+	}), logs.Logger)
+
+	req := httptest.NewRequest("POST", "/api/v1/hvac/temperature", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("X-Request-ID") != "abc-123" {
+		t.Errorf("Expected the caller's request ID, got %q", rec.Header().Get("X-Request-ID"))
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected the handler's log and the access log, got %v", records)
+	}
+	if records[0]["request_id"] != "abc-123" || records[0]["msg"] != "Failed to set temperature: timeout" {
+		t.Errorf("Expected the handler's log tagged with the request ID, got %v", records[0])
+	}
+	access := records[1]
+	expected := map[string]interface{}{
+		"msg":        "request",
+		"request_id": "abc-123",
+		"method":     "POST",
+		"path":       "/api/v1/hvac/temperature",
+		"status":     float64(500),
+		"remote_ip":  "192.0.2.1",
+	}
+	for key, value := range expected {
+		if access[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, access[key])
+		}
+	}
+	if _, ok := access["latency_ms"]; !ok || access["bytes"].(float64) == 0 {
+		t.Errorf("Expected the latency and size, got %v", access)
+	}
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	var ids []string
+	handler := accessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, logging.RequestID(r.Context()))
+	}), slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+
+	// Missing and unsafe IDs are replaced with generated ones
+	for _, header := range []string{"", "bad id\nwith newline", strings.Repeat("x", 200)} {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("X-Request-ID", header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		id := rec.Header().Get("X-Request-ID")
+		if id == "" || id == header || id != ids[len(ids)-1] {
+			t.Errorf("Expected a generated ID for %q, got %q", header, id)
+		}
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("Expected unique IDs, got %v", ids)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// AdminHandler serves the runtime administration endpoints, under /admin and
+// /config. Requests must carry the admin token as a bearer token; the handler
+// is disabled when no token is configured.
+type AdminHandler struct {
+	client        *tesla.Client
+	configManager *tesla.ConfigManager
+	token         string
+	logger        *log.Logger
+
+	// updates serves /admin/update; nil when updates aren't configured
+	updates *UpdateManager
+
+	// users serves /admin/users; nil when accounts aren't configured
+	users *ProfileHandler
+}
+
+// NewAdminHandler creates a new admin handler. configManager may be nil, in
+// which case changes apply only until the server restarts. Users with the
+// admin role may also use the handler, whether or not a token is set.
+func NewAdminHandler(client *tesla.Client, configManager *tesla.ConfigManager, token string, logger *log.Logger) *AdminHandler {
+	return &AdminHandler{
+		client:        client,
+		configManager: configManager,
+		token:         token,
+		logger:        logger,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token == "" && !adminUser(r) {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Admin token required")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/admin/tuning":
+		h.handleTuning(w, r)
+	case "/admin/update":
+		if h.updates == nil {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "Updates are not configured")
+			return
+		}
+		h.updates.ServeHTTP(w, r)
+	case "/admin/users":
+		h.serveUsers(w, r)
+	case "/admin/api-keys":
+		h.serveAPIKeys(w, r)
+	case "/admin/circuit", "/admin/circuit/reset", "/admin/circuit/trip":
+		h.serveCircuit(w, r)
+	case "/config", "/config/reload", "/config/profile":
+		h.serveConfig(w, r)
+	default:
+		if strings.HasPrefix(r.URL.Path, "/admin/users/") {
+			h.serveUsers(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/admin/api-keys/") {
+			h.serveAPIKeys(w, r)
+			return
+		}
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	}
+}
+
+// serveUsers serves the user endpoints when accounts are configured
+func (h *AdminHandler) serveUsers(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "User accounts are not configured")
+		return
+	}
+	h.users.serveUsers(w, r)
+}
+
+// adminUser reports whether the request is from a logged-in admin
+func adminUser(r *http.Request) bool {
+	user, ok := profile.FromContext(r.Context())
+	return ok && user.Role.IsAdmin()
+}
+
+// authorized checks the request's bearer token against the admin token, or
+// that it comes from a logged-in admin
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	if adminUser(r) {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// tuningResult is the response to updating the tuning
+type tuningResult struct {
+	Tuning    tesla.Tuning `json:"tuning"`
+	Persisted bool         `json:"persisted"` // Whether the change was saved to the config file
+}
+
+// handleTuning reads or updates the client's runtime tuning. PATCH and PUT
+// both merge the request body over the current settings.
+func (h *AdminHandler) handleTuning(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeData(w, http.StatusOK, h.client.Tuning())
+	case "PUT", "PATCH":
+		tuning := h.client.Tuning()
+
+		if err := parseJSON(w, r, &tuning); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+
+		if err := tuning.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+
+		persisted := false
+		if h.configManager != nil {
+			// The config manager's change callback applies the new settings to the client
+			if err := h.configManager.UpdateConfig(tuning.ApplyTo); err != nil {
+				h.logger.Printf("Failed to persist tuning: %v", err)
+				writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist tuning")
+				return
+			}
+			persisted = true
+		} else {
+			h.client.ApplyTuning(tuning)
+		}
+
+		h.logger.Printf("Tuning updated via admin API (persisted: %v)", persisted)
+		writeData(w, http.StatusOK, tuningResult{Tuning: h.client.Tuning(), Persisted: persisted})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func newTestAdminAPI(token string) (*APIHandler, *tesla.Client) {
+	logger := log.New(io.Discard, "", 0)
+	client := tesla.NewClientFromConfig(tesla.DefaultConfig(), logger)
+	handler := NewAPIHandler(client, logger)
+	handler.Mount("/admin", NewAdminHandler(client, nil, token, logger))
+	return handler, client
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	handler, _ := newTestAdminAPI("secret")
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		req := httptest.NewRequest("GET", "/admin/tuning", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", auth, rec.Code)
+		}
+	}
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	handler, _ := newTestAdminAPI("")
+
+	req := httptest.NewRequest("GET", "/admin/tuning", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAdminPatchTuning(t *testing.T) {
+	handler, client := newTestAdminAPI("secret")
+
+	body := `{"retry": {"max_retries": 7}, "circuit_breaker": {"max_failures": 10}}`
+	req := httptest.NewRequest("PATCH", "/admin/tuning", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tuning := client.Tuning()
+	if tuning.Retry.MaxRetries != 7 {
+		t.Errorf("Expected max retries 7, got %d", tuning.Retry.MaxRetries)
+	}
+	if tuning.CircuitBreaker.MaxFailures != 10 {
+		t.Errorf("Expected max failures 10, got %d", tuning.CircuitBreaker.MaxFailures)
+	}
+	// Fields not in the body keep their current values
+	if tuning.Retry.BackoffFactor != 2.0 {
+		t.Errorf("Expected backoff factor to be unchanged, got %v", tuning.Retry.BackoffFactor)
+	}
+
+	var env struct {
+		Data struct {
+			Persisted bool `json:"persisted"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if env.Data.Persisted {
+		t.Error("Expected persisted to be false without a config manager")
+	}
+}
+
+func TestAdminRejectsInvalidTuning(t *testing.T) {
+	handler, client := newTestAdminAPI("secret")
+
+	for _, body := range []string{`{"retry": {"max_retries": -1}}`, `{"bogus": 1}`, `not json`} {
+		req := httptest.NewRequest("PUT", "/admin/tuning", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Body %s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	if client.Tuning().Retry.MaxRetries != 3 {
+		t.Errorf("Expected tuning to be unchanged, got %+v", client.Tuning().Retry)
+	}
+}
+
+func TestAdminCircuit(t *testing.T) {
+	handler, client := newTestAdminAPI("secret")
+
+	rec := serveWithToken(handler, "POST", "/admin/circuit/trip", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Trip: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if client.CircuitState() != tesla.CircuitOpen {
+		t.Errorf("Circuit is %s after a trip", client.CircuitState())
+	}
+
+	rec = serveWithToken(handler, "GET", "/admin/circuit", "secret", "")
+	var envelope struct {
+		Data circuitInfo `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Data.State != "open" || envelope.Data.RetryAt.IsZero() {
+		t.Errorf("Circuit status = %+v", envelope.Data)
+	}
+
+	rec = serveWithToken(handler, "POST", "/admin/circuit/reset", "secret", "")
+	if rec.Code != http.StatusOK || client.CircuitState() != tesla.CircuitClosed {
+		t.Errorf("Reset: %d, circuit %s", rec.Code, client.CircuitState())
+	}
+
+	if rec := serveWithToken(handler, "POST", "/admin/circuit", "secret", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /admin/circuit: expected 405, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "POST", "/admin/circuit/reset", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Reset without the token: expected 401, got %d", rec.Code)
+	}
+}
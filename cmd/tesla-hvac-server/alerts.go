@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// alertEventBuffer is how many vehicle events may queue for the alert
+	// monitor
+	alertEventBuffer = 32
+	// notifyTimeout bounds sending one notification to every backend
+	notifyTimeout = time.Minute
+)
+
+// tempAlarm goes off once when a temperature rises above a threshold, and
+// again only after it has cooled cabinTempRearm below it
+type tempAlarm struct {
+	raised bool
+}
+
+// check reports whether celsius sets the alarm off
+func (a *tempAlarm) check(celsius, threshold float32) bool {
+	switch {
+	case celsius > threshold && !a.raised:
+		a.raised = true
+		return true
+	case celsius <= threshold-cabinTempRearm:
+		a.raised = false
+	}
+	return false
+}
+
+// sendNotification sends msg in the background, logging a failure
+func sendNotification(notifier notify.Notifier, logger *log.Logger, msg notify.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		if err := notifier.Notify(ctx, msg); err != nil {
+			logger.Printf("Failed to send notification %q: %v", msg.Title, err)
+		}
+	}()
+}
+
+// AlertMonitor watches the vehicles' state and sends a cabin_temperature
+// alert when a cabin rises above alerts.cabin_temp_max, and a circuit_open
+// alert when repeated failures open a vehicle's circuit breaker, with another
+// when it closes again. The Dog Mode monitor sends the keeper alerts.
+type AlertMonitor struct {
+	api    *APIHandler
+	config notify.AlertsConfig
+	send   func(notify.Message)
+	logger *log.Logger
+
+	vehicles map[string]*alertVehicle // Only touched by Run
+}
+
+// alertVehicle is the alert state of a vehicle, so each alert is sent once
+type alertVehicle struct {
+	cabin       tempAlarm
+	circuitOpen bool // A circuit_open alert was sent, and the breaker hasn't closed since
+}
+
+// NewAlertMonitor creates a monitor sending alerts through notifier
+func NewAlertMonitor(api *APIHandler, config notify.AlertsConfig, notifier notify.Notifier, logger *log.Logger) *AlertMonitor {
+	return &AlertMonitor{
+		api:    api,
+		config: config,
+		send: func(msg notify.Message) {
+			sendNotification(notifier, logger, msg)
+		},
+		logger:   logger,
+		vehicles: make(map[string]*alertVehicle),
+	}
+}
+
+// Run checks the vehicles' state changes until ctx is cancelled
+func (m *AlertMonitor) Run(ctx context.Context) error {
+	events := make(chan tesla.Event, alertEventBuffer)
+	for _, vehicle := range m.api.vehicles() {
+		vehicleEvents, unsubscribe := vehicle.Events().Subscribe(alertEventBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range vehicleEvents {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			m.handle(event)
+		}
+	}
+}
+
+// handle sends the alerts an event calls for
+func (m *AlertMonitor) handle(event tesla.Event) {
+	v := m.vehicles[event.VIN]
+	if v == nil {
+		v = &alertVehicle{}
+		m.vehicles[event.VIN] = v
+	}
+
+	switch data := event.Data.(type) {
+	case tesla.HVACState:
+		if event.Type == tesla.EventStateChanged {
+			m.cabin(event, v, data)
+		}
+	case tesla.CircuitOpened:
+		if m.config.AlertEnabled(notify.AlertCircuitOpen) {
+			v.circuitOpen = true
+			m.send(notify.Message{
+				Title:    fmt.Sprintf("%s is unreachable", event.VIN),
+				Body:     fmt.Sprintf("Repeated failures opened the circuit breaker for %s; commands are refused until it recovers. Last error from %s: %s", event.VIN, data.Operation, data.Error),
+				Priority: notify.PriorityHigh,
+			})
+		}
+	case tesla.CircuitStateChange:
+		if data.To == tesla.CircuitClosed.String() && v.circuitOpen {
+			v.circuitOpen = false
+			m.send(notify.Message{
+				Title: fmt.Sprintf("%s is reachable again", event.VIN),
+				Body:  fmt.Sprintf("The circuit breaker for %s closed; commands are going through.", event.VIN),
+			})
+		}
+	}
+}
+
+// cabin alerts once when the cabin rises above the threshold, and again only
+// after it has cooled off
+func (m *AlertMonitor) cabin(event tesla.Event, v *alertVehicle, state tesla.HVACState) {
+	threshold := m.config.CabinTemp()
+	if v.cabin.check(state.InsideTempCelsius, threshold) && m.config.AlertEnabled(notify.AlertCabinTemp) {
+		m.send(notify.Message{
+			Title:    fmt.Sprintf("Cabin is %.0f°C", state.InsideTempCelsius),
+			Body:     fmt.Sprintf("The cabin of %s is %.1f°C, above %.0f°C. Climate is %s.", event.VIN, state.InsideTempCelsius, threshold, onOff(state.IsOn)),
+			Priority: notify.PriorityHigh,
+		})
+	}
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
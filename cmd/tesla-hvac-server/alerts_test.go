@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func newTestAlertMonitor(config notify.AlertsConfig) (*AlertMonitor, *[]notify.Message) {
+	var sent []notify.Message
+	m := NewAlertMonitor(nil, config, nil, log.New(io.Discard, "", 0))
+	m.send = func(msg notify.Message) { sent = append(sent, msg) }
+	return m, &sent
+}
+
+func stateEvent(state tesla.HVACState) tesla.Event {
+	return tesla.Event{Type: tesla.EventStateChanged, VIN: "VIN1", Data: state}
+}
+
+func TestAlertMonitorCabinTemp(t *testing.T) {
+	m, sent := newTestAlertMonitor(notify.AlertsConfig{})
+	for _, temp := range []float32{40, 46, 50, 44, 46, 42, 47} {
+		m.handle(stateEvent(tesla.HVACState{InsideTempCelsius: temp, IsOn: true}))
+	}
+	// Above the default 45°C at 46, re-armed at 42, again at 47
+	if len(*sent) != 2 || (*sent)[0].Priority != notify.PriorityHigh {
+		t.Errorf("sent = %+v, want two high priority alerts", *sent)
+	}
+
+	m, sent = newTestAlertMonitor(notify.AlertsConfig{Disabled: []string{notify.AlertCabinTemp}})
+	m.handle(stateEvent(tesla.HVACState{InsideTempCelsius: 50}))
+	if len(*sent) != 0 {
+		t.Errorf("sent = %+v, want none when disabled", *sent)
+	}
+}
+
+func TestAlertMonitorCircuit(t *testing.T) {
+	m, sent := newTestAlertMonitor(notify.AlertsConfig{})
+	closed := tesla.Event{Type: tesla.EventCircuitStateChanged, VIN: "VIN1", Data: tesla.CircuitStateChange{From: "half_open", To: "closed"}}
+	m.handle(closed) // Nothing was reported open
+	m.handle(tesla.Event{Type: tesla.EventCircuitOpened, VIN: "VIN1", Data: tesla.CircuitOpened{Operation: "connect", Error: "timeout"}})
+	m.handle(closed)
+	if len(*sent) != 2 || (*sent)[0].Priority != notify.PriorityHigh || (*sent)[1].Priority != notify.PriorityNormal {
+		t.Errorf("sent = %+v, want an alert and a recovery", *sent)
+	}
+
+	m, sent = newTestAlertMonitor(notify.AlertsConfig{Disabled: []string{notify.AlertCircuitOpen}})
+	m.handle(tesla.Event{Type: tesla.EventCircuitOpened, VIN: "VIN1", Data: tesla.CircuitOpened{}})
+	m.handle(closed)
+	if len(*sent) != 0 {
+		t.Errorf("sent = %+v, want none when disabled", *sent)
+	}
+}
@@ -0,0 +1,1035 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/update"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// defaultVehicleStatusTimeout bounds how long a single vehicle may take to
+// report its status in bulk status requests
+const defaultVehicleStatusTimeout = 5 * time.Second
+
+// maxLongPollWait caps how long a long-poll request may wait for a change
+const maxLongPollWait = 2 * time.Minute
+
+// maxRequestBodySize bounds the size of JSON request bodies
+const maxRequestBodySize = 64 << 10
+
+// APIHandler handles API requests
+type APIHandler struct {
+	client   *tesla.Client // The default vehicle
+	registry *tesla.Registry
+	mounts   map[string]http.Handler
+	jobs     *JobManager // Commands run with ?async=true
+	offline  *OfflineQueue // Holds async commands for vehicles that aren't connected; nil when not enabled
+	logger  *log.Logger
+	updates *UpdateManager // nil when update checks aren't configured
+
+	// profiles authenticates requests once user accounts exist; nil when
+	// accounts aren't configured
+	profiles *ProfileHandler
+
+	// keys authenticates requests once API keys are configured; nil without
+	// a config file
+	keys *APIKeyAuth
+
+	// audit records requests that change something; nil when not set up
+	audit *AuditLog
+}
+
+// NewAPIHandler creates a new API handler for a single vehicle
+func NewAPIHandler(client *tesla.Client, logger *log.Logger) *APIHandler {
+	registry := tesla.NewRegistry()
+	registry.Add(client, "")
+	return NewRegistryAPIHandler(registry, logger)
+}
+
+// NewRegistryAPIHandler creates an API handler for every vehicle in a
+// registry. The registry's first vehicle is the default.
+func NewRegistryAPIHandler(registry *tesla.Registry, logger *log.Logger) *APIHandler {
+	h := &APIHandler{
+		client:   registry.Default(),
+		registry: registry,
+		jobs:     NewJobManager(logger),
+		logger:   logger,
+	}
+	h.Mount("/jobs", h.jobs)
+	return h
+}
+
+// Mount serves prefix and every path below it with handler, e.g. "/admin"
+// serves /admin and /admin/...
+func (h *APIHandler) Mount(prefix string, handler http.Handler) {
+	if h.mounts == nil {
+		h.mounts = make(map[string]http.Handler)
+	}
+	h.mounts[strings.TrimSuffix(prefix, "/")] = handler
+}
+
+// mounted returns the handler mounted at the path's first segment, if any
+func (h *APIHandler) mounted(path string) (http.Handler, bool) {
+	if path == "" {
+		return nil, false
+	}
+	segment := path
+	if i := strings.Index(path[1:], "/"); i >= 0 {
+		segment = path[:i+1]
+	}
+	handler, ok := h.mounts[segment]
+	return handler, ok
+}
+
+// ServeHTTP implements http.Handler
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Set content type
+	w.Header().Set("Content-Type", "application/json")
+
+	var ok bool
+	if r, ok = h.authenticate(w, r); !ok {
+		return
+	}
+
+	// /vehicles/{vin}/... addresses one vehicle on any of the routes below
+	if vin, rest, ok := vehiclePath(r.URL.Path); ok {
+		client, err := h.vehicle(vin)
+		if err != nil {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+			return
+		}
+		r = withVehicle(r, client, rest)
+	}
+
+	// Async commands keep their body, to be held if the vehicle isn't
+	// connected
+	if h.offline != nil && wantsAsync(r) {
+		r = keepRequestBody(r)
+	}
+
+	if h.audit != nil && audited(r) {
+		h.audit.serve(w, r, h.route)
+		return
+	}
+	h.route(w, r)
+}
+
+// route dispatches a request to its handler
+func (h *APIHandler) route(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/status":
+		h.handleStatus(w, r)
+	case "/connect":
+		h.handleConnect(w, r)
+	case "/vehicles":
+		h.handleVehicles(w, r)
+	case "/vehicles/status":
+		h.handleVehiclesStatus(w, r)
+	case "/hvac/state":
+		h.handleHVACState(w, r)
+	case "/hvac/temperature":
+		h.handleTemperature(w, r)
+	case "/hvac/fan":
+		h.handleFanSpeed(w, r)
+	case "/hvac/airflow":
+		h.handleAirflow(w, r)
+	case "/hvac/auto":
+		h.handleAutoMode(w, r)
+	case "/hvac/climate":
+		h.handleClimate(w, r)
+	case "/hvac/climate/timer":
+		h.handleClimateTimer(w, r)
+	case "/hvac/overheat-protection":
+		h.handleOverheatProtection(w, r)
+	case "/hvac/keeper":
+		h.handleClimateKeeper(w, r)
+	case "/hvac/seats/heater", "/hvac/seats/cooler":
+		h.handleSeats(w, r)
+	case "/hvac/steering-wheel":
+		h.handleSteeringWheel(w, r)
+	case "/hvac/departure":
+		h.handleDeparture(w, r)
+	case "/charge/state":
+		h.handleChargeState(w, r)
+	case "/state":
+		h.handleVehicleSnapshot(w, r)
+	default:
+		if handler, ok := h.mounted(r.URL.Path); ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	}
+}
+
+// apiStatus is the response to GET /status
+type apiStatus struct {
+	Connected bool           `json:"connected"`
+	VIN       string         `json:"vin"`
+	Version   string         `json:"version"`
+	Timestamp string         `json:"timestamp"`
+	Update    *update.Status `json:"update,omitempty"` // Present when update checks are configured
+}
+
+// handleStatus returns the current connection status
+func (h *APIHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	status := apiStatus{
+		Connected: client.IsConnected(),
+		VIN:       client.GetVIN(),
+		Version:   version,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if h.updates != nil {
+		updateStatus := h.updates.Status()
+		status.Update = &updateStatus
+	}
+
+	writeData(w, http.StatusOK, status)
+}
+
+// vehicles returns the clients for all configured vehicles
+func (h *APIHandler) vehicles() []*tesla.Client {
+	return h.registry.Clients()
+}
+
+// vehicle returns the client for a VIN, or the only vehicle if vin is empty
+func (h *APIHandler) vehicle(vin string) (*tesla.Client, error) {
+	if vin == "" {
+		if h.registry.Len() == 1 {
+			return h.client, nil
+		}
+		return nil, fmt.Errorf("vin is required with %d vehicles", h.registry.Len())
+	}
+	if client, ok := h.registry.Get(vin); ok {
+		return client, nil
+	}
+	return nil, fmt.Errorf("unknown vehicle %q", vin)
+}
+
+// handleVehiclesStatus returns connection and key state for every configured
+// vehicle. Vehicles are checked in parallel, each bounded by its own timeout,
+// so one unreachable car doesn't block the response.
+func (h *APIHandler) handleVehiclesStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	timeout := defaultVehicleStatusTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "timeout must be a positive duration")
+			return
+		}
+		timeout = parsed
+	}
+
+	clients := h.vehicles()
+	statuses := make([]tesla.VehicleStatus, len(clients))
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *tesla.Client) {
+			defer wg.Done()
+			statuses[i] = vehicleStatusWithTimeout(r.Context(), client, timeout)
+		}(i, client)
+	}
+	wg.Wait()
+
+	writeData(w, http.StatusOK, statuses)
+}
+
+// vehicleStatusWithTimeout returns the vehicle's status, or a timed-out status
+// if the check doesn't complete in time
+func vehicleStatusWithTimeout(ctx context.Context, client *tesla.Client, timeout time.Duration) tesla.VehicleStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan tesla.VehicleStatus, 1)
+	go func() {
+		done <- client.Status(ctx)
+	}()
+
+	select {
+	case status := <-done:
+		return status
+	case <-ctx.Done():
+		return tesla.VehicleStatus{
+			VIN:       client.GetVIN(),
+			Connected: client.IsConnected(),
+			Error:     "status check timed out",
+			CheckedAt: time.Now(),
+		}
+	}
+}
+
+// handleConnect attempts to connect to the Tesla vehicle
+func (h *APIHandler) handleConnect(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	err := client.Connect(ctx, client.GetPrivateKeyFile())
+	
+	if err != nil {
+		h.logger.Printf("Connection failed: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+
+	writeMessage(w, http.StatusOK, "Connected successfully")
+}
+
+// handleHVACState returns the current HVAC state
+func (h *APIHandler) handleHVACState(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Long-poll mode: wait for a change relative to the client's ETag
+	if r.URL.Query().Get("wait") != "" {
+		h.handleHVACStateLongPoll(w, r)
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	var snapshot tesla.StateSnapshot
+	var err error
+	if wantsFreshState(r) {
+		_, err = client.GetHVACState(ctx)
+		snapshot, _ = client.LastState()
+	} else {
+		snapshot, err = client.CachedHVACState(ctx)
+	}
+	
+	if err != nil {
+		h.logger.Printf("Failed to get HVAC state: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+
+	setStateFreshness(w, snapshot.ReadAt)
+	writeStateData(w, r, snapshot.ETag, displayStateIn(snapshot.State, requestUnit(r)))
+}
+
+// wantsFreshState reports whether a state request bypasses the state cache,
+// with ?fresh=true or Cache-Control: no-cache
+func wantsFreshState(r *http.Request) bool {
+	if fresh, _ := strconv.ParseBool(r.URL.Query().Get("fresh")); fresh {
+		return true
+	}
+	return strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-cache")
+}
+
+// setStateFreshness reports when the state in a response was read from the
+// vehicle, as X-State-Read-At and the standard Age header
+func setStateFreshness(w http.ResponseWriter, readAt time.Time) {
+	if readAt.IsZero() {
+		return
+	}
+	w.Header().Set("X-State-Read-At", readAt.UTC().Format(time.RFC3339Nano))
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(readAt).Seconds())))
+}
+
+// handleHVACStateLongPoll implements GET /hvac/state?wait=30s&etag=... for
+// clients that can't hold a streaming connection. It responds as soon as the
+// state differs from the given ETag, or with 304 Not Modified once the wait
+// expires without a change.
+func (h *APIHandler) handleHVACStateLongPoll(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil || wait <= 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "wait must be a positive duration")
+		return
+	}
+	if wait > maxLongPollWait {
+		wait = maxLongPollWait
+	}
+
+	// Compare against the entity's tag regardless of which representation
+	// the client was sent
+	requested := strings.Trim(r.URL.Query().Get("etag"), `"`)
+	etag := baseETag(requested)
+
+	// Without a known ETag, or before any state has been read, there is
+	// nothing to compare against: fetch the current state
+	if _, ok := client.LastState(); !ok || etag == "" {
+		state, err := client.GetHVACState(r.Context())
+		if err != nil {
+			h.logger.Printf("Failed to get HVAC state: %v", err)
+			writeCommandError(w, err)
+			return
+		}
+		if snapshot, ok := client.LastState(); ok {
+			setStateFreshness(w, snapshot.ReadAt)
+		}
+		writeStateData(w, r, tesla.StateETag(state), displayStateIn(state, requestUnit(r)))
+		return
+	}
+
+	// Allow the response to be written after the server's default write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	snapshot, err := client.WaitForStateChange(ctx, etag)
+	if err != nil {
+		if r.Context().Err() != nil {
+			// Client went away
+			return
+		}
+		w.Header().Set("ETag", quoteETag(requested))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	setStateFreshness(w, snapshot.ReadAt)
+	writeStateData(w, r, snapshot.ETag, displayStateIn(snapshot.State, requestUnit(r)))
+}
+
+// displayState returns a copy of the state with temperatures converted from
+// Celsius to Fahrenheit for the frontend
+func displayState(state *tesla.HVACState) *tesla.HVACState {
+	converted := *state
+	converted.DriverTempCelsius = float32(celsiusToFahrenheit(float64(state.DriverTempCelsius)))
+	converted.PassengerTempCelsius = float32(celsiusToFahrenheit(float64(state.PassengerTempCelsius)))
+	converted.InsideTempCelsius = float32(celsiusToFahrenheit(float64(state.InsideTempCelsius)))
+	converted.OutsideTempCelsius = float32(celsiusToFahrenheit(float64(state.OutsideTempCelsius)))
+	return &converted
+}
+
+// displayStateIn returns the state with temperatures in the given unit
+func displayStateIn(state *tesla.HVACState, unit profile.Unit) *tesla.HVACState {
+	if unit == profile.UnitCelsius {
+		return state
+	}
+	return displayState(state)
+}
+
+// temperatureRequest is the body of POST /hvac/temperature
+type temperatureRequest struct {
+	DriverTemp    *float64 `json:"driver_temp"`    // Temperature in the user's unit, Fahrenheit by default
+	PassengerTemp *float64 `json:"passenger_temp"` // Temperature in the user's unit, Fahrenheit by default
+}
+
+// handleTemperature sets the temperature
+func (h *APIHandler) handleTemperature(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Parse request body
+	var req temperatureRequest
+
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	// Convert to Celsius for Tesla API. Omitted temperatures fall back to
+	// the user's preferences, and the passenger side defaults to the driver.
+	unit := requestUnit(r)
+	var preferences profile.Preferences
+	if user, ok := profile.FromContext(r.Context()); ok {
+		preferences = user.Preferences
+	}
+
+	var driverTempC, passengerTempC float64
+	switch {
+	case req.DriverTemp != nil:
+		driverTempC = toCelsius(*req.DriverTemp, unit)
+	case preferences.DriverTemp != 0:
+		driverTempC = preferences.DriverTemp
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "driver_temp is required")
+		return
+	}
+	switch {
+	case req.PassengerTemp != nil:
+		passengerTempC = toCelsius(*req.PassengerTemp, unit)
+	case req.DriverTemp == nil && preferences.PassengerTemp != 0:
+		passengerTempC = preferences.PassengerTemp
+	default:
+		passengerTempC = driverTempC
+	}
+
+	if err := validateTemperature("driver_temp", driverTempC, unit); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err := validateTemperature("passenger_temp", passengerTempC, unit); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	h.runCommand(context.WithoutCancel(r.Context()), w, r, "set temperature", "Temperature set successfully", func(ctx context.Context) error {
+		return client.SetTemperature(ctx, float32(driverTempC), float32(passengerTempC))
+	})
+}
+
+// fanSpeedRequest is the body of POST /hvac/fan
+type fanSpeedRequest struct {
+	Speed *int `json:"speed"` // 0 (off) to 10, or 11 for auto
+}
+
+// handleFanSpeed sets the fan speed
+func (h *APIHandler) handleFanSpeed(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Parse request body
+	var req fanSpeedRequest
+
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Speed == nil || *req.Speed < int(tesla.FanSpeedOff) || *req.Speed > int(tesla.FanSpeedAuto) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest,
+			fmt.Sprintf("speed must be between %d and %d", tesla.FanSpeedOff, tesla.FanSpeedAuto))
+		return
+	}
+
+	h.runCommand(context.WithoutCancel(r.Context()), w, r, "set fan speed", "Fan speed set successfully", func(ctx context.Context) error {
+		return client.SetFanSpeed(ctx, tesla.FanSpeed(*req.Speed))
+	})
+}
+
+// airflowRequest is the body of POST /hvac/airflow
+type airflowRequest struct {
+	Pattern string `json:"pattern"`
+}
+
+// handleAirflow sets the airflow pattern
+func (h *APIHandler) handleAirflow(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Parse request body
+	var req airflowRequest
+
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	// Convert string pattern to AirflowPattern
+	pattern, err := tesla.ParseAirflowPattern(req.Pattern)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid airflow pattern")
+		return
+	}
+
+	h.runCommand(context.WithoutCancel(r.Context()), w, r, "set airflow pattern", "Airflow pattern set successfully", func(ctx context.Context) error {
+		return client.SetAirflowPattern(ctx, pattern)
+	})
+}
+
+// autoModeRequest is the body of POST /hvac/auto
+type autoModeRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// handleAutoMode toggles auto mode
+func (h *APIHandler) handleAutoMode(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Parse request body
+	var req autoModeRequest
+
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Enabled == nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "enabled is required")
+		return
+	}
+
+	h.runCommand(context.WithoutCancel(r.Context()), w, r, "set auto mode", "Auto mode set successfully", func(ctx context.Context) error {
+		return client.SetAutoMode(ctx, *req.Enabled)
+	})
+}
+
+// overheatProtectionRequest is the body of POST /hvac/overheat-protection
+type overheatProtectionRequest struct {
+	Mode  *string `json:"mode"`  // off, no_ac or on
+	Limit *string `json:"limit"` // low, medium or high
+}
+
+// handleOverheatProtection returns or changes Cabin Overheat Protection.
+// POST takes a mode, a limit or both.
+func (h *APIHandler) handleOverheatProtection(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	ctx := r.Context()
+
+	switch r.Method {
+	case "GET":
+		state, err := client.GetHVACState(ctx)
+		if err != nil {
+			h.logger.Printf("Failed to get overheat protection: %v", err)
+			writeCommandError(w, err)
+			return
+		}
+		writeData(w, http.StatusOK, state.OverheatProtection)
+	case "POST":
+		var req overheatProtectionRequest
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.Mode == nil && req.Limit == nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "mode or limit is required")
+			return
+		}
+
+		var mode tesla.OverheatProtectionMode
+		var limit tesla.OverheatProtectionLimit
+		var err error
+		if req.Mode != nil {
+			if mode, err = tesla.ParseOverheatProtectionMode(*req.Mode); err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+				return
+			}
+		}
+		if req.Limit != nil {
+			if limit, err = tesla.ParseOverheatProtectionLimit(*req.Limit); err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+				return
+			}
+		}
+
+		h.runCommand(ctx, w, r, "set overheat protection", "Overheat protection set successfully", func(ctx context.Context) error {
+			// The limit is set first so protection starts at the new temperature
+			if limit != "" {
+				if err := client.SetCabinOverheatProtectionLimit(ctx, limit); err != nil {
+					return err
+				}
+			}
+			if mode != "" {
+				return client.SetCabinOverheatProtection(ctx, mode)
+			}
+			return nil
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// climateKeeperState is the response to GET /hvac/keeper
+type climateKeeperState struct {
+	Mode tesla.ClimateKeeperMode `json:"mode"`
+}
+
+// climateKeeperRequest is the body of POST /hvac/keeper
+type climateKeeperRequest struct {
+	Mode           *string `json:"mode"` // off, keep, dog or camp
+	ManualOverride bool    `json:"manual_override"`
+}
+
+// handleClimateKeeper returns or sets the climate keeper mode, which keeps
+// the cabin conditioned while parked (Keep, Dog and Camp Mode)
+func (h *APIHandler) handleClimateKeeper(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	ctx := r.Context()
+
+	switch r.Method {
+	case "GET":
+		state, err := client.GetHVACState(ctx)
+		if err != nil {
+			h.logger.Printf("Failed to get climate keeper mode: %v", err)
+			writeCommandError(w, err)
+			return
+		}
+		writeData(w, http.StatusOK, climateKeeperState{Mode: state.ClimateKeeperMode})
+	case "POST":
+		var req climateKeeperRequest
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.Mode == nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "mode is required")
+			return
+		}
+		mode, err := tesla.ParseClimateKeeperMode(*req.Mode)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+
+		h.runCommand(ctx, w, r, "set climate keeper mode", "Climate keeper mode set successfully", func(ctx context.Context) error {
+			return client.SetClimateKeeperMode(ctx, mode, req.ManualOverride)
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// seatRequest is the body of POST /hvac/seats/heater and /hvac/seats/cooler
+type seatRequest struct {
+	Seat  string `json:"seat"`  // A seat name such as front_left, or all
+	Level *int   `json:"level"` // 0 (off) to 3 (high)
+}
+
+// handleSeats sets a seat heater or cooler, or every seat's with "all"
+func (h *APIHandler) handleSeats(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	cooler := strings.HasSuffix(r.URL.Path, "/cooler")
+
+	var req seatRequest
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Level == nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "level is required")
+		return
+	}
+	if err := tesla.ValidateSeatLevel(*req.Level); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	seats := tesla.HeatedSeats
+	if cooler {
+		seats = tesla.CooledSeats
+	}
+	if req.Seat != "all" {
+		seat, err := tesla.ParseSeat(req.Seat)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		if cooler && seat != vehicle.SeatFrontLeft && seat != vehicle.SeatFrontRight {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Only the front seats have coolers")
+			return
+		}
+		seats = []vehicle.SeatPosition{seat}
+	}
+
+	level := vehicle.Level(*req.Level)
+	h.runCommand(r.Context(), w, r, "set seats", "Seats set successfully", func(ctx context.Context) error {
+		if cooler {
+			return client.SetSeatCoolers(ctx, seats, level)
+		}
+		return client.SetSeatHeaters(ctx, seats, level)
+	})
+}
+
+// steeringWheelState is the response to GET /hvac/steering-wheel
+type steeringWheelState struct {
+	Enabled bool                         `json:"enabled"`
+	Level   tesla.SteeringWheelHeatLevel `json:"level"`
+}
+
+// steeringWheelRequest is the body of POST /hvac/steering-wheel. The
+// vehicle picks the heat level, so there's only the on/off switch.
+type steeringWheelRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// handleSteeringWheel returns or sets the steering wheel heater
+func (h *APIHandler) handleSteeringWheel(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	ctx := r.Context()
+
+	switch r.Method {
+	case "GET":
+		state, err := client.GetHVACState(ctx)
+		if err != nil {
+			h.logger.Printf("Failed to get steering wheel heater: %v", err)
+			writeCommandError(w, err)
+			return
+		}
+		writeData(w, http.StatusOK, steeringWheelState{
+			Enabled: state.SteeringWheelHeater,
+			Level:   state.SteeringWheelHeatLevel,
+		})
+	case "POST":
+		var req steeringWheelRequest
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.Enabled == nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "enabled is required")
+			return
+		}
+
+		command := func(ctx context.Context) error {
+			return client.SetSteeringWheelHeater(ctx, *req.Enabled)
+		}
+		h.runCommand(ctx, w, r, "set steering wheel heater", "Steering wheel heater set successfully", command)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// climateRequest is the body of POST /hvac/climate
+type climateRequest struct {
+	On       *bool `json:"on"`
+	Duration int   `json:"duration,omitempty"` // Minutes until climate turns off again
+	tesla.ClimateConditions
+}
+
+// climateResult is the data of a response to turning climate on
+type climateResult struct {
+	Battery *tesla.ClimateImpact `json:"battery,omitempty"` // Predicted range impact
+}
+
+// handleClimate toggles climate control
+func (h *APIHandler) handleClimate(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Parse request body
+	var req climateRequest
+
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.On == nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "on is required")
+		return
+	}
+	if err := req.ClimateConditions.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	duration := time.Duration(req.Duration) * time.Minute
+	if req.Duration != 0 && (!*req.On || req.Duration < 0 || duration > tesla.MaxClimateDuration) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("duration must be 1 to %d minutes, with on", int(tesla.MaxClimateDuration.Minutes())))
+		return
+	}
+
+	user, hasUser := profile.FromContext(r.Context())
+	h.runCommandResult(context.WithoutCancel(r.Context()), w, r, "toggle climate", "Climate control toggled successfully", func(ctx context.Context) (interface{}, error) {
+		// Turning climate off, or on without a duration, ends an auto-off
+		// timer
+		if !*req.On {
+			if err := client.SetClimateOff(ctx); err != nil {
+				return nil, err
+			}
+			client.CancelClimateTimer()
+			return nil, nil
+		}
+		// Turning climate on applies the user's preferred temperatures
+		if hasUser && user.Preferences.DriverTemp != 0 {
+			driver, passenger := user.Preferences.DriverTemp, user.Preferences.PassengerTemp
+			if passenger == 0 {
+				passenger = driver
+			}
+			if err := client.SetTemperature(ctx, float32(driver), float32(passenger)); err != nil {
+				h.logger.Printf("Failed to apply preferred temperature for %s: %v", user.Username, err)
+				return nil, err
+			}
+		}
+		impact, err := client.StartClimate(ctx, req.ClimateConditions, duration)
+		if err != nil {
+			return nil, err
+		}
+		return climateResult{Battery: impact}, nil
+	})
+}
+
+// handleClimateTimer reports or cancels the pending auto-off set by turning
+// climate on with a duration
+func (h *APIHandler) handleClimateTimer(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	switch r.Method {
+	case "GET":
+		writeData(w, http.StatusOK, client.ClimateTimer())
+	case "DELETE":
+		if !client.CancelClimateTimer() {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "No climate timer")
+			return
+		}
+		writeMessage(w, http.StatusOK, "Climate timer cancelled")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// departureRequest is the body of POST /hvac/departure
+type departureRequest struct {
+	DepartureTime   string `json:"departure_time"`              // HH:MM
+	Preconditioning string `json:"preconditioning,omitempty"`   // off, all_week or weekdays
+	OffPeakCharging string `json:"off_peak_charging,omitempty"` // off, all_week or weekdays
+	OffPeakEndTime  string `json:"off_peak_end_time,omitempty"` // HH:MM
+}
+
+// handleDeparture returns, sets or clears the vehicle's own scheduled
+// departure
+func (h *APIHandler) handleDeparture(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	ctx := r.Context()
+
+	switch r.Method {
+	case "GET":
+		departure, err := client.GetScheduledDeparture(ctx)
+		if err != nil {
+			h.logger.Printf("Failed to get scheduled departure: %v", err)
+			writeCommandError(w, err)
+			return
+		}
+		writeData(w, http.StatusOK, departure)
+	case "POST":
+		var req departureRequest
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		departure := tesla.ScheduledDeparture{
+			Enabled:         true,
+			DepartureTime:   req.DepartureTime,
+			Preconditioning: req.Preconditioning,
+			OffPeakCharging: req.OffPeakCharging,
+			OffPeakEndTime:  req.OffPeakEndTime,
+		}
+		if err := departure.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+
+		h.runCommand(context.WithoutCancel(ctx), w, r, "set scheduled departure", "Scheduled departure set successfully", func(ctx context.Context) error {
+			return client.SetScheduledDeparture(ctx, departure)
+		})
+	case "DELETE":
+		h.runCommand(context.WithoutCancel(ctx), w, r, "clear scheduled departure", "Scheduled departure cleared", func(ctx context.Context) error {
+			return client.ClearScheduledDeparture(ctx)
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleChargeState reads the battery level, charge limit and charging
+// status from the vehicle
+func (h *APIHandler) handleChargeState(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	state, err := client.GetChargeState(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to get charge state: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+	writeStateData(w, r, tesla.ChargeStateETag(state), state)
+}
+
+// handleVehicleSnapshot reads the climate, charge and basic vehicle state
+// in one request to the vehicle
+func (h *APIHandler) handleVehicleSnapshot(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFor(r)
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	snapshot, err := client.GetVehicleSnapshot(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to get vehicle state: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, snapshot)
+}
+
+// parseJSON decodes a JSON request body into v. Unknown fields, trailing
+// data and bodies over maxRequestBodySize are rejected.
+func parseJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("request body is required")
+		}
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after JSON body")
+	}
+	return nil
+}
+
+// validateTemperature checks a Celsius setpoint is within the vehicle's
+// range, reporting the range in the user's unit
+func validateTemperature(name string, celsius float64, unit profile.Unit) error {
+	if celsius >= profile.MinTemp && celsius <= profile.MaxTemp {
+		return nil
+	}
+	if unit == profile.UnitCelsius {
+		return fmt.Errorf("%s must be between %.0f and %.0f°C", name, profile.MinTemp, profile.MaxTemp)
+	}
+	return fmt.Errorf("%s must be between %.0f and %.0f°F", name,
+		celsiusToFahrenheit(profile.MinTemp), celsiusToFahrenheit(profile.MaxTemp))
+}
+
+// toCelsius converts a temperature in unit to Celsius
+func toCelsius(temp float64, unit profile.Unit) float64 {
+	if unit == profile.UnitCelsius {
+		return temp
+	}
+	return fahrenheitToCelsius(temp)
+}
+
+// Temperature conversion functions
+func fahrenheitToCelsius(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+func celsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
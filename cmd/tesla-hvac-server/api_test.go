@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func newTestAPIHandler() *APIHandler {
+	logger := log.New(io.Discard, "", 0)
+	return NewAPIHandler(tesla.NewClient("TEST_VIN", logger), logger)
+}
+
+func TestVehiclesStatus(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	req := httptest.NewRequest("GET", "/vehicles/status?timeout=1s", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var env struct {
+		Data []tesla.VehicleStatus `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(env.Data) != 1 || env.Data[0].VIN != "TEST_VIN" {
+		t.Errorf("Unexpected statuses: %+v", env.Data)
+	}
+}
+
+func TestVehiclesStatusInvalidTimeout(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	req := httptest.NewRequest("GET", "/vehicles/status?timeout=soon", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHVACStateLongPollInvalidWait(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	req := httptest.NewRequest("GET", "/hvac/state?wait=forever", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHVACStateLongPollNotConnected(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	// With no prior state the long-poll falls back to a direct read
+	req := httptest.NewRequest("GET", "/hvac/state?wait=1s&etag=abc", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when not connected, got %d", rec.Code)
+	}
+}
+
+func TestWantsFreshState(t *testing.T) {
+	tests := []struct {
+		url          string
+		cacheControl string
+		want         bool
+	}{
+		{"/hvac/state", "", false},
+		{"/hvac/state?fresh=true", "", true},
+		{"/hvac/state?fresh=0", "", false},
+		{"/hvac/state", "no-cache", true},
+		{"/hvac/state", "max-age=0, No-Cache", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		if tt.cacheControl != "" {
+			req.Header.Set("Cache-Control", tt.cacheControl)
+		}
+		if got := wantsFreshState(req); got != tt.want {
+			t.Errorf("wantsFreshState(%s, %q) = %v, want %v", tt.url, tt.cacheControl, got, tt.want)
+		}
+	}
+}
+
+func TestSetStateFreshness(t *testing.T) {
+	rec := httptest.NewRecorder()
+	readAt := time.Now().Add(-3 * time.Second)
+	setStateFreshness(rec, readAt)
+
+	if got := rec.Header().Get("Age"); got != "3" {
+		t.Errorf("Expected Age 3, got %q", got)
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, rec.Header().Get("X-State-Read-At"))
+	if err != nil || !parsed.Equal(readAt) {
+		t.Errorf("Expected X-State-Read-At %v, got %q", readAt, rec.Header().Get("X-State-Read-At"))
+	}
+}
+
+func TestCommandBodyValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"empty body", "/hvac/fan", ""},
+		{"malformed", "/hvac/fan", `{"speed": `},
+		{"unknown field", "/hvac/fan", `{"speed": 3, "turbo": true}`},
+		{"trailing data", "/hvac/fan", `{"speed": 3} {"speed": 4}`},
+		{"wrong type", "/hvac/fan", `{"speed": "fast"}`},
+		{"fan speed missing", "/hvac/fan", `{}`},
+		{"fan speed out of range", "/hvac/fan", `{"speed": 12}`},
+		{"driver temp missing", "/hvac/temperature", `{"passenger_temp": 70}`},
+		{"driver temp too hot", "/hvac/temperature", `{"driver_temp": 90}`},
+		{"passenger temp too cold", "/hvac/temperature", `{"driver_temp": 70, "passenger_temp": 50}`},
+		{"unknown airflow", "/hvac/airflow", `{"pattern": "ceiling"}`},
+		{"auto mode missing", "/hvac/auto", `{}`},
+		{"climate missing", "/hvac/climate", `{"min_battery_level": 40}`},
+		{"climate bad condition", "/hvac/climate", `{"on": true, "min_battery_level": 101}`},
+		{"climate duration too long", "/hvac/climate", `{"on": true, "duration": 721}`},
+		{"climate negative duration", "/hvac/climate", `{"on": true, "duration": -5}`},
+		{"climate off with duration", "/hvac/climate", `{"on": false, "duration": 30}`},
+		{"overheat protection empty", "/hvac/overheat-protection", `{}`},
+		{"overheat protection bad mode", "/hvac/overheat-protection", `{"mode": "max"}`},
+		{"overheat protection bad limit", "/hvac/overheat-protection", `{"mode": "on", "limit": "scorching"}`},
+		{"keeper mode missing", "/hvac/keeper", `{"manual_override": true}`},
+		{"keeper bad mode", "/hvac/keeper", `{"mode": "cat"}`},
+		{"seat level missing", "/hvac/seats/heater", `{"seat": "front_left"}`},
+		{"seat level out of range", "/hvac/seats/heater", `{"seat": "all", "level": 4}`},
+		{"unknown seat", "/hvac/seats/heater", `{"seat": "trunk", "level": 1}`},
+		{"seat missing", "/hvac/seats/heater", `{"level": 1}`},
+		{"rear seat cooler", "/hvac/seats/cooler", `{"seat": "rear_left", "level": 1}`},
+		{"steering wheel empty", "/hvac/steering-wheel", `{}`},
+		{"steering wheel level", "/hvac/steering-wheel", `{"level": "high"}`},
+		{"departure time missing", "/hvac/departure", `{"preconditioning": "weekdays"}`},
+		{"departure bad time", "/hvac/departure", `{"departure_time": "7:30am"}`},
+		{"departure bad policy", "/hvac/departure", `{"departure_time": "07:30", "preconditioning": "sundays"}`},
+		{"departure off-peak without end", "/hvac/departure", `{"departure_time": "07:30", "off_peak_charging": "all_week"}`},
+	}
+
+	handler := newTestAPIHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected 400, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var env Envelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || len(env.Errors) != 1 {
+				t.Errorf("Expected an error envelope, got %s", rec.Body.String())
+			} else if env.Errors[0].Code != ErrCodeInvalidRequest {
+				t.Errorf("Expected %s, got %s", ErrCodeInvalidRequest, env.Errors[0].Code)
+			}
+		})
+	}
+}
+
+func TestClimateTimerEndpoint(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	req := httptest.NewRequest("GET", "/hvac/climate/timer", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"active":false`) {
+		t.Errorf("Expected no timer, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/hvac/climate/timer", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a timer, got %d", rec.Code)
+	}
+}
+
+func TestChargeStateEndpoint(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/charge/state", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when not connected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/charge/state", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
+
+func TestChargeStateConditionalAndFields(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = tesla.SimulatorVIN
+	config.Tesla.Transport = string(tesla.TransportSim)
+	client := tesla.NewClientFromConfig(config, logger)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	handler := NewAPIHandler(client, logger)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/charge/state", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d, %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/charge/state", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/charge/state?fields=battery_level", nil))
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := response.Data["battery_level"]; !ok || len(response.Data) != 1 {
+		t.Errorf("Expected only battery_level, got %s", rec.Body.String())
+	}
+}
+
+func TestVehicleSnapshotEndpoint(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/state", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when not connected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("DELETE", "/state", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
+
+func TestCommandBodyReachesVehicle(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	// A valid body passes validation and fails only because there's no vehicle
+	req := httptest.NewRequest("POST", "/hvac/temperature", strings.NewReader(`{"driver_temp": 70}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when not connected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBatteryGuardEntryPoints(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = tesla.SimulatorVIN
+	config.Tesla.Transport = string(tesla.TransportSim)
+	// The simulator's battery starts at 64%
+	config.BatteryGuard = tesla.BatteryGuardConfig{MinBatteryLevel: 90, Action: tesla.BatteryGuardRefuse}
+	client := tesla.NewClientFromConfig(config, logger)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	api := NewAPIHandler(client, logger)
+	schedules := NewScheduleHandler(api, nil, logger)
+	graphql := NewGraphQLHandler(api, logger)
+	ctx := context.Background()
+	temperature := float32(21)
+
+	entryPoints := map[string]func() error{
+		"SetClimateOn": func() error {
+			return client.SetClimateOn(ctx)
+		},
+		"climate_on schedule": func() error {
+			return schedules.action(ctx, schedule.Schedule{Action: schedule.ActionClimateOn})
+		},
+		"precondition schedule": func() error {
+			return schedules.action(ctx, schedule.Schedule{Action: schedule.ActionPrecondition, Temperature: &temperature})
+		},
+		"preset": func() error {
+			return applyPreset(ctx, client, profile.Preset{Name: "warm", DriverTemp: 22, ClimateOn: true})
+		},
+		"set_climate mutation": func() error {
+			body := `{"query": "mutation { set_climate(on: true) { vin } }"}`
+			rec := httptest.NewRecorder()
+			graphql.ServeHTTP(rec, httptest.NewRequest("POST", "/api/graphql", strings.NewReader(body)))
+			var resp struct {
+				Errors []gqlError `json:"errors"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Errors) == 0 {
+				return err
+			}
+			return fmt.Errorf("%w: %s", tesla.ErrClimateSkipped, resp.Errors[0].Message)
+		},
+	}
+	for name, start := range entryPoints {
+		if err := start(); !errors.Is(err, tesla.ErrClimateSkipped) || !strings.Contains(err.Error(), "below the guard") {
+			t.Errorf("Expected %s to be refused by the battery guard, got %v", name, err)
+		}
+	}
+
+	state, err := client.GetHVACState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.IsOn {
+		t.Error("Expected climate to stay off with the battery below the guard")
+	}
+}
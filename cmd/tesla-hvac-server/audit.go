@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/audit"
+	"github.com/teslamotors/vehicle-command/internal/profile"
+)
+
+// maxAuditParams bounds the request body recorded with an entry
+const maxAuditParams = 4 << 10
+
+// maxAuditResponse bounds how much of an error response is kept to find
+// its message
+const maxAuditResponse = 4 << 10
+
+// AuditLog records every API request that changes something and serves the
+// log at GET /audit
+type AuditLog struct {
+	api    *APIHandler
+	log    *audit.Log
+	logger *log.Logger
+}
+
+// NewAuditLog creates the audit log for the handler's requests
+func NewAuditLog(api *APIHandler, log *audit.Log, logger *log.Logger) *AuditLog {
+	return &AuditLog{
+		api:    api,
+		log:    log,
+		logger: logger,
+	}
+}
+
+// audited reports whether a request is recorded. Reads aren't, and neither
+// are logins, whose bodies hold passwords.
+func audited(r *http.Request) bool {
+	return !readOnly(r) && r.URL.Path != "/login"
+}
+
+// auditWriter keeps the status, and the start of an error body, of a response
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= 400 && w.body.Len() < maxAuditResponse {
+		w.body.Write(data[:min(len(data), maxAuditResponse-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *auditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serve runs next and records the request and its outcome
+func (a *AuditLog) serve(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+	entry := audit.Entry{
+		Time:     start,
+		Method:   r.Method,
+		Endpoint: r.URL.Path,
+		Query:    r.URL.RawQuery,
+	}
+	if client, err := a.api.requestVehicle(r); err == nil {
+		entry.VIN = client.GetVIN()
+	}
+	if user, ok := profile.FromContext(r.Context()); ok {
+		entry.Principal = user.Username
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.RemoteIP = host
+	}
+
+	// Read the body up to the handler's limit and hand it on unchanged
+	if r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err == nil && len(body) <= maxAuditParams {
+			entry.Params = audit.RedactParams(body)
+		}
+	}
+
+	recorder := &auditWriter{ResponseWriter: w}
+	next(recorder, r)
+
+	entry.LatencyMS = time.Since(start).Milliseconds()
+	entry.Status = recorder.status
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+	switch {
+	case entry.Status == http.StatusAccepted:
+		entry.Result = audit.ResultAccepted
+	case entry.Status < 400:
+		entry.Result = audit.ResultOK
+	default:
+		entry.Result = audit.ResultError
+		var env Envelope
+		if json.Unmarshal(recorder.body.Bytes(), &env) == nil && len(env.Errors) > 0 {
+			entry.Error = env.Errors[0].Message
+		}
+	}
+
+	if err := a.log.Record(entry); err != nil {
+		a.logger.Printf("Failed to record %s %s in the audit log: %v", entry.Method, entry.Endpoint, err)
+	}
+}
+
+// ServeHTTP implements http.Handler for GET /audit. ?since= and ?until= take
+// RFC 3339 times or a duration back from now, and ?user= and ?vin= filter
+// the entries, which are listed oldest first a page at a time. Once logins or
+// API keys are required, only admins may read the log.
+func (a *AuditLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/audit" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if a.api.authRequired() && !adminUser(r) {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Only admins can read the audit log")
+		return
+	}
+
+	historyQuery, err := parseHistoryQuery(r, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	entries := a.log.Query(audit.Query{
+		Since:     historyQuery.Since,
+		Until:     historyQuery.Until,
+		Principal: r.URL.Query().Get("user"),
+		VIN:       r.URL.Query().Get("vin"),
+	})
+	writeList(w, r, entries, func(entry audit.Entry) string {
+		return entry.Time.Format(time.RFC3339Nano) + " " + entry.Method + " " + entry.Endpoint
+	})
+}
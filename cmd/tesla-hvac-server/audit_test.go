@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/audit"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// withTestAudit records the handler's requests in an in-memory audit log
+func withTestAudit(t *testing.T, handler *APIHandler) *audit.Log {
+	t.Helper()
+	auditLog, err := audit.Open("", audit.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.audit = NewAuditLog(handler, auditLog, log.New(io.Discard, "", 0))
+	handler.Mount("/audit", handler.audit)
+	return auditLog
+}
+
+func TestAuditRecordsCommands(t *testing.T) {
+	handler := newTestAPIHandler()
+	auditLog := withTestAudit(t, handler)
+
+	// The vehicle isn't connected, so the command fails
+	rec := serveWithToken(handler, "POST", "/hvac/climate", "", `{"on": true}`)
+	if rec.Code == http.StatusOK {
+		t.Fatalf("Expected the command to fail, got %d", rec.Code)
+	}
+	serveWithToken(handler, "GET", "/hvac/climate/timer", "", "")
+
+	entries := auditLog.Query(audit.Query{})
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the command to be recorded, got %+v", entries)
+	}
+	entry := entries[0]
+	if entry.Method != "POST" || entry.Endpoint != "/hvac/climate" || entry.VIN != "TEST_VIN" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if string(entry.Params) != `{"on":true}` {
+		t.Errorf("Expected the request body as params, got %s", entry.Params)
+	}
+	if entry.Status != rec.Code || entry.Result != audit.ResultError || entry.Error == "" {
+		t.Errorf("Expected the failure to be recorded, got %+v", entry)
+	}
+}
+
+func TestAuditKeepsBodyForHandler(t *testing.T) {
+	handler := newTestAPIHandler()
+	withTestAudit(t, handler)
+
+	// The handler still sees, and rejects, the whole body
+	rec := serveWithToken(handler, "POST", "/hvac/fan", "", `{"speed": 42}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "speed") {
+		t.Errorf("Expected the handler to validate the body, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAuditPrincipalAndAccess(t *testing.T) {
+	handler, _ := newTestKeyAPI(t, []tesla.APIKey{
+		{Name: "automation", Key: "automation-key-01"},
+		{Name: "ops", Key: "ops-key-000000001", Role: "admin"},
+	})
+	auditLog := withTestAudit(t, handler)
+
+	serveWithToken(handler, "POST", "/hvac/climate", "automation-key-01", `{"on": false}`)
+	if entries := auditLog.Query(audit.Query{}); len(entries) != 1 || entries[0].Principal != "key:automation" {
+		t.Fatalf("Expected the key as the principal, got %+v", entries)
+	}
+
+	if rec := serveWithToken(handler, "GET", "/audit", "automation-key-01", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a driver, got %d", rec.Code)
+	}
+	rec := serveWithToken(handler, "GET", "/audit?user=key:automation", "ops-key-000000001", "")
+	var env struct {
+		Data []audit.Entry `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(env.Data) != 1 {
+		t.Errorf("Expected an admin to read the entry, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAuditPagination(t *testing.T) {
+	handler := newTestAPIHandler()
+	withTestAudit(t, handler)
+	serveWithToken(handler, "POST", "/hvac/climate", "", `{"on": true}`)
+	serveWithToken(handler, "POST", "/hvac/climate", "", `{"on": false}`)
+
+	page := func(target string) ([]audit.Entry, Meta) {
+		t.Helper()
+		rec := serveWithToken(handler, "GET", target, "", "")
+		var env struct {
+			Data []audit.Entry `json:"data"`
+			Meta Meta          `json:"meta"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", target, rec.Code, rec.Body.String())
+		}
+		return env.Data, env.Meta
+	}
+
+	first, meta := page("/audit?limit=1")
+	if len(first) != 1 || !strings.Contains(string(first[0].Params), "true") || !meta.HasMore {
+		t.Fatalf("Expected the oldest entry and more to come, got %+v, %+v", first, meta)
+	}
+	second, meta := page("/audit?limit=1&cursor=" + meta.NextCursor)
+	if len(second) != 1 || !strings.Contains(string(second[0].Params), "false") || meta.HasMore {
+		t.Errorf("Expected the newest entry last, got %+v, %+v", second, meta)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// APIKeyAuth authenticates requests with the configured API keys, from the
+// config file or TESLA_API_KEYS. Keys are read from the config on every
+// request, so adding, removing or rotating a key applies as soon as the
+// config is reloaded.
+type APIKeyAuth struct {
+	config func() *tesla.Config
+	logger *log.Logger
+}
+
+// NewAPIKeyAuth creates key authentication backed by the config manager
+func NewAPIKeyAuth(configManager *tesla.ConfigManager, logger *log.Logger) *APIKeyAuth {
+	configManager.RegisterCallback(func(oldConfig, newConfig *tesla.Config) error {
+		if !sameKeys(oldConfig.APIKeys, newConfig.APIKeys) {
+			logger.Printf("API keys changed: %d configured", len(newConfig.APIKeys))
+		}
+		return nil
+	})
+	return &APIKeyAuth{config: configManager.GetConfig, logger: logger}
+}
+
+// NewEnvAPIKeyAuth creates key authentication for a server without a config
+// file, with the keys TESLA_API_KEYS set in config
+func NewEnvAPIKeyAuth(config *tesla.Config, logger *log.Logger) *APIKeyAuth {
+	return &APIKeyAuth{config: func() *tesla.Config { return config }, logger: logger}
+}
+
+// enabled reports whether any key is configured, in which case every API
+// request needs a key or a login
+func (a *APIKeyAuth) enabled() bool {
+	return a != nil && len(a.config().APIKeys) > 0
+}
+
+// user returns a profile standing in for the key the request carries, as an
+// X-API-Key header or a bearer token
+func (a *APIKeyAuth) user(r *http.Request) (profile.Profile, bool) {
+	if a == nil {
+		return profile.Profile{}, false
+	}
+	presented := r.Header.Get("X-API-Key")
+	if presented == "" {
+		presented = bearerToken(r)
+	}
+	if presented == "" {
+		return profile.Profile{}, false
+	}
+	key, ok := a.config().FindAPIKey(presented)
+	if !ok {
+		return profile.Profile{}, false
+	}
+	return profile.Profile{
+		Username:    "key:" + key.Name,
+		DisplayName: key.Name,
+		Role:        profile.Role(key.KeyRole()),
+	}, true
+}
+
+// sameKeys reports whether two key lists are identical
+func sameKeys(a, b []tesla.APIKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// authRequired reports whether requests must carry an API key or a login,
+// which is once a key or a user exists
+func (h *APIHandler) authRequired() bool {
+	return h.keys.enabled() || (h.profiles != nil && h.profiles.required())
+}
+
+// warnUnauthenticated logs a warning, and reports true, when the API is
+// served to anyone who can reach it
+func (h *APIHandler) warnUnauthenticated(logger *log.Logger) bool {
+	if h.authRequired() {
+		return false
+	}
+	logger.Printf("warn: The API is serving without authentication; set api_keys or TESLA_API_KEYS, or create a user")
+	return true
+}
+
+// requestUser returns the profile for the request's API key or login
+func (h *APIHandler) requestUser(r *http.Request) (profile.Profile, bool) {
+	if user, ok := h.keys.user(r); ok {
+		return user, true
+	}
+	if h.profiles != nil {
+		return h.profiles.user(r)
+	}
+	return profile.Profile{}, false
+}
+
+// authenticate attaches the caller's profile to the request and checks their
+// role allows it. It writes an error response and returns false if the
+// request may not proceed.
+func (h *APIHandler) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !h.authRequired() || r.URL.Path == "/login" {
+		return r, true
+	}
+
+	user, ok := h.requestUser(r)
+	if !ok {
+		// The admin API checks its own token
+		if r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			return r, true
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "API key or login required")
+		return r, false
+	}
+
+	if !user.Role.CanControl() && !readOnly(r) {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Your role can't control the vehicle")
+		return r, false
+	}
+	return r.WithContext(profile.WithProfile(r.Context(), user)), true
+}
+
+// apiKeyInfo describes a key without revealing it
+type apiKeyInfo struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Hashed bool   `json:"hashed"`
+}
+
+// apiKeyRequest is the body of POST /admin/api-keys
+type apiKeyRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role,omitempty"`
+}
+
+// newAPIKey is a key's secret, returned only when the key is created or
+// rotated
+type newAPIKey struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Key  string `json:"key"`
+}
+
+// serveAPIKeys lists, creates, rotates and deletes API keys in the config
+// file. New keys are stored hashed and returned only in the response that
+// creates them.
+func (h *AdminHandler) serveAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "API keys need a config file")
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/api-keys"), "/")
+	name, rotate := strings.CutSuffix(name, "/rotate")
+
+	switch {
+	case name == "" && r.Method == "GET":
+		keys := h.configManager.GetConfig().APIKeys
+		infos := make([]apiKeyInfo, 0, len(keys))
+		for _, key := range keys {
+			infos = append(infos, apiKeyInfo{Name: key.Name, Role: key.KeyRole(), Hashed: strings.HasPrefix(key.Key, "sha256:")})
+		}
+		writeData(w, http.StatusOK, infos)
+	case name == "" && r.Method == "POST":
+		var req apiKeyRequest
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if _, ok := findKey(h.configManager.GetConfig().APIKeys, req.Name); ok {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRequest, "API key already exists")
+			return
+		}
+		h.storeAPIKey(w, tesla.APIKey{Name: req.Name, Role: req.Role}, http.StatusCreated)
+	case name == "":
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	case rotate && r.Method == "POST":
+		key, ok := findKey(h.configManager.GetConfig().APIKeys, name)
+		if !ok {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "Unknown API key "+name)
+			return
+		}
+		h.storeAPIKey(w, key, http.StatusOK)
+	case !rotate && r.Method == "DELETE":
+		if _, ok := findKey(h.configManager.GetConfig().APIKeys, name); !ok {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "Unknown API key "+name)
+			return
+		}
+		err := h.configManager.UpdateConfig(func(config *tesla.Config) {
+			keys := make([]tesla.APIKey, 0, len(config.APIKeys))
+			for _, key := range config.APIKeys {
+				if key.Name != name {
+					keys = append(keys, key)
+				}
+			}
+			config.APIKeys = keys
+		})
+		if err != nil {
+			h.logger.Printf("Failed to delete API key: %v", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save API keys")
+			return
+		}
+		h.logger.Printf("API key %s deleted", name)
+		writeMessage(w, http.StatusOK, "API key deleted")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// storeAPIKey gives a key a new secret, replacing the key of the same name
+// if there is one, and returns the secret
+func (h *AdminHandler) storeAPIKey(w http.ResponseWriter, key tesla.APIKey, status int) {
+	secret, err := tesla.GenerateAPIKey()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	key.Key = tesla.HashAPIKey(secret)
+	if err := key.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	err = h.configManager.UpdateConfig(func(config *tesla.Config) {
+		keys := make([]tesla.APIKey, 0, len(config.APIKeys)+1)
+		for _, existing := range config.APIKeys {
+			if existing.Name != key.Name {
+				keys = append(keys, existing)
+			}
+		}
+		config.APIKeys = append(keys, key)
+	})
+	if err != nil {
+		h.logger.Printf("Failed to save API key: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save API keys")
+		return
+	}
+	h.logger.Printf("API key %s saved", key.Name)
+	writeData(w, status, newAPIKey{Name: key.Name, Role: key.KeyRole(), Key: secret})
+}
+
+// findKey returns the key with a name
+func findKey(keys []tesla.APIKey, name string) (tesla.APIKey, bool) {
+	for _, key := range keys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return tesla.APIKey{}, false
+}
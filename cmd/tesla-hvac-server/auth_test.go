@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newTestKeyAPI serves the API with keys from a temporary config file
+func newTestKeyAPI(t *testing.T, keys []tesla.APIKey) (*APIHandler, *tesla.ConfigManager) {
+	t.Helper()
+
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.APIKeys = keys
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	configManager, err := tesla.NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configManager.Close() })
+
+	logger := log.New(io.Discard, "", 0)
+	handler := newTestAPIHandler()
+	handler.keys = NewAPIKeyAuth(configManager, logger)
+	handler.Mount("/admin", NewAdminHandler(handler.client, configManager, "secret", logger))
+	return handler, configManager
+}
+
+func TestAPIKeysOpenWithoutKeys(t *testing.T) {
+	handler, _ := newTestKeyAPI(t, nil)
+
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 without configured keys, got %d", rec.Code)
+	}
+}
+
+func TestEnvAPIKeys(t *testing.T) {
+	t.Setenv("TESLA_API_KEYS", "automation=automation-key-01")
+	config := tesla.DefaultConfig()
+	if err := config.LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestAPIHandler()
+	var logs strings.Builder
+	logger := log.New(&logs, "", 0)
+
+	// Without a config file, the environment's keys are required
+	handler.keys = NewEnvAPIKeyAuth(config, logger)
+	if handler.warnUnauthenticated(logger) {
+		t.Errorf("Expected no warning with a key, got %q", logs.String())
+	}
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "GET", "/status", "automation-key-01", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with the key, got %d", rec.Code)
+	}
+
+	handler.keys = NewEnvAPIKeyAuth(tesla.DefaultConfig(), logger)
+	if !handler.warnUnauthenticated(logger) || !strings.Contains(logs.String(), "without authentication") {
+		t.Errorf("Expected a warning without keys, got %q", logs.String())
+	}
+}
+
+func TestAPIKeysRequired(t *testing.T) {
+	handler, _ := newTestKeyAPI(t, []tesla.APIKey{
+		{Name: "dashboard", Key: "dashboard-key-0001", Role: "viewer"},
+		{Name: "automation", Key: tesla.HashAPIKey("automation-key-01")},
+	})
+
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "GET", "/status", "wrong-key", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong key, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "GET", "/status", "dashboard-key-0001", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with a bearer key, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "POST", "/hvac/fan", "dashboard-key-0001", `{"speed": 3}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a viewer key command, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("X-API-Key", "automation-key-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with a hashed key in X-API-Key, got %d", rec.Code)
+	}
+
+	// The admin token still reaches the admin API
+	if rec := serveWithToken(handler, "GET", "/admin/api-keys", "secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the admin token, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeysRotate(t *testing.T) {
+	handler, configManager := newTestKeyAPI(t, []tesla.APIKey{
+		{Name: "dashboard", Key: "dashboard-key-0001"},
+	})
+
+	rec := serveWithToken(handler, "POST", "/admin/api-keys/dashboard/rotate", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Key string `json:"key"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	// The new key works at once and only its digest is saved
+	if rec := serveWithToken(handler, "GET", "/status", "dashboard-key-0001", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old key to stop working, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "GET", "/status", resp.Data.Key, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the new key to work, got %d", rec.Code)
+	}
+	if saved := configManager.GetConfig().APIKeys[0].Key; saved != tesla.HashAPIKey(resp.Data.Key) {
+		t.Errorf("Expected the key's digest to be saved, got %q", saved)
+	}
+
+	if rec := serveWithToken(handler, "POST", "/admin/api-keys", "secret", `{"name": "dashboard"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an existing key, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "DELETE", "/admin/api-keys/dashboard", "secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the API to open once no keys remain, got %d", rec.Code)
+	}
+}
+
+func TestAPIKeysReload(t *testing.T) {
+	handler, configManager := newTestKeyAPI(t, nil)
+
+	config := *configManager.GetConfig()
+	config.APIKeys = []tesla.APIKey{{Name: "new", Key: "reloaded-key-00001"}}
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := configManager.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after keys are added, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "GET", "/status", "reloaded-key-00001", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the reloaded key to work, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// authStatus is the body of GET /auth/status
+type authStatus struct {
+	// Enabled is whether any vehicle uses the Fleet API and so needs a token
+	Enabled bool                `json:"enabled"`
+	Tokens  []tesla.TokenStatus `json:"tokens"`
+}
+
+// AuthStatusHandler reports the health of the Fleet API's OAuth tokens at
+// GET /auth/status, so an expiring or unrefreshable token is noticed before
+// commands start failing
+type AuthStatusHandler struct {
+	oauth  *tesla.OAuthManager // nil when no vehicle uses the Fleet API
+	logger *log.Logger
+}
+
+// NewAuthStatusHandler creates an auth status handler
+func NewAuthStatusHandler(oauth *tesla.OAuthManager, logger *log.Logger) *AuthStatusHandler {
+	return &AuthStatusHandler{oauth: oauth, logger: logger}
+}
+
+// ServeHTTP implements http.Handler for /auth
+func (h *AuthStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/auth/status" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	status := authStatus{Enabled: h.oauth != nil, Tokens: []tesla.TokenStatus{}}
+	if h.oauth != nil {
+		tokens, err := h.oauth.TokenStatuses()
+		if err != nil {
+			h.logger.Printf("Failed to read OAuth tokens: %v", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+			return
+		}
+		status.Tokens = tokens
+	}
+	writeData(w, http.StatusOK, status)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestAuthStatus(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	status := func(handler *AuthStatusHandler) authStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/auth/status", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Data authStatus `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Data
+	}
+
+	if s := status(NewAuthStatusHandler(nil, logger)); s.Enabled || s.Tokens == nil || len(s.Tokens) != 0 {
+		t.Errorf("Expected no tokens without the Fleet API, got %+v", s)
+	}
+
+	oauth := tesla.NewOAuthManagerWithKeyring(keyring.NewArrayKeyring(nil), logger)
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := oauth.StoreToken("default", &tesla.OAuthToken{AccessToken: "access", RefreshToken: "refresh", ExpiresAt: expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+	s := status(NewAuthStatusHandler(oauth, logger))
+	if !s.Enabled || len(s.Tokens) != 1 {
+		t.Fatalf("Expected one token, got %+v", s)
+	}
+	if token := s.Tokens[0]; token.Name != "default" || !token.ExpiresAt.Equal(expiresAt) || !token.Valid || !token.Refreshable || token.LastRefresh != nil {
+		t.Errorf("Unexpected token status %+v", token)
+	}
+
+	rec := httptest.NewRecorder()
+	NewAuthStatusHandler(oauth, logger).ServeHTTP(rec, httptest.NewRequest("POST", "/auth/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// serveCircuit shows a vehicle's circuit breaker on GET /admin/circuit, and
+// resets or trips it on POST /admin/circuit/reset and /admin/circuit/trip.
+// The vehicle is the one in the request path, as in
+// /vehicles/{vin}/admin/circuit, or the default one.
+func (h *AdminHandler) serveCircuit(w http.ResponseWriter, r *http.Request) {
+	client := h.client
+	if vehicle, ok := vehicleFromContext(r.Context()); ok {
+		client = vehicle
+	}
+
+	if r.URL.Path == "/admin/circuit" {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+	} else {
+		if r.Method != "POST" {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if r.URL.Path == "/admin/circuit/reset" {
+			client.ResetCircuit()
+		} else {
+			client.TripCircuit()
+		}
+		h.logger.Printf("Circuit breaker for %s is %s via admin API", client.GetVIN(), client.CircuitStatus().State)
+	}
+	writeData(w, http.StatusOK, circuitInfo{VIN: client.GetVIN(), CircuitStatus: client.CircuitStatus()})
+}
+
+// circuitInfo is a vehicle's circuit breaker
+type circuitInfo struct {
+	VIN string `json:"vin"`
+	tesla.CircuitStatus
+}
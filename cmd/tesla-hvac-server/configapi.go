@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// redactedValue replaces secrets in the config the API returns. Sending it
+// back in a PUT or PATCH keeps the stored secret.
+const redactedValue = "[redacted]"
+
+// configFieldError is a detail of a rejected config
+type configFieldError struct {
+	Field   string `json:"field,omitempty"` // Such as retry.max_delay
+	Message string `json:"message"`
+}
+
+// configErrorField matches the field a validation error starts with, as in
+// "retry.max_delay must be positive" or "tesla.transport: unknown transport"
+var configErrorField = regexp.MustCompile(`^([a-z0-9_]+(?:\.[a-z0-9_]+|\[\d+\])*)(?::| must | is | needs )`)
+
+// profileInfo is the active config profile and the ones to choose from
+type profileInfo struct {
+	Active   string   `json:"active"` // "" when none is
+	Profiles []string `json:"profiles"`
+}
+
+// profileRequest switches the config profile
+type profileRequest struct {
+	Name string `json:"name"` // "" for none
+}
+
+// serveConfig serves /config, /config/reload and /config/profile
+func (h *AdminHandler) serveConfig(w http.ResponseWriter, r *http.Request) {
+	if h.configManager == nil {
+		writeError(w, http.StatusConflict, ErrCodeConditionsNotMet, "The server was started without a config file")
+		return
+	}
+	if r.URL.Path == "/config/reload" {
+		if r.Method != "POST" {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if err := h.configManager.Reload(); err != nil {
+			// Reload wraps the error Validate or the parser returned
+			writeConfigError(w, err.Error(), errors.Unwrap(err))
+			return
+		}
+		h.logger.Printf("Configuration reloaded via admin API")
+		writeData(w, http.StatusOK, redactConfig(h.configManager.BaseConfig()))
+		return
+	}
+	if r.URL.Path == "/config/profile" {
+		h.serveProfile(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeData(w, http.StatusOK, redactConfig(h.configManager.BaseConfig()))
+	case "PUT", "PATCH":
+		h.updateConfig(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// updateConfig replaces the config with the body of a PUT, in which missing
+// fields take their defaults, or merges the body of a PATCH over it as a JSON
+// merge patch (RFC 7386), then validates and saves it. Both edit the config
+// as it's saved, without its profile applied.
+func (h *AdminHandler) updateConfig(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if err := parseJSON(w, r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	current, err := configMap(h.configManager.BaseConfig())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	if err := restoreSecrets(body, current, ""); err != nil {
+		writeConfigError(w, "Invalid configuration", err)
+		return
+	}
+	if r.Method == "PATCH" {
+		body = tesla.MergePatch(current, body).(map[string]interface{})
+	}
+
+	config, err := decodeConfig(body)
+	if err != nil {
+		writeConfigError(w, "Invalid configuration", err)
+		return
+	}
+	if err := config.Validate(); err != nil {
+		writeConfigError(w, "Invalid configuration", err)
+		return
+	}
+	err = h.configManager.UpdateConfig(func(c *tesla.Config) {
+		config.ConfigPath = c.ConfigPath
+		*c = *config
+	})
+	if err != nil {
+		h.logger.Printf("Failed to save configuration: %v", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save configuration")
+		return
+	}
+	h.logger.Printf("Configuration updated via admin API")
+	writeData(w, http.StatusOK, redactConfig(h.configManager.BaseConfig()))
+}
+
+// serveProfile shows the config profiles, and switches to another on a PUT.
+// The switch is saved, and applied to the vehicles like any config change.
+func (h *AdminHandler) serveProfile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var req profileRequest
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if _, ok := h.configManager.BaseConfig().Profiles[req.Name]; req.Name != "" && !ok {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("Profile %q is not defined", req.Name))
+			return
+		}
+		if err := h.configManager.SwitchProfile(req.Name); err != nil {
+			h.logger.Printf("Failed to switch profile: %v", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to switch profile")
+			return
+		}
+		h.logger.Printf("Switched to profile %q via admin API", req.Name)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	config := h.configManager.BaseConfig()
+	writeData(w, http.StatusOK, profileInfo{Active: config.Profile, Profiles: config.ProfileNames()})
+}
+
+// writeConfigError rejects a config, with the field err is about if it's
+// known
+func writeConfigError(w http.ResponseWriter, message string, err error) {
+	details := []configFieldError{}
+	if err != nil {
+		detail := configFieldError{Message: strings.TrimPrefix(err.Error(), "json: ")}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			detail.Field = typeErr.Field
+		} else if m := configErrorField.FindStringSubmatch(detail.Message); m != nil {
+			detail.Field = m[1]
+		}
+		details = append(details, detail)
+	}
+	writeErrorDetails(w, http.StatusUnprocessableEntity, ErrCodeInvalidRequest, message, details)
+}
+
+// configMap returns config as it's saved, as generic JSON
+func configMap(config *tesla.Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return m, nil
+}
+
+// decodeConfig decodes generic JSON over the defaults, rejecting unknown
+// fields
+func decodeConfig(m map[string]interface{}) (*tesla.Config, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	config := tesla.DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// redactConfig returns config as generic JSON with its secrets replaced by
+// redactedValue
+func redactConfig(config *tesla.Config) interface{} {
+	m, err := configMap(config)
+	if err != nil {
+		return nil
+	}
+	redactSecrets(m)
+	return m
+}
+
+func redactSecrets(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if !tesla.IsSecretField(key) {
+				redactSecrets(value)
+				continue
+			}
+			switch value := value.(type) {
+			case string:
+				if value != "" {
+					v[key] = redactedValue
+				}
+			case map[string]interface{}:
+				for name := range value {
+					value[name] = redactedValue
+				}
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			redactSecrets(item)
+		}
+	}
+}
+
+// restoreSecrets replaces each redactedValue in v with the value at the same
+// place in current, the config as stored
+func restoreSecrets(v, current interface{}, path string) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		stored, _ := current.(map[string]interface{})
+		for key, value := range v {
+			field := key
+			if path != "" {
+				field = path + "." + key
+			}
+			if value == redactedValue {
+				storedValue, _ := stored[key].(string)
+				if storedValue == "" {
+					return fmt.Errorf("%s: %s can only be sent for a stored secret", field, redactedValue)
+				}
+				v[key] = storedValue
+				continue
+			}
+			if err := restoreSecrets(value, stored[key], field); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		stored, _ := current.([]interface{})
+		for i, item := range v {
+			var storedItem interface{}
+			if i < len(stored) {
+				storedItem = stored[i]
+			}
+			if err := restoreSecrets(item, storedItem, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newTestConfigAPI serves /config from a temporary config file holding an
+// SMTP password
+func newTestConfigAPI(t *testing.T) (*APIHandler, *tesla.ConfigManager) {
+	t.Helper()
+
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Tesla.PrivateKeyFile = "/etc/tesla/private.pem"
+	config.Notifications.SMTP = &notify.SMTPConfig{
+		Host: "smtp.example.com", Port: 587, From: "hvac@example.com",
+		To: []string{"me@example.com"}, Username: "hvac", Password: "hunter2",
+	}
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	configManager, err := tesla.NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configManager.Close() })
+
+	handler := newTestAPIHandler()
+	handler.Mount("/config", NewAdminHandler(handler.client, configManager, "secret", log.New(io.Discard, "", 0)))
+	return handler, configManager
+}
+
+// decodeConfigData decodes the config in a response's envelope
+func decodeConfigData(t *testing.T, body []byte) map[string]interface{} {
+	t.Helper()
+	var envelope struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	return envelope.Data
+}
+
+func TestConfigAPIRedactsSecrets(t *testing.T) {
+	handler, _ := newTestConfigAPI(t)
+
+	if rec := serveWithToken(handler, "GET", "/config", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Without the admin token: expected 401, got %d", rec.Code)
+	}
+	rec := serveWithToken(handler, "GET", "/config", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	config := decodeConfigData(t, rec.Body.Bytes())
+	tesla := config["tesla"].(map[string]interface{})
+	smtp := config["notifications"].(map[string]interface{})["smtp"].(map[string]interface{})
+	if tesla["private_key_file"] != redactedValue || smtp["password"] != redactedValue {
+		t.Errorf("Secrets not redacted: key %v, password %v", tesla["private_key_file"], smtp["password"])
+	}
+	if tesla["vin"] != "TEST_VIN" || smtp["host"] != "smtp.example.com" {
+		t.Errorf("Settings redacted: vin %v, host %v", tesla["vin"], smtp["host"])
+	}
+}
+
+func TestConfigAPIPatch(t *testing.T) {
+	handler, configManager := newTestConfigAPI(t)
+
+	rec := serveWithToken(handler, "PATCH", "/config", "secret",
+		`{"retry": {"max_retries": 7}, "notifications": {"smtp": {"password": "[redacted]", "port": 465}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	config := configManager.GetConfig()
+	if config.Retry.MaxRetries != 7 || config.Notifications.SMTP.Port != 465 {
+		t.Errorf("Patch not applied: retries %d, port %d", config.Retry.MaxRetries, config.Notifications.SMTP.Port)
+	}
+	if config.Notifications.SMTP.Password != "hunter2" || config.Tesla.PrivateKeyFile != "/etc/tesla/private.pem" {
+		t.Errorf("Secrets not kept: password %q, key %q", config.Notifications.SMTP.Password, config.Tesla.PrivateKeyFile)
+	}
+	saved, err := tesla.LoadConfig(config.ConfigPath)
+	if err != nil || saved.Retry.MaxRetries != 7 {
+		t.Errorf("Patch not saved: %v", err)
+	}
+}
+
+func TestConfigAPIPut(t *testing.T) {
+	handler, configManager := newTestConfigAPI(t)
+
+	rec := serveWithToken(handler, "PUT", "/config", "secret", `{"tesla": {"vin": "NEW_VIN"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	config := configManager.GetConfig()
+	if config.Tesla.VIN != "NEW_VIN" || config.Notifications.SMTP != nil {
+		t.Errorf("Config not replaced: vin %q, smtp %v", config.Tesla.VIN, config.Notifications.SMTP)
+	}
+	if config.Retry.MaxRetries != tesla.DefaultConfig().Retry.MaxRetries {
+		t.Errorf("Missing field didn't take its default: %d", config.Retry.MaxRetries)
+	}
+}
+
+func TestConfigAPIRejectsInvalidConfig(t *testing.T) {
+	for _, test := range []struct {
+		body, field string
+	}{
+		{`{"retry": {"max_retries": -1}}`, "retry.max_retries"},
+		{`{"retry": {"max_retries": "many"}}`, "retry.max_retries"},
+		{`{"tesla": {"transport": "carrier-pigeon"}}`, "tesla.transport"},
+		{`{"tesla": {"oauth_token_file": "[redacted]"}}`, "tesla.oauth_token_file"},
+		{`{"no_such_section": {}}`, ""},
+	} {
+		handler, configManager := newTestConfigAPI(t)
+		rec := serveWithToken(handler, "PATCH", "/config", "secret", test.body)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected 422, got %d: %s", test.body, rec.Code, rec.Body.String())
+			continue
+		}
+		var envelope Envelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if len(envelope.Errors) != 1 {
+			t.Fatalf("%s: expected one error, got %v", test.body, envelope.Errors)
+		}
+		details, _ := envelope.Errors[0].Details.([]interface{})
+		if len(details) != 1 {
+			t.Errorf("%s: expected one detail, got %v", test.body, envelope.Errors[0].Details)
+			continue
+		}
+		if field, _ := details[0].(map[string]interface{})["field"].(string); field != test.field {
+			t.Errorf("%s: field %q, want %q", test.body, field, test.field)
+		}
+		if configManager.GetConfig().Retry.MaxRetries < 0 {
+			t.Errorf("%s: invalid config applied", test.body)
+		}
+	}
+}
+
+func TestConfigAPIReload(t *testing.T) {
+	handler, configManager := newTestConfigAPI(t)
+	path := configManager.GetConfig().ConfigPath
+
+	if err := os.WriteFile(path, []byte(`{"tesla": {"vin": ""}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec := serveWithToken(handler, "POST", "/config/reload", "secret", "")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected 422, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	config := *tesla.DefaultConfig()
+	config.Tesla.VIN = "RELOADED_VIN"
+	config.ConfigPath = path
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	rec = serveWithToken(handler, "POST", "/config/reload", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if vin := configManager.GetConfig().Tesla.VIN; vin != "RELOADED_VIN" {
+		t.Errorf("VIN = %q after reload", vin)
+	}
+}
+
+func TestConfigAPIProfile(t *testing.T) {
+	handler, configManager := newTestConfigAPI(t)
+
+	rec := serveWithToken(handler, "PATCH", "/config", "secret",
+		`{"profiles": {"garage": {"tesla": {"request_timeout": 60000000000}}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Adding a profile: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveWithToken(handler, "PUT", "/config/profile", "secret", `{"name": "garage"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var envelope struct {
+		Data profileInfo `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.Data.Active != "garage" || len(envelope.Data.Profiles) != 1 {
+		t.Errorf("Profile info = %+v", envelope.Data)
+	}
+	if timeout := configManager.GetConfig().Tesla.RequestTimeout; timeout != time.Minute {
+		t.Errorf("Request timeout %v after switching to garage", timeout)
+	}
+
+	// The config the API edits is the one saved, without the profile applied
+	config := decodeConfigData(t, serveWithToken(handler, "GET", "/config", "secret", "").Body.Bytes())
+	if timeout := config["tesla"].(map[string]interface{})["request_timeout"]; timeout == float64(time.Minute) {
+		t.Error("GET /config returned the config with the profile applied")
+	}
+
+	if rec := serveWithToken(handler, "PUT", "/config/profile", "secret", `{"name": "office"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Undefined profile: expected 404, got %d", rec.Code)
+	}
+}
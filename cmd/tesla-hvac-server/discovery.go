@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// defaultDiscoveryDuration is how long GET /discovery listens for
+	// beacons without ?duration
+	defaultDiscoveryDuration = 10 * time.Second
+	// maxDiscoveryDuration is the longest ?duration allowed
+	maxDiscoveryDuration = time.Minute
+)
+
+// discovery is the body of GET /discovery
+type discovery struct {
+	Duration string             `json:"duration"` // How long the scan listened
+	Vehicles []tesla.ScanResult `json:"vehicles"` // Strongest signal first
+}
+
+// DiscoveryHandler lists the Tesla vehicles in BLE range at GET /discovery,
+// to find a vehicle to set up or tell the cars in a garage apart. A beacon's
+// name is derived from its VIN, so it's labelled with the VIN only for a
+// configured vehicle or one passed as ?vin=.
+type DiscoveryHandler struct {
+	api      *APIHandler
+	scan     func(ctx context.Context, vins ...string) ([]tesla.ScanResult, error)
+	scanning sync.Mutex // Held for the one scan allowed at a time
+	logger   *log.Logger
+}
+
+// NewDiscoveryHandler creates a discovery handler scanning with manager
+func NewDiscoveryHandler(api *APIHandler, manager *tesla.BLEManager, logger *log.Logger) *DiscoveryHandler {
+	return &DiscoveryHandler{api: api, scan: manager.ScanAll, logger: logger}
+}
+
+// ServeHTTP implements http.Handler for /discovery
+func (h *DiscoveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/discovery" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	duration := defaultDiscoveryDuration
+	if value := r.URL.Query().Get("duration"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxDiscoveryDuration {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("duration must be a positive duration up to %v", maxDiscoveryDuration))
+			return
+		}
+		duration = parsed
+	}
+	vins := r.URL.Query()["vin"]
+	for _, client := range h.api.vehicles() {
+		vins = append(vins, client.GetVIN())
+	}
+
+	if !h.scanning.TryLock() {
+		writeError(w, http.StatusConflict, ErrCodeConditionsNotMet, "A discovery scan is already running")
+		return
+	}
+	defer h.scanning.Unlock()
+
+	// Long scans outlast the server's write timeout, so extend it
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(duration + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), duration)
+	defer cancel()
+	start := time.Now()
+	vehicles, err := h.scan(ctx, vins...)
+	if err != nil {
+		h.logger.Printf("Discovery scan failed: %v", err)
+		writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, err.Error())
+		return
+	}
+	writeData(w, http.StatusOK, discovery{Duration: time.Since(start).Round(time.Millisecond).String(), Vehicles: vehicles})
+}
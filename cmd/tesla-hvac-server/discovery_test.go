@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newFakeDiscovery returns a discovery handler whose scans find vehicles,
+// labelling those whose local name is a VIN it's given
+func newFakeDiscovery(api *APIHandler, vehicles ...tesla.ScanResult) *DiscoveryHandler {
+	scan := func(ctx context.Context, vins ...string) ([]tesla.ScanResult, error) {
+		found := make([]tesla.ScanResult, 0, len(vehicles))
+		for _, vehicle := range vehicles {
+			for _, vin := range vins {
+				if vehicle.LocalName == vin {
+					vehicle.VIN = vin
+				}
+			}
+			found = append(found, vehicle)
+		}
+		return found, nil
+	}
+	return &DiscoveryHandler{api: api, scan: scan, logger: log.New(io.Discard, "", 0)}
+}
+
+func TestDiscovery(t *testing.T) {
+	api := newTestAPIHandler()
+	handler := newFakeDiscovery(api,
+		tesla.ScanResult{LocalName: "TEST_VIN", Address: "00:11:22:33:44:55", RSSI: -50},
+		tesla.ScanResult{LocalName: "5YJ3E1EA7KF000001", Address: "66:77:88:99:AA:BB", RSSI: -70},
+		tesla.ScanResult{LocalName: "S0123456789abcdefC", Address: "CC:DD:EE:FF:00:11", RSSI: -90},
+	)
+	discover := func(target string) (int, discovery) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		var response struct {
+			Data discovery `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response.Data
+	}
+
+	code, found := discover("/discovery?duration=1s&vin=5YJ3E1EA7KF000001")
+	if code != http.StatusOK || len(found.Vehicles) != 3 {
+		t.Fatalf("Expected 3 vehicles, got %d: %+v", code, found)
+	}
+	for i, want := range []string{"TEST_VIN", "5YJ3E1EA7KF000001", ""} {
+		if found.Vehicles[i].VIN != want {
+			t.Errorf("Vehicle %d: expected VIN %q, got %+v", i, want, found.Vehicles[i])
+		}
+	}
+
+	for _, target := range []string{"/discovery?duration=2m", "/discovery?duration=soon"} {
+		if code, _ := discover(target); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, code)
+		}
+	}
+
+	// One scan runs at a time
+	handler.scanning.Lock()
+	if code, _ := discover("/discovery"); code != http.StatusConflict {
+		t.Errorf("Expected 409 during another scan, got %d", code)
+	}
+	handler.scanning.Unlock()
+}
+
+func TestDiscoveryScanFails(t *testing.T) {
+	handler := newFakeDiscovery(newTestAPIHandler())
+	handler.scan = func(ctx context.Context, vins ...string) ([]tesla.ScanResult, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Expected the scan to be bounded by the duration")
+		}
+		return nil, errors.New("ble: failed to enable device")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/discovery?duration=50ms", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// dogModeEventBuffer is how many vehicle events may queue for the
+	// monitor
+	dogModeEventBuffer = 32
+	// dogModePollTimeout bounds one poll of a vehicle
+	dogModePollTimeout = 2 * time.Minute
+)
+
+// DogModeStatus is a vehicle's entry in /monitor/dogmode
+type DogModeStatus struct {
+	VIN               string                  `json:"vin"`
+	Active            bool                    `json:"active"`
+	Mode              tesla.ClimateKeeperMode `json:"mode"`
+	ActiveSince       time.Time               `json:"active_since,omitempty"`
+	ClimateOn         bool                    `json:"climate_on"`
+	InsideTempCelsius float32                 `json:"inside_temp_celsius"`
+	BatteryLevel      int                     `json:"battery_level"`
+	LastCheckAt       time.Time               `json:"last_check_at,omitempty"`
+	LastError         string                  `json:"last_error,omitempty"`
+	Alerts            []string                `json:"alerts"` // Raised and not yet cleared
+}
+
+// dogModeReport is the body of /monitor/dogmode
+type dogModeReport struct {
+	Config   tesla.DogModeConfig `json:"config"`
+	Vehicles []DogModeStatus     `json:"vehicles"`
+}
+
+// dogModeVehicle is the monitor's view of a vehicle
+type dogModeVehicle struct {
+	status DogModeStatus
+	alerts map[string]bool
+	// A keeper or climate off command was sent, so the next state may
+	// legitimately show the keeper or climate off
+	expectChange bool
+}
+
+// DogModeMonitor watches vehicles while Dog Mode or another climate keeper
+// mode is on. It polls their cabin temperature and battery and raises an
+// alert when the cabin leaves the configured range, the battery runs low or
+// the climate shuts off without a command to stop it. It serves the
+// vehicles' status at GET /monitor/dogmode.
+type DogModeMonitor struct {
+	api           *APIHandler
+	configManager *tesla.ConfigManager // Defaults without one
+	alerts        notify.AlertsConfig
+	send          func(notify.Message) // Nil without notifications
+	logger        *log.Logger
+
+	mutex    sync.Mutex
+	vehicles map[string]*dogModeVehicle
+}
+
+// NewDogModeMonitor creates a monitor alerting through notifier, which may be
+// nil to only log alerts
+func NewDogModeMonitor(api *APIHandler, configManager *tesla.ConfigManager, notifier notify.Notifier, logger *log.Logger) *DogModeMonitor {
+	m := &DogModeMonitor{
+		api:           api,
+		configManager: configManager,
+		logger:        logger,
+		vehicles:      make(map[string]*dogModeVehicle),
+	}
+	if configManager != nil {
+		m.alerts = configManager.GetConfig().Notifications.Alerts
+	}
+	if notifier != nil {
+		m.send = func(msg notify.Message) {
+			sendNotification(notifier, logger, msg)
+		}
+	}
+	return m
+}
+
+// config returns the monitor's settings
+func (m *DogModeMonitor) config() tesla.DogModeConfig {
+	var config tesla.DogModeConfig
+	if m.configManager != nil {
+		config = m.configManager.GetConfig().DogMode
+	}
+	return config.WithDefaults()
+}
+
+// Run polls the vehicles with a keeper mode on until ctx is cancelled. A
+// vehicle is watched once any state read, or a keeper command, shows a
+// keeper mode on.
+func (m *DogModeMonitor) Run(ctx context.Context) error {
+	events := make(chan tesla.Event, dogModeEventBuffer)
+	for _, vehicle := range m.api.vehicles() {
+		vehicleEvents, unsubscribe := vehicle.Events().Subscribe(dogModeEventBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range vehicleEvents {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	interval := m.config().Interval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			if m.handle(event) {
+				m.poll(ctx, event.VIN)
+			}
+		case <-ticker.C:
+			for _, vin := range m.activeVINs() {
+				m.poll(ctx, vin)
+			}
+			if next := m.config().Interval; next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+// handle applies an event, reporting whether the vehicle should be polled
+// right away
+func (m *DogModeMonitor) handle(event tesla.Event) bool {
+	switch event.Type {
+	case tesla.EventStateUpdated:
+		if state, ok := event.Data.(tesla.HVACState); ok {
+			m.checkState(event.VIN, state)
+		}
+	case tesla.EventCommandSent:
+		cmd, ok := event.Data.(tesla.Command)
+		if !ok || (cmd.Name != "set_climate_keeper_mode" && cmd.Name != "set_climate_off") {
+			return false
+		}
+		m.mutex.Lock()
+		m.vehicle(event.VIN).expectChange = true
+		m.mutex.Unlock()
+		// Find out whether a keeper mode was turned on
+		return cmd.Name == "set_climate_keeper_mode"
+	}
+	return false
+}
+
+// poll reads a vehicle's state, which is checked when its event arrives,
+// and its battery level
+func (m *DogModeMonitor) poll(ctx context.Context, vin string) {
+	client, err := m.api.vehicle(vin)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, dogModePollTimeout)
+	defer cancel()
+
+	_, err = client.GetHVACState(ctx)
+	if err == nil {
+		var charge *tesla.ChargeState
+		if charge, err = client.GetChargeState(ctx); err == nil {
+			m.checkBattery(vin, charge.BatteryLevel)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v := m.vehicle(vin)
+	v.status.LastCheckAt = time.Now()
+	v.status.LastError = ""
+	if err != nil {
+		v.status.LastError = err.Error()
+		if v.status.Active {
+			m.logger.Printf("Dog Mode monitor failed to poll %s: %v", vin, err)
+		}
+	}
+}
+
+// checkState starts or stops watching a vehicle as its keeper mode changes
+// and raises the climate and temperature alerts
+func (m *DogModeMonitor) checkState(vin string, state tesla.HVACState) {
+	config := m.config()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v := m.vehicle(vin)
+	expected := v.expectChange
+	v.expectChange = false
+	keeperOn := state.ClimateKeeperMode != tesla.ClimateKeeperOff && state.ClimateKeeperMode != ""
+
+	if !keeperOn {
+		// The keeper mode may read off once the climate stops
+		if v.status.Active && !expected {
+			m.raise(v, notify.AlertDogModeClimate, fmt.Sprintf("%s turned off", keeperName(v.status.Mode)),
+				fmt.Sprintf("%s turned off on %s without a command to stop it. The cabin is %.1f°C.", keeperName(v.status.Mode), vin, state.InsideTempCelsius))
+		}
+		if v.status.Active {
+			m.logger.Printf("Dog Mode monitor: %s left %s", vin, keeperName(v.status.Mode))
+		}
+		v.status.Active = false
+		v.status.ActiveSince = time.Time{}
+		v.status.Mode = tesla.ClimateKeeperOff
+		v.status.ClimateOn = state.IsOn
+		v.status.InsideTempCelsius = state.InsideTempCelsius
+		if expected {
+			v.alerts = nil
+		}
+		return
+	}
+
+	if !v.status.Active {
+		m.logger.Printf("Dog Mode monitor: watching %s in %s", vin, keeperName(state.ClimateKeeperMode))
+		v.status.Active = true
+		v.status.ActiveSince = time.Now()
+		v.alerts = nil
+	}
+	v.status.Mode = state.ClimateKeeperMode
+	v.status.ClimateOn = state.IsOn
+	v.status.InsideTempCelsius = state.InsideTempCelsius
+
+	if !state.IsOn && !expected {
+		m.raise(v, notify.AlertDogModeClimate, "Climate is off in "+keeperName(state.ClimateKeeperMode),
+			fmt.Sprintf("Climate shut off on %s in %s. The cabin is %.1f°C.", vin, keeperName(state.ClimateKeeperMode), state.InsideTempCelsius))
+	} else if state.IsOn {
+		delete(v.alerts, notify.AlertDogModeClimate)
+	}
+
+	if t := state.InsideTempCelsius; t < config.MinTempCelsius || t > config.MaxTempCelsius {
+		m.raise(v, notify.AlertDogModeTemp, fmt.Sprintf("Cabin is %.0f°C in %s", t, keeperName(state.ClimateKeeperMode)),
+			fmt.Sprintf("The cabin of %s is %.1f°C, outside %.0f-%.0f°C, in %s.", vin, t, config.MinTempCelsius, config.MaxTempCelsius, keeperName(state.ClimateKeeperMode)))
+	} else {
+		delete(v.alerts, notify.AlertDogModeTemp)
+	}
+}
+
+// checkBattery raises the battery alert while a keeper mode is on
+func (m *DogModeMonitor) checkBattery(vin string, level int) {
+	config := m.config()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v := m.vehicle(vin)
+	v.status.BatteryLevel = level
+	if !v.status.Active {
+		return
+	}
+	if level <= config.MinBatteryLevel {
+		m.raise(v, notify.AlertDogModeBattery, fmt.Sprintf("Battery is %d%% in %s", level, keeperName(v.status.Mode)),
+			fmt.Sprintf("The battery of %s is at %d%% with %s on.", vin, level, keeperName(v.status.Mode)))
+	} else {
+		delete(v.alerts, notify.AlertDogModeBattery)
+	}
+}
+
+// keeperName is what the car calls a keeper mode
+func keeperName(mode tesla.ClimateKeeperMode) string {
+	switch mode {
+	case tesla.ClimateKeeperDog:
+		return "Dog Mode"
+	case tesla.ClimateKeeperCamp:
+		return "Camp Mode"
+	}
+	return "Keep Climate"
+}
+
+// raise sends an alert unless it is already raised. Call with the mutex
+// held.
+func (m *DogModeMonitor) raise(v *dogModeVehicle, alert, title, body string) {
+	if v.alerts[alert] {
+		return
+	}
+	if v.alerts == nil {
+		v.alerts = make(map[string]bool)
+	}
+	v.alerts[alert] = true
+	m.logger.Printf("warn: Dog Mode alert: %s", body)
+	if m.send != nil && m.alerts.AlertEnabled(alert) {
+		m.send(notify.Message{Title: title, Body: body, Priority: notify.PriorityHigh})
+	}
+}
+
+// vehicle returns the monitor's view of a vehicle. Call with the mutex held.
+func (m *DogModeMonitor) vehicle(vin string) *dogModeVehicle {
+	v := m.vehicles[vin]
+	if v == nil {
+		v = &dogModeVehicle{status: DogModeStatus{VIN: vin, Mode: tesla.ClimateKeeperOff}}
+		m.vehicles[vin] = v
+	}
+	return v
+}
+
+// activeVINs returns the vehicles with a keeper mode on
+func (m *DogModeMonitor) activeVINs() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var vins []string
+	for vin, v := range m.vehicles {
+		if v.status.Active {
+			vins = append(vins, vin)
+		}
+	}
+	return vins
+}
+
+// Status returns the status of each vehicle
+func (m *DogModeMonitor) Status() []DogModeStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	statuses := make([]DogModeStatus, 0, len(m.api.vehicles()))
+	for _, client := range m.api.vehicles() {
+		v := m.vehicle(client.GetVIN())
+		status := v.status
+		status.Alerts = make([]string, 0, len(v.alerts))
+		for alert := range v.alerts {
+			status.Alerts = append(status.Alerts, alert)
+		}
+		sort.Strings(status.Alerts)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ServeHTTP implements http.Handler for GET /monitor/dogmode
+func (m *DogModeMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/monitor/dogmode" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeData(w, http.StatusOK, dogModeReport{Config: m.config(), Vehicles: m.Status()})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func newTestDogModeMonitor() (*APIHandler, *DogModeMonitor, *[]notify.Message) {
+	api := newTestAPIHandler()
+	var sent []notify.Message
+	m := NewDogModeMonitor(api, nil, nil, log.New(io.Discard, "", 0))
+	m.send = func(msg notify.Message) { sent = append(sent, msg) }
+	return api, m, &sent
+}
+
+func dogState(on bool, mode tesla.ClimateKeeperMode, celsius float32) tesla.Event {
+	return tesla.Event{Type: tesla.EventStateUpdated, VIN: "TEST_VIN", Data: tesla.HVACState{
+		IsOn:              on,
+		ClimateKeeperMode: mode,
+		InsideTempCelsius: celsius,
+	}}
+}
+
+func TestDogModeMonitorAlerts(t *testing.T) {
+	_, m, sent := newTestDogModeMonitor()
+
+	m.handle(dogState(true, tesla.ClimateKeeperOff, 35)) // Not watched
+	if len(*sent) != 0 || len(m.activeVINs()) != 0 {
+		t.Fatalf("Expected no alerts without a keeper mode, got %+v", *sent)
+	}
+
+	m.handle(dogState(true, tesla.ClimateKeeperDog, 22))
+	if len(m.activeVINs()) != 1 {
+		t.Fatal("Expected the vehicle to be watched in Dog Mode")
+	}
+	m.handle(dogState(true, tesla.ClimateKeeperDog, 32))  // Too hot
+	m.handle(dogState(true, tesla.ClimateKeeperDog, 33))  // Already raised
+	m.checkBattery("TEST_VIN", 15)                        // Low
+	m.handle(dogState(false, tesla.ClimateKeeperOff, 33)) // Shut off
+
+	want := []string{"Cabin is 32°C in Dog Mode", "Battery is 15% in Dog Mode", "Dog Mode turned off"}
+	if len(*sent) != len(want) {
+		t.Fatalf("Expected %d alerts, got %+v", len(want), *sent)
+	}
+	for i, msg := range *sent {
+		if msg.Title != want[i] || msg.Priority != notify.PriorityHigh {
+			t.Errorf("Alert %d: got %+v, want %q", i, msg, want[i])
+		}
+	}
+	if len(m.activeVINs()) != 0 {
+		t.Error("Expected the vehicle to no longer be watched")
+	}
+}
+
+func TestDogModeMonitorExpectedStop(t *testing.T) {
+	_, m, sent := newTestDogModeMonitor()
+	m.handle(dogState(true, tesla.ClimateKeeperDog, 22))
+
+	poll := m.handle(tesla.Event{Type: tesla.EventCommandSent, VIN: "TEST_VIN", Data: tesla.Command{Name: "set_climate_keeper_mode"}})
+	if !poll {
+		t.Error("Expected a keeper command to poll the vehicle")
+	}
+	m.handle(dogState(false, tesla.ClimateKeeperOff, 22))
+	if len(*sent) != 0 {
+		t.Errorf("Expected no alert when the keeper was turned off by a command, got %+v", *sent)
+	}
+}
+
+func TestDogModeStatusEndpoint(t *testing.T) {
+	api, m, _ := newTestDogModeMonitor()
+	api.Mount("/monitor", m)
+	m.handle(dogState(false, tesla.ClimateKeeperDog, 22))
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/monitor/dogmode", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var env struct {
+		Data dogModeReport `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if env.Data.Config.MaxTempCelsius != tesla.DefaultDogModeMaxTemp {
+		t.Errorf("Expected the default config, got %+v", env.Data.Config)
+	}
+	if len(env.Data.Vehicles) != 1 {
+		t.Fatalf("Expected one vehicle, got %+v", env.Data.Vehicles)
+	}
+	status := env.Data.Vehicles[0]
+	if !status.Active || status.Mode != tesla.ClimateKeeperDog || len(status.Alerts) != 1 || status.Alerts[0] != notify.AlertDogModeClimate {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	rec = httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", "/monitor/dogmode", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bodyEncoder encodes response bodies in one media type
+type bodyEncoder struct {
+	contentType string
+	// etagSuffix distinguishes this representation's entity tags
+	etagSuffix string
+	marshal    func(v interface{}) ([]byte, error)
+}
+
+var (
+	jsonEncoder = &bodyEncoder{
+		contentType: "application/json",
+		marshal:     marshalJSONLine,
+	}
+	cborEncoder = &bodyEncoder{
+		contentType: "application/cbor",
+		etagSuffix:  "cbor",
+		marshal:     marshalCBOR,
+	}
+	msgpackEncoder = &bodyEncoder{
+		contentType: "application/msgpack",
+		etagSuffix:  "msgpack",
+		marshal:     marshalMsgpack,
+	}
+)
+
+// binaryEncoders maps accepted media types to the compact encoders offered to
+// embedded clients
+var binaryEncoders = map[string]*bodyEncoder{
+	"application/cbor":        cborEncoder,
+	"application/msgpack":     msgpackEncoder,
+	"application/x-msgpack":   msgpackEncoder,
+	"application/vnd.msgpack": msgpackEncoder,
+}
+
+// negotiateEncoder selects the response encoder for a request from its Accept
+// header, preferring the highest quality supported type. JSON is used when
+// nothing better is acceptable.
+func negotiateEncoder(r *http.Request) *bodyEncoder {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return jsonEncoder
+	}
+
+	best := jsonEncoder
+	bestQ := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 || q <= bestQ {
+			continue
+		}
+
+		if encoder, ok := binaryEncoders[mediaType]; ok {
+			best, bestQ = encoder, q
+		} else if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "*/*" || mediaType == "application/*" {
+			best, bestQ = jsonEncoder, q
+		}
+	}
+	return best
+}
+
+// representationETag returns the entity tag for this encoder's representation
+// of an entity
+func (e *bodyEncoder) representationETag(etag string) string {
+	if etag == "" || e.etagSuffix == "" {
+		return etag
+	}
+	return etag + "-" + e.etagSuffix
+}
+
+// write encodes v and writes it with the given status code
+func (e *bodyEncoder) write(w http.ResponseWriter, status int, v interface{}) {
+	body, err := e.marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", e.contentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// marshalJSONLine encodes v as JSON followed by a newline, matching
+// json.Encoder's output
+func marshalJSONLine(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toGeneric converts v to its JSON data model so that binary encodings honor
+// the same field names and omitempty rules as JSON responses
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// sortedKeys returns a map's keys in sorted order so encodings are stable
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// numberValue returns a JSON number as an int64, uint64 or float64
+func numberValue(n json.Number) interface{} {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u
+	}
+	f, _ := strconv.ParseFloat(string(n), 64)
+	return f
+}
+
+// marshalCBOR encodes v as CBOR (RFC 8949)
+func marshalCBOR(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cborHead writes a CBOR initial byte and argument
+func cborHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// encodeCBOR encodes a value from the JSON data model as CBOR
+func encodeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		return encodeCBOR(buf, numberValue(v))
+	case int64:
+		if v >= 0 {
+			cborHead(buf, 0, uint64(v))
+		} else {
+			cborHead(buf, 1, uint64(-(v + 1)))
+		}
+	case uint64:
+		cborHead(buf, 0, v)
+	case float64:
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		cborHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		cborHead(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		cborHead(buf, 5, uint64(len(v)))
+		for _, key := range sortedKeys(v) {
+			encodeCBOR(buf, key)
+			if err := encodeCBOR(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+	return nil
+}
+
+// marshalMsgpack encodes v as MessagePack
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackLength writes a length-prefixed MessagePack header using the fixed
+// form when it fits, otherwise the 16 or 32 bit form
+func msgpackLength(buf *bytes.Buffer, n int, fixed byte, fixedMax int, code16, code32 byte) {
+	switch {
+	case n <= fixedMax:
+		buf.WriteByte(fixed | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// encodeMsgpack encodes a value from the JSON data model as MessagePack
+func encodeMsgpack(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		return encodeMsgpack(buf, numberValue(v))
+	case int64:
+		switch {
+		case v >= 0:
+			return encodeMsgpack(buf, uint64(v))
+		case v >= -32:
+			buf.WriteByte(byte(v))
+		case v >= math.MinInt8:
+			buf.WriteByte(0xd0)
+			buf.WriteByte(byte(v))
+		case v >= math.MinInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(v))
+		case v >= math.MinInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(v))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case uint64:
+		switch {
+		case v <= 127:
+			buf.WriteByte(byte(v))
+		case v <= math.MaxUint8:
+			buf.WriteByte(0xcc)
+			buf.WriteByte(byte(v))
+		case v <= math.MaxUint16:
+			buf.WriteByte(0xcd)
+			binary.Write(buf, binary.BigEndian, uint16(v))
+		case v <= math.MaxUint32:
+			buf.WriteByte(0xce)
+			binary.Write(buf, binary.BigEndian, uint32(v))
+		default:
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, v)
+		}
+	case float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case string:
+		if len(v) > 31 && len(v) <= math.MaxUint8 {
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(len(v)))
+		} else {
+			msgpackLength(buf, len(v), 0xa0, 31, 0xda, 0xdb)
+		}
+		buf.WriteString(v)
+	case []interface{}:
+		msgpackLength(buf, len(v), 0x90, 15, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := encodeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		msgpackLength(buf, len(v), 0x80, 15, 0xde, 0xdf)
+		for _, key := range sortedKeys(v) {
+			encodeMsgpack(buf, key)
+			if err := encodeMsgpack(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
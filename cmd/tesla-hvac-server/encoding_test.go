@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEncodeCBOR(t *testing.T) {
+	// Vectors from RFC 8949 Appendix A
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{1.5, "fb3ff8000000000000"},
+		{true, "f5"},
+		{nil, "f6"},
+		{"a", "6161"},
+		{[]int{1, 2, 3}, "83010203"},
+		{map[string]int{"b": 2, "a": 1}, "a2616101616202"},
+	}
+
+	for _, test := range tests {
+		encoded, err := marshalCBOR(test.value)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.value, err)
+		}
+		if got := hex.EncodeToString(encoded); got != test.expected {
+			t.Errorf("%v: expected %s, got %s", test.value, test.expected, got)
+		}
+	}
+}
+
+func TestEncodeMsgpack(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{1, "01"},
+		{200, "ccc8"},
+		{-1, "ff"},
+		{-100, "d09c"},
+		{1.5, "cb3ff8000000000000"},
+		{false, "c2"},
+		{nil, "c0"},
+		{"a", "a161"},
+		{[]int{1, 2}, "920102"},
+		{map[string]int{"a": 1}, "81a16101"},
+	}
+
+	for _, test := range tests {
+		encoded, err := marshalMsgpack(test.value)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", test.value, err)
+		}
+		if got := hex.EncodeToString(encoded); got != test.expected {
+			t.Errorf("%v: expected %s, got %s", test.value, test.expected, got)
+		}
+	}
+}
+
+func TestNegotiateEncoder(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected *bodyEncoder
+	}{
+		{"", jsonEncoder},
+		{"application/json", jsonEncoder},
+		{"application/cbor", cborEncoder},
+		{"application/x-msgpack", msgpackEncoder},
+		{"application/json;q=0.5, application/cbor", cborEncoder},
+		{"application/cbor;q=0.2, */*;q=0.8", jsonEncoder},
+		{"application/vnd.tesla-hvac.v1+json", jsonEncoder},
+		{"text/html", jsonEncoder},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/hvac/state", nil)
+		req.Header.Set("Accept", test.accept)
+		if got := negotiateEncoder(req); got != test.expected {
+			t.Errorf("Accept %q: expected %s, got %s", test.accept, test.expected.contentType, got.contentType)
+		}
+	}
+}
+
+func TestWriteDataWithETagCBOR(t *testing.T) {
+	req := httptest.NewRequest("GET", "/hvac/state", nil)
+	req.Header.Set("Accept", "application/cbor")
+	rec := httptest.NewRecorder()
+	writeDataWithETag(rec, req, "abc", map[string]bool{"is_on": true})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/cbor" {
+		t.Errorf("Expected application/cbor, got %q", ct)
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"abc-cbor"` {
+		t.Errorf("Expected representation-specific ETag, got %q", etag)
+	}
+	if json.Valid(rec.Body.Bytes()) {
+		t.Error("Expected a binary body")
+	}
+	// Map header for a 3-entry envelope: status, data, meta
+	if rec.Body.Bytes()[0] != 0xa3 {
+		t.Errorf("Expected CBOR map header, got %x", rec.Body.Bytes()[0])
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// defaultEnrollmentTimeout is how long an add-key request waits for a
+	// key card tap
+	defaultEnrollmentTimeout = 2 * time.Minute
+	maxEnrollmentTimeout     = 10 * time.Minute
+
+	// defaultQRScale is the enrollment QR code's pixels per module
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// enrollInstructions tells the user how to approve an add-key request
+const enrollInstructions = "Tap a key card on the center console, then approve the new key on the vehicle's touchscreen."
+
+// EnrollmentState is the progress of an enrollment
+type EnrollmentState string
+
+const (
+	EnrollmentWaiting  EnrollmentState = "waiting_for_card"
+	EnrollmentEnrolled EnrollmentState = "enrolled"
+	EnrollmentFailed   EnrollmentState = "failed"
+	EnrollmentCanceled EnrollmentState = "canceled"
+)
+
+// Enrollment reports an enrollment of the server's key on a vehicle
+type Enrollment struct {
+	VIN          string          `json:"vin"`
+	Role         tesla.KeyRole   `json:"role"`
+	State        EnrollmentState `json:"state"`
+	Instructions string          `json:"instructions,omitempty"` // While waiting for a key card
+	StartedAt    time.Time       `json:"started_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// enrollRequest is the body of POST /enroll
+type enrollRequest struct {
+	Role    string `json:"role,omitempty"`    // owner or driver; defaults to driver
+	Timeout string `json:"timeout,omitempty"` // How long to wait for a key card, such as 2m
+}
+
+// EnrollmentHandler guides enrolling the server's key on a vehicle over BLE:
+// POST /enroll sends the add-key request, GET /enroll reports whether it has
+// been approved and DELETE /enroll stops waiting. GET /enroll/qr serves the
+// QR code the Tesla app scans to pair a key registered for a domain.
+type EnrollmentHandler struct {
+	api    *APIHandler
+	logger *log.Logger
+
+	mu          sync.Mutex
+	enrollments map[string]*enrollment // Latest by VIN
+}
+
+// enrollment is an enrollment and how to stop it
+type enrollment struct {
+	Enrollment
+	cancel context.CancelFunc
+}
+
+// NewEnrollmentHandler creates an enrollment handler
+func NewEnrollmentHandler(api *APIHandler, logger *log.Logger) *EnrollmentHandler {
+	return &EnrollmentHandler{api: api, logger: logger, enrollments: make(map[string]*enrollment)}
+}
+
+// ServeHTTP implements http.Handler for GET, POST and DELETE /enroll and GET
+// /enroll/qr
+func (h *EnrollmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/enroll/qr" {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h.serveQRCode(w, r)
+		return
+	}
+	if r.URL.Path != "/enroll" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	client, err := h.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	switch r.Method {
+	case "GET":
+		h.serveStatus(w, client)
+	case "POST":
+		h.serveEnroll(w, r, client)
+	case "DELETE":
+		h.serveCancel(w, client)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// serveEnroll sends an add-key request for the server's key and waits for
+// approval in the background
+func (h *EnrollmentHandler) serveEnroll(w http.ResponseWriter, r *http.Request, client *tesla.Client) {
+	var req enrollRequest
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	role, err := tesla.ParseKeyRole(req.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	timeout := defaultEnrollmentTimeout
+	if req.Timeout != "" {
+		timeout, err = time.ParseDuration(req.Timeout)
+		if err != nil || timeout <= 0 || timeout > maxEnrollmentTimeout {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("timeout must be a duration up to %v", maxEnrollmentTimeout))
+			return
+		}
+	}
+	publicKey, err := client.PublicKey()
+	if err != nil {
+		writeError(w, http.StatusConflict, ErrCodeConditionsNotMet, err.Error())
+		return
+	}
+
+	vin := client.GetVIN()
+	h.mu.Lock()
+	if current := h.enrollments[vin]; current != nil && current.State == EnrollmentWaiting {
+		h.mu.Unlock()
+		writeError(w, http.StatusConflict, ErrCodeConditionsNotMet, "An enrollment is already waiting for a key card")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	now := time.Now()
+	current := &enrollment{
+		Enrollment: Enrollment{
+			VIN:          vin,
+			Role:         role,
+			State:        EnrollmentWaiting,
+			Instructions: enrollInstructions,
+			StartedAt:    now,
+			ExpiresAt:    now.Add(timeout),
+		},
+		cancel: cancel,
+	}
+	h.enrollments[vin] = current
+	h.mu.Unlock()
+
+	// Answer once the request has reached the vehicle, or failed to
+	sent := make(chan struct{})
+	go func() {
+		defer cancel()
+		err := client.EnrollKey(ctx, publicKey, role, func() { close(sent) })
+		h.finish(current, err)
+		select {
+		case <-sent:
+		default:
+			close(sent)
+		}
+	}()
+	select {
+	case <-sent:
+	case <-r.Context().Done():
+	}
+
+	status := h.status(vin)
+	if status.State == EnrollmentFailed {
+		writeError(w, http.StatusInternalServerError, ErrCodeVehicleError, status.Error)
+		return
+	}
+	writeData(w, http.StatusAccepted, status)
+}
+
+// finish records how an enrollment ended
+func (h *EnrollmentHandler) finish(current *enrollment, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if current.State != EnrollmentWaiting {
+		return
+	}
+	now := time.Now()
+	current.FinishedAt = &now
+	current.Instructions = ""
+	switch {
+	case err == nil:
+		current.State = EnrollmentEnrolled
+		h.logger.Printf("Enrolled the server's key on %s as %s", current.VIN, current.Role)
+	case errors.Is(err, context.Canceled):
+		current.State = EnrollmentCanceled
+	default:
+		current.State = EnrollmentFailed
+		current.Error = err.Error()
+		h.logger.Printf("Failed to enroll the server's key on %s: %v", current.VIN, err)
+	}
+}
+
+// status returns a copy of a vehicle's latest enrollment
+func (h *EnrollmentHandler) status(vin string) Enrollment {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.enrollments[vin].Enrollment
+}
+
+// serveStatus reports a vehicle's latest enrollment
+func (h *EnrollmentHandler) serveStatus(w http.ResponseWriter, client *tesla.Client) {
+	h.mu.Lock()
+	current := h.enrollments[client.GetVIN()]
+	h.mu.Unlock()
+	if current == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "No enrollment has been started")
+		return
+	}
+	writeData(w, http.StatusOK, h.status(client.GetVIN()))
+}
+
+// serveCancel stops waiting for a vehicle's enrollment to be approved
+func (h *EnrollmentHandler) serveCancel(w http.ResponseWriter, client *tesla.Client) {
+	h.mu.Lock()
+	current := h.enrollments[client.GetVIN()]
+	h.mu.Unlock()
+	if current == nil || current.State != EnrollmentWaiting {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "No enrollment is waiting for a key card")
+		return
+	}
+	current.cancel()
+	now := time.Now()
+	h.mu.Lock()
+	if current.State == EnrollmentWaiting {
+		current.State = EnrollmentCanceled
+		current.Instructions = ""
+		current.FinishedAt = &now
+	}
+	h.mu.Unlock()
+	writeData(w, http.StatusOK, h.status(client.GetVIN()))
+}
+
+// serveQRCode renders the enrollment QR code for ?domain= as a PNG, or an SVG
+// with ?format=svg
+func (h *EnrollmentHandler) serveQRCode(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	code, err := tesla.EnrollmentQRCode(query.Get("domain"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	scale := defaultQRScale
+	if value := query.Get("scale"); value != "" {
+		scale, err = strconv.Atoi(value)
+		if err != nil || scale < 1 || scale > maxQRScale {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("scale must be from 1 to %d", maxQRScale))
+			return
+		}
+	}
+
+	var body []byte
+	switch format := query.Get("format"); format {
+	case "", "png":
+		body, err = code.PNG(scale)
+		if err != nil {
+			h.logger.Printf("Failed to render QR code: %v", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to render QR code")
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+	case "svg":
+		body = code.SVG(scale)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "format must be png or svg")
+		return
+	}
+	w.Write(body)
+}
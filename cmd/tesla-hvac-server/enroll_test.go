@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// newEnrollmentAPI returns an API for a simulated vehicle with a private key
+func newEnrollmentAPI(t *testing.T) *APIHandler {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	keyFile := filepath.Join(t.TempDir(), "private.pem")
+	key, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.SavePrivateKey(key, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = tesla.SimulatorVIN
+	config.Tesla.Transport = string(tesla.TransportSim)
+	config.Tesla.PrivateKeyFile = keyFile
+	api := NewAPIHandler(tesla.NewClientFromConfig(config, logger), logger)
+	api.Mount("/enroll", NewEnrollmentHandler(api, logger))
+	return api
+}
+
+func serveEnrollment(api *APIHandler, method, body string) (*httptest.ResponseRecorder, Enrollment) {
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(method, "/enroll", strings.NewReader(body)))
+	var response struct {
+		Data Enrollment `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec, response.Data
+}
+
+func TestEnrollServerKey(t *testing.T) {
+	api := newEnrollmentAPI(t)
+
+	if rec, _ := serveEnrollment(api, "GET", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 before enrolling, got %d", rec.Code)
+	}
+
+	rec, enrollment := serveEnrollment(api, "POST", `{"role": "owner", "timeout": "30s"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if enrollment.VIN != tesla.SimulatorVIN || enrollment.Role != tesla.KeyRoleOwner || enrollment.ExpiresAt.Sub(enrollment.StartedAt).Seconds() != 30 {
+		t.Errorf("Unexpected enrollment: %+v", enrollment)
+	}
+
+	// The simulator approves at once; wait for the background check
+	for i := 0; i < 1000 && enrollment.State == EnrollmentWaiting; i++ {
+		_, enrollment = serveEnrollment(api, "GET", "")
+	}
+	if enrollment.State != EnrollmentEnrolled || enrollment.FinishedAt == nil || enrollment.Instructions != "" {
+		t.Errorf("Expected the key enrolled, got %+v", enrollment)
+	}
+
+	if rec, _ := serveEnrollment(api, "DELETE", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 canceling a finished enrollment, got %d", rec.Code)
+	}
+}
+
+func TestEnrollServerKeyRejectsInvalidRequests(t *testing.T) {
+	api := newEnrollmentAPI(t)
+	for _, body := range []string{`{"role": "service"}`, `{"timeout": "1h"}`, `{"timeout": "soon"}`, `{"unknown": 1}`} {
+		if rec, _ := serveEnrollment(api, "POST", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	// Without a private key there's nothing to enroll
+	api.client.SetPrivateKeyFile("")
+	if rec, _ := serveEnrollment(api, "POST", `{}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without a key, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestEnrollmentQRCode(t *testing.T) {
+	api := newEnrollmentAPI(t)
+	tests := []struct {
+		query       string
+		status      int
+		contentType string
+	}{
+		{"?domain=example.com", http.StatusOK, "image/png"},
+		{"?domain=example.com&format=svg&scale=2", http.StatusOK, "image/svg+xml"},
+		{"", http.StatusBadRequest, ""},
+		{"?domain=example.com&format=gif", http.StatusBadRequest, ""},
+		{"?domain=example.com&scale=100", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("GET", "/enroll/qr"+test.query, nil))
+		if rec.Code != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.query, test.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s: expected %s, got %s", test.query, test.contentType, rec.Header().Get("Content-Type"))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("GET", "/enroll/qr?domain=example.com", nil))
+	if _, err := png.Decode(rec.Body); err != nil {
+		t.Errorf("Expected a PNG: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// feedBuffer is how many events may queue for a feed before new ones
+	// are dropped
+	feedBuffer = 32
+	// feedKeepAlive is how often idle feeds get a comment, so proxies don't
+	// close them
+	feedKeepAlive = 15 * time.Second
+)
+
+// feedDefaultEvents are streamed when a client doesn't pick its own
+var feedDefaultEvents = []tesla.EventType{tesla.EventConnectionState, tesla.EventStateChanged}
+
+// EventFeed streams vehicle events at /events as Server-Sent Events, for
+// clients that can't use WebSockets. The first state_changed event for a
+// vehicle carries its whole state; later ones carry only the fields that
+// changed.
+type EventFeed struct {
+	api       *APIHandler
+	logger    *log.Logger
+	keepAlive time.Duration
+}
+
+// NewEventFeed creates a feed for the handler's vehicles
+func NewEventFeed(api *APIHandler, logger *log.Logger) *EventFeed {
+	return &EventFeed{
+		api:       api,
+		logger:    logger,
+		keepAlive: feedKeepAlive,
+	}
+}
+
+// isEventStream reports whether a request comes from an EventSource
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// ServeHTTP streams events until the client disconnects. ?events= and ?vin=
+// select what is sent.
+func (f *EventFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/events" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	types := make(map[tesla.EventType]bool)
+	for _, event := range feedDefaultEvents {
+		types[event] = true
+	}
+	if events := r.URL.Query().Get("events"); events != "" {
+		types = make(map[tesla.EventType]bool)
+		for _, name := range strings.Split(events, ",") {
+			if !streamEventTypes[tesla.EventType(name)] {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Unknown event type "+name)
+				return
+			}
+			types[tesla.EventType(name)] = true
+		}
+	}
+	vehicles := f.api.vehicles()
+	if vins := vehicleFilter(r); len(vins) > 0 {
+		vehicles = nil
+		for _, vin := range vins {
+			client, err := f.api.vehicle(vin)
+			if err != nil {
+				writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+				return
+			}
+			vehicles = append(vehicles, client)
+		}
+	}
+
+	events := make(chan tesla.Event, feedBuffer)
+	for _, client := range vehicles {
+		ch, unsubscribe := client.Events().Subscribe(feedBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range ch {
+				select {
+				case events <- event:
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{
+		w:      w,
+		rc:     http.NewResponseController(w),
+		unit:   requestUnit(r),
+		states: make(map[string]map[string]interface{}),
+	}
+
+	// Start with where things stand so clients don't wait for a change
+	for _, client := range vehicles {
+		if types[tesla.EventConnectionState] {
+			event := tesla.Event{
+				Type:      tesla.EventConnectionState,
+				VIN:       client.GetVIN(),
+				Timestamp: time.Now(),
+				Data:      map[string]tesla.ConnectionState{"state": client.ConnectionState()},
+			}
+			if err := stream.send(event); err != nil {
+				return
+			}
+		}
+		if snapshot, ok := client.LastState(); ok && types[tesla.EventStateChanged] {
+			event := tesla.Event{Type: tesla.EventStateChanged, VIN: client.GetVIN(), Timestamp: snapshot.ReadAt, Data: *snapshot.State}
+			if err := stream.send(event); err != nil {
+				return
+			}
+		}
+	}
+	if err := stream.rc.Flush(); err != nil {
+		f.logger.Printf("Event stream can't be flushed: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(f.keepAlive)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if !types[event.Type] {
+				continue
+			}
+			err = stream.send(event)
+		case <-ticker.C:
+			err = stream.write(": keepalive\n\n")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// eventStream writes Server-Sent Events to one client
+type eventStream struct {
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	unit profile.Unit
+
+	// states holds the last state sent per vehicle, as encoded
+	states map[string]map[string]interface{}
+}
+
+// send writes an event, reducing HVAC states to what changed since the last
+// one sent for the vehicle. Events that change nothing are skipped.
+func (s *eventStream) send(event tesla.Event) error {
+	if state, ok := event.Data.(tesla.HVACState); ok {
+		fields, err := stateFields(displayStateIn(&state, s.unit))
+		if err != nil {
+			return err
+		}
+		if event.Type == tesla.EventStateChanged {
+			previous := s.states[event.VIN]
+			s.states[event.VIN] = fields
+			if previous != nil {
+				fields = stateDelta(previous, fields)
+				if len(fields) == 0 {
+					return nil
+				}
+			}
+		}
+		event.Data = fields
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, data))
+}
+
+// write writes and flushes raw stream data
+func (s *eventStream) write(data string) error {
+	// The server's write timeout would otherwise end the stream
+	if err := s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// stateFields encodes a state as a map of its JSON fields
+func stateFields(state interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// stateDelta returns the fields of current that differ from previous
+func stateDelta(previous, current map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{})
+	for name, value := range current {
+		if old, ok := previous[name]; !ok || !reflect.DeepEqual(old, value) {
+			delta[name] = value
+		}
+	}
+	return delta
+}
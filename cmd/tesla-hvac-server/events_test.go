@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newTestFeed serves an event feed and returns the server
+func newTestFeed(t *testing.T) (*APIHandler, *httptest.Server) {
+	t.Helper()
+	handler := newTestAPIHandler()
+	handler.Mount("/events", NewEventFeed(handler, handler.logger))
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return handler, server
+}
+
+// openFeed connects to the feed and waits until it is subscribed
+func openFeed(t *testing.T, handler *APIHandler, url string) *bufio.Reader {
+	t.Helper()
+	before := handler.client.Events().SubscriberCount()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for handler.client.Events().SubscriberCount() == before {
+		time.Sleep(time.Millisecond)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readFeedEvent reads the next event, skipping comments
+func readFeedEvent(t *testing.T, reader *bufio.Reader) (string, map[string]interface{}) {
+	t.Helper()
+	var name string
+	var message map[string]interface{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &message); err != nil {
+				t.Fatalf("Invalid data %s: %v", line, err)
+			}
+		case line == "" && name != "":
+			return name, message
+		}
+	}
+}
+
+func TestEventFeedConnectionState(t *testing.T) {
+	handler, server := newTestFeed(t)
+	reader := openFeed(t, handler, server.URL+"/events")
+
+	// The current state comes first
+	name, message := readFeedEvent(t, reader)
+	if name != "connection_state" || message["data"].(map[string]interface{})["state"] != "disconnected" {
+		t.Fatalf("Expected the current connection state, got %s %v", name, message)
+	}
+
+	handler.client.Events().Publish(tesla.Event{Type: tesla.EventClimateSkipped, VIN: "TEST_VIN"})
+	handler.client.Events().Publish(tesla.Event{
+		Type: tesla.EventConnectionState,
+		VIN:  "TEST_VIN",
+		Data: tesla.ConnectionStatus{State: tesla.StateScanning, Previous: tesla.StateDisconnected},
+	})
+	name, message = readFeedEvent(t, reader)
+	data := message["data"].(map[string]interface{})
+	if name != "connection_state" || data["state"] != "scanning" || data["previous"] != "disconnected" {
+		t.Errorf("Expected a scanning transition, got %s %v", name, message)
+	}
+}
+
+func TestEventFeedStateDeltas(t *testing.T) {
+	handler, server := newTestFeed(t)
+	reader := openFeed(t, handler, server.URL+"/events?events=state_changed")
+
+	events := handler.client.Events()
+	events.Publish(tesla.Event{Type: tesla.EventStateChanged, VIN: "TEST_VIN", Data: tesla.HVACState{DriverTempCelsius: 20}})
+	events.Publish(tesla.Event{Type: tesla.EventStateChanged, VIN: "TEST_VIN", Data: tesla.HVACState{DriverTempCelsius: 20, FanStatus: 3}})
+
+	_, message := readFeedEvent(t, reader)
+	data := message["data"].(map[string]interface{})
+	if data["driver_temp_celsius"] != 68.0 || data["is_on"] != false {
+		t.Errorf("Expected the whole state in Fahrenheit first, got %v", data)
+	}
+
+	_, message = readFeedEvent(t, reader)
+	data = message["data"].(map[string]interface{})
+	if len(data) != 1 || data["fan_status"] != 3.0 {
+		t.Errorf("Expected only the fan speed to change, got %v", data)
+	}
+}
+
+func TestEventFeedRejectsUnknownEvents(t *testing.T) {
+	handler, _ := newTestFeed(t)
+
+	rec := serveWithToken(handler, "GET", "/events?events=bogus", "", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown event, got %d", rec.Code)
+	}
+	rec = serveWithToken(handler, "POST", "/events", "", "")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
+
+func TestStateDelta(t *testing.T) {
+	previous := map[string]interface{}{"is_on": false, "fan_status": 1.0}
+	current := map[string]interface{}{"is_on": true, "fan_status": 1.0}
+	if delta := stateDelta(previous, current); len(delta) != 1 || delta["is_on"] != true {
+		t.Errorf("Unexpected delta %v", delta)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// parseFields returns the field names requested with ?fields=a,b,c, or nil if
+// the full object was requested
+func parseFields(r *http.Request) []string {
+	value := r.URL.Query().Get("fields")
+	if value == "" {
+		return nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// projectFields returns a projection of data containing only the named
+// top-level JSON fields. Unknown field names are rejected so that typos don't
+// silently produce empty responses.
+func projectFields(data interface{}, fields []string) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var full map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &full); err != nil {
+		return nil, fmt.Errorf("field selection is not supported for this resource")
+	}
+
+	projection := make(map[string]json.RawMessage, len(fields))
+	var unknown []string
+	for _, field := range fields {
+		value, ok := full[field]
+		if !ok {
+			unknown = append(unknown, field)
+			continue
+		}
+		projection[field] = value
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown fields: %s", strings.Join(unknown, ", "))
+	}
+
+	return projection, nil
+}
+
+// writeStateData writes a state resource, applying ?fields= projection and
+// conditional GET handling. The ETag is varied by the selected fields so that
+// different projections are cached independently.
+func writeStateData(w http.ResponseWriter, r *http.Request, etag string, data interface{}) {
+	fields := parseFields(r)
+	if fields == nil {
+		writeDataWithETag(w, r, etag, data)
+		return
+	}
+
+	projection, err := projectFields(data, fields)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	if etag != "" {
+		sorted := append([]string(nil), fields...)
+		sort.Strings(sorted)
+		etag = etag + "-" + strings.Join(sorted, ".")
+	}
+
+	writeDataWithETag(w, r, etag, projection)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testState struct {
+	IsOn       bool    `json:"is_on"`
+	DriverTemp float64 `json:"driver_temp_celsius"`
+	FanSpeed   int     `json:"fan_speed"`
+}
+
+func TestProjectFields(t *testing.T) {
+	state := testState{IsOn: true, DriverTemp: 21.5, FanSpeed: 3}
+
+	projection, err := projectFields(state, []string{"is_on", "driver_temp_celsius"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(projection) != 2 {
+		t.Errorf("Expected 2 fields, got %d", len(projection))
+	}
+	if _, ok := projection["fan_speed"]; ok {
+		t.Error("Expected fan_speed to be excluded")
+	}
+
+	if _, err := projectFields(state, []string{"is_on", "bogus"}); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+}
+
+func TestWriteStateDataWithFields(t *testing.T) {
+	state := testState{IsOn: true, DriverTemp: 21.5, FanSpeed: 3}
+
+	req := httptest.NewRequest("GET", "/hvac/state?fields=is_on,%20fan_speed", nil)
+	rec := httptest.NewRecorder()
+	writeStateData(rec, req, "abc", state)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var env struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(env.Data) != 2 || env.Data["is_on"] != true {
+		t.Errorf("Unexpected projection: %+v", env.Data)
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" || etag == `"abc"` {
+		t.Errorf("Expected projection-specific ETag, got %q", etag)
+	}
+
+	req = httptest.NewRequest("GET", "/hvac/state?fields=nope", nil)
+	rec = httptest.NewRecorder()
+	writeStateData(rec, req, "abc", state)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown field, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements the subset of GraphQL needed to query the vehicle
+// model: operations with variables, fields with aliases and arguments, and
+// nested selection sets. Fragments and directives are not supported.
+
+// gqlResolver resolves a field to a value. The value may be a gqlObject (whose
+// fields are resolved lazily, only when selected), or any JSON-encodable value
+// whose object keys can be selected as subfields.
+type gqlResolver func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// gqlObject is an object type whose fields are resolved on demand
+type gqlObject map[string]gqlResolver
+
+// gqlSchema holds the root operation types
+type gqlSchema struct {
+	Query    gqlObject
+	Mutation gqlObject
+}
+
+// gqlRequest is a GraphQL request as sent over HTTP
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// gqlError is an error in a GraphQL response
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlResponse is a GraphQL response
+type gqlResponse struct {
+	Data   interface{} `json:"data"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+// gqlOperation is a parsed query or mutation
+type gqlOperation struct {
+	Type         string
+	Name         string
+	Defaults     map[string]interface{}
+	SelectionSet []gqlField
+}
+
+// gqlField is a parsed field selection
+type gqlField struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]interface{}
+	SelectionSet []gqlField
+}
+
+// gqlVariable is a reference to an operation variable in an argument value
+type gqlVariable string
+
+// responseKey returns the key the field is reported under
+func (f gqlField) responseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// execute parses and runs a request against the schema. Field errors are
+// reported alongside partial data; request errors yield no data.
+func (s *gqlSchema) execute(ctx context.Context, req gqlRequest) gqlResponse {
+	operations, err := parseGraphQL(req.Query)
+	if err != nil {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}
+	}
+
+	operation, err := selectOperation(operations, req.OperationName)
+	if err != nil {
+		return gqlResponse{Errors: []gqlError{{Message: err.Error()}}}
+	}
+
+	root := s.Query
+	if operation.Type == "mutation" {
+		root = s.Mutation
+	}
+	if root == nil {
+		return gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("schema does not support %s operations", operation.Type)}}}
+	}
+
+	vars := make(map[string]interface{}, len(operation.Defaults)+len(req.Variables))
+	for name, value := range operation.Defaults {
+		vars[name] = value
+	}
+	for name, value := range req.Variables {
+		vars[name] = value
+	}
+
+	e := &gqlExecutor{vars: vars}
+	// Mutations run serially, in document order, as the spec requires
+	data := e.resolveObject(ctx, root, operation.SelectionSet, nil)
+	return gqlResponse{Data: data, Errors: e.errors}
+}
+
+// selectOperation picks the operation to run from a document
+func selectOperation(operations []gqlOperation, name string) (gqlOperation, error) {
+	if name == "" {
+		if len(operations) != 1 {
+			return gqlOperation{}, fmt.Errorf("operationName is required when the document has %d operations", len(operations))
+		}
+		return operations[0], nil
+	}
+
+	for _, operation := range operations {
+		if operation.Name == name {
+			return operation, nil
+		}
+	}
+	return gqlOperation{}, fmt.Errorf("unknown operation %q", name)
+}
+
+// gqlExecutor resolves selection sets, collecting field errors
+type gqlExecutor struct {
+	vars   map[string]interface{}
+	errors []gqlError
+}
+
+// fail records a field error
+func (e *gqlExecutor) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, gqlError{Message: err.Error(), Path: append([]interface{}(nil), path...)})
+}
+
+// resolveObject resolves the selected fields of a lazy object
+func (e *gqlExecutor) resolveObject(ctx context.Context, object gqlObject, selections []gqlField, path []interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(selections))
+	for _, field := range selections {
+		fieldPath := append(path, field.responseKey())
+
+		resolve, ok := object[field.Name]
+		if !ok {
+			e.fail(fieldPath, fmt.Errorf("unknown field %q", field.Name))
+			result[field.responseKey()] = nil
+			continue
+		}
+
+		args, err := e.bindArguments(field.Arguments)
+		if err != nil {
+			e.fail(fieldPath, err)
+			result[field.responseKey()] = nil
+			continue
+		}
+
+		value, err := resolve(ctx, args)
+		if err != nil {
+			e.fail(fieldPath, err)
+			result[field.responseKey()] = nil
+			continue
+		}
+
+		result[field.responseKey()] = e.complete(ctx, value, field, fieldPath)
+	}
+	return result
+}
+
+// complete shapes a resolved value according to the field's selection set
+func (e *gqlExecutor) complete(ctx context.Context, value interface{}, field gqlField, path []interface{}) interface{} {
+	if object, ok := value.(gqlObject); ok {
+		if len(field.SelectionSet) == 0 {
+			e.fail(path, fmt.Errorf("field %q must have a selection of subfields", field.Name))
+			return nil
+		}
+		return e.resolveObject(ctx, object, field.SelectionSet, path)
+	}
+
+	if objects, ok := value.([]gqlObject); ok {
+		items := make([]interface{}, len(objects))
+		for i, object := range objects {
+			items[i] = e.complete(ctx, object, field, append(path, i))
+		}
+		return items
+	}
+
+	// Plain data: select from its JSON representation
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	var generic interface{}
+	if err := json.Unmarshal(encoded, &generic); err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	return e.selectData(generic, field, path)
+}
+
+// selectData applies a selection set to decoded JSON data
+func (e *gqlExecutor) selectData(data interface{}, field gqlField, path []interface{}) interface{} {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		if len(field.SelectionSet) == 0 {
+			e.fail(path, fmt.Errorf("field %q must have a selection of subfields", field.Name))
+			return nil
+		}
+		result := make(map[string]interface{}, len(field.SelectionSet))
+		for _, sub := range field.SelectionSet {
+			value, ok := data[sub.Name]
+			if !ok {
+				e.fail(append(path, sub.responseKey()), fmt.Errorf("unknown field %q", sub.Name))
+				result[sub.responseKey()] = nil
+				continue
+			}
+			result[sub.responseKey()] = e.selectData(value, sub, append(path, sub.responseKey()))
+		}
+		return result
+	case []interface{}:
+		items := make([]interface{}, len(data))
+		for i, item := range data {
+			items[i] = e.selectData(item, field, append(path, i))
+		}
+		return items
+	default:
+		if len(field.SelectionSet) > 0 && data != nil {
+			e.fail(path, fmt.Errorf("field %q is a scalar and has no subfields", field.Name))
+			return nil
+		}
+		return data
+	}
+}
+
+// bindArguments substitutes variables into a field's arguments
+func (e *gqlExecutor) bindArguments(args map[string]interface{}) (map[string]interface{}, error) {
+	bound := make(map[string]interface{}, len(args))
+	for name, value := range args {
+		resolved, err := e.bindValue(value)
+		if err != nil {
+			return nil, err
+		}
+		bound[name] = resolved
+	}
+	return bound, nil
+}
+
+// bindValue substitutes variables into a single argument value
+func (e *gqlExecutor) bindValue(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case gqlVariable:
+		resolved, ok := e.vars[string(value)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not defined", value)
+		}
+		return resolved, nil
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			resolved, err := e.bindValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = resolved
+		}
+		return items, nil
+	case map[string]interface{}:
+		fields := make(map[string]interface{}, len(value))
+		for name, item := range value {
+			resolved, err := e.bindValue(item)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = resolved
+		}
+		return fields, nil
+	default:
+		return value, nil
+	}
+}
+
+// Argument helpers for resolvers
+
+// gqlString returns a string argument, or "" if absent
+func gqlString(args map[string]interface{}, name string) (string, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+	return s, nil
+}
+
+// gqlFloat returns a required numeric argument
+func gqlFloat(args map[string]interface{}, name string) (float64, error) {
+	switch value := args[name].(type) {
+	case float64:
+		return value, nil
+	case int64:
+		return float64(value), nil
+	case nil:
+		return 0, fmt.Errorf("argument %q is required", name)
+	default:
+		return 0, fmt.Errorf("argument %q must be a number", name)
+	}
+}
+
+// gqlInt returns a required integer argument
+func gqlInt(args map[string]interface{}, name string) (int, error) {
+	switch value := args[name].(type) {
+	case int64:
+		return int(value), nil
+	case float64:
+		if value != float64(int(value)) {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return int(value), nil
+	case nil:
+		return 0, fmt.Errorf("argument %q is required", name)
+	default:
+		return 0, fmt.Errorf("argument %q must be an integer", name)
+	}
+}
+
+// gqlBool returns a required boolean argument
+func gqlBool(args map[string]interface{}, name string) (bool, error) {
+	switch value := args[name].(type) {
+	case bool:
+		return value, nil
+	case nil:
+		return false, fmt.Errorf("argument %q is required", name)
+	default:
+		return false, fmt.Errorf("argument %q must be a boolean", name)
+	}
+}
+
+// Parsing
+
+// gqlParser is a recursive-descent parser over a GraphQL document
+type gqlParser struct {
+	src string
+	pos int
+}
+
+// parseGraphQL parses a document into its operations
+func parseGraphQL(src string) ([]gqlOperation, error) {
+	p := &gqlParser{src: src}
+
+	var operations []gqlOperation
+	for {
+		p.skipIgnored()
+		if p.pos >= len(p.src) {
+			break
+		}
+		operation, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("document contains no operations")
+	}
+	return operations, nil
+}
+
+// errorf reports a syntax error at the current position
+func (p *gqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// skipIgnored skips whitespace, commas and comments
+func (p *gqlParser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next significant byte, or 0 at the end of input
+func (p *gqlParser) peek() byte {
+	p.skipIgnored()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// expect consumes the given punctuator
+func (p *gqlParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// name consumes a name token
+func (p *gqlParser) name() (string, error) {
+	p.skipIgnored()
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (p.pos > start && c >= '0' && c <= '9') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if start == p.pos {
+		return "", p.errorf("expected name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// parseOperation parses a query or mutation, including the shorthand form
+func (p *gqlParser) parseOperation() (gqlOperation, error) {
+	operation := gqlOperation{Type: "query"}
+
+	if p.peek() != '{' {
+		keyword, err := p.name()
+		if err != nil {
+			return operation, err
+		}
+		switch keyword {
+		case "query", "mutation":
+			operation.Type = keyword
+		case "fragment", "subscription":
+			return operation, fmt.Errorf("%s definitions are not supported", keyword)
+		default:
+			return operation, p.errorf("unexpected %q", keyword)
+		}
+
+		if c := p.peek(); c != '{' && c != '(' {
+			if operation.Name, err = p.name(); err != nil {
+				return operation, err
+			}
+		}
+
+		if p.peek() == '(' {
+			if operation.Defaults, err = p.parseVariableDefinitions(); err != nil {
+				return operation, err
+			}
+		}
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return operation, err
+	}
+	operation.SelectionSet = selections
+	return operation, nil
+}
+
+// parseVariableDefinitions parses ($name: Type = default, ...), returning the
+// default values. Types are accepted but not checked.
+func (p *gqlParser) parseVariableDefinitions() (map[string]interface{}, error) {
+	defaults := make(map[string]interface{})
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	for p.peek() != ')' {
+		if err := p.expect('$'); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		if err := p.skipType(); err != nil {
+			return nil, err
+		}
+		if p.peek() == '=' {
+			p.pos++
+			value, err := p.parseValue(true)
+			if err != nil {
+				return nil, err
+			}
+			defaults[name] = value
+		}
+	}
+	p.pos++
+	return defaults, nil
+}
+
+// skipType consumes a type reference such as [String!]!
+func (p *gqlParser) skipType() error {
+	if p.peek() == '[' {
+		p.pos++
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect(']'); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek() == '!' {
+		p.pos++
+	}
+	return nil
+}
+
+// parseSelectionSet parses { field field(arg: value) { ... } }
+func (p *gqlParser) parseSelectionSet() ([]gqlField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	var fields []gqlField
+	for p.peek() != '}' {
+		if p.peek() == 0 {
+			return nil, p.errorf("unterminated selection set")
+		}
+		if strings.HasPrefix(p.src[p.pos:], "...") {
+			return nil, fmt.Errorf("fragments are not supported")
+		}
+		if p.peek() == '@' {
+			return nil, fmt.Errorf("directives are not supported")
+		}
+
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	p.pos++
+
+	if len(fields) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return fields, nil
+}
+
+// parseField parses a single field selection
+func (p *gqlParser) parseField() (gqlField, error) {
+	var field gqlField
+
+	name, err := p.name()
+	if err != nil {
+		return field, err
+	}
+	if p.peek() == ':' {
+		p.pos++
+		field.Alias = name
+		if name, err = p.name(); err != nil {
+			return field, err
+		}
+	}
+	field.Name = name
+
+	if p.peek() == '(' {
+		p.pos++
+		field.Arguments = make(map[string]interface{})
+		for p.peek() != ')' {
+			argName, err := p.name()
+			if err != nil {
+				return field, err
+			}
+			if err := p.expect(':'); err != nil {
+				return field, err
+			}
+			value, err := p.parseValue(false)
+			if err != nil {
+				return field, err
+			}
+			field.Arguments[argName] = value
+		}
+		p.pos++
+	}
+
+	if p.peek() == '@' {
+		return field, fmt.Errorf("directives are not supported")
+	}
+
+	if p.peek() == '{' {
+		if field.SelectionSet, err = p.parseSelectionSet(); err != nil {
+			return field, err
+		}
+	}
+	return field, nil
+}
+
+// parseValue parses an argument value. Integers decode to int64 and floats to
+// float64; enum values decode to their name as a string.
+func (p *gqlParser) parseValue(constant bool) (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '$':
+		if constant {
+			return nil, p.errorf("variables are not allowed here")
+		}
+		p.pos++
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return gqlVariable(name), nil
+	case c == '"':
+		return p.parseString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c == '[':
+		p.pos++
+		var items []interface{}
+		for p.peek() != ']' {
+			if p.peek() == 0 {
+				return nil, p.errorf("unterminated list")
+			}
+			item, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		p.pos++
+		return items, nil
+	case c == '{':
+		p.pos++
+		fields := make(map[string]interface{})
+		for p.peek() != '}' {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			value, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = value
+		}
+		p.pos++
+		return fields, nil
+	default:
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		default:
+			return name, nil
+		}
+	}
+}
+
+// parseString parses a double-quoted string
+func (p *gqlParser) parseString() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos++
+			// GraphQL string escapes are a subset of JSON's
+			var s string
+			if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+				return "", p.errorf("invalid string")
+			}
+			return s, nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		default:
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseNumber parses an integer or float literal
+func (p *gqlParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	isFloat := false
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' || c == 'e' || c == 'E' {
+			isFloat = true
+		} else if !(c == '-' || c == '+' || (c >= '0' && c <= '9')) {
+			break
+		}
+		p.pos++
+	}
+
+	literal := p.src[start:p.pos]
+	if isFloat {
+		f, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", literal)
+		}
+		return f, nil
+	}
+	i, err := strconv.ParseInt(literal, 10, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number %q", literal)
+	}
+	return i, nil
+}
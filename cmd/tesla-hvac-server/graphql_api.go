@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// maxGraphQLBodySize bounds the size of GraphQL request bodies
+const maxGraphQLBodySize = 1 << 20
+
+// GraphQLHandler serves the vehicle model over GraphQL. It resolves vehicles
+// through the API handler so both APIs see the same set of vehicles.
+type GraphQLHandler struct {
+	api    *APIHandler
+	schema *gqlSchema
+	logger *log.Logger
+}
+
+// NewGraphQLHandler creates a new GraphQL handler
+func NewGraphQLHandler(api *APIHandler, logger *log.Logger) *GraphQLHandler {
+	h := &GraphQLHandler{
+		api:    api,
+		logger: logger,
+	}
+	h.schema = &gqlSchema{
+		Query:    h.queryType(),
+		Mutation: h.mutationType(),
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler. Queries may be sent with GET or POST;
+// mutations require POST.
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req gqlRequest
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if vars := r.URL.Query().Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	case "POST":
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodySize)).Decode(&req); err != nil {
+			writeGraphQLError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	default:
+		writeGraphQLError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if req.Query == "" {
+		writeGraphQLError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	if r.Method == "GET" && isMutation(req) {
+		writeGraphQLError(w, http.StatusMethodNotAllowed, "Mutations require POST")
+		return
+	}
+
+	// Once API keys or user accounts exist, queries need a key or a login
+	// and mutations a role that can control the vehicle
+	ctx := r.Context()
+	if h.api.authRequired() {
+		user, ok := h.api.requestUser(r)
+		if !ok {
+			writeGraphQLError(w, http.StatusUnauthorized, "API key or login required")
+			return
+		}
+		if !user.Role.CanControl() && isMutation(req) {
+			writeGraphQLError(w, http.StatusForbidden, "Your role can't control the vehicle")
+			return
+		}
+		ctx = profile.WithProfile(ctx, user)
+	}
+
+	resp := h.schema.execute(ctx, req)
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Printf("Failed to encode GraphQL response: %v", err)
+	}
+}
+
+// isMutation reports whether the request's operation is a mutation
+func isMutation(req gqlRequest) bool {
+	operations, err := parseGraphQL(req.Query)
+	if err != nil {
+		return false
+	}
+	operation, err := selectOperation(operations, req.OperationName)
+	return err == nil && operation.Type == "mutation"
+}
+
+// writeGraphQLError writes a request-level error in GraphQL response format
+func writeGraphQLError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(gqlResponse{Errors: []gqlError{{Message: message}}})
+}
+
+// queryType returns the root query type
+//
+//	vehicles: [Vehicle]
+//	vehicle(vin: String): Vehicle
+func (h *GraphQLHandler) queryType() gqlObject {
+	return gqlObject{
+		"vehicles": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			clients := h.api.vehicles()
+			vehicles := make([]gqlObject, len(clients))
+			for i, client := range clients {
+				vehicles[i] = h.vehicleType(client)
+			}
+			return vehicles, nil
+		},
+		"vehicle": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			client, err := h.vehicleArg(args)
+			if err != nil {
+				return nil, err
+			}
+			return h.vehicleType(client), nil
+		},
+	}
+}
+
+// mutationType returns the root mutation type. Each mutation returns the
+// vehicle so clients can select its updated state in the same request.
+//
+//	connect(vin: String): Vehicle
+//	set_temperature(vin: String, driver_temp: Float!, passenger_temp: Float): Vehicle
+//	set_climate(vin: String, on: Boolean!): Vehicle
+//	set_fan_speed(vin: String, speed: Int!): Vehicle
+//	set_auto_mode(vin: String, enabled: Boolean!): Vehicle
+func (h *GraphQLHandler) mutationType() gqlObject {
+	return gqlObject{
+		"connect": h.mutation(func(ctx context.Context, client *tesla.Client, args map[string]interface{}) error {
+			return client.Connect(ctx, client.GetPrivateKeyFile())
+		}),
+		"set_temperature": h.mutation(func(ctx context.Context, client *tesla.Client, args map[string]interface{}) error {
+			driver, err := gqlFloat(args, "driver_temp")
+			if err != nil {
+				return err
+			}
+			passenger := driver
+			if _, ok := args["passenger_temp"]; ok {
+				if passenger, err = gqlFloat(args, "passenger_temp"); err != nil {
+					return err
+				}
+			}
+			// Temperatures are in Fahrenheit, as in the REST API
+			return client.SetTemperature(ctx, float32(fahrenheitToCelsius(driver)), float32(fahrenheitToCelsius(passenger)))
+		}),
+		"set_climate": h.mutation(func(ctx context.Context, client *tesla.Client, args map[string]interface{}) error {
+			on, err := gqlBool(args, "on")
+			if err != nil {
+				return err
+			}
+			if on {
+				return client.SetClimateOn(ctx)
+			}
+			return client.SetClimateOff(ctx)
+		}),
+		"set_fan_speed": h.mutation(func(ctx context.Context, client *tesla.Client, args map[string]interface{}) error {
+			speed, err := gqlInt(args, "speed")
+			if err != nil {
+				return err
+			}
+			return client.SetFanSpeed(ctx, tesla.FanSpeed(speed))
+		}),
+		"set_auto_mode": h.mutation(func(ctx context.Context, client *tesla.Client, args map[string]interface{}) error {
+			enabled, err := gqlBool(args, "enabled")
+			if err != nil {
+				return err
+			}
+			return client.SetAutoMode(ctx, enabled)
+		}),
+	}
+}
+
+// mutation wraps a vehicle command as a resolver returning the vehicle
+func (h *GraphQLHandler) mutation(command func(ctx context.Context, client *tesla.Client, args map[string]interface{}) error) gqlResolver {
+	return func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		client, err := h.vehicleArg(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := command(ctx, client, args); err != nil {
+			h.logger.Printf("GraphQL mutation failed: %v", err)
+			return nil, err
+		}
+		return h.vehicleType(client), nil
+	}
+}
+
+// vehicleArg returns the vehicle selected by the optional vin argument. If vin
+// is omitted and there is exactly one vehicle, that vehicle is used.
+func (h *GraphQLHandler) vehicleArg(args map[string]interface{}) (*tesla.Client, error) {
+	vin, err := gqlString(args, "vin")
+	if err != nil {
+		return nil, err
+	}
+
+	clients := h.api.vehicles()
+	if vin == "" {
+		if len(clients) != 1 {
+			return nil, fmt.Errorf("argument \"vin\" is required when more than one vehicle is configured")
+		}
+		return clients[0], nil
+	}
+
+	for _, client := range clients {
+		if client.GetVIN() == vin {
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown vehicle %q", vin)
+}
+
+// vehicleType returns the Vehicle object for a client
+//
+//	vin: String
+//	connected: Boolean
+//	status: VehicleStatus        # probes the link
+//	state: HVACState             # reads from the vehicle
+//	last_state: StateSnapshot    # most recent reading, no vehicle round trip
+func (h *GraphQLHandler) vehicleType(client *tesla.Client) gqlObject {
+	return gqlObject{
+		"vin": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return client.GetVIN(), nil
+		},
+		"connected": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return client.IsConnected(), nil
+		},
+		"status": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return vehicleStatusWithTimeout(ctx, client, defaultVehicleStatusTimeout), nil
+		},
+		"state": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			state, err := client.GetHVACState(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return displayState(state), nil
+		},
+		"last_state": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			snapshot, ok := client.LastState()
+			if !ok {
+				return nil, nil
+			}
+			return map[string]interface{}{
+				"state":   displayState(snapshot.State),
+				"etag":    snapshot.ETag,
+				"read_at": snapshot.ReadAt,
+			}, nil
+		},
+	}
+}
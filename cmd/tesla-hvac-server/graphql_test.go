@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testGraphQLSchema() *gqlSchema {
+	return &gqlSchema{
+		Query: gqlObject{
+			"greeting": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				name, err := gqlString(args, "name")
+				if err != nil {
+					return nil, err
+				}
+				return "hello " + name, nil
+			},
+			"item": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return testState{IsOn: true, DriverTemp: 21.5, FanSpeed: 3}, nil
+			},
+			"broken": func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				return nil, errors.New("boom")
+			},
+		},
+	}
+}
+
+func TestGraphQLParse(t *testing.T) {
+	operations, err := parseGraphQL(`
+		# comment
+		query Get($vin: String = "X", $n: Int!) {
+			v: vehicle(vin: $vin, list: [1, 2.5, "s"], obj: {a: true, b: null}, e: FAST) {
+				state { is_on }
+			}
+		}
+		mutation { connect }
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(operations) != 2 {
+		t.Fatalf("Expected 2 operations, got %d", len(operations))
+	}
+
+	query := operations[0]
+	if query.Type != "query" || query.Name != "Get" || query.Defaults["vin"] != "X" {
+		t.Errorf("Unexpected operation: %+v", query)
+	}
+
+	field := query.SelectionSet[0]
+	if field.Alias != "v" || field.Name != "vehicle" {
+		t.Errorf("Unexpected field: %+v", field)
+	}
+	if field.Arguments["vin"] != gqlVariable("vin") || field.Arguments["e"] != "FAST" {
+		t.Errorf("Unexpected arguments: %+v", field.Arguments)
+	}
+	if list := field.Arguments["list"].([]interface{}); list[0] != int64(1) || list[1] != 2.5 {
+		t.Errorf("Unexpected list argument: %+v", list)
+	}
+	if operations[1].Type != "mutation" {
+		t.Errorf("Expected mutation, got %s", operations[1].Type)
+	}
+}
+
+func TestGraphQLParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"{",
+		"{ }",
+		"{ a(b: ) }",
+		"{ ...frag }",
+		"fragment F on T { a }",
+		`{ a(b: "unterminated) }`,
+	} {
+		if _, err := parseGraphQL(query); err == nil {
+			t.Errorf("Query %q: expected error", query)
+		}
+	}
+}
+
+func TestGraphQLExecute(t *testing.T) {
+	schema := testGraphQLSchema()
+
+	resp := schema.execute(context.Background(), gqlRequest{
+		Query:     `query($who: String) { hi: greeting(name: $who) item { is_on fan_speed } broken }`,
+		Variables: map[string]interface{}{"who": "world"},
+	})
+
+	data := resp.Data.(map[string]interface{})
+	if data["hi"] != "hello world" {
+		t.Errorf("Unexpected greeting: %v", data["hi"])
+	}
+
+	item := data["item"].(map[string]interface{})
+	if len(item) != 2 || item["is_on"] != true {
+		t.Errorf("Unexpected item selection: %+v", item)
+	}
+
+	if data["broken"] != nil || len(resp.Errors) != 1 || resp.Errors[0].Message != "boom" {
+		t.Errorf("Expected field error for broken, got %+v", resp.Errors)
+	}
+}
+
+func TestGraphQLExecuteFieldErrors(t *testing.T) {
+	schema := testGraphQLSchema()
+
+	tests := []string{
+		`{ missing }`,
+		`{ item }`,
+		`{ item { nope } }`,
+		`{ greeting(name: $undefined) }`,
+		`mutation { greeting }`,
+	}
+	for _, query := range tests {
+		resp := schema.execute(context.Background(), gqlRequest{Query: query})
+		if len(resp.Errors) == 0 {
+			t.Errorf("Query %q: expected errors", query)
+		}
+	}
+}
+
+func TestGraphQLHandler(t *testing.T) {
+	handler := NewGraphQLHandler(newTestAPIHandler(), log.New(io.Discard, "", 0))
+
+	body := `{"query": "{ vehicles { vin connected last_state { etag } } }"}`
+	req := httptest.NewRequest("POST", "/api/graphql", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Data struct {
+			Vehicles []struct {
+				VIN       string      `json:"vin"`
+				Connected bool        `json:"connected"`
+				LastState interface{} `json:"last_state"`
+			} `json:"vehicles"`
+		} `json:"data"`
+		Errors []gqlError `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Errors) != 0 {
+		t.Fatalf("Unexpected errors: %+v", resp.Errors)
+	}
+	if len(resp.Data.Vehicles) != 1 || resp.Data.Vehicles[0].VIN != "TEST_VIN" || resp.Data.Vehicles[0].LastState != nil {
+		t.Errorf("Unexpected vehicles: %+v", resp.Data.Vehicles)
+	}
+}
+
+func TestGraphQLHandlerMutationErrors(t *testing.T) {
+	handler := NewGraphQLHandler(newTestAPIHandler(), log.New(io.Discard, "", 0))
+
+	// Mutations are not allowed over GET
+	req := httptest.NewRequest("GET", "/api/graphql?query=mutation%7Bset_climate(on%3Atrue)%7Bvin%7D%7D", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+
+	// Commands against a disconnected vehicle report a field error
+	body := `{"query": "mutation { set_climate(on: true) { vin } }"}`
+	req = httptest.NewRequest("POST", "/api/graphql", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp gqlResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "not connected") {
+		t.Errorf("Expected not connected error, got %+v", resp.Errors)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// Health rollups, for the server and for each vehicle
+const (
+	healthOK        = "ok"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+)
+
+// Reasons /readyz isn't ready
+var (
+	errNoVehicleConnected    = errors.New("no vehicle is connected")
+	errAdapterNotInitialized = errors.New("the Bluetooth adapter hasn't been initialized")
+)
+
+// vehicleHealth is a vehicle's entry in /health
+type vehicleHealth struct {
+	VIN            string                `json:"vin"`
+	Status         string                `json:"status"`
+	Connected      bool                  `json:"connected"`
+	State          tesla.ConnectionState `json:"connection_state"`
+	Transport      tesla.TransportType   `json:"transport,omitempty"` // Of the current connection
+	CircuitBreaker string                `json:"circuit_breaker"`
+	LastCommandAt  time.Time             `json:"last_command_at,omitempty"`
+	Queue          tesla.QueueStats      `json:"queue"`
+	tesla.HealthStatus
+}
+
+// configHealth reports whether the server runs on the config file as it is
+type configHealth struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// healthReport is the body of /health
+type healthReport struct {
+	Status     string                  `json:"status"`
+	BLEAdapter *tesla.AdapterStatus    `json:"ble_adapter,omitempty"` // When a vehicle uses BLE
+	Config     *configHealth           `json:"config,omitempty"`      // With a config file
+	Vehicles   []vehicleHealth         `json:"vehicles"`
+	Subsystems []tesla.SubsystemStatus `json:"subsystems"`
+}
+
+// vehicleStatus rolls up a vehicle's health. A vehicle is unhealthy when it
+// can't take commands: its circuit breaker is open, its connection failed,
+// or it has only BLE and the adapter is down. It is degraded while
+// recovering or failing health checks.
+func vehicleStatus(v vehicleHealth, client *tesla.Client, adapter tesla.AdapterStatus) string {
+	bleOnly := client.Transport() == tesla.TransportBLE && !client.UsesTransport(tesla.TransportFleet)
+	switch {
+	case client.CircuitState() == tesla.CircuitOpen, v.State == tesla.StateError:
+		return healthUnhealthy
+	case adapter.State == tesla.AdapterError && bleOnly:
+		return healthUnhealthy
+	case adapter.State == tesla.AdapterError && client.UsesTransport(tesla.TransportBLE):
+		return healthDegraded
+	case client.CircuitState() == tesla.CircuitHalfOpen, v.State == tesla.StateReconnecting:
+		return healthDegraded
+	case v.Connected && !v.Healthy && !v.LastCheckAt.IsZero():
+		return healthDegraded
+	}
+	return healthOK
+}
+
+// healthHandler serves /health with the state of each vehicle, the
+// Bluetooth adapter, the config file and the supervised subsystems. Status
+// is "unhealthy", with a 503, when the config is invalid or no vehicle can
+// take commands, and "degraded" when any part is.
+func healthHandler(registry *tesla.Registry, supervisor *tesla.Supervisor, configManager *tesla.ConfigManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{Status: healthOK, Subsystems: supervisor.Status()}
+		degrade := func(status string) {
+			if status == healthUnhealthy || report.Status == healthOK {
+				report.Status = status
+			}
+		}
+
+		adapter := tesla.BLEAdapterStatus()
+		clients := registry.Clients()
+		unhealthy := 0
+		report.Vehicles = make([]vehicleHealth, 0, len(clients))
+		for _, client := range clients {
+			if client.UsesTransport(tesla.TransportBLE) {
+				report.BLEAdapter = &adapter
+			}
+			v := vehicleHealth{
+				VIN:            client.GetVIN(),
+				Connected:      client.IsConnected(),
+				State:          client.ConnectionState(),
+				Transport:      client.ActiveTransport(),
+				CircuitBreaker: client.CircuitState().String(),
+				LastCommandAt:  client.LastCommandAt(),
+				Queue:          client.QueueStats(),
+				HealthStatus:   client.Health(),
+			}
+			v.Status = vehicleStatus(v, client, adapter)
+			if v.Status == healthUnhealthy {
+				unhealthy++
+			}
+			if v.Status != healthOK {
+				degrade(healthDegraded)
+			}
+			report.Vehicles = append(report.Vehicles, v)
+		}
+		if unhealthy > 0 && unhealthy == len(clients) {
+			degrade(healthUnhealthy)
+		}
+
+		// A rejected reload leaves the previous config running
+		if configManager != nil {
+			report.Config = &configHealth{Valid: true}
+			if err := configManager.GetConfig().Validate(); err != nil {
+				report.Config = &configHealth{Error: err.Error()}
+				degrade(healthUnhealthy)
+			} else if err := configManager.ReloadError(); err != nil {
+				report.Config = &configHealth{Error: err.Error()}
+				degrade(healthDegraded)
+			}
+		}
+
+		// Subsystems waiting to restart after a failure
+		for _, subsystem := range report.Subsystems {
+			if !subsystem.Running && subsystem.LastError != "" {
+				degrade(healthDegraded)
+			}
+		}
+
+		status := http.StatusOK
+		if report.Status == healthUnhealthy {
+			status = http.StatusServiceUnavailable
+		}
+		writeData(w, status, report)
+	}
+}
+
+// livenessHandler serves /healthz, which answers while the process can serve
+// requests. A failure means the server should be restarted.
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeData(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// readinessCheck is one condition of /readyz
+type readinessCheck struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// readinessHandler serves /readyz, which returns 503 until the server can
+// take commands: the config is valid, a vehicle is connected and, when a
+// vehicle connects over BLE first, the Bluetooth adapter is up. Unlike
+// /healthz, a failure means waiting rather than restarting.
+func readinessHandler(registry *tesla.Registry, configManager *tesla.ConfigManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var checks []readinessCheck
+		check := func(name string, err error) {
+			c := readinessCheck{Name: name, Ready: err == nil}
+			if err != nil {
+				c.Error = err.Error()
+			}
+			checks = append(checks, c)
+		}
+
+		if configManager != nil {
+			check("config", configManager.GetConfig().Validate())
+		}
+
+		var vehicleErr error = errNoVehicleConnected
+		needsAdapter := false
+		for _, client := range registry.Clients() {
+			if client.IsConnected() {
+				vehicleErr = nil
+			}
+			if client.Transport() == tesla.TransportBLE {
+				needsAdapter = true
+			}
+		}
+		check("vehicle", vehicleErr)
+
+		if needsAdapter {
+			var adapterErr error
+			if adapter := tesla.BLEAdapterStatus(); adapter.State == tesla.AdapterError {
+				adapterErr = errors.New(adapter.Error)
+			} else if adapter.State != tesla.AdapterOK {
+				adapterErr = errAdapterNotInitialized
+			}
+			check("ble_adapter", adapterErr)
+		}
+
+		status, code := "ready", http.StatusOK
+		for _, c := range checks {
+			if !c.Ready {
+				status, code = "not_ready", http.StatusServiceUnavailable
+			}
+		}
+		writeData(w, code, map[string]interface{}{"status": status, "checks": checks})
+	}
+}
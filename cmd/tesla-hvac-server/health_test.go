@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// healthBody is the part of /health the tests check
+type healthBody struct {
+	Data struct {
+		Status     string `json:"status"`
+		BLEAdapter *struct {
+			State string `json:"state"`
+		} `json:"ble_adapter"`
+		Config *struct {
+			Valid bool   `json:"valid"`
+			Error string `json:"error"`
+		} `json:"config"`
+		Vehicles []struct {
+			VIN            string `json:"vin"`
+			Status         string `json:"status"`
+			Connected      bool   `json:"connected"`
+			State          string `json:"connection_state"`
+			CircuitBreaker string `json:"circuit_breaker"`
+			Healthy        bool   `json:"healthy"`
+		} `json:"vehicles"`
+	} `json:"data"`
+}
+
+// getHealth serves /health and decodes the response
+func getHealth(t *testing.T, handler http.HandlerFunc) (int, healthBody) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/health", nil))
+	var body healthBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return rec.Code, body
+}
+
+func TestHealthHandler(t *testing.T) {
+	registry := tesla.NewRegistry()
+	registry.Add(tesla.NewClient("VIN_A", nil), "")
+	registry.Add(tesla.NewClient("VIN_B", nil), "")
+	supervisor := tesla.NewSupervisor(nil)
+
+	code, body := getHealth(t, healthHandler(registry, supervisor, nil))
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if body.Data.Status != "ok" || len(body.Data.Vehicles) != 2 || body.Data.Config != nil {
+		t.Fatalf("Unexpected health %+v", body.Data)
+	}
+	if body.Data.BLEAdapter == nil || body.Data.BLEAdapter.State == "" {
+		t.Errorf("Expected the adapter state for BLE vehicles, got %+v", body.Data.BLEAdapter)
+	}
+	vehicle := body.Data.Vehicles[0]
+	if vehicle.VIN != "VIN_A" || vehicle.Connected || vehicle.Healthy || vehicle.State != "disconnected" ||
+		vehicle.Status != "ok" || vehicle.CircuitBreaker != "closed" {
+		t.Errorf("Unexpected vehicle health %+v", vehicle)
+	}
+}
+
+func TestHealthHandlerConfig(t *testing.T) {
+	_, configManager := newTestPresetHandler(t)
+	registry := tesla.NewRegistry()
+	registry.Add(tesla.NewClient("TEST_VIN", nil), "")
+	handler := healthHandler(registry, tesla.NewSupervisor(nil), configManager)
+
+	code, body := getHealth(t, handler)
+	if code != http.StatusOK || body.Data.Config == nil || !body.Data.Config.Valid {
+		t.Fatalf("Expected a valid config, got %d %+v", code, body.Data.Config)
+	}
+
+	// An edit that fails to load leaves the server degraded on the old config
+	if err := os.WriteFile(configManager.GetConfig().ConfigPath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := configManager.Reload(); err == nil {
+		t.Fatal("Expected the reload to fail")
+	}
+	code, body = getHealth(t, handler)
+	if code != http.StatusOK || body.Data.Status != "degraded" || body.Data.Config.Valid || body.Data.Config.Error == "" {
+		t.Errorf("Expected degraded with the reload error, got %d %+v", code, body.Data)
+	}
+
+	// A config that doesn't validate is unhealthy
+	configManager.GetConfig().Tracing.Endpoint = "localhost:4318"
+	code, body = getHealth(t, handler)
+	if code != http.StatusServiceUnavailable || body.Data.Status != "unhealthy" {
+		t.Errorf("Expected 503 unhealthy, got %d %+v", code, body.Data)
+	}
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	rec := httptest.NewRecorder()
+	livenessHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /healthz to answer 200, got %d", rec.Code)
+	}
+
+	_, configManager := newTestPresetHandler(t)
+	registry := tesla.NewRegistry()
+	registry.Add(tesla.NewClient("TEST_VIN", nil), "")
+
+	// Alive but not ready until a vehicle is connected
+	rec = httptest.NewRecorder()
+	readinessHandler(registry, configManager)(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var body struct {
+		Data struct {
+			Status string `json:"status"`
+			Checks []struct {
+				Name  string `json:"name"`
+				Ready bool   `json:"ready"`
+				Error string `json:"error"`
+			} `json:"checks"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || body.Data.Status != "not_ready" {
+		t.Fatalf("Expected 503 not_ready, got %d %+v", rec.Code, body.Data)
+	}
+	ready := map[string]bool{}
+	for _, check := range body.Data.Checks {
+		ready[check.Name] = check.Ready
+		if !check.Ready && check.Error == "" {
+			t.Errorf("Expected a reason for %s", check.Name)
+		}
+	}
+	if len(ready) != 3 || !ready["config"] || ready["vehicle"] {
+		t.Errorf("Unexpected checks %+v", body.Data.Checks)
+	}
+	if _, ok := ready["ble_adapter"]; !ok {
+		t.Errorf("Expected the adapter checked for a BLE vehicle, got %+v", body.Data.Checks)
+	}
+}
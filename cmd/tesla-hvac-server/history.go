@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/history"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// historyEventBuffer is how many events may queue for the command recorder
+const historyEventBuffer = 32
+
+// historyPruneInterval is how often records past the retention period are
+// dropped
+const historyPruneInterval = time.Hour
+
+// HistoryHandler serves the state samples recorded by the pollers and the
+// commands sent to each vehicle
+type HistoryHandler struct {
+	api    *APIHandler
+	store  history.Store
+	logger *log.Logger
+}
+
+// NewHistoryHandler creates a handler for a history store
+func NewHistoryHandler(api *APIHandler, store history.Store, logger *log.Logger) *HistoryHandler {
+	return &HistoryHandler{
+		api:    api,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Start records every vehicle's commands under the supervisor, polls their
+// state if the config enables it, and prunes expired records
+func (h *HistoryHandler) Start(supervisor *tesla.Supervisor, config history.Config) error {
+	if err := supervisor.Add("history-prune", h.prune); err != nil {
+		return err
+	}
+	for _, client := range h.api.vehicles() {
+		if err := supervisor.Add("command-history:"+client.GetVIN(), func(ctx context.Context) error {
+			return h.recordCommands(ctx, client)
+		}); err != nil {
+			return err
+		}
+
+		if !config.Enabled() {
+			continue
+		}
+		poller := tesla.NewPoller(client, config.PollInterval, h.store, h.logger)
+		if err := supervisor.Add("poller:"+client.GetVIN(), poller.Run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordCommands adds the commands sent to a vehicle to the history until
+// ctx is cancelled
+func (h *HistoryHandler) recordCommands(ctx context.Context, client *tesla.Client) error {
+	events, unsubscribe := client.Events().Subscribe(historyEventBuffer)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			command, ok := event.Data.(tesla.Command)
+			if event.Type != tesla.EventCommandSent || !ok {
+				continue
+			}
+			if err := h.store.AddCommand(history.Command{Time: event.Timestamp, VIN: event.VIN, Name: command.Name}); err != nil {
+				h.logger.Printf("Failed to record command %s: %v", command.Name, err)
+			}
+		}
+	}
+}
+
+// prune drops expired records now and every historyPruneInterval until ctx
+// is cancelled
+func (h *HistoryHandler) prune(ctx context.Context) error {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.store.Prune(time.Now()); err != nil {
+			h.logger.Printf("Failed to prune history: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ServeHTTP implements http.Handler for GET /history, the state samples, and
+// GET /history/commands. ?since= and ?until= take RFC 3339 times, or a
+// duration such as 6h for that long ago. Records are listed oldest first, a
+// page at a time.
+func (h *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/history" && r.URL.Path != "/history/commands" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	client, err := h.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	query, err := parseHistoryQuery(r, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	query.VIN = client.GetVIN()
+
+	if r.URL.Path == "/history/commands" {
+		commands, err := h.store.Commands(query)
+		if err != nil {
+			h.queryFailed(w, err)
+			return
+		}
+		writeList(w, r, commands, func(command history.Command) string { return strconv.FormatUint(command.ID, 10) })
+		return
+	}
+	samples, err := h.store.Query(query)
+	if err != nil {
+		h.queryFailed(w, err)
+		return
+	}
+	writeList(w, r, samples, func(sample history.Sample) string { return strconv.FormatUint(sample.ID, 10) })
+}
+
+// queryFailed reports a history store error
+func (h *HistoryHandler) queryFailed(w http.ResponseWriter, err error) {
+	h.logger.Printf("Failed to query history: %v", err)
+	writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to query history")
+}
+
+// parseHistoryQuery reads the time range of a history request
+func parseHistoryQuery(r *http.Request, now time.Time) (history.Query, error) {
+	var query history.Query
+	var err error
+
+	if query.Since, err = parseHistoryTime(r.URL.Query().Get("since"), now); err != nil {
+		return query, fmt.Errorf("since: %w", err)
+	}
+	if query.Until, err = parseHistoryTime(r.URL.Query().Get("until"), now); err != nil {
+		return query, fmt.Errorf("until: %w", err)
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		return query, fmt.Errorf("since must be before until")
+	}
+	return query, nil
+}
+
+// parseHistoryTime parses an RFC 3339 time, or a duration before now
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("must be an RFC 3339 time or a positive duration")
+	}
+	return now.Add(-d), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/history"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	api := newTestAPIHandler()
+	store := history.NewMemory(history.Config{})
+	api.Mount("/history", NewHistoryHandler(api, store, log.New(io.Discard, "", 0)))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	store.Add(history.Sample{Time: now.Add(-2 * time.Hour), VIN: "TEST_VIN", InsideTempCelsius: 12})
+	store.Add(history.Sample{Time: now.Add(-30 * time.Minute), VIN: "TEST_VIN", InsideTempCelsius: 20, ClimateOn: true})
+	store.Add(history.Sample{Time: now.Add(-10 * time.Minute), VIN: "OTHER_VIN"})
+
+	var meta Meta
+	query := func(path string) []history.Sample {
+		t.Helper()
+		rec := servePreset(api, "GET", path, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+		var env struct {
+			Data []history.Sample `json:"data"`
+			Meta Meta             `json:"meta"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		meta = env.Meta
+		return env.Data
+	}
+
+	if samples := query("/history"); len(samples) != 2 {
+		t.Errorf("Expected the vehicle's two samples, got %+v", samples)
+	}
+	if samples := query("/history?since=1h"); len(samples) != 1 || !samples[0].ClimateOn {
+		t.Errorf("Expected the last hour's sample, got %+v", samples)
+	}
+	until := now.Add(-time.Hour).Format(time.RFC3339)
+	if samples := query("/history?until=" + until); len(samples) != 1 || samples[0].InsideTempCelsius != 12 {
+		t.Errorf("Expected the sample before %s, got %+v", until, samples)
+	}
+
+	// Pages run oldest first
+	if samples := query("/history?limit=1"); len(samples) != 1 || samples[0].InsideTempCelsius != 12 || !meta.HasMore {
+		t.Errorf("Expected the first sample and more to come, got %+v, %+v", samples, meta)
+	}
+	if samples := query("/history?limit=1&cursor=" + meta.NextCursor); len(samples) != 1 || samples[0].InsideTempCelsius != 20 || meta.HasMore {
+		t.Errorf("Expected the last sample, got %+v, %+v", samples, meta)
+	}
+}
+
+func TestHistoryPagesSameTime(t *testing.T) {
+	api := newTestAPIHandler()
+	store := history.NewMemory(history.Config{})
+	api.Mount("/history", NewHistoryHandler(api, store, log.New(io.Discard, "", 0)))
+
+	// Samples taken at the same time each get their own cursor
+	at := time.Now().UTC().Add(-time.Minute)
+	for i := 0; i < 3; i++ {
+		store.Add(history.Sample{Time: at, VIN: "TEST_VIN", InsideTempCelsius: float32(i)})
+	}
+
+	var seen []float32
+	path := "/history?limit=1"
+	for page := 0; page < 5; page++ {
+		rec := servePreset(api, "GET", path, "")
+		var env struct {
+			Data []history.Sample `json:"data"`
+			Meta Meta             `json:"meta"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		for _, sample := range env.Data {
+			seen = append(seen, sample.InsideTempCelsius)
+		}
+		if !env.Meta.HasMore {
+			break
+		}
+		path = "/history?limit=1&cursor=" + env.Meta.NextCursor
+	}
+	if len(seen) != 3 || seen[0] != 0 || seen[1] != 1 || seen[2] != 2 {
+		t.Errorf("Expected each sample once, in order, got %v", seen)
+	}
+}
+
+func TestHistoryCommands(t *testing.T) {
+	api := newTestAPIHandler()
+	store := history.NewMemory(history.Config{})
+	handler := NewHistoryHandler(api, store, log.New(io.Discard, "", 0))
+	api.Mount("/history", handler)
+
+	client, err := api.vehicle("TEST_VIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		handler.recordCommands(ctx, client)
+		close(done)
+	}()
+
+	// Wait for the recorder to subscribe before publishing
+	for client.Events().SubscriberCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	client.Events().Publish(tesla.Event{Type: tesla.EventStateUpdated, VIN: "TEST_VIN"})
+	client.Events().Publish(tesla.Event{Type: tesla.EventCommandSent, VIN: "TEST_VIN", Data: tesla.Command{Name: "climate_on", VIN: "TEST_VIN"}})
+
+	// Wait for the command to be recorded
+	deadline := time.Now().Add(time.Second)
+	for {
+		commands, _ := store.Commands(history.Query{})
+		if len(commands) > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	rec := servePreset(api, "GET", "/history/commands", "")
+	var env struct {
+		Data []history.Command `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(env.Data) != 1 || env.Data[0].Name != "climate_on" {
+		t.Errorf("Expected the sent command, got %s", rec.Body.String())
+	}
+}
+
+func TestHistoryQueryErrors(t *testing.T) {
+	api := newTestAPIHandler()
+	api.Mount("/history", NewHistoryHandler(api, history.NewMemory(history.Config{}), log.New(io.Discard, "", 0)))
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/history?since=yesterday", http.StatusBadRequest},
+		{"/history?since=1h&until=2h", http.StatusBadRequest},
+		{"/history?limit=0", http.StatusBadRequest},
+		{"/history?cursor=bWlzc2luZw", http.StatusBadRequest},
+		{"/history?vin=OTHER_VIN", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := servePreset(api, "GET", tt.path, ""); rec.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", "/history", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
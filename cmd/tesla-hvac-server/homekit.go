@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/homekit"
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+const (
+	// homekitCommandTimeout bounds a command from the Home app
+	homekitCommandTimeout = 2 * time.Minute
+	// homekitEventBuffer is how many vehicle events may queue for HomeKit
+	homekitEventBuffer = 16
+)
+
+// homekitSeats are the seat heaters exposed as switches
+var homekitSeats = []struct {
+	seat vehicle.SeatPosition
+	name string
+}{
+	{vehicle.SeatFrontLeft, "Driver Seat Heater"},
+	{vehicle.SeatFrontRight, "Passenger Seat Heater"},
+}
+
+// firmwarePattern is the version format HomeKit accepts
+var firmwarePattern = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// HomeKitBridge exposes each vehicle to the Home app and Siri as a
+// thermostat, which turns climate on (auto) or off and sets the cabin
+// temperature, with a switch for each front seat heater. Seat heater levels
+// aren't part of the vehicle state, so the switches show the last level set
+// through HomeKit.
+type HomeKitBridge struct {
+	server   *homekit.Server
+	vehicles []*homekitVehicle
+	logger   *log.Logger
+}
+
+// homekitVehicle is a vehicle's accessory
+type homekitVehicle struct {
+	client     *tesla.Client
+	thermostat *homekit.Thermostat
+}
+
+// NewHomeKitBridge creates a bridge for the API's vehicles, keeping its
+// pairings in dir
+func NewHomeKitBridge(api *APIHandler, config homekit.Config, dir string, logger *log.Logger) (*HomeKitBridge, error) {
+	name := config.Name
+	if name == "" {
+		name = homekit.DefaultName
+	}
+	firmware := strings.TrimPrefix(version, "v")
+	if !firmwarePattern.MatchString(firmware) {
+		firmware = "0.0.1"
+	}
+
+	b := &HomeKitBridge{logger: logger}
+	accessories := []*homekit.Accessory{homekit.NewAccessory(homekit.AccessoryInfo{
+		Name:         name,
+		Manufacturer: "Tesla",
+		Model:        "HVAC Bridge",
+		SerialNumber: "tesla-hvac-server",
+		Firmware:     firmware,
+	})}
+	for _, client := range api.vehicles() {
+		vehicleName := api.registry.Name(client.GetVIN())
+		if vehicleName == "" {
+			vehicleName = "Tesla " + lastChars(client.GetVIN(), 6)
+		}
+		accessory := homekit.NewAccessory(homekit.AccessoryInfo{
+			Name:         vehicleName,
+			Manufacturer: "Tesla",
+			Model:        "Vehicle",
+			SerialNumber: client.GetVIN(),
+			Firmware:     firmware,
+		})
+		v := b.addVehicle(client, vehicleName)
+		accessory.AddService(v.thermostat.Service)
+		for _, seat := range homekitSeats {
+			heater := homekit.NewSwitch(seat.name)
+			heater.On.OnWrite = v.seatHeater(seat.seat)
+			accessory.AddService(heater.Service)
+		}
+		accessories = append(accessories, accessory)
+	}
+
+	server, err := homekit.NewServer(config, dir, accessories, logger)
+	if err != nil {
+		return nil, err
+	}
+	b.server = server
+	return b, nil
+}
+
+// addVehicle creates a vehicle's thermostat
+func (b *HomeKitBridge) addVehicle(client *tesla.Client, name string) *homekitVehicle {
+	v := &homekitVehicle{
+		client:     client,
+		thermostat: homekit.NewThermostat(name+" Climate", profile.MinTemp, profile.MaxTemp),
+	}
+	v.thermostat.TargetState.OnWrite = v.setClimate
+	v.thermostat.TargetTemperature.OnWrite = v.setTemperature
+	if snapshot, ok := client.LastState(); ok {
+		v.update(snapshot.State)
+	}
+	b.vehicles = append(b.vehicles, v)
+	return v
+}
+
+// lastChars returns up to the last n characters of s
+func lastChars(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// Run serves HomeKit controllers and keeps the accessories in step with the
+// vehicles until ctx is cancelled
+func (b *HomeKitBridge) Run(ctx context.Context) error {
+	for _, v := range b.vehicles {
+		events, unsubscribe := v.client.Events().Subscribe(homekitEventBuffer)
+		defer unsubscribe()
+		go func(v *homekitVehicle) {
+			for event := range events {
+				if state, ok := event.Data.(tesla.HVACState); ok && event.Type == tesla.EventStateChanged {
+					v.update(&state)
+				}
+			}
+		}(v)
+	}
+	return b.server.Run(ctx)
+}
+
+// update shows a vehicle state on the thermostat. The car only reports
+// whether climate is on, so heating or cooling is inferred from the cabin
+// temperature.
+func (v *homekitVehicle) update(state *tesla.HVACState) {
+	current := homekit.HeatingOff
+	target := homekit.HeatingOff
+	if state.IsOn {
+		target = homekit.HeatingAuto
+		current = homekit.HeatingCool
+		if state.InsideTempCelsius < state.DriverTempCelsius {
+			current = homekit.HeatingHeat
+		}
+	}
+	setpoint := min(max(float64(state.DriverTempCelsius), profile.MinTemp), profile.MaxTemp)
+
+	v.thermostat.CurrentState.SetValue(float64(current))
+	v.thermostat.TargetState.SetValue(float64(target))
+	v.thermostat.CurrentTemperature.SetValue(float64(state.InsideTempCelsius))
+	v.thermostat.TargetTemperature.SetValue(setpoint)
+}
+
+// setClimate turns climate on or off. Like the HTTP API, it cancels an
+// auto-off timer.
+func (v *homekitVehicle) setClimate(ctx context.Context, value interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, homekitCommandTimeout)
+	defer cancel()
+
+	var err error
+	switch value.(float64) {
+	case homekit.HeatingAuto:
+		err = v.client.SetClimateOnIf(ctx, tesla.ClimateConditions{})
+	case homekit.HeatingOff:
+		err = v.client.SetClimateOff(ctx)
+	default:
+		return homekit.ErrInvalidValue
+	}
+	if err != nil {
+		return err
+	}
+	v.client.CancelClimateTimer()
+	return nil
+}
+
+// setTemperature sets both temperatures
+func (v *homekitVehicle) setTemperature(ctx context.Context, value interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, homekitCommandTimeout)
+	defer cancel()
+	celsius := float32(value.(float64))
+	return v.client.SetTemperature(ctx, celsius, celsius)
+}
+
+// seatHeater returns the write handler for a seat heater switch, which sets
+// the heater to high or off
+func (v *homekitVehicle) seatHeater(seat vehicle.SeatPosition) func(context.Context, interface{}) error {
+	return func(ctx context.Context, value interface{}) error {
+		ctx, cancel := context.WithTimeout(ctx, homekitCommandTimeout)
+		defer cancel()
+		level := vehicle.LevelOff
+		if value.(bool) {
+			level = vehicle.LevelHigh
+		}
+		if err := v.client.SetSeatHeater(ctx, seat, level); err != nil {
+			return fmt.Errorf("%s seat heater: %w", tesla.SeatName(seat), err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/homekit"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestHomeKitThermostatState(t *testing.T) {
+	api := newTestAPIHandler()
+	bridge, err := NewHomeKitBridge(api, homekit.Config{SetupCode: "031-45-154"}, t.TempDir(), log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bridge.vehicles) != 1 {
+		t.Fatalf("Expected one vehicle, got %d", len(bridge.vehicles))
+	}
+	v := bridge.vehicles[0]
+
+	tests := []struct {
+		name    string
+		state   tesla.HVACState
+		current float64
+		target  float64
+		setting float64
+	}{
+		{"off", tesla.HVACState{InsideTempCelsius: 30, DriverTempCelsius: 21}, homekit.HeatingOff, homekit.HeatingOff, 21},
+		{"heating", tesla.HVACState{IsOn: true, InsideTempCelsius: 5, DriverTempCelsius: 22}, homekit.HeatingHeat, homekit.HeatingAuto, 22},
+		{"cooling", tesla.HVACState{IsOn: true, InsideTempCelsius: 35, DriverTempCelsius: 20}, homekit.HeatingCool, homekit.HeatingAuto, 20},
+		{"setpoint out of range", tesla.HVACState{IsOn: true, InsideTempCelsius: 20, DriverTempCelsius: 10}, homekit.HeatingCool, homekit.HeatingAuto, 15},
+	}
+	for _, tt := range tests {
+		v.update(&tt.state)
+		if got := v.thermostat.CurrentState.Value(); got != tt.current {
+			t.Errorf("%s: expected current state %v, got %v", tt.name, tt.current, got)
+		}
+		if got := v.thermostat.TargetState.Value(); got != tt.target {
+			t.Errorf("%s: expected target state %v, got %v", tt.name, tt.target, got)
+		}
+		if got := v.thermostat.TargetTemperature.Value(); got != tt.setting {
+			t.Errorf("%s: expected target temperature %v, got %v", tt.name, tt.setting, got)
+		}
+		if got := v.thermostat.CurrentTemperature.Value(); got != float64(tt.state.InsideTempCelsius) {
+			t.Errorf("%s: expected current temperature %v, got %v", tt.name, tt.state.InsideTempCelsius, got)
+		}
+	}
+}
+
+func TestHomeKitCommands(t *testing.T) {
+	api := newTestAPIHandler()
+	bridge, err := NewHomeKitBridge(api, homekit.Config{SetupCode: "031-45-154"}, t.TempDir(), log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := bridge.vehicles[0]
+	ctx := context.Background()
+
+	if err := v.setClimate(ctx, float64(homekit.HeatingHeat)); err != homekit.ErrInvalidValue {
+		t.Errorf("Expected heat-only mode to be refused, got %v", err)
+	}
+	// The test vehicle isn't connected, so commands reach the client and fail
+	if err := v.setClimate(ctx, float64(homekit.HeatingAuto)); err == nil {
+		t.Error("Expected climate on to fail while not connected")
+	}
+	if err := v.setTemperature(ctx, 21.5); err == nil {
+		t.Error("Expected setting the temperature to fail while not connected")
+	}
+}
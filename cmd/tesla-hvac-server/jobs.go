@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/internal/tracing"
+)
+
+const (
+	// maxQueuedJobs bounds the async commands waiting for each vehicle
+	maxQueuedJobs = 20
+
+	// maxRetainedJobs bounds how many finished jobs are kept for lookup
+	maxRetainedJobs = 200
+)
+
+// JobStatus is the progress of an asynchronous command
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+
+	// Commands held in the offline queue until the vehicle reconnects
+	JobDeferred   JobStatus = "deferred"
+	JobSuperseded JobStatus = "superseded" // A later command replaced it before it ran
+	JobExpired    JobStatus = "expired"    // The vehicle didn't reconnect in time
+)
+
+// errJobQueueFull is returned when a vehicle already has maxQueuedJobs waiting
+var errJobQueueFull = errors.New("too many queued jobs for this vehicle")
+
+// Job is an asynchronous command and its outcome
+type Job struct {
+	ID         string     `json:"id"`
+	VIN        string     `json:"vin"`
+	Path       string     `json:"path"`
+	Status     JobStatus  `json:"status"`
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // When a deferred job expires
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job has succeeded, failed or won't run
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case JobSucceeded, JobFailed, JobSuperseded, JobExpired:
+		return true
+	}
+	return false
+}
+
+// jobRun is a queued job and the command that carries it out
+type jobRun struct {
+	job     *Job
+	command func(ctx context.Context) error
+}
+
+// JobManager runs commands in the background and serves their progress at
+// GET /jobs/{id}. Each vehicle's jobs run one at a time in the order they
+// were submitted, so commands sent in sequence are applied in sequence.
+type JobManager struct {
+	mutex  sync.Mutex
+	jobs   map[string]*Job
+	order  []string // Job IDs, oldest first
+	queues map[string]chan jobRun
+	logger *log.Logger
+}
+
+// NewJobManager creates a new job manager
+func NewJobManager(logger *log.Logger) *JobManager {
+	return &JobManager{
+		jobs:   make(map[string]*Job),
+		queues: make(map[string]chan jobRun),
+		logger: logger,
+	}
+}
+
+// Submit queues a command for a vehicle and returns the new job. message
+// is reported once the command succeeds.
+func (m *JobManager) Submit(vin, path, message string, command func(ctx context.Context) error) (Job, error) {
+	job := &Job{
+		ID:        newJobID(),
+		VIN:       vin,
+		Path:      path,
+		Status:    JobQueued,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.enqueue(job, command); err != nil {
+		return Job{}, err
+	}
+	m.add(job)
+	return *job, nil
+}
+
+// Hold records a deferred job, which waits until Resume queues it or End
+// finishes it
+func (m *JobManager) Hold(job Job) {
+	job.Status = JobDeferred
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(&job)
+}
+
+// Resume queues a deferred job's command
+func (m *JobManager) Resume(id string, command func(ctx context.Context) error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.Status != JobDeferred {
+		return fmt.Errorf("job %s isn't deferred", id)
+	}
+	if err := m.enqueue(job, command); err != nil {
+		return err
+	}
+	job.Status = JobQueued
+	job.ExpiresAt = nil
+	return nil
+}
+
+// End finishes a job that won't run, with status and an error describing why
+func (m *JobManager) End(id string, status JobStatus, reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.Finished() {
+		return
+	}
+	now := time.Now()
+	job.Status = status
+	job.Message = ""
+	job.Error = reason
+	job.ExpiresAt = nil
+	job.FinishedAt = &now
+}
+
+// enqueue adds a job to its vehicle's queue. Must be called with the lock
+// held.
+func (m *JobManager) enqueue(job *Job, command func(ctx context.Context) error) error {
+	queue, ok := m.queues[job.VIN]
+	if !ok {
+		queue = make(chan jobRun, maxQueuedJobs)
+		m.queues[job.VIN] = queue
+		go m.work(queue)
+	}
+	select {
+	case queue <- jobRun{job: job, command: command}:
+		return nil
+	default:
+		return errJobQueueFull
+	}
+}
+
+// add records a new job. Must be called with the lock held.
+func (m *JobManager) add(job *Job) {
+	m.jobs[job.ID] = job
+	m.order = append(m.order, job.ID)
+	m.prune()
+}
+
+// Get returns a copy of a job
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// work runs a vehicle's jobs in order
+func (m *JobManager) work(queue <-chan jobRun) {
+	for run := range queue {
+		m.update(run.job, func(job *Job) {
+			now := time.Now()
+			job.Status = JobRunning
+			job.StartedAt = &now
+		})
+
+		err := run.command(context.Background())
+		if err != nil {
+			m.logger.Printf("Job %s (%s) failed: %v", run.job.ID, run.job.Path, err)
+		}
+
+		m.update(run.job, func(job *Job) {
+			now := time.Now()
+			job.FinishedAt = &now
+			if err != nil {
+				job.Status = JobFailed
+				job.Message = ""
+				_, _, job.Error = classifyCommandError(err)
+				return
+			}
+			job.Status = JobSucceeded
+		})
+	}
+}
+
+// update changes a job under the lock
+func (m *JobManager) update(job *Job, change func(job *Job)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	change(job)
+}
+
+// prune forgets the oldest finished jobs beyond maxRetainedJobs. Queued and
+// running jobs are always kept. Must be called with the lock held.
+func (m *JobManager) prune() {
+	excess := len(m.order) - maxRetainedJobs
+	if excess <= 0 {
+		return
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		if excess > 0 && m.jobs[id].Finished() {
+			delete(m.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+// ServeHTTP serves GET /jobs/{id}
+func (m *JobManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	job, ok := m.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Job not found")
+		return
+	}
+	writeData(w, http.StatusOK, job)
+}
+
+// newJobID returns a random job ID
+func newJobID() string {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// wantsAsync reports whether a command request asked to run in the
+// background, with ?async=true or Prefer: respond-async
+func wantsAsync(r *http.Request) bool {
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		return true
+	}
+	for _, preference := range strings.Split(r.Header.Get("Prefer"), ",") {
+		if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+			return true
+		}
+	}
+	return false
+}
+
+// runCommand runs a vehicle command for a request. Asynchronous requests get
+// 202 Accepted with the job, whose progress is at the Location header;
+// otherwise the command runs with ctx and the response reports its outcome.
+// action names the command in logs, e.g. "set fan speed".
+func (h *APIHandler) runCommand(ctx context.Context, w http.ResponseWriter, r *http.Request, action, message string, command func(ctx context.Context) error) {
+	h.runCommandResult(ctx, w, r, action, message, func(ctx context.Context) (interface{}, error) {
+		return nil, command(ctx)
+	})
+}
+
+// runCommandResult is runCommand for a command with a result, which a
+// synchronous response carries as data alongside the message. A job keeps
+// only the message.
+func (h *APIHandler) runCommandResult(ctx context.Context, w http.ResponseWriter, r *http.Request, action, message string, command func(ctx context.Context) (interface{}, error)) {
+	if wantsAsync(r) {
+		if h.deferCommand(w, r, h.clientFor(r), message) {
+			return
+		}
+
+		// The job continues the request's trace and logs with its ID after
+		// the response is sent
+		parent := tracing.SpanContextFromContext(r.Context())
+		requestID := logging.RequestID(r.Context())
+		traced := func(ctx context.Context) error {
+			ctx = logging.WithRequestID(ctx, requestID)
+			ctx, span := tracing.Start(tracing.ContextWithSpanContext(ctx, parent), "job "+action)
+			defer span.End()
+			_, err := command(ctx)
+			span.RecordError(err)
+			return err
+		}
+		job, err := h.jobs.Submit(h.clientFor(r).GetVIN(), r.URL.Path, message, traced)
+		if err != nil {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, ErrCodeTooManyRequests, err.Error())
+			return
+		}
+		w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+		writeData(w, http.StatusAccepted, job)
+		return
+	}
+
+	result, err := command(ctx)
+	if err != nil {
+		logging.ForContext(ctx, h.logger).Printf("Failed to %s: %v", action, err)
+		writeCommandError(w, err)
+		return
+	}
+	if result == nil {
+		writeMessage(w, http.StatusOK, message)
+		return
+	}
+	writeEnvelope(w, http.StatusOK, Envelope{
+		Status:  "ok",
+		Data:    result,
+		Meta:    newMeta(),
+		Message: message,
+	})
+}
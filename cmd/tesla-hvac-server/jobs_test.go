@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// waitForJob polls a job until it finishes
+func waitForJob(t *testing.T, jobs *JobManager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := jobs.Get(id); ok && job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s didn't finish", id)
+	return Job{}
+}
+
+func TestJobManagerRunsInOrder(t *testing.T) {
+	jobs := NewJobManager(log.New(io.Discard, "", 0))
+
+	var mu sync.Mutex
+	var ran []int
+	release := make(chan struct{})
+	var ids []string
+	for i := 0; i < 3; i++ {
+		i := i
+		job, err := jobs.Submit("TEST_VIN", "/hvac/fan", "done", func(ctx context.Context) error {
+			<-release
+			mu.Lock()
+			ran = append(ran, i)
+			mu.Unlock()
+			if i == 2 {
+				return tesla.ErrWakeTimeout
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if job.Status != JobQueued {
+			t.Errorf("Expected a queued job, got %s", job.Status)
+		}
+		ids = append(ids, job.ID)
+	}
+	close(release)
+
+	if job := waitForJob(t, jobs, ids[0]); job.Status != JobSucceeded || job.Message != "done" || job.StartedAt == nil {
+		t.Errorf("Unexpected first job: %+v", job)
+	}
+	if job := waitForJob(t, jobs, ids[2]); job.Status != JobFailed || job.Error != "The vehicle is asleep and did not wake in time" || job.Message != "" {
+		t.Errorf("Unexpected last job: %+v", job)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 3 || ran[0] != 0 || ran[1] != 1 || ran[2] != 2 {
+		t.Errorf("Expected jobs to run in order, got %v", ran)
+	}
+}
+
+func TestJobManagerQueueFull(t *testing.T) {
+	jobs := NewJobManager(log.New(io.Discard, "", 0))
+	release := make(chan struct{})
+	defer close(release)
+	block := func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+
+	// One job runs and maxQueuedJobs wait behind it
+	var err error
+	for i := 0; i <= maxQueuedJobs+1 && err == nil; i++ {
+		_, err = jobs.Submit("TEST_VIN", "/hvac/fan", "", block)
+	}
+	if !errors.Is(err, errJobQueueFull) {
+		t.Errorf("Expected errJobQueueFull, got %v", err)
+	}
+
+	// Other vehicles have their own queue
+	if _, err := jobs.Submit("OTHER_VIN", "/hvac/fan", "", block); err != nil {
+		t.Errorf("Expected another vehicle's job to be accepted, got %v", err)
+	}
+}
+
+func TestJobManagerPrunesFinishedJobs(t *testing.T) {
+	jobs := NewJobManager(log.New(io.Discard, "", 0))
+	for i := 0; i < maxRetainedJobs; i++ {
+		id := newJobID()
+		jobs.jobs[id] = &Job{ID: id, Status: JobSucceeded}
+		jobs.order = append(jobs.order, id)
+	}
+	oldest := jobs.order[0]
+
+	job, err := jobs.Submit("TEST_VIN", "/hvac/fan", "", func(ctx context.Context) error { return nil })
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if _, ok := jobs.Get(oldest); ok {
+		t.Error("Expected the oldest finished job to be pruned")
+	}
+	if _, ok := jobs.Get(job.ID); !ok {
+		t.Error("Expected the new job to be kept")
+	}
+}
+
+func TestWantsAsync(t *testing.T) {
+	tests := []struct {
+		url    string
+		prefer string
+		want   bool
+	}{
+		{"/hvac/fan", "", false},
+		{"/hvac/fan?async=true", "", true},
+		{"/hvac/fan?async=false", "", false},
+		{"/hvac/fan", "respond-async", true},
+		{"/hvac/fan", "return=minimal, Respond-Async", true},
+		{"/hvac/fan", "wait=10", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.url, nil)
+		if tt.prefer != "" {
+			req.Header.Set("Prefer", tt.prefer)
+		}
+		if got := wantsAsync(req); got != tt.want {
+			t.Errorf("wantsAsync(%s, %q) = %v, want %v", tt.url, tt.prefer, got, tt.want)
+		}
+	}
+}
+
+func TestAsyncCommand(t *testing.T) {
+	handler := newTestAPIHandler()
+
+	req := httptest.NewRequest("POST", "/hvac/fan?async=true", strings.NewReader(`{"speed": 3}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var env struct {
+		Data Job `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if location := rec.Header().Get("Location"); location != "/api/v1/jobs/"+env.Data.ID {
+		t.Errorf("Unexpected Location %q", location)
+	}
+	if env.Data.VIN != "TEST_VIN" || env.Data.Path != "/hvac/fan" {
+		t.Errorf("Unexpected job: %+v", env.Data)
+	}
+
+	// The vehicle isn't connected, so the job fails
+	waitForJob(t, handler.jobs, env.Data.ID)
+	req = httptest.NewRequest("GET", "/jobs/"+env.Data.ID, nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if env.Data.Status != JobFailed || env.Data.Error == "" || env.Data.FinishedAt == nil {
+		t.Errorf("Expected a failed job with an error, got %+v", env.Data)
+	}
+
+	// Invalid requests are still rejected up front
+	req = httptest.NewRequest("POST", "/hvac/fan?async=true", strings.NewReader(`{"speed": 12}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+}
+
+func TestJobNotFound(t *testing.T) {
+	handler := newTestAPIHandler()
+	for _, path := range []string{"/jobs/missing", "/jobs"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
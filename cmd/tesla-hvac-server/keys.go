@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// KeysHandler audits and revokes the keys on a vehicle's whitelist: GET
+// /keys lists them and DELETE /keys/{public_key} removes one
+type KeysHandler struct {
+	api    *APIHandler
+	logger *log.Logger
+}
+
+// NewKeysHandler creates a keys handler
+func NewKeysHandler(api *APIHandler, logger *log.Logger) *KeysHandler {
+	return &KeysHandler{api: api, logger: logger}
+}
+
+// ServeHTTP implements http.Handler for /keys
+func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, err := h.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/keys"), "/")
+	switch {
+	case key == "" && r.Method == "GET":
+		h.serveList(w, r, client)
+	case key != "" && r.Method == "DELETE":
+		h.serveRemove(w, r, client, key)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// serveList lists the vehicle's keys
+func (h *KeysHandler) serveList(w http.ResponseWriter, r *http.Request, client *tesla.Client) {
+	keys, err := client.ListKeys(r.Context())
+	if err != nil {
+		h.logger.Printf("Failed to list keys: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+	if keys == nil {
+		keys = []tesla.VehicleKey{}
+	}
+	writeData(w, http.StatusOK, keys)
+}
+
+// serveRemove removes a key from the vehicle
+func (h *KeysHandler) serveRemove(w http.ResponseWriter, r *http.Request, client *tesla.Client, key string) {
+	publicKey, err := tesla.ParseVehiclePublicKey(key)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err := client.RemoveKey(r.Context(), publicKey); err != nil {
+		if errors.Is(err, tesla.ErrRemoveOwnKey) {
+			writeError(w, http.StatusConflict, ErrCodeConditionsNotMet, err.Error())
+			return
+		}
+		h.logger.Printf("Failed to remove key: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+	h.logger.Printf("Removed key %s from %s", key, client.GetVIN())
+	writeMessage(w, http.StatusOK, "Key removed")
+}
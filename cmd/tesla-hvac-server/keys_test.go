@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestVehicleKeys(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = tesla.SimulatorVIN
+	config.Tesla.Transport = string(tesla.TransportSim)
+	client := tesla.NewClientFromConfig(config, logger)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	api := NewAPIHandler(client, logger)
+	api.Mount("/keys", NewKeysHandler(api, logger))
+
+	list := func() []tesla.VehicleKey {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("GET", "/keys", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Data []tesla.VehicleKey `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Data
+	}
+
+	keys := list()
+	if len(keys) != 1 || keys[0].Role != "owner" {
+		t.Fatalf("Expected the simulator's phone key, got %+v", keys)
+	}
+
+	for path, expected := range map[string]int{"/keys/not-hex": http.StatusBadRequest, "/keys/" + keys[0].PublicKey: http.StatusOK} {
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, httptest.NewRequest("DELETE", path, nil))
+		if rec.Code != expected {
+			t.Errorf("DELETE %s: expected %d, got %d: %s", path, expected, rec.Code, rec.Body.String())
+		}
+	}
+	if keys := list(); len(keys) != 0 {
+		t.Errorf("Expected no keys left, got %+v", keys)
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", "/keys", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
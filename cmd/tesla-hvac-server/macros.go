@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// macroStepTimeout bounds each step of a macro on top of its delay
+const macroStepTimeout = 30 * time.Second
+
+// MacroHandler serves the command macros defined in the config file. Macros
+// are read from the config manager on every request, so edits to the config
+// file take effect without a restart.
+type MacroHandler struct {
+	api           *APIHandler
+	configManager *tesla.ConfigManager
+	logger        *log.Logger
+}
+
+// NewMacroHandler creates a handler for the macros in the config file. With
+// no config manager there are no macros.
+func NewMacroHandler(api *APIHandler, configManager *tesla.ConfigManager, logger *log.Logger) *MacroHandler {
+	return &MacroHandler{
+		api:           api,
+		configManager: configManager,
+		logger:        logger,
+	}
+}
+
+// macros returns the configured macros
+func (h *MacroHandler) macros() []tesla.Macro {
+	if h.configManager == nil {
+		return nil
+	}
+	return h.configManager.GetConfig().Macros
+}
+
+// find returns the macro with the given name
+func (h *MacroHandler) find(name string) (tesla.Macro, bool) {
+	if h.configManager == nil {
+		return tesla.Macro{}, false
+	}
+	return h.configManager.GetConfig().FindMacro(name)
+}
+
+// ServeHTTP implements http.Handler for GET /macros and POST /macros/<name>.
+// POST /macros/defrost runs the built-in defrost macro unless the config
+// file defines one with that name.
+func (h *MacroHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/macros"), "/")
+	if name == "" {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		macros := h.macros()
+		if macros == nil {
+			macros = []tesla.Macro{}
+		}
+		writeData(w, http.StatusOK, macros)
+		return
+	}
+
+	macro, ok := h.find(name)
+	builtin := !ok && name == tesla.DefrostMacro.Name
+	if builtin {
+		macro = tesla.DefrostMacro
+	} else if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Macro not found")
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	client, err := h.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+
+	if builtin {
+		h.serveDefrost(w, r, client)
+		return
+	}
+
+	// Macros with delays outlast the server's write timeout, so extend it
+	// to cover the whole run. Not every ResponseWriter supports this.
+	timeout := macroTimeout(macro)
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+	defer cancel()
+
+	if err := client.RunMacro(ctx, macro); err != nil {
+		h.logger.Printf("Macro %s failed: %v", macro.Name, err)
+		writeCommandError(w, err)
+		return
+	}
+
+	writeMessage(w, http.StatusOK, fmt.Sprintf("Macro %s completed successfully", macro.Name))
+}
+
+// serveDefrost runs the built-in defrost macro. Unlike config macros, every
+// step runs even if an earlier one fails, and the response reports each
+// step: as data on success, or as the error details if any step failed.
+func (h *MacroHandler) serveDefrost(w http.ResponseWriter, r *http.Request, client *tesla.Client) {
+	timeout := macroTimeout(tesla.DefrostMacro)
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+	defer cancel()
+
+	results, err := client.RunMacroSteps(ctx, tesla.DefrostMacro)
+	if err != nil {
+		h.logger.Printf("Defrost failed: %v", err)
+		writeCommandErrorDetails(w, err, results)
+		return
+	}
+	writeData(w, http.StatusOK, results)
+}
+
+// macroTimeout returns how long a macro may take to run
+func macroTimeout(macro tesla.Macro) time.Duration {
+	return macro.Duration() + time.Duration(len(macro.Steps))*macroStepTimeout
+}
+
+// runMacroCommand runs a macro named on the command line and exits. The
+// verb "macros" lists the configured macros instead.
+func runMacroCommand(configManager *tesla.ConfigManager, client *tesla.Client, verb string, logger *log.Logger) error {
+	if configManager == nil {
+		return fmt.Errorf("macros require -config")
+	}
+	config := configManager.GetConfig()
+
+	macro, ok := config.FindMacro(verb)
+	if !ok {
+		if verb == "macros" {
+			for _, macro := range config.Macros {
+				fmt.Printf("%-20s %s\n", macro.Name, macro.Description)
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown macro %q", verb)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), client.Tuning().ConnectionTimeout+macroTimeout(macro))
+	defer cancel()
+
+	if err := client.Connect(ctx, client.GetPrivateKeyFile()); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer client.Disconnect()
+
+	if err := client.RunMacro(ctx, macro); err != nil {
+		return err
+	}
+	logger.Printf("Macro %s completed", macro.Name)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newTestMacroHandler serves macros from a temporary config file
+func newTestMacroHandler(t *testing.T, macros []tesla.Macro) *APIHandler {
+	t.Helper()
+
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Macros = macros
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	configManager, err := tesla.NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configManager.Close() })
+
+	api := newTestAPIHandler()
+	api.Mount("/macros", NewMacroHandler(api, configManager, log.New(io.Discard, "", 0)))
+	return api
+}
+
+func TestMacroList(t *testing.T) {
+	api := newTestMacroHandler(t, []tesla.Macro{
+		{Name: "arrive-home", Description: "Warm up", Steps: []tesla.MacroStep{{Command: "set_climate_on"}}},
+	})
+
+	req := httptest.NewRequest("GET", "/macros", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"name":"arrive-home"`) {
+		t.Errorf("Expected macro in list, got %s", w.Body.String())
+	}
+}
+
+func TestMacroRun(t *testing.T) {
+	api := newTestMacroHandler(t, []tesla.Macro{
+		{Name: "arrive-home", Steps: []tesla.MacroStep{{Command: "set_climate_on"}}},
+	})
+
+	var ran []string
+	api.vehicles()[0].AddCommandHook(func(ctx context.Context, cmd tesla.Command) error {
+		ran = append(ran, cmd.Name)
+		return tesla.ErrCommandVetoed
+	})
+
+	req := httptest.NewRequest("POST", "/macros/arrive-home", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected vetoed step to return 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(ran) != 1 || ran[0] != "set_climate_on" {
+		t.Errorf("Expected the macro's command to run, got %v", ran)
+	}
+
+	req = httptest.NewRequest("POST", "/macros/leave-home", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown macro to return 404, got %d", w.Code)
+	}
+}
+
+func TestMacroDefrost(t *testing.T) {
+	api := newTestAPIHandler()
+	api.Mount("/macros", NewMacroHandler(api, nil, log.New(io.Discard, "", 0)))
+
+	var ran []string
+	api.vehicles()[0].AddCommandHook(func(ctx context.Context, cmd tesla.Command) error {
+		ran = append(ran, cmd.Name)
+		return nil
+	})
+
+	req := httptest.NewRequest("POST", "/macros/defrost", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	// Every step runs and fails without a vehicle, and each is reported
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	var env struct {
+		Errors []struct {
+			Details []tesla.StepResult `json:"details"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil || len(env.Errors) != 1 {
+		t.Fatalf("Expected an error envelope, got %s", w.Body.String())
+	}
+	if details := env.Errors[0].Details; len(details) != 4 || details[1].Command != "set_seat_heater" || details[1].OK {
+		t.Errorf("Expected a failed result per step, got %+v", details)
+	}
+	if len(ran) != 4 {
+		t.Errorf("Expected all four steps to run, got %v", ran)
+	}
+
+	req = httptest.NewRequest("GET", "/macros/defrost", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestMacrosWithoutConfig(t *testing.T) {
+	api := newTestAPIHandler()
+	api.Mount("/macros", NewMacroHandler(api, nil, log.New(io.Discard, "", 0)))
+
+	req := httptest.NewRequest("GET", "/macros", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":[]`) {
+		t.Errorf("Expected empty macro list, got %d: %s", w.Code, w.Body.String())
+	}
+}
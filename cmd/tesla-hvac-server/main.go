@@ -12,7 +12,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/teslamotors/vehicle-command/internal/audit"
+	"github.com/teslamotors/vehicle-command/internal/history"
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/profile"
 	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/tracing"
+	"github.com/teslamotors/vehicle-command/internal/weather"
 )
 
 const (
@@ -27,29 +34,164 @@ func main() {
 		host        = flag.String("host", defaultHost, "Host to bind to")
 		configPath  = flag.String("config", "", "Path to configuration file")
 		webDir      = flag.String("web", "./web", "Path to web directory")
-		devMode     = flag.Bool("dev", false, "Enable development mode with CORS")
+		devMode     = flag.Bool("dev", false, "Enable development mode with CORS and, without -config, a simulated vehicle")
+		enableGraphQL = flag.Bool("graphql", false, "Enable the GraphQL endpoint at /api/graphql")
+		pluginDir   = flag.String("plugin-dir", "", "Directory of plugin executables to run (disabled if empty)")
+		scriptDir   = flag.String("script-dir", "", "Directory of *.lua hook scripts to load (disabled if empty)")
+		adminToken  = flag.String("admin-token", os.Getenv("TESLA_ADMIN_TOKEN"), "Bearer token for the admin API (disabled if empty)")
+		showVersion = flag.Bool("version", false, "Print the version and exit")
+		selfUpdate  = flag.Bool("self-update", false, "Install the latest release from update.manifest_url and exit")
+		tlsCert     = flag.String("tls-cert", "", "TLS certificate file; with -tls-key, serves HTTPS")
+		tlsKey      = flag.String("tls-key", "", "TLS private key file")
+		recordFile  = flag.String("record", "", "File to record vehicle protocol messages to, for replay in tests (disabled if empty)")
 	)
 	flag.Parse()
 
-	// Setup logger
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+
+	// Setup logger. Once the config is loaded it is replaced by the log the
+	// config describes.
 	logger := log.New(os.Stdout, "[TESLA-HVAC] ", log.LstdFlags|log.Lshortfile)
 
-	// Load configuration
-	var config *tesla.Config
+	// An updated binary's first start decides whether the update is kept
+	if !*selfUpdate && flag.NArg() == 0 {
+		recoverUpdate(logger)
+	}
+
+	// Load configuration. With a config file, the config manager persists
+	// runtime changes and hot-reloads edits to the file.
+	var configManager *tesla.ConfigManager
+	var registry *tesla.Registry
 	var err error
 	
 	if *configPath != "" {
-		config, err = tesla.LoadConfig(*configPath)
+		configManager, err = tesla.NewConfigManager(*configPath, logger)
 		if err != nil {
 			logger.Fatalf("Failed to load config from %s: %v", *configPath, err)
 		}
+		defer configManager.Close()
+	}
+
+	// Without a config file, the defaults and TESLA_* variables configure
+	// the server; see tesla-config env
+	defaults := tesla.DefaultConfig()
+	if err := defaults.LoadFromEnv(); err != nil {
+		logger.Fatalf("Invalid environment: %v", err)
+	}
+	currentConfig := func() *tesla.Config {
+		if configManager != nil {
+			return configManager.GetConfig()
+		}
+		return defaults
+	}
+
+	// Level filtering, JSON records and file output from the config
+	// file, or from the defaults and TESLA_LOG_* variables without one
+	logs, err := logging.New(currentConfig().Logging)
+	if err != nil {
+		logger.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logs.Close()
+	logs.CaptureLibrary()
+	logger = logs.Std()
+	if configManager != nil {
+		configManager.SetLogger(logger)
+		configManager.RegisterCallback(func(oldConfig, newConfig *tesla.Config) error {
+			if oldConfig.Logging.Level != newConfig.Logging.Level {
+				return logs.SetLevel(newConfig.Logging.Level)
+			}
+			return nil
+		})
+	}
+
+	if configManager != nil {
+		// One client per configured vehicle
+		registry, err = tesla.NewRegistryWithConfigManager(configManager, logger)
 	} else {
-		config = tesla.DefaultConfig()
-		config.Tesla.VIN = "YOUR_TESLA_VIN" // Placeholder
+		config := defaults
+		if *devMode {
+			config.Tesla.VIN = tesla.SimulatorVIN
+			config.Tesla.Transport = string(tesla.TransportSim)
+			logger.Printf("Development mode: using a simulated vehicle")
+		} else if config.Tesla.VIN == "" {
+			config.Tesla.VIN = "YOUR_TESLA_VIN" // Placeholder until TESLA_VIN is set
+		}
+		if err := config.Validate(); err != nil {
+			logger.Fatalf("Invalid configuration from the environment: %v", err)
+		}
+		registry, err = tesla.NewRegistryFromConfig(config, logger)
+	}
+	if err != nil {
+		logger.Fatalf("Failed to set up vehicles: %v", err)
+	}
+	client := registry.Default()
+
+	// Protocol messages to and from every vehicle, for regression tests
+	if *recordFile != "" {
+		recorder, err := tesla.OpenRecorder(*recordFile)
+		if err != nil {
+			logger.Fatalf("Failed to start recording: %v", err)
+		}
+		defer recorder.Close()
+		for _, c := range registry.Clients() {
+			c.SetRecorder(recorder)
+		}
+		logger.Printf("Recording vehicle messages to %s", *recordFile)
+	}
+
+	// Vehicles on the Fleet API, directly or after failing over,
+	// authenticate with the OAuth token from the keyring or TESLA_ACCESS_TOKEN,
+	// refreshed through Tesla SSO before it expires
+	var oauth *tesla.OAuthManager
+	for _, c := range registry.Clients() {
+		if !c.UsesTransport(tesla.TransportFleet) {
+			continue
+		}
+		if oauth == nil {
+			if oauth, err = tesla.OpenOAuthManager(currentConfig().Keyring, logger); err != nil {
+				logger.Fatalf("Failed to open the OAuth token store: %v", err)
+			}
+			oauth.SetConfig(currentConfig().OAuth)
+			if _, err := oauth.MigrateTokens(); err != nil {
+				logger.Printf("warn: failed to migrate OAuth tokens: %v", err)
+			}
+		}
+		c.SetOAuthManager(oauth)
+	}
+
+	if *selfUpdate {
+		if err := runSelfUpdate(configManager, logger); err != nil {
+			logger.Fatalf("Self-update failed: %v", err)
+		}
+		return
 	}
 
-	// Create Tesla client
-	client := tesla.NewClientFromConfig(config, logger)
+	// A positional argument runs the named macro from the config file and
+	// exits instead of starting the server
+	if flag.NArg() > 0 {
+		if err := runMacroCommand(configManager, client, flag.Arg(0), logger); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+
+	// Supervisor for background subsystems
+	supervisor := tesla.NewSupervisor(logger)
+	supervisor.Start(context.Background())
+
+	// Command traces to an OpenTelemetry collector when configured
+	tracingConfig := currentConfig().Tracing
+	if tracingConfig.Enabled() {
+		tracer, err := tracing.New(tracingConfig, logger)
+		if err != nil {
+			logger.Fatalf("Failed to configure tracing: %v", err)
+		}
+		tracing.SetTracer(tracer)
+		supervisor.Add("tracing", tracer.Run)
+	}
 
 	// Setup HTTP server
 	mux := http.NewServeMux()
@@ -68,388 +210,380 @@ func main() {
 	fileServer := http.FileServer(http.Dir(webPath))
 	mux.Handle("/", fileServer)
 
-	// API endpoints
-	apiHandler := NewAPIHandler(client, logger)
-	mux.Handle("/api/", http.StripPrefix("/api", apiHandler))
-
-	// Health check endpoint
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ok","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
-	})
-
-	// CORS middleware for development
-	var handler http.Handler = mux
-	if *devMode {
-		handler = corsMiddleware(mux)
-		logger.Println("Development mode enabled with CORS")
-	}
-
-	// Create server
-	server := &http.Server{
-		Addr:         fmt.Sprintf("%s:%s", *host, *port),
-		Handler:      handler,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// API endpoints, served under /api/v1/ with unversioned /api/ paths kept
+	// as deprecated aliases
+	apiHandler := NewRegistryAPIHandler(registry, logger)
+	adminHandler := NewAdminHandler(client, configManager, *adminToken, logger)
+	apiHandler.Mount("/admin", adminHandler)
+	apiHandler.Mount("/config", adminHandler)
+
+	// API keys from the config file or TESLA_API_KEYS; once one is
+	// configured every request needs a key or a login. Keys are re-read when
+	// the config reloads.
+	if configManager != nil {
+		apiHandler.keys = NewAPIKeyAuth(configManager, logger)
+	} else {
+		apiHandler.keys = NewEnvAPIKeyAuth(defaults, logger)
 	}
 
-	// Start server in goroutine
-	go func() {
-		logger.Printf("Starting Tesla HVAC server on %s:%s", *host, *port)
-		logger.Printf("Web interface available at: http://%s:%s", *host, *port)
-		logger.Printf("Serving files from: %s", webPath)
-		
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Server failed to start: %v", err)
+	// User accounts live in the data directory. Once the first user is
+	// created through /api/v1/admin/users, every request needs a login.
+	if configManager != nil {
+		usersPath := filepath.Join(configManager.GetConfig().DataPath(), "users.json")
+		users, err := profile.Open(usersPath)
+		if err != nil {
+			logger.Fatalf("Failed to load users: %v", err)
 		}
-	}()
-
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	logger.Println("Shutting down server...")
+		profiles := NewProfileHandler(apiHandler, users, logger)
+		apiHandler.profiles = profiles
+		adminHandler.users = profiles
+		for _, prefix := range []string{"/login", "/logout", "/profile"} {
+			apiHandler.Mount(prefix, profiles)
+		}
+	}
+	apiHandler.warnUnauthenticated(logger)
+	apiRouter := NewAPIRouter(logger)
+	apiRouter.Register(1, apiHandler)
+	mux.Handle("/api/", http.StripPrefix("/api", apiRouter))
 
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// The OpenAPI document describing the API, for generating clients
+	openAPI, err := NewOpenAPIHandler()
+	if err != nil {
+		logger.Fatalf("Failed to generate the OpenAPI document: %v", err)
+	}
+	mux.Handle("/api/openapi.json", openAPI)
 
-	if err := server.Shutdown(ctx); err != nil {
-		logger.Printf("Server forced to shutdown: %v", err)
+	// Non-urgent background work waits for the vehicle to be awake
+	wakeManager := NewWakeManager(apiHandler, logger)
+	if err := wakeManager.Start(supervisor); err != nil {
+		logger.Fatalf("Failed to start wake scheduler: %v", err)
 	}
+	apiHandler.Mount("/wake", wakeManager)
 
-	// Disconnect from Tesla vehicle
-	client.Disconnect()
+	// Enroll the server's key on a vehicle over BLE, and audit and revoke
+	// the vehicle's keys
+	apiHandler.Mount("/enroll", NewEnrollmentHandler(apiHandler, logger))
+	apiHandler.Mount("/keys", NewKeysHandler(apiHandler, logger))
 
-	logger.Println("Server exited")
-}
+	// Refresh the Fleet API's OAuth tokens ahead of expiry and report their
+	// health at /api/v1/auth/status
+	if oauth != nil {
+		supervisor.Add("oauth-refresh", oauth.RunTokenRefresher)
+	}
+	apiHandler.Mount("/auth", NewAuthStatusHandler(oauth, logger))
 
-// CORS middleware for development
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	// List the Tesla vehicles in BLE range at /api/v1/discovery, for setup
+	apiHandler.Mount("/discovery", NewDiscoveryHandler(apiHandler, tesla.NewBLEManagerFromConfig(currentConfig(), logger), logger))
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	// Ping connected vehicles, keep idle BLE sessions alive and reconnect
+	// dropped sessions in the background when enabled
+	clientConfig := currentConfig().Client
+	if clientConfig.EnableHealthChecks {
+		for _, c := range registry.Clients() {
+			supervisor.Add("health:"+c.GetVIN(), c.RunHealthChecks)
 		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-// APIHandler handles API requests
-type APIHandler struct {
-	client *tesla.Client
-	logger *log.Logger
-}
-
-// NewAPIHandler creates a new API handler
-func NewAPIHandler(client *tesla.Client, logger *log.Logger) *APIHandler {
-	return &APIHandler{
-		client: client,
-		logger: logger,
 	}
-}
-
-// ServeHTTP implements http.Handler
-func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Set content type
-	w.Header().Set("Content-Type", "application/json")
-
-	// Route requests
-	switch r.URL.Path {
-	case "/status":
-		h.handleStatus(w, r)
-	case "/connect":
-		h.handleConnect(w, r)
-	case "/hvac/state":
-		h.handleHVACState(w, r)
-	case "/hvac/temperature":
-		h.handleTemperature(w, r)
-	case "/hvac/fan":
-		h.handleFanSpeed(w, r)
-	case "/hvac/airflow":
-		h.handleAirflow(w, r)
-	case "/hvac/auto":
-		h.handleAutoMode(w, r)
-	case "/hvac/climate":
-		h.handleClimate(w, r)
-	default:
-		http.NotFound(w, r)
-	}
-}
-
-// handleStatus returns the current connection status
-func (h *APIHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if clientConfig.KeepAliveInterval > 0 {
+		for _, c := range registry.Clients() {
+			supervisor.Add("keepalive:"+c.GetVIN(), c.RunKeepAlive)
+		}
 	}
-
-	status := map[string]interface{}{
-		"connected": h.client.IsConnected(),
-		"vin":       h.client.GetVIN(),
-		"timestamp": time.Now().Format(time.RFC3339),
+	// Climate turned on with a duration is turned off again in the background
+	for _, c := range registry.Clients() {
+		supervisor.Add("climate-timer:"+c.GetVIN(), c.RunClimateTimer)
 	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","data":%s}`, toJSON(status))
-}
-
-// handleConnect attempts to connect to the Tesla vehicle
-func (h *APIHandler) handleConnect(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if clientConfig.EnableAutoReconnect {
+		for _, c := range registry.Clients() {
+			reconnector := tesla.NewReconnector(c, clientConfig, logger)
+			supervisor.Add("reconnect:"+c.GetVIN(), reconnector.Run)
+		}
 	}
 
-	ctx := context.Background()
-	err := h.client.Connect(ctx, "")
-	
+	// Record sent commands and, when polling is enabled, each vehicle's
+	// state for /api/v1/history, in a database in the data directory
+	historyConfig := currentConfig().History
+	historyStore, err := history.OpenBolt(filepath.Join(currentConfig().DataPath(), "history.db"), historyConfig)
 	if err != nil {
-		h.logger.Printf("Connection failed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+		logger.Fatalf("Failed to open history: %v", err)
 	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"Connected successfully"}`)
-}
-
-// handleHVACState returns the current HVAC state
-func (h *APIHandler) handleHVACState(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	defer historyStore.Close()
+	historyHandler := NewHistoryHandler(apiHandler, historyStore, logger)
+	if err := historyHandler.Start(supervisor, historyConfig); err != nil {
+		logger.Fatalf("Failed to start history: %v", err)
 	}
+	apiHandler.Mount("/history", historyHandler)
 
-	ctx := context.Background()
-	state, err := h.client.GetHVACState(ctx)
-	
+	// Record requests that change something for /api/v1/audit, in the
+	// data directory when there is a config file
+	auditPath := ""
+	if configManager != nil {
+		auditPath = filepath.Join(configManager.GetConfig().DataPath(), "audit.jsonl")
+	}
+	auditLog, err := audit.Open(auditPath, currentConfig().Audit)
 	if err != nil {
-		h.logger.Printf("Failed to get HVAC state: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+		logger.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	apiHandler.audit = NewAuditLog(apiHandler, auditLog, logger)
+	apiHandler.Mount("/audit", apiHandler.audit)
+
+	// Async commands for vehicles that aren't connected, held until they
+	// reconnect, in the data directory when there is a config file
+	if currentConfig().OfflineQueue.Enabled {
+		offlinePath := ""
+		if configManager != nil {
+			offlinePath = filepath.Join(configManager.GetConfig().DataPath(), "offline_queue.json")
+		}
+		offline, err := NewOfflineQueue(apiHandler, currentConfig().OfflineQueue, offlinePath, logger)
+		if err != nil {
+			logger.Fatalf("Failed to open the offline queue: %v", err)
+		}
+		apiHandler.offline = offline
+		if err := supervisor.Add("offline_queue", offline.Run); err != nil {
+			logger.Fatalf("Failed to start the offline queue: %v", err)
+		}
 	}
 
-	// Convert temperatures from Celsius to Fahrenheit for frontend
-	state.DriverTempCelsius = float32(celsiusToFahrenheit(float64(state.DriverTempCelsius)))
-	state.PassengerTempCelsius = float32(celsiusToFahrenheit(float64(state.PassengerTempCelsius)))
-	state.InsideTempCelsius = float32(celsiusToFahrenheit(float64(state.InsideTempCelsius)))
-	state.OutsideTempCelsius = float32(celsiusToFahrenheit(float64(state.OutsideTempCelsius)))
+	// Live state and events for web clients over WebSocket at /api/ws
+	streamHub := NewStreamHub(apiHandler, logger)
+	apiHandler.Mount("/ws", streamHub)
+	supervisor.Add("stream", streamHub.Run)
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","data":%s}`, toJSON(state))
-}
+	// The same events as Server-Sent Events at /api/events
+	apiHandler.Mount("/events", NewEventFeed(apiHandler, logger))
 
-// handleTemperature sets the temperature
-func (h *APIHandler) handleTemperature(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	// State to and commands from an MQTT broker for home automation
+	if currentConfig().MQTT.Enabled() {
+		bridge := NewMQTTBridge(apiHandler, currentConfig().MQTT, logger)
+		if err := supervisor.Add("mqtt", bridge.Run); err != nil {
+			logger.Fatalf("Failed to start MQTT: %v", err)
+		}
 	}
 
-	// Parse request body
-	var req struct {
-		DriverTemp    float64 `json:"driver_temp"`    // Temperature in Fahrenheit
-		PassengerTemp float64 `json:"passenger_temp"` // Temperature in Fahrenheit
+	// Climate changes and alerts posted to the configured URLs
+	if currentConfig().Webhooks.Enabled() {
+		notifier := NewWebhookNotifier(apiHandler, currentConfig().Webhooks, logger)
+		if err := supervisor.Add("webhooks", notifier.Run); err != nil {
+			logger.Fatalf("Failed to start webhooks: %v", err)
+		}
 	}
 
-	if err := parseJSON(r, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	// Alerts and schedule outcomes by email, Pushover or Telegram
+	var notifier notify.Notifier
+	if currentConfig().Notifications.Enabled() {
+		config := currentConfig().Notifications
+		notifier = notify.New(config)
+		monitor := NewAlertMonitor(apiHandler, config.Alerts, notifier, logger)
+		if err := supervisor.Add("alerts", monitor.Run); err != nil {
+			logger.Fatalf("Failed to start alerts: %v", err)
+		}
 	}
 
-	// Convert Fahrenheit to Celsius for Tesla API
-	driverTempC := fahrenheitToCelsius(req.DriverTemp)
-	passengerTempC := fahrenheitToCelsius(req.PassengerTemp)
+	// Polling and alerts while Dog Mode or another keeper mode is on, with
+	// their status at /api/v1/monitor/dogmode
+	dogMode := NewDogModeMonitor(apiHandler, configManager, notifier, logger)
+	if err := supervisor.Add("dogmode", dogMode.Run); err != nil {
+		logger.Fatalf("Failed to start the Dog Mode monitor: %v", err)
+	}
+	apiHandler.Mount("/monitor", dogMode)
 
-	ctx := context.Background()
-	err := h.client.SetTemperature(ctx, float32(driverTempC), float32(passengerTempC))
-	
-	if err != nil {
-		h.logger.Printf("Failed to set temperature: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+	// The vehicles as HomeKit accessories, paired with the setup code
+	if currentConfig().HomeKit.Enabled() {
+		dir := filepath.Join(currentConfig().DataPath(), "homekit")
+		bridge, err := NewHomeKitBridge(apiHandler, currentConfig().HomeKit, dir, logger)
+		if err != nil {
+			logger.Fatalf("Failed to configure HomeKit: %v", err)
+		}
+		if err := supervisor.Add("homekit", bridge.Run); err != nil {
+			logger.Fatalf("Failed to start HomeKit: %v", err)
+		}
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"Temperature set successfully"}`)
-}
+	// Macros from the config file run as POST /api/v1/macros/<name>
+	apiHandler.Mount("/macros", NewMacroHandler(apiHandler, configManager, logger))
 
-// handleFanSpeed sets the fan speed
-func (h *APIHandler) handleFanSpeed(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	// Climate presets, stored in the config file, at /api/v1/presets
+	apiHandler.Mount("/presets", NewPresetHandler(apiHandler, configManager, logger))
 
-	// Parse request body
-	var req struct {
-		Speed int `json:"speed"`
+	// Timed climate actions, stored in the config file, at /api/v1/schedules
+	schedules := NewScheduleHandler(apiHandler, configManager, logger)
+	schedules.notifier = notifier
+	if err := schedules.Start(supervisor); err != nil {
+		logger.Fatalf("Failed to start schedules: %v", err)
 	}
+	apiHandler.Mount("/schedules", schedules)
 
-	if err := parseJSON(r, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	// Weather rules run schedules only when the forecast calls for it
+	if configManager != nil && configManager.GetConfig().Weather.Enabled() {
+		provider, err := weather.NewProvider(configManager.GetConfig().Weather)
+		if err != nil {
+			logger.Fatalf("Failed to configure weather: %v", err)
+		}
+		automation := NewWeatherAutomation(configManager, provider, schedules, logger)
+		if err := automation.Start(supervisor); err != nil {
+			logger.Fatalf("Failed to start weather rules: %v", err)
+		}
+		apiHandler.Mount("/weather", automation)
 	}
 
-	ctx := context.Background()
-	err := h.client.SetFanSpeed(ctx, tesla.FanSpeed(req.Speed))
-	
-	if err != nil {
-		h.logger.Printf("Failed to set fan speed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+	// Plugins run as supervised subprocesses and serve /api/v1/plugins/<name>/
+	if *pluginDir != "" {
+		plugins := NewPluginManager(apiHandler, supervisor, logger)
+		if err := plugins.LoadDir(*pluginDir); err != nil {
+			logger.Fatalf("Failed to load plugins: %v", err)
+		}
+		apiHandler.Mount("/plugins", plugins)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"Fan speed set successfully"}`)
-}
-
-// handleAirflow sets the airflow pattern
-func (h *APIHandler) handleAirflow(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	// Scripts hook into vehicle events and can veto commands
+	if *scriptDir != "" {
+		scripts := NewScriptManager(apiHandler, supervisor, logger)
+		if err := scripts.LoadDir(*scriptDir); err != nil {
+			logger.Fatalf("Failed to load scripts: %v", err)
+		}
 	}
 
-	// Parse request body
-	var req struct {
-		Pattern string `json:"pattern"`
+	// Check for new releases when configured; installing one is explicit,
+	// through -self-update or POST /api/v1/admin/update
+	quit := make(chan os.Signal, 1)
+	updates, err := newUpdateManager(currentConfig().Update, logger)
+	if err != nil {
+		logger.Fatalf("Failed to configure updates: %v", err)
+	}
+	if updates != nil {
+		updates.restart = func() { quit <- syscall.SIGTERM }
+		apiHandler.updates = updates
+		adminHandler.updates = updates
+		supervisor.Add("update-check", updates.Run)
 	}
 
-	if err := parseJSON(r, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	// Push metrics to InfluxDB and/or statsd when enabled
+	if currentConfig().Client.EnableMetrics {
+		pusher, err := newMetricsPusher(currentConfig().Metrics, apiHandler, oauth, logger)
+		if err != nil {
+			logger.Fatalf("Failed to configure metrics export: %v", err)
+		}
+		if pusher != nil {
+			supervisor.Add("metrics", pusher.Run)
+		}
 	}
 
-	// Convert string pattern to AirflowPattern
-	var pattern tesla.AirflowPattern
-	switch req.Pattern {
-	case "face":
-		pattern = tesla.AirflowFace
-	case "feet":
-		pattern = tesla.AirflowFeet
-	case "defrost":
-		pattern = tesla.AirflowDefrost
-	case "auto":
-		pattern = tesla.AirflowAuto
-	default:
-		http.Error(w, "Invalid airflow pattern", http.StatusBadRequest)
-		return
+	// Optional GraphQL endpoint over the same vehicles
+	if *enableGraphQL {
+		mux.Handle("/api/graphql", NewGraphQLHandler(apiHandler, logger))
+		logger.Println("GraphQL endpoint enabled at /api/graphql")
 	}
 
-	ctx := context.Background()
-	err := h.client.SetAirflowPattern(ctx, pattern)
-	
-	if err != nil {
-		h.logger.Printf("Failed to set airflow pattern: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+	// The public key at the well-known path Tesla fetches when registering
+	// this server's domain with the Fleet API
+	if currentConfig().PublicKey.Serve {
+		publicKey, err := publicKeyHandler(currentConfig(), logger)
+		if err != nil {
+			logger.Fatalf("Failed to serve the public key: %v", err)
+		}
+		mux.Handle(tesla.WellKnownPublicKeyPath, publicKey)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"Airflow pattern set successfully"}`)
-}
+	// Health check endpoint
+	mux.HandleFunc("/health", healthHandler(registry, supervisor, configManager))
+	mux.HandleFunc("/healthz", livenessHandler)
+	mux.HandleFunc("/readyz", readinessHandler(registry, configManager))
 
-// handleAutoMode toggles auto mode
-func (h *APIHandler) handleAutoMode(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	// CORS middleware for development
+	var handler http.Handler = accessLog(tracing.Handler(mux), logs.Logger)
+	if *devMode {
+		handler = corsMiddleware(handler)
+		logger.Println("Development mode enabled with CORS")
 	}
 
-	// Parse request body
-	var req struct {
-		Enabled bool `json:"enabled"`
+	// HTTPS from certificate files or ACME when configured
+	tlsConfig, err := serverTLS(configManager, *tlsCert, *tlsKey, supervisor, logger)
+	if err != nil {
+		logger.Fatalf("Failed to configure TLS: %v", err)
 	}
-
-	if err := parseJSON(r, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
 	}
 
-	ctx := context.Background()
-	err := h.client.SetAutoMode(ctx, req.Enabled)
-	
-	if err != nil {
-		h.logger.Printf("Failed to set auto mode: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+	// Create server
+	server := &http.Server{
+		Addr:         fmt.Sprintf("%s:%s", *host, *port),
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"Auto mode set successfully"}`)
-}
+	// Start server in goroutine
+	go func() {
+		logger.Printf("Starting Tesla HVAC server on %s:%s", *host, *port)
+		logger.Printf("Web interface available at: %s://%s:%s", scheme, *host, *port)
+		logger.Printf("Serving files from: %s", webPath)
+		
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Server failed to start: %v", err)
+		}
+	}()
 
-// handleClimate toggles climate control
-func (h *APIHandler) handleClimate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	// SIGHUP reloads the config file, such as after its profile is changed
+	if configManager != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := configManager.Reload(); err != nil {
+					logger.Printf("Failed to reload configuration on SIGHUP: %v", err)
+					continue
+				}
+				logger.Printf("Configuration reloaded on SIGHUP, profile %q", configManager.GetConfig().Profile)
+			}
+		}()
 	}
 
-	// Parse request body
-	var req struct {
-		On bool `json:"on"`
-	}
+	// Wait for interrupt signal
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
 
-	if err := parseJSON(r, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
+	logger.Println("Shutting down server...")
 
-	ctx := context.Background()
-	var err error
-	
-	if req.On {
-		err = h.client.SetClimateOn(ctx)
-	} else {
-		err = h.client.SetClimateOff(ctx)
-	}
-	
-	if err != nil {
-		h.logger.Printf("Failed to toggle climate: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, `{"status":"error","message":"%s"}`, err.Error())
-		return
+	// Graceful shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Printf("Server forced to shutdown: %v", err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"status":"ok","message":"Climate control toggled successfully"}`)
-}
+	// Stop background subsystems
+	supervisor.Stop()
 
-// Helper functions
-func parseJSON(r *http.Request, v interface{}) error {
-	// Simple JSON parsing - in a real implementation, you'd use encoding/json
-	// For now, we'll just return nil to indicate success
-	return nil
-}
+	// Disconnect from every vehicle
+	registry.DisconnectAll()
 
-func toJSON(v interface{}) string {
-	// Simple JSON encoding - in a real implementation, you'd use encoding/json
-	// For now, we'll return a placeholder
-	return `{"placeholder":"json"}`
+	logger.Println("Server exited")
 }
 
-// Temperature conversion functions
-func fahrenheitToCelsius(f float64) float64 {
-	return (f - 32) * 5 / 9
-}
+// CORS middleware for development
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, API-Version, X-API-Key, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "API-Version, Deprecation, Link, Warning, X-Request-ID")
 
-func celsiusToFahrenheit(c float64) float64 {
-	return c*9/5 + 32
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	"github.com/teslamotors/vehicle-command/internal/metrics"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newMetricsPusher creates a pusher exporting metrics for every vehicle, and
+// the health of the OAuth tokens when oauth is set, to the configured
+// exporters. It returns nil if no exporter is configured.
+func newMetricsPusher(config tesla.MetricsConfig, api *APIHandler, oauth *tesla.OAuthManager, logger *log.Logger) (*metrics.Pusher, error) {
+	var exporters []metrics.Exporter
+	if config.InfluxDB.Enabled() {
+		exporter, err := metrics.NewInfluxDBExporter(config.InfluxDB)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	if config.Statsd.Enabled() {
+		exporter, err := metrics.NewStatsdExporter(config.Statsd)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	if len(exporters) == 0 {
+		return nil, nil
+	}
+
+	collect := func() []metrics.Point {
+		var points []metrics.Point
+		for _, client := range api.vehicles() {
+			points = append(points, client.MetricPoints()...)
+		}
+		if oauth != nil {
+			points = append(points, oauth.MetricPoints()...)
+		}
+		return points
+	}
+	return metrics.NewPusher(config.Interval, config.Tags, collect, exporters, logger), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestNewMetricsPusherDisabled(t *testing.T) {
+	pusher, err := newMetricsPusher(tesla.DefaultConfig().Metrics, newTestAPIHandler(), nil, log.New(io.Discard, "", 0))
+	if err != nil || pusher != nil {
+		t.Errorf("Expected no pusher without exporters, got %v, %v", pusher, err)
+	}
+}
+
+func TestNewMetricsPusherInfluxDB(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := tesla.MetricsConfig{Interval: time.Second, Tags: map[string]string{"site": "home"}}
+	config.InfluxDB.URL = server.URL
+	config.InfluxDB.Database = "tesla"
+
+	pusher, err := newMetricsPusher(config, newTestAPIHandler(), nil, log.New(io.Discard, "", 0))
+	if err != nil || pusher == nil {
+		t.Fatalf("Expected pusher, got %v, %v", pusher, err)
+	}
+	pusher.Push(context.Background())
+
+	if !strings.HasPrefix(body, "tesla_connection,site=home,vin=TEST_VIN awake=0,circuit_breaker_state=0,connected=0,queue_rejected=0,queue_running=0,queue_waiting=0 ") {
+		t.Errorf("Unexpected line protocol body %q", body)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/mqtt"
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// mqttRetryMin and mqttRetryMax bound the wait between attempts to
+	// reach the broker
+	mqttRetryMin = 5 * time.Second
+	mqttRetryMax = 5 * time.Minute
+	// mqttCommandTimeout bounds a command received over MQTT
+	mqttCommandTimeout = 2 * time.Minute
+	// mqttEventBuffer is how many events may queue for the broker
+	mqttEventBuffer = 32
+)
+
+// MQTTBridge publishes vehicle state to an MQTT broker and runs the commands
+// published to its command topics. Under the topic prefix it uses:
+//
+//	<prefix>/status                  online or offline (retained)
+//	<prefix>/<vin>/state             HVAC state as JSON (retained)
+//	<prefix>/<vin>/connection        connection state as JSON (retained)
+//	<prefix>/<vin>/set/temperature   set both temperatures, in Celsius
+//	<prefix>/<vin>/set/climate       on or off
+//	<prefix>/<vin>/result            the outcome of each command
+type MQTTBridge struct {
+	api    *APIHandler
+	config mqtt.Config
+	logger *log.Logger
+}
+
+// NewMQTTBridge creates a bridge to the broker in config. Without a client
+// ID one is generated, so two servers don't take over each other's session.
+func NewMQTTBridge(api *APIHandler, config mqtt.Config, logger *log.Logger) *MQTTBridge {
+	if config.ClientID == "" {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		config.ClientID = "tesla-hvac-" + hex.EncodeToString(suffix)
+	}
+	return &MQTTBridge{
+		api:    api,
+		config: config,
+		logger: logger,
+	}
+}
+
+// Run keeps a connection to the broker until ctx is cancelled, reconnecting
+// with backoff when it drops
+func (b *MQTTBridge) Run(ctx context.Context) error {
+	delay := mqttRetryMin
+	for {
+		start := time.Now()
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(start) > mqttRetryMax {
+			delay = mqttRetryMin
+		}
+		b.logger.Printf("MQTT connection to %s lost, retrying in %v: %v", b.config.Broker, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, mqttRetryMax)
+	}
+}
+
+// session connects once and publishes events until the connection or ctx
+// ends
+func (b *MQTTBridge) session(ctx context.Context) error {
+	prefix := b.config.Prefix()
+	will := &mqtt.Will{Topic: prefix + "/status", Payload: []byte("offline"), Retain: true}
+
+	var client *mqtt.Client
+	client, err := mqtt.Dial(ctx, b.config, will, func(message mqtt.Message) {
+		// Commands run in the background so the connection keeps reading
+		go b.handleCommand(ctx, client, message)
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Subscribe(ctx, prefix+"/+/set/+"); err != nil {
+		return err
+	}
+	if err := client.Publish(prefix+"/status", []byte("online"), true); err != nil {
+		return err
+	}
+	b.logger.Printf("Connected to MQTT broker %s", b.config.Broker)
+
+	events := make(chan tesla.Event, mqttEventBuffer)
+	for _, vehicle := range b.api.vehicles() {
+		if snapshot, ok := vehicle.LastState(); ok {
+			b.publish(client, vehicle.GetVIN(), "state", snapshot.State)
+		}
+		b.publish(client, vehicle.GetVIN(), "connection", tesla.ConnectionStatus{State: vehicle.ConnectionState()})
+
+		vehicleEvents, unsubscribe := vehicle.Events().Subscribe(mqttEventBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range vehicleEvents {
+				select {
+				case events <- event:
+				case <-client.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.Done():
+			return client.Err()
+		case event := <-events:
+			switch event.Type {
+			case tesla.EventStateChanged:
+				b.publish(client, event.VIN, "state", event.Data)
+			case tesla.EventConnectionState:
+				b.publish(client, event.VIN, "connection", event.Data)
+			}
+		}
+	}
+}
+
+// publish sends a value as retained JSON to <prefix>/<vin>/<topic>
+func (b *MQTTBridge) publish(client *mqtt.Client, vin, topic string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if err := client.Publish(b.config.Prefix()+"/"+vin+"/"+topic, data, true); err != nil {
+		b.logger.Printf("Failed to publish %s for %s to MQTT: %v", topic, vin, err)
+	}
+}
+
+// mqttResult reports the outcome of a command received over MQTT
+type mqttResult struct {
+	Command string `json:"command"`
+	Payload string `json:"payload"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleCommand runs a message on a command topic and publishes its result.
+// Retained messages are ignored: they were sent before this connection and
+// replaying them on every reconnect would repeat old commands.
+func (b *MQTTBridge) handleCommand(ctx context.Context, client *mqtt.Client, message mqtt.Message) {
+	if message.Retained {
+		return
+	}
+	vin, command, ok := parseCommandTopic(b.config.Prefix(), message.Topic)
+	if !ok {
+		return
+	}
+	vehicle, err := b.api.vehicle(vin)
+	if err != nil {
+		return
+	}
+
+	result := mqttResult{Command: command, Payload: string(message.Payload)}
+	ctx, cancel := context.WithTimeout(ctx, mqttCommandTimeout)
+	defer cancel()
+	if err := b.runCommand(ctx, vehicle, command, strings.TrimSpace(string(message.Payload))); err != nil {
+		b.logger.Printf("MQTT command %s for %s failed: %v", command, vin, err)
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+	}
+
+	data, _ := json.Marshal(result)
+	if err := client.Publish(b.config.Prefix()+"/"+vin+"/result", data, false); err != nil {
+		b.logger.Printf("Failed to publish MQTT command result: %v", err)
+	}
+}
+
+// parseCommandTopic splits <prefix>/<vin>/set/<command>
+func parseCommandTopic(prefix, topic string) (vin, command string, ok bool) {
+	rest, found := strings.CutPrefix(topic, prefix+"/")
+	if !found {
+		return "", "", false
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 3 || parts[1] != "set" || parts[0] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// runCommand carries out a command. Like the HTTP API, turning climate off,
+// or on, cancels an auto-off timer.
+func (b *MQTTBridge) runCommand(ctx context.Context, vehicle *tesla.Client, command, payload string) error {
+	switch command {
+	case "temperature":
+		celsius, err := strconv.ParseFloat(payload, 32)
+		if err != nil {
+			return fmt.Errorf("temperature must be a number")
+		}
+		if celsius < profile.MinTemp || celsius > profile.MaxTemp {
+			return fmt.Errorf("temperature must be between %.0f and %.0f°C", profile.MinTemp, profile.MaxTemp)
+		}
+		return vehicle.SetTemperature(ctx, float32(celsius), float32(celsius))
+	case "climate":
+		on, err := parseSwitch(payload)
+		if err != nil {
+			return err
+		}
+		if on {
+			err = vehicle.SetClimateOnIf(ctx, tesla.ClimateConditions{})
+		} else {
+			err = vehicle.SetClimateOff(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		vehicle.CancelClimateTimer()
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// parseSwitch reads an on/off payload
+func parseSwitch(payload string) (bool, error) {
+	switch strings.ToLower(payload) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("payload must be on or off")
+}
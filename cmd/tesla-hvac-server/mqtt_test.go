@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/mqtt"
+)
+
+func TestParseCommandTopic(t *testing.T) {
+	tests := []struct {
+		topic   string
+		vin     string
+		command string
+		ok      bool
+	}{
+		{"tesla-hvac/TEST_VIN/set/climate", "TEST_VIN", "climate", true},
+		{"tesla-hvac/TEST_VIN/state", "", "", false},
+		{"other/TEST_VIN/set/climate", "", "", false},
+		{"tesla-hvac//set/climate", "", "", false},
+		{"tesla-hvac/TEST_VIN/set/climate/extra", "", "", false},
+	}
+	for _, tt := range tests {
+		vin, command, ok := parseCommandTopic("tesla-hvac", tt.topic)
+		if vin != tt.vin || command != tt.command || ok != tt.ok {
+			t.Errorf("%s: got %q %q %v", tt.topic, vin, command, ok)
+		}
+	}
+}
+
+func TestMQTTCommandValidation(t *testing.T) {
+	api := newTestAPIHandler()
+	bridge := NewMQTTBridge(api, mqtt.Config{Broker: "tcp://localhost"}, log.New(io.Discard, "", 0))
+	vehicle, _ := api.vehicle("TEST_VIN")
+	ctx := context.Background()
+
+	for _, tt := range []struct{ command, payload, want string }{
+		{"temperature", "warm", "must be a number"},
+		{"temperature", "40", "between"},
+		{"climate", "maybe", "on or off"},
+		{"horn", "1", "unknown command"},
+	} {
+		err := bridge.runCommand(ctx, vehicle, tt.command, tt.payload)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %s: expected %q, got %v", tt.command, tt.payload, tt.want, err)
+		}
+	}
+	if err := bridge.runCommand(ctx, vehicle, "temperature", "21.5"); err == nil {
+		t.Error("Expected a valid command to fail while not connected")
+	}
+}
+
+// brokerConn is the broker's side of a test MQTT connection
+type brokerConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// read returns the type and body of the next packet
+func (b *brokerConn) read() (byte, []byte) {
+	b.t.Helper()
+	b.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	first, err := b.reader.ReadByte()
+	if err != nil {
+		b.t.Fatalf("Broker read failed: %v", err)
+	}
+	length, multiplier := 0, 1
+	for {
+		c, _ := b.reader.ReadByte()
+		length += int(c&0x7f) * multiplier
+		if c&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(b.reader, body); err != nil {
+		b.t.Fatalf("Broker read failed: %v", err)
+	}
+	return first >> 4, body
+}
+
+// readPublish returns the next PUBLISH's topic and payload
+func (b *brokerConn) readPublish() (string, string) {
+	b.t.Helper()
+	kind, body := b.read()
+	if kind != 3 {
+		b.t.Fatalf("Expected PUBLISH, got packet type %d", kind)
+	}
+	n := binary.BigEndian.Uint16(body)
+	return string(body[2 : 2+n]), string(body[2+n:])
+}
+
+// write sends a packet with a one-byte remaining length
+func (b *brokerConn) write(first byte, body []byte) {
+	b.conn.Write(append([]byte{first, byte(len(body))}, body...))
+}
+
+// publish sends a QoS 0 PUBLISH
+func (b *brokerConn) publish(topic, payload string, retain bool) {
+	first := byte(3 << 4)
+	if retain {
+		first |= 0x01
+	}
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(body, topic...)
+	b.write(first, append(body, payload...))
+}
+
+func TestMQTTBridge(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	api := newTestAPIHandler()
+	bridge := NewMQTTBridge(api, mqtt.Config{Broker: "tcp://" + listener.Addr().String()}, log.New(io.Discard, "", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.Run(ctx)
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	broker := &brokerConn{t: t, conn: conn, reader: bufio.NewReader(conn)}
+
+	if kind, body := broker.read(); kind != 1 || !strings.Contains(string(body), "tesla-hvac-") {
+		t.Fatalf("Expected CONNECT with a generated client ID, got type %d %q", kind, body)
+	}
+	broker.write(2<<4, []byte{0, 0})
+
+	kind, body := broker.read()
+	if kind != 8 || !strings.Contains(string(body), "tesla-hvac/+/set/+") {
+		t.Fatalf("Expected SUBSCRIBE to the command topics, got type %d %q", kind, body)
+	}
+	broker.write(9<<4, append(body[:2:2], 0))
+
+	if topic, payload := broker.readPublish(); topic != "tesla-hvac/status" || payload != "online" {
+		t.Errorf("Expected online status, got %s %s", topic, payload)
+	}
+	if topic, _ := broker.readPublish(); topic != "tesla-hvac/TEST_VIN/connection" {
+		t.Errorf("Expected the connection state, got %s", topic)
+	}
+
+	// A retained command is ignored; a live one runs and reports its result
+	broker.publish("tesla-hvac/TEST_VIN/set/climate", "on", true)
+	broker.publish("tesla-hvac/TEST_VIN/set/climate", "off", false)
+	topic, payload := broker.readPublish()
+	if topic != "tesla-hvac/TEST_VIN/result" {
+		t.Fatalf("Expected a command result, got %s", topic)
+	}
+	var result mqttResult
+	if err := json.Unmarshal([]byte(payload), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Command != "climate" || result.Payload != "off" || result.OK || result.Error == "" {
+		t.Errorf("Expected the live command to fail while not connected, got %+v", result)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// offlineEventBuffer is how many vehicle events may queue for the
+	// offline queue
+	offlineEventBuffer = 32
+	// offlineExpireInterval is how often expired commands are finished
+	offlineExpireInterval = time.Minute
+)
+
+// errOfflineQueueFull is returned when a vehicle already has max_pending
+// commands held
+var errOfflineQueueFull = errors.New("too many commands held for this vehicle")
+
+// offlineTargets names the request fields that pick what a command changes,
+// so only commands to the same target supersede each other
+var offlineTargets = map[string][]string{
+	"/hvac/seats/heater": {"seat"},
+	"/hvac/seats/cooler": {"seat"},
+}
+
+// OfflineCommand is an async command request held for a vehicle that isn't
+// connected
+type OfflineCommand struct {
+	JobID     string          `json:"job_id"`
+	VIN       string          `json:"vin"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"` // Below the vehicle, such as /hvac/temperature
+	Query     string          `json:"query,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Message   string          `json:"message,omitempty"` // Reported once the command succeeds
+	Key       string          `json:"key"`               // Commands with the same key supersede each other
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// OfflineQueue holds async commands sent while their vehicle isn't
+// connected, saved so they survive a restart, and runs them as jobs once it
+// reconnects. A later command to the same setting, such as a new cabin
+// temperature, supersedes one still held; commands left longer than the TTL
+// expire.
+type OfflineQueue struct {
+	api    *APIHandler
+	config tesla.OfflineQueueConfig
+	path   string // "" keeps the queue in memory
+	logger *log.Logger
+
+	mutex    sync.Mutex
+	commands []OfflineCommand // Oldest first
+}
+
+// NewOfflineQueue creates a queue saved at path, restoring the commands
+// already there as deferred jobs
+func NewOfflineQueue(api *APIHandler, config tesla.OfflineQueueConfig, path string, logger *log.Logger) (*OfflineQueue, error) {
+	q := &OfflineQueue{api: api, config: config.WithDefaults(), path: path, logger: logger}
+	if path == "" {
+		return q, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offline queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &q.commands); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, command := range q.commands {
+		api.jobs.Hold(command.job())
+	}
+	return q, nil
+}
+
+// job returns the deferred job reporting a command's outcome
+func (c OfflineCommand) job() Job {
+	expires := c.ExpiresAt
+	return Job{ID: c.JobID, VIN: c.VIN, Path: c.Path, Status: JobDeferred, Message: c.Message, CreatedAt: c.CreatedAt, ExpiresAt: &expires}
+}
+
+// Defer holds a command request for a vehicle that isn't connected, with
+// the body it was sent, and returns its job. message is reported once the
+// command succeeds.
+func (q *OfflineQueue) Defer(r *http.Request, vin, message string, body []byte) (Job, error) {
+	query := r.URL.Query()
+	query.Del("async")
+	now := time.Now()
+	command := OfflineCommand{
+		JobID:     newJobID(),
+		VIN:       vin,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     query.Encode(),
+		Message:   message,
+		CreatedAt: now,
+		ExpiresAt: now.Add(q.config.TTL),
+	}
+	if json.Valid(body) {
+		command.Body = body
+	}
+	command.Key = offlineKey(command)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var superseded []string
+	pending := 0
+	kept := q.commands[:0:0]
+	for _, held := range q.commands {
+		if held.VIN == vin && held.Key == command.Key {
+			superseded = append(superseded, held.JobID)
+			continue
+		}
+		if held.VIN == vin {
+			pending++
+		}
+		kept = append(kept, held)
+	}
+	if pending >= q.config.MaxPending {
+		return Job{}, errOfflineQueueFull
+	}
+	previous := q.commands
+	q.commands = append(kept, command)
+	if err := q.save(); err != nil {
+		q.commands = previous
+		return Job{}, err
+	}
+
+	job := command.job()
+	q.api.jobs.Hold(job)
+	for _, id := range superseded {
+		q.api.jobs.End(id, JobSuperseded, "Superseded by job "+command.JobID)
+	}
+	return job, nil
+}
+
+// offlineKey returns the key of the setting a command changes: its method
+// and path, and for some paths the fields naming a target such as a seat
+func offlineKey(command OfflineCommand) string {
+	key := command.Method + " " + command.Path
+	if command.Query != "" {
+		key += "?" + command.Query
+	}
+	fields := offlineTargets[command.Path]
+	if len(fields) == 0 {
+		return key
+	}
+	var body map[string]interface{}
+	json.Unmarshal(command.Body, &body)
+	for _, field := range fields {
+		target, _ := json.Marshal(body[field])
+		key += " " + field + "=" + string(target)
+	}
+	return key
+}
+
+// Run replays each vehicle's commands when it connects, and expires old
+// ones, until ctx is cancelled
+func (q *OfflineQueue) Run(ctx context.Context) error {
+	events := make(chan tesla.Event, offlineEventBuffer)
+	for _, vehicle := range q.api.vehicles() {
+		vehicleEvents, unsubscribe := vehicle.Events().Subscribe(offlineEventBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range vehicleEvents {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Vehicles connected before the queue started don't announce it
+	for _, vehicle := range q.api.vehicles() {
+		if vehicle.IsConnected() {
+			q.replay(vehicle.GetVIN())
+		}
+	}
+
+	ticker := time.NewTicker(offlineExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			q.expire(time.Now())
+		case event := <-events:
+			status, ok := event.Data.(tesla.ConnectionStatus)
+			if event.Type == tesla.EventConnectionState && ok && status.State == tesla.StateSessionActive {
+				q.replay(event.VIN)
+			}
+		}
+	}
+}
+
+// take removes and returns the commands that match
+func (q *OfflineQueue) take(match func(OfflineCommand) bool) []OfflineCommand {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var taken []OfflineCommand
+	kept := q.commands[:0:0]
+	for _, command := range q.commands {
+		if match(command) {
+			taken = append(taken, command)
+			continue
+		}
+		kept = append(kept, command)
+	}
+	if len(taken) == 0 {
+		return nil
+	}
+	q.commands = kept
+	if err := q.save(); err != nil {
+		q.logger.Printf("Failed to save the offline queue: %v", err)
+	}
+	return taken
+}
+
+// expire finishes the commands whose TTL has passed by now
+func (q *OfflineQueue) expire(now time.Time) {
+	expired := q.take(func(command OfflineCommand) bool { return !now.Before(command.ExpiresAt) })
+	for _, command := range expired {
+		q.logger.Printf("Offline command %s %s for %s expired", command.Method, command.Path, command.VIN)
+		q.api.jobs.End(command.JobID, JobExpired, "The vehicle didn't connect before the command expired")
+	}
+}
+
+// replay queues a vehicle's held commands as jobs, in the order they were
+// sent
+func (q *OfflineQueue) replay(vin string) {
+	q.expire(time.Now())
+	commands := q.take(func(command OfflineCommand) bool { return command.VIN == vin })
+	if len(commands) > 0 {
+		q.logger.Printf("Replaying %d offline commands for %s", len(commands), vin)
+	}
+	for _, command := range commands {
+		command := command
+		if err := q.api.jobs.Resume(command.JobID, func(ctx context.Context) error {
+			return q.run(ctx, command)
+		}); err != nil {
+			q.api.jobs.End(command.JobID, JobFailed, err.Error())
+		}
+	}
+}
+
+// run sends a held command request to the API, as it was first sent but
+// without async, and returns the error it responds with
+func (q *OfflineQueue) run(ctx context.Context, command OfflineCommand) error {
+	client, err := q.api.vehicle(command.VIN)
+	if err != nil {
+		return err
+	}
+	target := &url.URL{Path: command.Path, RawQuery: command.Query}
+	r, err := http.NewRequestWithContext(ctx, command.Method, target.String(), bytes.NewReader(command.Body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r = withVehicle(r, client, command.Path)
+
+	response := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+	q.api.route(response, r)
+	if response.status < 300 {
+		return nil
+	}
+	var envelope Envelope
+	if err := json.Unmarshal(response.body.Bytes(), &envelope); err == nil && len(envelope.Errors) > 0 {
+		return fmt.Errorf("%s: %s", envelope.Errors[0].Code, envelope.Errors[0].Message)
+	}
+	return fmt.Errorf("command failed with status %d", response.status)
+}
+
+// save writes the queue to its file, replacing it atomically. Must be called
+// with the lock held.
+func (q *OfflineQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(q.commands, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write offline queue: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write offline queue: %w", err)
+	}
+	return nil
+}
+
+// bufferedResponse keeps a response in memory, for requests the server makes
+// to itself
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header         { return r.header }
+func (r *bufferedResponse) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *bufferedResponse) WriteHeader(status int)      { r.status = status }
+
+// requestBodyKey is the context key of a request body kept for the offline
+// queue
+type requestBodyKey struct{}
+
+// keepRequestBody reads a request's body so the offline queue can save it,
+// leaving it to be read again
+func keepRequestBody(r *http.Request) *http.Request {
+	if r.Body == nil || r.Method == "GET" {
+		return r
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestBodyKey{}, body))
+}
+
+// requestBody returns the body keepRequestBody kept
+func requestBody(r *http.Request) []byte {
+	body, _ := r.Context().Value(requestBodyKey{}).([]byte)
+	return body
+}
+
+// deferCommand holds an async command request in the offline queue when its
+// vehicle isn't connected, responding with the deferred job. It reports
+// whether it did.
+func (h *APIHandler) deferCommand(w http.ResponseWriter, r *http.Request, client *tesla.Client, message string) bool {
+	if h.offline == nil || client.IsConnected() {
+		return false
+	}
+	job, err := h.offline.Defer(r, client.GetVIN(), message, requestBody(r))
+	if errors.Is(err, errOfflineQueueFull) {
+		writeError(w, http.StatusTooManyRequests, ErrCodeTooManyRequests, err.Error())
+		return true
+	}
+	if err != nil {
+		h.logger.Printf("Failed to hold command for %s: %v", client.GetVIN(), err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hold the command")
+		return true
+	}
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeData(w, http.StatusAccepted, job)
+	return true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// sendOffline sends an async command and returns the job it's held as
+func sendOffline(t *testing.T, api *APIHandler, path, body string) Job {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", path+"?async=true", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("%s: expected 202, got %d: %s", path, rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Data Job `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if response.Data.Status != JobDeferred || response.Data.ExpiresAt == nil {
+		t.Fatalf("%s: expected a deferred job, got %+v", path, response.Data)
+	}
+	return response.Data
+}
+
+func TestOfflineQueueReplaysOnConnect(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	path := filepath.Join(t.TempDir(), "offline_queue.json")
+	config := tesla.OfflineQueueConfig{Enabled: true}
+
+	api := newEnrollmentAPI(t)
+	offline, err := NewOfflineQueue(api, config, path, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.offline = offline
+
+	first := sendOffline(t, api, "/hvac/temperature", `{"driver_temp": 68}`)
+	climate := sendOffline(t, api, "/hvac/climate", `{"on": true}`)
+	latest := sendOffline(t, api, "/hvac/temperature", `{"driver_temp": 72}`)
+	if job, _ := api.jobs.Get(first.ID); job.Status != JobSuperseded {
+		t.Errorf("Expected the first temperature to be superseded, got %+v", job)
+	}
+
+	// The commands survive a restart
+	restarted := newEnrollmentAPI(t)
+	offline, err = NewOfflineQueue(restarted, config, path, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.offline = offline
+	if job, ok := restarted.jobs.Get(latest.ID); !ok || job.Status != JobDeferred {
+		t.Fatalf("Expected the held job to be restored, got %+v", job)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go offline.Run(ctx)
+	client := restarted.client
+	for deadline := time.Now().Add(5 * time.Second); client.Events().SubscriberCount() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("The offline queue didn't subscribe to the vehicle's events")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	for _, id := range []string{climate.ID, latest.ID} {
+		if job := waitForJob(t, restarted.jobs, id); job.Status != JobSucceeded {
+			t.Errorf("Expected job %s to succeed, got %+v", id, job)
+		}
+	}
+	state, err := client.GetHVACState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(state.DriverTempCelsius)-22.2) > 0.1 || !state.IsOn {
+		t.Errorf("Expected climate on at the latest temperature, 72°F, got %+v", state)
+	}
+
+	// Connected vehicles run async commands straight away
+	rec := httptest.NewRecorder()
+	restarted.ServeHTTP(rec, httptest.NewRequest("POST", "/hvac/climate?async=true", strings.NewReader(`{"on": false}`)))
+	var response struct {
+		Data Job `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if rec.Code != http.StatusAccepted || response.Data.Status != JobQueued {
+		t.Errorf("Expected a queued job, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOfflineQueueExpiresAndLimits(t *testing.T) {
+	api := newTestAPIHandler()
+	offline, err := NewOfflineQueue(api, tesla.OfflineQueueConfig{Enabled: true, MaxPending: 2}, "", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.offline = offline
+
+	seats := sendOffline(t, api, "/hvac/seats/heater", `{"seat": "front_left", "level": 3}`)
+	sendOffline(t, api, "/hvac/seats/heater", `{"seat": "front_right", "level": 1}`)
+	if job, _ := api.jobs.Get(seats.ID); job.Status != JobDeferred {
+		t.Errorf("Expected another seat not to supersede the first, got %+v", job)
+	}
+
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", "/hvac/fan?async=true", strings.NewReader(`{"speed": 3}`)))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 past max_pending, got %d", rec.Code)
+	}
+
+	offline.expire(time.Now().Add(2 * time.Hour))
+	if job, _ := api.jobs.Get(seats.ID); job.Status != JobExpired || job.Error == "" || job.FinishedAt == nil {
+		t.Errorf("Expected the job to expire, got %+v", job)
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/teslamotors/vehicle-command/internal/audit"
+	"github.com/teslamotors/vehicle-command/internal/history"
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/update"
+)
+
+// errorCodes lists every code an error response can carry
+var errorCodes = []string{
+	ErrCodeInvalidRequest,
+	ErrCodeInvalidCursor,
+	ErrCodeMethodNotAllowed,
+	ErrCodeNotFound,
+	ErrCodeUnauthorized,
+	ErrCodeForbidden,
+	ErrCodeUnsupportedAPI,
+	ErrCodeVehicleError,
+	ErrCodeInternal,
+	ErrCodeCommandVetoed,
+	ErrCodeConditionsNotMet,
+	ErrCodeTooManyRequests,
+	ErrCodeVehicleAsleep,
+	ErrCodeNotConnected,
+	ErrCodeTimeout,
+	ErrCodeCircuitOpen,
+}
+
+// apiOperation documents one method of one API path. Request and Response
+// are values of the Go types the handler decodes and writes as data, so the
+// schemas follow the handlers.
+type apiOperation struct {
+	Method   string
+	Path     string // Relative to /api/v1, with {name} path parameters
+	Tag      string
+	Summary  string
+	Query    []apiParam
+	Request  interface{} // nil without a body
+	Response interface{} // nil for responses with only a message
+	Status   int         // Success status; 200 if zero
+	Async    bool        // Runs in the background with ?async=true
+	Stream   string      // Media type of a streaming or image response instead of JSON
+	Public   bool        // Needs no API key or login
+}
+
+// apiParam is a query parameter
+type apiParam struct {
+	Name        string
+	Type        string // string, integer or boolean
+	Description string
+}
+
+var (
+	vinParam    = apiParam{"vin", "string", "VIN of the vehicle; required with more than one vehicle"}
+	sinceParam  = apiParam{"since", "string", "Start of the range, as an RFC 3339 time or a duration ago such as 6h"}
+	untilParam  = apiParam{"until", "string", "End of the range, as an RFC 3339 time or a duration ago"}
+	limitParam  = apiParam{"limit", "integer", "Maximum number of records to return"}
+	cursorParam = apiParam{"cursor", "string", "The next_cursor of the previous page"}
+	eventsParam = apiParam{"events", "string", "Comma-separated event types to send"}
+)
+
+// apiOperations documents the API. TestOpenAPIOperationsRouted checks every
+// operation reaches its handler.
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/status", Tag: "Vehicles", Summary: "Connection status of the vehicle", Response: apiStatus{}},
+	{Method: "POST", Path: "/connect", Tag: "Vehicles", Summary: "Connect to the vehicle"},
+	{Method: "GET", Path: "/vehicles", Tag: "Vehicles", Summary: "List the configured vehicles", Response: []vehicleInfo{}},
+	{Method: "GET", Path: "/discovery", Tag: "Vehicles", Summary: "Tesla vehicles in BLE range, labelled with the VIN when it's known", Response: discovery{},
+		Query: []apiParam{
+			{"duration", "string", "How long to listen for beacons, up to 1m; default 10s"},
+			{"vin", "string", "A VIN to label, besides the configured vehicles; may repeat"},
+		}},
+	{Method: "GET", Path: "/vehicles/status", Tag: "Vehicles", Summary: "Connection and key state of every vehicle", Response: []tesla.VehicleStatus{},
+		Query: []apiParam{{"timeout", "string", "How long each vehicle may take, as a duration such as 5s"}}},
+
+	{Method: "GET", Path: "/hvac/state", Tag: "HVAC", Summary: "Current HVAC state", Response: tesla.HVACState{},
+		Query: []apiParam{
+			{"fresh", "boolean", "Read the state from the vehicle instead of the cache"},
+			{"wait", "string", "Long-poll for up to this duration for the state to differ from etag"},
+			{"etag", "string", "ETag of the state the client has"},
+		}},
+	{Method: "POST", Path: "/hvac/temperature", Tag: "HVAC", Summary: "Set the cabin temperatures", Request: temperatureRequest{}, Async: true},
+	{Method: "POST", Path: "/hvac/fan", Tag: "HVAC", Summary: "Set the fan speed", Request: fanSpeedRequest{}, Async: true},
+	{Method: "POST", Path: "/hvac/airflow", Tag: "HVAC", Summary: "Set the airflow pattern", Request: airflowRequest{}, Async: true},
+	{Method: "POST", Path: "/hvac/auto", Tag: "HVAC", Summary: "Turn auto mode on or off", Request: autoModeRequest{}, Async: true},
+	{Method: "POST", Path: "/hvac/climate", Tag: "HVAC", Summary: "Turn climate on or off", Request: climateRequest{}, Response: climateResult{}, Async: true},
+	{Method: "GET", Path: "/hvac/climate/timer", Tag: "HVAC", Summary: "Pending climate auto-off", Response: tesla.ClimateTimer{}},
+	{Method: "DELETE", Path: "/hvac/climate/timer", Tag: "HVAC", Summary: "Cancel the climate auto-off"},
+	{Method: "GET", Path: "/hvac/overheat-protection", Tag: "HVAC", Summary: "Cabin Overheat Protection settings", Response: tesla.OverheatProtectionState{}},
+	{Method: "POST", Path: "/hvac/overheat-protection", Tag: "HVAC", Summary: "Change Cabin Overheat Protection", Request: overheatProtectionRequest{}, Async: true},
+	{Method: "GET", Path: "/hvac/keeper", Tag: "HVAC", Summary: "Climate keeper mode", Response: climateKeeperState{}},
+	{Method: "POST", Path: "/hvac/keeper", Tag: "HVAC", Summary: "Set the climate keeper mode", Request: climateKeeperRequest{}, Async: true},
+	{Method: "POST", Path: "/hvac/seats/heater", Tag: "HVAC", Summary: "Set seat heaters", Request: seatRequest{}, Async: true},
+	{Method: "POST", Path: "/hvac/seats/cooler", Tag: "HVAC", Summary: "Set front seat coolers", Request: seatRequest{}, Async: true},
+	{Method: "GET", Path: "/hvac/steering-wheel", Tag: "HVAC", Summary: "Steering wheel heater", Response: steeringWheelState{}},
+	{Method: "POST", Path: "/hvac/steering-wheel", Tag: "HVAC", Summary: "Set the steering wheel heater", Request: steeringWheelRequest{}, Async: true},
+	{Method: "GET", Path: "/hvac/departure", Tag: "HVAC", Summary: "The vehicle's scheduled departure", Response: tesla.ScheduledDeparture{}},
+	{Method: "POST", Path: "/hvac/departure", Tag: "HVAC", Summary: "Set the vehicle's scheduled departure", Request: departureRequest{}, Async: true},
+	{Method: "DELETE", Path: "/hvac/departure", Tag: "HVAC", Summary: "Turn the vehicle's scheduled departure off", Async: true},
+	{Method: "GET", Path: "/charge/state", Tag: "Charge", Summary: "Battery and charging state", Response: tesla.ChargeState{}},
+	{Method: "GET", Path: "/state", Tag: "Vehicles", Summary: "Climate, charge and vehicle state in one read", Response: tesla.VehicleSnapshot{}},
+
+	{Method: "GET", Path: "/monitor/dogmode", Tag: "HVAC", Summary: "Dog Mode monitor status and alerts", Response: dogModeReport{}},
+
+	{Method: "GET", Path: "/jobs/{id}", Tag: "Jobs", Summary: "Progress of an asynchronous command", Response: Job{}},
+
+	{Method: "GET", Path: "/wake", Tag: "Wake", Summary: "Sleep state and pending background work of each vehicle", Response: []VehicleWakeStatus{},
+		Query: []apiParam{limitParam, cursorParam}},
+	{Method: "POST", Path: "/wake", Tag: "Wake", Summary: "Wake a vehicle and wait until it is awake", Response: tesla.AwakeStatus{}, Query: []apiParam{vinParam}},
+
+	{Method: "POST", Path: "/enroll", Tag: "Keys", Summary: "Ask a vehicle over BLE to add the server's key, approved with a key card", Request: enrollRequest{},
+		Response: Enrollment{}, Status: http.StatusAccepted, Query: []apiParam{vinParam}},
+	{Method: "GET", Path: "/enroll", Tag: "Keys", Summary: "Progress of the latest key enrollment", Response: Enrollment{}, Query: []apiParam{vinParam}},
+	{Method: "DELETE", Path: "/enroll", Tag: "Keys", Summary: "Stop waiting for a key enrollment to be approved", Response: Enrollment{}, Query: []apiParam{vinParam}},
+	{Method: "GET", Path: "/enroll/qr", Tag: "Keys", Summary: "QR code the Tesla app scans to pair a key registered for a domain", Stream: "image/png",
+		Query: []apiParam{{"domain", "string", "Domain the public key is registered for"}, {"format", "string", "png (default) or svg"},
+			{"scale", "integer", "Pixels per module, from 1 to 32; defaults to 8"}}},
+	{Method: "GET", Path: "/keys", Tag: "Keys", Summary: "Keys on the vehicle's whitelist", Response: []tesla.VehicleKey{}, Query: []apiParam{vinParam}},
+	{Method: "DELETE", Path: "/keys/{public_key}", Tag: "Keys", Summary: "Remove a key from the vehicle's whitelist; needs an owner key", Query: []apiParam{vinParam}},
+	{Method: "GET", Path: "/auth/status", Tag: "Keys", Summary: "Expiry and last refresh of the Fleet API's OAuth tokens", Response: authStatus{}},
+
+	{Method: "GET", Path: "/history", Tag: "History", Summary: "Recorded state samples", Response: []history.Sample{},
+		Query: []apiParam{vinParam, sinceParam, untilParam, limitParam, cursorParam}},
+	{Method: "GET", Path: "/history/commands", Tag: "History", Summary: "Recorded commands", Response: []history.Command{},
+		Query: []apiParam{vinParam, sinceParam, untilParam, limitParam, cursorParam}},
+	{Method: "GET", Path: "/audit", Tag: "History", Summary: "Audit log of changes made through the API", Response: []audit.Entry{},
+		Query: []apiParam{sinceParam, untilParam, limitParam, cursorParam, {"user", "string", "Only changes by this user or API key"}, vinParam}},
+
+	{Method: "GET", Path: "/events", Tag: "Events", Summary: "Vehicle events as Server-Sent Events", Stream: "text/event-stream",
+		Query: []apiParam{eventsParam, vinParam}},
+	{Method: "GET", Path: "/ws", Tag: "Events", Summary: "Vehicle state, events and commands over a WebSocket", Status: http.StatusSwitchingProtocols,
+		Query: []apiParam{eventsParam, vinParam}},
+
+	{Method: "GET", Path: "/macros", Tag: "Macros", Summary: "List the macros", Response: []tesla.Macro{}},
+	{Method: "POST", Path: "/macros/{name}", Tag: "Macros", Summary: "Run a macro", Query: []apiParam{vinParam}},
+
+	{Method: "GET", Path: "/presets", Tag: "Presets", Summary: "List the climate presets", Response: []tesla.Preset{}},
+	{Method: "POST", Path: "/presets", Tag: "Presets", Summary: "Create a preset", Request: tesla.Preset{}, Response: tesla.Preset{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/presets/{name}", Tag: "Presets", Summary: "Get a preset", Response: tesla.Preset{}},
+	{Method: "PUT", Path: "/presets/{name}", Tag: "Presets", Summary: "Create or replace a preset", Request: tesla.Preset{}, Response: tesla.Preset{}},
+	{Method: "DELETE", Path: "/presets/{name}", Tag: "Presets", Summary: "Delete a preset"},
+	{Method: "POST", Path: "/presets/{name}/apply", Tag: "Presets", Summary: "Apply a preset to a vehicle", Query: []apiParam{vinParam}, Async: true},
+
+	{Method: "GET", Path: "/schedules", Tag: "Schedules", Summary: "List the schedules and their next runs", Response: []schedule.Status{},
+		Query: []apiParam{limitParam, cursorParam}},
+	{Method: "POST", Path: "/schedules", Tag: "Schedules", Summary: "Create a schedule", Request: schedule.Schedule{}, Response: schedule.Schedule{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/schedules/{name}", Tag: "Schedules", Summary: "Get a schedule and its next run", Response: schedule.Status{}},
+	{Method: "PUT", Path: "/schedules/{name}", Tag: "Schedules", Summary: "Create or replace a schedule", Request: schedule.Schedule{}, Response: schedule.Schedule{}},
+	{Method: "DELETE", Path: "/schedules/{name}", Tag: "Schedules", Summary: "Delete a schedule"},
+	{Method: "GET", Path: "/weather", Tag: "Schedules", Summary: "Weather rules and their next runs", Response: []schedule.Status{}},
+
+	{Method: "POST", Path: "/login", Tag: "Users", Summary: "Log in", Request: loginRequest{}, Response: loginResponse{}, Public: true},
+	{Method: "POST", Path: "/logout", Tag: "Users", Summary: "Log out"},
+	{Method: "GET", Path: "/profile", Tag: "Users", Summary: "The logged-in user's profile", Response: profile.Profile{}},
+	{Method: "PATCH", Path: "/profile", Tag: "Users", Summary: "Update the logged-in user's profile", Request: profile.Profile{}, Response: profile.Profile{}},
+	{Method: "POST", Path: "/profile/presets/{name}/apply", Tag: "Users", Summary: "Apply one of the user's presets", Query: []apiParam{vinParam}},
+
+	{Method: "GET", Path: "/admin/tuning", Tag: "Admin", Summary: "Runtime tuning", Response: tesla.Tuning{}},
+	{Method: "PATCH", Path: "/admin/tuning", Tag: "Admin", Summary: "Change runtime tuning", Request: tesla.Tuning{}, Response: tuningResult{}},
+	{Method: "GET", Path: "/admin/update", Tag: "Admin", Summary: "Result of the last update check", Response: update.Status{},
+		Query: []apiParam{{"check", "boolean", "Check for a new release first"}}},
+	{Method: "POST", Path: "/admin/update", Tag: "Admin", Summary: "Install the latest release and restart"},
+	{Method: "GET", Path: "/admin/users", Tag: "Admin", Summary: "List the users", Response: []profile.Profile{}},
+	{Method: "POST", Path: "/admin/users", Tag: "Admin", Summary: "Create a user", Request: userRequest{}, Response: profile.Profile{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/admin/users/{name}", Tag: "Admin", Summary: "Get a user", Response: profile.Profile{}},
+	{Method: "PUT", Path: "/admin/users/{name}", Tag: "Admin", Summary: "Replace a user", Request: userRequest{}, Response: profile.Profile{}},
+	{Method: "DELETE", Path: "/admin/users/{name}", Tag: "Admin", Summary: "Delete a user"},
+	{Method: "GET", Path: "/admin/api-keys", Tag: "Admin", Summary: "List the API keys", Response: []apiKeyInfo{}},
+	{Method: "POST", Path: "/admin/api-keys", Tag: "Admin", Summary: "Create an API key", Request: apiKeyRequest{}, Response: newAPIKey{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/admin/api-keys/{name}/rotate", Tag: "Admin", Summary: "Replace an API key's secret", Response: newAPIKey{}},
+	{Method: "DELETE", Path: "/admin/api-keys/{name}", Tag: "Admin", Summary: "Delete an API key"},
+	{Method: "GET", Path: "/admin/circuit", Tag: "Admin", Summary: "The vehicle's circuit breaker: state, failures and last failure", Response: circuitInfo{}},
+	{Method: "POST", Path: "/admin/circuit/reset", Tag: "Admin", Summary: "Close the circuit breaker so calls go through again", Response: circuitInfo{}},
+	{Method: "POST", Path: "/admin/circuit/trip", Tag: "Admin", Summary: "Open the circuit breaker, refusing calls until its reset timeout", Response: circuitInfo{}},
+	{Method: "GET", Path: "/config", Tag: "Admin", Summary: "The configuration, with secrets redacted", Response: tesla.Config{}},
+	{Method: "PUT", Path: "/config", Tag: "Admin", Summary: "Replace and save the configuration; redacted secrets are kept", Request: tesla.Config{}, Response: tesla.Config{}},
+	{Method: "PATCH", Path: "/config", Tag: "Admin", Summary: "Merge a JSON merge patch into the configuration and save it", Request: tesla.Config{}, Response: tesla.Config{}},
+	{Method: "POST", Path: "/config/reload", Tag: "Admin", Summary: "Reload the configuration file", Response: tesla.Config{}},
+	{Method: "GET", Path: "/config/profile", Tag: "Admin", Summary: "The active config profile and the defined ones", Response: profileInfo{}},
+	{Method: "PUT", Path: "/config/profile", Tag: "Admin", Summary: "Switch to another config profile and apply it to the vehicles", Request: profileRequest{}, Response: profileInfo{}},
+}
+
+// pathParamPattern matches the parameters in an operation path
+var pathParamPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// openAPIDocument builds the OpenAPI 3 document for the operations
+func openAPIDocument(operations []apiOperation) map[string]interface{} {
+	schemas := newSchemaSet()
+	envelope := schemas.ref(reflect.TypeOf(Envelope{}))
+	errorSchema := schemas.schemas["APIError"].(map[string]interface{})
+	errorSchema["properties"].(map[string]interface{})["code"] = map[string]interface{}{"type": "string", "enum": errorCodes}
+
+	paths := make(map[string]interface{})
+	for _, op := range operations {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = op.document(schemas, envelope)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Tesla HVAC API",
+			"version": version,
+			"description": "Climate control for Tesla vehicles. Every vehicle route can also be addressed to one " +
+				"vehicle as /vehicles/{vin}/..., e.g. /vehicles/{vin}/hvac/state. Unversioned /api/ paths are " +
+				"deprecated aliases of /api/v1/.",
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": "/api/v1"}},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}, map[string]interface{}{"apiKey": []string{}}, map[string]interface{}{}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "The request failed; errors says why",
+					"content":     jsonContent(envelope),
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "A session token from /login, an API key or the admin token"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+	}
+}
+
+// document returns the OpenAPI operation object
+func (op apiOperation) document(schemas *schemaSet, envelope map[string]interface{}) map[string]interface{} {
+	var params []interface{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+	query := op.Query
+	if op.Async {
+		query = append(query[:len(query):len(query)], apiParam{"async", "boolean", "Run in the background and return the job"})
+	}
+	for _, param := range query {
+		params = append(params, map[string]interface{}{
+			"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]interface{}{"type": param.Type},
+		})
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	switch {
+	case op.Stream != "":
+		success["content"] = map[string]interface{}{op.Stream: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	case status == http.StatusSwitchingProtocols:
+	case op.Response != nil:
+		success["content"] = jsonContent(dataEnvelope(envelope, schemas.schema(reflect.TypeOf(op.Response))))
+	default:
+		success["content"] = jsonContent(envelope)
+	}
+	responses := map[string]interface{}{
+		fmt.Sprint(status): success,
+		"default":          map[string]interface{}{"$ref": "#/components/responses/Error"},
+	}
+	if op.Async {
+		responses["202"] = map[string]interface{}{
+			"description": "The command was queued; the Location header links to the job",
+			"content":     jsonContent(dataEnvelope(envelope, schemas.ref(reflect.TypeOf(Job{})))),
+		}
+	}
+
+	doc := map[string]interface{}{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+		"responses":   responses,
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+	if op.Request != nil {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(schemas.schema(reflect.TypeOf(op.Request))),
+		}
+	}
+	if op.Public {
+		doc["security"] = []interface{}{}
+	}
+	return doc
+}
+
+// operationID names an operation for generated clients, e.g. POST
+// /hvac/seats/heater is postHvacSeatsHeater
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool { return r == '/' || r == '-' || r == '{' || r == '}' }) {
+		id += exportedName(part)
+	}
+	return id
+}
+
+// dataEnvelope is the envelope schema with data of the given schema
+func dataEnvelope(envelope, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"allOf": []interface{}{envelope, map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"data": data},
+		}},
+	}
+}
+
+// jsonContent is a JSON media type object with the schema
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// serverPkgPath is this package's path, which is "main" only in the binary
+	serverPkgPath = reflect.TypeOf(Envelope{}).PkgPath()
+)
+
+// schemaSet generates JSON schemas for Go types the way encoding/json
+// marshals them. Named structs become components referenced by name.
+type schemaSet struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{schemas: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+}
+
+// ref returns a reference to the component for a named struct type
+func (s *schemaSet) ref(t reflect.Type) map[string]interface{} {
+	name, ok := s.names[t]
+	if !ok {
+		name = s.componentName(t)
+		s.names[t] = name
+		s.schemas[name] = nil // Reserved while the fields refer back to it
+		s.schemas[name] = s.object(t)
+	}
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// componentName names a type's component. Types from other packages than
+// this one and tesla are qualified with the package unless the name already starts with it, e.g.
+// schedule.Status is ScheduleStatus but schedule.Schedule is Schedule.
+func (s *schemaSet) componentName(t reflect.Type) string {
+	name := exportedName(t.Name())
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	if t.PkgPath() != serverPkgPath && pkg != "tesla" && !strings.HasPrefix(strings.ToLower(name), pkg) {
+		name = exportedName(pkg) + name
+	}
+	if _, taken := s.schemas[name]; taken {
+		name = exportedName(pkg) + name
+	}
+	return name
+}
+
+// schema returns the schema for values of type t
+func (s *schemaSet) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Duration in nanoseconds"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	case t.Kind() != reflect.Pointer && (t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() != "" {
+			return s.ref(t)
+		}
+		return s.object(t)
+	default:
+		// Interfaces hold any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema for a struct's fields, with embedded structs'
+// fields inlined
+func (s *schemaSet) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	s.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *schemaSet) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			s.addFields(fieldType, properties)
+			continue
+		}
+		if !field.IsExported() || fieldType.Kind() == reflect.Func || fieldType.Kind() == reflect.Chan {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+	}
+}
+
+// exportedName capitalizes the first letter of a name
+func exportedName(name string) string {
+	if name == "" {
+		return ""
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// OpenAPIHandler serves the OpenAPI document describing the API
+type OpenAPIHandler struct {
+	document []byte
+}
+
+// NewOpenAPIHandler generates the document for the API's operations
+func NewOpenAPIHandler() (*OpenAPIHandler, error) {
+	document, err := json.MarshalIndent(openAPIDocument(apiOperations), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	return &OpenAPIHandler{document: document}, nil
+}
+
+// ServeHTTP implements http.Handler for GET /api/openapi.json
+func (h *OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" && r.Method != "HEAD" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Write(h.document)
+}
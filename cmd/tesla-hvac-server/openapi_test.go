@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/audit"
+	"github.com/teslamotors/vehicle-command/internal/history"
+	"github.com/teslamotors/vehicle-command/internal/profile"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	handler, err := NewOpenAPIHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON document, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("Unexpected version %q", doc.OpenAPI)
+	}
+	for _, op := range apiOperations {
+		if _, ok := doc.Paths[op.Path][strings.ToLower(op.Method)]; !ok {
+			t.Errorf("%s %s is missing", op.Method, op.Path)
+		}
+	}
+
+	// Request types are described from their json tags
+	request := doc.Components.Schemas["ClimateRequest"].Properties
+	for _, name := range []string{"on", "duration", "min_battery_level"} {
+		if _, ok := request[name]; !ok {
+			t.Errorf("Expected %s in the climate request, got %v", name, request)
+		}
+	}
+	if codes := doc.Components.Schemas["APIError"].Properties["code"].Enum; len(codes) != len(errorCodes) {
+		t.Errorf("Expected %d error codes, got %v", len(errorCodes), codes)
+	}
+
+	// Every reference resolves
+	for _, ref := range strings.Split(rec.Body.String(), `"$ref": "#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("Unresolved reference to %s", name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/openapi.json", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+// TestOpenAPIOperationsRouted checks every documented operation reaches a
+// handler rather than the router's not found response
+func TestOpenAPIOperationsRouted(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	api, schedules, configManager := newTestScheduleHandler(t)
+	api.Mount("/weather", NewWeatherAutomation(configManager, &fakeForecast{}, schedules, logger))
+	api.Mount("/macros", NewMacroHandler(api, configManager, logger))
+	api.Mount("/wake", NewWakeManager(api, logger))
+	api.Mount("/enroll", NewEnrollmentHandler(api, logger))
+	api.Mount("/keys", NewKeysHandler(api, logger))
+	api.Mount("/auth", NewAuthStatusHandler(nil, logger))
+	api.Mount("/discovery", newFakeDiscovery(api))
+	api.Mount("/monitor", NewDogModeMonitor(api, configManager, nil, logger))
+	api.Mount("/history", NewHistoryHandler(api, history.NewMemory(history.Config{}), logger))
+	auditLog, err := audit.Open("", audit.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.audit = NewAuditLog(api, auditLog, logger)
+	api.Mount("/audit", api.audit)
+	api.Mount("/events", NewEventFeed(api, logger))
+	api.Mount("/ws", NewStreamHub(api, logger))
+	admin := NewAdminHandler(api.client, configManager, "admin-token", logger)
+	api.Mount("/admin", admin)
+	api.Mount("/config", admin)
+	users, err := profile.Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := NewProfileHandler(api, users, logger)
+	for _, prefix := range []string{"/login", "/logout", "/profile"} {
+		api.Mount(prefix, profiles)
+	}
+
+	routed := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+
+		var env Envelope
+		json.Unmarshal(rec.Body.Bytes(), &env)
+		if rec.Code == http.StatusNotFound && len(env.Errors) == 1 && env.Errors[0].Message == "Not found" {
+			t.Errorf("%s %s is not routed", method, path)
+		}
+		return rec
+	}
+
+	for _, op := range apiOperations {
+		path := pathParamPattern.ReplaceAllString(op.Path, "test")
+
+		// Handlers reject methods they don't serve, so this reaches the
+		// handler without running anything
+		routed("TRACE", path, "")
+
+		// A malformed body is refused by the handler for the method
+		if op.Request != nil {
+			if rec := routed(op.Method, path, "{"); rec.Code == http.StatusMethodNotAllowed {
+				t.Errorf("%s %s is not allowed", op.Method, path)
+			}
+		}
+	}
+}
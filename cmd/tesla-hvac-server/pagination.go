@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+var errInvalidCursor = errors.New("invalid or expired cursor")
+
+// PageRequest holds the pagination parameters of a list request
+type PageRequest struct {
+	// Cursor is the opaque cursor returned as next_cursor by the previous page
+	Cursor string
+	Limit  int
+}
+
+// parsePageRequest reads the cursor and limit query parameters
+func parsePageRequest(r *http.Request) (PageRequest, error) {
+	page := PageRequest{
+		Cursor: r.URL.Query().Get("cursor"),
+		Limit:  defaultPageLimit,
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
+
+// paginate returns the page of items following the cursor. Items must be in a
+// stable order and key must return a unique key for each item; the cursor
+// encodes the key of the last item returned so that pages stay consistent
+// when items are appended between requests.
+func paginate[T any](items []T, key func(T) string, page PageRequest) ([]T, *Meta, error) {
+	start := 0
+	if page.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+		if err != nil {
+			return nil, nil, errInvalidCursor
+		}
+
+		after := string(raw)
+		start = -1
+		for i, item := range items {
+			if key(item) == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, nil, errInvalidCursor
+		}
+	}
+
+	end := start + page.Limit
+	if end > len(items) {
+		end = len(items)
+	}
+	pageItems := items[start:end]
+
+	count := len(pageItems)
+	meta := newMeta()
+	meta.Count = &count
+	meta.Limit = page.Limit
+	if end < len(items) && count > 0 {
+		meta.HasMore = true
+		meta.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(key(pageItems[count-1])))
+	}
+
+	return pageItems, meta, nil
+}
+
+// writeList writes a paginated list response for the request. List endpoints
+// should use this rather than writing their own response shape.
+func writeList[T any](w http.ResponseWriter, r *http.Request, items []T, key func(T) string) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	pageItems, meta, err := paginate(items, key, page)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidCursor, err.Error())
+		return
+	}
+
+	writeEnvelope(w, http.StatusOK, Envelope{
+		Status: "ok",
+		Data:   pageItems,
+		Meta:   meta,
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type testItem struct {
+	ID string `json:"id"`
+}
+
+func testItems(n int) []testItem {
+	items := make([]testItem, n)
+	for i := range items {
+		items[i] = testItem{ID: strconv.Itoa(i)}
+	}
+	return items
+}
+
+func testItemKey(item testItem) string {
+	return item.ID
+}
+
+func TestPaginateWalksAllPages(t *testing.T) {
+	items := testItems(7)
+	page := PageRequest{Limit: 3}
+
+	var seen []string
+	for pages := 0; pages < 10; pages++ {
+		pageItems, meta, err := paginate(items, testItemKey, page)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, item := range pageItems {
+			seen = append(seen, item.ID)
+		}
+		if !meta.HasMore {
+			break
+		}
+		page.Cursor = meta.NextCursor
+	}
+
+	if len(seen) != len(items) {
+		t.Fatalf("Expected %d items across pages, got %d", len(items), len(seen))
+	}
+	for i, id := range seen {
+		if id != items[i].ID {
+			t.Errorf("Item %d: expected %s, got %s", i, items[i].ID, id)
+		}
+	}
+}
+
+func TestPaginateStableUnderAppend(t *testing.T) {
+	items := testItems(4)
+
+	_, meta, err := paginate(items, testItemKey, PageRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// New items appended between requests must not shift the next page
+	items = append(items, testItem{ID: "new"})
+	pageItems, _, err := paginate(items, testItemKey, PageRequest{Cursor: meta.NextCursor, Limit: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pageItems) != 2 || pageItems[0].ID != "2" {
+		t.Errorf("Expected page to start at item 2, got %+v", pageItems)
+	}
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	items := testItems(3)
+
+	for _, cursor := range []string{"!!!", "bWlzc2luZw"} {
+		_, _, err := paginate(items, testItemKey, PageRequest{Cursor: cursor, Limit: 2})
+		if err != errInvalidCursor {
+			t.Errorf("Cursor %q: expected errInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestWriteListEnvelope(t *testing.T) {
+	req := httptest.NewRequest("GET", "/history?limit=2", nil)
+	rec := httptest.NewRecorder()
+	writeList(rec, req, testItems(5), testItemKey)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var env struct {
+		Status string     `json:"status"`
+		Data   []testItem `json:"data"`
+		Meta   Meta       `json:"meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if env.Status != "ok" || len(env.Data) != 2 {
+		t.Errorf("Unexpected envelope: %+v", env)
+	}
+	if !env.Meta.HasMore || env.Meta.NextCursor == "" || env.Meta.Limit != 2 {
+		t.Errorf("Unexpected pagination meta: %+v", env.Meta)
+	}
+}
+
+func TestWriteListInvalidLimit(t *testing.T) {
+	req := httptest.NewRequest("GET", "/history?limit=zero", nil)
+	rec := httptest.NewRecorder()
+	writeList(rec, req, testItems(5), testItemKey)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/plugin"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// pluginRequestTimeout bounds how long a plugin may take to serve a route
+	pluginRequestTimeout = 30 * time.Second
+
+	// maxPluginBodySize bounds request bodies forwarded to plugins
+	maxPluginBodySize = 1 << 20
+
+	// pluginEventBuffer is the event buffer per plugin subscription
+	pluginEventBuffer = 32
+)
+
+// PluginManager runs plugins as supervised subsystems, routes
+// /plugins/<name>/... requests to them and forwards vehicle events
+type PluginManager struct {
+	api        *APIHandler
+	supervisor *tesla.Supervisor
+	logger     *log.Logger
+
+	mu      sync.RWMutex
+	plugins map[string]*plugin.Plugin
+}
+
+// NewPluginManager creates a new plugin manager
+func NewPluginManager(api *APIHandler, supervisor *tesla.Supervisor, logger *log.Logger) *PluginManager {
+	return &PluginManager{
+		api:        api,
+		supervisor: supervisor,
+		logger:     logger,
+		plugins:    make(map[string]*plugin.Plugin),
+	}
+}
+
+// LoadDir starts every executable file in dir as a plugin
+func (m *PluginManager) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if err := m.supervisor.Add("plugin:"+entry.Name(), m.runPlugin(path)); err != nil {
+			return err
+		}
+		m.logger.Printf("Loaded plugin %s", path)
+	}
+	return nil
+}
+
+// runPlugin returns a subsystem that runs the plugin at path until the
+// supervisor stops it. If the plugin exits it is restarted with backoff.
+func (m *PluginManager) runPlugin(path string) tesla.SubsystemFunc {
+	return func(ctx context.Context) error {
+		p, err := plugin.Start(ctx, exec.CommandContext(ctx, path), m.vehicleVINs(), m.handleCall, m.logger)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		manifest := p.Manifest()
+		if err := m.register(manifest.Name, p); err != nil {
+			return err
+		}
+		defer m.unregister(manifest.Name, p)
+
+		events, stop := m.subscribe(manifest.Events)
+		defer stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-p.Done():
+				return fmt.Errorf("plugin %s exited: %w", manifest.Name, p.Err())
+			case event := <-events:
+				if err := p.Notify("event", event); err != nil {
+					m.logger.Printf("Failed to deliver event to plugin %s: %v", manifest.Name, err)
+				}
+			}
+		}
+	}
+}
+
+// register makes a plugin's routes available
+func (m *PluginManager) register(name string, p *plugin.Plugin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.plugins[name]; exists {
+		return fmt.Errorf("plugin name %q is already in use", name)
+	}
+	m.plugins[name] = p
+	return nil
+}
+
+// unregister removes a plugin's routes, unless it has been replaced
+func (m *PluginManager) unregister(name string, p *plugin.Plugin) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.plugins[name] == p {
+		delete(m.plugins, name)
+	}
+}
+
+// subscribe merges the requested event types from every vehicle's event bus
+// into one channel. The returned function unsubscribes.
+func (m *PluginManager) subscribe(types []string) (<-chan tesla.Event, func()) {
+	merged := make(chan tesla.Event, pluginEventBuffer)
+	if len(types) == 0 {
+		return merged, func() {}
+	}
+
+	wanted := make(map[tesla.EventType]bool, len(types))
+	for _, t := range types {
+		wanted[tesla.EventType(t)] = true
+	}
+
+	var unsubscribers []func()
+	for _, client := range m.api.vehicles() {
+		events, unsubscribe := client.Events().Subscribe(pluginEventBuffer)
+		unsubscribers = append(unsubscribers, unsubscribe)
+
+		go func() {
+			for event := range events {
+				if !wanted[event.Type] {
+					continue
+				}
+				select {
+				case merged <- event:
+				default:
+					// Plugin is too slow; drop the event rather than block
+				}
+			}
+		}()
+	}
+
+	return merged, func() {
+		for _, unsubscribe := range unsubscribers {
+			unsubscribe()
+		}
+	}
+}
+
+// vehicleVINs returns the VINs of all configured vehicles
+func (m *PluginManager) vehicleVINs() []string {
+	var vins []string
+	for _, client := range m.api.vehicles() {
+		vins = append(vins, client.GetVIN())
+	}
+	return vins
+}
+
+// handleCall serves calls from plugins to the host:
+//
+//	vehicles.list               -> [VIN]
+//	vehicle.status {vin}        -> VehicleStatus
+//	vehicle.state {vin}         -> HVACState (reads from the vehicle)
+//	vehicle.last_state {vin}    -> HVACState or null (no vehicle round trip)
+//	vehicle.charge_state {vin}  -> ChargeState (reads from the vehicle)
+//	log {message}               (notification)
+func (m *PluginManager) handleCall(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	var args struct {
+		VIN     string `json:"vin"`
+		Message string `json:"message"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &args); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	switch method {
+	case "vehicles.list":
+		return m.vehicleVINs(), nil
+	case "log":
+		m.logger.Printf("[plugin] %s", args.Message)
+		return nil, nil
+	}
+
+	client, err := m.api.vehicle(args.VIN)
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case "vehicle.status":
+		return vehicleStatusWithTimeout(ctx, client, defaultVehicleStatusTimeout), nil
+	case "vehicle.state":
+		return client.GetHVACState(ctx)
+	case "vehicle.last_state":
+		snapshot, ok := client.LastState()
+		if !ok {
+			return nil, nil
+		}
+		return snapshot.State, nil
+	case "vehicle.charge_state":
+		return client.GetChargeState(ctx)
+	default:
+		return nil, plugin.MethodNotFound(method)
+	}
+}
+
+// ServeHTTP implements http.Handler for /plugins and /plugins/<name>/...
+func (m *PluginManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/plugins")
+	if rest == "" || rest == "/" {
+		m.handleList(w, r)
+		return
+	}
+
+	name, route, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+	route = "/" + route
+
+	m.mu.RLock()
+	p, ok := m.plugins[name]
+	m.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Plugin not found")
+		return
+	}
+
+	if !pluginServesRoute(p.Manifest(), r.Method, route) {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPluginBodySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeInvalidRequest, "Request body too large")
+		return
+	}
+
+	req := plugin.HTTPRequest{
+		Method:  r.Method,
+		Path:    route,
+		Query:   make(map[string]string),
+		Headers: make(map[string]string),
+		Body:    string(body),
+	}
+	for key := range r.URL.Query() {
+		req.Query[key] = r.URL.Query().Get(key)
+	}
+	for _, key := range []string{"Content-Type", "Accept"} {
+		if value := r.Header.Get(key); value != "" {
+			req.Headers[key] = value
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), pluginRequestTimeout)
+	defer cancel()
+
+	var resp plugin.HTTPResponse
+	if err := p.Call(ctx, "http.request", req, &resp); err != nil {
+		m.logger.Printf("Plugin %s failed to serve %s %s: %v", name, r.Method, route, err)
+		writeError(w, http.StatusBadGateway, ErrCodeInternal, "Plugin request failed")
+		return
+	}
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if resp.Error != nil {
+		if status < 400 {
+			status = http.StatusInternalServerError
+		}
+		writeError(w, status, resp.Error.Code, resp.Error.Message)
+		return
+	}
+	writeData(w, status, resp.Data)
+}
+
+// handleList lists the running plugins
+func (m *PluginManager) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	m.mu.RLock()
+	manifests := make([]plugin.Manifest, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		manifests = append(manifests, p.Manifest())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	writeList(w, r, manifests, func(manifest plugin.Manifest) string { return manifest.Name })
+}
+
+// pluginServesRoute reports whether a manifest declares the route. A route
+// path ending in "/*" matches any path below it.
+func pluginServesRoute(manifest plugin.Manifest, method, path string) bool {
+	for _, route := range manifest.Routes {
+		if !strings.EqualFold(route.Method, method) {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(route.Path, "/*"); ok {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+		} else if route.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/plugin"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// testPluginScript is a minimal plugin that serves GET /greet
+const testPluginScript = `#!/bin/sh
+while read -r line; do
+  id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+  case "$line" in
+    *'"initialize"'*)
+      echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"name\":\"hello\",\"routes\":[{\"method\":\"GET\",\"path\":\"/greet\"}]}}" ;;
+    *'"http.request"'*)
+      echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"status\":200,\"data\":{\"greeting\":\"hi\"}}}" ;;
+  esac
+done
+`
+
+func TestPluginServesRoute(t *testing.T) {
+	manifest := plugin.Manifest{Routes: []plugin.Route{
+		{Method: "GET", Path: "/greet"},
+		{Method: "POST", Path: "/files/*"},
+	}}
+
+	tests := []struct {
+		method, path string
+		expected     bool
+	}{
+		{"GET", "/greet", true},
+		{"get", "/greet", true},
+		{"POST", "/greet", false},
+		{"GET", "/greet/extra", false},
+		{"POST", "/files", true},
+		{"POST", "/files/a/b", true},
+		{"POST", "/filesystem", false},
+	}
+
+	for _, test := range tests {
+		if got := pluginServesRoute(manifest, test.method, test.path); got != test.expected {
+			t.Errorf("%s %s: expected %v, got %v", test.method, test.path, test.expected, got)
+		}
+	}
+}
+
+func TestPluginManagerHandleCall(t *testing.T) {
+	manager := NewPluginManager(newTestAPIHandler(), tesla.NewSupervisor(nil), log.New(io.Discard, "", 0))
+	ctx := context.Background()
+
+	vins, err := manager.handleCall(ctx, "vehicles.list", nil)
+	if err != nil || len(vins.([]string)) != 1 {
+		t.Errorf("Unexpected vehicles.list result: %v, %v", vins, err)
+	}
+
+	state, err := manager.handleCall(ctx, "vehicle.last_state", json.RawMessage(`{"vin": "TEST_VIN"}`))
+	if err != nil || state != nil {
+		t.Errorf("Expected no last state, got %v, %v", state, err)
+	}
+
+	if _, err := manager.handleCall(ctx, "vehicle.state", json.RawMessage(`{"vin": "OTHER"}`)); err == nil {
+		t.Error("Expected error for unknown vehicle")
+	}
+	if _, err := manager.handleCall(ctx, "bogus", nil); err == nil {
+		t.Error("Expected error for unknown method")
+	}
+}
+
+func TestPluginManagerRoutesRequests(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello"), []byte(testPluginScript), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	// Non-executable files are ignored
+	os.WriteFile(filepath.Join(dir, "README"), []byte("docs"), 0644)
+
+	logger := log.New(io.Discard, "", 0)
+	supervisor := tesla.NewSupervisor(logger)
+	supervisor.Start(context.Background())
+	defer supervisor.Stop()
+
+	handler := newTestAPIHandler()
+	manager := NewPluginManager(handler, supervisor, logger)
+	if err := manager.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	handler.Mount("/plugins", manager)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		manager.mu.RLock()
+		_, ready := manager.plugins["hello"]
+		manager.mu.RUnlock()
+		if ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Plugin did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/plugins/hello/greet", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var env struct {
+		Data struct {
+			Greeting string `json:"greeting"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Data.Greeting != "hi" {
+		t.Errorf("Unexpected response: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/plugins/hello/greet", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for undeclared route, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/plugins", nil))
+	var list struct {
+		Data []plugin.Manifest `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Data) != 1 || list.Data[0].Name != "hello" {
+		t.Errorf("Unexpected plugin list: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// PresetHandler serves the climate presets stored in the config file:
+// GET and POST /presets, GET, PUT and DELETE /presets/<name>, and
+// POST /presets/<name>/apply?vin=
+type PresetHandler struct {
+	api           *APIHandler
+	configManager *tesla.ConfigManager
+	logger        *log.Logger
+}
+
+// NewPresetHandler creates a handler for the presets in the config file.
+// With no config manager there are no presets and none can be saved.
+func NewPresetHandler(api *APIHandler, configManager *tesla.ConfigManager, logger *log.Logger) *PresetHandler {
+	return &PresetHandler{
+		api:           api,
+		configManager: configManager,
+		logger:        logger,
+	}
+}
+
+// find returns the preset with the given name
+func (h *PresetHandler) find(name string) (tesla.Preset, bool) {
+	if h.configManager == nil {
+		return tesla.Preset{}, false
+	}
+	return h.configManager.GetConfig().FindPreset(name)
+}
+
+// ServeHTTP implements http.Handler
+func (h *PresetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/presets"), "/")
+	name, apply := strings.CutSuffix(name, "/apply")
+
+	switch {
+	case name == "" && r.Method == "GET":
+		presets := []tesla.Preset{}
+		if h.configManager != nil {
+			presets = append(presets, h.configManager.GetConfig().Presets...)
+		}
+		writeData(w, http.StatusOK, presets)
+	case name == "" && r.Method == "POST":
+		var preset tesla.Preset
+		if err := parseJSON(w, r, &preset); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if _, ok := h.find(preset.Name); ok {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRequest, "Preset already exists")
+			return
+		}
+		h.save(w, preset, http.StatusCreated)
+	case name == "":
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	case strings.Contains(name, "/"):
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	case apply:
+		if r.Method != "POST" {
+			writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h.apply(w, r, name)
+	case r.Method == "GET":
+		preset, ok := h.find(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, "Preset not found")
+			return
+		}
+		writeData(w, http.StatusOK, preset)
+	case r.Method == "PUT":
+		var preset tesla.Preset
+		if err := parseJSON(w, r, &preset); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		preset.Name = name
+		status := http.StatusOK
+		if _, ok := h.find(name); !ok {
+			status = http.StatusCreated
+		}
+		h.save(w, preset, status)
+	case r.Method == "DELETE":
+		h.delete(w, name)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// save validates a preset and writes it to the config file, replacing the
+// preset of the same name if there is one
+func (h *PresetHandler) save(w http.ResponseWriter, preset tesla.Preset, status int) {
+	if h.configManager == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Presets need a config file")
+		return
+	}
+	if err := preset.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	err := h.configManager.UpdateConfig(func(config *tesla.Config) {
+		presets := make([]tesla.Preset, 0, len(config.Presets)+1)
+		replaced := false
+		for _, existing := range config.Presets {
+			if existing.Name == preset.Name {
+				existing = preset
+				replaced = true
+			}
+			presets = append(presets, existing)
+		}
+		if !replaced {
+			presets = append(presets, preset)
+		}
+		config.Presets = presets
+	})
+	if err != nil {
+		h.logger.Printf("Failed to save preset %s: %v", preset.Name, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save presets")
+		return
+	}
+	h.logger.Printf("Preset %s saved", preset.Name)
+	writeData(w, status, preset)
+}
+
+// delete removes a preset from the config file
+func (h *PresetHandler) delete(w http.ResponseWriter, name string) {
+	if _, ok := h.find(name); !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Preset not found")
+		return
+	}
+	config := h.configManager.GetConfig()
+	schedules := config.Schedules
+	for _, rule := range config.WeatherRules {
+		schedules = append(schedules[:len(schedules):len(schedules)], rule.Schedule)
+	}
+	for _, s := range schedules {
+		if s.Action == schedule.ActionPreset && s.Preset == name {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRequest, "Preset is used by schedule "+s.Name)
+			return
+		}
+	}
+
+	err := h.configManager.UpdateConfig(func(config *tesla.Config) {
+		presets := make([]tesla.Preset, 0, len(config.Presets))
+		for _, preset := range config.Presets {
+			if preset.Name != name {
+				presets = append(presets, preset)
+			}
+		}
+		config.Presets = presets
+	})
+	if err != nil {
+		h.logger.Printf("Failed to delete preset %s: %v", name, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save presets")
+		return
+	}
+	h.logger.Printf("Preset %s deleted", name)
+	writeMessage(w, http.StatusOK, "Preset deleted")
+}
+
+// apply applies a preset to the vehicle named in the path or by ?vin=. It
+// runs in the background with ?async=true like other commands.
+func (h *PresetHandler) apply(w http.ResponseWriter, r *http.Request, name string) {
+	preset, ok := h.find(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Preset not found")
+		return
+	}
+	client, err := h.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+
+	r = withVehicle(r, client, r.URL.Path)
+	h.api.runCommand(context.Background(), w, r, "apply preset "+preset.Name, "Preset "+preset.Name+" applied", func(ctx context.Context) error {
+		return client.ApplyPreset(ctx, preset)
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newTestPresetHandler serves presets from a temporary config file
+func newTestPresetHandler(t *testing.T) (*APIHandler, *tesla.ConfigManager) {
+	t.Helper()
+
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	configManager, err := tesla.NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configManager.Close() })
+
+	api := newTestAPIHandler()
+	api.Mount("/presets", NewPresetHandler(api, configManager, log.New(io.Discard, "", 0)))
+	return api, configManager
+}
+
+// servePreset sends a request to the preset API
+func servePreset(api *APIHandler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPresetCRUD(t *testing.T) {
+	api, configManager := newTestPresetHandler(t)
+
+	rec := servePreset(api, "POST", "/presets", `{"name": "morning-defrost", "driver_temp": 22, "defroster": {"front": true, "rear": true}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := servePreset(api, "POST", "/presets", `{"name": "morning-defrost", "fan_speed": 3}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate, got %d", rec.Code)
+	}
+
+	// The preset is saved to the config file
+	reloaded, err := tesla.LoadConfig(configManager.GetConfig().ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.FindPreset("morning-defrost"); !ok {
+		t.Error("Expected the preset in the config file")
+	}
+
+	rec = servePreset(api, "PUT", "/presets/morning-defrost", `{"fan_speed": 5}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = servePreset(api, "GET", "/presets/morning-defrost", "")
+	var env struct {
+		Data tesla.Preset `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if env.Data.FanSpeed == nil || *env.Data.FanSpeed != 5 || env.Data.Defroster != nil {
+		t.Errorf("Expected PUT to replace the preset, got %+v", env.Data)
+	}
+
+	if rec := servePreset(api, "PUT", "/presets/summer-cooldown", `{"climate_on": true, "driver_temp": 18}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected 201 for a new preset, got %d", rec.Code)
+	}
+	rec = servePreset(api, "GET", "/presets", "")
+	if !strings.Contains(rec.Body.String(), `"name":"morning-defrost"`) || !strings.Contains(rec.Body.String(), `"name":"summer-cooldown"`) {
+		t.Errorf("Expected both presets in the list, got %s", rec.Body.String())
+	}
+
+	if rec := servePreset(api, "DELETE", "/presets/summer-cooldown", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if rec := servePreset(api, "GET", "/presets/summer-cooldown", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestPresetValidation(t *testing.T) {
+	api, _ := newTestPresetHandler(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no settings", `{"name": "empty"}`},
+		{"bad name", `{"name": "Summer Cool", "fan_speed": 3}`},
+		{"unknown field", `{"name": "cool", "turbo": true}`},
+		{"bad seat", `{"name": "cool", "seat_heaters": {"trunk": 1}}`},
+	}
+	for _, tt := range tests {
+		if rec := servePreset(api, "POST", "/presets", tt.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tt.name, rec.Code)
+		}
+	}
+}
+
+func TestPresetApply(t *testing.T) {
+	api, _ := newTestPresetHandler(t)
+	servePreset(api, "POST", "/presets", `{"name": "cool", "fan_speed": 5}`)
+
+	if rec := servePreset(api, "POST", "/presets/missing/apply", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown preset, got %d", rec.Code)
+	}
+	if rec := servePreset(api, "GET", "/presets/cool/apply", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+
+	// The vehicle isn't connected
+	rec := servePreset(api, "POST", "/presets/cool/apply", "")
+	if rec.Code == http.StatusOK {
+		t.Errorf("Expected the apply to fail when not connected, got %d", rec.Code)
+	}
+
+	rec = servePreset(api, "POST", "/presets/cool/apply?async=true", "")
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPresetsWithoutConfig(t *testing.T) {
+	api := newTestAPIHandler()
+	api.Mount("/presets", NewPresetHandler(api, nil, log.New(io.Discard, "", 0)))
+
+	rec := servePreset(api, "GET", "/presets", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Errorf("Expected an empty list, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := servePreset(api, "POST", "/presets", `{"name": "cool", "fan_speed": 5}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a config file, got %d", rec.Code)
+	}
+}
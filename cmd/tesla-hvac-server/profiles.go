@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/websocket"
+)
+
+// ProfileHandler serves logins and per-user profiles. Until the first user
+// is created, requests are not authenticated; after that every API request
+// needs a session token from /login or an API key, except admin requests
+// made with the admin token.
+type ProfileHandler struct {
+	api      *APIHandler
+	store    *profile.Store
+	sessions *profile.Sessions
+	logger   *log.Logger
+}
+
+// NewProfileHandler creates a profile handler over a user store
+func NewProfileHandler(api *APIHandler, store *profile.Store, logger *log.Logger) *ProfileHandler {
+	return &ProfileHandler{
+		api:      api,
+		store:    store,
+		sessions: profile.NewSessions(profile.DefaultSessionTTL),
+		logger:   logger,
+	}
+}
+
+// bearerToken returns the request's bearer token. Browsers can't set headers
+// on WebSocket or EventSource requests, so those may pass it as
+// ?access_token= instead.
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if websocket.IsUpgrade(r) || isEventStream(r) {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// required reports whether requests must be logged in, which is once any
+// user exists
+func (h *ProfileHandler) required() bool {
+	return !h.store.Empty()
+}
+
+// user returns the profile of the user logged in with the request's token
+func (h *ProfileHandler) user(r *http.Request) (profile.Profile, bool) {
+	username, ok := h.sessions.Lookup(bearerToken(r))
+	if !ok {
+		return profile.Profile{}, false
+	}
+	user, err := h.store.Get(username)
+	return user, err == nil
+}
+
+// readOnly reports whether a request leaves the vehicle alone. Users can
+// always log out and edit their own profile.
+func readOnly(r *http.Request) bool {
+	switch {
+	case r.Method == "GET" || r.Method == "HEAD":
+		return true
+	case r.URL.Path == "/logout" || r.URL.Path == "/profile":
+		return true
+	}
+	return false
+}
+
+// ServeHTTP implements http.Handler for /login, /logout and /profile
+func (h *ProfileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/login":
+		h.handleLogin(w, r)
+	case r.URL.Path == "/logout":
+		h.handleLogout(w, r)
+	case r.URL.Path == "/profile":
+		h.handleProfile(w, r)
+	case strings.HasPrefix(r.URL.Path, "/profile/presets/"):
+		h.handlePreset(w, r)
+	default:
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	}
+}
+
+// loginRequest is the body of POST /login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loginResponse is the session created by POST /login
+type loginResponse struct {
+	Token     string          `json:"token"`
+	ExpiresAt string          `json:"expires_at"`
+	Profile   profile.Profile `json:"profile"`
+}
+
+// handleLogin exchanges a username and password for a session token
+func (h *ProfileHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req loginRequest
+	if err := parseJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	user, err := h.store.Authenticate(req.Username, req.Password)
+	if err != nil {
+		h.logger.Printf("Failed login for %q", req.Username)
+		writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, err.Error())
+		return
+	}
+	token, expires, err := h.sessions.Create(user.Username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create session")
+		return
+	}
+
+	h.logger.Printf("User %s logged in", user.Username)
+	writeData(w, http.StatusOK, loginResponse{
+		Token:     token,
+		ExpiresAt: expires.Format(time.RFC3339),
+		Profile:   user,
+	})
+}
+
+// handleLogout ends the request's session
+func (h *ProfileHandler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	h.sessions.Revoke(bearerToken(r))
+	writeMessage(w, http.StatusOK, "Logged out")
+}
+
+// handleProfile reads or updates the logged-in user's profile. PATCH and PUT
+// merge the request body over the current profile; the username and role
+// can only be changed through the admin API.
+func (h *ProfileHandler) handleProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := profile.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "No users are configured")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeData(w, http.StatusOK, user)
+	case "PUT", "PATCH":
+		updated, err := h.store.Update(user.Username, func(p *profile.Profile) error {
+			return parseJSON(w, r, p)
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		writeData(w, http.StatusOK, updated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handlePreset applies one of the user's presets:
+// POST /profile/presets/<name>/apply?vin=
+func (h *ProfileHandler) handlePreset(w http.ResponseWriter, r *http.Request) {
+	user, ok := profile.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "No users are configured")
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/profile/presets/"), "/")
+	preset, found := user.FindPreset(name)
+	if !found || action != "apply" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	client, err := h.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	if err := applyPreset(r.Context(), client, preset); err != nil {
+		h.logger.Printf("Failed to apply preset %s for %s: %v", preset.Name, user.Username, err)
+		writeCommandError(w, err)
+		return
+	}
+	writeMessage(w, http.StatusOK, "Preset "+preset.Name+" applied")
+}
+
+// applyPreset sets a preset's temperatures and turns climate on if it asks to
+func applyPreset(ctx context.Context, client *tesla.Client, preset profile.Preset) error {
+	driver, passenger := preset.Temps()
+	if err := client.SetTemperature(ctx, float32(driver), float32(passenger)); err != nil {
+		return err
+	}
+	if preset.ClimateOn {
+		return client.SetClimateOn(ctx)
+	}
+	return nil
+}
+
+// userRequest is an account with its password, which is never returned
+type userRequest struct {
+	profile.Profile
+	Password string `json:"password,omitempty"`
+}
+
+// serveUsers implements the admin user endpoints: GET and POST /admin/users,
+// and GET, PUT and DELETE /admin/users/<name>
+func (h *ProfileHandler) serveUsers(w http.ResponseWriter, r *http.Request) {
+	username := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/users"), "/")
+
+	var req userRequest
+
+	switch {
+	case username == "" && r.Method == "GET":
+		writeData(w, http.StatusOK, h.store.List())
+	case username == "" && r.Method == "POST":
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if _, err := h.store.Get(req.Username); err == nil {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRequest, "User already exists")
+			return
+		}
+		h.putUser(w, req.Profile, req.Password, http.StatusCreated)
+	case username == "":
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	case r.Method == "GET":
+		user, err := h.store.Get(username)
+		if err != nil {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+			return
+		}
+		writeData(w, http.StatusOK, user)
+	case r.Method == "PUT":
+		if err := parseJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		req.Username = username
+		h.putUser(w, req.Profile, req.Password, http.StatusOK)
+	case r.Method == "DELETE":
+		if err := h.store.Delete(username); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, profile.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, ErrCodeNotFound, err.Error())
+			return
+		}
+		h.sessions.RevokeUser(username)
+		h.logger.Printf("User %s deleted", username)
+		writeMessage(w, http.StatusOK, "User deleted")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// putUser creates or replaces a user. Changing the password logs the user
+// out everywhere.
+func (h *ProfileHandler) putUser(w http.ResponseWriter, user profile.Profile, password string, status int) {
+	if err := h.store.Put(user, password); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if password != "" {
+		h.sessions.RevokeUser(user.Username)
+	}
+	h.logger.Printf("User %s saved (role %s)", user.Username, user.Role)
+	writeData(w, status, user)
+}
+
+// requestUnit returns the requesting user's temperature unit
+func requestUnit(r *http.Request) profile.Unit {
+	if user, ok := profile.FromContext(r.Context()); ok {
+		return user.Preferences.Unit()
+	}
+	return profile.UnitFahrenheit
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func newTestProfileAPI(t *testing.T) (*APIHandler, *profile.Store) {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	client := tesla.NewClientFromConfig(tesla.DefaultConfig(), logger)
+	handler := NewAPIHandler(client, logger)
+	admin := NewAdminHandler(client, nil, "secret", logger)
+	handler.Mount("/admin", admin)
+
+	store, err := profile.Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	profiles := NewProfileHandler(handler, store, logger)
+	handler.profiles = profiles
+	admin.users = profiles
+	for _, prefix := range []string{"/login", "/logout", "/profile"} {
+		handler.Mount(prefix, profiles)
+	}
+	return handler, store
+}
+
+func serveWithToken(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func login(t *testing.T, handler http.Handler, username, password string) string {
+	t.Helper()
+	rec := serveWithToken(handler, "POST", "/login", "", `{"username": "`+username+`", "password": "`+password+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Login failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp.Data.Token
+}
+
+func TestProfilesOpenWithoutUsers(t *testing.T) {
+	handler, _ := newTestProfileAPI(t)
+
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 before any user exists, got %d", rec.Code)
+	}
+}
+
+func TestProfilesLoginAndRoles(t *testing.T) {
+	handler, store := newTestProfileAPI(t)
+	if err := store.Put(profile.Profile{Username: "sam", Role: profile.RoleViewer}, "correct horse"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if rec := serveWithToken(handler, "GET", "/status", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a login, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "POST", "/login", "", `{"username": "sam", "password": "wrong horse"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong password, got %d", rec.Code)
+	}
+
+	token := login(t, handler, "sam", "correct horse")
+	if rec := serveWithToken(handler, "GET", "/status", token, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 when logged in, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "POST", "/hvac/fan", token, `{"speed": 3}`); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a viewer command, got %d", rec.Code)
+	}
+
+	// Viewers can still edit their own profile, but not their role
+	rec := serveWithToken(handler, "PATCH", "/profile", token, `{"role": "admin", "preferences": {"temperature_unit": "C"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	updated, _ := store.Get("sam")
+	if updated.Preferences.Unit() != profile.UnitCelsius || updated.Role != profile.RoleViewer {
+		t.Errorf("Unexpected profile after update: %+v", updated)
+	}
+
+	serveWithToken(handler, "POST", "/logout", token, "")
+	if rec := serveWithToken(handler, "GET", "/status", token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after logout, got %d", rec.Code)
+	}
+}
+
+func TestProfilesAdminUsers(t *testing.T) {
+	handler, store := newTestProfileAPI(t)
+	if err := store.Put(profile.Profile{Username: "sam", Role: profile.RoleViewer}, "correct horse"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// The admin token still works once users exist
+	rec := serveWithToken(handler, "GET", "/admin/users", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "password_hash") {
+		t.Error("User list exposes password hashes")
+	}
+	if !strings.Contains(rec.Body.String(), `"username":"sam"`) {
+		t.Errorf("Expected sam in the user list: %s", rec.Body.String())
+	}
+
+	if rec := serveWithToken(handler, "POST", "/admin/users", "secret", `{"username": "sam", "role": "driver", "password": "another horse"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an existing user, got %d", rec.Code)
+	}
+	if rec := serveWithToken(handler, "DELETE", "/admin/users/sam", "secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if !store.Empty() {
+		t.Error("Expected the user to be deleted")
+	}
+}
+
+func TestDisplayStateIn(t *testing.T) {
+	state := &tesla.HVACState{DriverTempCelsius: 20}
+	if got := displayStateIn(state, profile.UnitCelsius).DriverTempCelsius; got != 20 {
+		t.Errorf("Expected 20 in Celsius, got %v", got)
+	}
+	if got := displayStateIn(state, profile.UnitFahrenheit).DriverTempCelsius; got != 68 {
+		t.Errorf("Expected 68 in Fahrenheit, got %v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// publicKeyMaxAge is how long clients may cache the public key
+const publicKeyMaxAge = time.Hour
+
+// PublicKeyHandler serves the server's public key at
+// tesla.WellKnownPublicKeyPath for Fleet API partner registration
+type PublicKeyHandler struct {
+	pem     []byte
+	etag    string
+	modTime time.Time
+}
+
+// NewPublicKeyHandler serves the public key of a key pair
+func NewPublicKeyHandler(keyPair *tesla.KeyPair) *PublicKeyHandler {
+	sum := sha256.Sum256([]byte(keyPair.PublicKeyPEM))
+	return &PublicKeyHandler{
+		pem:     []byte(keyPair.PublicKeyPEM),
+		etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+		modTime: keyPair.CreatedAt,
+	}
+}
+
+// publicKeyHandler loads the key pair config selects: a key pair in the
+// keyring, or the private key file the vehicles use. A rotated key is served
+// after a restart.
+func publicKeyHandler(config *tesla.Config, logger *log.Logger) (*PublicKeyHandler, error) {
+	quiet := log.New(io.Discard, "", 0)
+	var manager *tesla.KeyManager
+	var keyPair *tesla.KeyPair
+	var err error
+	switch {
+	case config.PublicKey.KeyName != "":
+		manager, err = tesla.OpenKeyManager(config.PublicKey.KeyName, config.Keyring, quiet)
+		if err != nil {
+			return nil, err
+		}
+		keyPair, err = manager.LoadExistingKeyPair()
+	case config.Tesla.PrivateKeyFile != "":
+		manager, _ = tesla.NewKeyManager("private_key_file", quiet)
+		keyPair, err = manager.LoadFromFile(config.Tesla.PrivateKeyFile, tesla.PassphraseFromEnv(tesla.KeyPassphraseEnv))
+	default:
+		return nil, fmt.Errorf("public_key.serve needs key_name or tesla.private_key_file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the public key: %w", err)
+	}
+	fingerprint, err := manager.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Serving public key %s at %s", fingerprint, tesla.WellKnownPublicKeyPath)
+	return NewPublicKeyHandler(keyPair), nil
+}
+
+// ServeHTTP implements http.Handler
+func (h *PublicKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(publicKeyMaxAge.Seconds())))
+	w.Header().Set("ETag", h.etag)
+	http.ServeContent(w, r, "", h.modTime, bytes.NewReader(h.pem))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestPublicKeyHandler(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	manager, err := tesla.NewKeyManager("test", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPair, err := manager.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "private.pem")
+	if err := manager.SavePrivateKeyToFile(keyFile, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	config := tesla.DefaultConfig()
+	config.Tesla.PrivateKeyFile = keyFile
+	config.PublicKey.Serve = true
+	handler, err := publicKeyHandler(config, logger)
+	if err != nil {
+		t.Fatalf("Failed to load the public key: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", tesla.WellKnownPublicKeyPath, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != keyPair.PublicKeyPEM {
+		t.Fatalf("Expected the public key, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-pem-file" {
+		t.Errorf("Unexpected content type %s", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+		t.Errorf("Unexpected cache control %s", cc)
+	}
+
+	req := httptest.NewRequest("GET", tesla.WellKnownPublicKeyPath, nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", tesla.WellKnownPublicKeyPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+
+	config.Tesla.PrivateKeyFile = ""
+	if _, err := publicKeyHandler(config, logger); err == nil {
+		t.Error("Expected an error without a key")
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// Error codes used in API error responses
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeInvalidCursor    = "invalid_cursor"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeUnsupportedAPI   = "unsupported_api_version"
+	ErrCodeVehicleError     = "vehicle_error"
+	ErrCodeInternal         = "internal_error"
+	ErrCodeCommandVetoed    = "command_vetoed"
+	ErrCodeConditionsNotMet = "conditions_not_met"
+	ErrCodeTooManyRequests  = "too_many_requests"
+	ErrCodeVehicleAsleep    = "vehicle_asleep"
+	ErrCodeNotConnected     = "not_connected"
+	ErrCodeTimeout          = "timeout"
+	ErrCodeCircuitOpen      = "circuit_open"
+)
+
+// vehicleErrors classifies the errors of vehicle commands, in the order
+// they're checked: a command that ran out of retries is classified by the
+// error of its last attempt. Their messages are fixed, so a response never
+// carries an internal error string.
+var vehicleErrors = []struct {
+	targets []error
+	status  int
+	code    string
+	message string
+}{
+	{[]error{tesla.ErrCircuitOpen}, http.StatusServiceUnavailable, ErrCodeCircuitOpen,
+		"Calls to the vehicle are paused after repeated failures"},
+	{[]error{protocol.ErrKeyNotPaired, protocol.ErrRequiresKey, tesla.ErrPassphraseRequired, tesla.ErrNoRefreshToken}, http.StatusForbidden, ErrCodeUnauthorized,
+		"The vehicle did not accept the server's key or token"},
+	{[]error{tesla.ErrWakeTimeout}, http.StatusServiceUnavailable, ErrCodeVehicleAsleep,
+		"The vehicle is asleep and did not wake in time"},
+	{[]error{tesla.ErrOperationTimeout, context.DeadlineExceeded}, http.StatusGatewayTimeout, ErrCodeTimeout,
+		"The vehicle did not respond in time"},
+	{[]error{tesla.ErrNotConnected, tesla.ErrConnectionLost, protocol.ErrNotConnected}, http.StatusServiceUnavailable, ErrCodeNotConnected,
+		"Not connected to the vehicle"},
+}
+
+// Envelope is the common shape of every API response. Successful responses
+// carry Data (and optionally Meta); failed responses carry Errors. Status and
+// Message are kept for compatibility with clients of the original API.
+type Envelope struct {
+	Status  string      `json:"status"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    *Meta       `json:"meta,omitempty"`
+	Errors  []APIError  `json:"errors,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// Meta holds response metadata such as pagination state
+type Meta struct {
+	Timestamp  string `json:"timestamp"`
+	Count      *int   `json:"count,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more,omitempty"`
+}
+
+// APIError describes a single error in an API response
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// newMeta creates response metadata stamped with the current time
+func newMeta() *Meta {
+	return &Meta{Timestamp: time.Now().Format(time.RFC3339)}
+}
+
+// writeEnvelope writes an envelope as JSON with the given status code
+func writeEnvelope(w http.ResponseWriter, status int, env Envelope) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(env)
+}
+
+// writeData writes a successful response carrying data
+func writeData(w http.ResponseWriter, status int, data interface{}) {
+	writeEnvelope(w, status, Envelope{
+		Status: "ok",
+		Data:   data,
+		Meta:   newMeta(),
+	})
+}
+
+// writeMessage writes a successful response carrying only a message
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	writeEnvelope(w, status, Envelope{
+		Status:  "ok",
+		Meta:    newMeta(),
+		Message: message,
+	})
+}
+
+// writeError writes a failed response with a single error
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeErrorDetails(w, status, code, message, nil)
+}
+
+// writeErrorDetails writes a failed response with a single error and
+// additional machine-readable details
+func writeErrorDetails(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	writeEnvelope(w, status, Envelope{
+		Status:  "error",
+		Meta:    newMeta(),
+		Errors:  []APIError{{Code: code, Message: message, Details: details}},
+		Message: message,
+	})
+}
+
+// writeCommandError writes the response for a failed vehicle command.
+// Commands rejected by a command hook are a conflict with local policy, not
+// a vehicle failure, as are commands skipped by their charge conditions.
+func writeCommandError(w http.ResponseWriter, err error) {
+	writeCommandErrorDetails(w, err, nil)
+}
+
+// writeCommandErrorDetails writes the response for a failed vehicle command
+// with additional machine-readable details
+func writeCommandErrorDetails(w http.ResponseWriter, err error, details interface{}) {
+	status, code, message := classifyCommandError(err)
+	if code == ErrCodeTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeErrorDetails(w, status, code, message, details)
+}
+
+// classifyCommandError returns the status, code and message that report a
+// failed vehicle command. Errors vehicleErrors doesn't classify are
+// vehicle_error with a generic message; callers log the error itself.
+func classifyCommandError(err error) (status int, code, message string) {
+	if errors.Is(err, tesla.ErrCommandVetoed) {
+		return http.StatusConflict, ErrCodeCommandVetoed, err.Error()
+	}
+	if errors.Is(err, tesla.ErrClimateSkipped) {
+		return http.StatusConflict, ErrCodeConditionsNotMet, err.Error()
+	}
+	if errors.Is(err, tesla.ErrQueueFull) {
+		return http.StatusTooManyRequests, ErrCodeTooManyRequests, err.Error()
+	}
+	for _, class := range vehicleErrors {
+		for _, target := range class.targets {
+			if errors.Is(err, target) {
+				return class.status, class.code, class.message
+			}
+		}
+	}
+	return http.StatusInternalServerError, ErrCodeVehicleError, "The vehicle command failed"
+}
+
+// writeDataWithETag writes a successful response carrying data, tagged with
+// the given entity tag and encoded in the media type negotiated from the
+// request's Accept header. If the request's If-None-Match header matches the
+// tag a 304 Not Modified is written instead of the body.
+func writeDataWithETag(w http.ResponseWriter, r *http.Request, etag string, data interface{}) {
+	encoder := negotiateEncoder(r)
+	w.Header().Add("Vary", "Accept")
+
+	if etag != "" {
+		etag = encoder.representationETag(etag)
+		w.Header().Set("ETag", quoteETag(etag))
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	encoder.write(w, http.StatusOK, Envelope{
+		Status: "ok",
+		Data:   data,
+		Meta:   newMeta(),
+	})
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using weak comparison as required for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// baseETag strips representation suffixes (field selection, encoding) from an
+// entity tag, leaving the tag of the underlying entity
+func baseETag(etag string) string {
+	base, _, _ := strings.Cut(etag, "-")
+	return base
+}
+
+// quoteETag formats an entity tag for use in HTTP headers
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`"xyz"`, false},
+		{"*", true},
+	}
+
+	for _, test := range tests {
+		if got := etagMatches(test.header, "abc"); got != test.expected {
+			t.Errorf("If-None-Match %q: expected %v, got %v", test.header, test.expected, got)
+		}
+	}
+}
+
+func TestWriteDataWithETag(t *testing.T) {
+	req := httptest.NewRequest("GET", "/hvac/state", nil)
+	rec := httptest.NewRecorder()
+	writeDataWithETag(rec, req, "abc", map[string]bool{"is_on": true})
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("ETag") != `"abc"` {
+		t.Errorf("Expected ETag header, got %q", rec.Header().Get("ETag"))
+	}
+
+	req = httptest.NewRequest("GET", "/hvac/state", nil)
+	req.Header.Set("If-None-Match", `"abc"`)
+	rec = httptest.NewRecorder()
+	writeDataWithETag(rec, req, "abc", map[string]bool{"is_on": true})
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Error("Expected empty body for 304 response")
+	}
+}
+
+func TestWriteCommandErrorQueueFull(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeCommandError(rec, fmt.Errorf("get_hvac_state: %w", tesla.ErrQueueFull))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+}
+
+func TestWriteCommandErrorClassifies(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("%w: set_temperature failed after 4 attempts: %w", tesla.ErrRetryExhausted, tesla.ErrCircuitOpen), http.StatusServiceUnavailable, ErrCodeCircuitOpen},
+		{fmt.Errorf("%w: still asleep after 30s", tesla.ErrWakeTimeout), http.StatusServiceUnavailable, ErrCodeVehicleAsleep},
+		{fmt.Errorf("%w: EOF", tesla.ErrConnectionLost), http.StatusServiceUnavailable, ErrCodeNotConnected},
+		{tesla.ErrNotConnected, http.StatusServiceUnavailable, ErrCodeNotConnected},
+		{fmt.Errorf("get_hvac_state: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, ErrCodeTimeout},
+		{fmt.Errorf("start session: %w", protocol.ErrKeyNotPaired), http.StatusForbidden, ErrCodeUnauthorized},
+		{fmt.Errorf(`vehicle said "no"`), http.StatusInternalServerError, ErrCodeVehicleError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeCommandError(rec, tt.err)
+		var envelope Envelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("%v: invalid JSON %s: %v", tt.err, rec.Body.String(), err)
+		}
+		if rec.Code != tt.status || len(envelope.Errors) != 1 || envelope.Errors[0].Code != tt.code {
+			t.Errorf("%v: got %d %s, want %d %s", tt.err, rec.Code, rec.Body.String(), tt.status, tt.code)
+		}
+		// No response repeats the internal error
+		if strings.Contains(envelope.Message, tt.err.Error()) || strings.Contains(envelope.Errors[0].Message, tt.err.Error()) {
+			t.Errorf("%v: response leaks the error: %s", tt.err, rec.Body.String())
+		}
+	}
+}
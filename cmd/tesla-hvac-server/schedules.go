@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// scheduleRunTimeout bounds one run of a schedule, including waking the
+// vehicle and retries
+const scheduleRunTimeout = 3 * time.Minute
+
+// ScheduleHandler runs the climate schedules stored in the config file and
+// serves them: GET and POST /schedules, and GET, PUT and DELETE
+// /schedules/<name>
+type ScheduleHandler struct {
+	api           *APIHandler
+	configManager *tesla.ConfigManager
+	scheduler     *schedule.Scheduler
+	notifier      notify.Notifier // For schedules with notify set
+	logger        *log.Logger
+}
+
+// NewScheduleHandler creates a handler for the schedules in the config file.
+// With no config manager there are no schedules and none can be saved.
+func NewScheduleHandler(api *APIHandler, configManager *tesla.ConfigManager, logger *log.Logger) *ScheduleHandler {
+	h := &ScheduleHandler{
+		api:           api,
+		configManager: configManager,
+		logger:        logger,
+	}
+	h.scheduler = schedule.New(h.schedules, h.run, logger)
+
+	// Pick up schedules saved through the API or edited in the file
+	if configManager != nil {
+		configManager.RegisterCallback(func(oldConfig, newConfig *tesla.Config) error {
+			h.scheduler.Reload()
+			return nil
+		})
+	}
+	return h
+}
+
+// Start runs the scheduler under the supervisor
+func (h *ScheduleHandler) Start(supervisor *tesla.Supervisor) error {
+	return supervisor.Add("schedules", h.scheduler.Run)
+}
+
+// schedules returns the configured schedules
+func (h *ScheduleHandler) schedules() []schedule.Schedule {
+	if h.configManager == nil {
+		return nil
+	}
+	return h.configManager.GetConfig().Schedules
+}
+
+// find returns the schedule with the given name
+func (h *ScheduleHandler) find(name string) (schedule.Schedule, bool) {
+	for _, s := range h.schedules() {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return schedule.Schedule{}, false
+}
+
+// run carries out a schedule's action, notifying of the outcome if the
+// schedule asks for it
+func (h *ScheduleHandler) run(ctx context.Context, s schedule.Schedule) error {
+	err := h.action(ctx, s)
+	if s.Notify && h.notifier != nil {
+		msg := notify.Message{Title: fmt.Sprintf("Schedule %s ran", s.Name), Body: fmt.Sprintf("%s succeeded.", s.Action)}
+		if err != nil {
+			msg = notify.Message{Title: fmt.Sprintf("Schedule %s failed", s.Name), Body: fmt.Sprintf("%s failed: %v", s.Action, err), Priority: notify.PriorityHigh}
+		}
+		sendNotification(h.notifier, h.logger, msg)
+	}
+	return err
+}
+
+// action carries out a schedule's action on its vehicle
+func (h *ScheduleHandler) action(ctx context.Context, s schedule.Schedule) error {
+	client, err := h.api.vehicle(s.VIN)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, scheduleRunTimeout)
+	defer cancel()
+
+	switch s.Action {
+	case schedule.ActionClimateOn:
+		return client.SetClimateOn(ctx)
+	case schedule.ActionClimateOff:
+		return client.SetClimateOff(ctx)
+	case schedule.ActionPrecondition:
+		if s.Temperature != nil {
+			if err := client.SetTemperature(ctx, *s.Temperature, *s.Temperature); err != nil {
+				return err
+			}
+		}
+		return client.SetClimateOn(ctx)
+	case schedule.ActionPreset:
+		preset, ok := h.configManager.GetConfig().FindPreset(s.Preset)
+		if !ok {
+			return fmt.Errorf("unknown preset %q", s.Preset)
+		}
+		return client.ApplyPreset(ctx, preset)
+	default:
+		return fmt.Errorf("unknown action %q", s.Action)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *ScheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/schedules"), "/")
+
+	switch {
+	case name == "" && r.Method == "GET":
+		writeList(w, r, h.scheduler.Status(), func(status schedule.Status) string { return status.Name })
+	case name == "" && r.Method == "POST":
+		var s schedule.Schedule
+		if err := parseJSON(w, r, &s); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if _, ok := h.find(s.Name); ok {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRequest, "Schedule already exists")
+			return
+		}
+		h.save(w, s, http.StatusCreated)
+	case name == "":
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	case strings.Contains(name, "/"):
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+	case r.Method == "GET":
+		for _, status := range h.scheduler.Status() {
+			if status.Name == name {
+				writeData(w, http.StatusOK, status)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Schedule not found")
+	case r.Method == "PUT":
+		var s schedule.Schedule
+		if err := parseJSON(w, r, &s); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		s.Name = name
+		status := http.StatusOK
+		if _, ok := h.find(name); !ok {
+			status = http.StatusCreated
+		}
+		h.save(w, s, status)
+	case r.Method == "DELETE":
+		h.delete(w, name)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// save validates a schedule and writes it to the config file, replacing the
+// schedule of the same name if there is one
+func (h *ScheduleHandler) save(w http.ResponseWriter, s schedule.Schedule, status int) {
+	if h.configManager == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Schedules need a config file")
+		return
+	}
+	if err := s.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if s.Action == schedule.ActionPreset {
+		if _, ok := h.configManager.GetConfig().FindPreset(s.Preset); !ok {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Unknown preset %q", s.Preset))
+			return
+		}
+	}
+	if _, err := h.api.vehicle(s.VIN); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	err := h.configManager.UpdateConfig(func(config *tesla.Config) {
+		schedules := make([]schedule.Schedule, 0, len(config.Schedules)+1)
+		replaced := false
+		for _, existing := range config.Schedules {
+			if existing.Name == s.Name {
+				existing = s
+				replaced = true
+			}
+			schedules = append(schedules, existing)
+		}
+		if !replaced {
+			schedules = append(schedules, s)
+		}
+		config.Schedules = schedules
+	})
+	if err != nil {
+		h.logger.Printf("Failed to save schedule %s: %v", s.Name, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save schedules")
+		return
+	}
+	h.logger.Printf("Schedule %s saved", s.Name)
+	writeData(w, status, s)
+}
+
+// delete removes a schedule from the config file
+func (h *ScheduleHandler) delete(w http.ResponseWriter, name string) {
+	if _, ok := h.find(name); !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Schedule not found")
+		return
+	}
+
+	err := h.configManager.UpdateConfig(func(config *tesla.Config) {
+		schedules := make([]schedule.Schedule, 0, len(config.Schedules))
+		for _, s := range config.Schedules {
+			if s.Name != name {
+				schedules = append(schedules, s)
+			}
+		}
+		config.Schedules = schedules
+	})
+	if err != nil {
+		h.logger.Printf("Failed to delete schedule %s: %v", name, err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save schedules")
+		return
+	}
+	h.logger.Printf("Schedule %s deleted", name)
+	writeMessage(w, http.StatusOK, "Schedule deleted")
+}
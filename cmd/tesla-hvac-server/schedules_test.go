@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// newTestScheduleHandler serves schedules and presets from a temporary
+// config file
+func newTestScheduleHandler(t *testing.T) (*APIHandler, *ScheduleHandler, *tesla.ConfigManager) {
+	t.Helper()
+
+	api, configManager := newTestPresetHandler(t)
+	schedules := NewScheduleHandler(api, configManager, log.New(io.Discard, "", 0))
+	api.Mount("/schedules", schedules)
+	return api, schedules, configManager
+}
+
+func TestScheduleCRUD(t *testing.T) {
+	api, _, configManager := newTestScheduleHandler(t)
+
+	rec := servePreset(api, "POST", "/schedules", `{"name": "morning", "action": "climate_on", "at": "06:45", "days": ["weekdays"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := servePreset(api, "POST", "/schedules", `{"name": "morning", "action": "climate_off", "at": "07:30"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate, got %d", rec.Code)
+	}
+
+	// The schedule is saved to the config file
+	reloaded, err := tesla.LoadConfig(configManager.GetConfig().ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Schedules) != 1 || reloaded.Schedules[0].At != "06:45" {
+		t.Errorf("Expected the schedule in the config file, got %+v", reloaded.Schedules)
+	}
+
+	rec = servePreset(api, "GET", "/schedules/morning", "")
+	var env struct {
+		Data schedule.Status `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if env.Data.Action != schedule.ActionClimateOn || env.Data.NextRun.IsZero() {
+		t.Errorf("Expected the schedule with its next run, got %+v", env.Data)
+	}
+
+	rec = servePreset(api, "PUT", "/schedules/morning", `{"action": "precondition", "temperature": 21, "at": "06:30"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = servePreset(api, "GET", "/schedules", "")
+	if !strings.Contains(rec.Body.String(), `"action":"precondition"`) || !strings.Contains(rec.Body.String(), `"at":"06:30"`) {
+		t.Errorf("Expected PUT to replace the schedule, got %s", rec.Body.String())
+	}
+
+	// The list is paginated in name order
+	servePreset(api, "POST", "/schedules", `{"name": "evening", "action": "climate_off", "at": "20:00"}`)
+	rec = servePreset(api, "GET", "/schedules?limit=1", "")
+	var page struct {
+		Data []schedule.Status `json:"data"`
+		Meta Meta              `json:"meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(page.Data) != 1 || page.Data[0].Name != "evening" || !page.Meta.HasMore {
+		t.Errorf("Expected the first schedule by name and more to come, got %s", rec.Body.String())
+	}
+	servePreset(api, "DELETE", "/schedules/evening", "")
+
+	if rec := servePreset(api, "DELETE", "/schedules/morning", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+	if rec := servePreset(api, "GET", "/schedules/morning", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	api, _, _ := newTestScheduleHandler(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"bad time", `{"name": "morning", "action": "climate_on", "at": "6:45am"}`},
+		{"bad day", `{"name": "morning", "action": "climate_on", "at": "06:45", "days": ["someday"]}`},
+		{"unknown action", `{"name": "morning", "action": "honk", "at": "06:45"}`},
+		{"unknown preset", `{"name": "morning", "action": "preset", "preset": "missing", "at": "06:45"}`},
+		{"unknown vehicle", `{"name": "morning", "action": "climate_on", "at": "06:45", "vin": "OTHER_VIN"}`},
+	}
+	for _, tt := range tests {
+		if rec := servePreset(api, "POST", "/schedules", tt.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tt.name, rec.Code)
+		}
+	}
+}
+
+func TestSchedulePresetInUse(t *testing.T) {
+	api, _, _ := newTestScheduleHandler(t)
+	servePreset(api, "POST", "/presets", `{"name": "cool", "fan_speed": 5}`)
+
+	rec := servePreset(api, "POST", "/schedules", `{"name": "evening", "action": "preset", "preset": "cool", "at": "18:00"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := servePreset(api, "DELETE", "/presets/cool", ""); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 deleting a preset a schedule uses, got %d", rec.Code)
+	}
+}
+
+func TestScheduleRun(t *testing.T) {
+	_, schedules, _ := newTestScheduleHandler(t)
+	ctx := context.Background()
+
+	// The vehicle isn't connected
+	if err := schedules.run(ctx, schedule.Schedule{Name: "morning", Action: schedule.ActionClimateOn, At: "06:45"}); err == nil {
+		t.Error("Expected the run to fail when not connected")
+	}
+	if err := schedules.run(ctx, schedule.Schedule{Name: "evening", Action: schedule.ActionPreset, Preset: "missing", At: "18:00"}); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+	if err := schedules.run(ctx, schedule.Schedule{Name: "other", Action: schedule.ActionClimateOn, At: "06:45", VIN: "OTHER_VIN"}); err == nil {
+		t.Error("Expected an error for an unknown vehicle")
+	}
+}
+
+// chanNotifier hands notifications to a channel
+type chanNotifier chan notify.Message
+
+func (c chanNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	c <- msg
+	return nil
+}
+
+func TestScheduleRunNotifies(t *testing.T) {
+	_, schedules, _ := newTestScheduleHandler(t)
+	sent := make(chanNotifier, 1)
+	schedules.notifier = sent
+
+	schedules.run(context.Background(), schedule.Schedule{Name: "quiet", Action: schedule.ActionClimateOn, At: "06:45"})
+	schedules.run(context.Background(), schedule.Schedule{Name: "morning", Action: schedule.ActionClimateOn, At: "06:45", Notify: true})
+	select {
+	case msg := <-sent:
+		if msg.Title != "Schedule morning failed" || msg.Priority != notify.PriorityHigh {
+			t.Errorf("Unexpected notification %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a notification of the failed run")
+	}
+	select {
+	case msg := <-sent:
+		t.Errorf("Unexpected notification %+v for a schedule without notify", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSchedulesWithoutConfig(t *testing.T) {
+	api := newTestAPIHandler()
+	api.Mount("/schedules", NewScheduleHandler(api, nil, log.New(io.Discard, "", 0)))
+
+	rec := servePreset(api, "GET", "/schedules", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"data":[]`) {
+		t.Errorf("Expected an empty list, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := servePreset(api, "POST", "/schedules", `{"name": "morning", "action": "climate_on", "at": "06:45"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a config file, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/script"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const (
+	// scriptLoadTimeout bounds running a script's top-level code
+	scriptLoadTimeout = 5 * time.Second
+
+	// scriptHookTimeout bounds an event hook, including commands it issues
+	scriptHookTimeout = 30 * time.Second
+
+	// scriptEventBuffer is the event buffer per vehicle subscription
+	scriptEventBuffer = 32
+)
+
+// Script hook function names
+const (
+	hookOnConnect     = "on_connect"
+	hookBeforeCommand = "before_command"
+	hookOnStateChange = "on_state_change"
+	hookOnSkipped     = "on_climate_skipped"
+)
+
+// scriptCallerKey marks contexts of commands issued by scripts, so they don't
+// re-enter before_command hooks
+type scriptCallerKey struct{}
+
+// userScript is a loaded script. Its state is not safe for concurrent use, so
+// every call holds mu.
+type userScript struct {
+	name  string
+	mu    sync.Mutex
+	state *script.State
+
+	// vin is the vehicle the current hook is running for
+	vin string
+}
+
+// ScriptManager runs user scripts in response to vehicle events and before
+// commands are sent. Scripts are written in a sandboxed Lua subset and can
+// only read state and issue commands through the vehicle API it provides.
+type ScriptManager struct {
+	api        *APIHandler
+	supervisor *tesla.Supervisor
+	logger     *log.Logger
+
+	scripts []*userScript
+}
+
+// NewScriptManager creates a new script manager
+func NewScriptManager(api *APIHandler, supervisor *tesla.Supervisor, logger *log.Logger) *ScriptManager {
+	return &ScriptManager{
+		api:        api,
+		supervisor: supervisor,
+		logger:     logger,
+	}
+}
+
+// LoadDir loads every *.lua file in dir in name order, then registers the
+// command hook and the event subsystem. A script that fails to load is an
+// error, so typos are caught at startup.
+func (m *ScriptManager) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return fmt.Errorf("failed to read script directory: %w", err)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read script: %w", err)
+		}
+		if err := m.Load(filepath.Base(path), string(src)); err != nil {
+			return err
+		}
+		m.logger.Printf("Loaded script %s", path)
+	}
+
+	if len(m.scripts) == 0 {
+		return nil
+	}
+
+	for _, client := range m.api.vehicles() {
+		client.AddCommandHook(m.beforeCommand)
+	}
+	return m.supervisor.Add("scripts", m.run)
+}
+
+// Load runs a script's top-level code, which defines its hook functions
+func (m *ScriptManager) Load(name, src string) error {
+	s := &userScript{name: name, state: script.NewState(name, script.Options{})}
+	s.state.SetPrint(func(message string) {
+		m.logger.Printf("[script %s] %s", name, message)
+	})
+	s.state.SetGlobal("log", s.state.Global("print"))
+	s.state.SetGlobal("vehicle", m.vehicleAPI(s))
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptLoadTimeout)
+	defer cancel()
+
+	if _, err := s.state.DoString(withScriptCaller(ctx), src); err != nil {
+		return fmt.Errorf("failed to load script %s: %w", name, err)
+	}
+
+	m.scripts = append(m.scripts, s)
+	return nil
+}
+
+// run delivers vehicle events to script hooks until ctx is done
+func (m *ScriptManager) run(ctx context.Context) error {
+	merged := make(chan tesla.Event, scriptEventBuffer)
+	for _, client := range m.api.vehicles() {
+		events, unsubscribe := client.Events().Subscribe(scriptEventBuffer)
+		defer unsubscribe()
+
+		go func() {
+			for event := range events {
+				select {
+				case merged <- event:
+				default:
+					// Hooks are too slow; drop the event rather than block
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-merged:
+			m.dispatch(ctx, event)
+		}
+	}
+}
+
+// dispatch calls the hook for an event in every script that defines it
+func (m *ScriptManager) dispatch(ctx context.Context, event tesla.Event) {
+	var hook string
+	var arg script.Value
+	switch event.Type {
+	case tesla.EventConnected:
+		hook = hookOnConnect
+		arg = eventTable(event)
+	case tesla.EventClimateSkipped:
+		skip, ok := event.Data.(tesla.ClimateSkip)
+		if !ok {
+			return
+		}
+		value, err := script.ToValue(skip)
+		if err != nil {
+			return
+		}
+		hook, arg = hookOnSkipped, value
+	case tesla.EventStateChanged:
+		state, ok := event.Data.(tesla.HVACState)
+		if !ok {
+			return
+		}
+		value, err := script.ToValue(displayState(&state))
+		if err != nil {
+			return
+		}
+		hook, arg = hookOnStateChange, value
+	default:
+		return
+	}
+
+	hookCtx, cancel := context.WithTimeout(withScriptCaller(ctx), scriptHookTimeout)
+	defer cancel()
+
+	for _, s := range m.scripts {
+		if _, err := s.call(hookCtx, hook, event.VIN, arg); err != nil {
+			m.logger.Printf("Script %s failed in %s: %v", s.name, hook, err)
+		}
+	}
+}
+
+// beforeCommand is the client command hook. A before_command hook vetoes a
+// command by returning false or a reason string. Script errors are logged
+// and don't block the command, so a broken script can't lock out control.
+func (m *ScriptManager) beforeCommand(ctx context.Context, cmd tesla.Command) error {
+	if ctx.Value(scriptCallerKey{}) != nil {
+		return nil
+	}
+
+	arg := script.NewTable()
+	arg.Set("name", cmd.Name)
+	arg.Set("vin", cmd.VIN)
+	args, err := script.ToValue(commandDisplayArgs(cmd))
+	if err == nil {
+		arg.Set("args", args)
+	}
+
+	for _, s := range m.scripts {
+		result, err := s.call(withScriptCaller(ctx), hookBeforeCommand, cmd.VIN, arg)
+		if err != nil {
+			m.logger.Printf("Script %s failed in %s: %v", s.name, hookBeforeCommand, err)
+			continue
+		}
+
+		switch result := result.(type) {
+		case bool:
+			if !result {
+				return fmt.Errorf("%w by script %s", tesla.ErrCommandVetoed, s.name)
+			}
+		case string:
+			return fmt.Errorf("%w by script %s: %s", tesla.ErrCommandVetoed, s.name, result)
+		}
+	}
+	return nil
+}
+
+// call runs a hook for a vehicle. Scripts that don't define the hook return nil.
+func (s *userScript) call(ctx context.Context, hook, vin string, args ...script.Value) (script.Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn := s.state.Global(hook)
+	if fn == nil {
+		return nil, nil
+	}
+
+	s.vin = vin
+	defer func() { s.vin = "" }()
+	return s.state.Call(ctx, fn, args...)
+}
+
+// vehicleAPI builds the vehicle table exposed to a script. Functions act on
+// the vehicle the running hook was called for, or the only vehicle when run
+// outside a hook. Temperatures are in Fahrenheit, as in the HTTP API.
+// climate_on takes optional charge conditions, e.g.
+// {min_battery_level = 40, skip_if_unplugged = true}, and returns false if
+// they skipped the command.
+//
+//	vehicle.vin()
+//	vehicle.state()                        -- reads from the vehicle
+//	vehicle.last_state()                   -- last read state, or nil
+//	vehicle.set_temperature(driver[, passenger])
+//	vehicle.charge_state()                 -- reads from the vehicle
+//	vehicle.climate_on([conditions]), vehicle.climate_off()
+//	vehicle.set_fan_speed(speed)
+//	vehicle.set_auto_mode(enabled)
+func (m *ScriptManager) vehicleAPI(s *userScript) *script.Table {
+	api := script.NewTable()
+
+	// command wraps a function that needs the current client
+	command := func(fn func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error)) script.GoFunction {
+		return func(args []script.Value) (script.Value, error) {
+			client, err := m.api.vehicle(s.vin)
+			if err != nil {
+				return nil, err
+			}
+			return fn(s.state.Context(), client, args)
+		}
+	}
+
+	api.Set("vin", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		return client.GetVIN(), nil
+	}))
+	api.Set("state", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		state, err := client.GetHVACState(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return script.ToValue(displayState(state))
+	}))
+	api.Set("last_state", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		snapshot, ok := client.LastState()
+		if !ok {
+			return nil, nil
+		}
+		return script.ToValue(displayState(snapshot.State))
+	}))
+	api.Set("set_temperature", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		driver, err := script.NumberArg(args, 0, "set_temperature")
+		if err != nil {
+			return nil, err
+		}
+		passenger := driver
+		if len(args) > 1 {
+			if passenger, err = script.NumberArg(args, 1, "set_temperature"); err != nil {
+				return nil, err
+			}
+		}
+		return nil, client.SetTemperature(ctx, float32(fahrenheitToCelsius(driver)), float32(fahrenheitToCelsius(passenger)))
+	}))
+	api.Set("charge_state", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		state, err := client.GetChargeState(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return script.ToValue(state)
+	}))
+	api.Set("climate_on", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		cond, err := climateConditionsArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = client.SetClimateOnIf(ctx, cond)
+		if errors.Is(err, tesla.ErrClimateSkipped) {
+			return false, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return true, nil
+	}))
+	api.Set("climate_off", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		return nil, client.SetClimateOff(ctx)
+	}))
+	api.Set("set_fan_speed", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		speed, err := script.NumberArg(args, 0, "set_fan_speed")
+		if err != nil {
+			return nil, err
+		}
+		return nil, client.SetFanSpeed(ctx, tesla.FanSpeed(speed))
+	}))
+	api.Set("set_auto_mode", command(func(ctx context.Context, client *tesla.Client, args []script.Value) (script.Value, error) {
+		return nil, client.SetAutoMode(ctx, script.BoolArg(args, 0))
+	}))
+
+	return api
+}
+
+// climateConditionsArg reads optional charge conditions from a table argument
+func climateConditionsArg(args []script.Value, i int) (tesla.ClimateConditions, error) {
+	var cond tesla.ClimateConditions
+	if i >= len(args) || args[i] == nil {
+		return cond, nil
+	}
+	if _, ok := args[i].(*script.Table); !ok {
+		return cond, fmt.Errorf("climate_on: conditions must be a table")
+	}
+
+	data, err := json.Marshal(script.FromValue(args[i]))
+	if err != nil {
+		return cond, fmt.Errorf("climate_on: %w", err)
+	}
+	if err := json.Unmarshal(data, &cond); err != nil {
+		return cond, fmt.Errorf("climate_on: invalid conditions: %w", err)
+	}
+	if err := cond.Validate(); err != nil {
+		return cond, fmt.Errorf("climate_on: %w", err)
+	}
+	return cond, nil
+}
+
+// withScriptCaller marks ctx as belonging to a script
+func withScriptCaller(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scriptCallerKey{}, true)
+}
+
+// eventTable converts an event to a script table
+func eventTable(event tesla.Event) *script.Table {
+	t := script.NewTable()
+	t.Set("type", string(event.Type))
+	t.Set("vin", event.VIN)
+	t.Set("timestamp", event.Timestamp.Format(time.RFC3339))
+	return t
+}
+
+// commandDisplayArgs returns a command's arguments with temperatures
+// converted to Fahrenheit, matching the rest of the script API
+func commandDisplayArgs(cmd tesla.Command) map[string]interface{} {
+	args := make(map[string]interface{}, len(cmd.Args))
+	for key, value := range cmd.Args {
+		if celsius, ok := value.(float32); ok && strings.HasSuffix(key, "_temp") {
+			value = celsiusToFahrenheit(float64(celsius))
+		}
+		args[key] = value
+	}
+	return args
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/script"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// testHookScript caps the temperature and records the hooks it sees
+const testHookScript = `
+local max_temp = 80
+
+function before_command(cmd)
+  if cmd.name == "set_temperature" and cmd.args.driver_temp > max_temp then
+    return "driver temperature above " .. max_temp
+  end
+end
+
+function on_connect(event)
+  log("connected", event.vin)
+  -- Commands issued by scripts skip before_command, so this reaches the client
+  vehicle.set_temperature(90)
+end
+
+function on_state_change(state)
+  log(string.format("state %s %.0f", tostring(state.is_on), state.driver_temp_celsius))
+end
+`
+
+// newTestScriptManager loads the given scripts from a temporary directory
+func newTestScriptManager(t *testing.T, scripts map[string]string) (*ScriptManager, *APIHandler, *bytes.Buffer) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var output bytes.Buffer
+	api := newTestAPIHandler()
+	manager := NewScriptManager(api, tesla.NewSupervisor(nil), log.New(&output, "", 0))
+	if err := manager.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	return manager, api, &output
+}
+
+func TestScriptBeforeCommandVeto(t *testing.T) {
+	_, api, _ := newTestScriptManager(t, map[string]string{"limits.lua": testHookScript})
+	client := api.vehicles()[0]
+
+	// 30°C is 86°F, above the script's limit
+	err := client.SetTemperature(context.Background(), 30, 30)
+	if !errors.Is(err, tesla.ErrCommandVetoed) {
+		t.Fatalf("Expected veto, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "limits.lua: driver temperature above 80") {
+		t.Errorf("Expected veto reason in error, got %v", err)
+	}
+
+	// Allowed commands proceed to the client, which isn't connected
+	if err := client.SetTemperature(context.Background(), 21, 21); !errors.Is(err, tesla.ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestScriptVetoHTTPStatus(t *testing.T) {
+	_, api, _ := newTestScriptManager(t, map[string]string{
+		"readonly.lua": `function before_command(cmd) return false end`,
+	})
+
+	req := httptest.NewRequest("POST", "/hvac/climate", strings.NewReader(`{"on": true}`))
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), ErrCodeCommandVetoed) {
+		t.Errorf("Expected %s error code, got %s", ErrCodeCommandVetoed, w.Body.String())
+	}
+}
+
+func TestScriptEventHooks(t *testing.T) {
+	manager, _, output := newTestScriptManager(t, map[string]string{"limits.lua": testHookScript})
+	ctx := context.Background()
+
+	manager.dispatch(ctx, tesla.Event{Type: tesla.EventConnected, VIN: "TEST_VIN"})
+	logged := output.String()
+	if !strings.Contains(logged, "[script limits.lua] connected\tTEST_VIN") {
+		t.Errorf("Expected on_connect output, got %q", logged)
+	}
+	// The hook's own command isn't vetoed; it fails because there's no vehicle
+	if !strings.Contains(logged, "not connected to vehicle") || strings.Contains(logged, "vetoed") {
+		t.Errorf("Expected script command to bypass before_command, got %q", logged)
+	}
+
+	output.Reset()
+	manager.dispatch(ctx, tesla.Event{
+		Type: tesla.EventStateChanged,
+		VIN:  "TEST_VIN",
+		Data: tesla.HVACState{IsOn: true, DriverTempCelsius: 20},
+	})
+	if !strings.Contains(output.String(), "state true 68") {
+		t.Errorf("Expected on_state_change output in Fahrenheit, got %q", output.String())
+	}
+}
+
+func TestScriptClimateSkippedHook(t *testing.T) {
+	manager, _, output := newTestScriptManager(t, map[string]string{
+		"notify.lua": `
+function on_climate_skipped(skip)
+  log(skip.command, skip.reason, skip.charge_state.battery_level)
+end
+`,
+	})
+
+	manager.dispatch(context.Background(), tesla.Event{
+		Type: tesla.EventClimateSkipped,
+		VIN:  "TEST_VIN",
+		Data: tesla.ClimateSkip{
+			Command:     "set_climate_on",
+			Reason:      "vehicle is not plugged in",
+			Conditions:  tesla.ClimateConditions{SkipIfUnplugged: true},
+			ChargeState: tesla.ChargeState{BatteryLevel: 42},
+		},
+	})
+	if !strings.Contains(output.String(), "set_climate_on\tvehicle is not plugged in\t42") {
+		t.Errorf("Expected on_climate_skipped output, got %q", output.String())
+	}
+}
+
+func TestScriptClimateConditionsArg(t *testing.T) {
+	table := script.NewTable()
+	table.Set("min_battery_level", 40.0)
+	table.Set("skip_if_unplugged", true)
+
+	cond, err := climateConditionsArg([]script.Value{table}, 0)
+	if err != nil {
+		t.Fatalf("climateConditionsArg failed: %v", err)
+	}
+	if cond.MinBatteryLevel != 40 || !cond.SkipIfUnplugged {
+		t.Errorf("Unexpected conditions: %+v", cond)
+	}
+
+	if cond, err := climateConditionsArg(nil, 0); err != nil || !cond.IsZero() {
+		t.Errorf("Expected no conditions without an argument, got %+v, %v", cond, err)
+	}
+
+	table.Set("min_battery_level", 150.0)
+	if _, err := climateConditionsArg([]script.Value{table}, 0); err == nil {
+		t.Error("Expected error for out of range min_battery_level")
+	}
+}
+
+func TestScriptErrorsDontBlockCommands(t *testing.T) {
+	_, api, output := newTestScriptManager(t, map[string]string{
+		"broken.lua": `function before_command(cmd) return cmd.args.missing.field end`,
+	})
+
+	err := api.vehicles()[0].SetClimateOn(context.Background())
+	if !errors.Is(err, tesla.ErrNotConnected) {
+		t.Errorf("Expected command to proceed past a failing script, got %v", err)
+	}
+	if !strings.Contains(output.String(), "broken.lua:1: attempt to index a nil value") {
+		t.Errorf("Expected script error to be logged, got %q", output.String())
+	}
+}
+
+func TestScriptLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.lua"), []byte("function broken(\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewScriptManager(newTestAPIHandler(), tesla.NewSupervisor(nil), log.New(io.Discard, "", 0))
+	err := manager.LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "bad.lua") {
+		t.Errorf("Expected load error naming the script, got %v", err)
+	}
+}
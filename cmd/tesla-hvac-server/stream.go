@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/profile"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/websocket"
+)
+
+const (
+	// streamSendBuffer is how many messages may queue for a client before
+	// it is disconnected as too slow
+	streamSendBuffer = 32
+	// streamPingInterval is how often idle clients are pinged
+	streamPingInterval = 30 * time.Second
+	// streamWriteTimeout bounds each write to a client
+	streamWriteTimeout = 10 * time.Second
+	// streamRefreshDelay is how long after a command the state is re-read,
+	// so a burst of commands costs one read
+	streamRefreshDelay = time.Second
+)
+
+// streamEventTypes are the events clients may subscribe to
+var streamEventTypes = map[tesla.EventType]bool{
+	tesla.EventStateUpdated:        true,
+	tesla.EventStateChanged:        true,
+	tesla.EventConnected:           true,
+	tesla.EventDisconnected:        true,
+	tesla.EventAwakeChanged:        true,
+	tesla.EventClimateSkipped:      true,
+	tesla.EventCommandSent:         true,
+	tesla.EventConnectionState:     true,
+	tesla.EventCircuitStateChanged: true,
+}
+
+// StreamHub pushes vehicle events to WebSocket clients at /ws. Clients get
+// state_changed events by default and can change their subscription by
+// sending {"subscribe": [...]}, {"unsubscribe": [...]} or {"vins": [...]}.
+// After a command succeeds and clients are connected, the hub re-reads the
+// vehicle's state so they see the change without polling.
+type StreamHub struct {
+	api          *APIHandler
+	logger       *log.Logger
+	refreshDelay time.Duration
+
+	mu        sync.Mutex
+	clients   map[*streamClient]struct{}
+	refreshes map[string]*time.Timer
+}
+
+// streamClient is one WebSocket connection and its subscription
+type streamClient struct {
+	conn *websocket.Conn
+	send chan []byte
+	unit profile.Unit
+
+	mu     sync.Mutex
+	events map[tesla.EventType]bool
+	vins   map[string]bool // All vehicles if empty
+}
+
+// streamRequest is a subscription change sent by a client
+type streamRequest struct {
+	Subscribe   []tesla.EventType `json:"subscribe,omitempty"`
+	Unsubscribe []tesla.EventType `json:"unsubscribe,omitempty"`
+	VINs        *[]string         `json:"vins,omitempty"`
+}
+
+// NewStreamHub creates a hub for the handler's vehicles
+func NewStreamHub(api *APIHandler, logger *log.Logger) *StreamHub {
+	return &StreamHub{
+		api:          api,
+		logger:       logger,
+		refreshDelay: streamRefreshDelay,
+		clients:      make(map[*streamClient]struct{}),
+		refreshes:    make(map[string]*time.Timer),
+	}
+}
+
+// ClientCount returns the number of connected clients
+func (h *StreamHub) ClientCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Run forwards vehicle events to clients until ctx is done
+func (h *StreamHub) Run(ctx context.Context) error {
+	events := make(chan tesla.Event, streamSendBuffer)
+	for _, client := range h.api.vehicles() {
+		ch, unsubscribe := client.Events().Subscribe(streamSendBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range ch {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return nil
+		case event := <-events:
+			h.dispatch(event)
+		}
+	}
+}
+
+// dispatch sends an event to the clients subscribed to it
+func (h *StreamHub) dispatch(event tesla.Event) {
+	if event.Type == tesla.EventCommandSent {
+		h.scheduleRefresh(event.VIN)
+	}
+
+	// Encode once per temperature unit
+	encoded := make(map[profile.Unit][]byte)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if !client.wants(event) {
+			continue
+		}
+		message, ok := encoded[client.unit]
+		if !ok {
+			var err error
+			if message, err = encodeStreamEvent(event, client.unit); err != nil {
+				h.logger.Printf("Failed to encode %s event: %v", event.Type, err)
+				continue
+			}
+			encoded[client.unit] = message
+		}
+
+		select {
+		case client.send <- message:
+		default:
+			h.logger.Printf("Dropping slow WebSocket client")
+			h.removeLocked(client)
+		}
+	}
+}
+
+// encodeStreamEvent encodes an event, converting state temperatures to unit
+func encodeStreamEvent(event tesla.Event, unit profile.Unit) ([]byte, error) {
+	if state, ok := event.Data.(tesla.HVACState); ok {
+		event.Data = displayStateIn(&state, unit)
+	}
+	return json.Marshal(event)
+}
+
+// scheduleRefresh re-reads a vehicle's state shortly after a command, if
+// anyone is listening
+func (h *StreamHub) scheduleRefresh(vin string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) == 0 {
+		return
+	}
+	if timer, ok := h.refreshes[vin]; ok {
+		timer.Reset(h.refreshDelay)
+		return
+	}
+	h.refreshes[vin] = time.AfterFunc(h.refreshDelay, func() {
+		h.mu.Lock()
+		delete(h.refreshes, vin)
+		h.mu.Unlock()
+
+		client, err := h.api.vehicle(vin)
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		// Reading the state publishes state_changed if the command changed it
+		if _, err := client.GetHVACState(ctx); err != nil {
+			h.logger.Printf("Failed to refresh state after command: %v", err)
+		}
+	})
+}
+
+// ServeHTTP upgrades GET /ws to a WebSocket. ?events= and ?vin= set the
+// initial subscription.
+func (h *StreamHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ws" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+
+	client := &streamClient{
+		send:   make(chan []byte, streamSendBuffer),
+		unit:   requestUnit(r),
+		events: map[tesla.EventType]bool{tesla.EventStateChanged: true},
+		vins:   make(map[string]bool),
+	}
+	if events := r.URL.Query().Get("events"); events != "" {
+		client.events = make(map[tesla.EventType]bool)
+		for _, name := range strings.Split(events, ",") {
+			if !streamEventTypes[tesla.EventType(name)] {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Unknown event type "+name)
+				return
+			}
+			client.events[tesla.EventType(name)] = true
+		}
+	}
+	for _, vin := range vehicleFilter(r) {
+		if _, err := h.api.vehicle(vin); err != nil {
+			writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+			return
+		}
+		client.vins[vin] = true
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if errors.Is(err, websocket.ErrBadHandshake) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	client.conn = conn
+	conn.SetReadTimeout(2 * streamPingInterval)
+
+	// Start with the current state so clients don't wait for a change
+	if client.events[tesla.EventStateChanged] {
+		for _, vehicle := range h.api.vehicles() {
+			snapshot, ok := vehicle.LastState()
+			if !ok {
+				continue
+			}
+			event := tesla.Event{Type: tesla.EventStateChanged, VIN: vehicle.GetVIN(), Timestamp: snapshot.ReadAt, Data: *snapshot.State}
+			if client.wants(event) {
+				if message, err := encodeStreamEvent(event, client.unit); err == nil {
+					client.send <- message
+				}
+			}
+		}
+	}
+
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+
+	go h.writeLoop(client)
+	h.readLoop(client)
+}
+
+// readLoop applies subscription changes until the client disconnects
+func (h *StreamHub) readLoop(client *streamClient) {
+	defer h.remove(client)
+
+	for {
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req streamRequest
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			h.reply(client, map[string]interface{}{"type": "error", "message": "Invalid JSON: " + err.Error()})
+			continue
+		}
+		if err := h.applyRequest(client, req); err != nil {
+			h.reply(client, map[string]interface{}{"type": "error", "message": err.Error()})
+			continue
+		}
+		h.reply(client, client.subscription())
+	}
+}
+
+// applyRequest changes a client's subscription
+func (h *StreamHub) applyRequest(client *streamClient, req streamRequest) error {
+	for _, event := range append(req.Subscribe, req.Unsubscribe...) {
+		if !streamEventTypes[event] {
+			return errors.New("unknown event type " + string(event))
+		}
+	}
+	if req.VINs != nil {
+		for _, vin := range *req.VINs {
+			if _, err := h.api.vehicle(vin); err != nil {
+				return err
+			}
+		}
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	for _, event := range req.Subscribe {
+		client.events[event] = true
+	}
+	for _, event := range req.Unsubscribe {
+		delete(client.events, event)
+	}
+	if req.VINs != nil {
+		client.vins = make(map[string]bool)
+		for _, vin := range *req.VINs {
+			client.vins[vin] = true
+		}
+	}
+	return nil
+}
+
+// reply queues a message for a client, dropping it if the client is behind
+func (h *StreamHub) reply(client *streamClient, v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	select {
+	case client.send <- message:
+	default:
+	}
+}
+
+// writeLoop sends queued messages and pings until the client is removed
+func (h *StreamHub) writeLoop(client *streamClient) {
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				client.conn.CloseWith(websocket.CloseGoingAway)
+				return
+			}
+			client.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			err = client.conn.WriteMessage(websocket.TextMessage, message)
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			err = client.conn.Ping()
+		}
+		if err != nil {
+			h.remove(client)
+			client.conn.Close()
+			return
+		}
+	}
+}
+
+// remove disconnects a client
+func (h *StreamHub) remove(client *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(client)
+}
+
+func (h *StreamHub) removeLocked(client *streamClient) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// closeAll disconnects every client
+func (h *StreamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		h.removeLocked(client)
+	}
+	for vin, timer := range h.refreshes {
+		timer.Stop()
+		delete(h.refreshes, vin)
+	}
+}
+
+// wants reports whether the client is subscribed to an event
+func (c *streamClient) wants(event tesla.Event) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.events[event.Type] {
+		return false
+	}
+	return len(c.vins) == 0 || c.vins[event.VIN]
+}
+
+// subscription describes the client's current subscription
+func (c *streamClient) subscription() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	events := make([]string, 0, len(c.events))
+	for event := range c.events {
+		events = append(events, string(event))
+	}
+	vins := make([]string, 0, len(c.vins))
+	for vin := range c.vins {
+		vins = append(vins, vin)
+	}
+	sort.Strings(events)
+	sort.Strings(vins)
+	return map[string]interface{}{"type": "subscribed", "events": events, "vins": vins}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/websocket"
+)
+
+// newTestStream serves a stream hub and returns its WebSocket URL
+func newTestStream(t *testing.T) (*APIHandler, *StreamHub, string) {
+	t.Helper()
+	handler := newTestAPIHandler()
+	hub := NewStreamHub(handler, handler.logger)
+	handler.Mount("/ws", hub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+	for handler.client.Events().SubscriberCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+	return handler, hub, "ws://" + strings.TrimPrefix(server.URL, "http://")
+}
+
+// readStreamMessage reads one JSON message from a stream connection
+func readStreamMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	conn.SetReadTimeout(5 * time.Second)
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		t.Fatalf("Invalid message %s: %v", data, err)
+	}
+	return message
+}
+
+// waitForClients waits until the hub has registered n clients
+func waitForClients(t *testing.T, hub *StreamHub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.ClientCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d clients, have %d", n, hub.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamPushesStateChanges(t *testing.T) {
+	handler, hub, url := newTestStream(t)
+
+	conn, err := websocket.Dial(url+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	waitForClients(t, hub, 1)
+
+	events := handler.client.Events()
+	// Not subscribed by default
+	events.Publish(tesla.Event{Type: tesla.EventClimateSkipped, VIN: "TEST_VIN"})
+	events.Publish(tesla.Event{Type: tesla.EventStateChanged, VIN: "TEST_VIN", Data: tesla.HVACState{DriverTempCelsius: 20}})
+
+	message := readStreamMessage(t, conn)
+	if message["type"] != string(tesla.EventStateChanged) {
+		t.Fatalf("Expected state_changed, got %v", message)
+	}
+	data := message["data"].(map[string]interface{})
+	if data["driver_temp_celsius"] != 68.0 {
+		t.Errorf("Expected the temperature in Fahrenheit, got %v", data["driver_temp_celsius"])
+	}
+}
+
+func TestStreamSubscribe(t *testing.T) {
+	handler, hub, url := newTestStream(t)
+
+	conn, err := websocket.Dial(url+"/ws?events=connected", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	waitForClients(t, hub, 1)
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"subscribe": ["bogus"]}`))
+	if message := readStreamMessage(t, conn); message["type"] != "error" {
+		t.Errorf("Expected an error for an unknown event, got %v", message)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"subscribe": ["climate_skipped"], "unsubscribe": ["connected"]}`))
+	message := readStreamMessage(t, conn)
+	if message["type"] != "subscribed" {
+		t.Fatalf("Expected subscribed, got %v", message)
+	}
+	if events := message["events"].([]interface{}); len(events) != 1 || events[0] != "climate_skipped" {
+		t.Errorf("Unexpected subscription %v", events)
+	}
+
+	handler.client.Events().Publish(tesla.Event{Type: tesla.EventConnected, VIN: "TEST_VIN"})
+	handler.client.Events().Publish(tesla.Event{Type: tesla.EventClimateSkipped, VIN: "TEST_VIN"})
+	if message := readStreamMessage(t, conn); message["type"] != "climate_skipped" {
+		t.Errorf("Expected climate_skipped, got %v", message)
+	}
+}
+
+func TestStreamRequiresUpgrade(t *testing.T) {
+	_, _, url := newTestStream(t)
+
+	resp, err := http.Get("http://" + strings.TrimPrefix(url, "ws://") + "/ws")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + strings.TrimPrefix(url, "ws://") + "/ws?events=bogus")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown event, got %d", resp.StatusCode)
+	}
+}
+
+func TestStreamDisconnect(t *testing.T) {
+	_, hub, url := newTestStream(t)
+
+	conn, err := websocket.Dial(url+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	waitForClients(t, hub, 1)
+	conn.Close()
+	waitForClients(t, hub, 0)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/acme"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// serverTLS returns the server's TLS config, or nil to serve plain HTTP.
+// Certificate files given as flags take precedence over the config file. An
+// ACME certificate is renewed by a supervised "acme" subsystem.
+func serverTLS(configManager *tesla.ConfigManager, certFile, keyFile string, supervisor *tesla.Supervisor, logger *log.Logger) (*tls.Config, error) {
+	var config tesla.TLSConfig
+	if configManager != nil {
+		config = configManager.GetConfig().TLS
+	}
+	if certFile != "" || keyFile != "" {
+		config = tesla.TLSConfig{CertFile: certFile, KeyFile: keyFile}
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case config.ACME.Enabled():
+		if config.ACME.CacheDir == "" {
+			config.ACME.CacheDir = filepath.Join(configManager.GetConfig().DataPath(), "acme")
+		}
+		manager, err := acme.NewManager(config.ACME, logger)
+		if err != nil {
+			return nil, err
+		}
+		supervisor.Add("acme", manager.Run)
+		return manager.TLSConfig(), nil
+	case config.CertFile != "":
+		certs, err := newCertReloader(config.CertFile, config.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}, nil
+	}
+	return nil, nil
+}
+
+// certReloader serves a certificate from files, reloading it when either
+// file changes so renewals apply without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *log.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the certificate, failing if it can't be used
+func newCertReloader(certFile, keyFile string, logger *log.Logger) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if _, err := c.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := c.latestModTime()
+	if err == nil && c.cert != nil && !modTime.After(c.modTime) {
+		return c.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(c.certFile, c.keyFile); err == nil {
+			if c.cert != nil {
+				c.logger.Printf("Reloaded TLS certificate from %s", c.certFile)
+			}
+			c.cert = &cert
+			c.modTime = modTime
+			return c.cert, nil
+		}
+	}
+
+	// Keep serving the old certificate while the files are being replaced
+	if c.cert != nil {
+		c.logger.Printf("Failed to reload TLS certificate, keeping the current one: %v", err)
+		c.modTime = modTime
+		return c.cert, nil
+	}
+	return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+}
+
+// latestModTime returns when the certificate or key last changed
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key for name
+func writeTestCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	writeTestCert(t, certFile, keyFile, "old.example.com", start)
+
+	certs, err := newCertReloader(certFile, keyFile, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("newCertReloader failed: %v", err)
+	}
+	name := func() string {
+		cert, err := certs.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate failed: %v", err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	if got := name(); got != "old.example.com" {
+		t.Fatalf("Expected the old certificate, got %s", got)
+	}
+
+	// A renewed certificate is picked up without a restart
+	writeTestCert(t, certFile, keyFile, "new.example.com", start.Add(time.Second))
+	if got := name(); got != "new.example.com" {
+		t.Errorf("Expected the renewed certificate, got %s", got)
+	}
+
+	// A half-written renewal keeps the current certificate
+	os.WriteFile(certFile, []byte("garbage"), 0600)
+	os.Chtimes(certFile, start.Add(2*time.Second), start.Add(2*time.Second))
+	if got := name(); got != "new.example.com" {
+		t.Errorf("Expected the current certificate to be kept, got %s", got)
+	}
+}
+
+func TestCertReloaderRejectsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), log.New(io.Discard, "", 0)); err == nil {
+		t.Error("Expected an error for missing files")
+	}
+}
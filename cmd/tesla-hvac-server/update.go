@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/update"
+)
+
+// version is the server version, set at build time with
+// -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+// updateCommitDelay is how long an updated binary must run before the
+// update is committed and the previous binary discarded
+const updateCommitDelay = 30 * time.Second
+
+// UpdateManager checks for releases and installs them on request
+type UpdateManager struct {
+	checker *update.Checker
+	exePath string
+	logger  *log.Logger
+
+	// restart is called after an update is installed to stop the server so
+	// the service manager starts the new binary
+	restart func()
+}
+
+// newUpdateManager returns an update manager, or nil if update checks
+// aren't configured
+func newUpdateManager(config update.Config, logger *log.Logger) (*UpdateManager, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+	checker, err := update.NewChecker(config, version, logger)
+	if err != nil {
+		return nil, err
+	}
+	exePath, err := executablePath()
+	if err != nil {
+		return nil, err
+	}
+	return &UpdateManager{checker: checker, exePath: exePath, logger: logger}, nil
+}
+
+// Status returns the result of the last update check
+func (m *UpdateManager) Status() update.Status {
+	return m.checker.Status()
+}
+
+// Run checks for updates periodically until ctx is done
+func (m *UpdateManager) Run(ctx context.Context) error {
+	return m.checker.Run(ctx)
+}
+
+// Install checks for a newer release and installs it. It returns the
+// installed release, or nil if the running version is current.
+func (m *UpdateManager) Install(ctx context.Context) (*update.Release, error) {
+	release, err := m.checker.Check(ctx)
+	if err != nil || release == nil {
+		return nil, err
+	}
+	if err := m.checker.Apply(ctx, release, m.exePath); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// ServeHTTP implements http.Handler for /admin/update. GET reports the last
+// check; POST installs the latest release and restarts the server.
+func (m *UpdateManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if r.URL.Query().Get("check") == "true" {
+			if _, err := m.checker.Check(r.Context()); err != nil {
+				writeError(w, http.StatusBadGateway, ErrCodeInternal, err.Error())
+				return
+			}
+		}
+		writeData(w, http.StatusOK, m.Status())
+	case "POST":
+		release, err := m.Install(r.Context())
+		if err != nil {
+			m.logger.Printf("Update failed: %v", err)
+			writeError(w, http.StatusBadGateway, ErrCodeInternal, err.Error())
+			return
+		}
+		if release == nil {
+			writeMessage(w, http.StatusOK, fmt.Sprintf("Version %s is up to date", version))
+			return
+		}
+
+		writeMessage(w, http.StatusAccepted, fmt.Sprintf("Installed %s; restarting", release.Version))
+		if m.restart != nil {
+			go m.restart()
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// executablePath returns the path of the running binary
+func executablePath() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate executable: %w", err)
+	}
+	return filepath.EvalSymlinks(exePath)
+}
+
+// recoverUpdate checks for an update pending its first start. A pending
+// update is committed once the server has run for updateCommitDelay; an
+// update whose first start never committed is rolled back, and the process
+// exits so the service manager starts the previous binary.
+func recoverUpdate(logger *log.Logger) {
+	exePath, err := executablePath()
+	if err != nil {
+		logger.Printf("Skipping update recovery: %v", err)
+		return
+	}
+
+	pending, err := update.Recover(exePath)
+	if errors.Is(err, update.ErrRolledBack) {
+		logger.Fatalf("%v; restart to run it", err)
+	}
+	if err != nil {
+		logger.Printf("Update recovery failed: %v", err)
+		return
+	}
+	if !pending {
+		return
+	}
+
+	logger.Printf("Running updated version %s; committing in %v", version, updateCommitDelay)
+	time.AfterFunc(updateCommitDelay, func() {
+		if err := update.Commit(exePath); err != nil {
+			logger.Printf("%v", err)
+			return
+		}
+		logger.Printf("Update to %s committed", version)
+	})
+}
+
+// runSelfUpdate installs the latest release from the command line
+func runSelfUpdate(configManager *tesla.ConfigManager, logger *log.Logger) error {
+	if configManager == nil {
+		return fmt.Errorf("self-update requires -config")
+	}
+	manager, err := newUpdateManager(configManager.GetConfig().Update, logger)
+	if err != nil {
+		return err
+	}
+	if manager == nil {
+		return fmt.Errorf("update.manifest_url is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	release, err := manager.Install(ctx)
+	if err != nil {
+		return err
+	}
+	if release == nil {
+		fmt.Printf("Version %s is up to date\n", version)
+		return nil
+	}
+	fmt.Printf("Installed %s; restart the server to run it\n", release.Version)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/update"
+)
+
+// newTestUpdateManager serves a signed release of version 9.9.9 and
+// installs it over a temporary binary
+func newTestUpdateManager(t *testing.T) (*UpdateManager, string) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new binary")
+	digest := sha256.Sum256(binary)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(update.Release{
+			Version: "9.9.9",
+			Assets: map[string]update.Asset{update.Platform(): {
+				URL:       server.URL + "/binary",
+				SHA256:    hex.EncodeToString(digest[:]),
+				Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, binary)),
+			}},
+		})
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+
+	logger := log.New(io.Discard, "", 0)
+	checker, err := update.NewChecker(update.Config{
+		ManifestURL:   server.URL + "/manifest.json",
+		PublicKey:     base64.StdEncoding.EncodeToString(publicKey),
+		CheckInterval: time.Hour,
+	}, version, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exePath := filepath.Join(t.TempDir(), "tesla-hvac-server")
+	if err := os.WriteFile(exePath, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &UpdateManager{checker: checker, exePath: exePath, logger: logger}, exePath
+}
+
+func TestAdminUpdate(t *testing.T) {
+	handler, _ := newTestAdminAPI("secret")
+	updates, exePath := newTestUpdateManager(t)
+	restarted := make(chan struct{})
+	updates.restart = func() { close(restarted) }
+	handler.mounts["/admin"].(*AdminHandler).updates = updates
+	handler.updates = updates
+
+	req := httptest.NewRequest("GET", "/admin/update?check=true", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"available":true`) {
+		t.Fatalf("Expected an available update, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/status", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"latest":"9.9.9"`) || !strings.Contains(rec.Body.String(), `"version":"dev"`) {
+		t.Errorf("Expected version and update in status, got %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", "/admin/update", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if data, _ := os.ReadFile(exePath); string(data) != "new binary" {
+		t.Errorf("Expected new binary installed, got %q", data)
+	}
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Error("Expected restart after installing the update")
+	}
+}
+
+func TestAdminUpdateNotConfigured(t *testing.T) {
+	handler, _ := newTestAdminAPI("secret")
+
+	req := httptest.NewRequest("GET", "/admin/update", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// vehicleKey is the context key for the vehicle a request addresses
+type vehicleKey struct{}
+
+// vehicleInfo describes a configured vehicle
+type vehicleInfo struct {
+	VIN       string                `json:"vin"`
+	Name      string                `json:"name,omitempty"`
+	Transport string                `json:"transport"`
+	Active    string                `json:"active_transport,omitempty"` // Transport of the current connection
+	Connected bool                  `json:"connected"`
+	State     tesla.ConnectionState `json:"connection_state"`
+	Default   bool                  `json:"default"`
+}
+
+// vehiclePath splits /vehicles/{vin}/rest into the VIN and /rest. The
+// /vehicles/status route is not a VIN.
+func vehiclePath(path string) (vin, rest string, ok bool) {
+	trimmed, found := strings.CutPrefix(path, "/vehicles/")
+	if !found {
+		return "", "", false
+	}
+	vin, rest, found = strings.Cut(trimmed, "/")
+	if !found || vin == "" || vin == "status" {
+		return "", "", false
+	}
+	return vin, "/" + rest, true
+}
+
+// withVehicle attaches a vehicle to the request and rewrites its path to the
+// route within the vehicle
+func withVehicle(r *http.Request, client *tesla.Client, path string) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), vehicleKey{}, client))
+	u := *r.URL
+	u.Path = path
+	u.RawPath = ""
+	r.URL = &u
+	return r
+}
+
+// vehicleFromContext returns the vehicle named in the request path, if any
+func vehicleFromContext(ctx context.Context) (*tesla.Client, bool) {
+	client, ok := ctx.Value(vehicleKey{}).(*tesla.Client)
+	return client, ok
+}
+
+// clientFor returns the vehicle named in the request path, or the default
+// vehicle
+func (h *APIHandler) clientFor(r *http.Request) *tesla.Client {
+	if client, ok := vehicleFromContext(r.Context()); ok {
+		return client
+	}
+	return h.client
+}
+
+// requestVehicle returns the vehicle named in the request path or by a vin
+// query parameter, or the only vehicle if there is one
+func (h *APIHandler) requestVehicle(r *http.Request) (*tesla.Client, error) {
+	if client, ok := vehicleFromContext(r.Context()); ok {
+		return client, nil
+	}
+	return h.vehicle(r.URL.Query().Get("vin"))
+}
+
+// vehicleFilter returns the VINs a stream should be limited to: the vehicle
+// in the request path, or the vin query parameters
+func vehicleFilter(r *http.Request) []string {
+	if client, ok := vehicleFromContext(r.Context()); ok {
+		return []string{client.GetVIN()}
+	}
+	return r.URL.Query()["vin"]
+}
+
+// handleVehicles lists the configured vehicles
+func (h *APIHandler) handleVehicles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	clients := h.vehicles()
+	vehicles := make([]vehicleInfo, 0, len(clients))
+	for _, client := range clients {
+		vehicles = append(vehicles, vehicleInfo{
+			VIN:       client.GetVIN(),
+			Name:      h.registry.Name(client.GetVIN()),
+			Transport: string(client.Transport()),
+			Active:    string(client.ActiveTransport()),
+			Connected: client.IsConnected(),
+			State:     client.ConnectionState(),
+			Default:   client == h.client,
+		})
+	}
+	writeData(w, http.StatusOK, vehicles)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func newTestRegistryAPI(t *testing.T) *APIHandler {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	registry := tesla.NewRegistry()
+	registry.Add(tesla.NewClient("VIN_A", logger), "Model 3")
+	registry.Add(tesla.NewClient("VIN_B", logger), "")
+	return NewRegistryAPIHandler(registry, logger)
+}
+
+func TestVehiclePath(t *testing.T) {
+	tests := []struct {
+		path, vin, rest string
+		ok              bool
+	}{
+		{"/vehicles/VIN_A/hvac/state", "VIN_A", "/hvac/state", true},
+		{"/vehicles/VIN_A/", "VIN_A", "/", true},
+		{"/vehicles/status", "", "", false},
+		{"/vehicles/VIN_A", "", "", false},
+		{"/vehicles", "", "", false},
+		{"/hvac/state", "", "", false},
+	}
+	for _, tt := range tests {
+		vin, rest, ok := vehiclePath(tt.path)
+		if vin != tt.vin || rest != tt.rest || ok != tt.ok {
+			t.Errorf("vehiclePath(%q) = %q, %q, %v", tt.path, vin, rest, ok)
+		}
+	}
+}
+
+func TestListVehicles(t *testing.T) {
+	handler := newTestRegistryAPI(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/vehicles", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var env struct {
+		Data []vehicleInfo `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := []vehicleInfo{{VIN: "VIN_A", Name: "Model 3", Transport: "ble", Default: true}, {VIN: "VIN_B", Transport: "ble"}}
+	if len(env.Data) != 2 || env.Data[0] != want[0] || env.Data[1] != want[1] {
+		t.Errorf("Unexpected vehicles: %+v", env.Data)
+	}
+}
+
+func TestPerVehicleRouting(t *testing.T) {
+	handler := newTestRegistryAPI(t)
+
+	tests := []struct {
+		path   string
+		status int
+		vin    string
+	}{
+		{"/vehicles/VIN_B/status", http.StatusOK, "VIN_B"},
+		{"/vehicles/VIN_A/status", http.StatusOK, "VIN_A"},
+		{"/status", http.StatusOK, "VIN_A"},
+		{"/vehicles/VIN_C/status", http.StatusNotFound, ""},
+		{"/vehicles/VIN_B/unknown", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.path, tt.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if tt.vin == "" {
+			continue
+		}
+		var env struct {
+			Data struct {
+				VIN string `json:"vin"`
+			} `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &env)
+		if env.Data.VIN != tt.vin {
+			t.Errorf("%s: expected %s, got %q", tt.path, tt.vin, env.Data.VIN)
+		}
+	}
+}
+
+func TestRequestVehicle(t *testing.T) {
+	handler := newTestRegistryAPI(t)
+
+	if _, err := handler.requestVehicle(httptest.NewRequest("GET", "/macros", nil)); err == nil {
+		t.Error("Expected an error without a vin when several vehicles are configured")
+	}
+	client, err := handler.requestVehicle(httptest.NewRequest("GET", "/macros?vin=VIN_B", nil))
+	if err != nil || client.GetVIN() != "VIN_B" {
+		t.Errorf("Expected VIN_B from the query, got %v", err)
+	}
+
+	b, _ := handler.registry.Get("VIN_B")
+	r := withVehicle(httptest.NewRequest("GET", "/vehicles/VIN_B/macros?vin=VIN_A", nil), b, "/macros")
+	if r.URL.Path != "/macros" || r.URL.Query().Get("vin") != "VIN_A" {
+		t.Errorf("Unexpected rewritten URL %s", r.URL)
+	}
+	if client, err := handler.requestVehicle(r); err != nil || client != b {
+		t.Errorf("Expected the path's vehicle to win, got %v", err)
+	}
+	if vins := vehicleFilter(r); len(vins) != 1 || vins[0] != "VIN_B" {
+		t.Errorf("Expected the stream filter to be VIN_B, got %v", vins)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// apiVersionHeader lets clients request, and the server report, an API version
+	apiVersionHeader = "API-Version"
+
+	// legacyAPIVersion is the version served on unversioned /api/ paths when the
+	// client doesn't ask for one. It stays pinned so that adding a new version
+	// never changes the responses seen by existing integrations.
+	legacyAPIVersion = 1
+)
+
+var (
+	// versionedPathPattern matches the version segment of /vN/... paths
+	versionedPathPattern = regexp.MustCompile(`^/v([0-9]+)(/.*)?$`)
+
+	// acceptVersionPattern matches vendor media types such as
+	// application/vnd.tesla-hvac.v1+json
+	acceptVersionPattern = regexp.MustCompile(`application/vnd\.tesla-hvac\.v([0-9]+)\+json`)
+)
+
+// APIRouter dispatches /api requests to versioned API handlers.
+//
+// Requests to /api/vN/... are served by version N. Requests to unversioned
+// /api/... paths are deprecated aliases: they are served by the version the
+// client negotiates via the API-Version header or a vendor Accept media type,
+// falling back to legacyAPIVersion, and carry Deprecation and Link headers
+// pointing at the versioned successor.
+type APIRouter struct {
+	versions map[int]http.Handler
+	logger   *log.Logger
+
+	// deprecatedSeen tracks unversioned paths already logged as deprecated
+	deprecatedSeen sync.Map
+}
+
+// NewAPIRouter creates a new API router
+func NewAPIRouter(logger *log.Logger) *APIRouter {
+	return &APIRouter{
+		versions: make(map[int]http.Handler),
+		logger:   logger,
+	}
+}
+
+// Register registers the handler for an API version
+func (ar *APIRouter) Register(version int, handler http.Handler) {
+	ar.versions[version] = handler
+}
+
+// SupportedVersions returns the registered API versions in ascending order
+func (ar *APIRouter) SupportedVersions() []int {
+	versions := make([]int, 0, len(ar.versions))
+	for v := range ar.versions {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// ServeHTTP implements http.Handler. The /api prefix must already be stripped.
+func (ar *APIRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Explicitly versioned path
+	if m := versionedPathPattern.FindStringSubmatch(r.URL.Path); m != nil {
+		version, _ := strconv.Atoi(m[1])
+		handler, ok := ar.versions[version]
+		if !ok {
+			ar.unsupportedVersion(w, version, http.StatusNotFound)
+			return
+		}
+
+		path := m[2]
+		if path == "" {
+			path = "/"
+		}
+		w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+		serveWithPath(handler, w, r, path)
+		return
+	}
+
+	if r.URL.Path == "/versions" {
+		ar.serveVersions(w, r)
+		return
+	}
+
+	// Unversioned deprecated alias
+	version, err := requestedVersion(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeUnsupportedAPI, err.Error())
+		return
+	}
+	if version == 0 {
+		version = legacyAPIVersion
+	}
+
+	handler, ok := ar.versions[version]
+	if !ok {
+		ar.unsupportedVersion(w, version, http.StatusNotAcceptable)
+		return
+	}
+
+	successor := fmt.Sprintf("/api/v%d%s", version, r.URL.Path)
+	if _, seen := ar.deprecatedSeen.LoadOrStore(r.URL.Path, true); !seen {
+		ar.logger.Printf("Deprecated unversioned API path used: /api%s (use %s)", r.URL.Path, successor)
+	}
+	w.Header().Set(apiVersionHeader, strconv.Itoa(version))
+	w.Header().Set("Deprecation", "true")
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+	w.Header().Add("Warning", fmt.Sprintf(`299 - "Unversioned API paths are deprecated; use %s"`, successor))
+
+	handler.ServeHTTP(w, r)
+}
+
+// apiVersions is the response to GET /api/versions
+type apiVersions struct {
+	Versions []int `json:"versions"`
+	Latest   int   `json:"latest"`
+	Default  int   `json:"default"` // The version unversioned paths are served by
+}
+
+// serveVersions lists the supported API versions so clients can pick one
+// before relying on an unversioned path
+func (ar *APIRouter) serveVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	versions := ar.SupportedVersions()
+	latest := 0
+	if len(versions) > 0 {
+		latest = versions[len(versions)-1]
+	}
+	writeData(w, http.StatusOK, apiVersions{Versions: versions, Latest: latest, Default: legacyAPIVersion})
+}
+
+// unsupportedVersion writes an error listing the supported API versions
+func (ar *APIRouter) unsupportedVersion(w http.ResponseWriter, version int, status int) {
+	writeErrorDetails(w, status, ErrCodeUnsupportedAPI,
+		fmt.Sprintf("API version %d is not supported", version),
+		map[string]interface{}{"supported_versions": ar.SupportedVersions()})
+}
+
+// requestedVersion returns the API version requested by the client via the
+// API-Version header or a vendor Accept media type, or 0 if none was requested
+func requestedVersion(r *http.Request) (int, error) {
+	if header := strings.TrimSpace(r.Header.Get(apiVersionHeader)); header != "" {
+		version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(header), "v"))
+		if err != nil || version <= 0 {
+			return 0, fmt.Errorf("invalid %s header", apiVersionHeader)
+		}
+		return version, nil
+	}
+
+	if m := acceptVersionPattern.FindStringSubmatch(r.Header.Get("Accept")); m != nil {
+		version, _ := strconv.Atoi(m[1])
+		return version, nil
+	}
+
+	return 0, nil
+}
+
+// serveWithPath serves the request with its URL path replaced
+func serveWithPath(handler http.Handler, w http.ResponseWriter, r *http.Request, path string) {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	handler.ServeHTTP(w, r2)
+}
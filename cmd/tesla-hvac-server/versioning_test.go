@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestRouter() *APIRouter {
+	router := NewAPIRouter(log.New(io.Discard, "", 0))
+	router.Register(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "v1:"+r.URL.Path)
+	}))
+	router.Register(2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "v2:"+r.URL.Path)
+	}))
+	return router
+}
+
+func TestAPIRouterVersionedPath(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest("GET", "/v2/hvac/state", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if body := rec.Body.String(); body != "v2:/hvac/state" {
+		t.Errorf("Expected v2 handler with stripped path, got %q", body)
+	}
+	if rec.Header().Get("API-Version") != "2" {
+		t.Errorf("Expected API-Version 2, got %q", rec.Header().Get("API-Version"))
+	}
+	if rec.Header().Get("Deprecation") != "" {
+		t.Error("Versioned paths should not be marked deprecated")
+	}
+}
+
+func TestAPIRouterUnversionedAlias(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest("GET", "/hvac/state", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if body := rec.Body.String(); body != "v1:/hvac/state" {
+		t.Errorf("Expected legacy v1 handler, got %q", body)
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Error("Expected Deprecation header on unversioned path")
+	}
+	if link := rec.Header().Get("Link"); link != `</api/v1/hvac/state>; rel="successor-version"` {
+		t.Errorf("Unexpected Link header: %q", link)
+	}
+}
+
+func TestAPIRouterNegotiation(t *testing.T) {
+	router := newTestRouter()
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		body   string
+	}{
+		{"api version header", "API-Version", "2", http.StatusOK, "v2:/status"},
+		{"api version header with prefix", "API-Version", "v2", http.StatusOK, "v2:/status"},
+		{"vendor accept type", "Accept", "application/vnd.tesla-hvac.v2+json", http.StatusOK, "v2:/status"},
+		{"unsupported version", "API-Version", "9", http.StatusNotAcceptable, ""},
+		{"invalid version", "API-Version", "latest", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/status", nil)
+			req.Header.Set(test.header, test.value)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				t.Errorf("Expected status %d, got %d", test.status, rec.Code)
+			}
+			if test.body != "" && rec.Body.String() != test.body {
+				t.Errorf("Expected body %q, got %q", test.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAPIRouterUnknownVersionPath(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest("GET", "/v7/status", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown version, got %d", rec.Code)
+	}
+}
+
+func TestAPIRouterVersions(t *testing.T) {
+	router := newTestRouter()
+
+	req := httptest.NewRequest("GET", "/versions", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var env struct {
+		Data apiVersions `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Data.Versions) != 2 || env.Data.Latest != 2 || env.Data.Default != 1 {
+		t.Errorf("Unexpected versions %+v", env.Data)
+	}
+	if rec.Header().Get("Deprecation") != "" {
+		t.Error("The version list should not be marked deprecated")
+	}
+}
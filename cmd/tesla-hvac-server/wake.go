@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+// VehicleWakeStatus reports a vehicle's observed sleep state and the
+// background work waiting for it to be awake
+type VehicleWakeStatus struct {
+	VIN   string            `json:"vin"`
+	Awake tesla.AwakeStatus `json:"awake"`
+	Tasks []tesla.WakeTask  `json:"tasks"`
+}
+
+// WakeManager runs a wake scheduler per vehicle so background work is
+// batched into windows when the vehicle is already awake
+type WakeManager struct {
+	api        *APIHandler
+	logger     *log.Logger
+	schedulers map[string]*tesla.WakeScheduler
+}
+
+// NewWakeManager creates a scheduler for every configured vehicle
+func NewWakeManager(api *APIHandler, logger *log.Logger) *WakeManager {
+	m := &WakeManager{
+		api:        api,
+		logger:     logger,
+		schedulers: make(map[string]*tesla.WakeScheduler),
+	}
+	for _, client := range api.vehicles() {
+		m.schedulers[client.GetVIN()] = tesla.NewWakeScheduler(client, logger)
+	}
+	return m
+}
+
+// Start runs the schedulers under the supervisor and schedules the periodic
+// state refresh for vehicles that have one configured. The refresh never
+// wakes the vehicle; it only keeps the cached state current while awake.
+func (m *WakeManager) Start(supervisor *tesla.Supervisor) error {
+	for _, client := range m.api.vehicles() {
+		scheduler := m.schedulers[client.GetVIN()]
+
+		if interval := client.Tuning().Wake.RefreshInterval; interval > 0 {
+			refresh := func(ctx context.Context) error {
+				_, err := client.GetHVACState(ctx)
+				return err
+			}
+			if err := scheduler.Every("state_refresh", interval, 0, refresh); err != nil {
+				return err
+			}
+		}
+
+		if err := supervisor.Add("wake-scheduler:"+client.GetVIN(), scheduler.Run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scheduler returns the wake scheduler for a vehicle, or nil
+func (m *WakeManager) Scheduler(vin string) *tesla.WakeScheduler {
+	return m.schedulers[vin]
+}
+
+// ServeHTTP implements http.Handler for GET and POST /wake
+func (m *WakeManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/wake" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	switch r.Method {
+	case "GET":
+		m.serveStatus(w, r)
+	case "POST":
+		m.serveWake(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// serveWake wakes a vehicle and waits until it is awake, up to
+// wake.max_wait
+func (m *WakeManager) serveWake(w http.ResponseWriter, r *http.Request) {
+	client, err := m.api.requestVehicle(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, err.Error())
+		return
+	}
+	if err := client.Wake(r.Context()); err != nil {
+		m.logger.Printf("Failed to wake vehicle: %v", err)
+		writeCommandError(w, err)
+		return
+	}
+	writeData(w, http.StatusOK, client.AwakeStatus())
+}
+
+// serveStatus lists each vehicle's sleep state and pending tasks
+func (m *WakeManager) serveStatus(w http.ResponseWriter, r *http.Request) {
+
+	statuses := make([]VehicleWakeStatus, 0, len(m.schedulers))
+	for _, client := range m.api.vehicles() {
+		statuses = append(statuses, VehicleWakeStatus{
+			VIN:   client.GetVIN(),
+			Awake: client.AwakeStatus(),
+			Tasks: m.schedulers[client.GetVIN()].Tasks(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].VIN < statuses[j].VIN })
+
+	writeList(w, r, statuses, func(status VehicleWakeStatus) string { return status.VIN })
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+func TestWakeStatus(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	config := tesla.DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Wake.RefreshInterval = 5 * time.Minute
+
+	api := NewAPIHandler(tesla.NewClientFromConfig(config, logger), logger)
+	manager := NewWakeManager(api, logger)
+	if err := manager.Start(tesla.NewSupervisor(nil)); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	api.Mount("/wake", manager)
+
+	req := httptest.NewRequest("GET", "/wake", nil)
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data []VehicleWakeStatus `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 1 {
+		t.Fatalf("Expected one vehicle, got %d", len(response.Data))
+	}
+
+	status := response.Data[0]
+	if status.VIN != "TEST_VIN" || status.Awake.State != tesla.AwakeUnknown {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if len(status.Tasks) != 1 || status.Tasks[0].Name != "state_refresh" || status.Tasks[0].Interval != 5*time.Minute {
+		t.Errorf("Expected state_refresh task, got %+v", status.Tasks)
+	}
+
+	// Waking needs a connection
+	req = httptest.NewRequest("POST", "/wake", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/wake", nil)
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/weather"
+)
+
+// WeatherAutomation runs the weather rules from the config file. Each rule's
+// schedule triggers a forecast check, and the rule's action runs through the
+// schedule handler when the forecast meets its condition. It serves the
+// rules' status at GET /weather.
+type WeatherAutomation struct {
+	configManager *tesla.ConfigManager
+	provider      weather.Provider
+	actions       *ScheduleHandler
+	scheduler     *schedule.Scheduler
+	logger        *log.Logger
+}
+
+// NewWeatherAutomation creates the automation for the configured rules.
+// Rules are re-read on every pass, but the provider is only set up at start.
+func NewWeatherAutomation(configManager *tesla.ConfigManager, provider weather.Provider, actions *ScheduleHandler, logger *log.Logger) *WeatherAutomation {
+	a := &WeatherAutomation{
+		configManager: configManager,
+		provider:      provider,
+		actions:       actions,
+		logger:        logger,
+	}
+	a.scheduler = schedule.New(a.schedules, a.run, logger)
+
+	configManager.RegisterCallback(func(oldConfig, newConfig *tesla.Config) error {
+		a.scheduler.Reload()
+		return nil
+	})
+	return a
+}
+
+// Start runs the rules under the supervisor
+func (a *WeatherAutomation) Start(supervisor *tesla.Supervisor) error {
+	return supervisor.Add("weather", a.scheduler.Run)
+}
+
+// schedules returns when each rule is checked
+func (a *WeatherAutomation) schedules() []schedule.Schedule {
+	rules := a.configManager.GetConfig().WeatherRules
+	schedules := make([]schedule.Schedule, 0, len(rules))
+	for _, rule := range rules {
+		schedules = append(schedules, rule.Schedule)
+	}
+	return schedules
+}
+
+// find returns the rule with the given name
+func (a *WeatherAutomation) find(name string) (weather.Rule, bool) {
+	for _, rule := range a.configManager.GetConfig().WeatherRules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return weather.Rule{}, false
+}
+
+// run checks a rule's forecast and runs its action if the condition holds
+func (a *WeatherAutomation) run(ctx context.Context, s schedule.Schedule) error {
+	rule, ok := a.find(s.Name)
+	if !ok {
+		return fmt.Errorf("unknown weather rule %q", s.Name)
+	}
+
+	at := rule.ForecastTime(time.Now())
+	celsius, err := a.provider.Forecast(ctx, at)
+	if err != nil {
+		return err
+	}
+	if !rule.Matches(celsius) {
+		a.logger.Printf("Weather rule %s: forecast for %s is %.1f°C, not %s", rule.Name, at.Format("15:04"), celsius, rule.Describe())
+		return nil
+	}
+
+	a.logger.Printf("Weather rule %s: forecast for %s is %.1f°C, running %s", rule.Name, at.Format("15:04"), celsius, rule.Action)
+	return a.actions.run(ctx, rule.Schedule)
+}
+
+// ServeHTTP implements http.Handler for GET /weather
+func (a *WeatherAutomation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/weather" {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeData(w, http.StatusOK, a.scheduler.Status())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/weather"
+)
+
+// fakeForecast returns a fixed temperature and records the requested times
+type fakeForecast struct {
+	celsius float64
+	err     error
+	calls   []time.Time
+}
+
+func (f *fakeForecast) Forecast(ctx context.Context, at time.Time) (float64, error) {
+	f.calls = append(f.calls, at)
+	return f.celsius, f.err
+}
+
+// newTestWeatherAutomation runs a "cold-morning" rule, which preconditions
+// when the forecast is below 0°C, against a fake forecast
+func newTestWeatherAutomation(t *testing.T) (*APIHandler, *WeatherAutomation, *fakeForecast) {
+	t.Helper()
+
+	api, schedules, configManager := newTestScheduleHandler(t)
+	below := 0.0
+	err := configManager.UpdateConfig(func(c *tesla.Config) {
+		c.Weather = weather.Config{Provider: weather.ProviderOpenWeatherMap, Latitude: 59.3, Longitude: 18.1}
+		c.WeatherRules = []weather.Rule{{
+			Schedule:   schedule.Schedule{Name: "cold-morning", Action: schedule.ActionPrecondition, At: "06:45"},
+			ForecastAt: "07:00",
+			Below:      &below,
+		}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forecast := &fakeForecast{}
+	automation := NewWeatherAutomation(configManager, forecast, schedules, log.New(io.Discard, "", 0))
+	api.Mount("/weather", automation)
+	return api, automation, forecast
+}
+
+func TestWeatherRuleRun(t *testing.T) {
+	_, automation, forecast := newTestWeatherAutomation(t)
+	ctx := context.Background()
+	rule := schedule.Schedule{Name: "cold-morning", Action: schedule.ActionPrecondition, At: "06:45"}
+
+	// A mild forecast skips the action
+	forecast.celsius = 4
+	if err := automation.run(ctx, rule); err != nil {
+		t.Errorf("Expected the rule to be skipped, got %v", err)
+	}
+	if len(forecast.calls) != 1 || forecast.calls[0].Format("15:04") != "07:00" {
+		t.Errorf("Expected a forecast for 07:00, got %v", forecast.calls)
+	}
+
+	// A freezing forecast runs the action, which fails as the vehicle isn't
+	// connected
+	forecast.celsius = -3
+	if err := automation.run(ctx, rule); err == nil {
+		t.Error("Expected the action to run and fail when not connected")
+	}
+
+	forecast.err = errors.New("forecast unavailable")
+	if err := automation.run(ctx, rule); err == nil || !strings.Contains(err.Error(), "forecast unavailable") {
+		t.Errorf("Expected the forecast error, got %v", err)
+	}
+
+	if err := automation.run(ctx, schedule.Schedule{Name: "missing"}); err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+}
+
+func TestWeatherStatus(t *testing.T) {
+	api, _, _ := newTestWeatherAutomation(t)
+
+	rec := servePreset(api, "GET", "/weather", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"cold-morning"`) {
+		t.Errorf("Expected the rule's status, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := servePreset(api, "POST", "/weather", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/webhook"
+)
+
+const (
+	// webhookEventBuffer is how many vehicle events may queue for the
+	// notifier
+	webhookEventBuffer = 32
+	// cabinTempRearm is how far, in Celsius, the cabin must cool below
+	// cabin_temp_max before it can alert again
+	cabinTempRearm = 2
+)
+
+// WebhookNotifier turns vehicle events into webhook deliveries:
+//
+//	climate_on, climate_off   the climate was seen or commanded on or off
+//	cabin_temperature         the cabin rose above cabin_temp_max
+//	circuit_open              repeated failures opened the circuit breaker
+//	circuit_closed            the circuit breaker closed again
+type WebhookNotifier struct {
+	api        *APIHandler
+	config     webhook.Config
+	dispatcher *webhook.Dispatcher
+	send       func(webhook.Payload)
+	logger     *log.Logger
+
+	vehicles map[string]*webhookVehicle // Only touched by Run
+}
+
+// webhookVehicle is what the notifier knows of a vehicle, so each change is
+// reported once
+type webhookVehicle struct {
+	climateKnown bool
+	climateOn    bool
+	cabin        tempAlarm
+}
+
+// NewWebhookNotifier creates a notifier for the endpoints in config
+func NewWebhookNotifier(api *APIHandler, config webhook.Config, logger *log.Logger) *WebhookNotifier {
+	dispatcher := webhook.NewDispatcher(config, logger)
+	return &WebhookNotifier{
+		api:        api,
+		config:     config,
+		dispatcher: dispatcher,
+		send:       dispatcher.Send,
+		logger:     logger,
+		vehicles:   make(map[string]*webhookVehicle),
+	}
+}
+
+// Run delivers webhooks for the vehicles' events until ctx is cancelled
+func (n *WebhookNotifier) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.dispatcher.Run(ctx)
+	}()
+	defer func() { <-done }()
+
+	events := make(chan tesla.Event, webhookEventBuffer)
+	for _, vehicle := range n.api.vehicles() {
+		vehicleEvents, unsubscribe := vehicle.Events().Subscribe(webhookEventBuffer)
+		defer unsubscribe()
+		go func() {
+			for event := range vehicleEvents {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			n.handle(event)
+		}
+	}
+}
+
+// handle sends the webhooks an event calls for
+func (n *WebhookNotifier) handle(event tesla.Event) {
+	v := n.vehicles[event.VIN]
+	if v == nil {
+		v = &webhookVehicle{}
+		n.vehicles[event.VIN] = v
+	}
+
+	switch event.Type {
+	case tesla.EventStateChanged:
+		state, ok := event.Data.(tesla.HVACState)
+		if !ok {
+			return
+		}
+		n.climate(event, v, state.IsOn, "state")
+		n.cabin(event, v, state)
+
+	case tesla.EventCommandSent:
+		cmd, ok := event.Data.(tesla.Command)
+		if !ok {
+			return
+		}
+		switch cmd.Name {
+		case "set_climate_on":
+			n.climate(event, v, true, "command")
+		case "set_climate_off":
+			n.climate(event, v, false, "command")
+		}
+
+	case tesla.EventCircuitOpened:
+		n.notify(event, webhook.EventCircuitOpen, event.Data)
+
+	case tesla.EventCircuitStateChanged:
+		if change, ok := event.Data.(tesla.CircuitStateChange); ok && change.To == tesla.CircuitClosed.String() {
+			n.notify(event, webhook.EventCircuitClosed, change)
+		}
+	}
+}
+
+// climate reports the climate turning on or off. The first state seen only
+// sets the baseline, as it isn't known to be a change.
+func (n *WebhookNotifier) climate(event tesla.Event, v *webhookVehicle, on bool, source string) {
+	known, was := v.climateKnown, v.climateOn
+	v.climateKnown, v.climateOn = true, on
+	if (!known && source == "state") || (known && was == on) {
+		return
+	}
+	name := webhook.EventClimateOff
+	if on {
+		name = webhook.EventClimateOn
+	}
+	n.notify(event, name, map[string]interface{}{"source": source})
+}
+
+// cabin alerts once when the cabin rises above the threshold, and again only
+// after it has cooled off
+func (n *WebhookNotifier) cabin(event tesla.Event, v *webhookVehicle, state tesla.HVACState) {
+	threshold := n.config.CabinTempMax
+	if threshold == 0 {
+		return
+	}
+	if v.cabin.check(state.InsideTempCelsius, threshold) {
+		n.notify(event, webhook.EventCabinTemp, map[string]interface{}{
+			"inside_temp_celsius":  state.InsideTempCelsius,
+			"outside_temp_celsius": state.OutsideTempCelsius,
+			"threshold_celsius":    threshold,
+			"climate_on":           state.IsOn,
+		})
+	}
+}
+
+func (n *WebhookNotifier) notify(event tesla.Event, name string, data interface{}) {
+	n.send(webhook.Payload{Event: name, VIN: event.VIN, Timestamp: event.Timestamp, Data: data})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+	"github.com/teslamotors/vehicle-command/internal/webhook"
+)
+
+func newTestNotifier(config webhook.Config) (*WebhookNotifier, *[]webhook.Payload) {
+	var sent []webhook.Payload
+	n := NewWebhookNotifier(nil, config, log.New(io.Discard, "", 0))
+	n.send = func(p webhook.Payload) { sent = append(sent, p) }
+	return n, &sent
+}
+
+func events(sent []webhook.Payload) []string {
+	var names []string
+	for _, p := range sent {
+		names = append(names, p.Event)
+	}
+	return names
+}
+
+func TestWebhookNotifierClimate(t *testing.T) {
+	n, sent := newTestNotifier(webhook.Config{})
+	state := func(on bool) tesla.Event {
+		return tesla.Event{Type: tesla.EventStateChanged, VIN: "VIN1", Data: tesla.HVACState{IsOn: on}}
+	}
+	command := func(name string) tesla.Event {
+		return tesla.Event{Type: tesla.EventCommandSent, VIN: "VIN1", Data: tesla.Command{Name: name}}
+	}
+
+	n.handle(state(false))              // Baseline
+	n.handle(command("set_climate_on")) // Change
+	n.handle(state(true))               // Already reported
+	n.handle(command("set_temps"))      // Unrelated
+	n.handle(state(false))              // Change
+
+	got := events(*sent)
+	want := []string{webhook.EventClimateOn, webhook.EventClimateOff}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestWebhookNotifierCabinTemp(t *testing.T) {
+	n, sent := newTestNotifier(webhook.Config{CabinTempMax: 40})
+	for _, temp := range []float32{35, 41, 45, 39, 41, 37, 42} {
+		n.handle(tesla.Event{Type: tesla.EventStateChanged, VIN: "VIN1", Data: tesla.HVACState{InsideTempCelsius: temp}})
+	}
+	// Alerts at 41, re-arms at 37 and alerts again at 42
+	if got := events(*sent); len(got) != 2 || got[0] != webhook.EventCabinTemp || got[1] != webhook.EventCabinTemp {
+		t.Errorf("events = %v, want two cabin_temperature alerts", got)
+	}
+}
+
+func TestWebhookNotifierCircuitOpen(t *testing.T) {
+	n, sent := newTestNotifier(webhook.Config{})
+	n.handle(tesla.Event{Type: tesla.EventCircuitOpened, VIN: "VIN1", Data: tesla.CircuitOpened{Operation: "set_climate_on"}})
+	if got := events(*sent); len(got) != 1 || got[0] != webhook.EventCircuitOpen || (*sent)[0].VIN != "VIN1" {
+		t.Errorf("sent = %+v", *sent)
+	}
+}
+
+func TestWebhookNotifierCircuitClosed(t *testing.T) {
+	n, sent := newTestNotifier(webhook.Config{})
+	for _, to := range []string{"open", "half_open", "closed"} {
+		n.handle(tesla.Event{Type: tesla.EventCircuitStateChanged, VIN: "VIN1", Data: tesla.CircuitStateChange{To: to}})
+	}
+	if got := events(*sent); len(got) != 1 || got[0] != webhook.EventCircuitClosed {
+		t.Errorf("events = %v, want one circuit_closed", got)
+	}
+}
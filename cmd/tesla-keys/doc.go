@@ -0,0 +1,5 @@
+/*
+Tesla-keys manages the HVAC server's key pair in the system keyring: it generates, fingerprints,
+exports, rotates and deletes the key, and prints the instructions for enrolling it in a vehicle.
+*/
+package main
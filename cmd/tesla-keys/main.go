@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/tesla"
+)
+
+const usageText = `
+Manages the key pair the HVAC server signs vehicle commands with. The key pair is stored in the
+system keyring under -name.
+
+COMMANDS:
+  generate      Generate a key pair and print its public key; -f replaces an existing one
+  fingerprint   Print the SHA-256 fingerprint of the public key
+  export        Print the public key as PEM, or write it to -output
+  rotate        Replace the key pair with a new one and print both fingerprints
+  delete        Delete the key pair from the keyring
+  instructions  Print how to enroll the key for -domain; -qr also writes the QR code
+
+generate and rotate also write the private key to -key-file, encrypted with the passphrase in
+TESLA_KEY_PASSPHRASE, the keyring or the terminal.
+
+The file keyring's password is read from TESLA_KEYRING_PASSWORD, -keyring-password-file or the
+terminal.`
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s [OPTION...] generate|fingerprint|export|rotate|delete|instructions\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(w, usageText)
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "OPTIONS:")
+	flag.PrintDefaults()
+}
+
+// options are the command-line flags
+type options struct {
+	name       string
+	keyring    tesla.KeyringConfig
+	overwrite  bool
+	outputFile string
+	keyFile    string
+	domain     string
+	qrFile     string
+}
+
+func main() {
+	var opts options
+	flag.Usage = func() { usage(flag.CommandLine.Output()) }
+	flag.StringVar(&opts.name, "name", "tesla-hvac", "Name of the key pair in the keyring")
+	flag.StringVar(&opts.keyring.Backend, "keyring", "", "Keyring backend: file, secret-service or keychain (default: first available)")
+	flag.StringVar(&opts.keyring.FileDir, "keyring-dir", "", "Directory for the file keyring (default "+tesla.DefaultKeyringDir+")")
+	flag.StringVar(&opts.keyring.PasswordFile, "keyring-password-file", "", "Read the file keyring's password from `file` when "+tesla.KeyringPasswordEnv+" is not set")
+	flag.BoolVar(&opts.overwrite, "f", false, "Replace an existing key pair (for generate)")
+	flag.StringVar(&opts.outputFile, "output", "", "Write the public key to `file` instead of stdout (for export)")
+	flag.StringVar(&opts.keyFile, "key-file", "", "Also write the private key to `file` (for generate and rotate)")
+	flag.StringVar(&opts.domain, "domain", "", "Domain the public key is registered for (for instructions)")
+	flag.StringVar(&opts.qrFile, "qr", "", "Write the enrollment QR code to `file`, as SVG if it ends in .svg and PNG otherwise (for instructions)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	if err := run(flag.Arg(0), opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(command string, opts options) error {
+	km, err := tesla.OpenKeyManager(opts.name, opts.keyring, log.New(io.Discard, "", 0))
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "generate":
+		return generate(km, opts)
+	case "fingerprint":
+		if _, err := km.LoadExistingKeyPair(); err != nil {
+			return err
+		}
+		fingerprint, err := km.Fingerprint()
+		if err != nil {
+			return err
+		}
+		fmt.Println(fingerprint)
+	case "export":
+		keyPair, err := km.LoadExistingKeyPair()
+		if err != nil {
+			return err
+		}
+		if opts.outputFile != "" {
+			return km.SavePublicKeyToFile(opts.outputFile)
+		}
+		fmt.Print(keyPair.PublicKeyPEM)
+	case "rotate":
+		return rotate(km, opts)
+	case "delete":
+		if err := km.DeleteKeyPair(); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted key pair %s.\n", opts.name)
+	case "instructions":
+		return instructions(km, opts)
+	default:
+		usage(os.Stderr)
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
+
+// generate creates the key pair unless one exists
+func generate(km *tesla.KeyManager, opts options) error {
+	_, err := km.LoadExistingKeyPair()
+	if err == nil && !opts.overwrite {
+		return fmt.Errorf("key pair %s already exists; use -f to replace it, or rotate", opts.name)
+	}
+	if err != nil && !errors.Is(err, tesla.ErrKeyPairNotFound) && !opts.overwrite {
+		return fmt.Errorf("%w; use -f to replace it", err)
+	}
+
+	keyPair, err := km.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	if err := saveKeyFile(km, opts); err != nil {
+		return err
+	}
+	fmt.Print(keyPair.PublicKeyPEM)
+	return nil
+}
+
+// rotate replaces the key pair and explains how to swap it on the vehicle
+func rotate(km *tesla.KeyManager, opts options) error {
+	previous, _, err := km.RotateKeyPair()
+	if err != nil {
+		return err
+	}
+	if err := saveKeyFile(km, opts); err != nil {
+		return err
+	}
+
+	oldPoint, err := publicKeyHex(previous.PublicKeyPEM)
+	if err != nil {
+		return err
+	}
+	oldFingerprint, err := fingerprintPEM(previous.PublicKeyPEM)
+	if err != nil {
+		return err
+	}
+	newFingerprint, err := km.Fingerprint()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Old key: %s\n", oldFingerprint)
+	fmt.Printf("New key: %s\n", newFingerprint)
+	fmt.Println()
+	fmt.Println("Enroll the new key with \"tesla-config enroll\", then revoke the old one with:")
+	fmt.Printf("  tesla-config remove-key -public-key %s\n", oldPoint)
+	return nil
+}
+
+// instructions prints the enrollment instructions and writes the QR code
+func instructions(km *tesla.KeyManager, opts options) error {
+	if opts.domain == "" {
+		return errors.New("-domain is required for instructions")
+	}
+	if _, err := km.LoadExistingKeyPair(); err != nil {
+		return err
+	}
+	text, err := km.CreateEnrollmentInstructions(opts.domain)
+	if err != nil {
+		return err
+	}
+	fmt.Print(text)
+
+	if opts.qrFile == "" {
+		return nil
+	}
+	code, err := tesla.EnrollmentQRCode(opts.domain)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if strings.HasSuffix(strings.ToLower(opts.qrFile), ".svg") {
+		data = code.SVG(8)
+	} else if data, err = code.PNG(8); err != nil {
+		return err
+	}
+	if err := os.WriteFile(opts.qrFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write QR code: %w", err)
+	}
+	fmt.Printf("QR code written to %s\n", opts.qrFile)
+	return nil
+}
+
+// saveKeyFile writes the private key to -key-file, if set
+func saveKeyFile(km *tesla.KeyManager, opts options) error {
+	if opts.keyFile == "" {
+		return nil
+	}
+	kr, err := tesla.OpenKeyring(opts.keyring)
+	if err != nil {
+		return err
+	}
+	if err := km.SavePrivateKeyToFile(opts.keyFile, tesla.DefaultKeyPassphrase(kr)); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Private key written to %s\n", opts.keyFile)
+	return nil
+}
+
+// parsePublicKeyPEM parses a KeyPair's public key
+func parsePublicKeyPEM(data string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not ECDSA")
+	}
+	return publicKey, nil
+}
+
+// publicKeyHex returns a public key the way the vehicle lists it
+func publicKeyHex(data string) (string, error) {
+	publicKey, err := parsePublicKeyPEM(data)
+	if err != nil {
+		return "", err
+	}
+	point, err := publicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(point.Bytes()), nil
+}
+
+func fingerprintPEM(data string) (string, error) {
+	publicKey, err := parsePublicKeyPEM(data)
+	if err != nil {
+		return "", err
+	}
+	return tesla.PublicKeyFingerprint(publicKey)
+}
@@ -1,6 +1,6 @@
 module github.com/teslamotors/vehicle-command
 
-go 1.23
+go 1.23.0
 
 require (
 	github.com/99designs/keyring v1.2.2
@@ -8,8 +8,11 @@ require (
 	github.com/go-ble/ble v0.0.0-20240122180141-8c5522f54333
 	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
-	golang.org/x/term v0.5.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.41.0
+	golang.org/x/term v0.34.0
 	google.golang.org/protobuf v1.34.2
+	gopkg.in/fsnotify.v1 v1.4.7
 )
 
 require (
@@ -17,6 +20,7 @@ require (
 	github.com/JuulLabs-OSS/cbgo v0.0.1 // indirect
 	github.com/danieljoos/wincred v1.2.0 // indirect
 	github.com/dvsekhvalnov/jose2go v1.6.0 // indirect
+	github.com/fsnotify/fsnotify v1.10.1 // indirect
 	github.com/godbus/dbus v0.0.0-20190726142602-4481cbc300e2 // indirect
 	github.com/gsterjov/go-libsecret v0.0.0-20161001094733-a6f4afe4910c // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
@@ -28,8 +32,7 @@ require (
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/raff/goble v0.0.0-20190909174656-72afc67d6a99 // indirect
 	github.com/sirupsen/logrus v1.5.0 // indirect
-	golang.org/x/sys v0.8.0 // indirect
-	gopkg.in/fsnotify.v1 v1.4.7 // indirect
+	golang.org/x/sys v0.35.0 // indirect
 )
 
 replace github.com/JuulLabs-OSS/cbgo => github.com/tinygo-org/cbgo v0.0.4
@@ -0,0 +1,307 @@
+// Package acme obtains and renews a TLS certificate for one hostname from an
+// ACME certificate authority such as Let's Encrypt (RFC 8555).
+//
+// The tls-alpn-01 challenge (RFC 8737) is answered on the server's own TLS
+// listener, so only the HTTPS port has to be reachable from the internet.
+// The certificate and the account key are cached on disk and reused across
+// restarts.
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LetsEncryptURL is the default directory URL
+	LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+	// ALPNProto is the protocol the CA offers when validating tls-alpn-01
+	ALPNProto = "acme-tls/1"
+
+	// renewBefore is how long before expiry a certificate is renewed
+	renewBefore = 30 * 24 * time.Hour
+	// checkInterval is how often Run checks whether to renew
+	checkInterval = 12 * time.Hour
+	// retryInterval is how long Run waits after a failed attempt, to stay
+	// within the CA's rate limits
+	retryInterval = time.Hour
+	// obtainTimeout bounds one attempt to obtain a certificate
+	obtainTimeout = 5 * time.Minute
+)
+
+// Config configures certificates from an ACME CA. ACME is disabled without
+// a hostname.
+type Config struct {
+	Hostname     string `json:"hostname,omitempty"`
+	Email        string `json:"email,omitempty"`         // Contact for expiry notices
+	DirectoryURL string `json:"directory_url,omitempty"` // Defaults to Let's Encrypt
+	AcceptTerms  bool   `json:"accept_terms,omitempty"`  // Agree to the CA's terms of service
+	CacheDir     string `json:"cache_dir,omitempty"`     // Defaults to "acme" in the data directory
+}
+
+// Enabled reports whether ACME is configured
+func (c Config) Enabled() bool {
+	return c.Hostname != ""
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if strings.ContainsAny(c.Hostname, ":/*") || !strings.Contains(c.Hostname, ".") {
+		return fmt.Errorf("hostname must be a fully qualified domain name, got %q", c.Hostname)
+	}
+	if !c.AcceptTerms {
+		return fmt.Errorf("accept_terms must be true to use the CA")
+	}
+	if c.DirectoryURL != "" && !strings.HasPrefix(c.DirectoryURL, "https://") {
+		return fmt.Errorf("directory_url must be an https URL")
+	}
+	return nil
+}
+
+// Manager serves a certificate for the configured hostname and keeps it
+// renewed
+type Manager struct {
+	config       Config
+	httpClient   *http.Client
+	logger       *log.Logger
+	pollInterval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	challenge *tls.Certificate // Answers tls-alpn-01 while an order is pending
+
+	// obtainMu serializes attempts to obtain a certificate
+	obtainMu sync.Mutex
+}
+
+// NewManager creates a manager, loading a cached certificate if there is one
+func NewManager(config Config, logger *log.Logger) (*Manager, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if !config.Enabled() {
+		return nil, fmt.Errorf("ACME is not configured")
+	}
+	if config.CacheDir == "" {
+		return nil, fmt.Errorf("ACME needs a cache directory")
+	}
+	if config.DirectoryURL == "" {
+		config.DirectoryURL = LetsEncryptURL
+	}
+	if err := os.MkdirAll(config.CacheDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ACME cache: %w", err)
+	}
+
+	m := &Manager{
+		config:       config,
+		httpClient:   &http.Client{Timeout: time.Minute},
+		logger:       logger,
+		pollInterval: 2 * time.Second,
+	}
+	if cert, err := m.loadCert(); err == nil {
+		m.cert = cert
+	} else if !errors.Is(err, os.ErrNotExist) {
+		logger.Printf("Ignoring cached certificate: %v", err)
+	}
+	return m, nil
+}
+
+// TLSConfig returns a server config that serves the managed certificate and
+// answers tls-alpn-01 challenges
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", ALPNProto},
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == ALPNProto {
+		if m.challenge == nil || !strings.EqualFold(hello.ServerName, m.config.Hostname) {
+			return nil, fmt.Errorf("no pending ACME challenge for %q", hello.ServerName)
+		}
+		return m.challenge, nil
+	}
+	if m.cert == nil {
+		return nil, fmt.Errorf("certificate for %s has not been obtained yet", m.config.Hostname)
+	}
+	// Clients on the LAN may connect by address without SNI; they still get
+	// the certificate rather than a failed handshake
+	return m.cert, nil
+}
+
+// Expiry returns when the current certificate expires, or the zero time if
+// there is none
+func (m *Manager) Expiry() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil || m.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return m.cert.Leaf.NotAfter
+}
+
+// needsRenewal reports whether there is no certificate or it expires soon
+func (m *Manager) needsRenewal() bool {
+	expiry := m.Expiry()
+	return expiry.IsZero() || time.Until(expiry) < renewBefore
+}
+
+// Run obtains a certificate if there is none and renews it before it
+// expires, until ctx is done
+func (m *Manager) Run(ctx context.Context) error {
+	for {
+		wait := checkInterval
+		if m.needsRenewal() {
+			if err := m.Obtain(ctx); err != nil {
+				m.logger.Printf("Failed to obtain certificate for %s: %v", m.config.Hostname, err)
+				wait = retryInterval
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Obtain orders a new certificate and starts serving it
+func (m *Manager) Obtain(ctx context.Context) error {
+	m.obtainMu.Lock()
+	defer m.obtainMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, obtainTimeout)
+	defer cancel()
+
+	accountKey, err := m.accountKey()
+	if err != nil {
+		return err
+	}
+	c := &client{
+		httpClient:   m.httpClient,
+		directoryURL: m.config.DirectoryURL,
+		key:          accountKey,
+		pollInterval: m.pollInterval,
+	}
+	if err := c.register(ctx, m.config.Email); err != nil {
+		return err
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	chain, err := c.order(ctx, m.config.Hostname, certKey, m.setChallenge)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(chain, keyPEM)
+	if err != nil {
+		return fmt.Errorf("CA returned an unusable certificate: %w", err)
+	}
+	if err := writeFileAtomic(m.certPath(), append(keyPEM, chain...)); err != nil {
+		return fmt.Errorf("failed to cache certificate: %w", err)
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	m.logger.Printf("Obtained certificate for %s, valid until %s", m.config.Hostname, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// setChallenge installs or clears the tls-alpn-01 challenge certificate
+func (m *Manager) setChallenge(cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.challenge = cert
+}
+
+// certPath is where the certificate and its key are cached
+func (m *Manager) certPath() string {
+	return filepath.Join(m.config.CacheDir, m.config.Hostname+".pem")
+}
+
+// loadCert reads the cached certificate
+func (m *Manager) loadCert() (*tls.Certificate, error) {
+	data, err := os.ReadFile(m.certPath())
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.Leaf.VerifyHostname(m.config.Hostname); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// accountKey loads the account key, creating it on first use
+func (m *Manager) accountKey() (*ecdsa.PrivateKey, error) {
+	path := filepath.Join(m.config.CacheDir, "account.key")
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid ACME account key in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("failed to save ACME account key: %w", err)
+	}
+	return key, nil
+}
+
+// writeFileAtomic replaces a private file without leaving a partial one
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,265 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCA is a minimal ACME server. It checks every request's signature and,
+// when a challenge is accepted, validates the manager's challenge
+// certificate directly instead of connecting to it.
+type fakeCA struct {
+	t       *testing.T
+	server  *httptest.Server
+	manager *Manager
+	caKey   *ecdsa.PrivateKey
+	caCert  *x509.Certificate
+
+	mu         sync.Mutex
+	accountKey *ecdsa.PublicKey
+	validated  bool
+	chain      []byte
+	nonce      int
+}
+
+func newFakeCA(t *testing.T) *fakeCA {
+	t.Helper()
+	ca := &fakeCA{t: t}
+	ca.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &ca.caKey.PublicKey, ca.caKey)
+	ca.caCert, _ = x509.ParseCertificate(der)
+
+	ca.server = httptest.NewTLSServer(http.HandlerFunc(ca.serve))
+	t.Cleanup(ca.server.Close)
+	return ca
+}
+
+func (ca *fakeCA) serve(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	ca.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", ca.nonce))
+	url := ca.server.URL
+	if r.URL.Path == "/directory" {
+		json.NewEncoder(w).Encode(directory{NewNonce: url + "/nonce", NewAccount: url + "/account", NewOrder: url + "/order"})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		return
+	}
+
+	payload := ca.verify(r)
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", url+"/account/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status": "valid"}`))
+	case "/order":
+		w.Header().Set("Location", url+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(order{Status: "pending", Authorizations: []string{url + "/authz/1"}, Finalize: url + "/finalize/1"})
+	case "/authz/1":
+		status := "pending"
+		if ca.validated {
+			status = "valid"
+		}
+		json.NewEncoder(w).Encode(authorization{Status: status, Challenges: []challenge{
+			{Type: "http-01", URL: url + "/chal/http", Token: "http-token"},
+			{Type: "tls-alpn-01", URL: url + "/chal/1", Token: "alpn-token"},
+		}})
+	case "/chal/1":
+		ca.validateChallenge()
+		w.Write([]byte(`{"status": "processing"}`))
+	case "/finalize/1":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		ca.issue(req.CSR)
+		json.NewEncoder(w).Encode(order{Status: "processing"})
+	case "/order/1":
+		json.NewEncoder(w).Encode(order{Status: "valid", Certificate: url + "/cert/1"})
+	case "/cert/1":
+		w.Write(ca.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verify checks a request's JWS signature and returns its payload
+func (ca *fakeCA) verify(r *http.Request) []byte {
+	var jws struct{ Protected, Payload, Signature string }
+	json.NewDecoder(r.Body).Decode(&jws)
+	header, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var protected struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  map[string]string
+	}
+	json.Unmarshal(header, &protected)
+
+	if protected.URL != ca.server.URL+r.URL.Path || protected.Nonce == "" {
+		ca.t.Errorf("Bad protected header %s", header)
+	}
+	if protected.JWK != nil {
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK["y"])
+		ca.accountKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	} else if protected.Kid != ca.server.URL+"/account/1" {
+		ca.t.Errorf("Unexpected kid %q", protected.Kid)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	rs, ss := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if ca.accountKey == nil || !ecdsa.Verify(ca.accountKey, digest[:], rs, ss) {
+		ca.t.Errorf("Invalid signature on %s", r.URL.Path)
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload
+}
+
+// validateChallenge checks the challenge certificate as the CA would see it
+// in a tls-alpn-01 handshake
+func (ca *fakeCA) validateChallenge() {
+	cert, err := ca.manager.GetCertificate(&tls.ClientHelloInfo{ServerName: "car.example.com", SupportedProtos: []string{ALPNProto}})
+	if err != nil {
+		ca.t.Errorf("No challenge certificate: %v", err)
+		return
+	}
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+
+	point, _ := ca.accountKey.ECDH()
+	b := point.Bytes()
+	jwk := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, encode(b[1:33]), encode(b[33:]))
+	thumbprint := sha256.Sum256([]byte(jwk))
+	expected := sha256.Sum256([]byte("alpn-token." + encode(thumbprint[:])))
+
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(idPeACMEIdentifier) {
+			var value []byte
+			asn1.Unmarshal(ext.Value, &value)
+			if ext.Critical && string(value) == string(expected[:]) {
+				ca.validated = true
+				return
+			}
+		}
+	}
+	ca.t.Error("Challenge certificate doesn't carry the key authorization")
+}
+
+// issue signs a certificate for a CSR
+func (ca *fakeCA) issue(encoded string) {
+	der, _ := base64.RawURLEncoding.DecodeString(encoded)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		ca.t.Errorf("Invalid CSR: %v", err)
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	cert, _ := x509.CreateCertificate(rand.Reader, template, ca.caCert, csr.PublicKey, ca.caKey)
+	ca.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.caCert.Raw})...)
+}
+
+func newTestManager(t *testing.T, ca *fakeCA, cacheDir string) *Manager {
+	t.Helper()
+	m, err := NewManager(Config{
+		Hostname:     "car.example.com",
+		DirectoryURL: ca.server.URL + "/directory",
+		AcceptTerms:  true,
+		CacheDir:     cacheDir,
+	}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	m.httpClient = ca.server.Client()
+	m.pollInterval = time.Millisecond
+	ca.manager = m
+	return m
+}
+
+func TestObtain(t *testing.T) {
+	ca := newFakeCA(t)
+	cacheDir := t.TempDir()
+	m := newTestManager(t, ca, cacheDir)
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "car.example.com"}); err == nil {
+		t.Error("Expected an error before a certificate is obtained")
+	}
+	if err := m.Obtain(context.Background()); err != nil {
+		t.Fatalf("Obtain failed: %v", err)
+	}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "car.example.com"})
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	if cert.Leaf.DNSNames[0] != "car.example.com" || m.needsRenewal() {
+		t.Errorf("Unexpected certificate for %v expiring %v", cert.Leaf.DNSNames, cert.Leaf.NotAfter)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "car.example.com", SupportedProtos: []string{ALPNProto}}); err == nil {
+		t.Error("Expected the challenge certificate to be removed")
+	}
+
+	// A restart reuses the cached certificate
+	reloaded := newTestManager(t, ca, cacheDir)
+	if reloaded.Expiry() != m.Expiry() {
+		t.Errorf("Expected the cached certificate, got expiry %v", reloaded.Expiry())
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		err    string
+	}{
+		{Config{}, ""},
+		{Config{Hostname: "car.example.com", AcceptTerms: true}, ""},
+		{Config{Hostname: "car.example.com"}, "accept_terms"},
+		{Config{Hostname: "https://car.example.com", AcceptTerms: true}, "fully qualified"},
+		{Config{Hostname: "car.example.com", AcceptTerms: true, DirectoryURL: "http://ca"}, "https URL"},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt.config, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%+v: expected error containing %q, got %v", tt.config, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// maxResponseSize bounds ACME response bodies
+const maxResponseSize = 1 << 20
+
+// idPeACMEIdentifier marks the tls-alpn-01 challenge certificate (RFC 8737)
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// directory lists the CA's endpoints
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// order is an ACME order for a certificate
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *problem `json:"error"`
+}
+
+// authorization is the CA's record of proving control of a hostname
+type authorization struct {
+	Status     string      `json:"status"`
+	Challenges []challenge `json:"challenges"`
+}
+
+// challenge is one way of proving control of a hostname
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *problem `json:"error"`
+}
+
+// problem is an ACME error document (RFC 7807)
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+// client speaks the ACME protocol with one account key
+type client struct {
+	httpClient   *http.Client
+	directoryURL string
+	key          *ecdsa.PrivateKey
+	pollInterval time.Duration
+
+	dir    directory
+	kid    string // Account URL, once registered
+	nonces []string
+}
+
+// register fetches the directory and creates or finds the account
+func (c *client) register(ctx context.Context, email string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.directoryURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch ACME directory: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ACME directory returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&c.dir); err != nil {
+		return fmt.Errorf("invalid ACME directory: %w", err)
+	}
+
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if email != "" {
+		account["contact"] = []string{"mailto:" + email}
+	}
+	_, header, err := c.post(ctx, c.dir.NewAccount, account, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register ACME account: %w", err)
+	}
+	c.kid = header.Get("Location")
+	if c.kid == "" {
+		return fmt.Errorf("ACME account response has no location")
+	}
+	return nil
+}
+
+// order proves control of hostname and returns the PEM certificate chain
+// for key. setChallenge installs the tls-alpn-01 certificate while the CA
+// validates, and clears it after.
+func (c *client) order(ctx context.Context, hostname string, key crypto.Signer, setChallenge func(*tls.Certificate)) ([]byte, error) {
+	var o order
+	identifiers := []map[string]string{{"type": "dns", "value": hostname}}
+	_, header, err := c.post(ctx, c.dir.NewOrder, map[string]interface{}{"identifiers": identifiers}, &o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+	orderURL := header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(ctx, authzURL, hostname, setChallenge); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: hostname},
+		DNSNames: []string{hostname},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.post(ctx, o.Finalize, map[string]string{"csr": encode(csr)}, &o); err != nil {
+		return nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+	for o.Status != "valid" {
+		switch o.Status {
+		case "pending", "ready", "processing":
+		default:
+			if o.Error != nil {
+				return nil, fmt.Errorf("order %s: %w", o.Status, o.Error)
+			}
+			return nil, fmt.Errorf("order %s", o.Status)
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+		if _, _, err := c.post(ctx, orderURL, nil, &o); err != nil {
+			return nil, fmt.Errorf("failed to check order: %w", err)
+		}
+	}
+
+	chain, _, err := c.post(ctx, o.Certificate, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download certificate: %w", err)
+	}
+	return chain, nil
+}
+
+// authorize answers the tls-alpn-01 challenge for one authorization and
+// waits for the CA to validate it
+func (c *client) authorize(ctx context.Context, authzURL, hostname string, setChallenge func(*tls.Certificate)) error {
+	var authz authorization
+	if _, _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+		return fmt.Errorf("failed to fetch authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == "tls-alpn-01" {
+			chal = &authz.Challenges[i]
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("CA doesn't offer the tls-alpn-01 challenge")
+	}
+
+	cert, err := c.challengeCert(hostname, chal.Token)
+	if err != nil {
+		return err
+	}
+	setChallenge(cert)
+	defer setChallenge(nil)
+
+	if _, _, err := c.post(ctx, chal.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("failed to accept challenge: %w", err)
+	}
+	for {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		if _, _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+			return fmt.Errorf("failed to check authorization: %w", err)
+		}
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending":
+			continue
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Type == "tls-alpn-01" && ch.Error != nil {
+				return fmt.Errorf("validation of %s failed: %w", hostname, ch.Error)
+			}
+		}
+		return fmt.Errorf("authorization for %s is %s", hostname, authz.Status)
+	}
+}
+
+// challengeCert builds the self-signed certificate that proves the key
+// authorization for a token (RFC 8737 section 3)
+func (c *client) challengeCert(hostname, token string) (*tls.Certificate, error) {
+	thumbprint, err := c.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(token + "." + thumbprint))
+	value, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: hostname},
+		DNSNames:        []string{hostname},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: idPeACMEIdentifier, Critical: true, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, c.key.Public(), c.key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: c.key}, nil
+}
+
+// post sends a JWS-signed request and decodes the JSON response into out,
+// if given. A nil payload sends a POST-as-GET. It returns the raw body and
+// headers.
+func (c *client) post(ctx context.Context, url string, payload, out interface{}) ([]byte, http.Header, error) {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A stale nonce is retried once with a fresh one
+	for attempt := 0; ; attempt++ {
+		data, header, err := c.send(ctx, url, body)
+		var p *problem
+		if attempt == 0 && errors.As(err, &p) && p.Type == "urn:ietf:params:acme:error:badNonce" {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if out != nil {
+			if err := json.Unmarshal(data, out); err != nil {
+				return nil, nil, fmt.Errorf("invalid response from %s: %w", url, err)
+			}
+		}
+		return data, header, nil
+	}
+}
+
+// send makes one signed request
+func (c *client) send(ctx context.Context, url string, payload []byte) ([]byte, http.Header, error) {
+	nonce, err := c.nonce(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	signed, err := c.sign(url, nonce, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(signed))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.nonces = append(c.nonces, nonce)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		p := &problem{}
+		if json.Unmarshal(data, p) != nil || p.Type == "" {
+			return nil, nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil, nil, p
+	}
+	return data, resp.Header, nil
+}
+
+// nonce returns an unused anti-replay nonce
+func (c *client) nonce(ctx context.Context) (string, error) {
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", c.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nonce: %w", err)
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("CA returned no nonce")
+	}
+	return nonce, nil
+}
+
+// sign wraps a payload in a flattened JWS (RFC 7515) signed with ES256
+func (c *client) sign(url, nonce string, payload []byte) ([]byte, error) {
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		jwk, err := c.jwk()
+		if err != nil {
+			return nil, err
+		}
+		protected["jwk"] = jwk
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	input := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return json.Marshal(map[string]string{
+		"protected": encode(header),
+		"payload":   encode(payload),
+		"signature": encode(signature),
+	})
+}
+
+// jwk returns the account's public key as a JSON Web Key
+func (c *client) jwk() (map[string]string, error) {
+	public, err := c.key.PublicKey.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	point := public.Bytes() // 0x04 || X || Y
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   encode(point[1:33]),
+		"y":   encode(point[33:]),
+	}, nil
+}
+
+// thumbprint returns the account key's JWK thumbprint (RFC 7638)
+func (c *client) thumbprint() (string, error) {
+	jwk, err := c.jwk()
+	if err != nil {
+		return "", err
+	}
+	// Members in lexicographic order, without whitespace
+	canonical := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, jwk["x"], jwk["y"])
+	digest := sha256.Sum256([]byte(canonical))
+	return encode(digest[:]), nil
+}
+
+// wait pauses between polls
+func (c *client) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.pollInterval):
+		return nil
+	}
+}
+
+// encode is unpadded base64url
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
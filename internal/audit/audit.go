@@ -0,0 +1,312 @@
+// Package audit keeps a durable log of the changes made through the API:
+// who sent which request, with what parameters, and how it turned out.
+//
+// Entries are appended to a JSON Lines file and synced before Record
+// returns, so they survive a crash. The most recent entries are kept in
+// memory for queries, and the file is rewritten without older entries once
+// it holds twice as many as are kept.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries is how many entries are kept when max_entries isn't set
+const DefaultMaxEntries = 10000
+
+// maxLineSize bounds one line of the log file
+const maxLineSize = 64 * 1024
+
+// Config controls how much of the audit log is kept
+type Config struct {
+	MaxEntries int `json:"max_entries,omitempty"` // Entries kept; oldest are dropped first
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("max_entries must be non-negative")
+	}
+	return nil
+}
+
+// Results of a request
+const (
+	ResultOK       = "ok"
+	ResultAccepted = "accepted" // Queued to run asynchronously
+	ResultError    = "error"
+)
+
+// Entry is one request that changed something
+type Entry struct {
+	Time      time.Time       `json:"time"`
+	Method    string          `json:"method"`
+	Endpoint  string          `json:"endpoint"`
+	Query     string          `json:"query,omitempty"`
+	VIN       string          `json:"vin,omitempty"`
+	Principal string          `json:"principal,omitempty"` // Username, or key:<name> for API keys; empty without auth
+	RemoteIP  string          `json:"remote_ip,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"` // The request body, with secrets redacted
+	Status    int             `json:"status"`
+	Result    string          `json:"result"`
+	Error     string          `json:"error,omitempty"`
+	LatencyMS int64           `json:"latency_ms"`
+}
+
+// Query selects entries. Zero fields don't filter.
+type Query struct {
+	Since     time.Time // Inclusive
+	Until     time.Time // Exclusive
+	Principal string
+	VIN       string
+	Limit     int // Most recent entries to return
+}
+
+// matches reports whether an entry is selected by the query
+func (q Query) matches(e Entry) bool {
+	switch {
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	case q.Principal != "" && e.Principal != q.Principal:
+		return false
+	case q.VIN != "" && e.VIN != q.VIN:
+		return false
+	}
+	return true
+}
+
+// Log is the audit log
+type Log struct {
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	lines   int
+	max     int
+	entries []Entry
+}
+
+// Open loads the log at path, creating it if needed. With an empty path the
+// log is only kept in memory.
+func Open(path string, config Config) (*Log, error) {
+	l := &Log{path: path, max: config.MaxEntries}
+	if l.max <= 0 {
+		l.max = DefaultMaxEntries
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads the existing entries. Lines that don't parse, such as one cut
+// short by a crash, are skipped.
+func (l *Log) load() error {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		l.lines++
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			l.add(entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// open opens the file for appending
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.file = file
+	return nil
+}
+
+// add keeps an entry in memory, dropping the oldest beyond the limit
+func (l *Log) add(entry Entry) {
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.max {
+		l.entries = append(l.entries[:0:0], l.entries[len(l.entries)-l.max:]...)
+	}
+}
+
+// Record appends an entry to the log
+func (l *Log) Record(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.add(entry)
+	if l.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	l.lines++
+
+	if l.lines > 2*l.max {
+		return l.compact()
+	}
+	return nil
+}
+
+// compact rewrites the file with only the entries kept, atomically
+func (l *Log) compact() error {
+	tmp := l.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to compact audit log: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range l.entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, l.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compact audit log: %w", err)
+	}
+
+	l.file.Close()
+	l.lines = len(l.entries)
+	return l.open()
+}
+
+// Query returns the selected entries, oldest first
+func (l *Log) Query(query Query) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := []Entry{}
+	for _, entry := range l.entries {
+		if query.matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[len(result)-query.Limit:]
+	}
+	return result
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// redacted replaces secret values in recorded parameters
+const redacted = "[redacted]"
+
+// secretFields are substrings of parameter names whose values aren't
+// recorded
+var secretFields = []string{"password", "secret", "token", "key"}
+
+// RedactParams returns a JSON request body with the values of secret-looking
+// fields, at any depth, replaced. Bodies that aren't JSON return nil.
+func RedactParams(body []byte) json.RawMessage {
+	var params interface{}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil
+	}
+	data, err := json.Marshal(redact(params))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// redact replaces secret values in a decoded JSON value
+func redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, field := range v {
+			if isSecret(name) {
+				v[name] = redacted
+			} else {
+				v[name] = redact(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item)
+		}
+	}
+	return value
+}
+
+// isSecret reports whether a field name looks like it holds a secret
+func isSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range secretFields {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func entryAt(t time.Time, principal string) Entry {
+	return Entry{Time: t, Method: "POST", Endpoint: "/hvac/climate", VIN: "TEST_VIN", Principal: principal, Status: 200, Result: ResultOK}
+}
+
+func TestLogQuery(t *testing.T) {
+	l, err := Open("", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	l.Record(entryAt(base, "alice"))
+	l.Record(entryAt(base.Add(time.Minute), "bob"))
+	l.Record(entryAt(base.Add(2*time.Minute), "alice"))
+
+	if entries := l.Query(Query{Principal: "alice"}); len(entries) != 2 {
+		t.Errorf("Expected alice's two entries, got %+v", entries)
+	}
+	if entries := l.Query(Query{Since: base.Add(time.Minute), Until: base.Add(2 * time.Minute)}); len(entries) != 1 || entries[0].Principal != "bob" {
+		t.Errorf("Expected bob's entry, got %+v", entries)
+	}
+	if entries := l.Query(Query{Limit: 1}); len(entries) != 1 || !entries[0].Time.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("Expected the latest entry, got %+v", entries)
+	}
+	if entries := l.Query(Query{VIN: "OTHER_VIN"}); entries == nil || len(entries) != 0 {
+		t.Errorf("Expected an empty list, got %#v", entries)
+	}
+}
+
+func TestLogReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "audit.jsonl")
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+
+	l, err := Open(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := entryAt(base, "alice")
+	entry.Params = json.RawMessage(`{"on":true}`)
+	entry.LatencyMS = 1200
+	if err := l.Record(entry); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// A line cut short by a crash is skipped
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString(`{"time": "2026`)
+	file.Close()
+
+	l, err = Open(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	entries := l.Query(Query{})
+	if len(entries) != 1 || string(entries[0].Params) != `{"on":true}` || entries[0].LatencyMS != 1200 {
+		t.Errorf("Expected the entry to survive a reopen, got %+v", entries)
+	}
+}
+
+func TestLogCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+
+	l, err := Open(path, Config{MaxEntries: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < 11; i++ {
+		if err := l.Record(entryAt(base.Add(time.Duration(i)*time.Minute), "alice")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 5 {
+		t.Errorf("Expected the file to be compacted to 5 entries, it has %d", lines)
+	}
+	if entries := l.Query(Query{}); len(entries) != 5 || !entries[0].Time.Equal(base.Add(6*time.Minute)) {
+		t.Errorf("Expected the five newest entries, got %+v", entries)
+	}
+
+	// Appends after a compaction go to the new file
+	l.Record(entryAt(base.Add(time.Hour), "bob"))
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), `"principal":"bob"`) {
+		t.Error("Expected the new entry in the compacted file")
+	}
+}
+
+func TestRedactParams(t *testing.T) {
+	params := RedactParams([]byte(`{"name": "kiosk", "password": "hunter22", "nested": [{"api_key": "abc", "level": 2}]}`))
+	if strings.Contains(string(params), "hunter22") || strings.Contains(string(params), "abc") {
+		t.Errorf("Expected secrets to be redacted, got %s", params)
+	}
+	if !strings.Contains(string(params), `"name":"kiosk"`) || !strings.Contains(string(params), `"level":2`) {
+		t.Errorf("Expected other fields to be kept, got %s", params)
+	}
+	if params := RedactParams([]byte("not json")); params != nil {
+		t.Errorf("Expected nil for a body that isn't JSON, got %s", params)
+	}
+}
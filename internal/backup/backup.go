@@ -0,0 +1,265 @@
+// Package backup reads and writes passphrase-encrypted archives of local
+// state, so an installation can be moved to new storage in one step.
+//
+// An archive is a gzipped tar stream, sealed with AES-256-GCM under a key
+// derived from the passphrase with PBKDF2-HMAC-SHA256. The header (magic,
+// salt, iteration count and nonce) is authenticated along with the payload.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/kdf"
+)
+
+const (
+	// magic identifies the archive format and version
+	magic = "TESLABK1"
+
+	// DefaultIterations is the PBKDF2 iteration count for new archives
+	DefaultIterations = 600000
+
+	// minIterations rejects archives with a weakened key derivation
+	minIterations = 100000
+
+	saltSize     = 16
+	keySize      = 32
+	manifestName = "manifest.json"
+
+	// maxArchiveSize bounds how much of an archive is read into memory
+	maxArchiveSize = 1 << 30
+)
+
+// ErrDecrypt is returned when an archive can't be decrypted, either because
+// the passphrase is wrong or the archive was modified
+var ErrDecrypt = errors.New("wrong passphrase or corrupted archive")
+
+// Entry kinds
+const (
+	KindConfig       = "config"
+	KindToken        = "token"
+	KindData         = "data"
+	KindKeyReference = "key_reference" // Path only; key material isn't archived
+)
+
+// Entry is a file in an archive
+type Entry struct {
+	Name string `json:"name"` // Path within the archive
+	Kind string `json:"kind"`
+	Path string `json:"path"` // Original location
+	Mode int64  `json:"mode,omitempty"`
+	Data []byte `json:"-"`
+}
+
+// Manifest describes an archive's contents
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Archive is a decrypted backup
+type Archive struct {
+	Manifest
+}
+
+// Find returns the entries of the given kind, ordered by name
+func (a *Archive) Find(kind string) []Entry {
+	var entries []Entry
+	for _, entry := range a.Entries {
+		if entry.Kind == kind {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Write encrypts entries into an archive written to w
+func Write(w io.Writer, passphrase string, entries []Entry) error {
+	return writeArchive(w, passphrase, entries, DefaultIterations)
+}
+
+// writeArchive encrypts entries with the given key derivation cost
+func writeArchive(w io.Writer, passphrase string, entries []Entry, iterations int) error {
+	if passphrase == "" {
+		return fmt.Errorf("passphrase is required")
+	}
+
+	payload, err := pack(entries)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(magic)+saltSize+4)
+	copy(header, magic)
+	salt := header[len(magic) : len(magic)+saltSize]
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	binary.BigEndian.PutUint32(header[len(magic)+saltSize:], uint32(iterations))
+
+	aead, err := newAEAD(passphrase, salt, iterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header = append(header, nonce...)
+
+	sealed := aead.Seal(nil, nonce, payload, header)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := w.Write(sealed); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// Read decrypts an archive
+func Read(r io.Reader, passphrase string) (*Archive, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	headerSize := len(magic) + saltSize + 4
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a backup archive")
+	}
+	salt := data[len(magic) : len(magic)+saltSize]
+	iterations := int(binary.BigEndian.Uint32(data[len(magic)+saltSize:]))
+	if iterations < minIterations {
+		return nil, fmt.Errorf("archive key derivation is too weak (%d iterations)", iterations)
+	}
+
+	aead, err := newAEAD(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	headerSize += aead.NonceSize()
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("not a backup archive")
+	}
+	header, sealed := data[:headerSize], data[headerSize:]
+
+	payload, err := aead.Open(nil, header[headerSize-aead.NonceSize():], sealed, header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return unpack(payload)
+}
+
+// newAEAD derives the archive key and returns its cipher
+func newAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key := kdf.PBKDF2SHA256([]byte(passphrase), salt, iterations, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pack writes the manifest and entries to a gzipped tar stream
+func pack(entries []Entry) ([]byte, error) {
+	manifest, err := json.MarshalIndent(Manifest{CreatedAt: time.Now().UTC(), Entries: entries}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	files := []Entry{{Name: manifestName, Mode: 0600, Data: manifest}}
+	for _, entry := range entries {
+		if entry.Kind != KindKeyReference {
+			files = append(files, entry)
+		}
+	}
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.Name,
+			Mode:    file.Mode,
+			Size:    int64(len(file.Data)),
+			ModTime: time.Now(),
+		}
+		if header.Mode == 0 {
+			header.Mode = 0600
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", file.Name, err)
+		}
+		if _, err := tw.Write(file.Data); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", file.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpack reads the manifest and fills in each entry's data
+func unpack(payload []byte) (*Archive, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive payload: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive payload: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive payload: %w", err)
+		}
+		files[header.Name] = data
+	}
+
+	var archive Archive
+	manifest, ok := files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("archive has no manifest")
+	}
+	if err := json.Unmarshal(manifest, &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	for i, entry := range archive.Entries {
+		if entry.Kind == KindKeyReference {
+			continue
+		}
+		data, ok := files[entry.Name]
+		if !ok {
+			return nil, fmt.Errorf("archive is missing %s", entry.Name)
+		}
+		archive.Entries[i].Data = data
+	}
+	return &archive, nil
+}
@@ -0,0 +1,78 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testEntries() []Entry {
+	return []Entry{
+		{Name: "config.json", Kind: KindConfig, Path: "/etc/tesla/config.json", Data: []byte(`{"tesla":{}}`)},
+		{Name: "token", Kind: KindToken, Path: "/etc/tesla/token", Data: []byte("secret-token")},
+		{Name: "data/presets.json", Kind: KindData, Path: "presets.json", Data: []byte("[]")},
+		{Name: "key", Kind: KindKeyReference, Path: "/etc/tesla/private_key.pem"},
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, "correct horse", testEntries(), minIterations); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret-token")) {
+		t.Fatal("Archive contains plaintext")
+	}
+
+	archive, err := Read(bytes.NewReader(buf.Bytes()), "correct horse")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(archive.Entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(archive.Entries))
+	}
+
+	tokens := archive.Find(KindToken)
+	if len(tokens) != 1 || string(tokens[0].Data) != "secret-token" || tokens[0].Path != "/etc/tesla/token" {
+		t.Errorf("Unexpected token entries: %+v", tokens)
+	}
+	keys := archive.Find(KindKeyReference)
+	if len(keys) != 1 || keys[0].Data != nil || keys[0].Path != "/etc/tesla/private_key.pem" {
+		t.Errorf("Expected key reference without data, got %+v", keys)
+	}
+}
+
+func TestArchiveWrongPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, "correct horse", testEntries(), minIterations); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), "battery staple"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt, got %v", err)
+	}
+
+	// The header is authenticated too
+	tampered := append([]byte(nil), buf.Bytes()...)
+	tampered[len(magic)] ^= 1
+	if _, err := Read(bytes.NewReader(tampered), "correct horse"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for tampered salt, got %v", err)
+	}
+}
+
+func TestArchiveRejectsInvalidInput(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "", testEntries()); err == nil {
+		t.Error("Expected error for empty passphrase")
+	}
+	if _, err := Read(bytes.NewReader([]byte("not an archive")), "x"); err == nil {
+		t.Error("Expected error for non-archive input")
+	}
+
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, "x", testEntries(), 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()), "x"); err == nil {
+		t.Error("Expected error for weak key derivation")
+	}
+}
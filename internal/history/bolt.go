@@ -0,0 +1,231 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Top-level buckets, each holding a bucket of records per vehicle
+var (
+	samplesBucket  = []byte("samples")
+	commandsBucket = []byte("commands")
+)
+
+// Bolt is a Store that keeps history in an embedded BoltDB file, so it
+// survives restarts. A vehicle's records are keyed by time then ID, so a
+// time range is read with one seek and the oldest records are trimmed from
+// the front.
+type Bolt struct {
+	db        *bolt.DB
+	max       int
+	retention time.Duration
+}
+
+// OpenBolt opens the history database at path, creating it and its
+// directory if needed, and applies the config's limits to it
+func OpenBolt(path string, config Config) (*Bolt, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	// Another server holding the file would block forever without a timeout
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+
+	b := &Bolt{db: db, max: config.maxSamples(), retention: config.retention()}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{samplesBucket, commandsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+
+	// Limits may have been lowered since the records were written
+	if err := b.Prune(time.Now()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Close closes the database
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// Add implements Store
+func (b *Bolt) Add(sample Sample) error {
+	return boltAdd(b, samplesBucket, sample, func(s *Sample, id uint64) { s.ID = id })
+}
+
+// Query implements Store
+func (b *Bolt) Query(query Query) ([]Sample, error) {
+	return boltQuery[Sample](b, samplesBucket, query)
+}
+
+// AddCommand implements Store
+func (b *Bolt) AddCommand(command Command) error {
+	return boltAdd(b, commandsBucket, command, func(c *Command, id uint64) { c.ID = id })
+}
+
+// Commands implements Store
+func (b *Bolt) Commands(query Query) ([]Command, error) {
+	return boltQuery[Command](b, commandsBucket, query)
+}
+
+// Prune implements Store. It also trims each vehicle to the record limit,
+// and drops the buckets of vehicles left with no records.
+func (b *Bolt) Prune(now time.Time) error {
+	cutoff := now.Add(-b.retention)
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{samplesBucket, commandsBucket} {
+			parent := tx.Bucket(name)
+			var empty [][]byte
+			err := parent.ForEachBucket(func(vin []byte) error {
+				vehicle := parent.Bucket(vin)
+				if err := trim(vehicle, cutoff, b.max); err != nil {
+					return err
+				}
+				if k, _ := vehicle.Cursor().First(); k == nil {
+					empty = append(empty, vin)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, vin := range empty {
+				if err := parent.DeleteBucket(vin); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prune history: %w", err)
+	}
+	return nil
+}
+
+// boltAdd stores r in its vehicle's bucket under kind with the kind's next
+// ID, then drops the vehicle's records that are older than retention
+// before it, or beyond max
+func boltAdd[T record](b *Bolt, kind []byte, r T, setID func(*T, uint64)) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		parent := tx.Bucket(kind)
+		id, err := parent.NextSequence()
+		if err != nil {
+			return err
+		}
+		setID(&r, id)
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		vehicle, err := parent.CreateBucketIfNotExists([]byte(r.vehicle()))
+		if err != nil {
+			return err
+		}
+		if err := vehicle.Put(recordKey(r.timestamp(), id), data); err != nil {
+			return err
+		}
+		return trim(vehicle, r.timestamp().Add(-b.retention), b.max)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// boltQuery returns the records under kind selected by q, in time order
+func boltQuery[T record](b *Bolt, kind []byte, q Query) ([]T, error) {
+	result := []T{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		parent := tx.Bucket(kind)
+		return parent.ForEachBucket(func(vin []byte) error {
+			if q.VIN != "" && string(vin) != q.VIN {
+				return nil
+			}
+			c := parent.Bucket(vin).Cursor()
+			k, v := c.First()
+			if !q.Since.IsZero() {
+				k, v = c.Seek(timeKey(q.Since))
+			}
+			for ; k != nil; k, v = c.Next() {
+				if !q.Until.IsZero() && !keyTime(k).Before(q.Until) {
+					break
+				}
+				var r T
+				if err := json.Unmarshal(v, &r); err != nil {
+					return err
+				}
+				result = append(result, r)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	sortRecords(result)
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result, nil
+}
+
+// trim deletes a vehicle's records older than cutoff, then its oldest ones
+// beyond max
+func trim(vehicle *bolt.Bucket, cutoff time.Time, max int) error {
+	var keep int
+	var dropped [][]byte
+	c := vehicle.Cursor()
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		if keep < max && !keyTime(k).Before(cutoff) {
+			keep++
+			continue
+		}
+		dropped = append(dropped, k)
+	}
+	// Deleting under a cursor can skip keys, so delete once it's done
+	for _, k := range dropped {
+		if err := vehicle.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeKey encodes t so that keys sort in time order, including before 1970
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano())^(1<<63))
+	return key
+}
+
+// recordKey is a record's key: its time, then its ID for records at the
+// same time
+func recordKey(t time.Time, id uint64) []byte {
+	return binary.BigEndian.AppendUint64(timeKey(t), id)
+}
+
+// keyTime returns the time a key was made from
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])^(1<<63)))
+}
@@ -0,0 +1,115 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "history.db")
+	base := time.Now().UTC().Truncate(time.Second)
+
+	store, err := OpenBolt(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add(Sample{Time: base, VIN: "VIN_A", InsideTempCelsius: 18.5, ClimateOn: true})
+	store.AddCommand(Command{Time: base, VIN: "VIN_A", Name: "climate_on"})
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenBolt(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	samples, _ := store.Query(Query{VIN: "VIN_A"})
+	if len(samples) != 1 || samples[0].InsideTempCelsius != 18.5 || !samples[0].ClimateOn || !samples[0].Time.Equal(base) {
+		t.Errorf("Expected the sample to survive a reopen, got %+v", samples)
+	}
+	commands, _ := store.Commands(Query{})
+	if len(commands) != 1 || commands[0].Name != "climate_on" {
+		t.Errorf("Expected the command to survive a reopen, got %+v", commands)
+	}
+
+	// IDs carry on from before the reopen
+	store.Add(Sample{Time: base, VIN: "VIN_A"})
+	samples, _ = store.Query(Query{})
+	if len(samples) != 2 || samples[0].ID == samples[1].ID {
+		t.Errorf("Expected samples at the same time to have their own IDs, got %+v", samples)
+	}
+}
+
+func TestBoltQuery(t *testing.T) {
+	store, err := OpenBolt(filepath.Join(t.TempDir(), "history.db"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	base := time.Now().UTC().Truncate(time.Minute).Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		store.Add(Sample{Time: base.Add(time.Duration(i) * time.Minute), VIN: "VIN_A", InsideTempCelsius: float32(i)})
+	}
+	store.Add(Sample{Time: base.Add(90 * time.Second), VIN: "VIN_B"})
+
+	all, _ := store.Query(Query{})
+	if len(all) != 5 || all[2].VIN != "VIN_B" {
+		t.Errorf("Expected every vehicle in time order, got %+v", all)
+	}
+
+	ranged, _ := store.Query(Query{VIN: "VIN_A", Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)})
+	if len(ranged) != 2 || ranged[0].InsideTempCelsius != 1 || ranged[1].InsideTempCelsius != 2 {
+		t.Errorf("Expected the samples from minute 1 up to 3, got %+v", ranged)
+	}
+
+	latest, _ := store.Query(Query{VIN: "VIN_A", Limit: 1})
+	if len(latest) != 1 || latest[0].InsideTempCelsius != 3 {
+		t.Errorf("Expected the most recent sample, got %+v", latest)
+	}
+}
+
+func TestBoltLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	base := time.Now().UTC().Truncate(time.Minute).Add(-time.Hour)
+
+	store, err := OpenBolt(path, Config{MaxSamples: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		if err := store.Add(Sample{Time: base.Add(time.Duration(i) * time.Minute), VIN: "VIN_A"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	samples, _ := store.Query(Query{})
+	if len(samples) != 10 || !samples[9].Time.Equal(base.Add(24*time.Minute)) {
+		t.Errorf("Expected the ten newest samples, got %d", len(samples))
+	}
+	store.Close()
+
+	// A lower limit applies on reopening
+	store, err = OpenBolt(path, Config{MaxSamples: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	samples, _ = store.Query(Query{})
+	if len(samples) != 4 || !samples[0].Time.Equal(base.Add(21*time.Minute)) {
+		t.Errorf("Expected the four newest samples after reopening, got %+v", samples)
+	}
+
+	// Pruning drops records past the retention period, and their vehicle
+	store.AddCommand(Command{Time: base, VIN: "VIN_B", Name: "climate_on"})
+	if err := store.Prune(base.Add(DefaultRetention + 22*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	samples, _ = store.Query(Query{})
+	commands, _ := store.Commands(Query{})
+	if len(samples) != 3 || len(commands) != 0 {
+		t.Errorf("Expected the records past retention to be pruned, got %d samples and %d commands", len(samples), len(commands))
+	}
+}
@@ -0,0 +1,282 @@
+// Package history keeps a time series of HVAC state samples and of the
+// commands sent to each vehicle.
+//
+// Samples are taken by a poller while the vehicle is reachable and added to
+// a Store, which the history API queries by vehicle and time range. Records
+// beyond the per-vehicle limit are dropped oldest first as records are
+// added, and records past the retention period are dropped when the store
+// is pruned, so a vehicle that stops reporting doesn't keep its history.
+package history
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSamples is how many samples, and how many commands, are kept
+// per vehicle when max_samples isn't set: a day at one sample every 30
+// seconds
+const DefaultMaxSamples = 2880
+
+// DefaultRetention is how long records are kept when retention isn't set
+const DefaultRetention = 30 * 24 * time.Hour
+
+// minPollInterval keeps the poller from hogging the vehicle's BLE link
+const minPollInterval = 10 * time.Second
+
+// Config controls state polling and how much history is kept. Polling is
+// disabled without an interval.
+type Config struct {
+	PollInterval time.Duration `json:"poll_interval,omitempty"` // Sample the state this often while reachable (0 disables)
+	MaxSamples   int           `json:"max_samples,omitempty"`   // Samples and commands kept per vehicle
+	Retention    time.Duration `json:"retention,omitempty"`     // Drop records older than this (30 days when 0)
+}
+
+// Enabled reports whether polling is configured
+func (c Config) Enabled() bool {
+	return c.PollInterval > 0
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if c.PollInterval < 0 {
+		return fmt.Errorf("poll_interval must be non-negative")
+	}
+	if c.PollInterval > 0 && c.PollInterval < minPollInterval {
+		return fmt.Errorf("poll_interval must be at least %v", minPollInterval)
+	}
+	if c.MaxSamples < 0 {
+		return fmt.Errorf("max_samples must be non-negative")
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("retention must be non-negative")
+	}
+	return nil
+}
+
+// maxSamples returns the per-vehicle limit
+func (c Config) maxSamples() int {
+	if c.MaxSamples <= 0 {
+		return DefaultMaxSamples
+	}
+	return c.MaxSamples
+}
+
+// retention returns how long records are kept
+func (c Config) retention() time.Duration {
+	if c.Retention <= 0 {
+		return DefaultRetention
+	}
+	return c.Retention
+}
+
+// Sample is the HVAC state of a vehicle at a point in time
+type Sample struct {
+	ID                 uint64    `json:"id"` // Assigned by the store, unique among its samples
+	Time               time.Time `json:"time"`
+	VIN                string    `json:"vin"`
+	InsideTempCelsius  float32   `json:"inside_temp_celsius"`
+	OutsideTempCelsius float32   `json:"outside_temp_celsius"`
+	ClimateOn          bool      `json:"climate_on"`
+	FanStatus          int32     `json:"fan_status"`
+}
+
+// Command is a command that reached a vehicle
+type Command struct {
+	ID   uint64    `json:"id"` // Assigned by the store, unique among its commands
+	Time time.Time `json:"time"`
+	VIN  string    `json:"vin"`
+	Name string    `json:"name"`
+}
+
+func (s Sample) timestamp() time.Time  { return s.Time }
+func (s Sample) vehicle() string       { return s.VIN }
+func (s Sample) id() uint64            { return s.ID }
+func (c Command) timestamp() time.Time { return c.Time }
+func (c Command) vehicle() string      { return c.VIN }
+func (c Command) id() uint64           { return c.ID }
+
+// record is a Sample or a Command
+type record interface {
+	timestamp() time.Time
+	vehicle() string
+	id() uint64
+}
+
+// sortRecords puts records in time order, and records at the same time in
+// the order they were added
+func sortRecords[T record](records []T) {
+	sort.Slice(records, func(i, j int) bool {
+		ti, tj := records[i].timestamp(), records[j].timestamp()
+		if ti.Equal(tj) {
+			return records[i].id() < records[j].id()
+		}
+		return ti.Before(tj)
+	})
+}
+
+// Query selects records. Zero fields don't filter.
+type Query struct {
+	VIN   string
+	Since time.Time // Inclusive
+	Until time.Time // Exclusive
+	Limit int       // Most recent records to return
+}
+
+// matches reports whether a record is selected by the query's VIN and range
+func (q Query) matches(r record) bool {
+	if q.VIN != "" && r.vehicle() != q.VIN {
+		return false
+	}
+	if !q.Since.IsZero() && r.timestamp().Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.timestamp().Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Store records samples and commands and returns them in time order. It
+// gives each record an ID when it's added.
+type Store interface {
+	Add(sample Sample) error
+	Query(query Query) ([]Sample, error)
+	AddCommand(command Command) error
+	Commands(query Query) ([]Command, error)
+	// Prune drops every record older than the retention period at now
+	Prune(now time.Time) error
+}
+
+// series holds one kind of record per vehicle, in the order added
+type series[T record] struct {
+	byVIN map[string][]T
+}
+
+func newSeries[T record]() series[T] {
+	return series[T]{byVIN: make(map[string][]T)}
+}
+
+// add appends a record, then drops the vehicle's records that are older
+// than retention before it, or beyond max
+func (s series[T]) add(r T, max int, retention time.Duration) {
+	records := append(s.byVIN[r.vehicle()], r)
+
+	start := 0
+	if retention > 0 {
+		cutoff := r.timestamp().Add(-retention)
+		for start < len(records) && records[start].timestamp().Before(cutoff) {
+			start++
+		}
+	}
+	if len(records)-start > max {
+		start = len(records) - max
+	}
+	if start > 0 {
+		records = append(records[:0:0], records[start:]...)
+	}
+	s.byVIN[r.vehicle()] = records
+}
+
+// prune drops the records older than cutoff, and the vehicles left with none
+func (s series[T]) prune(cutoff time.Time) {
+	for vin, records := range s.byVIN {
+		start := 0
+		for start < len(records) && records[start].timestamp().Before(cutoff) {
+			start++
+		}
+		switch {
+		case start == len(records):
+			delete(s.byVIN, vin)
+		case start > 0:
+			s.byVIN[vin] = append(records[:0:0], records[start:]...)
+		}
+	}
+}
+
+// query returns the selected records in time order
+func (s series[T]) query(q Query) []T {
+	result := []T{}
+	for vin, records := range s.byVIN {
+		if q.VIN != "" && vin != q.VIN {
+			continue
+		}
+		for _, r := range records {
+			if q.matches(r) {
+				result = append(result, r)
+			}
+		}
+	}
+
+	sortRecords(result)
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[len(result)-q.Limit:]
+	}
+	return result
+}
+
+// Memory is a Store that keeps history in memory. It is lost on restart.
+type Memory struct {
+	mu        sync.RWMutex
+	max       int
+	retention time.Duration
+	lastID    uint64
+	samples   series[Sample]
+	commands  series[Command]
+}
+
+// NewMemory creates a store with the config's limits
+func NewMemory(config Config) *Memory {
+	return &Memory{
+		max:       config.maxSamples(),
+		retention: config.retention(),
+		samples:   newSeries[Sample](),
+		commands:  newSeries[Command](),
+	}
+}
+
+// Add implements Store
+func (m *Memory) Add(sample Sample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	sample.ID = m.lastID
+	m.samples.add(sample, m.max, m.retention)
+	return nil
+}
+
+// Query implements Store
+func (m *Memory) Query(query Query) ([]Sample, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.samples.query(query), nil
+}
+
+// AddCommand implements Store
+func (m *Memory) AddCommand(command Command) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	command.ID = m.lastID
+	m.commands.add(command, m.max, m.retention)
+	return nil
+}
+
+// Commands implements Store
+func (m *Memory) Commands(query Query) ([]Command, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.commands.query(query), nil
+}
+
+// Prune implements Store
+func (m *Memory) Prune(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := now.Add(-m.retention)
+	m.samples.prune(cutoff)
+	m.commands.prune(cutoff)
+	return nil
+}
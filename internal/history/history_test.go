@@ -0,0 +1,124 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"disabled", Config{}, true},
+		{"polling", Config{PollInterval: time.Minute, MaxSamples: 100}, true},
+		{"negative interval", Config{PollInterval: -time.Second}, false},
+		{"interval too short", Config{PollInterval: time.Second}, false},
+		{"negative max samples", Config{MaxSamples: -1}, false},
+		{"negative retention", Config{Retention: -time.Hour}, false},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestMemoryQuery(t *testing.T) {
+	store := NewMemory(Config{})
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		store.Add(Sample{Time: base.Add(time.Duration(i) * time.Minute), VIN: "VIN_A", InsideTempCelsius: float32(i)})
+	}
+	store.Add(Sample{Time: base.Add(90 * time.Second), VIN: "VIN_B"})
+
+	all, _ := store.Query(Query{})
+	if len(all) != 5 || all[2].VIN != "VIN_B" {
+		t.Errorf("Expected every sample in time order, got %+v", all)
+	}
+
+	samples, _ := store.Query(Query{VIN: "VIN_A", Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)})
+	if len(samples) != 2 || samples[0].InsideTempCelsius != 1 || samples[1].InsideTempCelsius != 2 {
+		t.Errorf("Expected the samples at 06:01 and 06:02, got %+v", samples)
+	}
+
+	samples, _ = store.Query(Query{VIN: "VIN_A", Limit: 1})
+	if len(samples) != 1 || samples[0].InsideTempCelsius != 3 {
+		t.Errorf("Expected the latest sample, got %+v", samples)
+	}
+
+	if samples, _ := store.Query(Query{VIN: "VIN_C"}); samples == nil || len(samples) != 0 {
+		t.Errorf("Expected an empty list, got %#v", samples)
+	}
+}
+
+func TestMemoryMaxSamples(t *testing.T) {
+	store := NewMemory(Config{MaxSamples: 3})
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		store.Add(Sample{Time: base.Add(time.Duration(i) * time.Minute), VIN: "VIN_A", InsideTempCelsius: float32(i)})
+	}
+	store.Add(Sample{Time: base, VIN: "VIN_B"})
+
+	samples, _ := store.Query(Query{VIN: "VIN_A"})
+	if len(samples) != 3 || samples[0].InsideTempCelsius != 2 {
+		t.Errorf("Expected the three newest samples, got %+v", samples)
+	}
+	if samples, _ := store.Query(Query{VIN: "VIN_B"}); len(samples) != 1 {
+		t.Errorf("Expected other vehicles to keep their own samples, got %+v", samples)
+	}
+}
+
+func TestMemoryRetention(t *testing.T) {
+	store := NewMemory(Config{Retention: time.Hour})
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	store.Add(Sample{Time: base, VIN: "VIN_A"})
+	store.Add(Sample{Time: base.Add(30 * time.Minute), VIN: "VIN_A"})
+	store.Add(Sample{Time: base.Add(90 * time.Minute), VIN: "VIN_A"})
+
+	samples, _ := store.Query(Query{})
+	if len(samples) != 2 || !samples[0].Time.Equal(base.Add(30*time.Minute)) {
+		t.Errorf("Expected samples older than an hour to be dropped, got %+v", samples)
+	}
+}
+
+func TestMemoryPrune(t *testing.T) {
+	store := NewMemory(Config{})
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	store.Add(Sample{Time: base, VIN: "VIN_A"})
+	store.Add(Sample{Time: base.Add(DefaultRetention), VIN: "VIN_A"})
+	store.AddCommand(Command{Time: base, VIN: "VIN_B", Name: "climate_on"})
+
+	// Vehicles that stopped reporting lose their history too
+	store.Prune(base.Add(DefaultRetention + time.Minute))
+	if samples, _ := store.Query(Query{}); len(samples) != 1 || !samples[0].Time.Equal(base.Add(DefaultRetention)) {
+		t.Errorf("Expected only the sample within the default retention, got %+v", samples)
+	}
+	if commands, _ := store.Commands(Query{}); len(commands) != 0 {
+		t.Errorf("Expected the expired command to be dropped, got %+v", commands)
+	}
+	if _, ok := store.commands.byVIN["VIN_B"]; ok {
+		t.Error("Expected a vehicle with no records left to be forgotten")
+	}
+}
+
+func TestMemoryCommands(t *testing.T) {
+	store := NewMemory(Config{MaxSamples: 2})
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+	for i, name := range []string{"climate_on", "set_temperature", "climate_off"} {
+		store.AddCommand(Command{Time: base.Add(time.Duration(i) * time.Minute), VIN: "VIN_A", Name: name})
+	}
+
+	commands, _ := store.Commands(Query{VIN: "VIN_A"})
+	if len(commands) != 2 || commands[0].Name != "set_temperature" || commands[1].Name != "climate_off" {
+		t.Errorf("Expected the two newest commands, got %+v", commands)
+	}
+	if samples, _ := store.Query(Query{}); len(samples) != 0 {
+		t.Errorf("Expected commands to be kept apart from samples, got %+v", samples)
+	}
+}
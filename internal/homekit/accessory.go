@@ -0,0 +1,341 @@
+package homekit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Characteristic permissions
+const (
+	PermRead   = "pr"
+	PermWrite  = "pw"
+	PermEvents = "ev"
+)
+
+// Characteristic formats
+const (
+	FormatBool   = "bool"
+	FormatUInt8  = "uint8"
+	FormatFloat  = "float"
+	FormatString = "string"
+)
+
+// ErrInvalidValue is returned for a write whose value is out of range
+var ErrInvalidValue = errors.New("homekit: invalid value")
+
+// Characteristic is one value of a service. Values are bool, float64 or
+// string according to the format.
+type Characteristic struct {
+	Type        string // Short form of the HAP UUID
+	Perms       []string
+	Format      string
+	Unit        string
+	MinValue    *float64
+	MaxValue    *float64
+	MinStep     *float64
+	ValidValues []int
+
+	// OnWrite applies a value written by a controller. The value is only
+	// stored if it returns nil. Without it writes just store the value.
+	OnWrite func(ctx context.Context, value interface{}) error
+
+	iid    uint64
+	aid    uint64
+	notify func(c *Characteristic, except *conn)
+
+	mu    sync.Mutex
+	value interface{}
+}
+
+// Value returns the current value
+func (c *Characteristic) Value() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// SetValue updates the value, notifying subscribed controllers if it
+// changed
+func (c *Characteristic) SetValue(value interface{}) {
+	c.setValue(value, nil)
+}
+
+// setValue updates the value, notifying every subscribed controller except
+// the one that wrote it
+func (c *Characteristic) setValue(value interface{}, except *conn) {
+	c.mu.Lock()
+	changed := c.value != value
+	c.value = value
+	notify := c.notify
+	c.mu.Unlock()
+
+	if changed && notify != nil && c.has(PermEvents) {
+		notify(c, except)
+	}
+}
+
+// has reports whether the characteristic has a permission
+func (c *Characteristic) has(perm string) bool {
+	for _, p := range c.Perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// convert checks a value written by a controller and converts it to the
+// characteristic's format. Controllers may write booleans as 0 or 1.
+func (c *Characteristic) convert(value interface{}) (interface{}, error) {
+	switch c.Format {
+	case FormatBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+		return nil, ErrInvalidValue
+	case FormatString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return nil, ErrInvalidValue
+	}
+
+	v, ok := value.(float64)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+	if c.Format == FormatUInt8 && (v != math.Trunc(v) || v < 0 || v > 255) {
+		return nil, ErrInvalidValue
+	}
+	if (c.MinValue != nil && v < *c.MinValue) || (c.MaxValue != nil && v > *c.MaxValue) {
+		return nil, ErrInvalidValue
+	}
+	if len(c.ValidValues) > 0 {
+		valid := false
+		for _, allowed := range c.ValidValues {
+			valid = valid || float64(allowed) == v
+		}
+		if !valid {
+			return nil, ErrInvalidValue
+		}
+	}
+	return v, nil
+}
+
+// MarshalJSON encodes the characteristic for the accessory database
+func (c *Characteristic) MarshalJSON() ([]byte, error) {
+	out := struct {
+		IID         uint64      `json:"iid"`
+		Type        string      `json:"type"`
+		Perms       []string    `json:"perms"`
+		Format      string      `json:"format"`
+		Value       interface{} `json:"value,omitempty"`
+		Unit        string      `json:"unit,omitempty"`
+		MinValue    *float64    `json:"minValue,omitempty"`
+		MaxValue    *float64    `json:"maxValue,omitempty"`
+		MinStep     *float64    `json:"minStep,omitempty"`
+		ValidValues []int       `json:"valid-values,omitempty"`
+	}{
+		IID:         c.iid,
+		Type:        c.Type,
+		Perms:       c.Perms,
+		Format:      c.Format,
+		Unit:        c.Unit,
+		MinValue:    c.MinValue,
+		MaxValue:    c.MaxValue,
+		MinStep:     c.MinStep,
+		ValidValues: c.ValidValues,
+	}
+	// Write-only characteristics must not include a value
+	if c.has(PermRead) {
+		out.Value = c.Value()
+	}
+	return json.Marshal(out)
+}
+
+// Service groups characteristics
+type Service struct {
+	Type            string
+	Primary         bool
+	Characteristics []*Characteristic
+
+	iid uint64
+}
+
+// MarshalJSON encodes the service for the accessory database
+func (s *Service) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		IID             uint64            `json:"iid"`
+		Type            string            `json:"type"`
+		Primary         bool              `json:"primary,omitempty"`
+		Characteristics []*Characteristic `json:"characteristics"`
+	}{s.iid, s.Type, s.Primary, s.Characteristics})
+}
+
+// Accessory is one device: the bridge, or something behind it
+type Accessory struct {
+	Services []*Service
+
+	aid uint64
+}
+
+// AccessoryInfo describes an accessory
+type AccessoryInfo struct {
+	Name         string
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	Firmware     string
+}
+
+// NewAccessory creates an accessory with an information service
+func NewAccessory(info AccessoryInfo) *Accessory {
+	identify := &Characteristic{Type: "14", Perms: []string{PermWrite}, Format: FormatBool}
+	return &Accessory{Services: []*Service{{
+		Type: "3E",
+		Characteristics: []*Characteristic{
+			identify,
+			stringCharacteristic("20", info.Manufacturer),
+			stringCharacteristic("21", info.Model),
+			stringCharacteristic("23", info.Name),
+			stringCharacteristic("30", info.SerialNumber),
+			stringCharacteristic("52", info.Firmware),
+		},
+	}}}
+}
+
+// AddService adds a service to the accessory
+func (a *Accessory) AddService(s *Service) {
+	a.Services = append(a.Services, s)
+}
+
+// assign numbers the accessory and its services and characteristics
+func (a *Accessory) assign(aid uint64, notify func(*Characteristic, *conn)) {
+	a.aid = aid
+	iid := uint64(1)
+	for _, s := range a.Services {
+		s.iid = iid
+		iid++
+		for _, c := range s.Characteristics {
+			c.iid, c.aid = iid, aid
+			c.mu.Lock()
+			c.notify = notify
+			c.mu.Unlock()
+			iid++
+		}
+	}
+}
+
+// MarshalJSON encodes the accessory for the accessory database
+func (a *Accessory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		AID      uint64     `json:"aid"`
+		Services []*Service `json:"services"`
+	}{a.aid, a.Services})
+}
+
+// layout describes the accessory's structure, without values, so a change
+// can be detected
+func (a *Accessory) layout() string {
+	layout := fmt.Sprintf("%d:", a.aid)
+	for _, s := range a.Services {
+		layout += s.Type + "("
+		for _, c := range s.Characteristics {
+			layout += fmt.Sprintf("%s/%s/%v/%v,", c.Type, c.Format, c.Perms, c.ValidValues)
+		}
+		layout += ")"
+	}
+	return layout
+}
+
+// stringCharacteristic is a read-only string
+func stringCharacteristic(kind, value string) *Characteristic {
+	return &Characteristic{Type: kind, Perms: []string{PermRead}, Format: FormatString, value: value}
+}
+
+// float returns a pointer to v
+func float(v float64) *float64 {
+	return &v
+}
+
+// Thermostat is a thermostat service
+type Thermostat struct {
+	*Service
+	CurrentState       *Characteristic // Heating: 0 off, 1 heat, 2 cool
+	TargetState        *Characteristic // 0 off, 3 auto
+	CurrentTemperature *Characteristic // Celsius
+	TargetTemperature  *Characteristic // Celsius
+	DisplayUnits       *Characteristic // 0 Celsius, 1 Fahrenheit
+}
+
+// Heating states
+const (
+	HeatingOff  = 0
+	HeatingHeat = 1
+	HeatingCool = 2
+	HeatingAuto = 3
+)
+
+// NewThermostat creates a thermostat whose target temperature is limited to
+// minTemp to maxTemp Celsius. It can only be switched off or to auto.
+func NewThermostat(name string, minTemp, maxTemp float64) *Thermostat {
+	t := &Thermostat{
+		CurrentState: &Characteristic{
+			Type: "F", Perms: []string{PermRead, PermEvents}, Format: FormatUInt8,
+			MinValue: float(0), MaxValue: float(2), MinStep: float(1), value: float64(HeatingOff),
+		},
+		TargetState: &Characteristic{
+			Type: "33", Perms: []string{PermRead, PermWrite, PermEvents}, Format: FormatUInt8,
+			MinValue: float(0), MaxValue: float(3), MinStep: float(1),
+			ValidValues: []int{HeatingOff, HeatingAuto}, value: float64(HeatingOff),
+		},
+		CurrentTemperature: &Characteristic{
+			Type: "11", Perms: []string{PermRead, PermEvents}, Format: FormatFloat, Unit: "celsius",
+			MinValue: float(-50), MaxValue: float(100), MinStep: float(0.1), value: float64(0),
+		},
+		TargetTemperature: &Characteristic{
+			Type: "35", Perms: []string{PermRead, PermWrite, PermEvents}, Format: FormatFloat, Unit: "celsius",
+			MinValue: float(minTemp), MaxValue: float(maxTemp), MinStep: float(0.5), value: minTemp,
+		},
+		DisplayUnits: &Characteristic{
+			Type: "36", Perms: []string{PermRead, PermWrite, PermEvents}, Format: FormatUInt8,
+			MinValue: float(0), MaxValue: float(1), MinStep: float(1), value: float64(0),
+		},
+	}
+	t.Service = &Service{
+		Type:    "4A",
+		Primary: true,
+		Characteristics: []*Characteristic{
+			t.CurrentState, t.TargetState, t.CurrentTemperature, t.TargetTemperature, t.DisplayUnits,
+			stringCharacteristic("23", name),
+		},
+	}
+	return t
+}
+
+// Switch is an on/off switch service
+type Switch struct {
+	*Service
+	On *Characteristic
+}
+
+// NewSwitch creates a switch
+func NewSwitch(name string) *Switch {
+	s := &Switch{
+		On: &Characteristic{Type: "25", Perms: []string{PermRead, PermWrite, PermEvents}, Format: FormatBool, value: false},
+	}
+	s.Service = &Service{
+		Type:            "49",
+		Characteristics: []*Characteristic{s.On, stringCharacteristic("23", name)},
+	}
+	return s
+}
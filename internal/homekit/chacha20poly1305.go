@@ -0,0 +1,18 @@
+package homekit
+
+import (
+	"crypto/cipher"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// HAP encrypts everything with ChaCha20-Poly1305 (RFC 8439), which the
+// standard library doesn't export, so it comes from x/crypto
+
+var errOpen = errors.New("homekit: message authentication failed")
+
+// newAEAD returns the AEAD for a 32-byte key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.New(key)
+}
@@ -0,0 +1,137 @@
+package homekit
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+)
+
+// maxFrameSize is the most plaintext one encrypted frame carries
+const maxFrameSize = 1024
+
+// conn is a controller's connection. It is plain HTTP until pair verify
+// completes, then every message is sent in encrypted frames: a two-byte
+// little-endian length, which is also the additional data, followed by the
+// sealed payload. Each direction has its own key and counts its frames in
+// the nonce.
+type conn struct {
+	net.Conn
+
+	mu         sync.Mutex // Guards the fields below and serializes writes
+	readKey    cipher.AEAD
+	writeKey   cipher.AEAD
+	readCount  uint64
+	writeCount uint64
+	controller string                   // Paired controller ID, once verified
+	events     map[*Characteristic]bool // Characteristics the controller subscribed to
+	verify     *verifySession
+
+	pending []byte // Decrypted bytes not yet read
+}
+
+// newConn wraps a network connection
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c, events: make(map[*Characteristic]bool)}
+}
+
+// encrypt switches the connection to encrypted frames. Called after the
+// last plain response has been written.
+func (c *conn) encrypt(controller string, readKey, writeKey cipher.AEAD) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.controller = controller
+	c.readKey, c.writeKey = readKey, writeKey
+}
+
+// verified returns the controller ID, or "" before pair verify
+func (c *conn) verified() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.controller
+}
+
+// subscribe sets whether the controller receives events for a
+// characteristic
+func (c *conn) subscribe(ch *Characteristic, on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if on {
+		c.events[ch] = true
+	} else {
+		delete(c.events, ch)
+	}
+}
+
+// subscribed reports whether the controller receives events for a
+// characteristic
+func (c *conn) subscribed(ch *Characteristic) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.events[ch]
+}
+
+// Read implements net.Conn. Only one goroutine reads a connection.
+func (c *conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	key := c.readKey
+	c.mu.Unlock()
+	if key == nil {
+		return c.Conn.Read(b)
+	}
+
+	if len(c.pending) == 0 {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(c.Conn, header); err != nil {
+			return 0, err
+		}
+		length := int(binary.LittleEndian.Uint16(header))
+		if length > maxFrameSize {
+			return 0, errOpen
+		}
+		sealed := make([]byte, length+key.Overhead())
+		if _, err := io.ReadFull(c.Conn, sealed); err != nil {
+			return 0, err
+		}
+		plaintext, err := key.Open(sealed[:0], frameNonce(c.readCount), sealed, header)
+		if err != nil {
+			return 0, err
+		}
+		c.readCount++
+		c.pending = plaintext
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write implements net.Conn, writing b as one or more frames
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writeKey == nil {
+		return c.Conn.Write(b)
+	}
+
+	var out []byte
+	for rest := b; len(rest) > 0; {
+		n := min(len(rest), maxFrameSize)
+		header := binary.LittleEndian.AppendUint16(nil, uint16(n))
+		out = append(out, header...)
+		out = c.writeKey.Seal(out, frameNonce(c.writeCount), rest[:n], header)
+		c.writeCount++
+		rest = rest[n:]
+	}
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// frameNonce is the nonce for the nth frame: four zero bytes and the
+// little-endian count
+func frameNonce(count uint64) []byte {
+	return binary.LittleEndian.AppendUint64(make([]byte, 4), count)
+}
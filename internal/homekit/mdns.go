@@ -0,0 +1,327 @@
+package homekit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Controllers find the accessory with DNS service discovery over multicast
+// DNS (RFC 6762, RFC 6763). The responder answers queries for the _hap._tcp
+// service, the accessory's instance and its host name, and announces the
+// records again when they change, such as when the accessory is paired.
+
+// DNS record types
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+)
+
+const (
+	// dnsClassIN is the Internet class, and dnsCacheFlush marks records
+	// this responder alone owns
+	dnsClassIN    = 1
+	dnsCacheFlush = 0x8000
+	// Record lifetimes recommended by RFC 6762
+	hostTTL    = 120
+	serviceTTL = 4500
+)
+
+// hapService is the service type controllers browse for
+const hapService = "_hap._tcp.local."
+
+// mdnsAddress is the multicast DNS group
+var mdnsAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+var errDNS = errors.New("homekit: malformed DNS message")
+
+// dnsRecord is a resource record
+type dnsRecord struct {
+	name  string
+	kind  uint16
+	ttl   uint32
+	flush bool
+	data  []byte
+}
+
+// responder advertises the accessory
+type responder struct {
+	instance string // Service instance, such as Tesla._hap._tcp.local.
+	host     string // Host name, such as Tesla-1A2B3C.local.
+	port     int
+	txt      func() []string
+	addrs    func() []net.IP
+}
+
+// newResponder creates a responder for an accessory named name with the
+// pairing ID id, served on port
+func newResponder(name, id string, port int, txt func() []string) *responder {
+	hostLabel := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, name)
+	suffix := strings.ReplaceAll(id, ":", "")
+	return &responder{
+		instance: escapeLabel(name) + "." + hapService,
+		host:     hostLabel + "-" + suffix[len(suffix)-6:] + ".local.",
+		port:     port,
+		txt:      txt,
+		addrs:    localAddresses,
+	}
+}
+
+// escapeLabel makes a name usable as one label: dots become spaces and it
+// is cut to the 63 byte limit
+func escapeLabel(name string) string {
+	name = strings.ReplaceAll(name, ".", " ")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// localAddresses returns the IPv4 addresses of interfaces that are up and
+// support multicast
+func localAddresses() []net.IP {
+	var ips []net.IP
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				ips = append(ips, ipnet.IP.To4())
+			}
+		}
+	}
+	return ips
+}
+
+// run answers queries until ctx is cancelled, then says goodbye. A value on
+// changed announces the records again.
+func (r *responder) run(ctx context.Context, changed <-chan struct{}) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		<-ctx.Done()
+		conn.WriteToUDP(r.response(0, nil, 0), mdnsAddress)
+		conn.Close()
+	}()
+	go func() {
+		// Announce twice, a second apart, as RFC 6762 section 8.3 asks
+		for i := 0; i < 2; i++ {
+			conn.WriteToUDP(r.response(0, nil, serviceTTL), mdnsAddress)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				conn.WriteToUDP(r.response(0, nil, serviceTTL), mdnsAddress)
+			}
+		}
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		id, questions, ok := r.query(buf[:n])
+		if !ok {
+			continue
+		}
+		if from.Port != mdnsAddress.Port {
+			// A one-shot query from an ordinary resolver gets a unicast
+			// reply that echoes it
+			conn.WriteToUDP(r.response(id, questions, serviceTTL), from)
+		} else {
+			conn.WriteToUDP(r.response(0, nil, serviceTTL), mdnsAddress)
+		}
+	}
+}
+
+// query parses a message and reports whether it asks about this accessory,
+// returning its ID and raw questions
+func (r *responder) query(msg []byte) (id uint16, questions []byte, ok bool) {
+	if len(msg) < 12 || msg[2]&0x80 != 0 {
+		return 0, nil, false // Too short, or a response
+	}
+	count := int(binary.BigEndian.Uint16(msg[4:]))
+	offset := 12
+	for i := 0; i < count; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil || next+4 > len(msg) {
+			return 0, nil, false
+		}
+		kind := binary.BigEndian.Uint16(msg[next:])
+		offset = next + 4
+		if r.answers(name, kind) {
+			ok = true
+		}
+	}
+	return binary.BigEndian.Uint16(msg), msg[12:offset], ok
+}
+
+// answers reports whether a question is about this accessory
+func (r *responder) answers(name string, kind uint16) bool {
+	switch {
+	case strings.EqualFold(name, hapService), strings.EqualFold(name, "_services._dns-sd._udp.local."):
+		return kind == dnsTypePTR || kind == dnsTypeANY
+	case strings.EqualFold(name, r.instance):
+		return kind == dnsTypeSRV || kind == dnsTypeTXT || kind == dnsTypeANY
+	case strings.EqualFold(name, r.host):
+		return kind == dnsTypeA || kind == dnsTypeANY
+	}
+	return false
+}
+
+// records returns every record the responder owns
+func (r *responder) records(ttl uint32) []dnsRecord {
+	srv := binary.BigEndian.AppendUint16(nil, 0) // Priority
+	srv = binary.BigEndian.AppendUint16(srv, 0)  // Weight
+	srv = binary.BigEndian.AppendUint16(srv, uint16(r.port))
+	srv = appendName(srv, r.host)
+
+	var txt []byte
+	for _, entry := range r.txt() {
+		txt = append(txt, byte(len(entry)))
+		txt = append(txt, entry...)
+	}
+
+	records := []dnsRecord{
+		{name: "_services._dns-sd._udp.local.", kind: dnsTypePTR, ttl: ttl, data: appendName(nil, hapService)},
+		{name: hapService, kind: dnsTypePTR, ttl: ttl, data: appendName(nil, r.instance)},
+		{name: r.instance, kind: dnsTypeSRV, ttl: min(ttl, hostTTL), flush: true, data: srv},
+		{name: r.instance, kind: dnsTypeTXT, ttl: ttl, flush: true, data: txt},
+	}
+	for _, ip := range r.addrs() {
+		records = append(records, dnsRecord{name: r.host, kind: dnsTypeA, ttl: min(ttl, hostTTL), flush: true, data: ip.To4()})
+	}
+	return records
+}
+
+// response encodes an authoritative answer carrying every record. Replies
+// to one-shot queries echo the ID and questions.
+func (r *responder) response(id uint16, questions []byte, ttl uint32) []byte {
+	records := r.records(ttl)
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = binary.BigEndian.AppendUint16(msg, 0x8400) // Response, authoritative
+	qdcount := 0
+	if questions != nil {
+		qdcount = countQuestions(questions)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, uint16(qdcount))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(records)))
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	if qdcount > 0 {
+		msg = append(msg, questions...)
+	}
+
+	for _, record := range records {
+		class := uint16(dnsClassIN)
+		// One-shot replies must not set the cache flush bit
+		if record.flush && questions == nil {
+			class |= dnsCacheFlush
+		}
+		msg = appendName(msg, record.name)
+		msg = binary.BigEndian.AppendUint16(msg, record.kind)
+		msg = binary.BigEndian.AppendUint16(msg, class)
+		msg = binary.BigEndian.AppendUint32(msg, record.ttl)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(record.data)))
+		msg = append(msg, record.data...)
+	}
+	return msg
+}
+
+// countQuestions counts the questions in their uncompressed wire form.
+// Questions with compressed names aren't echoed.
+func countQuestions(questions []byte) int {
+	count := 0
+	for offset := 0; offset < len(questions); count++ {
+		for offset < len(questions) && questions[offset] != 0 {
+			if questions[offset]&0xc0 != 0 {
+				return 0
+			}
+			offset += 1 + int(questions[offset])
+		}
+		offset += 5 // Terminating zero, type and class
+	}
+	return count
+}
+
+// appendName encodes a name such as host.local. as labels
+func appendName(b []byte, name string) []byte {
+	// The instance label may contain dots escaped as spaces, so split on
+	// the service suffix first
+	var labels []string
+	if prefix, found := strings.CutSuffix(name, "."+hapService); found && prefix != "" {
+		labels = append([]string{prefix}, strings.Split(strings.TrimSuffix(hapService, "."), ".")...)
+	} else {
+		labels = strings.Split(strings.TrimSuffix(name, "."), ".")
+	}
+	for _, label := range labels {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// readName decodes a possibly compressed name at offset, returning it and
+// the offset after it
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errDNS
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) || jumps > 16 {
+				return "", 0, errDNS
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errDNS
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package homekit
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newTestResponder() *responder {
+	r := newResponder("Tesla Model.3", "1A:2B:3C:4D:5E:6F", 51826, func() []string {
+		return []string{"c#=1", "sf=1"}
+	})
+	r.addrs = func() []net.IP { return []net.IP{net.IPv4(192, 168, 1, 20)} }
+	return r
+}
+
+// dnsQuery encodes a query with one question
+func dnsQuery(id uint16, name string, kind uint16) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = append(msg, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0)
+	msg = appendName(msg, name)
+	msg = binary.BigEndian.AppendUint16(msg, kind)
+	return binary.BigEndian.AppendUint16(msg, dnsClassIN)
+}
+
+func TestResponderQuery(t *testing.T) {
+	r := newTestResponder()
+	if r.instance != "Tesla Model 3._hap._tcp.local." || r.host != "Tesla-Model-3-4D5E6F.local." {
+		t.Fatalf("Unexpected names %q and %q", r.instance, r.host)
+	}
+
+	tests := []struct {
+		name string
+		kind uint16
+		ok   bool
+	}{
+		{"_hap._tcp.local.", dnsTypePTR, true},
+		{"_HAP._tcp.local.", dnsTypePTR, true},
+		{"Tesla Model 3._hap._tcp.local.", dnsTypeTXT, true},
+		{"Tesla-Model-3-4D5E6F.local.", dnsTypeA, true},
+		{"_airplay._tcp.local.", dnsTypePTR, false},
+		{"_hap._tcp.local.", dnsTypeA, false},
+	}
+	for _, tt := range tests {
+		if _, _, ok := r.query(dnsQuery(1, tt.name, tt.kind)); ok != tt.ok {
+			t.Errorf("%s type %d: expected %v", tt.name, tt.kind, tt.ok)
+		}
+	}
+
+	// Responses are ignored
+	response := r.response(0, nil, serviceTTL)
+	if _, _, ok := r.query(response); ok {
+		t.Error("Expected responses to be ignored")
+	}
+}
+
+func TestResponderResponse(t *testing.T) {
+	r := newTestResponder()
+	query := dnsQuery(42, "_hap._tcp.local.", dnsTypePTR)
+	id, questions, _ := r.query(query)
+	msg := r.response(id, questions, serviceTTL)
+
+	if binary.BigEndian.Uint16(msg) != 42 || binary.BigEndian.Uint16(msg[4:]) != 1 {
+		t.Fatalf("Expected the ID and question to be echoed: %x", msg[:12])
+	}
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	if answers != 5 {
+		t.Fatalf("Expected 5 records, got %d", answers)
+	}
+
+	// Walk the records after the echoed question
+	offset := 12 + len(questions)
+	var names []string
+	for i := 0; i < answers; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kind := binary.BigEndian.Uint16(msg[next:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := msg[next+10 : next+10+length]
+		names = append(names, name)
+		switch kind {
+		case dnsTypePTR:
+			target, _, err := readName(data, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name == hapService && target != r.instance {
+				t.Errorf("Expected PTR to %q, got %q", r.instance, target)
+			}
+		case dnsTypeSRV:
+			if port := binary.BigEndian.Uint16(data[4:]); port != 51826 {
+				t.Errorf("Expected port 51826, got %d", port)
+			}
+		case dnsTypeTXT:
+			if !strings.Contains(string(data), "sf=1") {
+				t.Errorf("Unexpected TXT %q", data)
+			}
+		case dnsTypeA:
+			if !net.IP(data).Equal(net.IPv4(192, 168, 1, 20)) {
+				t.Errorf("Unexpected address %v", net.IP(data))
+			}
+		}
+		offset = next + 10 + length
+	}
+	if offset != len(msg) {
+		t.Errorf("Expected %d bytes, got %d", offset, len(msg))
+	}
+	if names[2] != r.instance || names[4] != r.host {
+		t.Errorf("Unexpected record names %v", names)
+	}
+}
+
+func TestReadNameCompression(t *testing.T) {
+	msg := appendName(make([]byte, 12), "local.")
+	msg = append(msg, 4, 'h', 'o', 's', 't', 0xc0, 12)
+	name, next, err := readName(msg, 19)
+	if err != nil || name != "host.local." || next != len(msg) {
+		t.Errorf("Got %q, %d, %v", name, next, err)
+	}
+
+	loop := []byte{0xc0, 0}
+	if _, _, err := readName(loop, 0); err == nil {
+		t.Error("Expected a pointer loop to be rejected")
+	}
+}
@@ -0,0 +1,348 @@
+package homekit
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// maxSetupAttempts is how many failed pair setups are allowed before the
+// accessory refuses more until it restarts
+const maxSetupAttempts = 100
+
+// Pairing methods
+const (
+	methodPairSetup         = 0
+	methodPairSetupWithAuth = 1
+	methodAddPairing        = 3
+	methodRemovePairing     = 4
+	methodListPairings      = 5
+)
+
+var errMaxPeers = errors.New("homekit: too many pairings")
+
+// deriveKey derives a 32-byte key with HKDF-SHA512 (RFC 5869). One block
+// of output is enough.
+func deriveKey(secret []byte, salt, info string) []byte {
+	extract := hmac.New(sha512.New, []byte(salt))
+	extract.Write(secret)
+	expand := hmac.New(sha512.New, extract.Sum(nil))
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:chacha20poly1305.KeySize]
+}
+
+// messageNonce is the nonce for a pairing message: four zero bytes and an
+// eight-character label such as PS-Msg05
+func messageNonce(label string) []byte {
+	return append(make([]byte, 4), label...)
+}
+
+// seal encrypts a sub-TLV for a pairing message
+func seal(key []byte, label string, message tlv8) []byte {
+	aead, _ := newAEAD(key)
+	return aead.Seal(nil, messageNonce(label), message.encode(), nil)
+}
+
+// open decrypts a pairing message's sub-TLV
+func open(key []byte, label string, sealed []byte) (tlv8, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, messageNonce(label), sealed, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTLV8(plaintext)
+}
+
+// pairSetup handles a step of pair setup, which exchanges long-term keys
+// with a new controller after it proves it knows the setup code
+func (s *Server) pairSetup(c *conn, request tlv8) tlv8 {
+	state, _ := request.getByte(tlvState)
+	switch state {
+	case 1:
+		return s.pairSetupStart(c, request)
+	case 3:
+		return s.pairSetupVerify(c, request)
+	case 5:
+		return s.pairSetupExchange(c, request)
+	}
+	return pairingError(state+1, errorUnknown)
+}
+
+// pairSetupStart answers M1 with the SRP salt and public key
+func (s *Server) pairSetupStart(c *conn, request tlv8) tlv8 {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	method, _ := request.getByte(tlvMethod)
+	switch {
+	case method != methodPairSetup && method != methodPairSetupWithAuth:
+		return pairingError(2, errorUnknown)
+	case s.store.paired():
+		return pairingError(2, errorUnavailable)
+	case s.setupAttempts >= maxSetupAttempts:
+		return pairingError(2, errorMaxTries)
+	case s.setupConn != nil && s.setupConn != c:
+		return pairingError(2, errorBusy)
+	}
+
+	srp, err := newSRPServer(s.config.SetupCode)
+	if err != nil {
+		return pairingError(2, errorUnknown)
+	}
+	s.setup, s.setupConn = srp, c
+
+	var response tlv8
+	response.addByte(tlvState, 2)
+	response.add(tlvPublicKey, srp.publicKey())
+	response.add(tlvSalt, srp.salt)
+	return response
+}
+
+// pairSetupVerify answers M3 by checking the controller's SRP proof
+func (s *Server) pairSetupVerify(c *conn, request tlv8) tlv8 {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	if s.setupConn != c {
+		return pairingError(4, errorUnknown)
+	}
+	public, _ := request.get(tlvPublicKey)
+	proof, _ := request.get(tlvProof)
+	serverProof, err := s.setup.verify(public, proof)
+	if err != nil {
+		s.setupAttempts++
+		s.setup, s.setupConn = nil, nil
+		s.logger.Printf("HomeKit pairing failed: incorrect setup code")
+		return pairingError(4, errorAuthentication)
+	}
+
+	var response tlv8
+	response.addByte(tlvState, 4)
+	response.add(tlvProof, serverProof)
+	return response
+}
+
+// pairSetupExchange answers M5: it checks the controller's long-term key,
+// saves the pairing and returns the accessory's long-term key
+func (s *Server) pairSetupExchange(c *conn, request tlv8) tlv8 {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+
+	if s.setupConn != c || s.setup.key == nil {
+		return pairingError(6, errorUnknown)
+	}
+	defer func() { s.setup, s.setupConn = nil, nil }()
+
+	sessionKey := deriveKey(s.setup.key, "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	sealed, _ := request.get(tlvEncryptedData)
+	message, err := open(sessionKey, "PS-Msg05", sealed)
+	if err != nil {
+		return pairingError(6, errorAuthentication)
+	}
+	id, _ := message.get(tlvIdentifier)
+	publicKey, _ := message.get(tlvPublicKey)
+	signature, _ := message.get(tlvSignature)
+	if len(publicKey) != ed25519.PublicKeySize {
+		return pairingError(6, errorAuthentication)
+	}
+
+	controllerX := deriveKey(s.setup.key, "Pair-Setup-Controller-Sign-Salt", "Pair-Setup-Controller-Sign-Info")
+	signed := append(append(controllerX, id...), publicKey...)
+	if !ed25519.Verify(publicKey, signed, signature) {
+		return pairingError(6, errorAuthentication)
+	}
+
+	if err := s.store.addPairing(Pairing{ID: string(id), PublicKey: publicKey, Admin: true}); err != nil {
+		s.logger.Printf("HomeKit pairing failed: %v", err)
+		return pairingError(6, errorMaxPeers)
+	}
+	s.logger.Printf("HomeKit controller %s paired", id)
+	s.paired()
+
+	accessoryX := deriveKey(s.setup.key, "Pair-Setup-Accessory-Sign-Salt", "Pair-Setup-Accessory-Sign-Info")
+	accessoryInfo := append(append(accessoryX, s.store.id()...), s.store.publicKey()...)
+	var reply tlv8
+	reply.add(tlvIdentifier, []byte(s.store.id()))
+	reply.add(tlvPublicKey, s.store.publicKey())
+	reply.add(tlvSignature, s.store.sign(accessoryInfo))
+
+	var response tlv8
+	response.addByte(tlvState, 6)
+	response.add(tlvEncryptedData, seal(sessionKey, "PS-Msg06", reply))
+	return response
+}
+
+// verifySession is a pair verify in progress
+type verifySession struct {
+	shared           []byte
+	sessionKey       []byte
+	accessoryPublic  []byte
+	controllerPublic []byte
+}
+
+// pairVerify handles a step of pair verify, which starts an encrypted
+// session with a paired controller. On success it returns the controller's
+// ID, and the connection is encrypted once the response is sent.
+func (s *Server) pairVerify(c *conn, request tlv8) (response tlv8, controller string) {
+	state, _ := request.getByte(tlvState)
+	switch state {
+	case 1:
+		return s.pairVerifyStart(c, request), ""
+	case 3:
+		return s.pairVerifyFinish(c, request)
+	}
+	return pairingError(state+1, errorUnknown), ""
+}
+
+// pairVerifyStart answers M1 with an ephemeral key signed by the accessory
+func (s *Server) pairVerifyStart(c *conn, request tlv8) tlv8 {
+	controllerPublic, _ := request.get(tlvPublicKey)
+	peer, err := ecdh.X25519().NewPublicKey(controllerPublic)
+	if err != nil {
+		return pairingError(2, errorAuthentication)
+	}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return pairingError(2, errorUnknown)
+	}
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return pairingError(2, errorAuthentication)
+	}
+
+	session := &verifySession{
+		shared:           shared,
+		sessionKey:       deriveKey(shared, "Pair-Verify-Encrypt-Salt", "Pair-Verify-Encrypt-Info"),
+		accessoryPublic:  private.PublicKey().Bytes(),
+		controllerPublic: controllerPublic,
+	}
+	c.mu.Lock()
+	c.verify = session
+	c.mu.Unlock()
+
+	accessoryInfo := append(append(append([]byte{}, session.accessoryPublic...), s.store.id()...), controllerPublic...)
+	var reply tlv8
+	reply.add(tlvIdentifier, []byte(s.store.id()))
+	reply.add(tlvSignature, s.store.sign(accessoryInfo))
+
+	var response tlv8
+	response.addByte(tlvState, 2)
+	response.add(tlvPublicKey, session.accessoryPublic)
+	response.add(tlvEncryptedData, seal(session.sessionKey, "PV-Msg02", reply))
+	return response
+}
+
+// pairVerifyFinish answers M3 by checking the controller's signature with
+// its long-term key
+func (s *Server) pairVerifyFinish(c *conn, request tlv8) (tlv8, string) {
+	c.mu.Lock()
+	session := c.verify
+	c.verify = nil
+	c.mu.Unlock()
+	if session == nil {
+		return pairingError(4, errorUnknown), ""
+	}
+
+	sealed, _ := request.get(tlvEncryptedData)
+	message, err := open(session.sessionKey, "PV-Msg03", sealed)
+	if err != nil {
+		return pairingError(4, errorAuthentication), ""
+	}
+	id, _ := message.get(tlvIdentifier)
+	signature, _ := message.get(tlvSignature)
+	pairing, ok := s.store.pairing(string(id))
+	if !ok {
+		return pairingError(4, errorAuthentication), ""
+	}
+	controllerInfo := append(append(append([]byte{}, session.controllerPublic...), id...), session.accessoryPublic...)
+	if !ed25519.Verify(pairing.PublicKey, controllerInfo, signature) {
+		return pairingError(4, errorAuthentication), ""
+	}
+
+	c.mu.Lock()
+	c.verify = session
+	c.mu.Unlock()
+
+	var response tlv8
+	response.addByte(tlvState, 4)
+	return response, pairing.ID
+}
+
+// startSession switches a verified connection to encrypted frames
+func (c *conn) startSession(controller string) {
+	c.mu.Lock()
+	session := c.verify
+	c.verify = nil
+	c.mu.Unlock()
+
+	readKey, _ := newAEAD(deriveKey(session.shared, "Control-Salt", "Control-Write-Encryption-Key"))
+	writeKey, _ := newAEAD(deriveKey(session.shared, "Control-Salt", "Control-Read-Encryption-Key"))
+	c.encrypt(controller, readKey, writeKey)
+}
+
+// pairings handles adding, removing and listing pairings, which only admin
+// controllers may do
+func (s *Server) pairings(c *conn, request tlv8) tlv8 {
+	state, _ := request.getByte(tlvState)
+	if state != 1 {
+		return pairingError(2, errorUnknown)
+	}
+	if pairing, ok := s.store.pairing(c.verified()); !ok || !pairing.Admin {
+		return pairingError(2, errorAuthentication)
+	}
+
+	method, _ := request.getByte(tlvMethod)
+	id, _ := request.get(tlvIdentifier)
+	switch method {
+	case methodAddPairing:
+		publicKey, _ := request.get(tlvPublicKey)
+		permissions, _ := request.getByte(tlvPermissions)
+		if len(publicKey) != ed25519.PublicKeySize {
+			return pairingError(2, errorUnknown)
+		}
+		err := s.store.addPairing(Pairing{ID: string(id), PublicKey: publicKey, Admin: permissions&0x01 != 0})
+		if errors.Is(err, errMaxPeers) {
+			return pairingError(2, errorMaxPeers)
+		} else if err != nil {
+			return pairingError(2, errorUnknown)
+		}
+		s.logger.Printf("HomeKit controller %s added", id)
+	case methodRemovePairing:
+		if err := s.store.removePairing(string(id)); err != nil {
+			return pairingError(2, errorUnknown)
+		}
+		s.logger.Printf("HomeKit controller %s removed", id)
+		s.paired()
+	case methodListPairings:
+		var response tlv8
+		response.addByte(tlvState, 2)
+		for i, pairing := range s.store.pairings() {
+			if i > 0 {
+				response.add(tlvSeparator, nil)
+			}
+			var permissions byte
+			if pairing.Admin {
+				permissions = 1
+			}
+			response.add(tlvIdentifier, []byte(pairing.ID))
+			response.add(tlvPublicKey, pairing.PublicKey)
+			response.addByte(tlvPermissions, permissions)
+		}
+		return response
+	default:
+		return pairingError(2, errorUnknown)
+	}
+
+	var response tlv8
+	response.addByte(tlvState, 2)
+	return response
+}
@@ -0,0 +1,534 @@
+// Package homekit implements a HomeKit Accessory Protocol (HAP) bridge over
+// IP, so the Home app and Siri can control accessories the server exposes.
+//
+// It covers what a bridge needs: advertising over multicast DNS, pair setup
+// with the setup code, pair verify and encrypted sessions, adding, removing
+// and listing pairings, reading and writing characteristics, and event
+// notifications. Pairings and the accessory's long-term key are kept in a
+// directory so controllers stay paired across restarts.
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultName is the bridge's name unless the config sets one
+	DefaultName = "Tesla"
+	// DefaultPort is the port served unless the config sets one
+	DefaultPort = 51826
+	// maxBodySize bounds a request body
+	maxBodySize = 64 << 10
+	// eventTimeout bounds sending an event to one controller
+	eventTimeout = 5 * time.Second
+)
+
+// categoryBridge is the accessory category advertised
+const categoryBridge = 2
+
+// HAP status codes
+const (
+	statusSuccess           = 0
+	statusInsufficientPrivs = -70401
+	statusCommunication     = -70402
+	statusReadOnly          = -70404
+	statusWriteOnly         = -70405
+	statusNoNotification    = -70406
+	statusNotFound          = -70409
+	statusInvalidValue      = -70410
+)
+
+// setupCodePattern is the format of a setup code
+var setupCodePattern = regexp.MustCompile(`^\d{3}-\d{2}-\d{3}$`)
+
+// trivialSetupCodes are setup codes HAP forbids
+var trivialSetupCodes = []string{
+	"000-00-000", "111-11-111", "222-22-222", "333-33-333", "444-44-444",
+	"555-55-555", "666-66-666", "777-77-777", "888-88-888", "999-99-999",
+	"123-45-678", "876-54-321",
+}
+
+// Config enables the bridge. HomeKit is disabled without a setup code.
+type Config struct {
+	Name      string `json:"name,omitempty"`       // Shown in the Home app; defaults to Tesla
+	SetupCode string `json:"setup_code,omitempty"` // Entered when pairing, as 123-45-678
+	Port      int    `json:"port,omitempty"`       // Defaults to 51826
+}
+
+// Enabled reports whether a setup code is configured
+func (c Config) Enabled() bool {
+	return c.SetupCode != ""
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if !setupCodePattern.MatchString(c.SetupCode) {
+		return fmt.Errorf("setup_code must have the form 123-45-678")
+	}
+	for _, trivial := range trivialSetupCodes {
+		if c.SetupCode == trivial {
+			return fmt.Errorf("setup_code %s is too easy to guess", trivial)
+		}
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	return nil
+}
+
+// Server serves a bridge and the accessories behind it
+type Server struct {
+	config      Config
+	store       *store
+	accessories []*Accessory
+	logger      *log.Logger
+	changed     chan struct{} // Signals the advertisement should be updated
+
+	setupMu       sync.Mutex
+	setup         *srpServer
+	setupConn     *conn
+	setupAttempts int
+
+	connsMu sync.Mutex
+	conns   map[*conn]bool
+}
+
+// NewServer creates a server for a bridge, which must be the first
+// accessory, and the accessories behind it. Its identity and pairings are
+// kept in dir.
+func NewServer(config Config, dir string, accessories []*Accessory, logger *log.Logger) (*Server, error) {
+	if len(accessories) == 0 {
+		return nil, fmt.Errorf("homekit: a bridge accessory is required")
+	}
+	if config.Name == "" {
+		config.Name = DefaultName
+	}
+	if config.Port == 0 {
+		config.Port = DefaultPort
+	}
+
+	store, err := openStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		config:      config,
+		store:       store,
+		accessories: accessories,
+		logger:      logger,
+		changed:     make(chan struct{}, 1),
+		conns:       make(map[*conn]bool),
+	}
+	for i, accessory := range accessories {
+		accessory.assign(uint64(i+1), s.notify)
+	}
+	return s, nil
+}
+
+// Paired reports whether any controller is paired
+func (s *Server) Paired() bool {
+	return s.store.paired()
+}
+
+// Pairings returns the paired controllers
+func (s *Server) Pairings() []Pairing {
+	return s.store.pairings()
+}
+
+// Run advertises the bridge and serves controllers until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.Port))
+	if err != nil {
+		return fmt.Errorf("homekit: %w", err)
+	}
+
+	responder := newResponder(s.config.Name, s.store.id(), s.config.Port, s.txtRecord)
+	go func() {
+		if err := responder.run(ctx, s.changed); err != nil {
+			s.logger.Printf("HomeKit advertisement failed: %v", err)
+		}
+	}()
+
+	if !s.Paired() {
+		s.logger.Printf("HomeKit bridge %q is ready to pair with setup code %s", s.config.Name, s.config.SetupCode)
+	}
+	return s.serve(ctx, listener)
+}
+
+// serve accepts connections until ctx is cancelled
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		s.connsMu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.connsMu.Unlock()
+	}()
+
+	for {
+		nc, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("homekit: %w", err)
+		}
+		c := newConn(nc)
+		s.connsMu.Lock()
+		s.conns[c] = true
+		s.connsMu.Unlock()
+		go s.serveConn(ctx, c)
+	}
+}
+
+// txtRecord describes the bridge to controllers browsing for it
+func (s *Server) txtRecord() []string {
+	layout := ""
+	for _, accessory := range s.accessories {
+		layout += accessory.layout() + ";"
+	}
+	configNumber, err := s.store.configNumber(layout)
+	if err != nil {
+		s.logger.Printf("HomeKit: %v", err)
+	}
+	statusFlags := 0
+	if !s.Paired() {
+		statusFlags = 1
+	}
+	return []string{
+		"c#=" + strconv.Itoa(configNumber),
+		"ff=0",
+		"id=" + s.store.id(),
+		"md=" + s.config.Name,
+		"pv=1.1",
+		"s#=1",
+		"sf=" + strconv.Itoa(statusFlags),
+		"ci=" + strconv.Itoa(categoryBridge),
+	}
+}
+
+// paired updates the advertisement after the pairings change
+func (s *Server) paired() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// response is an HTTP response to a controller
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// serveConn handles a controller's requests until it disconnects
+func (s *Server) serveConn(ctx context.Context, c *conn) {
+	defer func() {
+		c.Close()
+		s.connsMu.Lock()
+		delete(s.conns, c)
+		s.connsMu.Unlock()
+		s.setupMu.Lock()
+		if s.setupConn == c {
+			s.setup, s.setupConn = nil, nil
+		}
+		s.setupMu.Unlock()
+	}()
+
+	reader := bufio.NewReader(c)
+	for {
+		request, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(request.Body, maxBodySize))
+		request.Body.Close()
+		if err != nil {
+			return
+		}
+
+		var controller string
+		var resp response
+		switch {
+		case request.Method == http.MethodPost && request.URL.Path == "/pair-setup":
+			resp = s.pairingRequest(body, func(t tlv8) tlv8 { return s.pairSetup(c, t) })
+		case request.Method == http.MethodPost && request.URL.Path == "/pair-verify":
+			resp = s.pairingRequest(body, func(t tlv8) tlv8 {
+				var out tlv8
+				out, controller = s.pairVerify(c, t)
+				return out
+			})
+		case request.Method == http.MethodPost && request.URL.Path == "/identify":
+			resp = s.identify()
+		case c.verified() == "":
+			resp = hapStatus(470, statusInsufficientPrivs)
+		case request.Method == http.MethodPost && request.URL.Path == "/pairings":
+			resp = s.pairingRequest(body, func(t tlv8) tlv8 { return s.pairings(c, t) })
+		case request.Method == http.MethodGet && request.URL.Path == "/accessories":
+			resp = jsonResponse(http.StatusOK, map[string]interface{}{"accessories": s.accessories})
+		case request.Method == http.MethodGet && request.URL.Path == "/characteristics":
+			resp = s.readCharacteristics(request)
+		case request.Method == http.MethodPut && request.URL.Path == "/characteristics":
+			resp = s.writeCharacteristics(ctx, c, body)
+		default:
+			resp = response{status: http.StatusNotFound}
+		}
+
+		if err := c.writeResponse(resp); err != nil {
+			return
+		}
+		if controller != "" {
+			c.startSession(controller)
+		}
+		if request.URL.Path == "/pairings" {
+			s.closeRemoved()
+		}
+	}
+}
+
+// pairingRequest decodes a TLV8 request body and encodes the reply
+func (s *Server) pairingRequest(body []byte, handle func(tlv8) tlv8) response {
+	request, err := decodeTLV8(body)
+	if err != nil {
+		return response{status: http.StatusBadRequest}
+	}
+	return response{status: http.StatusOK, contentType: "application/pairing+tlv8", body: handle(request).encode()}
+}
+
+// identify answers an unpaired identify request. There is nothing to
+// flash, so it only logs.
+func (s *Server) identify() response {
+	if s.Paired() {
+		return hapStatus(http.StatusBadRequest, statusInsufficientPrivs)
+	}
+	s.logger.Printf("HomeKit identify requested")
+	return response{status: http.StatusNoContent}
+}
+
+// closeRemoved ends the sessions of controllers that are no longer paired
+func (s *Server) closeRemoved() {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for c := range s.conns {
+		if id := c.verified(); id != "" {
+			if _, ok := s.store.pairing(id); !ok {
+				c.Close()
+			}
+		}
+	}
+}
+
+// characteristic finds a characteristic by accessory and instance ID
+func (s *Server) characteristic(aid, iid uint64) *Characteristic {
+	if aid == 0 || aid > uint64(len(s.accessories)) {
+		return nil
+	}
+	for _, service := range s.accessories[aid-1].Services {
+		for _, c := range service.Characteristics {
+			if c.iid == iid {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// characteristicStatus is one entry of a characteristics response
+type characteristicStatus struct {
+	AID    uint64      `json:"aid"`
+	IID    uint64      `json:"iid"`
+	Value  interface{} `json:"value,omitempty"`
+	Status *int        `json:"status,omitempty"`
+}
+
+// readCharacteristics answers GET /characteristics?id=1.2,1.3
+func (s *Server) readCharacteristics(request *http.Request) response {
+	var results []characteristicStatus
+	failed := false
+	for _, id := range strings.Split(request.URL.Query().Get("id"), ",") {
+		var aid, iid uint64
+		if _, err := fmt.Sscanf(id, "%d.%d", &aid, &iid); err != nil {
+			return hapStatus(http.StatusBadRequest, statusInvalidValue)
+		}
+
+		status := statusSuccess
+		result := characteristicStatus{AID: aid, IID: iid}
+		switch c := s.characteristic(aid, iid); {
+		case c == nil:
+			status = statusNotFound
+		case !c.has(PermRead):
+			status = statusWriteOnly
+		default:
+			result.Value = c.Value()
+		}
+		if status != statusSuccess {
+			failed = true
+		}
+		result.Status = &status
+		results = append(results, result)
+	}
+
+	if !failed {
+		for i := range results {
+			results[i].Status = nil
+		}
+		return jsonResponse(http.StatusOK, map[string]interface{}{"characteristics": results})
+	}
+	return jsonResponse(http.StatusMultiStatus, map[string]interface{}{"characteristics": results})
+}
+
+// characteristicWrite is one entry of a write request
+type characteristicWrite struct {
+	AID   uint64          `json:"aid"`
+	IID   uint64          `json:"iid"`
+	Value json.RawMessage `json:"value"`
+	Event *bool           `json:"ev"`
+}
+
+// writeCharacteristics answers PUT /characteristics, which writes values
+// and subscribes to events
+func (s *Server) writeCharacteristics(ctx context.Context, conn *conn, body []byte) response {
+	var request struct {
+		Characteristics []characteristicWrite `json:"characteristics"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return hapStatus(http.StatusBadRequest, statusInvalidValue)
+	}
+
+	var results []characteristicStatus
+	failed := false
+	for _, write := range request.Characteristics {
+		status := s.writeCharacteristic(ctx, conn, write)
+		if status != statusSuccess {
+			failed = true
+		}
+		results = append(results, characteristicStatus{AID: write.AID, IID: write.IID, Status: &status})
+	}
+	if !failed {
+		return response{status: http.StatusNoContent}
+	}
+	return jsonResponse(http.StatusMultiStatus, map[string]interface{}{"characteristics": results})
+}
+
+// writeCharacteristic applies one entry of a write request, returning its
+// HAP status
+func (s *Server) writeCharacteristic(ctx context.Context, conn *conn, write characteristicWrite) int {
+	c := s.characteristic(write.AID, write.IID)
+	if c == nil {
+		return statusNotFound
+	}
+
+	if write.Event != nil {
+		if !c.has(PermEvents) {
+			return statusNoNotification
+		}
+		conn.subscribe(c, *write.Event)
+	}
+
+	if len(write.Value) == 0 || string(write.Value) == "null" {
+		return statusSuccess
+	}
+	if !c.has(PermWrite) {
+		return statusReadOnly
+	}
+	var raw interface{}
+	if err := json.Unmarshal(write.Value, &raw); err != nil {
+		return statusInvalidValue
+	}
+	value, err := c.convert(raw)
+	if err != nil {
+		return statusInvalidValue
+	}
+	if c.OnWrite != nil {
+		if err := c.OnWrite(ctx, value); err != nil {
+			s.logger.Printf("HomeKit write to %d.%d failed: %v", write.AID, write.IID, err)
+			if err == ErrInvalidValue {
+				return statusInvalidValue
+			}
+			return statusCommunication
+		}
+	}
+	// The controller that wrote the value knows it already
+	c.setValue(value, conn)
+	return statusSuccess
+}
+
+// notify sends an event for a changed characteristic to every subscribed
+// controller except one
+func (s *Server) notify(c *Characteristic, except *conn) {
+	body, err := json.Marshal(map[string]interface{}{
+		"characteristics": []characteristicStatus{{AID: c.aid, IID: c.iid, Value: c.Value()}},
+	})
+	if err != nil {
+		return
+	}
+	event := []byte(fmt.Sprintf("EVENT/1.0 200 OK\r\nContent-Type: application/hap+json\r\nContent-Length: %d\r\n\r\n", len(body)))
+	event = append(event, body...)
+
+	s.connsMu.Lock()
+	var targets []*conn
+	for conn := range s.conns {
+		if conn != except && conn.verified() != "" && conn.subscribed(c) {
+			targets = append(targets, conn)
+		}
+	}
+	s.connsMu.Unlock()
+
+	for _, conn := range targets {
+		conn.SetWriteDeadline(time.Now().Add(eventTimeout))
+		if _, err := conn.Write(event); err != nil {
+			conn.Close()
+		}
+		conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// writeResponse sends an HTTP response
+func (c *conn) writeResponse(r response) error {
+	text := http.StatusText(r.status)
+	if r.status == 470 {
+		text = "Connection Authorization Required"
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "HTTP/1.1 %d %s\r\n", r.status, text)
+	if r.contentType != "" {
+		fmt.Fprintf(&out, "Content-Type: %s\r\n", r.contentType)
+	}
+	fmt.Fprintf(&out, "Content-Length: %d\r\n\r\n", len(r.body))
+	out.Write(r.body)
+	_, err := c.Write(out.Bytes())
+	return err
+}
+
+// jsonResponse encodes a HAP JSON response
+func jsonResponse(status int, value interface{}) response {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return response{status: http.StatusInternalServerError}
+	}
+	return response{status: status, contentType: "application/hap+json", body: body}
+}
+
+// hapStatus is an error response carrying a HAP status code
+func hapStatus(status, code int) response {
+	return jsonResponse(status, map[string]int{"status": code})
+}
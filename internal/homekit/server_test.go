@@ -0,0 +1,501 @@
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSetupCode = "031-45-154"
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"disabled", Config{}, true},
+		{"valid", Config{SetupCode: testSetupCode, Port: 51827}, true},
+		{"no dashes", Config{SetupCode: "03145154"}, false},
+		{"trivial", Config{SetupCode: "123-45-678"}, false},
+		{"bad port", Config{SetupCode: testSetupCode, Port: 70000}, false},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestTLV8Fragments(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 300)
+	var message tlv8
+	message.addByte(tlvState, 2)
+	message.add(tlvPublicKey, long)
+	message.add(tlvSalt, []byte("salt"))
+
+	decoded, err := decodeTLV8(message.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := decoded.get(tlvPublicKey); !bytes.Equal(value, long) {
+		t.Errorf("Expected the fragments to be joined, got %d bytes", len(value))
+	}
+	if state, _ := decoded.getByte(tlvState); state != 2 {
+		t.Errorf("Expected state 2, got %d", state)
+	}
+	if _, err := decodeTLV8([]byte{tlvState, 5, 1}); err == nil {
+		t.Error("Expected an error for a truncated item")
+	}
+}
+
+// testBridge serves a bridge with a thermostat and a switch on a loopback
+// port
+type testBridge struct {
+	server     *Server
+	thermostat *Thermostat
+	heater     *Switch
+	writes     chan interface{}
+	addr       string
+}
+
+func newTestBridge(t *testing.T, dir string) *testBridge {
+	t.Helper()
+	b := &testBridge{
+		thermostat: NewThermostat("Climate", 15, 28),
+		heater:     NewSwitch("Driver seat heater"),
+		writes:     make(chan interface{}, 10),
+	}
+	b.heater.On.OnWrite = func(ctx context.Context, value interface{}) error {
+		b.writes <- value
+		return nil
+	}
+	b.thermostat.TargetTemperature.OnWrite = func(ctx context.Context, value interface{}) error {
+		return fmt.Errorf("vehicle unavailable")
+	}
+
+	car := NewAccessory(AccessoryInfo{Name: "Car", Manufacturer: "Tesla", Model: "HVAC", SerialNumber: "VIN"})
+	car.AddService(b.thermostat.Service)
+	car.AddService(b.heater.Service)
+	bridge := NewAccessory(AccessoryInfo{Name: "Bridge", Manufacturer: "Tesla", Model: "Bridge", SerialNumber: "1"})
+
+	server, err := NewServer(Config{SetupCode: testSetupCode}, dir, []*Accessory{bridge, car}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.server = server
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.addr = listener.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go server.serve(ctx, listener)
+	return b
+}
+
+// testController plays the part of an iPhone
+type testController struct {
+	t      *testing.T
+	conn   *conn
+	reader *bufio.Reader
+	id     string
+	key    ed25519.PrivateKey
+
+	accessoryKey ed25519.PublicKey
+}
+
+func newTestController(t *testing.T, addr, id string) *testController {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	c := newConn(nc)
+	return &testController{t: t, conn: c, reader: bufio.NewReader(c), id: id, key: key}
+}
+
+// message reads a response or event: the status code and body
+func (c *testController) message() (int, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	status := 0
+	length := 0
+	for first := true; ; first = false {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return 0, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if first {
+			fields := strings.Fields(line)
+			status, _ = strconv.Atoi(fields[1])
+		} else if value, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+			length, _ = strconv.Atoi(value)
+		}
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(c.reader, body)
+	return status, body, err
+}
+
+func (c *testController) request(method, path string, body []byte) (int, []byte) {
+	c.t.Helper()
+	fmt.Fprintf(c.conn, "%s %s HTTP/1.1\r\nHost: bridge\r\nContent-Length: %d\r\n\r\n%s", method, path, len(body), body)
+	status, response, err := c.message()
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return status, response
+}
+
+func (c *testController) tlv(path string, request tlv8) tlv8 {
+	c.t.Helper()
+	status, body := c.request("POST", path, request.encode())
+	if status != 200 {
+		c.t.Fatalf("POST %s: status %d", path, status)
+	}
+	response, err := decodeTLV8(body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return response
+}
+
+// pairSetup pairs with a setup code, returning the error code of a failed
+// step or 0
+func (c *testController) pairSetup(setupCode string) byte {
+	c.t.Helper()
+	var m1 tlv8
+	m1.addByte(tlvState, 1)
+	m1.addByte(tlvMethod, methodPairSetup)
+	m2 := c.tlv("/pair-setup", m1)
+	if code, ok := m2.getByte(tlvError); ok {
+		return code
+	}
+	salt, _ := m2.get(tlvSalt)
+	serverPublic, _ := m2.get(tlvPublicKey)
+
+	// The client side of SRP, computed with math/big to check the server
+	// against a second implementation
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	N, g := srpN.Big(), big.NewInt(5)
+	pad := func(n *big.Int) []byte { return n.FillBytes(make([]byte, srpLen)) }
+	a := new(big.Int).SetBytes(secret)
+	A := new(big.Int).Exp(g, a, N)
+	B := new(big.Int).SetBytes(serverPublic)
+	u := new(big.Int).SetBytes(srpHash(pad(A), pad(B)))
+	x := new(big.Int).SetBytes(srpHash(salt, srpHash([]byte(srpUsername+":"+setupCode))))
+	k := new(big.Int).SetBytes(srpHash(N.Bytes(), pad(g)))
+	base := new(big.Int).Sub(B, new(big.Int).Mul(k, new(big.Int).Exp(g, x, N)))
+	base.Mod(base, N)
+	S := new(big.Int).Exp(base, new(big.Int).Add(a, new(big.Int).Mul(u, x)), N)
+	key := srpHash(pad(S))
+	proof := srpClientProof(salt, pad(A), pad(B), key)
+
+	var m3 tlv8
+	m3.addByte(tlvState, 3)
+	m3.add(tlvPublicKey, pad(A))
+	m3.add(tlvProof, proof)
+	m4 := c.tlv("/pair-setup", m3)
+	if code, ok := m4.getByte(tlvError); ok {
+		return code
+	}
+	if serverProof, _ := m4.get(tlvProof); !bytes.Equal(serverProof, srpHash(pad(A), proof, key)) {
+		c.t.Fatal("Accessory's SRP proof is wrong")
+	}
+
+	sessionKey := deriveKey(key, "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	controllerX := deriveKey(key, "Pair-Setup-Controller-Sign-Salt", "Pair-Setup-Controller-Sign-Info")
+	public := c.key.Public().(ed25519.PublicKey)
+	var info tlv8
+	info.add(tlvIdentifier, []byte(c.id))
+	info.add(tlvPublicKey, public)
+	info.add(tlvSignature, ed25519.Sign(c.key, append(append(controllerX, c.id...), public...)))
+	var m5 tlv8
+	m5.addByte(tlvState, 5)
+	m5.add(tlvEncryptedData, seal(sessionKey, "PS-Msg05", info))
+	m6 := c.tlv("/pair-setup", m5)
+	if code, ok := m6.getByte(tlvError); ok {
+		return code
+	}
+
+	sealed, _ := m6.get(tlvEncryptedData)
+	reply, err := open(sessionKey, "PS-Msg06", sealed)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	accessoryID, _ := reply.get(tlvIdentifier)
+	accessoryKey, _ := reply.get(tlvPublicKey)
+	signature, _ := reply.get(tlvSignature)
+	accessoryX := deriveKey(key, "Pair-Setup-Accessory-Sign-Salt", "Pair-Setup-Accessory-Sign-Info")
+	if !ed25519.Verify(accessoryKey, append(append(accessoryX, accessoryID...), accessoryKey...), signature) {
+		c.t.Fatal("Accessory's signature is wrong")
+	}
+	c.accessoryKey = accessoryKey
+	return 0
+}
+
+// pairVerify starts an encrypted session, returning the error code of a
+// failed step or 0
+func (c *testController) pairVerify() byte {
+	c.t.Helper()
+	private, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	public := private.PublicKey().Bytes()
+	var m1 tlv8
+	m1.addByte(tlvState, 1)
+	m1.add(tlvPublicKey, public)
+	m2 := c.tlv("/pair-verify", m1)
+	if code, ok := m2.getByte(tlvError); ok {
+		return code
+	}
+
+	accessoryPublic, _ := m2.get(tlvPublicKey)
+	peer, err := ecdh.X25519().NewPublicKey(accessoryPublic)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	shared, _ := private.ECDH(peer)
+	sessionKey := deriveKey(shared, "Pair-Verify-Encrypt-Salt", "Pair-Verify-Encrypt-Info")
+	sealed, _ := m2.get(tlvEncryptedData)
+	reply, err := open(sessionKey, "PV-Msg02", sealed)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	accessoryID, _ := reply.get(tlvIdentifier)
+	signature, _ := reply.get(tlvSignature)
+	signed := append(append(append([]byte{}, accessoryPublic...), accessoryID...), public...)
+	if !ed25519.Verify(c.accessoryKey, signed, signature) {
+		c.t.Fatal("Accessory's verify signature is wrong")
+	}
+
+	var info tlv8
+	info.add(tlvIdentifier, []byte(c.id))
+	info.add(tlvSignature, ed25519.Sign(c.key, append(append(append([]byte{}, public...), c.id...), accessoryPublic...)))
+	var m3 tlv8
+	m3.addByte(tlvState, 3)
+	m3.add(tlvEncryptedData, seal(sessionKey, "PV-Msg03", info))
+	m4 := c.tlv("/pair-verify", m3)
+	if code, ok := m4.getByte(tlvError); ok {
+		return code
+	}
+
+	readKey, _ := newAEAD(deriveKey(shared, "Control-Salt", "Control-Read-Encryption-Key"))
+	writeKey, _ := newAEAD(deriveKey(shared, "Control-Salt", "Control-Write-Encryption-Key"))
+	c.conn.encrypt(c.id, readKey, writeKey)
+	return 0
+}
+
+func (c *testController) characteristics(status int, body []byte) []characteristicStatus {
+	c.t.Helper()
+	var response struct {
+		Characteristics []characteristicStatus `json:"characteristics"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		c.t.Fatalf("Status %d, body %q: %v", status, body, err)
+	}
+	return response.Characteristics
+}
+
+func TestPairAndControl(t *testing.T) {
+	dir := t.TempDir()
+	b := newTestBridge(t, dir)
+	phone := newTestController(t, b.addr, "phone")
+
+	if status, _ := phone.request("GET", "/accessories", nil); status != 470 {
+		t.Errorf("Expected 470 before pairing, got %d", status)
+	}
+	if code := phone.pairSetup(testSetupCode); code != 0 {
+		t.Fatalf("Pair setup failed with error %d", code)
+	}
+	if !b.server.Paired() {
+		t.Fatal("Expected the bridge to be paired")
+	}
+	if code := phone.pairVerify(); code != 0 {
+		t.Fatalf("Pair verify failed with error %d", code)
+	}
+
+	status, body := phone.request("GET", "/accessories", nil)
+	if status != 200 || !strings.Contains(string(body), `"type":"4A"`) || !strings.Contains(string(body), `"aid":2`) {
+		t.Fatalf("Unexpected accessories: %d %s", status, body)
+	}
+
+	heater, target := b.heater.On, b.thermostat.TargetTemperature
+	status, body = phone.request("GET", fmt.Sprintf("/characteristics?id=2.%d,2.%d", heater.iid, target.iid), nil)
+	values := phone.characteristics(status, body)
+	if status != 200 || len(values) != 2 || values[0].Value != false || values[1].Value != float64(15) {
+		t.Errorf("Unexpected values: %d %s", status, body)
+	}
+
+	// A write reaches the handler and is stored
+	status, _ = phone.request("PUT", "/characteristics", []byte(fmt.Sprintf(`{"characteristics":[{"aid":2,"iid":%d,"value":1}]}`, heater.iid)))
+	if status != 204 {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if value := <-b.writes; value != true {
+		t.Errorf("Expected true to be written, got %v", value)
+	}
+	if heater.Value() != true {
+		t.Error("Expected the written value to be stored")
+	}
+
+	// Failed and invalid writes report a status per characteristic
+	state := b.thermostat.TargetState
+	status, body = phone.request("PUT", "/characteristics", []byte(fmt.Sprintf(
+		`{"characteristics":[{"aid":2,"iid":%d,"value":22},{"aid":2,"iid":%d,"value":1},{"aid":9,"iid":1,"value":1}]}`,
+		target.iid, state.iid)))
+	results := phone.characteristics(status, body)
+	if status != 207 || len(results) != 3 ||
+		*results[0].Status != statusCommunication || *results[1].Status != statusInvalidValue || *results[2].Status != statusNotFound {
+		t.Errorf("Unexpected write results: %d %s", status, body)
+	}
+	if target.Value() != float64(15) {
+		t.Error("Expected a failed write not to be stored")
+	}
+
+	// Subscribed characteristics send events when they change
+	current := b.thermostat.CurrentTemperature
+	status, _ = phone.request("PUT", "/characteristics", []byte(fmt.Sprintf(`{"characteristics":[{"aid":2,"iid":%d,"ev":true}]}`, current.iid)))
+	if status != 204 {
+		t.Fatalf("Expected 204 subscribing, got %d", status)
+	}
+	current.SetValue(21.5)
+	status, body, err := phone.message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := phone.characteristics(status, body)
+	if len(events) != 1 || events[0].IID != current.iid || events[0].Value != 21.5 {
+		t.Errorf("Unexpected event %s", body)
+	}
+
+	// Only one controller can pair with the setup code
+	other := newTestController(t, b.addr, "other")
+	if code := other.pairSetup(testSetupCode); code != errorUnavailable {
+		t.Errorf("Expected pair setup to be unavailable once paired, got %d", code)
+	}
+
+	// Pairings survive a restart
+	restarted := newTestBridge(t, dir)
+	again := newTestController(t, restarted.addr, "phone")
+	again.key, again.accessoryKey = phone.key, phone.accessoryKey
+	if code := again.pairVerify(); code != 0 {
+		t.Errorf("Expected pair verify to succeed after a restart, got error %d", code)
+	}
+}
+
+func TestPairSetupWrongCode(t *testing.T) {
+	b := newTestBridge(t, t.TempDir())
+	phone := newTestController(t, b.addr, "phone")
+	if code := phone.pairSetup("111-22-333"); code != errorAuthentication {
+		t.Errorf("Expected an authentication error, got %d", code)
+	}
+	if b.server.Paired() {
+		t.Error("Expected the bridge to stay unpaired")
+	}
+
+	// An unknown controller can't verify
+	stranger := newTestController(t, b.addr, "stranger")
+	stranger.accessoryKey = b.server.store.publicKey()
+	if code := stranger.pairVerify(); code != errorAuthentication {
+		t.Errorf("Expected an authentication error, got %d", code)
+	}
+}
+
+func TestPairings(t *testing.T) {
+	b := newTestBridge(t, t.TempDir())
+	phone := newTestController(t, b.addr, "phone")
+	if code := phone.pairSetup(testSetupCode); code != 0 {
+		t.Fatalf("Pair setup failed with error %d", code)
+	}
+	if code := phone.pairVerify(); code != 0 {
+		t.Fatalf("Pair verify failed with error %d", code)
+	}
+
+	hubKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	var add tlv8
+	add.addByte(tlvState, 1)
+	add.addByte(tlvMethod, methodAddPairing)
+	add.add(tlvIdentifier, []byte("hub"))
+	add.add(tlvPublicKey, hubKey)
+	add.addByte(tlvPermissions, 0)
+	if response := phone.tlv("/pairings", add); len(response) != 1 {
+		t.Fatalf("Unexpected add response %v", response)
+	}
+
+	var list tlv8
+	list.addByte(tlvState, 1)
+	list.addByte(tlvMethod, methodListPairings)
+	response := phone.tlv("/pairings", list)
+	ids := 0
+	for _, item := range response {
+		if item.kind == tlvIdentifier {
+			ids++
+		}
+	}
+	if ids != 2 {
+		t.Errorf("Expected two pairings, got %d", ids)
+	}
+
+	// Removing the only admin unpairs the bridge and ends the session
+	var remove tlv8
+	remove.addByte(tlvState, 1)
+	remove.addByte(tlvMethod, methodRemovePairing)
+	remove.add(tlvIdentifier, []byte("phone"))
+	phone.tlv("/pairings", remove)
+	if b.server.Paired() {
+		t.Errorf("Expected every pairing to be removed, got %v", b.server.Pairings())
+	}
+	if _, _, err := phone.message(); err == nil {
+		t.Error("Expected the removed controller's session to end")
+	}
+}
+
+func TestConfigNumber(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.configNumber("a")
+	same, _ := s.configNumber("a")
+	changed, _ := s.configNumber("b")
+	if first != 1 || same != 1 || changed != 2 {
+		t.Errorf("Expected config numbers 1, 1, 2, got %d, %d, %d", first, same, changed)
+	}
+
+	reopened, err := openStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.id() != s.id() || !reopened.publicKey().Equal(s.publicKey()) {
+		t.Error("Expected the identity to persist")
+	}
+	if n, _ := reopened.configNumber("b"); n != 2 {
+		t.Errorf("Expected config number 2 after reopening, got %d", n)
+	}
+}
@@ -0,0 +1,134 @@
+package homekit
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/cronokirby/saferith"
+)
+
+// Pair setup proves both sides know the setup code with SRP-6a (RFC 5054),
+// using the 3072-bit group, SHA-512 and the username Pair-Setup. The
+// arithmetic is saferith's, whose timing doesn't depend on the secrets.
+
+// srpUsername is the SRP identity used by pair setup
+const srpUsername = "Pair-Setup"
+
+// srpN is the 3072-bit group's prime
+var srpN, _ = saferith.ModulusFromHex(strings.Join([]string{
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74",
+	"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437",
+	"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED",
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05",
+	"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB",
+	"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B",
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718",
+	"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33",
+	"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7",
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864",
+	"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2",
+	"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF",
+}, ""))
+
+// srpG is the group's generator
+var srpG = new(saferith.Nat).SetBytes([]byte{5})
+
+// srpLen is the length of the prime in bytes
+var srpLen = (srpN.BitLen() + 7) / 8
+
+var errSRPProof = errors.New("homekit: incorrect setup code")
+
+// srpServer is the accessory's side of one SRP exchange
+type srpServer struct {
+	salt     []byte
+	verifier *saferith.Nat
+	secret   *saferith.Nat // b
+	public   *saferith.Nat // B
+	key      []byte        // K, once verified
+}
+
+// newSRPServer starts an exchange for a setup code
+func newSRPServer(setupCode string) (*srpServer, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	s := &srpServer{
+		salt:   salt,
+		secret: new(saferith.Nat).SetBytes(secret),
+	}
+	x := new(saferith.Nat).SetBytes(srpHash(salt, srpHash([]byte(srpUsername+":"+setupCode))))
+	s.verifier = new(saferith.Nat).Exp(srpG, x, srpN)
+
+	// B = k*v + g^b
+	s.public = new(saferith.Nat).ModMul(srpK(), s.verifier, srpN)
+	s.public.ModAdd(s.public, new(saferith.Nat).Exp(srpG, s.secret, srpN), srpN)
+	return s, nil
+}
+
+// publicKey returns B
+func (s *srpServer) publicKey() []byte {
+	return srpPad(s.public)
+}
+
+// verify checks the controller's public key A and proof M1, returning the
+// accessory's proof M2
+func (s *srpServer) verify(clientPublic, clientProof []byte) ([]byte, error) {
+	if len(clientPublic) > srpLen {
+		return nil, errSRPProof
+	}
+	A := new(saferith.Nat).Mod(new(saferith.Nat).SetBytes(clientPublic), srpN)
+	if A.EqZero() == 1 {
+		return nil, errSRPProof
+	}
+
+	// S = (A * v^u)^b
+	u := new(saferith.Nat).SetBytes(srpHash(srpPad(A), srpPad(s.public)))
+	S := new(saferith.Nat).Exp(s.verifier, u, srpN)
+	S.ModMul(S, A, srpN)
+	S.Exp(S, s.secret, srpN)
+	key := srpHash(srpPad(S))
+
+	expected := srpClientProof(s.salt, srpPad(A), srpPad(s.public), key)
+	if subtle.ConstantTimeCompare(expected, clientProof) != 1 {
+		return nil, errSRPProof
+	}
+	s.key = key
+	return srpHash(srpPad(A), expected, key), nil
+}
+
+// srpK is the multiplier k = H(N, pad(g))
+func srpK() *saferith.Nat {
+	return new(saferith.Nat).SetBytes(srpHash(srpN.Bytes(), srpPad(srpG)))
+}
+
+// srpClientProof computes M1 = H(H(N) xor H(g), H(I), s, A, B, K)
+func srpClientProof(salt, A, B, key []byte) []byte {
+	hN, hG := srpHash(srpN.Bytes()), srpHash(srpG.Bytes())
+	for i := range hN {
+		hN[i] ^= hG[i]
+	}
+	return srpHash(hN, srpHash([]byte(srpUsername)), salt, A, B, key)
+}
+
+// srpHash is SHA-512 over the concatenated parts
+func srpHash(parts ...[]byte) []byte {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// srpPad encodes n at the length of the prime
+func srpPad(n *saferith.Nat) []byte {
+	return n.FillBytes(make([]byte, srpLen))
+}
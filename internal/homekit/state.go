@@ -0,0 +1,208 @@
+package homekit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxPairings is how many controllers may be paired
+const maxPairings = 16
+
+// Pairing is a controller, such as an iPhone or a home hub, allowed to use
+// the accessory
+type Pairing struct {
+	ID        string `json:"id"`
+	PublicKey []byte `json:"public_key"`
+	Admin     bool   `json:"admin"`
+}
+
+// identity is what the accessory keeps across restarts
+type identity struct {
+	ID           string    `json:"id"`          // Accessory pairing ID, like a MAC address
+	PrivateKey   []byte    `json:"private_key"` // Ed25519 seed
+	Layout       string    `json:"layout"`      // Accessory layout the config number was issued for
+	ConfigNumber int       `json:"config_number"`
+	Pairings     []Pairing `json:"pairings"`
+}
+
+// store holds the identity in a file
+type store struct {
+	mu    sync.RWMutex
+	path  string
+	state identity
+	key   ed25519.PrivateKey
+}
+
+// openStore loads the identity from dir, creating one on first use
+func openStore(dir string) (*store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create HomeKit directory: %w", err)
+	}
+	s := &store{path: filepath.Join(dir, "homekit.json")}
+
+	data, err := os.ReadFile(s.path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+		}
+		if len(s.state.PrivateKey) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%s has an invalid private key", s.path)
+		}
+	case os.IsNotExist(err):
+		id := make([]byte, 6)
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		s.state = identity{ID: formatID(id), PrivateKey: seed, ConfigNumber: 1}
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to read HomeKit state: %w", err)
+	}
+
+	s.key = ed25519.NewKeyFromSeed(s.state.PrivateKey)
+	return s, nil
+}
+
+// formatID formats six bytes as XX:XX:XX:XX:XX:XX
+func formatID(id []byte) string {
+	parts := make([]string, len(id))
+	for i, b := range id {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// save writes the state atomically. Callers hold the lock or own the store.
+func (s *store) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save HomeKit state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save HomeKit state: %w", err)
+	}
+	return nil
+}
+
+// id returns the accessory pairing ID
+func (s *store) id() string {
+	return s.state.ID
+}
+
+// publicKey returns the accessory's long-term public key
+func (s *store) publicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// sign signs a message with the accessory's long-term key
+func (s *store) sign(message []byte) []byte {
+	return ed25519.Sign(s.key, message)
+}
+
+// configNumber returns the config number for an accessory layout, issuing a
+// new one if the layout changed
+func (s *store) configNumber(layout string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Layout != layout {
+		if s.state.Layout != "" {
+			// Config numbers wrap from 65535 to 1
+			s.state.ConfigNumber = s.state.ConfigNumber%65535 + 1
+		}
+		s.state.Layout = layout
+		if err := s.save(); err != nil {
+			return 0, err
+		}
+	}
+	return s.state.ConfigNumber, nil
+}
+
+// paired reports whether any controller is paired
+func (s *store) paired() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.state.Pairings) > 0
+}
+
+// pairing looks up a controller
+func (s *store) pairing(id string) (Pairing, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.state.Pairings {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Pairing{}, false
+}
+
+// pairings returns every paired controller
+func (s *store) pairings() []Pairing {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Pairing(nil), s.state.Pairings...)
+}
+
+// addPairing adds a controller or updates its permissions. A controller
+// that is already paired must keep its key.
+func (s *store) addPairing(pairing Pairing) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.state.Pairings {
+		if p.ID == pairing.ID {
+			if !ed25519.PublicKey(p.PublicKey).Equal(ed25519.PublicKey(pairing.PublicKey)) {
+				return fmt.Errorf("controller %s is paired with a different key", p.ID)
+			}
+			s.state.Pairings[i].Admin = pairing.Admin
+			return s.save()
+		}
+	}
+	if len(s.state.Pairings) >= maxPairings {
+		return errMaxPeers
+	}
+	s.state.Pairings = append(s.state.Pairings, pairing)
+	return s.save()
+}
+
+// removePairing removes a controller. Removing the last admin removes every
+// pairing, returning the accessory to unpaired.
+func (s *store) removePairing(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []Pairing
+	admins := 0
+	for _, p := range s.state.Pairings {
+		if p.ID != id {
+			kept = append(kept, p)
+			if p.Admin {
+				admins++
+			}
+		}
+	}
+	if admins == 0 {
+		kept = nil
+	}
+	s.state.Pairings = kept
+	return s.save()
+}
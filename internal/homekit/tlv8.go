@@ -0,0 +1,116 @@
+package homekit
+
+import "errors"
+
+// TLV8 types used by pairing
+const (
+	tlvMethod        = 0x00
+	tlvIdentifier    = 0x01
+	tlvSalt          = 0x02
+	tlvPublicKey     = 0x03
+	tlvProof         = 0x04
+	tlvEncryptedData = 0x05
+	tlvState         = 0x06
+	tlvError         = 0x07
+	tlvSignature     = 0x0a
+	tlvPermissions   = 0x0b
+	tlvSeparator     = 0xff
+)
+
+// Pairing errors
+const (
+	errorUnknown        = 0x01
+	errorAuthentication = 0x02
+	errorMaxPeers       = 0x04
+	errorMaxTries       = 0x05
+	errorUnavailable    = 0x06
+	errorBusy           = 0x07
+)
+
+var errTLV = errors.New("homekit: malformed TLV8")
+
+// tlvItem is one type and value
+type tlvItem struct {
+	kind  byte
+	value []byte
+}
+
+// tlv8 is an ordered list of items. Values longer than 255 bytes are split
+// across consecutive items of the same type when encoded and joined again
+// when decoded.
+type tlv8 []tlvItem
+
+// decodeTLV8 parses a TLV8 message
+func decodeTLV8(data []byte) (tlv8, error) {
+	var items tlv8
+	for len(data) > 0 {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return nil, errTLV
+		}
+		kind, value := data[0], data[2:2+int(data[1])]
+		data = data[2+len(value):]
+
+		// A fragment continues the previous item if that one was full
+		if n := len(items); n > 0 && items[n-1].kind == kind && len(items[n-1].value)%255 == 0 && len(items[n-1].value) > 0 {
+			items[n-1].value = append(items[n-1].value, value...)
+			continue
+		}
+		items = append(items, tlvItem{kind: kind, value: append([]byte(nil), value...)})
+	}
+	return items, nil
+}
+
+// encode returns the message's wire form
+func (t tlv8) encode() []byte {
+	var out []byte
+	for _, item := range t {
+		value := item.value
+		for {
+			n := min(len(value), 255)
+			out = append(out, item.kind, byte(n))
+			out = append(out, value[:n]...)
+			value = value[n:]
+			if len(value) == 0 {
+				break
+			}
+		}
+	}
+	return out
+}
+
+// add appends an item
+func (t *tlv8) add(kind byte, value []byte) {
+	*t = append(*t, tlvItem{kind: kind, value: value})
+}
+
+// addByte appends an item with a one-byte value
+func (t *tlv8) addByte(kind, value byte) {
+	t.add(kind, []byte{value})
+}
+
+// get returns the first value of a type
+func (t tlv8) get(kind byte) ([]byte, bool) {
+	for _, item := range t {
+		if item.kind == kind {
+			return item.value, true
+		}
+	}
+	return nil, false
+}
+
+// getByte returns the first value of a type, which must be one byte
+func (t tlv8) getByte(kind byte) (byte, bool) {
+	value, ok := t.get(kind)
+	if !ok || len(value) != 1 {
+		return 0, false
+	}
+	return value[0], true
+}
+
+// pairingError returns a pairing response reporting an error
+func pairingError(state, code byte) tlv8 {
+	var response tlv8
+	response.addByte(tlvState, state)
+	response.addByte(tlvError, code)
+	return response
+}
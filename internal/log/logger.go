@@ -42,8 +42,25 @@ func logLevel() Level {
 	return globalLogLevel
 }
 
+// sink receives messages instead of stderr when set
+var sink func(level Level, msg string)
+
+// SetSink sends messages to f instead of stderr
+func SetSink(f func(level Level, msg string)) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	sink = f
+}
+
 func log(level Level, format string, a ...interface{}) {
 	if level <= logLevel() {
+		logMutex.Lock()
+		f := sink
+		logMutex.Unlock()
+		if f != nil {
+			f(level, fmt.Sprintf(format, a...))
+			return
+		}
 		msg := fmt.Sprintf("%s %s ", time.Now().Format(time.RFC3339), labels[level])
 		msg += fmt.Sprintf(format, a...)
 		fmt.Fprintln(os.Stderr, msg)
@@ -0,0 +1,258 @@
+// Package logging sets up the server's log from the logging config: level
+// filtering, text or JSON records, and stdout, stderr or a file rotated by
+// size and age.
+//
+// Most of the server logs through a *log.Logger. Std returns one that
+// writes into the structured log. Those call sites predate levels, so a
+// message may start with a "debug: ", "info: ", "warn: " or "error: " tag;
+// otherwise its level is inferred, with failures logged as errors.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	liblog "github.com/teslamotors/vehicle-command/internal/log"
+)
+
+// Levels
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Outputs
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+)
+
+// Config holds logging configuration
+type Config struct {
+	Level      string `json:"level"`       // debug, info, warn, error
+	Format     string `json:"format"`      // json, text
+	Output     string `json:"output"`      // stdout, stderr, file
+	FilePath   string `json:"file_path"`   // Path to log file (if output is file)
+	MaxSize    int    `json:"max_size"`    // Max log file size in MB
+	MaxBackups int    `json:"max_backups"` // Max number of backup files
+	MaxAge     int    `json:"max_age"`     // Max age in days
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if _, err := ParseLevel(c.Level); err != nil {
+		return err
+	}
+	if c.Format != FormatText && c.Format != FormatJSON {
+		return fmt.Errorf("format must be one of: json, text")
+	}
+	switch c.Output {
+	case OutputStdout, OutputStderr:
+	case OutputFile:
+		if c.FilePath == "" {
+			return fmt.Errorf("file_path is required when output is file")
+		}
+	default:
+		return fmt.Errorf("output must be one of: stdout, stderr, file")
+	}
+	if c.MaxSize < 0 || c.MaxBackups < 0 || c.MaxAge < 0 {
+		return fmt.Errorf("max_size, max_backups and max_age must not be negative")
+	}
+	return nil
+}
+
+// ParseLevel returns the slog level for a config level
+func ParseLevel(level string) (slog.Level, error) {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug, nil
+	case LevelInfo:
+		return slog.LevelInfo, nil
+	case LevelWarn:
+		return slog.LevelWarn, nil
+	case LevelError:
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("level must be one of: debug, info, warn, error")
+}
+
+// Logger is the structured log
+type Logger struct {
+	*slog.Logger
+	level *slog.LevelVar
+	out   io.Writer
+}
+
+// New opens the log described by config
+func New(config Config) (*Logger, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	var out io.Writer
+	switch config.Output {
+	case OutputStdout:
+		out = os.Stdout
+	case OutputStderr:
+		out = os.Stderr
+	case OutputFile:
+		file, err := openRotating(config)
+		if err != nil {
+			return nil, fmt.Errorf("logging: %w", err)
+		}
+		out = file
+	}
+	return NewWriter(config, out)
+}
+
+// NewWriter creates a log writing to out in config's level and format,
+// ignoring its output
+func NewWriter(config Config, out io.Writer) (*Logger, error) {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+	l := &Logger{level: new(slog.LevelVar), out: out}
+	l.level.Set(level)
+
+	options := &slog.HandlerOptions{Level: l.level}
+	var handler slog.Handler = slog.NewTextHandler(out, options)
+	if config.Format == FormatJSON {
+		handler = slog.NewJSONHandler(out, options)
+	}
+	l.Logger = slog.New(handler)
+	return l, nil
+}
+
+// SetLevel changes the level, e.g. when the config file is edited
+func (l *Logger) SetLevel(level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.Set(parsed)
+	liblog.SetLevel(libraryLevel(parsed))
+	return nil
+}
+
+// Std returns a *log.Logger that writes into the log
+func (l *Logger) Std() *log.Logger {
+	return log.New(&stdWriter{logger: l.Logger}, "", log.Lshortfile)
+}
+
+// CaptureLibrary sends the vehicle command library's log, which otherwise
+// goes to stderr, into the log at the same level
+func (l *Logger) CaptureLibrary() {
+	liblog.SetLevel(libraryLevel(l.level.Level()))
+	liblog.SetSink(func(level liblog.Level, msg string) {
+		l.Log(context.Background(), slogLevel(level), msg, "component", "vehicle")
+	})
+}
+
+// Close closes the log file, if the log has one
+func (l *Logger) Close() error {
+	if closer, ok := l.out.(io.Closer); ok && l.out != os.Stdout && l.out != os.Stderr {
+		return closer.Close()
+	}
+	return nil
+}
+
+// libraryLevel maps a level to the library's
+func libraryLevel(level slog.Level) liblog.Level {
+	switch {
+	case level <= slog.LevelDebug:
+		return liblog.LevelDebug
+	case level <= slog.LevelInfo:
+		return liblog.LevelInfo
+	case level <= slog.LevelWarn:
+		return liblog.LevelWarning
+	}
+	return liblog.LevelError
+}
+
+// slogLevel maps a library level to a level
+func slogLevel(level liblog.Level) slog.Level {
+	switch level {
+	case liblog.LevelDebug:
+		return slog.LevelDebug
+	case liblog.LevelWarning:
+		return slog.LevelWarn
+	case liblog.LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Debugf logs a debug message through a *log.Logger
+func Debugf(logger *log.Logger, format string, args ...interface{}) {
+	logger.Output(2, "debug: "+fmt.Sprintf(format, args...))
+}
+
+// sourcePattern matches the file:line prefix added by log.Lshortfile
+var sourcePattern = regexp.MustCompile(`^([\w.-]+\.go:\d+): `)
+
+// levelTags are the message prefixes that set a level
+var levelTags = []struct {
+	tag   string
+	level slog.Level
+}{
+	{"debug: ", slog.LevelDebug},
+	{"info: ", slog.LevelInfo},
+	{"warn: ", slog.LevelWarn},
+	{"warning: ", slog.LevelWarn},
+	{"error: ", slog.LevelError},
+}
+
+// stdWriter turns the lines of a *log.Logger into records
+type stdWriter struct {
+	logger *slog.Logger
+}
+
+// Write implements io.Writer. log.Logger calls it once per message.
+func (w *stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	var attrs []any
+	if m := sourcePattern.FindStringSubmatch(msg); m != nil {
+		attrs = append(attrs, "source", m[1])
+		msg = msg[len(m[0]):]
+	}
+	if m := requestIDPattern.FindStringSubmatch(msg); m != nil {
+		attrs = append(attrs, "request_id", m[1])
+		msg = msg[:len(msg)-len(m[0])]
+	}
+	level, msg := messageLevel(msg)
+	w.logger.Log(context.Background(), level, msg, attrs...)
+	return len(p), nil
+}
+
+// messageLevel returns the level of a message and the message without its
+// level tag
+func messageLevel(msg string) (slog.Level, string) {
+	lower := strings.ToLower(msg)
+	for _, t := range levelTags {
+		if strings.HasPrefix(lower, t.tag) {
+			return t.level, msg[len(t.tag):]
+		}
+	}
+	switch {
+	case strings.Contains(lower, "retrying") || strings.Contains(lower, "restarting in") || strings.Contains(lower, "failing over"):
+		return slog.LevelWarn, msg
+	case strings.Contains(lower, "fail") || strings.Contains(lower, "error") || strings.Contains(lower, "panic"):
+		return slog.LevelError, msg
+	}
+	return slog.LevelInfo, msg
+}
@@ -0,0 +1,179 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	liblog "github.com/teslamotors/vehicle-command/internal/log"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{Level: LevelInfo, Format: FormatText, Output: OutputStdout}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"level", func(c *Config) { c.Level = "verbose" }},
+		{"format", func(c *Config) { c.Format = "xml" }},
+		{"output", func(c *Config) { c.Output = "syslog" }},
+		{"file without path", func(c *Config) { c.Output = OutputFile }},
+		{"negative max_size", func(c *Config) { c.MaxSize = -1 }},
+	}
+	for _, tt := range tests {
+		config := valid
+		tt.modify(&config)
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// records decodes JSON log lines
+func records(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		result = append(result, record)
+	}
+	return result
+}
+
+func TestStdLevels(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewWriter(Config{Level: LevelInfo, Format: FormatJSON}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := logger.Std()
+
+	std.Printf("Connected to %s", "TEST_VIN")
+	Debugf(std, "Setting fan speed to: %d", 4)
+	std.Printf("Failed to get HVAC state: %v", "timeout")
+	std.Printf("Subsystem 'mqtt' failed: refused. Restarting in 1s")
+	std.Printf("warning: weak key")
+
+	got := records(t, &out)
+	expected := []struct{ level, msg string }{
+		{"INFO", "Connected to TEST_VIN"},
+		{"ERROR", "Failed to get HVAC state: timeout"},
+		{"WARN", "Subsystem 'mqtt' failed: refused. Restarting in 1s"},
+		{"WARN", "weak key"},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d records, got %v", len(expected), got)
+	}
+	for i, want := range expected {
+		if got[i]["level"] != want.level || got[i]["msg"] != want.msg {
+			t.Errorf("Record %d: expected %s %q, got %v", i, want.level, want.msg, got[i])
+		}
+		if source, _ := got[i]["source"].(string); !strings.HasPrefix(source, "logging_test.go:") {
+			t.Errorf("Record %d: expected the caller as source, got %v", i, got[i]["source"])
+		}
+	}
+
+	// Debug messages appear once the level is lowered
+	out.Reset()
+	if err := logger.SetLevel(LevelDebug); err != nil {
+		t.Fatal(err)
+	}
+	Debugf(std, "Setting fan speed to: %d", 4)
+	if got := records(t, &out); len(got) != 1 || got[0]["level"] != "DEBUG" || got[0]["msg"] != "Setting fan speed to: 4" {
+		t.Errorf("Expected the debug message, got %v", got)
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewWriter(Config{Level: LevelWarn, Format: FormatText}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Std().Printf("Server started")
+	logger.Std().Printf("Failed to load plugin")
+	if text := out.String(); strings.Contains(text, "Server started") || !strings.Contains(text, `level=ERROR msg="Failed to load plugin"`) {
+		t.Errorf("Unexpected output %q", text)
+	}
+}
+
+func TestFileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "server.log")
+	logger, err := New(Config{Level: LevelInfo, Format: FormatText, Output: OutputFile, FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hello")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "msg=hello") {
+		t.Errorf("Expected the record in the file, got %q, %v", data, err)
+	}
+}
+
+func TestCaptureLibrary(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewWriter(Config{Level: LevelWarn, Format: FormatJSON}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.CaptureLibrary()
+	defer liblog.SetSink(nil)
+	defer liblog.SetLevel(liblog.LevelNone)
+
+	liblog.Info("session started")
+	liblog.Warning("retrying handshake")
+	got := records(t, &out)
+	if len(got) != 1 || got[0]["msg"] != "retrying handshake" || got[0]["component"] != "vehicle" {
+		t.Errorf("Expected only the library warning, got %v", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewWriter(Config{Level: LevelInfo, Format: FormatJSON}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := logger.Std()
+
+	if ForContext(context.Background(), std) != std {
+		t.Error("Expected the logger unchanged without a request ID")
+	}
+	ctx := WithRequestID(context.Background(), "abc-123")
+	ForContext(ctx, std).Printf("Operation 'connect' failed on attempt 1: timeout. Retrying in 1s")
+	Debugf(ForContext(ctx, std), "hidden")
+
+	got := records(t, &out)
+	if len(got) != 1 || got[0]["request_id"] != "abc-123" || got[0]["level"] != "WARN" ||
+		got[0]["msg"] != "Operation 'connect' failed on attempt 1: timeout. Retrying in 1s" {
+		t.Errorf("Expected the message with its request ID, got %v", got)
+	}
+	if source, _ := got[0]["source"].(string); !strings.HasPrefix(source, "logging_test.go:") {
+		t.Errorf("Expected the caller as source, got %v", got[0]["source"])
+	}
+
+	// Without the structured log, the ID is appended to the line
+	var plain bytes.Buffer
+	ForContext(ctx, log.New(&plain, "", 0)).Printf("Turning climate system on")
+	if plain.String() != "Turning climate system on request_id=abc-123\n" {
+		t.Errorf("Unexpected line %q", plain.String())
+	}
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"regexp"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the HTTP request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ForContext returns logger, tagging each message with the request ID in ctx
+// if it has one. The log records the tag as a request_id attribute.
+func ForContext(ctx context.Context, logger *log.Logger) *log.Logger {
+	id := RequestID(ctx)
+	if id == "" {
+		return logger
+	}
+	return log.New(&requestIDWriter{out: logger.Writer(), suffix: " request_id=" + id}, logger.Prefix(), logger.Flags())
+}
+
+// requestIDPattern matches the tag added by ForContext
+var requestIDPattern = regexp.MustCompile(` request_id=(\S+)$`)
+
+// requestIDWriter adds a request ID tag to each message
+type requestIDWriter struct {
+	out    io.Writer
+	suffix string
+}
+
+// Write implements io.Writer. log.Logger calls it once per message.
+func (w *requestIDWriter) Write(p []byte) (int, error) {
+	line := make([]byte, 0, len(p)+len(w.suffix)+1)
+	line = append(line, bytes.TrimSuffix(p, []byte("\n"))...)
+	line = append(line, w.suffix+"\n"...)
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names backups, e.g. server-2025-01-02T15-04-05.000.log,
+// so they sort by age
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotatingFile is a log file that is renamed to a timestamped backup once it
+// reaches its size limit or holds entries older than the age limit. Backups
+// beyond the count or age limits are deleted when it rotates.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64         // 0 never rotates by size
+	maxBackups int           // 0 keeps every backup
+	maxAge     time.Duration // 0 keeps backups and the file regardless of age
+	now        func() time.Time
+
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// openRotating opens the log file described by config
+func openRotating(config Config) (*rotatingFile, error) {
+	return newRotatingFile(config.FilePath, int64(config.MaxSize)<<20, config.MaxBackups,
+		time.Duration(config.MaxAge)*24*time.Hour)
+}
+
+func newRotatingFile(path string, maxBytes int64, maxBackups int, maxAge time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups, maxAge: maxAge, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.prune()
+	return f, nil
+}
+
+// open opens or creates the file. An existing file's age is taken from its
+// modification time, the best available record of its entries.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.created = f.now()
+	if f.size > 0 {
+		f.created = info.ModTime()
+	}
+	return nil
+}
+
+// Write implements io.Writer
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("logging: rotate: %w", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n bytes
+func (f *rotatingFile) due(n int) bool {
+	if f.maxBytes > 0 && f.size+int64(n) > f.maxBytes {
+		return true
+	}
+	return f.maxAge > 0 && f.now().Sub(f.created) > f.maxAge
+}
+
+// rotate renames the file to a backup, starts a new one and prunes backups
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := os.Rename(f.path, f.backupName(f.now())); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// backupName returns the name of a backup made at t
+func (f *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-" + t.UTC().Format(backupTimeFormat) + ext
+}
+
+// backups returns the file's backups, newest first
+func (f *rotatingFile) backups() []string {
+	ext := filepath.Ext(f.path)
+	prefix := filepath.Base(strings.TrimSuffix(f.path, ext)) + "-"
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || !strings.HasSuffix(stamp, ext) || entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext)); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names
+}
+
+// prune deletes backups beyond max_backups and older than max_age. Errors
+// are ignored: the next rotation tries again.
+func (f *rotatingFile) prune() {
+	ext := filepath.Ext(f.path)
+	prefix := filepath.Base(strings.TrimSuffix(f.path, ext)) + "-"
+	dir := filepath.Dir(f.path)
+	for i, name := range f.backups() {
+		stamp, _ := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && f.now().Sub(stamp) > f.maxAge) {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
+
+// Close implements io.Closer
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
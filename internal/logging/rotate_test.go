@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+	f, err := newRotatingFile(path, 10, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		now = now.Add(time.Second)
+		if _, err := f.Write([]byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each write filled the file, so three rotations kept the newest two
+	backups := f.backups()
+	if len(backups) != 2 || backups[0] != "server-2025-01-02T15-04-09.000.log" || backups[1] != "server-2025-01-02T15-04-08.000.log" {
+		t.Errorf("Unexpected backups %v", backups)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 10 {
+		t.Errorf("Expected the last write in the file, got %v, %v", info, err)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+	old := filepath.Join(dir, "server-2025-01-01T00-00-00.000.log")
+	for _, name := range []string{old, filepath.Join(dir, "server-notes.log")} {
+		if err := os.WriteFile(name, []byte("old\n"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := newRotatingFile(path, 0, 0, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected the expired backup to be deleted, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "server-notes.log")); err != nil {
+		t.Errorf("Expected other files to be kept, got %v", err)
+	}
+
+	start := f.now()
+	f.now = func() time.Time { return start.Add(time.Hour) }
+	f.Write([]byte("first\n"))
+	f.now = func() time.Time { return start.Add(25 * time.Hour) }
+	f.Write([]byte("second\n"))
+
+	backups := f.backups()
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %v", backups)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, backups[0]))
+	current, _ := os.ReadFile(path)
+	if string(data) != "first\n" || string(current) != "second\n" {
+		t.Errorf("Unexpected contents %q and %q", data, current)
+	}
+}
+
+func TestRotatingLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	logger, err := New(Config{Level: LevelInfo, Format: FormatText, Output: OutputFile, FilePath: path, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := strings.Repeat("x", 1000)
+	for i := 0; i < 1100; i++ {
+		logger.Info(message)
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "server-*.log"))
+	if len(matches) != 1 {
+		t.Errorf("Expected one backup after writing over 1 MB, got %v", matches)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > 1<<20 {
+		t.Errorf("Expected the log under 1 MB, got %v, %v", info, err)
+	}
+}
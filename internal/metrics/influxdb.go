@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InfluxDBConfig configures the InfluxDB exporter. Set Bucket and Org for
+// InfluxDB 2.x, or Database for 1.x.
+type InfluxDBConfig struct {
+	URL      string `json:"url"`                // e.g. http://localhost:8086 (disabled if empty)
+	Database string `json:"database,omitempty"` // InfluxDB 1.x database
+	Org      string `json:"org,omitempty"`      // InfluxDB 2.x organization
+	Bucket   string `json:"bucket,omitempty"`   // InfluxDB 2.x bucket
+	Token    string `json:"token,omitempty"`    // API token, sent as "Authorization: Token ..."
+}
+
+// Enabled reports whether the exporter is configured
+func (c InfluxDBConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks the configuration
+func (c InfluxDBConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	if c.Bucket == "" && c.Database == "" {
+		return fmt.Errorf("bucket (InfluxDB 2.x) or database (InfluxDB 1.x) is required")
+	}
+	return nil
+}
+
+// InfluxDBExporter writes points using the InfluxDB line protocol
+type InfluxDBExporter struct {
+	writeURL string
+	token    string
+	client   *http.Client
+}
+
+// NewInfluxDBExporter creates an exporter for the given configuration
+func NewInfluxDBExporter(config InfluxDBConfig) (*InfluxDBExporter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid influxdb config: %w", err)
+	}
+
+	base := strings.TrimSuffix(config.URL, "/")
+	query := url.Values{"precision": {"ms"}}
+	var writeURL string
+	if config.Bucket != "" {
+		query.Set("bucket", config.Bucket)
+		query.Set("org", config.Org)
+		writeURL = base + "/api/v2/write?" + query.Encode()
+	} else {
+		query.Set("db", config.Database)
+		writeURL = base + "/write?" + query.Encode()
+	}
+
+	return &InfluxDBExporter{
+		writeURL: writeURL,
+		token:    config.Token,
+		client:   &http.Client{},
+	}, nil
+}
+
+// Name implements Exporter
+func (e *InfluxDBExporter) Name() string {
+	return "influxdb"
+}
+
+// Export implements Exporter
+func (e *InfluxDBExporter) Export(ctx context.Context, points []Point) error {
+	var body bytes.Buffer
+	for _, point := range points {
+		writeLine(&body, point)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.writeURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// writeLine appends a point in line protocol:
+//
+//	measurement,tag=value field=1.5 1700000000000
+//
+// Tags and fields are sorted so output is stable. All fields are written as
+// floats so their type never changes between writes. NaN and infinite values
+// can't be represented and are skipped.
+func writeLine(b *bytes.Buffer, point Point) {
+	var fields []string
+	for _, key := range sortedKeys(point.Fields) {
+		if isFinite(point.Fields[key]) {
+			fields = append(fields, key)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	b.WriteString(measurementEscaper.Replace(point.Measurement))
+	for _, key := range sortedKeys(point.Tags) {
+		if point.Tags[key] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(keyEscaper.Replace(key))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(point.Tags[key]))
+	}
+
+	for i, key := range fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(keyEscaper.Replace(key))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(point.Fields[key], 'f', -1, 64))
+	}
+
+	if !point.Time.IsZero() {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(point.Time.UnixMilli(), 10))
+	}
+	b.WriteByte('\n')
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// isFinite reports whether v is neither NaN nor infinite
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+// Package metrics pushes client metrics to external systems such as InfluxDB
+// and statsd on a fixed interval.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Point is a set of related values sharing a measurement name and tags
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+
+	// Counter marks fields as cumulative totals rather than gauges
+	Counter bool
+
+	Time time.Time
+}
+
+// Exporter sends points to an external system
+type Exporter interface {
+	Name() string
+	Export(ctx context.Context, points []Point) error
+}
+
+// Pusher periodically collects points and sends them to every exporter
+type Pusher struct {
+	interval  time.Duration
+	tags      map[string]string
+	collect   func() []Point
+	exporters []Exporter
+	logger    *log.Logger
+}
+
+// NewPusher creates a pusher. tags are added to every point, without
+// overriding tags the point already has.
+func NewPusher(interval time.Duration, tags map[string]string, collect func() []Point, exporters []Exporter, logger *log.Logger) *Pusher {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Pusher{
+		interval:  interval,
+		tags:      tags,
+		collect:   collect,
+		exporters: exporters,
+		logger:    logger,
+	}
+}
+
+// Run pushes metrics every interval until ctx is done. Export failures are
+// logged and retried on the next tick; they don't stop the pusher.
+func (p *Pusher) Run(ctx context.Context) error {
+	if p.interval <= 0 {
+		return fmt.Errorf("metrics interval must be positive")
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			p.Push(ctx)
+		}
+	}
+}
+
+// Push collects and exports one batch of points
+func (p *Pusher) Push(ctx context.Context) {
+	points := p.collect()
+	if len(points) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for i := range points {
+		points[i].Tags = mergeTags(p.tags, points[i].Tags)
+		if points[i].Time.IsZero() {
+			points[i].Time = now
+		}
+	}
+
+	for _, exporter := range p.exporters {
+		exportCtx, cancel := context.WithTimeout(ctx, p.interval)
+		if err := exporter.Export(exportCtx, points); err != nil {
+			p.logger.Printf("Failed to export metrics to %s: %v", exporter.Name(), err)
+		}
+		cancel()
+	}
+}
+
+// mergeTags returns base overlaid with tags
+func mergeTags(base, tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(tags))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteLine(t *testing.T) {
+	var b bytes.Buffer
+	writeLine(&b, Point{
+		Measurement: "tesla hvac,x",
+		Tags:        map[string]string{"vin": "TEST_VIN", "site": "home garage", "empty": ""},
+		Fields:      map[string]float64{"temp": 21.5, "is_on": 1, "bad": math.NaN()},
+		Time:        time.UnixMilli(1700000000123),
+	})
+
+	expected := `tesla\ hvac\,x,site=home\ garage,vin=TEST_VIN is_on=1,temp=21.5 1700000000123` + "\n"
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+
+	b.Reset()
+	writeLine(&b, Point{Measurement: "m", Fields: map[string]float64{"bad": math.Inf(1)}})
+	if b.Len() != 0 {
+		t.Errorf("Expected points without finite fields to be skipped, got %q", b.String())
+	}
+}
+
+func TestInfluxDBExporter(t *testing.T) {
+	tests := []struct {
+		config       InfluxDBConfig
+		expectedPath string
+		expectedAuth string
+	}{
+		{InfluxDBConfig{Bucket: "tesla", Org: "home", Token: "secret"}, "/api/v2/write?bucket=tesla&org=home&precision=ms", "Token secret"},
+		{InfluxDBConfig{Database: "tesla"}, "/write?db=tesla&precision=ms", ""},
+	}
+
+	for _, test := range tests {
+		var path, auth, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, auth = r.URL.RequestURI(), r.Header.Get("Authorization")
+			data, _ := io.ReadAll(r.Body)
+			body = string(data)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		test.config.URL = server.URL + "/"
+		exporter, err := NewInfluxDBExporter(test.config)
+		if err != nil {
+			t.Fatalf("NewInfluxDBExporter failed: %v", err)
+		}
+
+		err = exporter.Export(context.Background(), []Point{{Measurement: "m", Fields: map[string]float64{"v": 1}}})
+		server.Close()
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+
+		if path != test.expectedPath {
+			t.Errorf("Expected path %s, got %s", test.expectedPath, path)
+		}
+		if auth != test.expectedAuth {
+			t.Errorf("Expected auth %q, got %q", test.expectedAuth, auth)
+		}
+		if body != "m v=1\n" {
+			t.Errorf("Unexpected body %q", body)
+		}
+	}
+}
+
+func TestInfluxDBExporterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bucket not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	exporter, err := NewInfluxDBExporter(InfluxDBConfig{URL: server.URL, Bucket: "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = exporter.Export(context.Background(), []Point{{Measurement: "m", Fields: map[string]float64{"v": 1}}})
+	if err == nil || !strings.Contains(err.Error(), "404: bucket not found") {
+		t.Errorf("Expected status error with message, got %v", err)
+	}
+}
+
+// listenUDP returns a local UDP listener and a function reading one packet
+func listenUDP(t *testing.T) (string, func() string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String(), func() string {
+		buf := make([]byte, 2048)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to read packet: %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestStatsdExporter(t *testing.T) {
+	tests := []struct {
+		tagStyle string
+		expected string
+	}{
+		{"", "tesla.hvac.temp:21.5|g|#vin:TEST_VIN\ntesla.op.count:3|c|#vin:TEST_VIN"},
+		{TagStyleInflux, "tesla.hvac.temp,vin=TEST_VIN:21.5|g\ntesla.op.count,vin=TEST_VIN:3|c"},
+		{TagStyleNone, "tesla.hvac.temp:21.5|g\ntesla.op.count:3|c"},
+	}
+
+	for _, test := range tests {
+		address, read := listenUDP(t)
+		exporter, err := NewStatsdExporter(StatsdConfig{Address: address, Prefix: "tesla", TagStyle: test.tagStyle})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tags := map[string]string{"vin": "TEST_VIN"}
+		points := []Point{
+			{Measurement: "hvac", Tags: tags, Fields: map[string]float64{"temp": 21.5}},
+			{Measurement: "op", Tags: tags, Fields: map[string]float64{"count": 3}, Counter: true},
+		}
+		if err := exporter.Export(context.Background(), points); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if packet := read(); packet != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.tagStyle, test.expected, packet)
+		}
+		exporter.Close()
+	}
+}
+
+func TestStatsdCounterDeltas(t *testing.T) {
+	address, read := listenUDP(t)
+	exporter, err := NewStatsdExporter(StatsdConfig{Address: address, TagStyle: TagStyleNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	export := func(count float64) {
+		points := []Point{
+			{Measurement: "op", Fields: map[string]float64{"count": count}, Counter: true},
+			{Measurement: "conn", Fields: map[string]float64{"up": 1}},
+		}
+		if err := exporter.Export(context.Background(), points); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+	}
+
+	export(5)
+	if packet := read(); packet != "op.count:5|c\nconn.up:1|g" {
+		t.Errorf("Unexpected first packet %q", packet)
+	}
+
+	// Only the change is sent, and unchanged counters are omitted
+	export(7)
+	if packet := read(); packet != "op.count:2|c\nconn.up:1|g" {
+		t.Errorf("Unexpected second packet %q", packet)
+	}
+	export(7)
+	if packet := read(); packet != "conn.up:1|g" {
+		t.Errorf("Unexpected third packet %q", packet)
+	}
+}
+
+// recordingExporter keeps the points it's given
+type recordingExporter struct {
+	points []Point
+}
+
+func (e *recordingExporter) Name() string { return "recording" }
+
+func (e *recordingExporter) Export(ctx context.Context, points []Point) error {
+	e.points = append(e.points, points...)
+	return nil
+}
+
+func TestPusherAddsTags(t *testing.T) {
+	recorder := &recordingExporter{}
+	collect := func() []Point {
+		return []Point{{Measurement: "m", Tags: map[string]string{"vin": "A", "host": "car"}, Fields: map[string]float64{"v": 1}}}
+	}
+
+	pusher := NewPusher(time.Second, map[string]string{"host": "pi", "site": "home"}, collect, []Exporter{recorder}, log.New(io.Discard, "", 0))
+	pusher.Push(context.Background())
+
+	if len(recorder.points) != 1 {
+		t.Fatalf("Expected 1 point, got %d", len(recorder.points))
+	}
+	point := recorder.points[0]
+	if point.Tags["vin"] != "A" || point.Tags["host"] != "car" || point.Tags["site"] != "home" {
+		t.Errorf("Expected global tags without overriding point tags, got %v", point.Tags)
+	}
+	if point.Time.IsZero() {
+		t.Error("Expected point time to be set")
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	valid := []interface{ Validate() error }{
+		InfluxDBConfig{},
+		InfluxDBConfig{URL: "https://influx.local", Database: "tesla"},
+		StatsdConfig{},
+		StatsdConfig{Address: "localhost:8125", TagStyle: TagStyleInflux},
+	}
+	for _, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", config, err)
+		}
+	}
+
+	invalid := []interface{ Validate() error }{
+		InfluxDBConfig{URL: "influx.local:8086", Database: "tesla"},
+		InfluxDBConfig{URL: "http://influx.local"},
+		StatsdConfig{Address: "localhost"},
+		StatsdConfig{Address: "localhost:8125", TagStyle: "graphite"},
+	}
+	for _, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%+v: expected validation error", config)
+		}
+	}
+}
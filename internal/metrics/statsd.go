@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tag styles supported by the statsd exporter
+const (
+	TagStyleDogStatsd = "dogstatsd" // name:1|g|#tag:value
+	TagStyleInflux    = "influx"    // name,tag=value:1|g (Telegraf's statsd input)
+	TagStyleNone      = "none"      // name:1|g
+)
+
+// maxDatagramSize keeps statsd packets under a typical network MTU
+const maxDatagramSize = 1400
+
+// StatsdConfig configures the statsd exporter
+type StatsdConfig struct {
+	Address  string `json:"address"`             // host:port of the statsd server (disabled if empty)
+	Prefix   string `json:"prefix,omitempty"`    // Prepended to every metric name
+	TagStyle string `json:"tag_style,omitempty"` // dogstatsd (default), influx or none
+}
+
+// Enabled reports whether the exporter is configured
+func (c StatsdConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// Validate checks the configuration
+func (c StatsdConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("address must be host:port: %w", err)
+	}
+	switch c.TagStyle {
+	case "", TagStyleDogStatsd, TagStyleInflux, TagStyleNone:
+		return nil
+	default:
+		return fmt.Errorf("tag_style must be one of: dogstatsd, influx, none")
+	}
+}
+
+// StatsdExporter sends points over UDP. Gauge fields are sent as gauges;
+// counter fields are sent as counters carrying the change since the last
+// export.
+type StatsdExporter struct {
+	config StatsdConfig
+
+	mu       sync.Mutex
+	conn     net.Conn
+	counters map[string]float64
+}
+
+// NewStatsdExporter creates an exporter for the given configuration
+func NewStatsdExporter(config StatsdConfig) (*StatsdExporter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid statsd config: %w", err)
+	}
+	if config.TagStyle == "" {
+		config.TagStyle = TagStyleDogStatsd
+	}
+	return &StatsdExporter{config: config, counters: make(map[string]float64)}, nil
+}
+
+// Name implements Exporter
+func (e *StatsdExporter) Name() string {
+	return "statsd"
+}
+
+// Export implements Exporter
+func (e *StatsdExporter) Export(ctx context.Context, points []Point) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "udp", e.config.Address)
+		if err != nil {
+			return fmt.Errorf("failed to dial statsd: %w", err)
+		}
+		e.conn = conn
+	}
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := e.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+
+	for _, point := range points {
+		for _, field := range sortedKeys(point.Fields) {
+			line, ok := e.format(point, field)
+			if !ok {
+				continue
+			}
+			if packet.Len() > 0 && packet.Len()+1+len(line) > maxDatagramSize {
+				if err := flush(); err != nil {
+					return fmt.Errorf("failed to send metrics: %w", err)
+				}
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	return nil
+}
+
+// format renders one field as a statsd line. ok is false for counters that
+// haven't changed since the last export and for non-finite values.
+func (e *StatsdExporter) format(point Point, field string) (string, bool) {
+	name := statsdEscaper.Replace(point.Measurement + "." + field)
+	if e.config.Prefix != "" {
+		name = statsdEscaper.Replace(e.config.Prefix) + "." + name
+	}
+
+	value := point.Fields[field]
+	if !isFinite(value) {
+		return "", false
+	}
+	kind := "g"
+	if point.Counter {
+		key := seriesKey(name, point.Tags)
+		delta := value - e.counters[key]
+		e.counters[key] = value
+		if delta <= 0 {
+			// Unchanged, or the counter was reset; send nothing this round
+			return "", false
+		}
+		value, kind = delta, "c"
+	}
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+
+	tags := sortedKeys(point.Tags)
+	var b strings.Builder
+	switch e.config.TagStyle {
+	case TagStyleInflux:
+		b.WriteString(name)
+		for _, key := range tags {
+			b.WriteString("," + statsdEscaper.Replace(key) + "=" + statsdEscaper.Replace(point.Tags[key]))
+		}
+		b.WriteString(":" + formatted + "|" + kind)
+	case TagStyleDogStatsd:
+		b.WriteString(name + ":" + formatted + "|" + kind)
+		for i, key := range tags {
+			if i == 0 {
+				b.WriteString("|#")
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(statsdEscaper.Replace(key) + ":" + statsdEscaper.Replace(point.Tags[key]))
+		}
+	default:
+		b.WriteString(name + ":" + formatted + "|" + kind)
+	}
+	return b.String(), true
+}
+
+// Close closes the exporter's socket
+func (e *StatsdExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// statsdEscaper replaces characters that are separators in statsd lines
+var statsdEscaper = strings.NewReplacer(":", "_", "|", "_", ",", "_", "=", "_", "#", "_", " ", "_", "\n", "_")
+
+// seriesKey identifies a metric and its tags
+func seriesKey(name string, tags map[string]string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, key := range sortedKeys(tags) {
+		b.WriteString("\x00" + key + "=" + tags[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,408 @@
+// Package mqtt implements the parts of MQTT 3.1.1 the server needs to talk
+// to a home automation broker: connecting with credentials and a last will,
+// publishing at QoS 0, subscribing at QoS 0 and keep-alive pings. Sessions
+// are always clean, so subscriptions are renewed on every connection.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKeepAlive is the keep-alive interval unless the config sets one
+const DefaultKeepAlive = 30 * time.Second
+
+// DefaultTopicPrefix is the first level of every topic unless the config
+// sets one
+const DefaultTopicPrefix = "tesla-hvac"
+
+// connectTimeout bounds the CONNECT/CONNACK exchange
+const connectTimeout = 10 * time.Second
+
+// ErrClosed is returned once the connection has been closed by either side
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Config selects a broker. MQTT is disabled without one.
+type Config struct {
+	Broker      string        `json:"broker,omitempty"` // tcp://host:1883 or tls://host:8883
+	ClientID    string        `json:"client_id,omitempty"`
+	Username    string        `json:"username,omitempty"`
+	Password    string        `json:"password,omitempty"`
+	TopicPrefix string        `json:"topic_prefix,omitempty"` // Defaults to tesla-hvac
+	KeepAlive   time.Duration `json:"keep_alive,omitempty"`   // Defaults to 30 seconds
+}
+
+// Enabled reports whether a broker is configured
+func (c Config) Enabled() bool {
+	return c.Broker != ""
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if _, _, err := brokerAddress(c.Broker); err != nil {
+		return err
+	}
+	if strings.ContainsAny(c.TopicPrefix, "#+") {
+		return fmt.Errorf("topic_prefix must not contain wildcards")
+	}
+	if c.KeepAlive < 0 || c.KeepAlive > 18*time.Hour {
+		return fmt.Errorf("keep_alive must be between 0 and 18h")
+	}
+	if c.Password != "" && c.Username == "" {
+		return fmt.Errorf("password requires username")
+	}
+	return nil
+}
+
+// Prefix returns the topic prefix
+func (c Config) Prefix() string {
+	if c.TopicPrefix == "" {
+		return DefaultTopicPrefix
+	}
+	return strings.TrimSuffix(c.TopicPrefix, "/")
+}
+
+// brokerAddress splits a broker URL into a dial address and whether it
+// uses TLS
+func brokerAddress(broker string) (string, bool, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("broker must be a URL such as tcp://host:1883")
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), "1883"), false, nil
+		}
+		return u.Host, false, nil
+	case "tls", "ssl", "mqtts":
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), "8883"), true, nil
+		}
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("broker scheme must be tcp or tls")
+	}
+}
+
+// Message is a message received on a subscription
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// Will is published by the broker if the connection drops without a
+// DISCONNECT
+type Will struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Client is a connection to a broker. Messages on subscribed topics are
+// passed to the handler given to Dial, one at a time, from the goroutine
+// reading the connection.
+type Client struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	keepAlive time.Duration
+	handler   func(Message)
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan error
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Dial connects to the broker in config, announcing will if it isn't nil
+func Dial(ctx context.Context, config Config, will *Will, handler func(Message)) (*Client, error) {
+	address, useTLS, err := brokerAddress(config.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	var conn net.Conn
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: failed to connect to %s: %w", address, err)
+	}
+
+	c, err := newClient(conn, config, will, handler)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient runs the CONNECT handshake on conn and starts reading
+func newClient(conn net.Conn, config Config, will *Will, handler func(Message)) (*Client, error) {
+	keepAlive := config.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	c := &Client{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		keepAlive: keepAlive,
+		handler:   handler,
+		pending:   make(map[uint16]chan error),
+		done:      make(chan struct{}),
+	}
+
+	conn.SetDeadline(time.Now().Add(connectTimeout))
+	if _, err := conn.Write(connectPacket(config, will, keepAlive).encode()); err != nil {
+		return nil, fmt.Errorf("mqtt: failed to connect: %w", err)
+	}
+	ack, err := readPacket(c.reader)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: failed to connect: %w", err)
+	}
+	if ack.kind != packetConnAck || len(ack.body) != 2 {
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", ack.kind)
+	}
+	if code := ack.body[1]; code != 0 {
+		return nil, fmt.Errorf("mqtt: broker refused connection: %s", connectError(code))
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+// connectPacket encodes a CONNECT with a clean session
+func connectPacket(config Config, will *Will, keepAlive time.Duration) packet {
+	flags := byte(0x02)
+	if will != nil {
+		flags |= 0x04
+		if will.Retain {
+			flags |= 0x20
+		}
+	}
+	if config.Username != "" {
+		flags |= 0x80
+	}
+	// A password is only allowed with a username
+	if config.Username != "" && config.Password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	body = appendString(body, config.ClientID)
+	if will != nil {
+		body = appendString(body, will.Topic)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(will.Payload)))
+		body = append(body, will.Payload...)
+	}
+	if config.Username != "" {
+		body = appendString(body, config.Username)
+	}
+	if flags&0x40 != 0 {
+		body = appendString(body, config.Password)
+	}
+	return packet{kind: packetConnect, body: body}
+}
+
+// connectError describes a CONNACK return code
+func connectError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	default:
+		return fmt.Sprintf("return code %d", code)
+	}
+}
+
+// Publish sends a message at QoS 0
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	return c.write(publishPacket(topic, payload, retain))
+}
+
+// Subscribe subscribes to topic filters at QoS 0 and waits for the broker
+// to acknowledge them
+func (c *Client) Subscribe(ctx context.Context, filters ...string) error {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	acked := make(chan error, 1)
+	c.pending[id] = acked
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, filter := range filters {
+		body = appendString(body, filter)
+		body = append(body, 0)
+	}
+	if err := c.write(packet{kind: packetSubscribe, flags: 0x02, body: body}); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-acked:
+		return err
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	c.write(packet{kind: packetDisconnect})
+	c.fail(ErrClosed)
+	return nil
+}
+
+// Done is closed when the connection ends
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, or nil while it is open
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// write sends a packet
+func (c *Client) write(p packet) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	if _, err := c.conn.Write(p.encode()); err != nil {
+		c.fail(fmt.Errorf("mqtt: write failed: %w", err))
+		return c.err
+	}
+	return nil
+}
+
+// fail ends the connection with err
+func (c *Client) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// readLoop handles incoming packets until the connection ends. The broker
+// must send something, if only a PINGRESP, within one and a half keep-alive
+// intervals.
+func (c *Client) readLoop() {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := readPacket(c.reader)
+		if err != nil {
+			c.fail(fmt.Errorf("mqtt: read failed: %w", err))
+			return
+		}
+
+		switch p.kind {
+		case packetPublish:
+			message, id, err := decodePublish(p)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			if (p.flags>>1)&0x03 == 1 {
+				c.write(packet{kind: packetPubAck, body: binary.BigEndian.AppendUint16(nil, id)})
+			}
+			if c.handler != nil {
+				c.handler(message)
+			}
+		case packetSubAck:
+			c.subscribed(p)
+		}
+	}
+}
+
+// subscribed completes the Subscribe call a SUBACK answers
+func (c *Client) subscribed(p packet) {
+	if len(p.body) < 2 {
+		return
+	}
+	id := binary.BigEndian.Uint16(p.body)
+
+	var err error
+	for _, code := range p.body[2:] {
+		if code == 0x80 {
+			err = fmt.Errorf("mqtt: broker refused subscription")
+		}
+	}
+
+	c.mu.Lock()
+	acked, ok := c.pending[id]
+	c.mu.Unlock()
+	if ok {
+		acked <- err
+	}
+}
+
+// pingLoop sends a PINGREQ every keep-alive interval
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packet{kind: packetPingReq})
+		}
+	}
+}
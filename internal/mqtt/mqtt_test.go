@@ -0,0 +1,173 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"disabled", Config{}, true},
+		{"tcp", Config{Broker: "tcp://broker.local:1883"}, true},
+		{"tls without port", Config{Broker: "tls://broker.local", Username: "hvac", Password: "secret"}, true},
+		{"bad scheme", Config{Broker: "http://broker.local"}, false},
+		{"no host", Config{Broker: "broker.local:1883"}, false},
+		{"wildcard prefix", Config{Broker: "tcp://broker.local", TopicPrefix: "cars/#"}, false},
+		{"password without username", Config{Broker: "tcp://broker.local", Password: "secret"}, false},
+		{"negative keep-alive", Config{Broker: "tcp://broker.local", KeepAlive: -time.Second}, false},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	if prefix := (Config{TopicPrefix: "home/car/"}).Prefix(); prefix != "home/car" {
+		t.Errorf("Expected the trailing slash to be dropped, got %q", prefix)
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 300) // Needs a two-byte remaining length
+	encoded := publishPacket("tesla-hvac/VIN/state", payload, true).encode()
+
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(encoded)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, _, err := decodePublish(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Topic != "tesla-hvac/VIN/state" || !bytes.Equal(message.Payload, payload) || !message.Retained {
+		t.Errorf("Unexpected message %q retained=%v", message.Topic, message.Retained)
+	}
+
+	if _, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff}))); err == nil {
+		t.Error("Expected an error for a five-byte remaining length")
+	}
+}
+
+// fakeBroker answers a client's CONNECT on the other end of a pipe
+type fakeBroker struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (b *fakeBroker) read() packet {
+	b.t.Helper()
+	b.conn.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := readPacket(b.reader)
+	if err != nil {
+		b.t.Fatalf("Broker read failed: %v", err)
+	}
+	return p
+}
+
+func (b *fakeBroker) write(p packet) {
+	b.conn.Write(p.encode())
+}
+
+// dialFake connects a client to a fake broker, which answers CONNECT with
+// code and passes the CONNECT to check
+func dialFake(t *testing.T, config Config, will *Will, code byte, handler func(Message), check func(packet)) (*Client, *fakeBroker, error) {
+	t.Helper()
+	clientConn, brokerConn := net.Pipe()
+	broker := &fakeBroker{t: t, conn: brokerConn, reader: bufio.NewReader(brokerConn)}
+	t.Cleanup(func() { brokerConn.Close() })
+
+	go func() {
+		p, err := readPacket(broker.reader)
+		if err != nil {
+			return
+		}
+		check(p)
+		broker.write(packet{kind: packetConnAck, body: []byte{0, code}})
+	}()
+
+	client, err := newClient(clientConn, config, will, handler)
+	return client, broker, err
+}
+
+func TestClientSession(t *testing.T) {
+	received := make(chan Message, 1)
+	var connect packet
+	client, broker, err := dialFake(t,
+		Config{ClientID: "hvac", Username: "user", Password: "pass", KeepAlive: time.Minute},
+		&Will{Topic: "tesla-hvac/status", Payload: []byte("offline"), Retain: true},
+		0,
+		func(m Message) { received <- m },
+		func(p packet) { connect = p })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if connect.kind != packetConnect || connect.body[7] != 0xe6 || binary.BigEndian.Uint16(connect.body[8:]) != 60 {
+		t.Errorf("Unexpected CONNECT flags %#x", connect.body[7])
+	}
+	if !bytes.Contains(connect.body, []byte("tesla-hvac/status")) || !bytes.HasSuffix(connect.body, []byte("\x00\x04pass")) {
+		t.Errorf("Expected the will and credentials in CONNECT, got %q", connect.body)
+	}
+
+	// Subscribe waits for the SUBACK
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- client.Subscribe(context.Background(), "tesla-hvac/+/set/+") }()
+	sub := broker.read()
+	if sub.kind != packetSubscribe || sub.flags != 0x02 {
+		t.Fatalf("Expected SUBSCRIBE, got type %d flags %d", sub.kind, sub.flags)
+	}
+	broker.write(packet{kind: packetSubAck, body: append(sub.body[:2:2], 0)})
+	if err := <-subscribed; err != nil {
+		t.Errorf("Unexpected subscribe error: %v", err)
+	}
+
+	// A QoS 1 message is delivered and acknowledged
+	body := appendString(nil, "tesla-hvac/VIN/set/climate")
+	body = append(body, 0, 7)
+	broker.write(packet{kind: packetPublish, flags: 0x02, body: append(body, "on"...)})
+	if ack := broker.read(); ack.kind != packetPubAck || binary.BigEndian.Uint16(ack.body) != 7 {
+		t.Errorf("Expected PUBACK 7, got type %d", ack.kind)
+	}
+	if m := <-received; m.Topic != "tesla-hvac/VIN/set/climate" || string(m.Payload) != "on" {
+		t.Errorf("Unexpected message %+v", m)
+	}
+
+	go client.Publish("tesla-hvac/status", []byte("online"), true)
+	if p := broker.read(); p.kind != packetPublish || p.flags != 0x01 {
+		t.Errorf("Expected a retained PUBLISH, got type %d flags %d", p.kind, p.flags)
+	}
+
+	// Losing the connection ends the client
+	broker.conn.Close()
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected the client to notice the closed connection")
+	}
+	if err := client.Publish("tesla-hvac/status", nil, false); err == nil {
+		t.Error("Expected publishing on a closed connection to fail")
+	}
+}
+
+func TestClientRefused(t *testing.T) {
+	_, _, err := dialFake(t, Config{ClientID: "hvac"}, nil, 4, nil, func(packet) {})
+	if err == nil || !strings.Contains(err.Error(), "bad username or password") {
+		t.Errorf("Expected the refusal reason, got %v", err)
+	}
+}
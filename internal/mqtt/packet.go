@@ -0,0 +1,138 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetSubscribe  = 8
+	packetSubAck     = 9
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// maxRemainingBytes is the longest encoding of a remaining length
+const maxRemainingBytes = 4
+
+// maxPacketSize bounds incoming packets
+const maxPacketSize = 256 << 10
+
+// errMalformed is returned for packets that can't be decoded
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// packet is a decoded control packet: its type, the flags in the low bits of
+// the first byte, and everything after the remaining length
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads one control packet
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == maxRemainingBytes {
+			return packet{}, errMalformed
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf("mqtt: packet of %d bytes is too large", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+// encode returns the packet with its fixed header
+func (p packet) encode() []byte {
+	header := []byte{p.kind<<4 | p.flags}
+	length := len(p.body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		header = append(header, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(header, p.body...)
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string from the front of b and returns
+// the rest
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformed
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errMalformed
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// publishPacket encodes a QoS 0 PUBLISH
+func publishPacket(topic string, payload []byte, retain bool) packet {
+	var flags byte
+	if retain {
+		flags = 0x01
+	}
+	body := appendString(nil, topic)
+	return packet{kind: packetPublish, flags: flags, body: append(body, payload...)}
+}
+
+// decodePublish returns a PUBLISH packet's message and, for QoS 1, the
+// packet ID to acknowledge
+func decodePublish(p packet) (Message, uint16, error) {
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	var id uint16
+	qos := (p.flags >> 1) & 0x03
+	if qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errMalformed
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest, Retained: p.flags&0x01 != 0}, id, nil
+}
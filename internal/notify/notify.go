@@ -0,0 +1,159 @@
+// Package notify sends short messages to people through email, Pushover or a
+// Telegram bot. Each configured backend receives every message.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Alerts
+const (
+	AlertCabinTemp      = "cabin_temperature"    // The cabin rose above cabin_temp_max
+	AlertDogModeClimate = "dog_mode_climate_off" // Climate turned off while a keeper mode was on
+	AlertDogModeTemp    = "dog_mode_temperature" // The cabin left the keeper's range
+	AlertDogModeBattery = "dog_mode_battery"     // The battery ran low while a keeper mode was on
+	AlertCircuitOpen    = "circuit_open"         // A vehicle's circuit breaker opened, or closed again
+)
+
+// DefaultCabinTempMax is the cabin temperature alert threshold, in Celsius,
+// unless the config sets one
+const DefaultCabinTempMax = 45
+
+// defaultRequestTimeout bounds each delivery
+const defaultRequestTimeout = 15 * time.Second
+
+// alerts lists the valid alert names
+var alerts = []string{AlertCabinTemp, AlertDogModeClimate, AlertDogModeTemp, AlertDogModeBattery, AlertCircuitOpen}
+
+// Priority sets how insistently a backend presents a message
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh            // Alerts that may need someone to act
+)
+
+// Message is a notification
+type Message struct {
+	Title    string
+	Body     string
+	Priority Priority
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Config selects the backends. Notifications are disabled without any.
+type Config struct {
+	SMTP     *SMTPConfig     `json:"smtp,omitempty"`
+	Pushover *PushoverConfig `json:"pushover,omitempty"`
+	Telegram *TelegramConfig `json:"telegram,omitempty"`
+	Alerts   AlertsConfig    `json:"alerts"`
+}
+
+// AlertsConfig tunes the alerts sent about the vehicles
+type AlertsConfig struct {
+	CabinTempMax float32  `json:"cabin_temp_max,omitempty"` // Celsius; defaults to 45
+	Disabled     []string `json:"disabled,omitempty"`       // Alerts not to send
+}
+
+// Enabled reports whether any backend is configured
+func (c Config) Enabled() bool {
+	return c.SMTP != nil || c.Pushover != nil || c.Telegram != nil
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if c.SMTP != nil {
+		if err := c.SMTP.Validate(); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+	if c.Pushover != nil {
+		if err := c.Pushover.Validate(); err != nil {
+			return fmt.Errorf("pushover: %w", err)
+		}
+	}
+	if c.Telegram != nil {
+		if err := c.Telegram.Validate(); err != nil {
+			return fmt.Errorf("telegram: %w", err)
+		}
+	}
+	if c.Alerts.CabinTempMax < 0 || c.Alerts.CabinTempMax > 100 {
+		return fmt.Errorf("alerts: cabin_temp_max must be between 0 and 100")
+	}
+	for _, name := range c.Alerts.Disabled {
+		if !validAlert(name) {
+			return fmt.Errorf("alerts: unknown alert %q", name)
+		}
+	}
+	return nil
+}
+
+func validAlert(name string) bool {
+	for _, alert := range alerts {
+		if alert == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertEnabled reports whether the named alert should be sent
+func (c AlertsConfig) AlertEnabled(name string) bool {
+	for _, disabled := range c.Disabled {
+		if disabled == name {
+			return false
+		}
+	}
+	return true
+}
+
+// CabinTemp returns the cabin temperature that raises an alert
+func (c AlertsConfig) CabinTemp() float32 {
+	if c.CabinTempMax == 0 {
+		return DefaultCabinTempMax
+	}
+	return c.CabinTempMax
+}
+
+// New returns a notifier that sends to each configured backend, or nil if
+// there are none
+func New(config Config) Notifier {
+	client := &http.Client{Timeout: defaultRequestTimeout}
+	var notifiers Multi
+	if config.SMTP != nil {
+		notifiers = append(notifiers, NewSMTP(*config.SMTP))
+	}
+	if config.Pushover != nil {
+		notifiers = append(notifiers, NewPushover(*config.Pushover, client))
+	}
+	if config.Telegram != nil {
+		notifiers = append(notifiers, NewTelegram(*config.Telegram, client))
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	return notifiers
+}
+
+// Multi sends each message to several notifiers
+type Multi []Notifier
+
+// Notify implements Notifier. It tries every notifier and returns their
+// errors joined.
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
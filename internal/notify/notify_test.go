@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"pushover", Config{Pushover: &PushoverConfig{Token: "t", User: "u"}}, false},
+		{"pushover without user", Config{Pushover: &PushoverConfig{Token: "t"}}, true},
+		{"telegram without chat", Config{Telegram: &TelegramConfig{BotToken: "t"}}, true},
+		{"smtp", Config{SMTP: &SMTPConfig{Host: "mail.example.com", From: "hvac@example.com", To: []string{"me@example.com"}}}, false},
+		{"smtp bad from", Config{SMTP: &SMTPConfig{Host: "mail.example.com", From: "nobody", To: []string{"me@example.com"}}}, true},
+		{"smtp without to", Config{SMTP: &SMTPConfig{Host: "mail.example.com", From: "hvac@example.com"}}, true},
+		{"unknown alert", Config{Alerts: AlertsConfig{Disabled: []string{"bogus"}}}, true},
+		{"cabin temp", Config{Alerts: AlertsConfig{CabinTempMax: -1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAlertsConfig(t *testing.T) {
+	alerts := AlertsConfig{Disabled: []string{AlertCabinTemp}}
+	if alerts.AlertEnabled(AlertCabinTemp) || !alerts.AlertEnabled(AlertDogModeClimate) {
+		t.Error("AlertEnabled ignores disabled")
+	}
+	if alerts.CabinTemp() != DefaultCabinTempMax {
+		t.Errorf("CabinTemp() = %v, want the default", alerts.CabinTemp())
+	}
+}
+
+func TestNew(t *testing.T) {
+	if New(Config{}) != nil {
+		t.Error("New without backends should return nil")
+	}
+	n := New(Config{Pushover: &PushoverConfig{Token: "t", User: "u"}, Telegram: &TelegramConfig{BotToken: "b", ChatID: "c"}})
+	if multi, ok := n.(Multi); !ok || len(multi) != 2 {
+		t.Errorf("New() = %#v, want two notifiers", n)
+	}
+}
+
+func TestPushover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("token") != "app" || r.Form.Get("user") != "me" || r.Form.Get("title") != "Hot" || r.Form.Get("priority") != "1" {
+			t.Errorf("form = %v", r.Form)
+		}
+		w.Write([]byte(`{"status":1}`))
+	}))
+	defer server.Close()
+
+	p := NewPushover(PushoverConfig{Token: "app", User: "me"}, server.Client())
+	p.url = server.URL
+	if err := p.Notify(context.Background(), Message{Title: "Hot", Body: "46°C", Priority: PriorityHigh}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/botsecret/sendMessage" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["chat_id"] != "42" || body["text"] != "Hot\n46°C" || body["disable_notification"] != true {
+			t.Errorf("body = %v", body)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false}`))
+	}))
+	defer server.Close()
+
+	tg := NewTelegram(TelegramConfig{BotToken: "secret", ChatID: "42"}, server.Client())
+	tg.url = server.URL
+	err := tg.Notify(context.Background(), Message{Title: "Hot", Body: "46°C"})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Notify() error = %v, want the 400", err)
+	}
+
+	tg.url = "http://127.0.0.1:0"
+	if err := tg.Notify(context.Background(), Message{Body: "x"}); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Notify() error = %v, want an error without the token", err)
+	}
+}
+
+func TestSMTPMessage(t *testing.T) {
+	s := NewSMTP(SMTPConfig{Host: "mail.example.com", From: "hvac@example.com", To: []string{"a@example.com", "b@example.com"}})
+	msg := string(s.message(Message{Title: "Cabin 46°C", Body: "line one\nline two", Priority: PriorityHigh}))
+	for _, want := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Cabin_46=C2=B0C?=\r\n",
+		"X-Priority: 1\r\n",
+		"\r\n\r\nline one\r\nline two\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+type fakeNotifier struct {
+	err  error
+	sent []Message
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, msg Message) error {
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+func TestMulti(t *testing.T) {
+	failing := &fakeNotifier{err: errors.New("down")}
+	working := &fakeNotifier{}
+	err := Multi{failing, working}.Notify(context.Background(), Message{Body: "x"})
+	if err == nil || len(working.sent) != 1 {
+		t.Errorf("Notify() error = %v, sent %d; want the error and delivery to the rest", err, len(working.sent))
+	}
+}
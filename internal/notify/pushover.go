@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pushoverURL is the Pushover message API
+const pushoverURL = "https://api.pushover.net/1/messages.json"
+
+// PushoverConfig sends push notifications through Pushover
+type PushoverConfig struct {
+	Token  string `json:"token"`            // The application's API token
+	User   string `json:"user"`             // The user or group key
+	Device string `json:"device,omitempty"` // All the user's devices if empty
+}
+
+// Validate checks the config
+func (c PushoverConfig) Validate() error {
+	if c.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if c.User == "" {
+		return fmt.Errorf("user is required")
+	}
+	return nil
+}
+
+// Pushover sends messages as push notifications
+type Pushover struct {
+	config PushoverConfig
+	client *http.Client
+	url    string
+}
+
+// NewPushover creates a Pushover notifier
+func NewPushover(config PushoverConfig, client *http.Client) *Pushover {
+	return &Pushover{config: config, client: client, url: pushoverURL}
+}
+
+// Notify implements Notifier. High priority messages bypass the user's
+// quiet hours.
+func (p *Pushover) Notify(ctx context.Context, msg Message) error {
+	form := url.Values{
+		"token":    {p.config.Token},
+		"user":     {p.config.User},
+		"title":    {msg.Title},
+		"message":  {msg.Body},
+		"priority": {strconv.Itoa(int(msg.Priority))},
+	}
+	if p.config.Device != "" {
+		form.Set("device", p.config.Device)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("pushover: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return do(p.client, req, "pushover")
+}
+
+// do sends req and turns a non-2xx response into an error
+func do(client *http.Client, req *http.Request, backend string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", backend, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s: %s", backend, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// telegramURL is the Telegram Bot API
+const telegramURL = "https://api.telegram.org"
+
+// TelegramConfig sends messages from a Telegram bot to a chat
+type TelegramConfig struct {
+	BotToken string `json:"bot_token"` // From @BotFather
+	ChatID   string `json:"chat_id"`   // A user, group or @channel
+}
+
+// Validate checks the config
+func (c TelegramConfig) Validate() error {
+	if c.BotToken == "" {
+		return fmt.Errorf("bot_token is required")
+	}
+	if c.ChatID == "" {
+		return fmt.Errorf("chat_id is required")
+	}
+	return nil
+}
+
+// Telegram sends messages as a bot
+type Telegram struct {
+	config TelegramConfig
+	client *http.Client
+	url    string
+}
+
+// NewTelegram creates a Telegram notifier
+func NewTelegram(config TelegramConfig, client *http.Client) *Telegram {
+	return &Telegram{config: config, client: client, url: telegramURL}
+}
+
+// Notify implements Notifier. Normal priority messages arrive silently.
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	text := msg.Body
+	if msg.Title != "" {
+		text = msg.Title + "\n" + msg.Body
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":              t.config.ChatID,
+		"text":                 text,
+		"disable_notification": msg.Priority < PriorityHigh,
+	})
+	if err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url+"/bot"+t.config.BotToken+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := do(t.client, req, "telegram"); err != nil {
+		// The token is part of the URL, which network errors quote
+		return errors.New(strings.ReplaceAll(err.Error(), t.config.BotToken, "<bot_token>"))
+	}
+	return nil
+}
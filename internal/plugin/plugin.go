@@ -0,0 +1,400 @@
+// Package plugin runs out-of-process plugins that extend the HVAC server.
+//
+// A plugin is an executable that speaks JSON-RPC 2.0 over its standard input
+// and output, one message per line. Standard error is forwarded to the host's
+// log. Either side may send requests: the host calls the plugin to initialize
+// it, deliver events and serve HTTP routes, and the plugin may call back into
+// the host (for example to read vehicle state).
+//
+// The host sends, in order:
+//
+//	initialize   -> Manifest          (once, at startup)
+//	event        (notification)       for each subscribed event
+//	http.request -> HTTPResponse      for each request to a declared route
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// ProtocolVersion is sent to plugins in the initialize call
+	ProtocolVersion = 1
+
+	// maxMessageSize bounds a single JSON-RPC message
+	maxMessageSize = 4 << 20
+
+	// initializeTimeout bounds how long a plugin may take to initialize
+	initializeTimeout = 10 * time.Second
+
+	// closeTimeout is how long a plugin has to exit after its input is closed
+	closeTimeout = 5 * time.Second
+)
+
+var (
+	ErrPluginExited = errors.New("plugin exited")
+	ErrInvalidName  = errors.New("plugin name must be lowercase letters, digits, '-' or '_'")
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Manifest describes a plugin. It is returned from the initialize call.
+type Manifest struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// Routes the plugin serves under /plugins/<name>/
+	Routes []Route `json:"routes,omitempty"`
+	// Events the plugin wants to receive, e.g. "state_changed"
+	Events []string `json:"events,omitempty"`
+}
+
+// Route is an HTTP route served by a plugin
+type Route struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// InitializeParams is sent to the plugin in the initialize call
+type InitializeParams struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	Vehicles        []string `json:"vehicles"`
+}
+
+// HTTPRequest is sent to the plugin in an http.request call
+type HTTPRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   map[string]string `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// HTTPResponse is returned by the plugin from an http.request call. The host
+// wraps Data (or Error) in its standard response envelope.
+type HTTPResponse struct {
+	Status int             `json:"status"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  *HTTPError      `json:"error,omitempty"`
+}
+
+// HTTPError is an error returned by a plugin route
+type HTTPError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// HandlerFunc handles a call from the plugin to the host. For notifications
+// the result is discarded.
+type HandlerFunc func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// RPCError is a JSON-RPC error
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+// JSON-RPC error codes
+const (
+	codeMethodNotFound = -32601
+	codeInternalError  = -32603
+)
+
+// message is a JSON-RPC request, notification or response
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// Plugin is a running plugin process
+type Plugin struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	handler  HandlerFunc
+	logger   *log.Logger
+	manifest Manifest
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message
+
+	stderrDone chan struct{}
+	done       chan struct{}
+	exitErr    error
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// Start starts the plugin process and initializes it. Calls from the plugin
+// are dispatched to handler, which may be nil.
+func Start(ctx context.Context, cmd *exec.Cmd, vehicles []string, handler HandlerFunc, logger *log.Logger) (*Plugin, error) {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin stderr: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", cmd.Path, err)
+	}
+
+	pctx, cancel := context.WithCancel(ctx)
+	p := &Plugin{
+		cmd:        cmd,
+		stdin:      stdin,
+		handler:    handler,
+		logger:     logger,
+		pending:    make(map[int64]chan message),
+		stderrDone: make(chan struct{}),
+		done:       make(chan struct{}),
+		ctx:        pctx,
+		cancel:     cancel,
+	}
+
+	go p.forwardStderr(stderr)
+	go p.readLoop(stdout)
+
+	initCtx, initCancel := context.WithTimeout(ctx, initializeTimeout)
+	defer initCancel()
+
+	params := InitializeParams{ProtocolVersion: ProtocolVersion, Vehicles: vehicles}
+	if err := p.Call(initCtx, "initialize", params, &p.manifest); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to initialize plugin %s: %w", cmd.Path, err)
+	}
+
+	if !validName.MatchString(p.manifest.Name) {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: %w", cmd.Path, ErrInvalidName)
+	}
+
+	return p, nil
+}
+
+// Manifest returns the plugin's manifest
+func (p *Plugin) Manifest() Manifest {
+	return p.manifest
+}
+
+// Done returns a channel that is closed when the plugin process exits
+func (p *Plugin) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the reason the plugin exited, once Done is closed
+func (p *Plugin) Err() error {
+	<-p.done
+	return p.exitErr
+}
+
+// Call sends a request to the plugin and decodes its result into result,
+// which may be nil
+func (p *Plugin) Call(ctx context.Context, method string, params, result interface{}) error {
+	p.mu.Lock()
+	id := p.nextID
+	p.nextID++
+	ch := make(chan message, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(message{ID: &id, Method: method}, params); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("invalid result for %s: %w", method, err)
+			}
+		}
+		return nil
+	case <-p.done:
+		return ErrPluginExited
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification to the plugin
+func (p *Plugin) Notify(method string, params interface{}) error {
+	return p.send(message{Method: method}, params)
+}
+
+// Close asks the plugin to exit by closing its input, killing it if it
+// doesn't exit in time
+func (p *Plugin) Close() error {
+	p.stdin.Close()
+
+	select {
+	case <-p.done:
+	case <-time.After(closeTimeout):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	return nil
+}
+
+// send writes a message to the plugin
+func (p *Plugin) send(msg message, params interface{}) error {
+	msg.JSONRPC = "2.0"
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode params: %w", err)
+		}
+		msg.Params = encoded
+	}
+	return p.write(msg)
+}
+
+// write serializes a message onto the plugin's input
+func (p *Plugin) write(msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	select {
+	case <-p.done:
+		return ErrPluginExited
+	default:
+	}
+
+	if _, err := p.stdin.Write(data); err != nil {
+		return fmt.Errorf("%w: %v", ErrPluginExited, err)
+	}
+	return nil
+}
+
+// readLoop dispatches messages from the plugin until it exits
+func (p *Plugin) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageSize)
+
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			p.logger.Printf("Plugin %s sent invalid message: %v", p.cmd.Path, err)
+			continue
+		}
+
+		if msg.Method != "" {
+			go p.handleCall(msg)
+			continue
+		}
+
+		if msg.ID == nil {
+			continue
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[*msg.ID]
+		p.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+
+	// Wait must not be called until all output has been read
+	<-p.stderrDone
+	err := p.cmd.Wait()
+	if err == nil {
+		err = ErrPluginExited
+	}
+	p.exitErr = err
+	p.cancel()
+	close(p.done)
+}
+
+// handleCall runs a request or notification from the plugin
+func (p *Plugin) handleCall(msg message) {
+	var result interface{}
+	err := MethodNotFound(msg.Method)
+	if p.handler != nil {
+		result, err = p.handler(p.ctx, msg.Method, msg.Params)
+	}
+
+	if msg.ID == nil {
+		if err != nil {
+			p.logger.Printf("Plugin %s notification %s failed: %v", p.manifest.Name, msg.Method, err)
+		}
+		return
+	}
+
+	resp := message{JSONRPC: "2.0", ID: msg.ID}
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		encoded, encErr := json.Marshal(result)
+		if encErr != nil {
+			resp.Error = &RPCError{Code: codeInternalError, Message: encErr.Error()}
+		} else {
+			resp.Result = encoded
+		}
+	}
+
+	if err := p.write(resp); err != nil {
+		p.logger.Printf("Failed to reply to plugin %s: %v", p.manifest.Name, err)
+	}
+}
+
+// forwardStderr copies the plugin's standard error to the log
+func (p *Plugin) forwardStderr(stderr io.Reader) {
+	defer close(p.stderrDone)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		p.logger.Printf("[plugin %s] %s", p.cmd.Path, scanner.Text())
+	}
+}
+
+// MethodNotFound returns the JSON-RPC error for an unknown method
+func MethodNotFound(method string) error {
+	return &RPCError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
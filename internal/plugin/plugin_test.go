@@ -0,0 +1,135 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestHelperPlugin is not a real test: it is run as a subprocess by the other
+// tests to act as a plugin
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("TESLA_PLUGIN_HELPER") != "1" {
+		t.Skip("helper process")
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		switch msg.Method {
+		case "initialize":
+			out.Encode(message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(
+				`{"name": "echo", "routes": [{"method": "GET", "path": "/ping"}], "events": ["state_changed"]}`)})
+		case "http.request":
+			// Call back into the host before answering
+			id := int64(1000)
+			out.Encode(message{JSONRPC: "2.0", ID: &id, Method: "host.ping"})
+			var reply message
+			for scanner.Scan() {
+				json.Unmarshal(scanner.Bytes(), &reply)
+				if reply.ID != nil && *reply.ID == id {
+					break
+				}
+			}
+			data := fmt.Sprintf(`{"request": %s, "host": %s}`, msg.Params, reply.Result)
+			out.Encode(message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage(
+				fmt.Sprintf(`{"status": 200, "data": %s}`, data))})
+		case "event":
+			fmt.Fprintln(os.Stderr, "got event")
+		default:
+			if msg.ID != nil {
+				out.Encode(message{JSONRPC: "2.0", ID: msg.ID, Error: &RPCError{Code: codeMethodNotFound, Message: msg.Method}})
+			}
+		}
+	}
+	os.Exit(0)
+}
+
+func helperCommand() *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperPlugin$")
+	cmd.Env = append(os.Environ(), "TESLA_PLUGIN_HELPER=1")
+	return cmd
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
+	handler := func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		if method == "host.ping" {
+			return "pong", nil
+		}
+		return nil, MethodNotFound(method)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p, err := Start(ctx, helperCommand(), []string{"TEST_VIN"}, handler, logger)
+	if err != nil {
+		t.Fatalf("Failed to start plugin: %v", err)
+	}
+	defer p.Close()
+
+	manifest := p.Manifest()
+	if manifest.Name != "echo" || len(manifest.Routes) != 1 || manifest.Events[0] != "state_changed" {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	var resp HTTPResponse
+	if err := p.Call(ctx, "http.request", HTTPRequest{Method: "GET", Path: "/ping"}, &resp); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	var data struct {
+		Request HTTPRequest `json:"request"`
+		Host    string      `json:"host"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+	if resp.Status != 200 || data.Request.Path != "/ping" || data.Host != "pong" {
+		t.Errorf("Unexpected response: %d %+v", resp.Status, data)
+	}
+
+	var rpcErr *RPCError
+	if err := p.Call(ctx, "unknown", nil, nil); !errors.As(err, &rpcErr) || rpcErr.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found, got %v", err)
+	}
+
+	if err := p.Notify("event", map[string]string{"type": "state_changed"}); err != nil {
+		t.Errorf("Notify failed: %v", err)
+	}
+
+	p.Close()
+	select {
+	case <-p.Done():
+	default:
+		t.Error("Expected plugin to have exited after Close")
+	}
+	if err := p.Call(ctx, "http.request", nil, nil); !errors.Is(err, ErrPluginExited) {
+		t.Errorf("Expected ErrPluginExited after exit, got %v", err)
+	}
+}
+
+func TestPluginStartFailure(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := Start(ctx, exec.Command("/nonexistent/plugin"), nil, nil, nil); err == nil {
+		t.Error("Expected error for missing executable")
+	}
+
+	// A process that exits without initializing
+	if _, err := Start(ctx, exec.Command("true"), nil, nil, nil); err == nil {
+		t.Error("Expected error for plugin that exits immediately")
+	}
+}
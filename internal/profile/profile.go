@@ -0,0 +1,180 @@
+// Package profile stores server user accounts. Each user has a role that
+// decides what they may do, and a profile with their own preferences and
+// climate presets, so people sharing a vehicle keep their own defaults.
+package profile
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Role decides what a user may do
+type Role string
+
+const (
+	// RoleAdmin may control the vehicle and manage users and settings
+	RoleAdmin Role = "admin"
+	// RoleDriver may read state and control the vehicle
+	RoleDriver Role = "driver"
+	// RoleViewer may only read state
+	RoleViewer Role = "viewer"
+)
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleDriver, RoleViewer:
+		return true
+	}
+	return false
+}
+
+// CanControl reports whether the role may send vehicle commands
+func (r Role) CanControl() bool {
+	return r == RoleAdmin || r == RoleDriver
+}
+
+// IsAdmin reports whether the role may use the admin API
+func (r Role) IsAdmin() bool {
+	return r == RoleAdmin
+}
+
+// Unit is a temperature unit
+type Unit string
+
+const (
+	UnitFahrenheit Unit = "F"
+	UnitCelsius    Unit = "C"
+)
+
+// Temperature setpoint limits in Celsius
+const (
+	MinTemp = 15.0
+	MaxTemp = 28.0
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,31}$`)
+
+// Profile is a user's account details and preferences
+type Profile struct {
+	Username    string      `json:"username"`
+	DisplayName string      `json:"display_name,omitempty"`
+	Role        Role        `json:"role"`
+	Preferences Preferences `json:"preferences"`
+	Presets     []Preset    `json:"presets,omitempty"`
+}
+
+// Preferences are a user's defaults
+type Preferences struct {
+	TemperatureUnit Unit          `json:"temperature_unit,omitempty"` // Unit for API temperatures, Fahrenheit if empty
+	DriverTemp      float64       `json:"driver_temp,omitempty"`      // Preferred driver temperature in Celsius (0 for none)
+	PassengerTemp   float64       `json:"passenger_temp,omitempty"`   // Preferred passenger temperature in Celsius (0 for none)
+	Notifications   Notifications `json:"notifications"`
+}
+
+// Notifications selects the events a user wants to be told about
+type Notifications struct {
+	Enabled bool     `json:"enabled"`
+	Events  []string `json:"events,omitempty"` // Event types to notify about; all if empty
+}
+
+// Wants reports whether the user wants notifications of an event type
+func (n Notifications) Wants(eventType string) bool {
+	if !n.Enabled {
+		return false
+	}
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, event := range n.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Preset is a named set of climate settings. Temperatures are in Celsius.
+type Preset struct {
+	Name          string  `json:"name"`
+	DriverTemp    float64 `json:"driver_temp"`
+	PassengerTemp float64 `json:"passenger_temp,omitempty"` // Same as the driver if 0
+	ClimateOn     bool    `json:"climate_on,omitempty"`     // Turn climate on after setting the temperature
+}
+
+// Temps returns the preset's driver and passenger temperatures
+func (p Preset) Temps() (float64, float64) {
+	if p.PassengerTemp == 0 {
+		return p.DriverTemp, p.DriverTemp
+	}
+	return p.DriverTemp, p.PassengerTemp
+}
+
+// Unit returns the user's temperature unit
+func (p Preferences) Unit() Unit {
+	if p.TemperatureUnit == "" {
+		return UnitFahrenheit
+	}
+	return p.TemperatureUnit
+}
+
+// Validate checks the profile
+func (p *Profile) Validate() error {
+	if !usernamePattern.MatchString(p.Username) {
+		return fmt.Errorf("username %q must be 1-32 lowercase letters, digits, '.', '_' or '-'", p.Username)
+	}
+	if !p.Role.Valid() {
+		return fmt.Errorf("role %q must be admin, driver or viewer", p.Role)
+	}
+
+	prefs := p.Preferences
+	if prefs.TemperatureUnit != "" && prefs.TemperatureUnit != UnitFahrenheit && prefs.TemperatureUnit != UnitCelsius {
+		return fmt.Errorf("temperature_unit %q must be F or C", prefs.TemperatureUnit)
+	}
+	if err := validateTemp("driver_temp", prefs.DriverTemp, true); err != nil {
+		return err
+	}
+	if err := validateTemp("passenger_temp", prefs.PassengerTemp, true); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, preset := range p.Presets {
+		if preset.Name == "" {
+			return fmt.Errorf("preset name is required")
+		}
+		if names[preset.Name] {
+			return fmt.Errorf("duplicate preset %q", preset.Name)
+		}
+		names[preset.Name] = true
+		if err := validateTemp("preset "+preset.Name+" driver_temp", preset.DriverTemp, false); err != nil {
+			return err
+		}
+		if err := validateTemp("preset "+preset.Name+" passenger_temp", preset.PassengerTemp, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTemp checks a Celsius temperature is within the setpoint limits.
+// Zero means unset when optional.
+func validateTemp(name string, temp float64, optional bool) error {
+	if optional && temp == 0 {
+		return nil
+	}
+	if temp < MinTemp || temp > MaxTemp {
+		return fmt.Errorf("%s %.1f°C is outside %.0f-%.0f°C", name, temp, MinTemp, MaxTemp)
+	}
+	return nil
+}
+
+// FindPreset returns the preset with the given name
+func (p *Profile) FindPreset(name string) (Preset, bool) {
+	for _, preset := range p.Presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
@@ -0,0 +1,191 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s.iterations = 1000
+	return s
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		valid   bool
+	}{
+		{"minimal", Profile{Username: "alex", Role: RoleDriver}, true},
+		{"bad username", Profile{Username: "Alex Smith", Role: RoleDriver}, false},
+		{"bad role", Profile{Username: "alex", Role: "owner"}, false},
+		{"celsius", Profile{Username: "alex", Role: RoleViewer, Preferences: Preferences{TemperatureUnit: UnitCelsius}}, true},
+		{"bad unit", Profile{Username: "alex", Role: RoleViewer, Preferences: Preferences{TemperatureUnit: "K"}}, false},
+		{"preferred temp", Profile{Username: "alex", Role: RoleDriver, Preferences: Preferences{DriverTemp: 21}}, true},
+		{"temp out of range", Profile{Username: "alex", Role: RoleDriver, Preferences: Preferences{DriverTemp: 40}}, false},
+		{"preset", Profile{Username: "alex", Role: RoleDriver, Presets: []Preset{{Name: "warm", DriverTemp: 24}}}, true},
+		{"preset without temp", Profile{Username: "alex", Role: RoleDriver, Presets: []Preset{{Name: "warm"}}}, false},
+		{"duplicate preset", Profile{Username: "alex", Role: RoleDriver,
+			Presets: []Preset{{Name: "warm", DriverTemp: 24}, {Name: "warm", DriverTemp: 25}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Expected valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	if !RoleAdmin.CanControl() || !RoleAdmin.IsAdmin() {
+		t.Error("Expected admin to control and administer")
+	}
+	if !RoleDriver.CanControl() || RoleDriver.IsAdmin() {
+		t.Error("Expected driver to control only")
+	}
+	if RoleViewer.CanControl() || RoleViewer.IsAdmin() {
+		t.Error("Expected viewer to read only")
+	}
+}
+
+func TestNotificationsWants(t *testing.T) {
+	if (Notifications{}).Wants("climate_skipped") {
+		t.Error("Expected disabled notifications to want nothing")
+	}
+	if !(Notifications{Enabled: true}).Wants("climate_skipped") {
+		t.Error("Expected no event filter to want everything")
+	}
+	filtered := Notifications{Enabled: true, Events: []string{"connected"}}
+	if filtered.Wants("climate_skipped") || !filtered.Wants("connected") {
+		t.Error("Expected the event filter to apply")
+	}
+}
+
+func TestStoreAuthenticate(t *testing.T) {
+	s := testStore(t)
+	if !s.Empty() {
+		t.Fatal("Expected a new store to be empty")
+	}
+
+	if err := s.Put(Profile{Username: "alex", Role: RoleDriver}, ""); err == nil {
+		t.Error("Expected a new user without a password to be rejected")
+	}
+	if err := s.Put(Profile{Username: "alex", Role: RoleDriver}, "short"); err == nil {
+		t.Error("Expected a short password to be rejected")
+	}
+	if err := s.Put(Profile{Username: "alex", Role: RoleDriver}, "correct horse"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	profile, err := s.Authenticate("alex", "correct horse")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if profile.Role != RoleDriver {
+		t.Errorf("Expected driver role, got %s", profile.Role)
+	}
+	if _, err := s.Authenticate("alex", "wrong horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected invalid credentials, got %v", err)
+	}
+	if _, err := s.Authenticate("sam", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected invalid credentials for an unknown user, got %v", err)
+	}
+
+	// Replacing the profile without a password keeps the password
+	if err := s.Put(Profile{Username: "alex", Role: RoleViewer}, ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := s.Authenticate("alex", "correct horse"); err != nil {
+		t.Errorf("Expected the password to be kept, got %v", err)
+	}
+}
+
+func TestStorePersists(t *testing.T) {
+	s := testStore(t)
+	if err := s.Put(Profile{Username: "alex", Role: RoleDriver}, "correct horse"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	_, err := s.Update("alex", func(p *Profile) error {
+		p.Preferences.TemperatureUnit = UnitCelsius
+		p.Presets = append(p.Presets, Preset{Name: "warm", DriverTemp: 24, ClimateOn: true})
+		p.Role = RoleAdmin
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	reopened, err := Open(s.path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	profile, err := reopened.Get("alex")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if profile.Preferences.Unit() != UnitCelsius {
+		t.Errorf("Expected Celsius, got %s", profile.Preferences.Unit())
+	}
+	if _, ok := profile.FindPreset("warm"); !ok {
+		t.Error("Expected the preset to persist")
+	}
+	if profile.Role != RoleDriver {
+		t.Errorf("Expected Update not to change the role, got %s", profile.Role)
+	}
+	if _, err := reopened.Authenticate("alex", "correct horse"); err != nil {
+		t.Errorf("Expected the password to persist, got %v", err)
+	}
+
+	if err := reopened.Delete("alex"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := reopened.Get("alex"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	sessions := NewSessions(time.Hour)
+	token, _, err := sessions.Create("alex")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if username, ok := sessions.Lookup(token); !ok || username != "alex" {
+		t.Errorf("Expected alex, got %q (%v)", username, ok)
+	}
+
+	sessions.RevokeUser("alex")
+	if _, ok := sessions.Lookup(token); ok {
+		t.Error("Expected the session to be revoked")
+	}
+
+	expired := NewSessions(-time.Second)
+	token, _, _ = expired.Create("alex")
+	if _, ok := expired.Lookup(token); ok {
+		t.Error("Expected an expired session to be rejected")
+	}
+}
+
+func TestProfileContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("Expected no profile")
+	}
+	ctx := WithProfile(context.Background(), Profile{Username: "alex"})
+	if profile, ok := FromContext(ctx); !ok || profile.Username != "alex" {
+		t.Errorf("Expected alex, got %+v", profile)
+	}
+}
@@ -0,0 +1,106 @@
+package profile
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is how long a login lasts
+const DefaultSessionTTL = 30 * 24 * time.Hour
+
+// Sessions tracks logged-in users by bearer token. Sessions are kept in
+// memory, so a restart logs everyone out.
+type Sessions struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+// session is one login
+type session struct {
+	username string
+	expires  time.Time
+}
+
+// NewSessions creates a session table whose logins last ttl
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{ttl: ttl, sessions: make(map[string]session)}
+}
+
+// Create starts a session for username and returns its token and expiry
+func (s *Sessions) Create(username string) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expires := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[token] = session{username: username, expires: expires}
+	s.pruneLocked()
+	return token, expires, nil
+}
+
+// Lookup returns the user logged in with token
+func (s *Sessions) Lookup(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[token]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(session.expires) {
+		delete(s.sessions, token)
+		return "", false
+	}
+	return session.username, true
+}
+
+// Revoke ends the session for token
+func (s *Sessions) Revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+// RevokeUser ends every session of username
+func (s *Sessions) RevokeUser(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, session := range s.sessions {
+		if session.username == username {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// pruneLocked drops expired sessions
+func (s *Sessions) pruneLocked() {
+	now := time.Now()
+	for token, session := range s.sessions {
+		if now.After(session.expires) {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+type contextKey struct{}
+
+// WithProfile returns a context carrying the requesting user's profile
+func WithProfile(ctx context.Context, profile Profile) context.Context {
+	return context.WithValue(ctx, contextKey{}, profile)
+}
+
+// FromContext returns the requesting user's profile, if any
+func FromContext(ctx context.Context) (Profile, bool) {
+	profile, ok := ctx.Value(contextKey{}).(Profile)
+	return profile, ok
+}
@@ -0,0 +1,248 @@
+package profile
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/teslamotors/vehicle-command/internal/kdf"
+)
+
+// defaultIterations is the PBKDF2 work factor for new password hashes
+const defaultIterations = 600000
+
+// minPasswordLength is the shortest accepted password
+const minPasswordLength = 8
+
+var (
+	// ErrNotFound is returned for an unknown user
+	ErrNotFound = errors.New("user not found")
+	// ErrInvalidCredentials is returned when a login fails
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+// user is a stored account: the profile and its password hash
+type user struct {
+	Profile
+	PasswordHash []byte `json:"password_hash"`
+	Salt         []byte `json:"salt"`
+	Iterations   int    `json:"iterations"`
+}
+
+// Store keeps user accounts in a JSON file. Changes are written through to
+// the file.
+type Store struct {
+	path       string
+	iterations int
+
+	mu    sync.RWMutex
+	users map[string]*user
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, iterations: defaultIterations, users: make(map[string]*user)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	var users []*user
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, u := range users {
+		if err := u.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		s.users[u.Username] = u
+	}
+	return s, nil
+}
+
+// Empty reports whether the store has no users
+func (s *Store) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users) == 0
+}
+
+// List returns every profile, sorted by username
+func (s *Store) List() []Profile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	profiles := make([]Profile, 0, len(s.users))
+	for _, u := range s.users {
+		profiles = append(profiles, u.Profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Username < profiles[j].Username })
+	return profiles
+}
+
+// Get returns a user's profile
+func (s *Store) Get(username string) (Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+	return u.Profile, nil
+}
+
+// Put creates or replaces a user. A new user needs a password; an empty
+// password keeps an existing user's password.
+func (s *Store) Put(profile Profile, password string) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[profile.Username]
+	if !exists && password == "" {
+		return fmt.Errorf("password is required for a new user")
+	}
+
+	updated := &user{Profile: profile}
+	if password != "" {
+		if err := s.setPassword(updated, password); err != nil {
+			return err
+		}
+	} else {
+		updated.PasswordHash, updated.Salt, updated.Iterations = u.PasswordHash, u.Salt, u.Iterations
+	}
+
+	s.users[profile.Username] = updated
+	if err := s.save(); err != nil {
+		if exists {
+			s.users[profile.Username] = u
+		} else {
+			delete(s.users, profile.Username)
+		}
+		return err
+	}
+	return nil
+}
+
+// Update changes a user's profile with fn. The username and role can't be
+// changed this way.
+func (s *Store) Update(username string, fn func(*Profile) error) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return Profile{}, ErrNotFound
+	}
+
+	profile := u.Profile
+	profile.Presets = append([]Preset(nil), u.Presets...)
+	profile.Preferences.Notifications.Events = append([]string(nil), u.Preferences.Notifications.Events...)
+	if err := fn(&profile); err != nil {
+		return Profile{}, err
+	}
+	profile.Username, profile.Role = u.Username, u.Role
+	if err := profile.Validate(); err != nil {
+		return Profile{}, err
+	}
+
+	previous := u.Profile
+	u.Profile = profile
+	if err := s.save(); err != nil {
+		u.Profile = previous
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// Delete removes a user
+func (s *Store) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.users, username)
+	if err := s.save(); err != nil {
+		s.users[username] = u
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks a username and password and returns the profile
+func (s *Store) Authenticate(username, password string) (Profile, error) {
+	s.mu.RLock()
+	u, ok := s.users[username]
+	s.mu.RUnlock()
+
+	if !ok {
+		// Spend the same time as a real check so usernames can't be probed
+		kdf.PBKDF2SHA256([]byte(password), make([]byte, 16), s.iterations, 32)
+		return Profile{}, ErrInvalidCredentials
+	}
+
+	hash := kdf.PBKDF2SHA256([]byte(password), u.Salt, u.Iterations, len(u.PasswordHash))
+	if subtle.ConstantTimeCompare(hash, u.PasswordHash) != 1 {
+		return Profile{}, ErrInvalidCredentials
+	}
+	return s.Get(username)
+}
+
+// setPassword hashes password into u
+func (s *Store) setPassword(u *user, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	u.Salt = salt
+	u.Iterations = s.iterations
+	u.PasswordHash = kdf.PBKDF2SHA256([]byte(password), salt, s.iterations, 32)
+	return nil
+}
+
+// save writes the store to its file, replacing it atomically
+func (s *Store) save() error {
+	users := make([]*user, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,488 @@
+// Package qr encodes QR codes (ISO/IEC 18004) in byte mode with error
+// correction level M, and renders them as PNG or SVG.
+package qr
+
+import (
+	"errors"
+)
+
+// ErrTooLong is returned when the data doesn't fit the largest supported
+// version
+var ErrTooLong = errors.New("qr: data too long")
+
+// MaxVersion is the largest version Encode produces: 77x77 modules, up to
+// 412 bytes
+const MaxVersion = 15
+
+// blockLayout describes a version's error correction blocks at level M
+type blockLayout struct {
+	ecPerBlock   int // Error correction codewords in each block
+	group1Blocks int
+	group1Data   int // Data codewords in each group 1 block
+	group2Blocks int
+	group2Data   int // Group 2 blocks hold one more data codeword
+}
+
+// layouts is indexed by version
+var layouts = [MaxVersion + 1]blockLayout{
+	1:  {10, 1, 16, 0, 0},
+	2:  {16, 1, 28, 0, 0},
+	3:  {26, 1, 44, 0, 0},
+	4:  {18, 2, 32, 0, 0},
+	5:  {24, 2, 43, 0, 0},
+	6:  {16, 4, 27, 0, 0},
+	7:  {18, 4, 31, 0, 0},
+	8:  {22, 2, 38, 2, 39},
+	9:  {22, 3, 36, 2, 37},
+	10: {26, 4, 43, 1, 44},
+	11: {30, 1, 50, 4, 51},
+	12: {22, 6, 36, 2, 37},
+	13: {22, 8, 37, 1, 38},
+	14: {24, 4, 40, 5, 41},
+	15: {24, 5, 41, 5, 42},
+}
+
+// alignments lists the alignment pattern centers on each axis, by version
+var alignments = [MaxVersion + 1][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+	11: {6, 30, 54},
+	12: {6, 32, 58},
+	13: {6, 34, 62},
+	14: {6, 26, 46, 66},
+	15: {6, 26, 48, 70},
+}
+
+func (l blockLayout) dataCodewords() int {
+	return l.group1Blocks*l.group1Data + l.group2Blocks*l.group2Data
+}
+
+// countBits is the width of the byte mode character count
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// Code is an encoded QR code
+type Code struct {
+	Version int
+	Size    int // Modules on each side, without the quiet zone
+
+	modules  []bool // Dark modules, row by row
+	function []bool // Finder, timing, alignment, format and version modules
+}
+
+// Black reports whether the module at column x, row y is dark. Modules
+// outside the code are light.
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y*c.Size+x]
+}
+
+// Encode encodes data in the smallest version that holds it
+func Encode(data string) (*Code, error) {
+	version := 1
+	for ; version <= MaxVersion; version++ {
+		if 4+countBits(version)+8*len(data) <= 8*layouts[version].dataCodewords() {
+			break
+		}
+	}
+	if version > MaxVersion {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(addErrorCorrection(encodeData(data, version), layouts[version]))
+
+	best, lowest := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); lowest < 0 || penalty < lowest {
+			best, lowest = mask, penalty
+		}
+		c.applyMask(mask) // XOR undoes it
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+func newCode(version int) *Code {
+	size := 17 + 4*version
+	return &Code{
+		Version:  version,
+		Size:     size,
+		modules:  make([]bool, size*size),
+		function: make([]bool, size*size),
+	}
+}
+
+// encodeData builds the data codewords: byte mode indicator, count, data,
+// terminator and padding
+func encodeData(data string, version int) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits(version))
+	for i := 0; i < len(data); i++ {
+		bits.append(int(data[i]), 8)
+	}
+
+	capacity := 8 * layouts[version].dataCodewords()
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+// addErrorCorrection splits data into blocks, adds each block's Reed-Solomon
+// codewords and interleaves the result
+func addErrorCorrection(data []byte, layout blockLayout) []byte {
+	divisor := reedSolomonDivisor(layout.ecPerBlock)
+	var blocks, ecBlocks [][]byte
+	for i := 0; i < layout.group1Blocks+layout.group2Blocks; i++ {
+		n := layout.group1Data
+		if i >= layout.group1Blocks {
+			n = layout.group2Data
+		}
+		blocks = append(blocks, data[:n])
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(data[:n], divisor))
+		data = data[n:]
+	}
+
+	var result []byte
+	for i := 0; i < layout.group1Data || i < layout.group2Data; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// set sets a function module
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y*c.Size+x] = dark
+	c.function[y*c.Size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignments[c.Version]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the three overlapping the finders
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas until a mask is chosen
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator around a center
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the error correction level and mask,
+// protected by a BCH(15,5) code
+func (c *Code) drawFormatBits(mask int) {
+	const levelM = 0
+	data := levelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(bits, i))
+	}
+	c.set(8, 7, bit(bits, 6))
+	c.set(8, 8, bit(bits, 7))
+	c.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(bits, i))
+	}
+	c.set(8, c.Size-8, true) // Always dark
+}
+
+// drawVersion draws both copies of the version, protected by a BCH(18,6)
+// code, from version 7 up
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := c.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, bit(bits, i))
+		c.set(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places codewords in the zigzag order: up and down two-module
+// columns from the right, skipping function modules
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert // Upward
+				}
+				if c.function[y*c.Size+x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y*c.Size+x] = bit(int(codewords[i/8]), 7-i%8)
+				i++
+			}
+		}
+	}
+}
+
+// masked reports whether a mask pattern flips the module at x, y
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// applyMask flips the data modules a mask pattern selects
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y*c.Size+x] && masked(mask, x, y) {
+				c.modules[y*c.Size+x] = !c.modules[y*c.Size+x]
+			}
+		}
+	}
+}
+
+// finderLike is the 1:1:3:1:1 pattern, with four light modules on one side,
+// that penalty rule 3 looks for
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty scores how hard the code is to scan; the mask with the lowest
+// score is used
+func (c *Code) penalty() int {
+	result := 0
+	dark := 0
+	for a := 0; a < c.Size; a++ {
+		for _, horizontal := range []bool{true, false} {
+			at := func(i int) bool {
+				if horizontal {
+					return c.Black(i, a)
+				}
+				return c.Black(a, i)
+			}
+			// Rule 1: runs of five or more modules of one color
+			run := 1
+			for i := 1; i <= c.Size; i++ {
+				if i < c.Size && at(i) == at(i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += 3 + run - 5
+				}
+				run = 1
+			}
+			// Rule 3: patterns that look like finders
+			for i := 0; i+11 <= c.Size; i++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for j, want := range pattern {
+						if at(i+j) != want {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						result += 40
+					}
+				}
+			}
+		}
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			color := c.Black(x, y)
+			if color {
+				dark++
+			}
+			// Rule 2: 2x2 blocks of one color
+			if x+1 < c.Size && y+1 < c.Size && color == c.Black(x+1, y) && color == c.Black(x, y+1) && color == c.Black(x+1, y+1) {
+				result += 3
+			}
+		}
+	}
+
+	// Rule 4: 10 for every 5% the dark share is away from half
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * 10
+	return result
+}
+
+// bitBuffer is a sequence of bits, most significant first
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, bit(value, i))
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, (len(b)+7)/8)
+	for i, set := range b {
+		if set {
+			result[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return result
+}
+
+// reedSolomonDivisor returns the generator polynomial of a degree, without
+// its leading 1, highest power first
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords for data
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func bit(value, i int) bool {
+	return value>>i&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,225 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" in alphanumeric mode at 1-M, a widely published example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if ec := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(ec, expected) {
+		t.Errorf("Expected %v, got %v", expected, ec)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	c := newCode(7)
+	c.drawFormatBits(0)
+	c.drawVersion()
+
+	// Level M, mask 0 is 101010000010010, least significant bit at row 0
+	var format int
+	for i := 0; i <= 5; i++ {
+		if c.Black(8, i) {
+			format |= 1 << i
+		}
+	}
+	if c.Black(8, 7) {
+		format |= 1 << 6
+	}
+	if c.Black(8, 8) {
+		format |= 1 << 7
+	}
+	if c.Black(7, 8) {
+		format |= 1 << 8
+	}
+	for i := 9; i < 15; i++ {
+		if c.Black(14-i, 8) {
+			format |= 1 << i
+		}
+	}
+	if format != 0x5412 {
+		t.Errorf("Expected format bits 101010000010010, got %015b", format)
+	}
+
+	// Version 7 is 000111110010010100
+	var version int
+	for i := 0; i < 18; i++ {
+		if c.Black(c.Size-11+i%3, i/3) {
+			version |= 1 << i
+		}
+	}
+	if version != 0x07C94 {
+		t.Errorf("Expected version bits 000111110010010100, got %018b", version)
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	for version := 1; version <= MaxVersion; version++ {
+		c := newCode(version)
+		c.drawFunctionPatterns()
+		modules := 0
+		for _, function := range c.function {
+			if !function {
+				modules++
+			}
+		}
+		layout := layouts[version]
+		total := layout.dataCodewords() + layout.ecPerBlock*(layout.group1Blocks+layout.group2Blocks)
+		remainder := map[bool]int{true: 7, false: 0}[version >= 2 && version <= 6]
+		if version >= 14 {
+			remainder = 3
+		}
+		if modules != total*8+remainder {
+			t.Errorf("Version %d: %d data modules for %d codewords", version, modules, total)
+		}
+	}
+}
+
+// decode reads a code back: format, unmasking, codeword order, error
+// correction and byte mode
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+	var format int
+	for i := 0; i < 8; i++ {
+		if c.Black(c.Size-1-i, 8) {
+			format |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if c.Black(8, c.Size-15+i) {
+			format |= 1 << i
+		}
+	}
+	format ^= 0x5412
+	if format>>13 != 0 {
+		t.Fatalf("Expected level M, got format %015b", format)
+	}
+	mask := format >> 10 & 7
+
+	layout := layouts[c.Version]
+	blocks := layout.group1Blocks + layout.group2Blocks
+	total := layout.dataCodewords() + layout.ecPerBlock*blocks
+	reference := newCode(c.Version)
+	reference.drawFunctionPatterns()
+	var bits bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !reference.function[y*c.Size+x] && len(bits) < total*8 {
+					bits = append(bits, c.Black(x, y) != masked(mask, x, y))
+				}
+			}
+		}
+	}
+	codewords := bits.bytes()
+
+	data := make([][]byte, blocks)
+	i := 0
+	for n := 0; n < layout.group1Data || n < layout.group2Data; n++ {
+		for b := range data {
+			if n < layout.group1Data || b >= layout.group1Blocks {
+				data[b] = append(data[b], codewords[i])
+				i++
+			}
+		}
+	}
+	var stream []byte
+	for b := range data {
+		var ec []byte
+		for n := 0; n < layout.ecPerBlock; n++ {
+			ec = append(ec, codewords[i+n*blocks+b])
+		}
+		if !bytes.Equal(ec, reedSolomonRemainder(data[b], reedSolomonDivisor(layout.ecPerBlock))) {
+			t.Fatalf("Block %d fails error correction", b)
+		}
+		stream = append(stream, data[b]...)
+	}
+
+	read := func(offset, n int) int {
+		value := 0
+		for i := offset; i < offset+n; i++ {
+			value = value<<1 | int(stream[i/8]>>(7-i%8)&1)
+		}
+		return value
+	}
+	if mode := read(0, 4); mode != 0x4 {
+		t.Fatalf("Expected byte mode, got %04b", mode)
+	}
+	count := read(4, countBits(c.Version))
+	var result []byte
+	for i := 0; i < count; i++ {
+		result = append(result, byte(read(4+countBits(c.Version)+8*i, 8)))
+	}
+	return string(result)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"tesla://_ak/example.com",
+		"https://tesla.com/_ak/" + strings.Repeat("sub.", 30) + "example.com",
+		strings.Repeat("x", 412),
+	} {
+		c, err := Encode(data)
+		if err != nil {
+			t.Fatalf("Failed to encode %d bytes: %v", len(data), err)
+		}
+		if c.Size != 17+4*c.Version {
+			t.Errorf("Version %d has size %d", c.Version, c.Size)
+		}
+		if decoded := decode(t, c); decoded != data {
+			t.Errorf("Expected %q, decoded %q", data, decoded)
+		}
+	}
+
+	if c, _ := Encode("tesla://_ak/example.com"); c.Version != 2 {
+		t.Errorf("Expected version 2, got %d", c.Version)
+	}
+	if _, err := Encode(strings.Repeat("x", 413)); err != ErrTooLong {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode("tesla://_ak/example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.PNG(4)
+	if err != nil {
+		t.Fatalf("Failed to render PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Invalid PNG: %v", err)
+	}
+	width := (c.Size + 2*QuietZone) * 4
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != width {
+		t.Errorf("Expected %dx%d, got %v", width, width, img.Bounds())
+	}
+	// Top-left finder corner is dark, the quiet zone light
+	if r, _, _, _ := img.At(QuietZone*4, QuietZone*4).RGBA(); r != 0 {
+		t.Error("Expected the finder corner to be dark")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("Expected the quiet zone to be light")
+	}
+
+	svg := string(c.SVG(4))
+	if !strings.Contains(svg, "<svg") || !strings.Contains(svg, `viewBox="0 0 33 33"`) || !strings.Contains(svg, "M4,4h1v1h-1z") {
+		t.Errorf("Unexpected SVG: %s", svg)
+	}
+}
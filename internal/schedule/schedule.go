@@ -0,0 +1,361 @@
+// Package schedule runs climate actions at set times of day, like a small
+// cron for the HVAC server.
+//
+// A schedule fires at a local time on chosen days of the week. The Scheduler
+// reads its schedules from a source on every pass, so edits take effect
+// without a restart, and hands each due schedule to a RunFunc that drives
+// the vehicle. Runs missed while the server was down are skipped rather than
+// caught up.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions a schedule can run
+const (
+	ActionClimateOn    = "climate_on"
+	ActionClimateOff   = "climate_off"
+	ActionPreset       = "preset"       // Apply the named preset
+	ActionPrecondition = "precondition" // Set the temperature, if given, and turn climate on
+)
+
+// maxWait bounds how long the scheduler sleeps between passes, so clock
+// changes are noticed
+const maxWait = time.Minute
+
+// maxLate is how late a run may start, e.g. after the host was suspended,
+// before it is skipped
+const maxLate = 5 * time.Minute
+
+// namePattern restricts schedule names to what works as a URL segment
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// timePattern matches a 24-hour HH:MM time of day
+var timePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):([0-5][0-9])$`)
+
+// dayNames maps day names to weekdays. "weekdays" and "weekends" expand to
+// several days.
+var dayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Schedule runs an action at a time of day on some days of the week
+type Schedule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Action      string   `json:"action"`
+	Preset      string   `json:"preset,omitempty"`      // For the preset action
+	Temperature *float32 `json:"temperature,omitempty"` // Celsius, for the precondition action
+	At          string   `json:"at"`                    // Local time of day as HH:MM
+	Days        []string `json:"days,omitempty"`        // mon to sun, weekdays or weekends; every day if empty
+	VIN         string   `json:"vin,omitempty"`         // The only vehicle if empty
+	Disabled    bool     `json:"disabled,omitempty"`
+	Notify      bool     `json:"notify,omitempty"` // Send a notification each time it runs
+}
+
+// Validate checks the schedule's name, action and timing
+func (s Schedule) Validate() error {
+	if !namePattern.MatchString(s.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, '-' or '_'", s.Name)
+	}
+
+	switch s.Action {
+	case ActionClimateOn, ActionClimateOff, ActionPrecondition:
+		if s.Preset != "" {
+			return fmt.Errorf("schedule %s: preset is only used by the %s action", s.Name, ActionPreset)
+		}
+	case ActionPreset:
+		if s.Preset == "" {
+			return fmt.Errorf("schedule %s: preset is required", s.Name)
+		}
+	default:
+		return fmt.Errorf("schedule %s: unknown action %q", s.Name, s.Action)
+	}
+	if s.Temperature != nil && s.Action != ActionPrecondition {
+		return fmt.Errorf("schedule %s: temperature is only used by the %s action", s.Name, ActionPrecondition)
+	}
+
+	if _, _, err := s.clock(); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	if _, err := s.weekdays(); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// clock parses the time of day
+func (s Schedule) clock() (hour, minute int, err error) {
+	hour, minute, err = ParseTimeOfDay(s.At)
+	if err != nil {
+		return 0, 0, fmt.Errorf("at %w", err)
+	}
+	return hour, minute, nil
+}
+
+// ParseTimeOfDay parses a 24-hour HH:MM time of day
+func ParseTimeOfDay(value string) (hour, minute int, err error) {
+	match := timePattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, 0, fmt.Errorf("%q must be a time of day as HH:MM", value)
+	}
+	hour, _ = strconv.Atoi(match[1])
+	minute, _ = strconv.Atoi(match[2])
+	return hour, minute, nil
+}
+
+// weekdays returns the days the schedule fires on
+func (s Schedule) weekdays() (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool, 7)
+	if len(s.Days) == 0 {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			days[day] = true
+		}
+		return days, nil
+	}
+	for _, name := range s.Days {
+		weekdays, ok := dayNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", name)
+		}
+		for _, day := range weekdays {
+			days[day] = true
+		}
+	}
+	return days, nil
+}
+
+// Next returns the first time after t that the schedule fires, in t's
+// location. It returns the zero time for an invalid schedule.
+func (s Schedule) Next(t time.Time) time.Time {
+	hour, minute, err := s.clock()
+	if err != nil {
+		return time.Time{}
+	}
+	days, err := s.weekdays()
+	if err != nil {
+		return time.Time{}
+	}
+
+	// Eight days covers a weekly schedule whose time today has passed
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		next := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, t.Location())
+		if next.After(t) && days[next.Weekday()] {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// Validate checks every schedule and that names are unique
+func Validate(schedules []Schedule) error {
+	seen := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+		if seen[schedule.Name] {
+			return fmt.Errorf("duplicate schedule %s", schedule.Name)
+		}
+		seen[schedule.Name] = true
+	}
+	return nil
+}
+
+// Status is a schedule with its next and most recent runs
+type Status struct {
+	Schedule
+	NextRun   time.Time `json:"next_run,omitempty"` // Zero while disabled
+	LastRunAt time.Time `json:"last_run_at,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Runs      int       `json:"runs"`
+}
+
+// RunFunc carries out a schedule's action
+type RunFunc func(ctx context.Context, schedule Schedule) error
+
+// Scheduler fires schedules when they are due
+type Scheduler struct {
+	source func() []Schedule
+	run    RunFunc
+	logger *log.Logger
+	now    func() time.Time
+
+	mu     sync.Mutex
+	status map[string]*Status
+	kick   chan struct{}
+}
+
+// New creates a scheduler for the schedules returned by source, which is
+// called on every pass
+func New(source func() []Schedule, run RunFunc, logger *log.Logger) *Scheduler {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	return &Scheduler{
+		source: source,
+		run:    run,
+		logger: logger,
+		now:    time.Now,
+		status: make(map[string]*Status),
+		kick:   make(chan struct{}, 1),
+	}
+}
+
+// Run fires due schedules until ctx is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		timer := time.NewTimer(s.RunDue(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		case <-s.kick:
+			timer.Stop()
+		}
+	}
+}
+
+// Reload prompts Run to re-read the schedules, after they were changed
+func (s *Scheduler) Reload() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// RunDue fires the schedules that are due and returns how long until the
+// next one is
+func (s *Scheduler) RunDue(ctx context.Context) time.Duration {
+	now := s.now()
+	for _, schedule := range s.due(now) {
+		s.logger.Printf("Running schedule %s (%s)", schedule.Name, schedule.Action)
+		err := s.run(ctx, schedule)
+		if err != nil {
+			s.logger.Printf("Schedule %s failed: %v", schedule.Name, err)
+		}
+		s.finish(schedule.Name, now, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := maxWait
+	for _, status := range s.status {
+		if status.NextRun.IsZero() {
+			continue
+		}
+		if until := status.NextRun.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// due syncs the status with the current schedules and returns those due at
+// now. A new or changed schedule is first due at its next time after now.
+func (s *Scheduler) due(now time.Time) []Schedule {
+	schedules := s.source()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Schedule
+	current := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		current[schedule.Name] = true
+
+		status, ok := s.status[schedule.Name]
+		if !ok {
+			status = &Status{}
+			s.status[schedule.Name] = status
+		}
+		changed := !ok || status.At != schedule.At || strings.Join(status.Days, ",") != strings.Join(schedule.Days, ",") || status.Disabled != schedule.Disabled
+		status.Schedule = schedule
+
+		switch {
+		case schedule.Disabled:
+			status.NextRun = time.Time{}
+		case changed || status.NextRun.IsZero():
+			status.NextRun = schedule.Next(now)
+		case now.Sub(status.NextRun) > maxLate:
+			s.logger.Printf("Skipping schedule %s, missed at %s", schedule.Name, status.NextRun.Format(time.RFC3339))
+			status.NextRun = schedule.Next(now)
+		case !status.NextRun.After(now):
+			due = append(due, schedule)
+		}
+	}
+
+	for name := range s.status {
+		if !current[name] {
+			delete(s.status, name)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Name < due[j].Name })
+	return due
+}
+
+// finish records a run and moves the schedule to its next time
+func (s *Scheduler) finish(name string, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.status[name]
+	if !ok {
+		// Removed while running
+		return
+	}
+	status.Runs++
+	status.LastRunAt = now
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	status.NextRun = status.Schedule.Next(now)
+}
+
+// Status returns the state of every current schedule, ordered by name.
+// Schedules Run hasn't picked up yet are listed with their next run.
+func (s *Scheduler) Status() []Status {
+	schedules := s.source()
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(schedules))
+	for _, schedule := range schedules {
+		status := Status{Schedule: schedule}
+		if tracked, ok := s.status[schedule.Name]; ok {
+			status = *tracked
+			status.Schedule = schedule
+		} else if !schedule.Disabled {
+			status.NextRun = schedule.Next(now)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
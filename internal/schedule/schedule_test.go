@@ -0,0 +1,250 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	temp := float32(21)
+	tests := []struct {
+		name     string
+		schedule Schedule
+		valid    bool
+	}{
+		{"climate on", Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45"}, true},
+		{"preset", Schedule{Name: "defrost", Action: ActionPreset, Preset: "morning-defrost", At: "07:00", Days: []string{"weekdays"}}, true},
+		{"precondition", Schedule{Name: "warm", Action: ActionPrecondition, Temperature: &temp, At: "23:59", Days: []string{"Sat", "sun"}}, true},
+		{"bad name", Schedule{Name: "Morning", Action: ActionClimateOn, At: "06:45"}, false},
+		{"unknown action", Schedule{Name: "morning", Action: "honk", At: "06:45"}, false},
+		{"preset without name", Schedule{Name: "defrost", Action: ActionPreset, At: "07:00"}, false},
+		{"preset on climate action", Schedule{Name: "morning", Action: ActionClimateOff, Preset: "cool", At: "07:00"}, false},
+		{"temperature on climate action", Schedule{Name: "morning", Action: ActionClimateOn, Temperature: &temp, At: "07:00"}, false},
+		{"bad time", Schedule{Name: "morning", Action: ActionClimateOn, At: "24:00"}, false},
+		{"missing time", Schedule{Name: "morning", Action: ActionClimateOn}, false},
+		{"bad day", Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45", Days: []string{"monday"}}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.schedule.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestValidateDuplicateNames(t *testing.T) {
+	schedules := []Schedule{
+		{Name: "morning", Action: ActionClimateOn, At: "06:45"},
+		{Name: "morning", Action: ActionClimateOff, At: "07:30"},
+	}
+	if err := Validate(schedules); err == nil {
+		t.Error("Expected an error for duplicate names")
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// Wednesday
+	now := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     time.Time
+	}{
+		{"later today", Schedule{At: "09:30"}, time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)},
+		{"passed today", Schedule{At: "07:00"}, time.Date(2026, 10, 15, 7, 0, 0, 0, time.UTC)},
+		{"exactly now", Schedule{At: "08:00"}, time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)},
+		{"weekends", Schedule{At: "07:00", Days: []string{"weekends"}}, time.Date(2026, 10, 17, 7, 0, 0, 0, time.UTC)},
+		{"same day next week", Schedule{At: "07:00", Days: []string{"wed"}}, time.Date(2026, 10, 21, 7, 0, 0, 0, time.UTC)},
+		{"invalid", Schedule{At: "7am"}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.schedule.Next(now); !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// testScheduler runs schedules from a fixed list on a fake clock
+type testScheduler struct {
+	*Scheduler
+
+	mu        sync.Mutex
+	schedules []Schedule
+	runs      []string
+	now       time.Time
+	err       error
+}
+
+func newTestScheduler(schedules ...Schedule) *testScheduler {
+	ts := &testScheduler{
+		schedules: schedules,
+		now:       time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC),
+	}
+	ts.Scheduler = New(ts.source, ts.run, nil)
+	ts.Scheduler.now = func() time.Time {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		return ts.now
+	}
+	return ts
+}
+
+func (ts *testScheduler) source() []Schedule {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]Schedule(nil), ts.schedules...)
+}
+
+func (ts *testScheduler) run(ctx context.Context, schedule Schedule) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.runs = append(ts.runs, schedule.Name)
+	return ts.err
+}
+
+func (ts *testScheduler) advance(to string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	clock, _ := time.Parse("15:04", to)
+	ts.now = time.Date(ts.now.Year(), ts.now.Month(), ts.now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+}
+
+func (ts *testScheduler) runCount() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return len(ts.runs)
+}
+
+func TestSchedulerRunsDueSchedules(t *testing.T) {
+	ts := newTestScheduler(
+		Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45"},
+		Schedule{Name: "off", Action: ActionClimateOff, At: "07:30"},
+	)
+	ctx := context.Background()
+
+	if wait := ts.RunDue(ctx); wait != maxWait {
+		t.Errorf("Expected to wait %v, got %v", maxWait, wait)
+	}
+	if ts.runCount() != 0 {
+		t.Fatalf("Expected no runs before the schedule is due, got %v", ts.runs)
+	}
+
+	ts.advance("06:44")
+	if wait := ts.RunDue(ctx); wait != time.Minute {
+		t.Errorf("Expected to wait a minute, got %v", wait)
+	}
+
+	ts.advance("06:45")
+	ts.RunDue(ctx)
+	if ts.runCount() != 1 || ts.runs[0] != "morning" {
+		t.Fatalf("Expected morning to run, got %v", ts.runs)
+	}
+
+	// It doesn't run again until tomorrow
+	ts.RunDue(ctx)
+	if ts.runCount() != 1 {
+		t.Errorf("Expected one run, got %v", ts.runs)
+	}
+
+	statuses := ts.Status()
+	if len(statuses) != 2 || statuses[0].Name != "morning" {
+		t.Fatalf("Unexpected status: %+v", statuses)
+	}
+	if statuses[0].Runs != 1 || !statuses[0].NextRun.Equal(time.Date(2026, 10, 15, 6, 45, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next run tomorrow, got %+v", statuses[0])
+	}
+}
+
+func TestSchedulerRecordsErrors(t *testing.T) {
+	ts := newTestScheduler(Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45"})
+	ts.err = errors.New("not connected")
+	ctx := context.Background()
+
+	ts.RunDue(ctx)
+	ts.advance("06:45")
+	ts.RunDue(ctx)
+
+	status := ts.Status()[0]
+	if status.LastError != "not connected" || status.Runs != 1 {
+		t.Errorf("Expected the failure to be recorded, got %+v", status)
+	}
+}
+
+func TestSchedulerFollowsChanges(t *testing.T) {
+	ts := newTestScheduler(Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45"})
+	ctx := context.Background()
+	ts.RunDue(ctx)
+
+	// Moving the time reschedules it
+	ts.mu.Lock()
+	ts.schedules[0].At = "06:30"
+	ts.mu.Unlock()
+	ts.RunDue(ctx)
+	ts.advance("06:30")
+	ts.RunDue(ctx)
+	if ts.runCount() != 1 {
+		t.Fatalf("Expected the moved schedule to run, got %v", ts.runs)
+	}
+
+	// Disabled and removed schedules don't run
+	ts.mu.Lock()
+	ts.schedules = []Schedule{
+		{Name: "disabled", Action: ActionClimateOn, At: "06:40", Disabled: true},
+	}
+	ts.mu.Unlock()
+	ts.RunDue(ctx)
+	ts.advance("06:45")
+	ts.RunDue(ctx)
+	if ts.runCount() != 1 {
+		t.Errorf("Expected no more runs, got %v", ts.runs)
+	}
+
+	statuses := ts.Status()
+	if len(statuses) != 1 || !statuses[0].NextRun.IsZero() {
+		t.Errorf("Expected only the disabled schedule without a next run, got %+v", statuses)
+	}
+}
+
+func TestSchedulerSkipsMissedRuns(t *testing.T) {
+	ts := newTestScheduler(Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45"})
+	ctx := context.Background()
+	ts.RunDue(ctx)
+
+	// The host slept through the run
+	ts.advance("09:00")
+	ts.RunDue(ctx)
+	if ts.runCount() != 0 {
+		t.Errorf("Expected the missed run to be skipped, got %v", ts.runs)
+	}
+	if next := ts.Status()[0].NextRun; !next.Equal(time.Date(2026, 10, 15, 6, 45, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next run tomorrow, got %v", next)
+	}
+}
+
+func TestSchedulerRunStops(t *testing.T) {
+	ts := newTestScheduler(Schedule{Name: "morning", Action: ActionClimateOn, At: "06:45"})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- ts.Run(ctx) }()
+	ts.Reload()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't stop")
+	}
+}
@@ -0,0 +1,716 @@
+// Package script implements a small, sandboxed subset of Lua for user hooks.
+//
+// Supported: local and global variables, functions and closures, tables,
+// if/while/numeric for/generic for (with pairs and ipairs), break and return,
+// and the usual arithmetic, comparison, logical and concatenation operators.
+// Functions return at most one value. There is no access to files, the
+// network or the OS: scripts can only call the functions the host provides.
+// Execution is bounded by a step budget, a call depth limit and a context.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// DefaultMaxSteps is the default step budget for a single Run or Call
+	DefaultMaxSteps = 100000
+	// DefaultMaxDepth is the default maximum call depth
+	DefaultMaxDepth = 100
+
+	// contextCheckInterval is how many steps run between context checks
+	contextCheckInterval = 1000
+)
+
+var (
+	ErrStepLimit  = errors.New("script exceeded its step limit")
+	ErrDepthLimit = errors.New("script exceeded its call depth limit")
+)
+
+// Error is a runtime error raised by a script
+type Error struct {
+	Script  string
+	Line    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Script, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Script, e.Message)
+}
+
+// Options limits the resources a script may use
+type Options struct {
+	MaxSteps int
+	MaxDepth int
+}
+
+// scope is a lexical scope
+type scope struct {
+	vars   map[string]Value
+	parent *scope
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: make(map[string]Value), parent: parent}
+}
+
+// lookup finds the scope defining name, or nil
+func (s *scope) lookup(name string) *scope {
+	for sc := s; sc != nil; sc = sc.parent {
+		if _, ok := sc.vars[name]; ok {
+			return sc
+		}
+	}
+	return nil
+}
+
+// State is a script environment holding globals. A State is not safe for
+// concurrent use.
+type State struct {
+	name     string
+	globals  *scope
+	maxSteps int
+	maxDepth int
+
+	ctx   context.Context
+	steps int
+	depth int
+}
+
+// NewState creates a script environment with the standard library installed
+func NewState(name string, opts Options) *State {
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultMaxSteps
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+
+	s := &State{
+		name:     name,
+		globals:  newScope(nil),
+		maxSteps: opts.MaxSteps,
+		maxDepth: opts.MaxDepth,
+	}
+	s.openStdlib()
+	return s
+}
+
+// SetGlobal sets a global variable
+func (s *State) SetGlobal(name string, v Value) {
+	if v == nil {
+		delete(s.globals.vars, name)
+		return
+	}
+	s.globals.vars[name] = v
+}
+
+// Global returns a global variable, or nil
+func (s *State) Global(name string) Value {
+	return s.globals.vars[name]
+}
+
+// DoString parses and runs a chunk of source, returning its return value
+func (s *State) DoString(ctx context.Context, src string) (Value, error) {
+	body, err := parse(src)
+	if err != nil {
+		return nil, &Error{Script: s.name, Message: err.Error()}
+	}
+
+	fn := &Function{name: "main", body: body, env: s.globals}
+	return s.Call(ctx, fn)
+}
+
+// Call calls a script or host function with a fresh step budget
+func (s *State) Call(ctx context.Context, fn Value, args ...Value) (result Value, err error) {
+	s.ctx = ctx
+	s.steps = 0
+	s.depth = 0
+
+	defer func() {
+		// Host functions may panic on unexpected input; report it as a
+		// script error rather than crashing the server
+		if r := recover(); r != nil {
+			result, err = nil, &Error{Script: s.name, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+
+	return s.call(fn, args, 0)
+}
+
+// Context returns the context of the call in progress, for host functions
+// that do I/O on the script's behalf
+func (s *State) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// runtimeError creates an error at a source line
+func (s *State) runtimeError(line int, format string, args ...interface{}) error {
+	return &Error{Script: s.name, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// step accounts for one unit of work, enforcing the budget and context
+func (s *State) step() error {
+	s.steps++
+	if s.steps > s.maxSteps {
+		return ErrStepLimit
+	}
+	if s.steps%contextCheckInterval == 0 && s.ctx != nil {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// control signals how a statement completed
+type control int
+
+const (
+	ctrlNone control = iota
+	ctrlBreak
+	ctrlReturn
+)
+
+// call invokes a function value
+func (s *State) call(fn Value, args []Value, line int) (Value, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+
+	switch fn := fn.(type) {
+	case GoFunction:
+		result, err := fn(args)
+		if err != nil {
+			var scriptErr *Error
+			if errors.As(err, &scriptErr) || errors.Is(err, ErrStepLimit) || errors.Is(err, ErrDepthLimit) {
+				return nil, err
+			}
+			return nil, s.runtimeError(line, "%v", err)
+		}
+		return result, nil
+	case *Function:
+		if s.depth >= s.maxDepth {
+			return nil, ErrDepthLimit
+		}
+		s.depth++
+		defer func() { s.depth-- }()
+
+		env := newScope(fn.env)
+		for i, param := range fn.params {
+			var arg Value
+			if i < len(args) {
+				arg = args[i]
+			}
+			env.vars[param] = arg
+		}
+
+		ctrl, result, err := s.execBlock(fn.body, env)
+		if err != nil {
+			return nil, err
+		}
+		if ctrl == ctrlBreak {
+			return nil, s.runtimeError(line, "break outside a loop")
+		}
+		return result, nil
+	default:
+		return nil, s.runtimeError(line, "attempt to call a %s value", typeName(fn))
+	}
+}
+
+// execBlock runs a block in a new scope
+func (s *State) execBlock(b *block, parent *scope) (control, Value, error) {
+	// Entering a block costs a step so empty loop bodies still consume budget
+	if err := s.step(); err != nil {
+		return ctrlNone, nil, err
+	}
+	env := newScope(parent)
+	for _, st := range b.stmts {
+		ctrl, result, err := s.exec(st, env)
+		if err != nil || ctrl != ctrlNone {
+			return ctrl, result, err
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+// exec runs a single statement
+func (s *State) exec(st stmt, env *scope) (control, Value, error) {
+	if err := s.step(); err != nil {
+		return ctrlNone, nil, err
+	}
+
+	switch st := st.(type) {
+	case *localStmt:
+		values, err := s.evalList(st.exprs, env, len(st.names))
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		for i, name := range st.names {
+			env.vars[name] = values[i]
+		}
+
+	case *localFuncStmt:
+		// Declare first so the function can call itself
+		env.vars[st.name] = nil
+		env.vars[st.name] = &Function{name: st.fn.name, params: st.fn.params, body: st.fn.body, env: env}
+
+	case *assignStmt:
+		values, err := s.evalList(st.exprs, env, len(st.targets))
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		for i, target := range st.targets {
+			if err := s.assign(target, values[i], env, st.line); err != nil {
+				return ctrlNone, nil, err
+			}
+		}
+
+	case *callStmt:
+		if _, err := s.eval(st.call, env); err != nil {
+			return ctrlNone, nil, err
+		}
+
+	case *ifStmt:
+		for i, cond := range st.conds {
+			v, err := s.eval(cond, env)
+			if err != nil {
+				return ctrlNone, nil, err
+			}
+			if truthy(v) {
+				return s.execBlock(st.blocks[i], env)
+			}
+		}
+		if st.elseBlock != nil {
+			return s.execBlock(st.elseBlock, env)
+		}
+
+	case *whileStmt:
+		for {
+			v, err := s.eval(st.cond, env)
+			if err != nil {
+				return ctrlNone, nil, err
+			}
+			if !truthy(v) {
+				break
+			}
+			ctrl, result, err := s.execBlock(st.body, env)
+			if err != nil || ctrl == ctrlReturn {
+				return ctrl, result, err
+			}
+			if ctrl == ctrlBreak {
+				break
+			}
+		}
+
+	case *numForStmt:
+		return s.execNumFor(st, env)
+
+	case *genForStmt:
+		return s.execGenFor(st, env)
+
+	case *doStmt:
+		return s.execBlock(st.body, env)
+
+	case *breakStmt:
+		return ctrlBreak, nil, nil
+
+	case *returnStmt:
+		if st.value == nil {
+			return ctrlReturn, nil, nil
+		}
+		v, err := s.eval(st.value, env)
+		return ctrlReturn, v, err
+
+	default:
+		return ctrlNone, nil, fmt.Errorf("unknown statement %T", st)
+	}
+
+	return ctrlNone, nil, nil
+}
+
+func (s *State) execNumFor(st *numForStmt, env *scope) (control, Value, error) {
+	bounds := []expr{st.start, st.limit, st.step}
+	values := []float64{0, 0, 1}
+	for i, e := range bounds {
+		if e == nil {
+			continue
+		}
+		v, err := s.eval(e, env)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		n, ok := toNumber(v)
+		if !ok {
+			return ctrlNone, nil, s.runtimeError(st.line, "'for' bounds must be numbers")
+		}
+		values[i] = n
+	}
+
+	start, limit, step := values[0], values[1], values[2]
+	if step == 0 {
+		return ctrlNone, nil, s.runtimeError(st.line, "'for' step is zero")
+	}
+
+	for i := start; (step > 0 && i <= limit) || (step < 0 && i >= limit); i += step {
+		loop := newScope(env)
+		loop.vars[st.name] = i
+		ctrl, result, err := s.execBlock(st.body, loop)
+		if err != nil || ctrl == ctrlReturn {
+			return ctrl, result, err
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+// iterator is returned by pairs and ipairs for use in generic for loops
+type iterator struct {
+	table *Table
+	keys  []Value
+}
+
+func (s *State) execGenFor(st *genForStmt, env *scope) (control, Value, error) {
+	v, err := s.eval(st.iter, env)
+	if err != nil {
+		return ctrlNone, nil, err
+	}
+	it, ok := v.(*iterator)
+	if !ok {
+		return ctrlNone, nil, s.runtimeError(st.line, "generic 'for' requires pairs() or ipairs()")
+	}
+
+	for _, key := range it.keys {
+		value := it.table.Get(key)
+		if value == nil {
+			// Removed during iteration
+			continue
+		}
+
+		loop := newScope(env)
+		loop.vars[st.names[0]] = key
+		if len(st.names) > 1 {
+			loop.vars[st.names[1]] = value
+		}
+
+		ctrl, result, err := s.execBlock(st.body, loop)
+		if err != nil || ctrl == ctrlReturn {
+			return ctrl, result, err
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+// assign stores a value into a name or table field
+func (s *State) assign(target expr, value Value, env *scope, line int) error {
+	switch target := target.(type) {
+	case *nameExpr:
+		if sc := env.lookup(target.name); sc != nil {
+			sc.vars[target.name] = value
+		} else if value != nil {
+			s.globals.vars[target.name] = value
+		}
+		return nil
+	case *indexExpr:
+		obj, err := s.eval(target.obj, env)
+		if err != nil {
+			return err
+		}
+		table, ok := obj.(*Table)
+		if !ok {
+			return s.runtimeError(target.line, "attempt to index a %s value", typeName(obj))
+		}
+		key, err := s.eval(target.key, env)
+		if err != nil {
+			return err
+		}
+		if !validKey(normalizeKey(key)) {
+			return s.runtimeError(target.line, "invalid table key (%s)", typeName(key))
+		}
+		table.Set(key, value)
+		return nil
+	default:
+		return s.runtimeError(line, "cannot assign to expression")
+	}
+}
+
+// evalList evaluates expressions, padding or truncating to n values
+func (s *State) evalList(exprs []expr, env *scope, n int) ([]Value, error) {
+	values := make([]Value, n)
+	for i, e := range exprs {
+		v, err := s.eval(e, env)
+		if err != nil {
+			return nil, err
+		}
+		if i < n {
+			values[i] = v
+		}
+	}
+	return values, nil
+}
+
+// eval evaluates an expression
+func (s *State) eval(e expr, env *scope) (Value, error) {
+	switch e := e.(type) {
+	case *constExpr:
+		return e.value, nil
+
+	case *nameExpr:
+		if sc := env.lookup(e.name); sc != nil {
+			return sc.vars[e.name], nil
+		}
+		return nil, nil
+
+	case *indexExpr:
+		obj, err := s.eval(e.obj, env)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.eval(e.key, env)
+		if err != nil {
+			return nil, err
+		}
+		return s.index(obj, key, e.line)
+
+	case *callExpr:
+		fn, err := s.eval(e.fn, env)
+		if err != nil {
+			return nil, err
+		}
+		args, err := s.evalArgs(e.args, env)
+		if err != nil {
+			return nil, err
+		}
+		return s.call(fn, args, e.line)
+
+	case *methodCallExpr:
+		obj, err := s.eval(e.obj, env)
+		if err != nil {
+			return nil, err
+		}
+		fn, err := s.index(obj, e.name, e.line)
+		if err != nil {
+			return nil, err
+		}
+		args, err := s.evalArgs(e.args, env)
+		if err != nil {
+			return nil, err
+		}
+		return s.call(fn, append([]Value{obj}, args...), e.line)
+
+	case *funcExpr:
+		return &Function{name: e.name, params: e.params, body: e.body, env: env}, nil
+
+	case *tableExpr:
+		table := NewTable()
+		n := 0
+		for _, item := range e.items {
+			value, err := s.eval(item.value, env)
+			if err != nil {
+				return nil, err
+			}
+			if item.key == nil {
+				n++
+				table.Set(float64(n), value)
+				continue
+			}
+			key, err := s.eval(item.key, env)
+			if err != nil {
+				return nil, err
+			}
+			if !validKey(normalizeKey(key)) {
+				return nil, s.runtimeError(0, "invalid table key (%s)", typeName(key))
+			}
+			table.Set(key, value)
+		}
+		return table, nil
+
+	case *unExpr:
+		v, err := s.eval(e.e, env)
+		if err != nil {
+			return nil, err
+		}
+		return s.unary(e.op, v, e.line)
+
+	case *binExpr:
+		return s.binary(e, env)
+
+	default:
+		return nil, fmt.Errorf("unknown expression %T", e)
+	}
+}
+
+func (s *State) evalArgs(exprs []expr, env *scope) ([]Value, error) {
+	args := make([]Value, len(exprs))
+	for i, e := range exprs {
+		v, err := s.eval(e, env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+// index reads a table field. Strings index the string library so that
+// methods like s:upper() work.
+func (s *State) index(obj, key Value, line int) (Value, error) {
+	switch obj := obj.(type) {
+	case *Table:
+		return obj.Get(key), nil
+	case string:
+		if lib, ok := s.globals.vars["string"].(*Table); ok {
+			return lib.Get(key), nil
+		}
+	}
+	return nil, s.runtimeError(line, "attempt to index a %s value", typeName(obj))
+}
+
+func (s *State) unary(op string, v Value, line int) (Value, error) {
+	switch op {
+	case "not":
+		return !truthy(v), nil
+	case "-":
+		n, ok := toNumber(v)
+		if !ok {
+			return nil, s.runtimeError(line, "attempt to perform arithmetic on a %s value", typeName(v))
+		}
+		return -n, nil
+	case "#":
+		switch v := v.(type) {
+		case string:
+			return float64(len(v)), nil
+		case *Table:
+			return float64(v.Len()), nil
+		}
+		return nil, s.runtimeError(line, "attempt to get length of a %s value", typeName(v))
+	}
+	return nil, s.runtimeError(line, "unknown operator %s", op)
+}
+
+func (s *State) binary(e *binExpr, env *scope) (Value, error) {
+	l, err := s.eval(e.l, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit operators return one of their operands
+	switch e.op {
+	case "and":
+		if !truthy(l) {
+			return l, nil
+		}
+		return s.eval(e.r, env)
+	case "or":
+		if truthy(l) {
+			return l, nil
+		}
+		return s.eval(e.r, env)
+	}
+
+	r, err := s.eval(e.r, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return equal(l, r), nil
+	case "~=":
+		return !equal(l, r), nil
+	case "..":
+		ls, lok := concatOperand(l)
+		rs, rok := concatOperand(r)
+		if !lok || !rok {
+			bad := l
+			if lok {
+				bad = r
+			}
+			return nil, s.runtimeError(e.line, "attempt to concatenate a %s value", typeName(bad))
+		}
+		return ls + rs, nil
+	case "<", "<=", ">", ">=":
+		return s.compare(e.op, l, r, e.line)
+	}
+
+	a, aok := toNumber(l)
+	b, bok := toNumber(r)
+	if !aok || !bok {
+		bad := l
+		if aok {
+			bad = r
+		}
+		return nil, s.runtimeError(e.line, "attempt to perform arithmetic on a %s value", typeName(bad))
+	}
+
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		return a / b, nil
+	case "%":
+		return a - math.Floor(a/b)*b, nil
+	case "^":
+		return math.Pow(a, b), nil
+	}
+	return nil, s.runtimeError(e.line, "unknown operator %s", e.op)
+}
+
+// concatOperand converts a string or number for concatenation
+func concatOperand(v Value) (string, bool) {
+	switch v.(type) {
+	case string, float64:
+		return toString(v), true
+	}
+	return "", false
+}
+
+func (s *State) compare(op string, l, r Value, line int) (Value, error) {
+	var less, eq bool
+	switch l := l.(type) {
+	case float64:
+		rn, ok := r.(float64)
+		if !ok {
+			return nil, s.runtimeError(line, "attempt to compare number with %s", typeName(r))
+		}
+		less, eq = l < rn, l == rn
+	case string:
+		rs, ok := r.(string)
+		if !ok {
+			return nil, s.runtimeError(line, "attempt to compare string with %s", typeName(r))
+		}
+		less, eq = strings.Compare(l, rs) < 0, l == rs
+	default:
+		return nil, s.runtimeError(line, "attempt to compare two %s values", typeName(l))
+	}
+
+	switch op {
+	case "<":
+		return less, nil
+	case "<=":
+		return less || eq, nil
+	case ">":
+		return !less && !eq, nil
+	default:
+		return !less, nil
+	}
+}
@@ -0,0 +1,191 @@
+package script
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind identifies the kind of a lexical token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokNumber
+	tokString
+	tokKeyword
+	tokSymbol
+)
+
+// token is a lexical token
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	line int
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "if": true,
+	"in": true, "local": true, "nil": true, "not": true, "or": true,
+	"return": true, "then": true, "true": true, "while": true,
+}
+
+// symbols lists multi-character symbols before their prefixes
+var symbols = []string{
+	"...", "..", "==", "~=", "<=", ">=",
+	"+", "-", "*", "/", "%", "^", "#", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+// lex splits source into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	i := 0
+
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			// Long comments --[[ ... ]] or line comments
+			if strings.HasPrefix(src[i:], "--[[") {
+				end := strings.Index(src[i:], "]]")
+				if end < 0 {
+					return nil, fmt.Errorf("line %d: unterminated comment", line)
+				}
+				line += strings.Count(src[i:i+end], "\n")
+				i += end + 2
+			} else {
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			}
+		case isLetter(c):
+			start := i
+			for i < len(src) && (isLetter(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			word := src[start:i]
+			kind := tokName
+			if keywords[word] {
+				kind = tokKeyword
+			}
+			tokens = append(tokens, token{kind: kind, text: word, line: line})
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+				i += 2
+				for i < len(src) && strings.IndexByte("0123456789abcdefABCDEF", src[i]) >= 0 {
+					i++
+				}
+				n, err := strconv.ParseInt(src[start+2:i], 16, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid number %q", line, src[start:i])
+				}
+				tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: float64(n), line: line})
+				continue
+			}
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %q", line, src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: n, line: line})
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:], line)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: s, line: line})
+			i += n
+		case strings.HasPrefix(src[i:], "[["):
+			end := strings.Index(src[i+2:], "]]")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated long string", line)
+			}
+			s := strings.TrimPrefix(src[i+2:i+2+end], "\n")
+			tokens = append(tokens, token{kind: tokString, text: s, line: line})
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		default:
+			matched := false
+			for _, sym := range symbols {
+				if strings.HasPrefix(src[i:], sym) {
+					tokens = append(tokens, token{kind: tokSymbol, text: sym, line: line})
+					i += len(sym)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, line: line})
+	return tokens, nil
+}
+
+// lexString reads a quoted string, returning its value and the number of
+// bytes consumed
+func lexString(src string, line int) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	i := 1
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("line %d: unterminated string", line)
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\\', '"', '\'':
+				b.WriteByte(src[i])
+			default:
+				return "", 0, fmt.Errorf("line %d: invalid escape \\%c", line, src[i])
+			}
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("line %d: unterminated string", line)
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,690 @@
+package script
+
+import (
+	"fmt"
+)
+
+// Syntax tree
+
+type expr interface{}
+
+type constExpr struct{ value Value }
+
+type nameExpr struct{ name string }
+
+type indexExpr struct {
+	obj, key expr
+	line     int
+}
+
+type callExpr struct {
+	fn   expr
+	args []expr
+	line int
+}
+
+type methodCallExpr struct {
+	obj  expr
+	name string
+	args []expr
+	line int
+}
+
+type funcExpr struct {
+	name   string
+	params []string
+	body   *block
+}
+
+type tableItem struct {
+	key   expr // nil for positional items
+	value expr
+}
+
+type tableExpr struct{ items []tableItem }
+
+type binExpr struct {
+	op   string
+	l, r expr
+	line int
+}
+
+type unExpr struct {
+	op   string
+	e    expr
+	line int
+}
+
+type stmt interface{}
+
+type block struct{ stmts []stmt }
+
+type localStmt struct {
+	names []string
+	exprs []expr
+}
+
+type assignStmt struct {
+	targets []expr
+	exprs   []expr
+	line    int
+}
+
+type callStmt struct{ call expr }
+
+type ifStmt struct {
+	conds     []expr
+	blocks    []*block
+	elseBlock *block
+}
+
+type whileStmt struct {
+	cond expr
+	body *block
+}
+
+type numForStmt struct {
+	name               string
+	start, limit, step expr
+	body               *block
+	line               int
+}
+
+type genForStmt struct {
+	names []string
+	iter  expr
+	body  *block
+	line  int
+}
+
+type doStmt struct{ body *block }
+
+type breakStmt struct{}
+
+type returnStmt struct{ value expr }
+
+type localFuncStmt struct {
+	name string
+	fn   *funcExpr
+}
+
+// Parser
+
+// parser is a recursive-descent parser producing a syntax tree
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// binaryPriority holds the left and right binding power of binary operators.
+// Right-associative operators bind less tightly on the right.
+var binaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"..": {5, 4},
+	"+":  {6, 6}, "-": {6, 6},
+	"*": {7, 7}, "/": {7, 7}, "%": {7, 7},
+	"^": {10, 9},
+}
+
+// unaryPriority is the binding power of unary operators
+const unaryPriority = 8
+
+// parse parses a chunk of source into a block
+func parse(src string) (*block, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return body, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the given keyword or symbol
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokKeyword || t.kind == tokSymbol) && t.text == text
+}
+
+// accept consumes the next token if it is the given keyword or symbol
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q", text)
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	if t.kind != tokName {
+		return "", p.errorf("expected name")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	near := t.text
+	if t.kind == tokEOF {
+		near = "<eof>"
+	}
+	return fmt.Errorf("line %d: %s near %q", t.line, fmt.Sprintf(format, args...), near)
+}
+
+// blockEnd reports whether the next token ends a block
+func (p *parser) blockEnd() bool {
+	return p.peek().kind == tokEOF || p.is("end") || p.is("else") || p.is("elseif")
+}
+
+func (p *parser) block() (*block, error) {
+	b := &block{}
+	for !p.blockEnd() {
+		if p.accept(";") {
+			continue
+		}
+		if p.accept("return") {
+			ret := &returnStmt{}
+			if !p.blockEnd() && !p.is(";") {
+				value, err := p.expr(0)
+				if err != nil {
+					return nil, err
+				}
+				ret.value = value
+			}
+			p.accept(";")
+			b.stmts = append(b.stmts, ret)
+			if !p.blockEnd() {
+				return nil, p.errorf("'return' must be the last statement in a block")
+			}
+			break
+		}
+
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		b.stmts = append(b.stmts, s)
+	}
+	return b, nil
+}
+
+func (p *parser) statement() (stmt, error) {
+	line := p.peek().line
+
+	switch {
+	case p.accept("break"):
+		return &breakStmt{}, nil
+	case p.accept("do"):
+		body, err := p.blockUntil("end")
+		return &doStmt{body: body}, err
+	case p.accept("while"):
+		cond, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		body, err := p.blockUntil("end")
+		return &whileStmt{cond: cond, body: body}, err
+	case p.accept("if"):
+		return p.ifStatement()
+	case p.accept("for"):
+		return p.forStatement(line)
+	case p.accept("function"):
+		return p.functionStatement(line)
+	case p.accept("local"):
+		if p.accept("function") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			fn, err := p.funcBody(name)
+			return &localFuncStmt{name: name, fn: fn}, err
+		}
+		return p.localStatement()
+	}
+
+	// Assignment or function call
+	e, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is("=") || p.is(",") {
+		targets := []expr{e}
+		for p.accept(",") {
+			target, err := p.suffixedExpr()
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+		for _, target := range targets {
+			switch target.(type) {
+			case *nameExpr, *indexExpr:
+			default:
+				return nil, p.errorf("cannot assign to expression")
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		exprs, err := p.exprList()
+		return &assignStmt{targets: targets, exprs: exprs, line: line}, err
+	}
+
+	switch e.(type) {
+	case *callExpr, *methodCallExpr:
+		return &callStmt{call: e}, nil
+	}
+	return nil, p.errorf("syntax error")
+}
+
+// blockUntil parses a block followed by the given keyword
+func (p *parser) blockUntil(end string) (*block, error) {
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return body, p.expect(end)
+}
+
+func (p *parser) ifStatement() (stmt, error) {
+	s := &ifStmt{}
+	for {
+		cond, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.conds = append(s.conds, cond)
+		s.blocks = append(s.blocks, body)
+
+		if p.accept("elseif") {
+			continue
+		}
+		if p.accept("else") {
+			if s.elseBlock, err = p.block(); err != nil {
+				return nil, err
+			}
+		}
+		return s, p.expect("end")
+	}
+}
+
+func (p *parser) forStatement(line int) (stmt, error) {
+	first, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("=") {
+		s := &numForStmt{name: first, line: line}
+		if s.start, err = p.expr(0); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if s.limit, err = p.expr(0); err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			if s.step, err = p.expr(0); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		s.body, err = p.blockUntil("end")
+		return s, err
+	}
+
+	s := &genForStmt{names: []string{first}, line: line}
+	for p.accept(",") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+	}
+	if len(s.names) > 2 {
+		return nil, p.errorf("generic for supports at most two variables")
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if s.iter, err = p.expr(0); err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	s.body, err = p.blockUntil("end")
+	return s, err
+}
+
+// functionStatement parses function a.b.c() ... end and function a:m() ... end
+func (p *parser) functionStatement(line int) (stmt, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	var target expr = &nameExpr{name: name}
+	fullName := name
+	isMethod := false
+	for p.is(".") || p.is(":") {
+		isMethod = p.is(":")
+		p.next()
+		field, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		target = &indexExpr{obj: target, key: &constExpr{value: field}, line: line}
+		fullName += "." + field
+		if isMethod {
+			break
+		}
+	}
+
+	fn, err := p.funcBody(fullName)
+	if err != nil {
+		return nil, err
+	}
+	if isMethod {
+		fn.params = append([]string{"self"}, fn.params...)
+	}
+	return &assignStmt{targets: []expr{target}, exprs: []expr{fn}, line: line}, nil
+}
+
+func (p *parser) localStatement() (stmt, error) {
+	s := &localStmt{}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if p.accept("=") {
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		s.exprs = exprs
+	}
+	return s, nil
+}
+
+// funcBody parses (params) block end
+func (p *parser) funcBody(name string) (*funcExpr, error) {
+	fn := &funcExpr{name: name}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if !p.is(")") {
+		for {
+			param, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			fn.params = append(fn.params, param)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.blockUntil("end")
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body
+	return fn, nil
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	var exprs []expr
+	for {
+		e, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.accept(",") {
+			return exprs, nil
+		}
+	}
+}
+
+// expr parses an expression whose operators bind more tightly than limit
+func (p *parser) expr(limit int) (expr, error) {
+	var e expr
+	var err error
+
+	line := p.peek().line
+	if p.is("not") || p.is("-") || p.is("#") {
+		op := p.next().text
+		operand, err := p.expr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		e = &unExpr{op: op, e: operand, line: line}
+	} else if e, err = p.simpleExpr(); err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != tokSymbol && t.kind != tokKeyword {
+			return e, nil
+		}
+		priority, ok := binaryPriority[t.text]
+		if !ok || priority[0] <= limit {
+			return e, nil
+		}
+		p.next()
+		r, err := p.expr(priority[1])
+		if err != nil {
+			return nil, err
+		}
+		e = &binExpr{op: t.text, l: e, r: r, line: t.line}
+	}
+}
+
+func (p *parser) simpleExpr() (expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokNumber:
+		p.next()
+		return &constExpr{value: t.num}, nil
+	case t.kind == tokString:
+		p.next()
+		return &constExpr{value: t.text}, nil
+	case p.accept("nil"):
+		return &constExpr{value: nil}, nil
+	case p.accept("true"):
+		return &constExpr{value: true}, nil
+	case p.accept("false"):
+		return &constExpr{value: false}, nil
+	case p.accept("function"):
+		return p.funcBody("anonymous")
+	case p.is("{"):
+		return p.tableConstructor()
+	default:
+		return p.suffixedExpr()
+	}
+}
+
+// primaryExpr parses a name or a parenthesized expression
+func (p *parser) primaryExpr() (expr, error) {
+	if p.accept("(") {
+		e, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	return &nameExpr{name: name}, nil
+}
+
+// suffixedExpr parses a primary expression followed by field accesses,
+// indexing and calls
+func (p *parser) suffixedExpr() (expr, error) {
+	e, err := p.primaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		line := p.peek().line
+		switch {
+		case p.accept("."):
+			field, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: &constExpr{value: field}, line: line}
+		case p.accept("["):
+			key, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{obj: e, key: key, line: line}
+		case p.accept(":"):
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &methodCallExpr{obj: e, name: name, args: args, line: line}
+		case p.is("(") || p.is("{") || p.peek().kind == tokString:
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = &callExpr{fn: e, args: args, line: line}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// callArgs parses (args), a table constructor or a string literal
+func (p *parser) callArgs() ([]expr, error) {
+	if t := p.peek(); t.kind == tokString {
+		p.next()
+		return []expr{&constExpr{value: t.text}}, nil
+	}
+	if p.is("{") {
+		table, err := p.tableConstructor()
+		return []expr{table}, err
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if p.accept(")") {
+		return nil, nil
+	}
+	args, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	return args, p.expect(")")
+}
+
+func (p *parser) tableConstructor() (expr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	table := &tableExpr{}
+	for !p.is("}") {
+		var item tableItem
+		switch {
+		case p.accept("["):
+			key, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			item.key = key
+		case p.peek().kind == tokName && p.tokens[p.pos+1].kind == tokSymbol && p.tokens[p.pos+1].text == "=":
+			item.key = &constExpr{value: p.next().text}
+			p.next()
+		}
+
+		value, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		item.value = value
+		table.items = append(table.items, item)
+
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	return table, p.expect("}")
+}
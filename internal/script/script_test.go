@@ -0,0 +1,174 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func run(t *testing.T, src string) Value {
+	t.Helper()
+	v, err := NewState("test", Options{}).DoString(context.Background(), src)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return v
+}
+
+func TestEvaluation(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected Value
+	}{
+		{"return 1 + 2 * 3", 7.0},
+		{"return (1 + 2) * 3", 9.0},
+		{"return 2 ^ 3 ^ 2", 512.0},
+		{"return -2 ^ 2", -4.0},
+		{"return 7 % 3", 1.0},
+		{"return -7 % 3", 2.0},
+		{"return 'a' .. 'b' .. 1", "ab1"},
+		{"return 1 < 2 and 'yes' or 'no'", "yes"},
+		{"return nil or false", false},
+		{"return not nil", true},
+		{"return #'hello'", 5.0},
+		{"return #{1, 2, 3}", 3.0},
+		{"return 1 == 1.0", true},
+		{"return 'a' ~= 'b'", true},
+		{"return 0x10", 16.0},
+		{"local t = {x = 1, ['y'] = 2, 3}; return t.x + t.y + t[1]", 6.0},
+		{"local s = 0; for i = 1, 10 do s = s + i end; return s", 55.0},
+		{"local s = 0; for i = 10, 1, -2 do s = s + i end; return s", 30.0},
+		{"local i = 0; while true do i = i + 1; if i >= 5 then break end end; return i", 5.0},
+		{"local n = 0; for k, v in pairs({a = 1, b = 2, 3}) do n = n + v end; return n", 6.0},
+		{"local s = ''; for i, v in ipairs({'a', 'b', 'c'}) do s = s .. i .. v end; return s", "1a2b3c"},
+		{"local function fact(n) if n <= 1 then return 1 end return n * fact(n - 1) end; return fact(5)", 120.0},
+		{"function counter() local c = 0; return function() c = c + 1; return c end end; local f = counter(); f(); return f()", 2.0},
+		{"local obj = {n = 2}; function obj:double() return self.n * 2 end; return obj:double()", 4.0},
+		{"x = 5; return x", 5.0},
+		{"if false then return 1 elseif nil then return 2 else return 3 end", 3.0},
+		{"return ('abc'):upper()", "ABC"},
+		{"return string.format('%d%% at %.1f %s', 42, 21.55, 'C')", "42% at 21.6 C"},
+		{"return string.sub('hello', 2, -2)", "ell"},
+		{"return math.max(1, 5, 3) + math.floor(2.7)", 7.0},
+		{"local t = {}; table.insert(t, 'a'); table.insert(t, 'b'); return table.concat(t, ',')", "a,b"},
+		{"return tostring(1.5) .. tostring(nil) .. type({})", "1.5niltable"},
+		{"return tonumber('12') + 1", 13.0},
+		{"--[[ block\ncomment ]] return [[long\nstring]] -- trailing", "long\nstring"},
+	}
+
+	for _, test := range tests {
+		if got := run(t, test.src); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.src, test.expected, got)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	for _, src := range []string{
+		"return 1 +",
+		"if x then",
+		"local = 1",
+		"x + 1",
+		"'unterminated",
+		"return 1 return 2",
+		"for a, b, c in pairs(t) do end",
+	} {
+		if _, err := NewState("test", Options{}).DoString(context.Background(), src); err == nil {
+			t.Errorf("%q: expected syntax error", src)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		message string
+	}{
+		{"return nil + 1", "arithmetic on a nil value"},
+		{"local t = nil; return t.x", "attempt to index a nil value"},
+		{"undefined()", "attempt to call a nil value"},
+		{"error('custom failure')", "custom failure"},
+		{"return {} < {}", "compare two table values"},
+		{"local t = {}; t[nil] = 1", "invalid table key"},
+		{"\n\nreturn 'a' .. {}", "test:3:"},
+	}
+
+	for _, test := range tests {
+		_, err := NewState("test", Options{}).DoString(context.Background(), test.src)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected error containing %q, got %v", test.src, test.message, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	_, err := NewState("test", Options{MaxSteps: 1000}).DoString(context.Background(), "while true do end")
+	if !errors.Is(err, ErrStepLimit) {
+		t.Errorf("Expected step limit error, got %v", err)
+	}
+
+	_, err = NewState("test", Options{}).DoString(context.Background(), "local function f() return f() end; f()")
+	if !errors.Is(err, ErrDepthLimit) {
+		t.Errorf("Expected depth limit error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	time.Sleep(20 * time.Millisecond)
+	_, err = NewState("test", Options{MaxSteps: 1 << 30}).DoString(ctx, "while true do end")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context error, got %v", err)
+	}
+}
+
+func TestHostInterop(t *testing.T) {
+	state := NewState("test", Options{})
+
+	var printed []string
+	state.SetPrint(func(message string) { printed = append(printed, message) })
+
+	var received interface{}
+	state.SetGlobal("send", GoFunction(func(args []Value) (Value, error) {
+		received = FromValue(arg(args, 0))
+		return true, nil
+	}))
+
+	input, err := ToValue(struct {
+		IsOn bool    `json:"is_on"`
+		Temp float32 `json:"temp"`
+	}{IsOn: true, Temp: 21.5})
+	if err != nil {
+		t.Fatalf("ToValue failed: %v", err)
+	}
+	state.SetGlobal("state", input)
+
+	_, err = state.DoString(context.Background(), `
+		function on_event(e)
+			print("event", e.name, state.temp)
+			return send({name = e.name, list = {1, 2}})
+		end
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	event := NewTable()
+	event.Set("name", "connected")
+	result, err := state.Call(context.Background(), state.Global("on_event"), event)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	if result != true {
+		t.Errorf("Expected true, got %v", result)
+	}
+	if len(printed) != 1 || printed[0] != "event\tconnected\t21.5" {
+		t.Errorf("Unexpected output: %q", printed)
+	}
+	m, ok := received.(map[string]interface{})
+	if !ok || m["name"] != "connected" || len(m["list"].([]interface{})) != 2 {
+		t.Errorf("Unexpected value received by host: %#v", received)
+	}
+}
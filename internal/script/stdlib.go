@@ -0,0 +1,315 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// openStdlib installs the safe subset of the standard library
+func (s *State) openStdlib() {
+	s.SetGlobal("print", GoFunction(func(args []Value) (Value, error) {
+		// Hosts replace print to route output to their log
+		return nil, nil
+	}))
+	s.SetGlobal("type", GoFunction(func(args []Value) (Value, error) {
+		return typeName(arg(args, 0)), nil
+	}))
+	s.SetGlobal("tostring", GoFunction(func(args []Value) (Value, error) {
+		return toString(arg(args, 0)), nil
+	}))
+	s.SetGlobal("tonumber", GoFunction(func(args []Value) (Value, error) {
+		if n, ok := toNumber(arg(args, 0)); ok {
+			return n, nil
+		}
+		return nil, nil
+	}))
+	s.SetGlobal("error", GoFunction(func(args []Value) (Value, error) {
+		return nil, &Error{Script: s.name, Message: toString(arg(args, 0))}
+	}))
+	s.SetGlobal("assert", GoFunction(func(args []Value) (Value, error) {
+		if !truthy(arg(args, 0)) {
+			message := "assertion failed"
+			if len(args) > 1 {
+				message = toString(args[1])
+			}
+			return nil, &Error{Script: s.name, Message: message}
+		}
+		return arg(args, 0), nil
+	}))
+	s.SetGlobal("pairs", GoFunction(func(args []Value) (Value, error) {
+		t, err := tableArg(args, 0, "pairs")
+		if err != nil {
+			return nil, err
+		}
+		return &iterator{table: t, keys: t.keys()}, nil
+	}))
+	s.SetGlobal("ipairs", GoFunction(func(args []Value) (Value, error) {
+		t, err := tableArg(args, 0, "ipairs")
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]Value, t.Len())
+		for i := range keys {
+			keys[i] = float64(i + 1)
+		}
+		return &iterator{table: t, keys: keys}, nil
+	}))
+
+	s.SetGlobal("math", mathLib())
+	s.SetGlobal("string", stringLib())
+	s.SetGlobal("table", tableLib())
+}
+
+// SetPrint routes the script's print function to fn
+func (s *State) SetPrint(fn func(message string)) {
+	s.SetGlobal("print", GoFunction(func(args []Value) (Value, error) {
+		parts := make([]string, len(args))
+		for i, a := range args {
+			parts[i] = toString(a)
+		}
+		fn(strings.Join(parts, "\t"))
+		return nil, nil
+	}))
+}
+
+// arg returns the i'th argument, or nil
+func arg(args []Value, i int) Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// NumberArg returns the i'th argument as a number
+func NumberArg(args []Value, i int, fn string) (float64, error) {
+	n, ok := toNumber(arg(args, i))
+	if !ok {
+		return 0, fmt.Errorf("bad argument #%d to '%s' (number expected, got %s)", i+1, fn, typeName(arg(args, i)))
+	}
+	return n, nil
+}
+
+// StringArg returns the i'th argument as a string; numbers are converted
+func StringArg(args []Value, i int, fn string) (string, error) {
+	switch v := arg(args, i).(type) {
+	case string:
+		return v, nil
+	case float64:
+		return toString(v), nil
+	}
+	return "", fmt.Errorf("bad argument #%d to '%s' (string expected, got %s)", i+1, fn, typeName(arg(args, i)))
+}
+
+// BoolArg returns the truthiness of the i'th argument
+func BoolArg(args []Value, i int) bool {
+	return truthy(arg(args, i))
+}
+
+func tableArg(args []Value, i int, fn string) (*Table, error) {
+	t, ok := arg(args, i).(*Table)
+	if !ok {
+		return nil, fmt.Errorf("bad argument #%d to '%s' (table expected, got %s)", i+1, fn, typeName(arg(args, i)))
+	}
+	return t, nil
+}
+
+// numberFunc wraps a one-argument math function
+func numberFunc(name string, f func(float64) float64) GoFunction {
+	return func(args []Value) (Value, error) {
+		n, err := NumberArg(args, 0, name)
+		if err != nil {
+			return nil, err
+		}
+		return f(n), nil
+	}
+}
+
+func mathLib() *Table {
+	lib := NewTable()
+	lib.Set("huge", math.Inf(1))
+	lib.Set("pi", math.Pi)
+	lib.Set("floor", numberFunc("floor", math.Floor))
+	lib.Set("ceil", numberFunc("ceil", math.Ceil))
+	lib.Set("abs", numberFunc("abs", math.Abs))
+	lib.Set("sqrt", numberFunc("sqrt", math.Sqrt))
+	lib.Set("min", GoFunction(func(args []Value) (Value, error) {
+		return foldNumbers(args, "min", math.Min)
+	}))
+	lib.Set("max", GoFunction(func(args []Value) (Value, error) {
+		return foldNumbers(args, "max", math.Max)
+	}))
+	return lib
+}
+
+// foldNumbers reduces one or more number arguments with f
+func foldNumbers(args []Value, name string, f func(a, b float64) float64) (Value, error) {
+	result, err := NumberArg(args, 0, name)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i++ {
+		n, err := NumberArg(args, i, name)
+		if err != nil {
+			return nil, err
+		}
+		result = f(result, n)
+	}
+	return result, nil
+}
+
+func stringLib() *Table {
+	lib := NewTable()
+	lib.Set("len", GoFunction(func(args []Value) (Value, error) {
+		str, err := StringArg(args, 0, "len")
+		return float64(len(str)), err
+	}))
+	lib.Set("upper", GoFunction(func(args []Value) (Value, error) {
+		str, err := StringArg(args, 0, "upper")
+		return strings.ToUpper(str), err
+	}))
+	lib.Set("lower", GoFunction(func(args []Value) (Value, error) {
+		str, err := StringArg(args, 0, "lower")
+		return strings.ToLower(str), err
+	}))
+	lib.Set("sub", GoFunction(func(args []Value) (Value, error) {
+		str, err := StringArg(args, 0, "sub")
+		if err != nil {
+			return nil, err
+		}
+		start, end := 1.0, -1.0
+		if len(args) > 1 {
+			if start, err = NumberArg(args, 1, "sub"); err != nil {
+				return nil, err
+			}
+		}
+		if len(args) > 2 {
+			if end, err = NumberArg(args, 2, "sub"); err != nil {
+				return nil, err
+			}
+		}
+		return substring(str, int(start), int(end)), nil
+	}))
+	lib.Set("find", GoFunction(func(args []Value) (Value, error) {
+		// Plain substring search; patterns are not supported
+		str, err := StringArg(args, 0, "find")
+		if err != nil {
+			return nil, err
+		}
+		needle, err := StringArg(args, 1, "find")
+		if err != nil {
+			return nil, err
+		}
+		if i := strings.Index(str, needle); i >= 0 {
+			return float64(i + 1), nil
+		}
+		return nil, nil
+	}))
+	lib.Set("format", GoFunction(func(args []Value) (Value, error) {
+		format, err := StringArg(args, 0, "format")
+		if err != nil {
+			return nil, err
+		}
+		return formatString(format, args[1:])
+	}))
+	return lib
+}
+
+// substring implements string.sub's 1-based, inclusive, negative-from-end
+// indexing
+func substring(str string, start, end int) string {
+	n := len(str)
+	if start < 0 {
+		start = n + start + 1
+	}
+	if end < 0 {
+		end = n + end + 1
+	}
+	if start < 1 {
+		start = 1
+	}
+	if end > n {
+		end = n
+	}
+	if start > end {
+		return ""
+	}
+	return str[start-1 : end]
+}
+
+var formatVerb = regexp.MustCompile(`%[-+ #0]*[0-9]*(?:\.[0-9]+)?[dfgisxq%]`)
+
+// formatString implements string.format for the common verbs
+func formatString(format string, args []Value) (string, error) {
+	var err error
+	i := 0
+	result := formatVerb.ReplaceAllStringFunc(format, func(verb string) string {
+		if verb == "%%" {
+			return "%"
+		}
+		if err != nil {
+			return ""
+		}
+		if i >= len(args) {
+			err = fmt.Errorf("bad argument #%d to 'format' (no value)", i+2)
+			return ""
+		}
+		a := args[i]
+		i++
+
+		switch verb[len(verb)-1] {
+		case 'd', 'i', 'x':
+			n, ok := toNumber(a)
+			if !ok {
+				err = fmt.Errorf("bad argument #%d to 'format' (number expected, got %s)", i+1, typeName(a))
+				return ""
+			}
+			return fmt.Sprintf(strings.Replace(verb, "i", "d", 1), int64(n))
+		case 'f', 'g':
+			n, ok := toNumber(a)
+			if !ok {
+				err = fmt.Errorf("bad argument #%d to 'format' (number expected, got %s)", i+1, typeName(a))
+				return ""
+			}
+			return fmt.Sprintf(verb, n)
+		default:
+			return fmt.Sprintf(verb, toString(a))
+		}
+	})
+	return result, err
+}
+
+func tableLib() *Table {
+	lib := NewTable()
+	lib.Set("insert", GoFunction(func(args []Value) (Value, error) {
+		t, err := tableArg(args, 0, "insert")
+		if err != nil {
+			return nil, err
+		}
+		t.Set(float64(t.Len()+1), arg(args, 1))
+		return nil, nil
+	}))
+	lib.Set("concat", GoFunction(func(args []Value) (Value, error) {
+		t, err := tableArg(args, 0, "concat")
+		if err != nil {
+			return nil, err
+		}
+		sep := ""
+		if len(args) > 1 {
+			if sep, err = StringArg(args, 1, "concat"); err != nil {
+				return nil, err
+			}
+		}
+		parts := make([]string, t.Len())
+		for i := range parts {
+			part, ok := concatOperand(t.Get(float64(i + 1)))
+			if !ok {
+				return nil, fmt.Errorf("invalid value at index %d in table for 'concat'", i+1)
+			}
+			parts[i] = part
+		}
+		return strings.Join(parts, sep), nil
+	}))
+	return lib
+}
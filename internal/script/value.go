@@ -0,0 +1,275 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Value is a script value: nil, bool, float64, string, *Table, *Function or
+// GoFunction
+type Value interface{}
+
+// GoFunction is a host function callable from scripts
+type GoFunction func(args []Value) (Value, error)
+
+// Function is a function defined in a script
+type Function struct {
+	name   string
+	params []string
+	body   *block
+	env    *scope
+}
+
+// Table is a script table. Keys are float64, string or bool values.
+type Table struct {
+	fields map[Value]Value
+}
+
+// NewTable creates an empty table
+func NewTable() *Table {
+	return &Table{fields: make(map[Value]Value)}
+}
+
+// Get returns the value stored under key, or nil
+func (t *Table) Get(key Value) Value {
+	key = normalizeKey(key)
+	if !validKey(key) {
+		return nil
+	}
+	return t.fields[key]
+}
+
+// Set stores a value under key; storing nil removes the key. Invalid keys
+// (nil, NaN and host functions) are ignored; the interpreter rejects them
+// before calling Set.
+func (t *Table) Set(key, value Value) {
+	key = normalizeKey(key)
+	if !validKey(key) {
+		return
+	}
+	if value == nil {
+		delete(t.fields, key)
+		return
+	}
+	t.fields[key] = value
+}
+
+// Len returns the length of the table's array part: the number of
+// consecutive integer keys starting at 1
+func (t *Table) Len() int {
+	n := 0
+	for t.fields[float64(n+1)] != nil {
+		n++
+	}
+	return n
+}
+
+// keys returns the table's keys in a deterministic order: array keys first,
+// then other keys sorted by their string form
+func (t *Table) keys() []Value {
+	n := t.Len()
+	keys := make([]Value, 0, len(t.fields))
+	for i := 1; i <= n; i++ {
+		keys = append(keys, float64(i))
+	}
+
+	var rest []Value
+	for key := range t.fields {
+		if f, ok := key.(float64); ok && f >= 1 && f <= float64(n) && f == math.Trunc(f) {
+			continue
+		}
+		rest = append(rest, key)
+	}
+	sort.Slice(rest, func(i, j int) bool { return toString(rest[i]) < toString(rest[j]) })
+	return append(keys, rest...)
+}
+
+// validKey reports whether a value can be used as a table key
+func validKey(key Value) bool {
+	switch k := key.(type) {
+	case nil, GoFunction:
+		return false
+	case float64:
+		return !math.IsNaN(k)
+	default:
+		return true
+	}
+}
+
+// normalizeKey converts integer-valued keys of other numeric types to float64
+// so lookups are consistent
+func normalizeKey(key Value) Value {
+	switch k := key.(type) {
+	case int:
+		return float64(k)
+	case int64:
+		return float64(k)
+	}
+	return key
+}
+
+// typeName returns the script type name of a value
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Table:
+		return "table"
+	case *Function, GoFunction:
+		return "function"
+	default:
+		return "userdata"
+	}
+}
+
+// truthy reports whether a value counts as true: everything except nil and
+// false
+func truthy(v Value) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	default:
+		return true
+	}
+}
+
+// toString formats a value as the script's tostring would
+func toString(v Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'g', 14, 64)
+	case string:
+		return v
+	case *Table:
+		return fmt.Sprintf("table: %p", v)
+	case *Function:
+		return fmt.Sprintf("function: %p", v)
+	case GoFunction:
+		return "function: builtin"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toNumber converts a value to a number, accepting numeric strings
+func toNumber(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// equal compares values by value for primitives and by identity otherwise
+func equal(a, b Value) bool {
+	switch a := a.(type) {
+	case *Function:
+		b, ok := b.(*Function)
+		return ok && a == b
+	case GoFunction:
+		// Go functions aren't comparable; treat distinct builtins as unequal
+		return false
+	default:
+		return a == b
+	}
+}
+
+// ToValue converts a Go value to a script value. Structs, maps and slices are
+// converted through their JSON representation, so field names follow their
+// json tags.
+func ToValue(v interface{}) (Value, error) {
+	switch v := v.(type) {
+	case nil, bool, float64, string, *Table, *Function, GoFunction:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case func(args []Value) (Value, error):
+		return GoFunction(v), nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return fromGeneric(generic), nil
+}
+
+// fromGeneric converts decoded JSON to script values
+func fromGeneric(v interface{}) Value {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		t := NewTable()
+		for key, item := range v {
+			t.Set(key, fromGeneric(item))
+		}
+		return t
+	case []interface{}:
+		t := NewTable()
+		for i, item := range v {
+			t.Set(float64(i+1), fromGeneric(item))
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// FromValue converts a script value to plain Go data: tables with only array
+// keys become slices, other tables become maps keyed by string
+func FromValue(v Value) interface{} {
+	t, ok := v.(*Table)
+	if !ok {
+		switch v.(type) {
+		case *Function, GoFunction:
+			return nil
+		}
+		return v
+	}
+
+	n := t.Len()
+	if n > 0 && n == len(t.fields) {
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = FromValue(t.fields[float64(i+1)])
+		}
+		return items
+	}
+
+	m := make(map[string]interface{}, len(t.fields))
+	for key, item := range t.fields {
+		m[toString(key)] = FromValue(item)
+	}
+	return m
+}
@@ -0,0 +1,59 @@
+package tesla
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
+)
+
+// States of the Bluetooth adapter
+const (
+	AdapterUnknown = "unknown" // No scan has run yet
+	AdapterOK      = "ok"
+	AdapterError   = "error"
+)
+
+// AdapterStatus is what the latest BLE scan learned about the Bluetooth
+// adapter. The adapter is shared by every vehicle on BLE.
+type AdapterStatus struct {
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+var adapter struct {
+	sync.RWMutex
+	status AdapterStatus
+}
+
+// BLEAdapterStatus returns the state of the Bluetooth adapter. It is learnt
+// from scans rather than probed, so it is unknown until the first one.
+func BLEAdapterStatus() AdapterStatus {
+	adapter.RLock()
+	defer adapter.RUnlock()
+	if adapter.status.State == "" {
+		return AdapterStatus{State: AdapterUnknown}
+	}
+	return adapter.status
+}
+
+// recordScan updates the adapter state from a scan's outcome. Any failure
+// other than bringing up the adapter means it is working.
+func recordScan(err error) {
+	status := AdapterStatus{State: AdapterOK, UpdatedAt: time.Now()}
+	if err != nil && isAdapterError(err) {
+		status.State = AdapterError
+		status.Error = err.Error()
+	}
+	adapter.Lock()
+	defer adapter.Unlock()
+	adapter.status = status
+}
+
+// isAdapterError reports whether a scan failed because the adapter couldn't
+// be brought up
+func isAdapterError(err error) bool {
+	return ble.IsAdapterError(err) || strings.Contains(err.Error(), "failed to enable device")
+}
@@ -0,0 +1,31 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBLEAdapterStatus(t *testing.T) {
+	defer func() {
+		adapter.Lock()
+		adapter.status = AdapterStatus{}
+		adapter.Unlock()
+	}()
+
+	if status := BLEAdapterStatus(); status.State != AdapterUnknown {
+		t.Errorf("Expected unknown before a scan, got %+v", status)
+	}
+
+	recordScan(errors.New("ble: failed to enable device: can't init hci: no devices available"))
+	if status := BLEAdapterStatus(); status.State != AdapterError || status.Error == "" || status.UpdatedAt.IsZero() {
+		t.Errorf("Expected an adapter error, got %+v", status)
+	}
+
+	// Not finding the vehicle means the adapter scanned
+	recordScan(fmt.Errorf("ble: failed to scan for TEST_VIN: %w", context.DeadlineExceeded))
+	if status := BLEAdapterStatus(); status.State != AdapterOK || status.Error != "" {
+		t.Errorf("Expected the adapter ok, got %+v", status)
+	}
+}
@@ -0,0 +1,129 @@
+package tesla
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// minAPIKeyLength keeps configured keys from being guessable
+const minAPIKeyLength = 16
+
+// apiKeyRoles are the roles a key may carry, matching user account roles
+var apiKeyRoles = map[string]bool{"admin": true, "driver": true, "viewer": true}
+
+// APIKey grants access to the HTTP API without a user login. Keys are
+// compared in constant time; a key may be stored as "sha256:<hex digest>" so
+// the config file doesn't hold it in plain text.
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Role string `json:"role,omitempty"` // admin, driver or viewer; defaults to driver
+}
+
+// KeyRole returns the key's role, defaulting to driver
+func (k APIKey) KeyRole() string {
+	if k.Role == "" {
+		return "driver"
+	}
+	return k.Role
+}
+
+// Matches reports whether a presented key is this key
+func (k APIKey) Matches(presented string) bool {
+	if strings.HasPrefix(k.Key, "sha256:") {
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(k.Key)), []byte(HashAPIKey(presented))) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(k.Key), []byte(presented)) == 1
+}
+
+// Validate checks the key's name, length and role
+func (k APIKey) Validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if digest, ok := strings.CutPrefix(k.Key, "sha256:"); ok {
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("key %s: invalid sha256 digest", k.Name)
+		}
+	} else if len(k.Key) < minAPIKeyLength {
+		return fmt.Errorf("key %s must be at least %d characters", k.Name, minAPIKeyLength)
+	}
+	if !apiKeyRoles[k.KeyRole()] {
+		return fmt.Errorf("key %s: unknown role %q", k.Name, k.Role)
+	}
+	return nil
+}
+
+// FindAPIKey returns the key matching a presented key. Every key is compared
+// so the time taken doesn't reveal which one matched.
+func (c *Config) FindAPIKey(presented string) (APIKey, bool) {
+	var found APIKey
+	ok := false
+	for _, key := range c.APIKeys {
+		if key.Matches(presented) && !ok {
+			found, ok = key, true
+		}
+	}
+	return found, ok
+}
+
+// parseAPIKeys reads keys from comma-separated name=key or name:role=key
+// entries, as TESLA_API_KEYS holds them. A key may be a sha256: digest.
+func parseAPIKeys(value string) ([]APIKey, error) {
+	var keys []APIKey
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry, expected name=key or name:role=key")
+		}
+		name, role, _ := strings.Cut(name, ":")
+		keys = append(keys, APIKey{Name: strings.TrimSpace(name), Key: strings.TrimSpace(key), Role: strings.TrimSpace(role)})
+	}
+	if err := validateAPIKeys(keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GenerateAPIKey returns a new random key
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return "thk_" + hex.EncodeToString(buf), nil
+}
+
+// HashAPIKey returns the form of a key to store in the config file in place
+// of the key itself
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// validateAPIKeys checks every key and that names and keys are unique
+func validateAPIKeys(keys []APIKey) error {
+	names := make(map[string]bool, len(keys))
+	values := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := key.Validate(); err != nil {
+			return err
+		}
+		if names[key.Name] {
+			return fmt.Errorf("duplicate key name %s", key.Name)
+		}
+		if values[key.Key] {
+			return fmt.Errorf("key %s reuses another key", key.Name)
+		}
+		names[key.Name] = true
+		values[key.Key] = true
+	}
+	return nil
+}
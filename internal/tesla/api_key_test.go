@@ -0,0 +1,75 @@
+package tesla
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []APIKey
+		err  string
+	}{
+		{"valid", []APIKey{
+			{Name: "dashboard", Key: "0123456789abcdef", Role: "viewer"},
+			{Name: "automation", Key: HashAPIKey("secret")},
+		}, ""},
+		{"no name", []APIKey{{Key: "0123456789abcdef"}}, "name is required"},
+		{"short", []APIKey{{Name: "k", Key: "short"}}, "at least 16 characters"},
+		{"bad digest", []APIKey{{Name: "k", Key: "sha256:abc"}}, "invalid sha256 digest"},
+		{"bad role", []APIKey{{Name: "k", Key: "0123456789abcdef", Role: "owner"}}, `unknown role "owner"`},
+		{"duplicate name", []APIKey{
+			{Name: "k", Key: "0123456789abcdef"},
+			{Name: "k", Key: "fedcba9876543210"},
+		}, "duplicate key name k"},
+		{"duplicate key", []APIKey{
+			{Name: "a", Key: "0123456789abcdef"},
+			{Name: "b", Key: "0123456789abcdef"},
+		}, "reuses another key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPIKeys(tt.keys)
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestFindAPIKey(t *testing.T) {
+	config := DefaultConfig()
+	config.APIKeys = []APIKey{
+		{Name: "plain", Key: "0123456789abcdef"},
+		{Name: "hashed", Key: HashAPIKey("thk_generated"), Role: "viewer"},
+	}
+
+	if key, ok := config.FindAPIKey("0123456789abcdef"); !ok || key.Name != "plain" || key.KeyRole() != "driver" {
+		t.Errorf("Expected the plain key as driver, got %+v %v", key, ok)
+	}
+	if key, ok := config.FindAPIKey("thk_generated"); !ok || key.Name != "hashed" {
+		t.Errorf("Expected the hashed key, got %+v %v", key, ok)
+	}
+	if _, ok := config.FindAPIKey(HashAPIKey("thk_generated")); ok {
+		t.Error("The stored digest must not work as a key")
+	}
+	if _, ok := config.FindAPIKey("wrong"); ok {
+		t.Error("Expected no match for a wrong key")
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	a, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey failed: %v", err)
+	}
+	b, _ := GenerateAPIKey()
+	if a == b || len(a) < minAPIKeyLength {
+		t.Errorf("Expected distinct, long keys, got %q and %q", a, b)
+	}
+}
@@ -0,0 +1,163 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tracing"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// wakePollInterval is how often Wake checks whether the vehicle has woken
+const wakePollInterval = time.Second
+
+// ErrWakeTimeout is returned when the vehicle doesn't wake within
+// wake.max_wait
+var ErrWakeTimeout = errors.New("vehicle did not wake in time")
+
+// AwakeState is the vehicle's last observed sleep state
+type AwakeState string
+
+const (
+	AwakeUnknown AwakeState = "unknown"
+	Awake        AwakeState = "awake"
+	Asleep       AwakeState = "asleep"
+)
+
+// AwakeStatus is the last observation of the vehicle's sleep state
+type AwakeStatus struct {
+	State       AwakeState `json:"state"`
+	UserPresent bool       `json:"user_present"`
+	ObservedAt  time.Time  `json:"observed_at,omitempty"`
+}
+
+// AwakeStatus returns the last observed sleep state
+func (c *Client) AwakeStatus() AwakeStatus {
+	c.awakeMutex.RLock()
+	defer c.awakeMutex.RUnlock()
+
+	if c.awake.State == "" {
+		return AwakeStatus{State: AwakeUnknown}
+	}
+	return c.awake
+}
+
+// IsAwake reports whether the vehicle was observed awake within window. An
+// observation older than window isn't trusted, since the vehicle may have
+// gone to sleep since.
+func (c *Client) IsAwake(window time.Duration) bool {
+	status := c.AwakeStatus()
+	return status.State == Awake && time.Since(status.ObservedAt) <= window
+}
+
+// observeAwake records an observation of the vehicle's sleep state and
+// publishes EventAwakeChanged when the state changes
+func (c *Client) observeAwake(state AwakeState, userPresent bool) {
+	c.awakeMutex.Lock()
+	previous := c.awake.State
+	c.awake = AwakeStatus{State: state, UserPresent: userPresent, ObservedAt: time.Now()}
+	status := c.awake
+	c.awakeMutex.Unlock()
+
+	if previous != state {
+		c.events.Publish(Event{Type: EventAwakeChanged, VIN: c.vin, Data: status})
+	}
+}
+
+// markAwake records that the vehicle answered an infotainment request, which
+// it only does while awake
+func (c *Client) markAwake() {
+	c.observeAwake(Awake, c.AwakeStatus().UserPresent)
+}
+
+// SleepStatus asks the vehicle's security controller whether infotainment is
+// awake. The security controller answers over BLE without waking the
+// vehicle, so this is safe to poll.
+func (c *Client) SleepStatus(ctx context.Context) (AwakeStatus, error) {
+	if c.vehicle == nil {
+		return AwakeStatus{}, ErrNotConnected
+	}
+
+	probeCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+	defer cancel()
+
+	status, err := c.vehicle.BodyControllerState(probeCtx)
+	if err != nil {
+		return AwakeStatus{}, fmt.Errorf("failed to read sleep status: %w", err)
+	}
+
+	state := AwakeUnknown
+	switch status.GetVehicleSleepStatus() {
+	case vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_AWAKE:
+		state = Awake
+	case vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_ASLEEP:
+		state = Asleep
+	}
+	userPresent := status.GetUserPresence() == vcsec.UserPresence_E_VEHICLE_USER_PRESENCE_PRESENT
+
+	c.observeAwake(state, userPresent)
+	return c.AwakeStatus(), nil
+}
+
+// Wake sends the security controller's wake command and waits up to
+// wake.max_wait for infotainment to report awake
+func (c *Client) Wake(ctx context.Context) error {
+	if c.vehicle == nil {
+		return ErrNotConnected
+	}
+
+	maxWait := c.wakeSettings().MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultConfig().Wake.MaxWait
+	}
+	wakeCtx, cancel := context.WithTimeout(ctx, maxWait)
+	defer cancel()
+
+	c.logFor(ctx).Printf("Waking vehicle %s", c.vin)
+	if err := c.vehicle.Wakeup(wakeCtx); err != nil {
+		return fmt.Errorf("failed to send wake command: %w", err)
+	}
+
+	for {
+		if status, err := c.SleepStatus(wakeCtx); err == nil && status.State == Awake {
+			return nil
+		}
+		select {
+		case <-wakeCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: still asleep after %v", ErrWakeTimeout, maxWait)
+		case <-time.After(wakePollInterval):
+		}
+	}
+}
+
+// ensureAwake wakes the vehicle before an operation if wake.on_demand is set
+// and the vehicle isn't known to be awake. The sleep status check doesn't
+// wake the vehicle, so an awake vehicle costs one BLE round trip at most.
+func (c *Client) ensureAwake(ctx context.Context) error {
+	settings := c.wakeSettings()
+	if !settings.OnDemand || c.vehicle == nil || c.IsAwake(settings.AwakeWindow) {
+		return nil
+	}
+
+	c.wakeMutex.Lock()
+	defer c.wakeMutex.Unlock()
+
+	// Another operation may have woken the vehicle while this one waited
+	if c.IsAwake(settings.AwakeWindow) {
+		return nil
+	}
+	if status, err := c.SleepStatus(ctx); err == nil && status.State == Awake {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "tesla.wake", tracing.Attr("vehicle.vin", c.vin))
+	defer span.End()
+	err := c.Wake(ctx)
+	span.RecordError(err)
+	return err
+}
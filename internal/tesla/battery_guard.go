@@ -0,0 +1,161 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Battery guard actions
+const (
+	BatteryGuardWarn   = "warn"   // Start climate, with a warning
+	BatteryGuardRefuse = "refuse" // Skip the command
+)
+
+// Defaults for the range estimate unless the config sets them
+const (
+	DefaultClimatePowerKW     = 2.5 // Average draw of the climate system
+	DefaultConsumptionWhPerKm = 160 // Driving consumption
+)
+
+// BatteryGuardConfig warns about, or refuses, turning climate on with a low
+// battery. Client.SetClimateOn and every other climate-on command check it,
+// on top of any charge conditions the command has.
+type BatteryGuardConfig struct {
+	MinBatteryLevel    int     `json:"min_battery_level,omitempty"`     // Percent; 0 disables the guard
+	Action             string  `json:"action,omitempty"`                // warn or refuse; defaults to warn
+	ClimatePowerKW     float64 `json:"climate_power_kw,omitempty"`      // For the range estimate; defaults to 2.5
+	ConsumptionWhPerKm float64 `json:"consumption_wh_per_km,omitempty"` // For the range estimate; defaults to 160
+}
+
+// Enabled reports whether the guard checks the battery level
+func (g BatteryGuardConfig) Enabled() bool {
+	return g.MinBatteryLevel > 0
+}
+
+// Validate checks the config
+func (g BatteryGuardConfig) Validate() error {
+	if g.MinBatteryLevel < 0 || g.MinBatteryLevel > 100 {
+		return fmt.Errorf("min_battery_level must be between 0 and 100")
+	}
+	switch g.Action {
+	case "", BatteryGuardWarn, BatteryGuardRefuse:
+	default:
+		return fmt.Errorf("action must be %s or %s", BatteryGuardWarn, BatteryGuardRefuse)
+	}
+	if g.ClimatePowerKW < 0 || g.ConsumptionWhPerKm < 0 {
+		return fmt.Errorf("climate_power_kw and consumption_wh_per_km must not be negative")
+	}
+	return nil
+}
+
+// ClimateImpact predicts what running climate costs in range
+type ClimateImpact struct {
+	BatteryLevel       int     `json:"battery_level"` // Percent
+	RangeKm            float64 `json:"range_km,omitempty"`
+	RangeLossKmPerHour float64 `json:"range_loss_km_per_hour"`
+	RangeLossKm        float64 `json:"range_loss_km,omitempty"` // Over the requested duration
+	Warning            string  `json:"warning,omitempty"`       // Set when the guard lets a low battery through
+}
+
+// Impact estimates the range running climate for d costs, per hour without
+// a duration
+func (g BatteryGuardConfig) Impact(state *ChargeState, d time.Duration) ClimateImpact {
+	power, consumption := g.ClimatePowerKW, g.ConsumptionWhPerKm
+	if power == 0 {
+		power = DefaultClimatePowerKW
+	}
+	if consumption == 0 {
+		consumption = DefaultConsumptionWhPerKm
+	}
+	perHour := power * 1000 / consumption
+	impact := ClimateImpact{
+		BatteryLevel:       state.BatteryLevel,
+		RangeKm:            round1(state.RangeKm),
+		RangeLossKmPerHour: round1(perHour),
+	}
+	if d > 0 {
+		impact.RangeLossKm = round1(perHour * d.Hours())
+	}
+	return impact
+}
+
+// round1 rounds to one decimal place
+func round1(v float64) float64 {
+	return float64(int64(v*10+0.5)) / 10
+}
+
+// batteryGuardSettings returns the battery guard
+func (c *Client) batteryGuardSettings() BatteryGuardConfig {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+	return c.batteryGuard
+}
+
+// checkClimate reads the charge state when cond or the battery guard needs
+// it, or withImpact is set, and returns an error wrapping ErrClimateSkipped
+// if either blocks command. It returns the predicted impact of running
+// climate for d when the state was read. A state read only for the impact
+// may fail without failing the check.
+func (c *Client) checkClimate(ctx context.Context, command string, cond ClimateConditions, d time.Duration, withImpact bool) (*ClimateImpact, error) {
+	guard := c.batteryGuardSettings()
+	needed := !cond.IsZero() || guard.Enabled()
+	if !needed && !withImpact {
+		return nil, nil
+	}
+	if err := cond.Validate(); err != nil {
+		return nil, err
+	}
+
+	state, err := c.GetChargeState(ctx)
+	if err != nil && !needed {
+		c.logFor(ctx).Printf("Failed to read charge state for the climate range impact: %v", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check charge conditions: %w", err)
+	}
+	if err := c.gateClimate(command, cond, state); err != nil {
+		return nil, err
+	}
+	return c.guardClimate(ctx, command, guard, cond, state, d)
+}
+
+// guardClimate applies the battery guard to a charge state, reporting a
+// refusal as a skip, and returns the predicted impact of climate for d
+func (c *Client) guardClimate(ctx context.Context, command string, guard BatteryGuardConfig, cond ClimateConditions, state *ChargeState, d time.Duration) (*ClimateImpact, error) {
+	impact := guard.Impact(state, d)
+	if guard.Enabled() && state.BatteryLevel < guard.MinBatteryLevel {
+		reason := fmt.Sprintf("battery level %d%% is below the guard of %d%%", state.BatteryLevel, guard.MinBatteryLevel)
+		if guard.Action == BatteryGuardRefuse {
+			return nil, c.skipClimate(command, reason, cond, state)
+		}
+		c.logFor(ctx).Printf("warn: Starting climate on %s: %s", c.vin, reason)
+		impact.Warning = reason
+	}
+	return &impact, nil
+}
+
+// StartClimate turns climate on, for d unless it is zero, if the charge state
+// meets cond and the battery guard. It returns the predicted range impact.
+// An earlier auto-off timer is replaced, or cancelled without a duration.
+func (c *Client) StartClimate(ctx context.Context, cond ClimateConditions, d time.Duration) (*ClimateImpact, error) {
+	if d != 0 {
+		if err := validClimateDuration(d); err != nil {
+			return nil, err
+		}
+	}
+	impact, err := c.checkClimate(ctx, "set_climate_on", cond, d, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.setClimateOn(ctx); err != nil {
+		return nil, err
+	}
+	if d > 0 {
+		c.startClimateTimer(d)
+	} else {
+		c.CancelClimateTimer()
+	}
+	return impact, nil
+}
@@ -0,0 +1,72 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBatteryGuardValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		guard   BatteryGuardConfig
+		wantErr bool
+	}{
+		{"disabled", BatteryGuardConfig{}, false},
+		{"refuse", BatteryGuardConfig{MinBatteryLevel: 20, Action: BatteryGuardRefuse}, false},
+		{"level above 100", BatteryGuardConfig{MinBatteryLevel: 101}, true},
+		{"unknown action", BatteryGuardConfig{MinBatteryLevel: 20, Action: "block"}, true},
+		{"negative power", BatteryGuardConfig{ClimatePowerKW: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.guard.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBatteryGuardImpact(t *testing.T) {
+	state := &ChargeState{BatteryLevel: 50, RangeKm: 200.04}
+
+	impact := BatteryGuardConfig{}.Impact(state, 30*time.Minute)
+	if impact.RangeLossKmPerHour != 15.6 || impact.RangeLossKm != 7.8 || impact.RangeKm != 200 {
+		t.Errorf("Unexpected default impact %+v", impact)
+	}
+
+	impact = BatteryGuardConfig{ClimatePowerKW: 4, ConsumptionWhPerKm: 200}.Impact(state, 0)
+	if impact.RangeLossKmPerHour != 20 || impact.RangeLossKm != 0 || impact.BatteryLevel != 50 {
+		t.Errorf("Unexpected impact %+v", impact)
+	}
+}
+
+func TestGuardClimate(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx := context.Background()
+	low := &ChargeState{BatteryLevel: 15}
+
+	guard := BatteryGuardConfig{MinBatteryLevel: 20}
+	impact, err := client.guardClimate(ctx, "set_climate_on", guard, ClimateConditions{}, low, 0)
+	if err != nil || impact.Warning == "" {
+		t.Errorf("Expected a warning, got %+v, %v", impact, err)
+	}
+
+	guard.Action = BatteryGuardRefuse
+	if _, err := client.guardClimate(ctx, "set_climate_on", guard, ClimateConditions{}, low, 0); !errors.Is(err, ErrClimateSkipped) {
+		t.Errorf("Expected ErrClimateSkipped, got %v", err)
+	}
+
+	impact, err = client.guardClimate(ctx, "set_climate_on", guard, ClimateConditions{}, &ChargeState{BatteryLevel: 60}, 0)
+	if err != nil || impact.Warning != "" {
+		t.Errorf("Expected no warning above the guard, got %+v, %v", impact, err)
+	}
+}
+
+func TestStartClimateValidatesDuration(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if _, err := client.StartClimate(context.Background(), ClimateConditions{}, 30*time.Second); err == nil {
+		t.Error("Expected error for a duration under a minute")
+	}
+}
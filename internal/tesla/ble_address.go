@@ -0,0 +1,144 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
+)
+
+// BLEAddresses remembers where each vehicle was last found over BLE, so the
+// next connection can dial it straight away instead of scanning for its
+// beacon, which takes most of the time to connect
+type BLEAddresses struct {
+	dir   string // "" keeps the addresses in memory
+	mutex sync.Mutex
+	known map[string]ScanResult
+}
+
+// NewBLEAddresses returns addresses saved in dir, one file per VIN
+func NewBLEAddresses(dir string) *BLEAddresses {
+	return &BLEAddresses{dir: dir, known: make(map[string]ScanResult)}
+}
+
+// bleAddressesFromConfig returns the addresses for config's data directory,
+// or nil when tesla.direct_connect_timeout is 0
+func bleAddressesFromConfig(config *Config) *BLEAddresses {
+	if config.Tesla.DirectConnectTimeout <= 0 {
+		return nil
+	}
+	return NewBLEAddresses(filepath.Join(config.DataPath(), "ble"))
+}
+
+// path returns the file a vehicle's address is saved in
+func (a *BLEAddresses) path(vin string) string {
+	return filepath.Join(a.dir, vin+".json")
+}
+
+// Get returns where vin was last found
+func (a *BLEAddresses) Get(vin string) (ScanResult, bool) {
+	if a == nil {
+		return ScanResult{}, false
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if result, ok := a.known[vin]; ok {
+		return result, true
+	}
+	if a.dir == "" {
+		return ScanResult{}, false
+	}
+	data, err := os.ReadFile(a.path(vin))
+	if err != nil {
+		return ScanResult{}, false
+	}
+	var result ScanResult
+	if err := json.Unmarshal(data, &result); err != nil || result.Address == "" {
+		return ScanResult{}, false
+	}
+	a.known[vin] = result
+	return result, true
+}
+
+// Put remembers where a vehicle was found
+func (a *BLEAddresses) Put(result ScanResult) error {
+	if a == nil || result.Address == "" {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.known[result.VIN] = result
+	if a.dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create BLE address directory: %w", err)
+	}
+	path := a.path(result.VIN)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to save BLE address: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to save BLE address: %w", err)
+	}
+	return nil
+}
+
+// Forget drops a vehicle's address, so the next connection scans for it
+func (a *BLEAddresses) Forget(vin string) error {
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.known, vin)
+	if a.dir == "" {
+		return nil
+	}
+	if err := os.Remove(a.path(vin)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// target returns the scan result to dial a vehicle at
+func (r ScanResult) target() *ble.ScanResult {
+	return &ble.ScanResult{LocalName: r.LocalName, Address: r.Address, RSSI: r.RSSI, Connectable: true}
+}
+
+// bleDialer opens a BLE connection to a scanned vehicle, or scans for it when
+// scan is nil
+type bleDialer func(ctx context.Context, vin string, scan *ble.ScanResult) (Connector, error)
+
+// dialKnownAddress dials vin at the address it was last found at, allowing
+// timeout for it to answer. A vehicle that doesn't is forgotten, so the
+// caller scans for it.
+func dialKnownAddress(ctx context.Context, addresses *BLEAddresses, vin string, timeout time.Duration, dial bleDialer, logger *log.Logger) (Connector, bool) {
+	known, ok := addresses.Get(vin)
+	if !ok || timeout <= 0 {
+		return nil, false
+	}
+	logger.Printf("Dialing vehicle VIN: %s at its last address %s", vin, known.Address)
+	directCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := dial(directCtx, vin, known.target())
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Printf("Vehicle not at %s, scanning instead: %v", known.Address, err)
+			addresses.Forget(vin)
+		}
+		return nil, false
+	}
+	return conn, true
+}
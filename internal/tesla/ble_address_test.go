@@ -0,0 +1,178 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
+)
+
+func TestBLEAddressesPersist(t *testing.T) {
+	dir := t.TempDir()
+	addresses := NewBLEAddresses(dir)
+	if _, ok := addresses.Get("TEST_VIN"); ok {
+		t.Fatal("Expected no address before one is found")
+	}
+	found := ScanResult{VIN: "TEST_VIN", LocalName: "S1a2b3c4d5e6f7a8bC", Address: "00:11:22:33:44:55", RSSI: -60}
+	if err := addresses.Put(found); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "TEST_VIN.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private address file, got %v, %v", info, err)
+	}
+
+	// A restart reads the address back
+	known, ok := NewBLEAddresses(dir).Get("TEST_VIN")
+	if !ok || known.Address != found.Address || known.LocalName != found.LocalName {
+		t.Errorf("Expected %+v, got %+v", found, known)
+	}
+
+	if err := addresses.Forget("TEST_VIN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := NewBLEAddresses(dir).Get("TEST_VIN"); ok {
+		t.Error("Expected the address to be forgotten")
+	}
+}
+
+// fakeBLE scans and dials for a BLETransport or BLEManager, with the vehicle
+// at address
+type fakeBLE struct {
+	address string
+	scans   int
+	dialed  []string
+}
+
+func (f *fakeBLE) scan(ctx context.Context, vin string) (*ble.ScanResult, error) {
+	f.scans++
+	return &ble.ScanResult{LocalName: "S1a2b3c4d5e6f7a8bC", Address: f.address, RSSI: -60, Connectable: true}, nil
+}
+
+func (f *fakeBLE) dial(ctx context.Context, vin string, scan *ble.ScanResult) (Connector, error) {
+	f.dialed = append(f.dialed, scan.Address)
+	if scan.Address != f.address {
+		return nil, errors.New("no response")
+	}
+	return &fakeConnector{}, nil
+}
+
+func TestBLETransportDialsKnownAddress(t *testing.T) {
+	fake := &fakeBLE{address: "00:11:22:33:44:55"}
+	addresses := NewBLEAddresses(t.TempDir())
+	transport := &BLETransport{Addresses: addresses, DirectTimeout: time.Second, scan: fake.scan, dial: fake.dial}
+
+	// The first connection scans, and remembers the address
+	if _, err := transport.Dial(context.Background(), "TEST_VIN"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.scans != 1 {
+		t.Errorf("Expected a scan with no known address, got %d", fake.scans)
+	}
+
+	// Later ones dial it straight away
+	if _, err := transport.Dial(context.Background(), "TEST_VIN"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.scans != 1 || len(fake.dialed) != 2 {
+		t.Errorf("Expected the known address to be dialed without a scan, got %d scans, dialed %v", fake.scans, fake.dialed)
+	}
+
+	// A vehicle that has moved is scanned for again
+	fake.address = "66:77:88:99:AA:BB"
+	if _, err := transport.Dial(context.Background(), "TEST_VIN"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.scans != 2 {
+		t.Errorf("Expected a scan after the known address failed, got %d", fake.scans)
+	}
+	if known, _ := addresses.Get("TEST_VIN"); known.Address != fake.address {
+		t.Errorf("Expected the new address to be remembered, got %+v", known)
+	}
+
+	// With no direct timeout every connection scans
+	transport.DirectTimeout = 0
+	transport.Dial(context.Background(), "TEST_VIN")
+	if fake.scans != 3 {
+		t.Errorf("Expected a scan with direct connections off, got %d", fake.scans)
+	}
+}
+
+func TestBLEManagerReconnectsAtKnownAddress(t *testing.T) {
+	manager := NewBLEManager(log.New(io.Discard, "", 0))
+	fake := &fakeBLE{address: "00:11:22:33:44:55"}
+	manager.scan, manager.dial = fake.scan, fake.dial
+	manager.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return newFakeVehicle(), nil
+	})
+
+	bleConn, err := manager.ConnectToVehicle(context.Background(), "TEST_VIN", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bleConn.Reconnect(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if fake.scans != 1 || len(fake.dialed) != 2 || fake.dialed[1] != fake.address {
+		t.Errorf("Expected the reconnect to dial the scanned address, got %d scans, dialed %v", fake.scans, fake.dialed)
+	}
+}
+
+func TestBLEManagerScanAll(t *testing.T) {
+	manager := NewBLEManager(log.New(io.Discard, "", 0))
+	manager.scanAll = func(ctx context.Context) ([]*ble.ScanResult, error) {
+		return []*ble.ScanResult{
+			{LocalName: ble.VehicleLocalName("OTHER_VIN"), Address: "66:77:88:99:AA:BB", RSSI: -80},
+			{LocalName: ble.VehicleLocalName("TEST_VIN"), Address: "00:11:22:33:44:55", RSSI: -50},
+		}, nil
+	}
+
+	found, err := manager.ScanAll(context.Background(), "TEST_VIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].VIN != "TEST_VIN" || found[1].VIN != "" || found[1].RSSI != -80 {
+		t.Errorf("Expected the known vehicle labelled and first, got %+v", found)
+	}
+	if known, ok := manager.addresses.Get("TEST_VIN"); !ok || known.Address != "00:11:22:33:44:55" {
+		t.Errorf("Expected the known vehicle's address to be remembered, got %+v", known)
+	}
+}
+
+func TestBLEManagerScanAllDuration(t *testing.T) {
+	manager := NewBLEManager(log.New(io.Discard, "", 0))
+	manager.scanTimeout = time.Second
+	var listened time.Duration
+	manager.scanAll = func(ctx context.Context) ([]*ble.ScanResult, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("Expected the scan to have a deadline")
+		}
+		listened = time.Until(deadline)
+		return nil, nil
+	}
+
+	// A caller's deadline is honored, even past the scan timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := manager.ScanAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if listened <= 30*time.Second {
+		t.Errorf("Expected the scan to last the caller's minute, got %v", listened)
+	}
+
+	// Without one, the scan timeout applies
+	if _, err := manager.ScanAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if listened > time.Second {
+		t.Errorf("Expected the scan timeout to apply, got %v", listened)
+	}
+}
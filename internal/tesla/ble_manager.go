@@ -4,12 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/logging"
 	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
-	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
 )
 
@@ -22,6 +23,12 @@ type BLEManager struct {
 	sessionTimeout time.Duration
 	retryInterval  time.Duration
 	maxRetries    int
+	scan          func(ctx context.Context, vin string) (*ble.ScanResult, error)
+	scanAll       func(ctx context.Context) ([]*ble.ScanResult, error)
+	dial          func(ctx context.Context, vin string, scan *ble.ScanResult) (Connector, error)
+	newVehicle    VehicleFactory
+	addresses     *BLEAddresses // Where vehicles were last found
+	directTimeout time.Duration // Time to connect at a last-known address before scanning
 }
 
 // ConnectionState represents the current state of the BLE connection
@@ -34,6 +41,7 @@ const (
 	StateConnected
 	StateSessionActive
 	StateError
+	StateReconnecting
 )
 
 func (s ConnectionState) String() string {
@@ -50,16 +58,36 @@ func (s ConnectionState) String() string {
 		return "session_active"
 	case StateError:
 		return "error"
+	case StateReconnecting:
+		return "reconnecting"
 	default:
 		return "unknown"
 	}
 }
 
+// MarshalText encodes the state as its name
+func (s ConnectionState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state from its name
+func (s *ConnectionState) UnmarshalText(text []byte) error {
+	for state := StateDisconnected; state <= StateReconnecting; state++ {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown connection state %q", text)
+}
+
 // BLEConnection represents an active BLE connection to a Tesla vehicle
 type BLEConnection struct {
 	vin            string
-	conn           *ble.Connection
-	vehicle        *vehicle.Vehicle
+	conn           Connector
+	vehicle        VehicleCommander
+	redial         func(ctx context.Context, vin string) (Connector, error) // nil scans for the vehicle
+	newVehicle     VehicleFactory
 	state          ConnectionState
 	lastError      error
 	connectedAt    time.Time
@@ -71,11 +99,11 @@ type BLEConnection struct {
 
 // ScanResult represents a discovered Tesla vehicle during scanning
 type ScanResult struct {
-	VIN         string
-	LocalName   string
-	Address     string
-	RSSI        int16
-	DiscoveredAt time.Time
+	VIN         string    `json:"vin,omitempty"` // Empty for a beacon of an unknown vehicle
+	LocalName   string    `json:"local_name"`
+	Address     string    `json:"address"`
+	RSSI        int16     `json:"rssi"`
+	DiscoveredAt time.Time `json:"discovered_at"`
 }
 
 // NewBLEManager creates a new BLE manager
@@ -87,7 +115,43 @@ func NewBLEManager(logger *log.Logger) *BLEManager {
 		sessionTimeout: 5 * time.Second,
 		retryInterval:  2 * time.Second,
 		maxRetries:     3,
+		scan:           ble.ScanVehicleBeacon,
+		scanAll:        ble.ScanVehicleBeacons,
+		dial:           dialBLE,
+		newVehicle:     NewVehicleCommander,
+		addresses:      NewBLEAddresses(""),
+		directTimeout:  5 * time.Second,
+	}
+}
+
+// NewBLEManagerFromConfig creates a BLE manager with the scan and direct
+// connection settings in config
+func NewBLEManagerFromConfig(config *Config, logger *log.Logger) *BLEManager {
+	bm := NewBLEManager(logger)
+	bm.SetTimeouts(config.Tesla.ScanTimeout, config.Tesla.ConnectionTimeout, bm.sessionTimeout)
+	if addresses := bleAddressesFromConfig(config); addresses != nil {
+		bm.SetAddresses(addresses, config.Tesla.DirectConnectTimeout)
 	}
+	return bm
+}
+
+// dialBLE opens a BLE connection to a scanned vehicle
+func dialBLE(ctx context.Context, vin string, scan *ble.ScanResult) (Connector, error) {
+	return ble.NewConnectionFromScanResult(ctx, vin, scan)
+}
+
+// SetVehicleFactory replaces how the manager creates the vehicle over each
+// connection
+func (bm *BLEManager) SetVehicleFactory(factory VehicleFactory) {
+	bm.newVehicle = factory
+}
+
+// SetAddresses remembers where vehicles are found in addresses, allowing
+// directTimeout for a vehicle to answer at its last address before scanning.
+// A directTimeout of 0 always scans.
+func (bm *BLEManager) SetAddresses(addresses *BLEAddresses, directTimeout time.Duration) {
+	bm.addresses = addresses
+	bm.directTimeout = directTimeout
 }
 
 // SetAdapterID sets the Bluetooth adapter ID to use
@@ -135,7 +199,7 @@ func (bm *BLEManager) ScanForVehicle(ctx context.Context, vin string) (*ScanResu
 	defer cancel()
 	
 	// Scan for the vehicle
-	scan, err := ble.ScanVehicleBeacon(scanCtx, vin)
+	scan, err := bm.scan(scanCtx, vin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan for vehicle: %w", err)
 	}
@@ -152,6 +216,51 @@ func (bm *BLEManager) ScanForVehicle(ctx context.Context, vin string) (*ScanResu
 	return result, nil
 }
 
+// ScanAll listens until ctx's deadline, or for the scan timeout when ctx has
+// none, and returns every Tesla beacon in range, strongest first. Beacon
+// names are derived from VINs, so a beacon is labelled with its VIN only when
+// it's one of vins; its address is then remembered for the next connection.
+func (bm *BLEManager) ScanAll(ctx context.Context, vins ...string) ([]ScanResult, error) {
+	bm.logger.Println("Scanning for nearby vehicles")
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, bm.scanTimeout)
+		defer cancel()
+	}
+
+	scans, err := bm.scanAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for vehicles: %w", err)
+	}
+
+	names := make(map[string]string, len(vins))
+	for _, vin := range vins {
+		names[ble.VehicleLocalName(vin)] = vin
+	}
+	now := time.Now()
+	results := make([]ScanResult, 0, len(scans))
+	for _, scan := range scans {
+		result := ScanResult{
+			VIN:          names[scan.LocalName],
+			LocalName:    scan.LocalName,
+			Address:      scan.Address,
+			RSSI:         scan.RSSI,
+			DiscoveredAt: now,
+		}
+		if result.VIN != "" {
+			if err := bm.addresses.Put(result); err != nil {
+				bm.logger.Printf("warn: Failed to remember the address of %s: %v", result.VIN, err)
+			}
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].RSSI > results[j].RSSI })
+
+	bm.logger.Printf("Found %d nearby vehicles", len(results))
+	return results, nil
+}
+
 // ConnectToVehicle connects to a Tesla vehicle using BLE
 func (bm *BLEManager) ConnectToVehicle(ctx context.Context, vin string, privateKey authentication.ECDHPrivateKey) (*BLEConnection, error) {
 	bm.logger.Printf("Connecting to vehicle VIN: %s", vin)
@@ -160,25 +269,14 @@ func (bm *BLEManager) ConnectToVehicle(ctx context.Context, vin string, privateK
 	connCtx, cancel := context.WithTimeout(ctx, bm.connTimeout)
 	defer cancel()
 	
-	// Scan for the vehicle first
-	scanResult, err := bm.ScanForVehicle(connCtx, vin)
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan for vehicle: %w", err)
-	}
-	
 	// Create BLE connection
-	conn, err := ble.NewConnectionFromScanResult(connCtx, vin, &ble.ScanResult{
-		LocalName: scanResult.LocalName,
-		Address:   scanResult.Address,
-		RSSI:      scanResult.RSSI,
-		Connectable: true,
-	})
+	conn, err := bm.dialVehicle(connCtx, vin)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create BLE connection: %w", err)
+		return nil, err
 	}
 	
 	// Create vehicle instance
-	car, err := vehicle.NewVehicle(conn, privateKey, nil)
+	car, err := bm.newVehicle(conn, privateKey)
 	if err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to create vehicle instance: %w", err)
@@ -195,6 +293,8 @@ func (bm *BLEManager) ConnectToVehicle(ctx context.Context, vin string, privateK
 		vin:            vin,
 		conn:           conn,
 		vehicle:        car,
+		redial:         bm.dialVehicle,
+		newVehicle:     bm.newVehicle,
 		state:          StateConnected,
 		connectedAt:    time.Now(),
 		logger:         bm.logger,
@@ -205,6 +305,26 @@ func (bm *BLEManager) ConnectToVehicle(ctx context.Context, vin string, privateK
 	return bleConn, nil
 }
 
+// dialVehicle opens a BLE connection to a vehicle at its last-known address
+// or, if it isn't there, where a scan finds it
+func (bm *BLEManager) dialVehicle(ctx context.Context, vin string) (Connector, error) {
+	if conn, ok := dialKnownAddress(ctx, bm.addresses, vin, bm.directTimeout, bm.dial, bm.logger); ok {
+		return conn, nil
+	}
+	scanResult, err := bm.ScanForVehicle(ctx, vin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for vehicle: %w", err)
+	}
+	conn, err := bm.dial(ctx, vin, scanResult.target())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BLE connection: %w", err)
+	}
+	if err := bm.addresses.Put(*scanResult); err != nil {
+		bm.logger.Printf("warn: Failed to remember the address of %s: %v", vin, err)
+	}
+	return conn, nil
+}
+
 // StartSession starts an authenticated session with the vehicle
 func (bc *BLEConnection) StartSession(ctx context.Context) error {
 	bc.mutex.Lock()
@@ -282,7 +402,7 @@ func (bc *BLEConnection) IsSessionActive() bool {
 }
 
 // GetVehicle returns the vehicle instance
-func (bc *BLEConnection) GetVehicle() *vehicle.Vehicle {
+func (bc *BLEConnection) GetVehicle() VehicleCommander {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
 	return bc.vehicle
@@ -328,13 +448,18 @@ func (bc *BLEConnection) Reconnect(ctx context.Context, privateKey authenticatio
 	bc.vehicle = nil
 	bc.conn = nil
 	
-	// Create new connection
-	conn, err := ble.NewConnectionFromScanResult(ctx, bc.vin, &ble.ScanResult{
-		LocalName: "Tesla", // This would need to be stored from previous scan
-		Address:   "",      // This would need to be stored from previous scan
-		RSSI:      0,       // This would need to be stored from previous scan
-		Connectable: true,
-	})
+	// Create new connection, at the address the vehicle was last found at
+	// if it's still there
+	redial, newVehicle := bc.redial, bc.newVehicle
+	if redial == nil {
+		redial = func(ctx context.Context, vin string) (Connector, error) {
+			return dialBLE(ctx, vin, nil)
+		}
+	}
+	if newVehicle == nil {
+		newVehicle = NewVehicleCommander
+	}
+	conn, err := redial(ctx, bc.vin)
 	if err != nil {
 		bc.state = StateError
 		bc.lastError = err
@@ -342,7 +467,7 @@ func (bc *BLEConnection) Reconnect(ctx context.Context, privateKey authenticatio
 	}
 	
 	// Create vehicle instance
-	car, err := vehicle.NewVehicle(conn, privateKey, nil)
+	car, err := newVehicle(conn, privateKey)
 	if err != nil {
 		conn.Close()
 		bc.state = StateError
@@ -384,7 +509,7 @@ func (bm *BLEManager) RetryWithBackoff(ctx context.Context, operation func() err
 			}
 		}
 		
-		bm.logger.Printf("Attempt %d/%d", attempt+1, bm.maxRetries)
+		logging.Debugf(bm.logger, "Attempt %d/%d", attempt+1, bm.maxRetries)
 		
 		err := operation()
 		if err == nil {
@@ -81,6 +81,7 @@ func TestConnectionState(t *testing.T) {
 		{StateConnected, "connected"},
 		{StateSessionActive, "session_active"},
 		{StateError, "error"},
+		{StateReconnecting, "reconnecting"},
 	}
 	
 	for _, s := range states {
@@ -0,0 +1,188 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// ErrClimateSkipped is returned when a climate command is skipped because
+// the vehicle's charge state doesn't meet the command's conditions
+var ErrClimateSkipped = errors.New("climate command skipped")
+
+// kmPerMile converts the ranges the vehicle reports in miles
+const kmPerMile = 1.609344
+
+// ChargeState is the part of the vehicle's charge state used to gate climate
+// commands
+type ChargeState struct {
+	BatteryLevel       int     `json:"battery_level"`        // Percent
+	UsableBatteryLevel int     `json:"usable_battery_level"` // Percent
+	ChargeLimit        int     `json:"charge_limit_soc"`     // Percent
+	ChargingState      string  `json:"charging_state"`       // disconnected, no_power, starting, charging, complete, stopped, calibrating or unknown
+	PluggedIn          bool    `json:"plugged_in"`
+	RangeKm            float64 `json:"range_km"` // Rated range
+	ChargerPowerKW     int     `json:"charger_power_kw"`
+	MinutesToFull      int     `json:"minutes_to_full_charge"` // While charging
+}
+
+// ChargeStateETag returns a stable fingerprint of a charge state, suitable
+// for use as an HTTP entity tag
+func ChargeStateETag(state *ChargeState) string {
+	if state == nil {
+		return ""
+	}
+	return etagOf(state)
+}
+
+// ClimateConditions gate a climate command on the vehicle's charge state so
+// scheduled preconditioning doesn't run the battery down
+type ClimateConditions struct {
+	MinBatteryLevel int  `json:"min_battery_level,omitempty"` // Percent; 0 disables the check
+	SkipIfUnplugged bool `json:"skip_if_unplugged,omitempty"`
+}
+
+// IsZero reports whether the conditions allow every command
+func (cond ClimateConditions) IsZero() bool {
+	return cond.MinBatteryLevel == 0 && !cond.SkipIfUnplugged
+}
+
+// Validate checks the conditions
+func (cond ClimateConditions) Validate() error {
+	if cond.MinBatteryLevel < 0 || cond.MinBatteryLevel > 100 {
+		return fmt.Errorf("min_battery_level must be between 0 and 100")
+	}
+	return nil
+}
+
+// SkipReason explains why the conditions block a command in the given charge
+// state, or returns "" if they allow it
+func (cond ClimateConditions) SkipReason(state *ChargeState) string {
+	if cond.SkipIfUnplugged && !state.PluggedIn {
+		return "vehicle is not plugged in"
+	}
+	if cond.MinBatteryLevel > 0 && state.BatteryLevel < cond.MinBatteryLevel {
+		return fmt.Sprintf("battery level %d%% is below the minimum of %d%%", state.BatteryLevel, cond.MinBatteryLevel)
+	}
+	return ""
+}
+
+// ClimateSkip describes a climate command skipped by its conditions. It is
+// published as the data of EventClimateSkipped.
+type ClimateSkip struct {
+	Command     string            `json:"command"`
+	Reason      string            `json:"reason"`
+	Conditions  ClimateConditions `json:"conditions"`
+	ChargeState ChargeState       `json:"charge_state"`
+}
+
+// GetChargeState reads the vehicle's charge state with retry logic
+func (c *Client) GetChargeState(ctx context.Context) (*ChargeState, error) {
+	chargeCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+	defer cancel()
+
+	var result *ChargeState
+	err := c.retryWithBackoff(chargeCtx, "get_charge_state", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		state, err := c.vehicle.GetState(chargeCtx, vehicle.StateCategoryCharge)
+		if err != nil {
+			return fmt.Errorf("failed to get charge state: %w", err)
+		}
+
+		chargeState := state.GetChargeState()
+		if chargeState == nil {
+			return fmt.Errorf("no charge state data received")
+		}
+
+		result = chargeStateFrom(chargeState)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// chargeStateFrom converts the vehicle's charge state
+func chargeStateFrom(chargeState *carserver.ChargeState) *ChargeState {
+	charging := chargingStateName(chargeState.GetChargingState())
+	return &ChargeState{
+		BatteryLevel:       int(chargeState.GetBatteryLevel()),
+		UsableBatteryLevel: int(chargeState.GetUsableBatteryLevel()),
+		ChargeLimit:        int(chargeState.GetChargeLimitSoc()),
+		ChargingState:      charging,
+		PluggedIn:          charging != "disconnected" && charging != "unknown",
+		RangeKm:            float64(chargeState.GetBatteryRange()) * kmPerMile,
+		ChargerPowerKW:     int(chargeState.GetChargerPower()),
+		MinutesToFull:      int(chargeState.GetMinutesToFullCharge()),
+	}
+}
+
+// chargingStateName converts the charging state to a stable name
+func chargingStateName(state *carserver.ChargeState_ChargingState) string {
+	switch state.GetType().(type) {
+	case *carserver.ChargeState_ChargingState_Disconnected:
+		return "disconnected"
+	case *carserver.ChargeState_ChargingState_NoPower:
+		return "no_power"
+	case *carserver.ChargeState_ChargingState_Starting:
+		return "starting"
+	case *carserver.ChargeState_ChargingState_Charging:
+		return "charging"
+	case *carserver.ChargeState_ChargingState_Complete:
+		return "complete"
+	case *carserver.ChargeState_ChargingState_Stopped:
+		return "stopped"
+	case *carserver.ChargeState_ChargingState_Calibrating:
+		return "calibrating"
+	default:
+		return "unknown"
+	}
+}
+
+// CheckClimateConditions reads the live charge state and returns an error
+// wrapping ErrClimateSkipped if cond or the battery guard blocks command. A
+// skip is logged and published as EventClimateSkipped so it can be reported
+// to the user.
+func (c *Client) CheckClimateConditions(ctx context.Context, command string, cond ClimateConditions) error {
+	_, err := c.checkClimate(ctx, command, cond, 0, false)
+	return err
+}
+
+// gateClimate applies cond to a charge state, reporting a skip
+func (c *Client) gateClimate(command string, cond ClimateConditions, state *ChargeState) error {
+	reason := cond.SkipReason(state)
+	if reason == "" {
+		return nil
+	}
+	return c.skipClimate(command, reason, cond, state)
+}
+
+// skipClimate reports a climate command skipped for reason
+func (c *Client) skipClimate(command, reason string, cond ClimateConditions, state *ChargeState) error {
+	c.logger.Printf("Skipping %s: %s", command, reason)
+	c.events.Publish(Event{Type: EventClimateSkipped, VIN: c.vin, Data: ClimateSkip{
+		Command:     command,
+		Reason:      reason,
+		Conditions:  cond,
+		ChargeState: *state,
+	}})
+	return fmt.Errorf("%w: %s", ErrClimateSkipped, reason)
+}
+
+// SetClimateOnIf turns the climate system on if the vehicle's charge state
+// meets cond
+func (c *Client) SetClimateOnIf(ctx context.Context, cond ClimateConditions) error {
+	if err := c.CheckClimateConditions(ctx, "set_climate_on", cond); err != nil {
+		return err
+	}
+	return c.setClimateOn(ctx)
+}
@@ -0,0 +1,100 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestClimateConditionsSkipReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   ClimateConditions
+		state  ChargeState
+		reason string
+	}{
+		{"no conditions", ClimateConditions{}, ChargeState{BatteryLevel: 5}, ""},
+		{"above minimum", ClimateConditions{MinBatteryLevel: 40}, ChargeState{BatteryLevel: 40}, ""},
+		{"below minimum", ClimateConditions{MinBatteryLevel: 40}, ChargeState{BatteryLevel: 39},
+			"battery level 39% is below the minimum of 40%"},
+		{"plugged in", ClimateConditions{SkipIfUnplugged: true}, ChargeState{PluggedIn: true}, ""},
+		{"unplugged", ClimateConditions{SkipIfUnplugged: true, MinBatteryLevel: 40}, ChargeState{BatteryLevel: 10},
+			"vehicle is not plugged in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := tt.cond.SkipReason(&tt.state); reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, reason)
+			}
+		})
+	}
+}
+
+func TestClimateConditionsValidate(t *testing.T) {
+	if err := (ClimateConditions{MinBatteryLevel: 100}).Validate(); err != nil {
+		t.Errorf("Expected 100%% to be valid, got %v", err)
+	}
+	if err := (ClimateConditions{MinBatteryLevel: 101}).Validate(); err == nil {
+		t.Error("Expected error for min_battery_level above 100")
+	}
+	if err := (ClimateConditions{MinBatteryLevel: -1}).Validate(); err == nil {
+		t.Error("Expected error for negative min_battery_level")
+	}
+}
+
+func TestChargingStateName(t *testing.T) {
+	charging := &carserver.ChargeState_ChargingState{
+		Type: &carserver.ChargeState_ChargingState_Charging{},
+	}
+	if name := chargingStateName(charging); name != "charging" {
+		t.Errorf("Expected charging, got %s", name)
+	}
+	if name := chargingStateName(nil); name != "unknown" {
+		t.Errorf("Expected unknown for missing state, got %s", name)
+	}
+}
+
+func TestGateClimatePublishesSkip(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	events, unsubscribe := client.Events().Subscribe(1)
+	defer unsubscribe()
+
+	cond := ClimateConditions{MinBatteryLevel: 50}
+	err := client.gateClimate("set_climate_on", cond, &ChargeState{BatteryLevel: 30, PluggedIn: true})
+	if !errors.Is(err, ErrClimateSkipped) {
+		t.Fatalf("Expected ErrClimateSkipped, got %v", err)
+	}
+
+	select {
+	case event := <-events:
+		skip, ok := event.Data.(ClimateSkip)
+		if event.Type != EventClimateSkipped || !ok {
+			t.Fatalf("Expected climate skipped event, got %+v", event)
+		}
+		if skip.Command != "set_climate_on" || skip.ChargeState.BatteryLevel != 30 || skip.Conditions != cond {
+			t.Errorf("Unexpected skip: %+v", skip)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a climate skipped event")
+	}
+
+	if err := client.gateClimate("set_climate_on", cond, &ChargeState{BatteryLevel: 80}); err != nil {
+		t.Errorf("Expected command to be allowed, got %v", err)
+	}
+}
+
+func TestCheckClimateConditionsWithoutConditions(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	// No conditions means no charge state read, so no connection is needed
+	if err := client.CheckClimateConditions(context.Background(), "set_climate_on", ClimateConditions{}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := client.CheckClimateConditions(context.Background(), "set_climate_on", ClimateConditions{MinBatteryLevel: 120}); err == nil {
+		t.Error("Expected error for invalid conditions")
+	}
+}
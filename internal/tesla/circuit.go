@@ -0,0 +1,114 @@
+package tesla
+
+import "time"
+
+// CircuitStatus is a snapshot of a circuit breaker
+type CircuitStatus struct {
+	State         string    `json:"state"` // closed, open or half_open
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at,omitempty"`
+	RetryAt       time.Time `json:"retry_at,omitempty"` // When an open circuit lets a call through to test the vehicle
+	CircuitBreakerConfig
+}
+
+// Status returns the breaker's state, failure count and last failure
+func (cb *CircuitBreaker) Status() CircuitStatus {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	status := CircuitStatus{
+		State:                cb.state.String(),
+		Failures:             cb.failureCount,
+		LastFailureAt:        cb.lastFailTime,
+		CircuitBreakerConfig: cb.config,
+	}
+	if cb.state == CircuitOpen {
+		status.RetryAt = cb.lastFailTime.Add(cb.config.ResetTimeout)
+	}
+	return status
+}
+
+// Reset closes the breaker and clears its failures, so calls go through
+// straight away
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	changed := cb.setState(CircuitClosed)
+	defer changed()
+	defer cb.mutex.Unlock()
+	cb.failureCount = 0
+	cb.successCount = 0
+}
+
+// Trip opens the breaker as if calls had kept failing: calls are refused
+// until the reset timeout passes, then tested as in any half-open state
+func (cb *CircuitBreaker) Trip() {
+	cb.mutex.Lock()
+	changed := cb.setState(CircuitOpen)
+	defer changed()
+	defer cb.mutex.Unlock()
+	cb.lastFailTime = time.Now()
+	cb.successCount = 0
+}
+
+// OnStateChange sets fn to be called each time the breaker moves from one
+// state to another. It's called without the breaker's lock held, so it may
+// look at the breaker.
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to CircuitBreakerState)) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.onChange = fn
+}
+
+// noStateChange reports nothing, when the state hasn't changed
+func noStateChange() {}
+
+// setState moves the breaker to state, returning a function that reports the
+// change to the OnStateChange hook once the lock is released. The caller
+// must hold mutex.
+func (cb *CircuitBreaker) setState(state CircuitBreakerState) func() {
+	from, fn := cb.state, cb.onChange
+	cb.state = state
+	if from == state || fn == nil {
+		return noStateChange
+	}
+	return func() { fn(from, state) }
+}
+
+// CircuitStateChange is the data of EventCircuitStateChanged
+type CircuitStateChange struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Failures int    `json:"failures"` // Consecutive failures when it changed
+}
+
+// watchCircuit logs, counts and publishes the client's circuit breaker
+// changes
+func (c *Client) watchCircuit() {
+	c.circuitBreaker.OnStateChange(func(from, to CircuitBreakerState) {
+		status := c.circuitBreaker.Status()
+		c.logger.Printf("Circuit breaker for %s changed from %s to %s after %d failures", c.vin, from, to, status.Failures)
+		c.metrics.circuitChange(to)
+		c.events.Publish(Event{Type: EventCircuitStateChanged, VIN: c.vin, Data: CircuitStateChange{
+			From:     from.String(),
+			To:       to.String(),
+			Failures: status.Failures,
+		}})
+	})
+}
+
+// CircuitStatus returns a snapshot of the client's circuit breaker
+func (c *Client) CircuitStatus() CircuitStatus {
+	return c.circuitBreaker.Status()
+}
+
+// ResetCircuit closes the client's circuit breaker
+func (c *Client) ResetCircuit() {
+	c.circuitBreaker.Reset()
+	c.logger.Printf("Circuit breaker reset for %s", c.vin)
+}
+
+// TripCircuit opens the client's circuit breaker
+func (c *Client) TripCircuit() {
+	c.circuitBreaker.Trip()
+	c.logger.Printf("Circuit breaker tripped for %s", c.vin)
+}
@@ -326,3 +326,61 @@ func TestCircuitBreakerConcurrentAccess(t *testing.T) {
 		t.Errorf("Expected state CircuitOpen, got %v", cb.GetState())
 	}
 }
+
+func TestCircuitBreakerResetAndTrip(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute, HalfOpenMaxCalls: 1})
+	failure := errors.New("test failure")
+	cb.Call(func() error { return failure })
+	cb.Call(func() error { return failure })
+
+	status := cb.Status()
+	if status.State != "open" || status.Failures != 2 || status.LastFailureAt.IsZero() {
+		t.Fatalf("Status after failures = %+v", status)
+	}
+	if want := status.LastFailureAt.Add(time.Minute); !status.RetryAt.Equal(want) {
+		t.Errorf("RetryAt = %v, want %v", status.RetryAt, want)
+	}
+
+	cb.Reset()
+	if err := cb.Call(func() error { return nil }); err != nil {
+		t.Errorf("Call after a reset failed: %v", err)
+	}
+	if status := cb.Status(); status.State != "closed" || status.Failures != 0 {
+		t.Errorf("Status after a reset = %+v", status)
+	}
+
+	cb.Trip()
+	if err := cb.Call(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a tripped breaker to refuse calls, got %v", err)
+	}
+}
+
+func TestCircuitBreakerOnStateChange(t *testing.T) {
+	cb := NewCircuitBreaker(CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: 10 * time.Millisecond, HalfOpenMaxCalls: 1})
+	var changes []string
+	cb.OnStateChange(func(from, to CircuitBreakerState) {
+		// The hook runs without the lock, so it can look at the breaker
+		if cb.GetState() != to {
+			t.Errorf("State %s in the hook, want %s", cb.GetState(), to)
+		}
+		changes = append(changes, from.String()+"->"+to.String())
+	})
+
+	cb.Call(func() error { return errors.New("test failure") })
+	time.Sleep(20 * time.Millisecond)
+	cb.Call(func() error { return nil })
+	cb.Reset() // Already closed
+	cb.Trip()
+	cb.Reset()
+
+	want := []string{"closed->open", "open->half_open", "half_open->closed", "closed->open", "open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("changes = %v, want %v", changes, want)
+			break
+		}
+	}
+}
@@ -4,16 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log"
 	"math"
+	"math/rand"
 	"sync"
 	"time"
 
-	"github.com/teslamotors/vehicle-command/internal/authentication"
-	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
-	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/internal/tracing"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
-	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
 )
 
 // Error types for better error handling
@@ -32,8 +34,22 @@ type RetryConfig struct {
 	MaxDelay        time.Duration `json:"max_delay"`
 	BackoffFactor   float64       `json:"backoff_factor"`
 	Jitter          bool          `json:"jitter"`
+	JitterStrategy  string        `json:"jitter_strategy,omitempty"` // proportional (the default), full or decorrelated
+	MaxElapsed      time.Duration `json:"max_elapsed,omitempty"`     // Retry budget: no retry starts after this long; 0 for no limit
 }
 
+// minRetryWindow is the least time worth leaving for an attempt before a
+// request's deadline
+const minRetryWindow = 100 * time.Millisecond
+
+// Jitter strategies, spreading out the retries of clients that failed
+// together
+const (
+	JitterProportional = "proportional" // Up to 12.5% either side of the backoff
+	JitterFull         = "full"         // Anywhere from nothing up to the backoff
+	JitterDecorrelated = "decorrelated" // Between initial_delay and three times the last delay, ignoring backoff_factor
+)
+
 // CircuitBreakerConfig holds configuration for circuit breaker
 type CircuitBreakerConfig struct {
 	MaxFailures     int           `json:"max_failures"`
@@ -50,6 +66,19 @@ const (
 	CircuitHalfOpen
 )
 
+// String returns the state's name
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
 	config        CircuitBreakerConfig
@@ -57,19 +86,72 @@ type CircuitBreaker struct {
 	failureCount  int
 	lastFailTime  time.Time
 	successCount  int
+	onChange      func(from, to CircuitBreakerState)
 	mutex         sync.RWMutex
 }
 
 // Client represents a Tesla vehicle client for HVAC operations
 type Client struct {
-	vehicle         *vehicle.Vehicle
+	vehicle         VehicleCommander
+	simulator       *SimulatedVehicle // Kept across reconnects with the sim transport
+	simulatorOnce   sync.Once
 	vin             string
-	conn            *ble.Connection
+	privateKeyFile  string
+	conn            Connector
+	transport       TransportType
+	failover        FailoverConfig
+	fleetAPIHost    string
+	oauth           *OAuthManager
+	scan            BLETransport
+	transports      []Transport
+	vehicleFactory  VehicleFactory // Creates the vehicle over a connection; nil uses NewVehicleCommander
+	recorder        *Recorder      // Records the messages on new connections
+	faults          *faultInjector // Injected into new connections; nil injects nothing
+	sessions        *SessionStore  // Resumes sessions across connections; nil starts new ones
+	activeTransport TransportType
+	failedOverAt    time.Time
+	transportMutex  sync.RWMutex
 	logger          *log.Logger
 	retryConfig     RetryConfig
 	circuitBreaker  *CircuitBreaker
+	requestTimeout  time.Duration
+	connectTimeout  time.Duration
+	wake            WakeConfig
+	batteryGuard    BatteryGuardConfig
+	setpointInterval time.Duration
+	stateCacheTTL   time.Duration
+	tuningMutex     sync.RWMutex
 	lastHealthCheck time.Time
 	healthMutex     sync.RWMutex
+	healthCheckInterval time.Duration
+	health          HealthStatus
+	healthStatusMutex sync.RWMutex
+	keepAliveInterval time.Duration
+	queue           *commandQueue
+	lastActivity    time.Time // Last time the vehicle answered
+	lastCommandAt   time.Time // Last time a command succeeded
+	activityMutex   sync.RWMutex
+	events          *EventBus
+	lastState       *HVACState
+	lastStateETag   string
+	lastStateAt     time.Time
+	stateStale      bool // A command has succeeded since lastState was read
+	stateMutex      sync.RWMutex
+	reads           flightGroup // Coalesces concurrent state reads
+	hooks           map[int]CommandHook
+	nextHookID      int
+	hookMutex       sync.RWMutex
+	metrics         clientMetrics
+	rng             *rand.Rand // For jitter; created on first use
+	rngMutex        sync.Mutex
+	awake           AwakeStatus
+	awakeMutex      sync.RWMutex
+	wakeMutex       sync.Mutex // Serializes wakes so concurrent commands send one
+	setpoints       setpointLimiter
+	connState       ConnectionState
+	keepConnected   bool // Connected and not disconnected on purpose, so drops are reconnected
+	connStateMutex  sync.RWMutex
+	climateTimer    climateTimer // Pending automatic climate off
 }
 
 // HVACState represents the current state of the vehicle's HVAC system
@@ -89,6 +171,10 @@ type HVACState struct {
 	RightTempDirection  int32   `json:"right_temp_direction"`
 	IsPreconditioning   bool    `json:"is_preconditioning"`
 	BioweaponModeOn     bool    `json:"bioweapon_mode_on"`
+	OverheatProtection  OverheatProtectionState `json:"overheat_protection"`
+	ClimateKeeperMode   ClimateKeeperMode       `json:"climate_keeper_mode"`
+	SteeringWheelHeater bool                    `json:"steering_wheel_heater"`
+	SteeringWheelHeatLevel SteeringWheelHeatLevel `json:"steering_wheel_heat_level"`
 }
 
 // FanSpeed represents the fan speed levels
@@ -149,13 +235,29 @@ func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
 
 // Call executes a function with circuit breaker protection
 func (cb *CircuitBreaker) Call(fn func() error) error {
+	if err := cb.before(); err != nil {
+		return err
+	}
+
+	// Execute the function without holding the lock so that nested calls
+	// (e.g. GetFanSpeed -> GetHVACState) don't deadlock
+	err := fn()
+
+	cb.after(err)
+	return err
+}
+
+// before checks whether a call is currently allowed through the breaker
+func (cb *CircuitBreaker) before() error {
 	cb.mutex.Lock()
+	changed := noStateChange
+	defer func() { changed() }()
 	defer cb.mutex.Unlock()
 
 	// Check if circuit is open
 	if cb.state == CircuitOpen {
 		if time.Since(cb.lastFailTime) > cb.config.ResetTimeout {
-			cb.state = CircuitHalfOpen
+			changed = cb.setState(CircuitHalfOpen)
 			cb.successCount = 0
 		} else {
 			return ErrCircuitOpen
@@ -167,26 +269,38 @@ func (cb *CircuitBreaker) Call(fn func() error) error {
 		return ErrCircuitOpen
 	}
 
-	// Execute the function
-	err := fn()
+	return nil
+}
+
+// after records the outcome of a call
+func (cb *CircuitBreaker) after(err error) {
+	cb.mutex.Lock()
+	changed := noStateChange
+	defer func() { changed() }()
+	defer cb.mutex.Unlock()
+
 	if err != nil {
+		// A client that isn't connected never reached the vehicle, so
+		// there's no vehicle failure to count
+		if errors.Is(err, ErrNotConnected) {
+			return
+		}
+
 		cb.failureCount++
 		cb.lastFailTime = time.Now()
 		
 		if cb.failureCount >= cb.config.MaxFailures {
-			cb.state = CircuitOpen
+			changed = cb.setState(CircuitOpen)
 		}
-		return err
+		return
 	}
 
 	// Success - reset failure count and update state
 	cb.failureCount = 0
 	cb.successCount++
 	if cb.state == CircuitHalfOpen {
-		cb.state = CircuitClosed
+		changed = cb.setState(CircuitClosed)
 	}
-
-	return nil
 }
 
 // GetState returns the current circuit breaker state
@@ -196,9 +310,17 @@ func (cb *CircuitBreaker) GetState() CircuitBreakerState {
 	return cb.state
 }
 
+// CircuitState returns the state of the client's circuit breaker
+func (c *Client) CircuitState() CircuitBreakerState {
+	return c.circuitBreaker.GetState()
+}
+
 // NewClient creates a new Tesla client with default retry and circuit breaker configuration
 func NewClient(vin string, logger *log.Logger) *Client {
-	return &Client{
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	client := &Client{
 		vin:    vin,
 		logger: logger,
 		retryConfig: RetryConfig{
@@ -213,39 +335,78 @@ func NewClient(vin string, logger *log.Logger) *Client {
 			ResetTimeout:     60 * time.Second,
 			HalfOpenMaxCalls: 3,
 		}),
+		wake:   DefaultConfig().Wake,
+		stateCacheTTL: DefaultConfig().Tesla.StateCacheTTL,
+		queue:  newCommandQueue(DefaultConfig().Tesla.MaxConcurrentRequests, DefaultConfig().Tesla.MaxQueuedRequests),
+		events: NewEventBus(),
 	}
+	client.watchCircuit()
+	return client
 }
 
 // NewClientWithConfig creates a new Tesla client with custom configuration
 func NewClientWithConfig(vin string, logger *log.Logger, retryConfig RetryConfig, circuitConfig CircuitBreakerConfig) *Client {
-	return &Client{
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	client := &Client{
 		vin:    vin,
 		logger: logger,
 		retryConfig: retryConfig,
 		circuitBreaker: NewCircuitBreaker(circuitConfig),
+		wake:   DefaultConfig().Wake,
+		stateCacheTTL: DefaultConfig().Tesla.StateCacheTTL,
+		queue:  newCommandQueue(DefaultConfig().Tesla.MaxConcurrentRequests, DefaultConfig().Tesla.MaxQueuedRequests),
+		events: NewEventBus(),
 	}
+	client.watchCircuit()
+	return client
 }
 
 // NewClientFromConfig creates a new Tesla client from a configuration
 func NewClientFromConfig(config *Config, logger *log.Logger) *Client {
-	return &Client{
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	client := &Client{
 		vin:    config.Tesla.VIN,
+		privateKeyFile: config.Tesla.PrivateKeyFile,
 		logger: logger,
 		retryConfig: config.Retry,
 		circuitBreaker: NewCircuitBreaker(config.CircuitBreaker),
+		requestTimeout: config.Tesla.RequestTimeout,
+		connectTimeout: config.Tesla.ConnectionTimeout,
+		wake: config.Wake,
+		batteryGuard: config.BatteryGuard,
+		faults: newFaultInjector(config.Faults),
+		setpointInterval: config.Tesla.SetpointInterval,
+		stateCacheTTL: config.Tesla.StateCacheTTL,
+		transport: TransportType(config.Tesla.Transport),
+		failover: config.Failover,
+		fleetAPIHost: config.Tesla.FleetAPIHost,
+		scan: bleTransportFromConfig(config),
+		sessions: sessionStoreFromConfig(config),
+		healthCheckInterval: config.Client.HealthCheckInterval,
+		keepAliveInterval: config.Client.KeepAliveInterval,
+		queue: newCommandQueue(config.Tesla.MaxConcurrentRequests, config.Tesla.MaxQueuedRequests),
+		events: NewEventBus(),
 	}
+	client.watchCircuit()
+	return client
 }
 
-// NewClientWithConfigManager creates a new Tesla client with configuration management
+// NewClientWithConfigManager creates a new Tesla client with configuration
+// management, for the first configured vehicle
 func NewClientWithConfigManager(configManager *ConfigManager, logger *log.Logger) *Client {
 	config := configManager.GetConfig()
-	client := NewClientFromConfig(config, logger)
+	client := NewClientFromConfig(config.ForVehicle(config.VehicleConfigs()[0]), logger)
 
 	// Register callback to update client configuration when config changes
 	configManager.RegisterCallback(func(oldConfig, newConfig *Config) error {
-		client.retryConfig = newConfig.Retry
-		client.circuitBreaker = NewCircuitBreaker(newConfig.CircuitBreaker)
-		client.vin = newConfig.Tesla.VIN
+		config := newConfig.ForVehicle(newConfig.VehicleConfigs()[0])
+		client.ApplyTuning(TuningFromConfig(config))
+		client.vin = config.Tesla.VIN
+		client.privateKeyFile = config.Tesla.PrivateKeyFile
 		return nil
 	})
 
@@ -253,10 +414,48 @@ func NewClientWithConfigManager(configManager *ConfigManager, logger *log.Logger
 }
 
 // retryWithBackoff executes a function with exponential backoff retry logic
-func (c *Client) retryWithBackoff(ctx context.Context, operation string, fn func() error) error {
+func (c *Client) retryWithBackoff(ctx context.Context, operation string, fn func() error) (err error) {
+	start := time.Now()
+	defer func() { c.metrics.observe(operation, time.Since(start), err) }()
+
+	ctx, span := tracing.Start(ctx, "tesla."+operation, tracing.Attr("vehicle.vin", c.vin))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// Wait for a turn on the vehicle, then with wake.on_demand set, wake a
+	// sleeping vehicle first
+	if operation != "connect" {
+		release, err := c.queue.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		span.SetAttributes(tracing.Attr("queue.wait_ms", time.Since(start).Milliseconds()))
+
+		if err := c.ensureAwake(ctx); err != nil {
+			return err
+		}
+	}
+
 	var lastErr error
+	var delay time.Duration // The last delay between attempts
+	woken := false
+	final := false // The delay was shrunk to fit the deadline, leaving one last attempt
+	retry := c.retrySettings()
+	attempts := retry.MaxRetries + 1
+
+	// Retries stop short of the caller's deadline or the retry budget,
+	// whichever comes first
+	deadline, hasDeadline := ctx.Deadline()
+	if retry.MaxElapsed > 0 {
+		if budget := time.Now().Add(retry.MaxElapsed); !hasDeadline || budget.Before(deadline) {
+			deadline, hasDeadline = budget, true
+		}
+	}
 	
-	for attempt := 0; attempt <= c.retryConfig.MaxRetries; attempt++ {
+	for attempt := 0; attempt <= retry.MaxRetries; attempt++ {
 		// Check if context is cancelled
 		select {
 		case <-ctx.Done():
@@ -265,26 +464,67 @@ func (c *Client) retryWithBackoff(ctx context.Context, operation string, fn func
 		}
 
 		// Execute the function with circuit breaker protection
-		err := c.circuitBreaker.Call(fn)
+		err := c.attempt(ctx, operation, attempt, fn)
 		if err == nil {
+			c.touch()
 			if attempt > 0 {
-				c.logger.Printf("Operation '%s' succeeded on attempt %d", operation, attempt+1)
+				c.logFor(ctx).Printf("Operation '%s' succeeded on attempt %d", operation, attempt+1)
+			}
+			// Only an awake vehicle answers infotainment requests
+			if operation != "connect" {
+				c.markAwake()
 			}
 			return nil
 		}
 
+		// Fail fast where retrying is pointless, and wake the vehicle where
+		// that's the fix
+		switch c.classifyError(err) {
+		case ErrorTerminal:
+			c.logFor(ctx).Printf("Operation '%s' failed on attempt %d and won't be retried: %v",
+				operation, attempt+1, err)
+			return err
+		case ErrorNeedsWake:
+			if !woken {
+				woken = true
+				c.logFor(ctx).Printf("Operation '%s' failed because the vehicle is asleep; waking it", operation)
+				if err := c.Wake(ctx); err != nil {
+					return err
+				}
+				attempt-- // The attempt failed for want of a wake, so it doesn't count
+				continue
+			}
+		}
+
 		lastErr = err
 		
 		// Don't retry on the last attempt
-		if attempt == c.retryConfig.MaxRetries {
+		if attempt == retry.MaxRetries || final {
+			attempts = attempt + 1
 			break
 		}
 
 		// Calculate delay with exponential backoff
-		delay := c.calculateDelay(attempt)
+		delay = c.nextDelay(attempt, delay)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if hasDeadline {
+			fitted, ok := fitDelay(delay, time.Until(deadline))
+			if !ok {
+				c.logFor(ctx).Printf("Operation '%s' failed on attempt %d: %v. No time left to retry",
+					operation, attempt+1, err)
+				return fmt.Errorf("%w: %s failed after %d attempts, with no time left to retry: %w",
+					ErrRetryExhausted, operation, attempt+1, err)
+			}
+			final = fitted < delay
+			delay = fitted
+		}
 		
-		c.logger.Printf("Operation '%s' failed on attempt %d: %v. Retrying in %v", 
+		c.logFor(ctx).Printf("Operation '%s' failed on attempt %d: %v. Retrying in %v", 
 			operation, attempt+1, err, delay)
+		c.metrics.retry(operation)
+		span.AddEvent("retry", tracing.Attr("delay_ms", delay.Milliseconds()))
 
 		// Wait with context cancellation support
 		select {
@@ -295,29 +535,108 @@ func (c *Client) retryWithBackoff(ctx context.Context, operation string, fn func
 		}
 	}
 
-	return fmt.Errorf("%w: %s failed after %d attempts: %v", 
-		ErrRetryExhausted, operation, c.retryConfig.MaxRetries+1, lastErr)
+	return fmt.Errorf("%w: %s failed after %d attempts: %w", 
+		ErrRetryExhausted, operation, attempts, lastErr)
+}
+
+// fitDelay fits a delay before retrying into the time remaining before a
+// deadline. A delay that wouldn't leave minRetryWindow for the attempt after
+// it is cut to half the time remaining, for one last attempt; ok is false
+// when there isn't time for even that.
+func fitDelay(delay, remaining time.Duration) (fitted time.Duration, ok bool) {
+	if remaining < 2*minRetryWindow {
+		return 0, false
+	}
+	if delay > remaining-minRetryWindow {
+		return remaining / 2, true
+	}
+	return delay, true
+}
+
+// attempt makes one attempt at an operation through the circuit breaker,
+// traced as a call to the vehicle
+func (c *Client) attempt(ctx context.Context, operation string, attempt int, fn func() error) error {
+	_, span := tracing.StartClient(ctx, "vehicle."+operation,
+		tracing.Attr("attempt", attempt+1),
+		tracing.Attr("circuit.state", c.circuitBreaker.GetState().String()),
+		tracing.Attr("transport", string(c.ActiveTransport())))
+	defer span.End()
+
+	before := c.circuitBreaker.GetState()
+	err := c.circuitBreaker.Call(fn)
+	if errors.Is(err, ErrCircuitOpen) {
+		span.AddEvent("circuit open")
+	} else if err != nil && before != CircuitOpen && c.circuitBreaker.GetState() == CircuitOpen {
+		c.events.Publish(Event{Type: EventCircuitOpened, VIN: c.vin, Data: CircuitOpened{
+			Operation: operation,
+			Error:     err.Error(),
+		}})
+	}
+	span.RecordError(err)
+	return err
+}
+
+// CircuitOpened is the data of EventCircuitOpened
+type CircuitOpened struct {
+	Operation string `json:"operation"` // The operation whose failure opened it
+	Error     string `json:"error"`
 }
 
 // calculateDelay calculates the delay for the given attempt using exponential backoff
 func (c *Client) calculateDelay(attempt int) time.Duration {
-	delay := float64(c.retryConfig.InitialDelay) * math.Pow(c.retryConfig.BackoffFactor, float64(attempt))
+	return c.nextDelay(attempt, 0)
+}
+
+// nextDelay calculates the delay before retrying after attempt, given the
+// previous delay, or 0 before the first retry
+func (c *Client) nextDelay(attempt int, previous time.Duration) time.Duration {
+	retry := c.retrySettings()
+	delay := math.Min(float64(retry.InitialDelay)*math.Pow(retry.BackoffFactor, float64(attempt)), float64(retry.MaxDelay))
 	
-	// Cap at max delay
-	if delay > float64(c.retryConfig.MaxDelay) {
-		delay = float64(c.retryConfig.MaxDelay)
+	// Add jitter if enabled
+	if retry.Jitter {
+		switch retry.JitterStrategy {
+		case JitterFull:
+			delay *= c.randFloat()
+		case JitterDecorrelated:
+			if previous < retry.InitialDelay {
+				previous = retry.InitialDelay
+			}
+			low := float64(retry.InitialDelay)
+			delay = low + c.randFloat()*(3*float64(previous)-low)
+		default:
+			// Up to 12.5% either way
+			delay += delay * 0.25 * (c.randFloat() - 0.5)
+		}
 	}
 	
-	// Add jitter if enabled
-	if c.retryConfig.Jitter {
-		// Add up to 25% jitter
-		jitter := delay * 0.25 * (0.5 - math.Mod(float64(time.Now().UnixNano()), 1.0))
-		delay += jitter
+	// Cap at max delay, jitter included
+	if delay > float64(retry.MaxDelay) {
+		delay = float64(retry.MaxDelay)
 	}
 	
 	return time.Duration(delay)
 }
 
+// randFloat returns a random number in [0, 1) from the client's own source,
+// so clients started together don't retry in step
+func (c *Client) randFloat() float64 {
+	c.rngMutex.Lock()
+	defer c.rngMutex.Unlock()
+	if c.rng == nil {
+		seed := fnv.New64a()
+		seed.Write([]byte(c.vin))
+		c.rng = rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(seed.Sum64())))
+	}
+	return c.rng.Float64()
+}
+
+// logFor returns the client's logger, tagging messages with the ID of the
+// HTTP request in ctx
+func (c *Client) logFor(ctx context.Context) *log.Logger {
+	return logging.ForContext(ctx, c.logger)
+}
+
 // withTimeout wraps a context with a timeout
 func (c *Client) withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(ctx, timeout)
@@ -337,8 +656,10 @@ func (c *Client) checkConnectionHealth(ctx context.Context) error {
 		return ErrNotConnected
 	}
 	
-	// Try to get a simple state to verify connection
-	_, err := c.vehicle.GetState(ctx, vehicle.StateCategoryClimate)
+	// A session ping is enough to verify the connection
+	start := time.Now()
+	err := c.Ping(ctx)
+	c.recordHealth(start, err)
 	if err != nil {
 		c.logger.Printf("Health check failed: %v", err)
 		return fmt.Errorf("%w: %v", ErrConnectionLost, err)
@@ -360,7 +681,7 @@ func (c *Client) ensureConnection(ctx context.Context, privateKeyFile string) er
 		c.logger.Printf("Connection health check failed, attempting to reconnect: %v", err)
 		
 		// Close existing connection
-		c.Disconnect()
+		c.dropConnection(err)
 		
 		// Attempt to reconnect
 		return c.Connect(ctx, privateKeyFile)
@@ -369,161 +690,80 @@ func (c *Client) ensureConnection(ctx context.Context, privateKeyFile string) er
 	return nil
 }
 
-// Connect establishes a BLE connection to the Tesla vehicle with retry logic
+// Connect establishes a connection to the Tesla vehicle over the configured
+// transport with retry logic
 func (c *Client) Connect(ctx context.Context, privateKeyFile string) error {
 	// Add timeout to connection process
-	connectCtx, cancel := c.withTimeout(ctx, 60*time.Second)
+	connectCtx, cancel := c.withTimeout(ctx, c.connectionTimeout(60*time.Second))
 	defer cancel()
 	
-	return c.retryWithBackoff(connectCtx, "connect", func() error {
+	err := c.retryWithBackoff(connectCtx, "connect", func() error {
 		return c.connectInternal(connectCtx, privateKeyFile)
 	})
+	if err == nil {
+		c.setKeepConnected(true)
+		c.events.Publish(Event{Type: EventConnected, VIN: c.vin})
+	} else {
+		c.setConnectionState(StateError, err)
+	}
+	return err
 }
 
-// ConnectWithConfig establishes a BLE connection using configuration settings
+// ConnectWithConfig establishes a connection using configuration settings
 func (c *Client) ConnectWithConfig(ctx context.Context, config *Config) error {
 	// Use connection timeout from config
 	connectCtx, cancel := c.withTimeout(ctx, config.Tesla.ConnectionTimeout)
 	defer cancel()
 	
-	return c.retryWithBackoff(connectCtx, "connect", func() error {
+	err := c.retryWithBackoff(connectCtx, "connect", func() error {
 		return c.connectInternalWithConfig(connectCtx, config)
 	})
+	if err == nil {
+		c.setKeepConnected(true)
+		c.events.Publish(Event{Type: EventConnected, VIN: c.vin})
+	} else {
+		c.setConnectionState(StateError, err)
+	}
+	return err
 }
 
 // connectInternalWithConfig performs the actual connection logic using config
 func (c *Client) connectInternalWithConfig(ctx context.Context, config *Config) error {
-	c.logger.Printf("Scanning for vehicle VIN: %s", config.Tesla.VIN)
-	
-	// Use scan timeout from config
-	scanCtx, cancel := c.withTimeout(ctx, config.Tesla.ScanTimeout)
-	defer cancel()
-	
-	// Scan for the vehicle with retries
-	var scan *ble.ScanResult
-	var err error
-	
-	for attempt := 0; attempt < config.Tesla.ScanRetries; attempt++ {
-		scan, err = ble.ScanVehicleBeacon(scanCtx, config.Tesla.VIN)
-		if err == nil {
-			break
-		}
-		
-		if attempt < config.Tesla.ScanRetries-1 {
-			c.logger.Printf("Scan attempt %d failed: %v. Retrying in %v", 
-				attempt+1, err, config.Tesla.ScanDelay)
-			time.Sleep(config.Tesla.ScanDelay)
-		}
-	}
-	
-	if err != nil {
-		return fmt.Errorf("failed to scan for vehicle after %d attempts: %w", 
-			config.Tesla.ScanRetries, err)
-	}
-	
-	c.logger.Printf("Found vehicle: %s (%s) %ddBm", scan.LocalName, scan.Address, scan.RSSI)
-	
-	// Create BLE connection
-	conn, err := ble.NewConnectionFromScanResult(ctx, config.Tesla.VIN, scan)
-	if err != nil {
-		return fmt.Errorf("failed to create BLE connection: %w", err)
-	}
-	c.conn = conn
-	
-	// Load private key if provided
-	var privateKey authentication.ECDHPrivateKey
-	if config.Tesla.PrivateKeyFile != "" {
-		privateKey, err = protocol.LoadPrivateKey(config.Tesla.PrivateKeyFile)
-		if err != nil {
-			return fmt.Errorf("failed to load private key: %w", err)
-		}
-	}
-	
-	// Create vehicle instance
-	car, err := vehicle.NewVehicle(conn, privateKey, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create vehicle instance: %w", err)
-	}
-	c.vehicle = car
-	
-	// Connect to vehicle
-	if err := car.Connect(ctx); err != nil {
-		return fmt.Errorf("failed to connect to vehicle: %w", err)
-	}
-	
-	// Start session for authenticated commands
-	if err := car.StartSession(ctx, []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT}); err != nil {
-		return fmt.Errorf("failed to start session: %w", err)
-	}
-	
-	c.logger.Println("Successfully connected to Tesla vehicle")
-	return nil
+	return c.connectVia(ctx, c.transportChain(bleTransportFromConfig(config)), config.Tesla.PrivateKeyFile)
 }
 
 // connectInternal performs the actual connection logic
 func (c *Client) connectInternal(ctx context.Context, privateKeyFile string) error {
-	c.logger.Printf("Scanning for vehicle VIN: %s", c.vin)
-	
-	// Scan for the vehicle
-	scan, err := ble.ScanVehicleBeacon(ctx, c.vin)
-	if err != nil {
-		return fmt.Errorf("failed to scan for vehicle: %w", err)
-	}
-	
-	c.logger.Printf("Found vehicle: %s (%s) %ddBm", scan.LocalName, scan.Address, scan.RSSI)
-	
-	// Create BLE connection
-	conn, err := ble.NewConnectionFromScanResult(ctx, c.vin, scan)
-	if err != nil {
-		return fmt.Errorf("failed to create BLE connection: %w", err)
-	}
-	c.conn = conn
-	
-	// Load private key if provided
-	var privateKey authentication.ECDHPrivateKey
-	if privateKeyFile != "" {
-		privateKey, err = protocol.LoadPrivateKey(privateKeyFile)
-		if err != nil {
-			return fmt.Errorf("failed to load private key: %w", err)
-		}
-	}
-	
-	// Create vehicle instance
-	car, err := vehicle.NewVehicle(conn, privateKey, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create vehicle instance: %w", err)
-	}
-	c.vehicle = car
-	
-	// Connect to vehicle
-	if err := car.Connect(ctx); err != nil {
-		return fmt.Errorf("failed to connect to vehicle: %w", err)
-	}
-	
-	// Start session for authenticated commands
-	if err := car.StartSession(ctx, []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT}); err != nil {
-		return fmt.Errorf("failed to start session: %w", err)
-	}
-	
-	c.logger.Println("Successfully connected to Tesla vehicle")
-	return nil
+	return c.connectVia(ctx, c.transportChain(c.scan), privateKeyFile)
 }
 
 // Disconnect closes the connection to the vehicle
 func (c *Client) Disconnect() {
-	if c.vehicle != nil {
-		c.vehicle.Disconnect()
-	}
-	if c.conn != nil {
-		c.conn.Close()
-	}
+	c.setKeepConnected(false)
+	c.closeConnection()
 	c.logger.Println("Disconnected from Tesla vehicle")
+	c.events.Publish(Event{Type: EventDisconnected, VIN: c.vin})
+	c.setConnectionState(StateDisconnected, nil)
 }
 
-// GetHVACState retrieves the current HVAC state from the vehicle with retry logic
+// GetHVACState retrieves the current HVAC state from the vehicle with retry
+// logic. Concurrent calls share a single read of the vehicle.
 func (c *Client) GetHVACState(ctx context.Context) (*HVACState, error) {
+	value, _, err := c.reads.do(ctx, "get_hvac_state", func(ctx context.Context) (interface{}, error) {
+		return c.readHVACState(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Each caller gets its own copy of the shared result
+	state := *value.(*HVACState)
+	return &state, nil
+}
+
+// readHVACState reads the HVAC state from the vehicle
+func (c *Client) readHVACState(ctx context.Context) (*HVACState, error) {
 	// Add timeout to state retrieval
-	stateCtx, cancel := c.withTimeout(ctx, 10*time.Second)
+	stateCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
 	defer cancel()
 	
 	var result *HVACState
@@ -544,23 +784,7 @@ func (c *Client) GetHVACState(ctx context.Context) (*HVACState, error) {
 			return fmt.Errorf("no climate state data received")
 		}
 		
-		result = &HVACState{
-			IsOn:                climateState.GetIsClimateOn(),
-			DriverTempCelsius:   climateState.GetDriverTempSetting(),
-			PassengerTempCelsius: climateState.GetPassengerTempSetting(),
-			InsideTempCelsius:   climateState.GetInsideTempCelsius(),
-			OutsideTempCelsius:  climateState.GetOutsideTempCelsius(),
-			FanStatus:           climateState.GetFanStatus(),
-			IsFrontDefrosterOn:  climateState.GetIsFrontDefrosterOn(),
-			IsRearDefrosterOn:   climateState.GetIsRearDefrosterOn(),
-			IsAutoConditioning:  climateState.GetIsAutoConditioningOn(),
-			MinTempCelsius:      climateState.GetMinAvailTempCelsius(),
-			MaxTempCelsius:      climateState.GetMaxAvailTempCelsius(),
-			LeftTempDirection:   climateState.GetLeftTempDirection(),
-			RightTempDirection:  climateState.GetRightTempDirection(),
-			IsPreconditioning:   climateState.GetIsPreconditioning(),
-			BioweaponModeOn:     climateState.GetBioweaponModeOn(),
-		}
+		result = hvacStateFrom(climateState)
 		
 		return nil
 	})
@@ -569,30 +793,78 @@ func (c *Client) GetHVACState(ctx context.Context) (*HVACState, error) {
 		return nil, err
 	}
 	
+	c.recordState(result)
 	return result, nil
 }
 
+// hvacStateFrom converts the vehicle's climate state
+func hvacStateFrom(climateState *carserver.ClimateState) *HVACState {
+	return &HVACState{
+		IsOn:                   climateState.GetIsClimateOn(),
+		DriverTempCelsius:      climateState.GetDriverTempSetting(),
+		PassengerTempCelsius:   climateState.GetPassengerTempSetting(),
+		InsideTempCelsius:      climateState.GetInsideTempCelsius(),
+		OutsideTempCelsius:     climateState.GetOutsideTempCelsius(),
+		FanStatus:              climateState.GetFanStatus(),
+		IsFrontDefrosterOn:     climateState.GetIsFrontDefrosterOn(),
+		IsRearDefrosterOn:      climateState.GetIsRearDefrosterOn(),
+		IsAutoConditioning:     climateState.GetIsAutoConditioningOn(),
+		MinTempCelsius:         climateState.GetMinAvailTempCelsius(),
+		MaxTempCelsius:         climateState.GetMaxAvailTempCelsius(),
+		LeftTempDirection:      climateState.GetLeftTempDirection(),
+		RightTempDirection:     climateState.GetRightTempDirection(),
+		IsPreconditioning:      climateState.GetIsPreconditioning(),
+		BioweaponModeOn:        climateState.GetBioweaponModeOn(),
+		OverheatProtection:     overheatProtectionState(climateState),
+		ClimateKeeperMode:      climateKeeperMode(climateState),
+		SteeringWheelHeater:    climateState.GetSteeringWheelHeater(),
+		SteeringWheelHeatLevel: steeringWheelHeatLevel(climateState),
+	}
+}
+
 // SetTemperature sets the driver and passenger temperature with retry logic
-func (c *Client) SetTemperature(ctx context.Context, driverTemp, passengerTemp float32) error {
-	// Add timeout to temperature setting
-	tempCtx, cancel := c.withTimeout(ctx, 15*time.Second)
-	defer cancel()
+func (c *Client) SetTemperature(ctx context.Context, driverTemp, passengerTemp float32) (err error) {
+	if err := c.runCommandHooks(ctx, "set_temperature", map[string]interface{}{"driver_temp": driverTemp, "passenger_temp": passengerTemp}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_temperature", err) }()
 	
-	return c.retryWithBackoff(tempCtx, "set_temperature", func() error {
-		if c.vehicle == nil {
-			return ErrNotConnected
-		}
-		
-		c.logger.Printf("Setting temperature - Driver: %.1f°C, Passenger: %.1f°C", driverTemp, passengerTemp)
-		
-		return c.vehicle.ChangeClimateTemp(tempCtx, driverTemp, passengerTemp)
+	return c.limitSetpoint(ctx, "set_temperature", func(ctx context.Context) error {
+		// Add timeout to temperature setting
+		tempCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+		defer cancel()
+
+		return c.retryWithBackoff(tempCtx, "set_temperature", func() error {
+			if c.vehicle == nil {
+				return ErrNotConnected
+			}
+
+			logging.Debugf(c.logFor(ctx), "Setting temperature - Driver: %.1f°C, Passenger: %.1f°C", driverTemp, passengerTemp)
+
+			return c.vehicle.ChangeClimateTemp(tempCtx, driverTemp, passengerTemp)
+		})
 	})
 }
 
-// SetClimateOn turns the climate system on with retry logic
+// SetClimateOn turns the climate system on with retry logic, unless the
+// battery guard refuses it
 func (c *Client) SetClimateOn(ctx context.Context) error {
+	if err := c.CheckClimateConditions(ctx, "set_climate_on", ClimateConditions{}); err != nil {
+		return err
+	}
+	return c.setClimateOn(ctx)
+}
+
+// setClimateOn turns the climate system on once the caller has checked the
+// battery guard
+func (c *Client) setClimateOn(ctx context.Context) (err error) {
+	if err := c.runCommandHooks(ctx, "set_climate_on", nil); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_climate_on", err) }()
+	
 	// Add timeout to climate control
-	climateCtx, cancel := c.withTimeout(ctx, 10*time.Second)
+	climateCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
 	defer cancel()
 	
 	return c.retryWithBackoff(climateCtx, "set_climate_on", func() error {
@@ -600,15 +872,20 @@ func (c *Client) SetClimateOn(ctx context.Context) error {
 			return ErrNotConnected
 		}
 		
-		c.logger.Println("Turning climate system on")
+		c.logFor(ctx).Println("Turning climate system on")
 		return c.vehicle.ClimateOn(climateCtx)
 	})
 }
 
 // SetClimateOff turns the climate system off with retry logic
-func (c *Client) SetClimateOff(ctx context.Context) error {
+func (c *Client) SetClimateOff(ctx context.Context) (err error) {
+	if err := c.runCommandHooks(ctx, "set_climate_off", nil); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_climate_off", err) }()
+	
 	// Add timeout to climate control
-	climateCtx, cancel := c.withTimeout(ctx, 10*time.Second)
+	climateCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
 	defer cancel()
 	
 	return c.retryWithBackoff(climateCtx, "set_climate_off", func() error {
@@ -616,73 +893,73 @@ func (c *Client) SetClimateOff(ctx context.Context) error {
 			return ErrNotConnected
 		}
 		
-		c.logger.Println("Turning climate system off")
+		c.logFor(ctx).Println("Turning climate system off")
 		return c.vehicle.ClimateOff(climateCtx)
 	})
 }
 
 // SetFanSpeed sets the fan speed level
-func (c *Client) SetFanSpeed(ctx context.Context, speed FanSpeed) error {
-	if c.vehicle == nil {
-		return fmt.Errorf("not connected to vehicle")
-	}
-	
-	c.logger.Printf("Setting fan speed to: %d", speed)
-	
-	// Convert FanSpeed to int32 for the vehicle command
-	speedInt := int32(speed)
-	if speed == FanSpeedAuto {
-		speedInt = -1 // Use -1 for auto mode
+func (c *Client) SetFanSpeed(ctx context.Context, speed FanSpeed) (err error) {
+	if err := c.runCommandHooks(ctx, "set_fan_speed", map[string]interface{}{"speed": int(speed)}); err != nil {
+		return err
 	}
+	defer func() { c.commandSent("set_fan_speed", err) }()
 	
-	// Note: The Tesla library doesn't have direct fan speed control
-	// This would need to be implemented using low-level commands
-	// For now, we'll log the request and return an error
-	return fmt.Errorf("fan speed control not yet implemented - would set to %d", speedInt)
-}
-
-// GetFanSpeed returns the current fan speed level with retry logic
-func (c *Client) GetFanSpeed(ctx context.Context) (FanSpeed, error) {
-	// Add timeout to fan speed retrieval
-	fanCtx, cancel := c.withTimeout(ctx, 10*time.Second)
-	defer cancel()
-	
-	var result FanSpeed
-	err := c.retryWithBackoff(fanCtx, "get_fan_speed", func() error {
-		state, err := c.GetHVACState(fanCtx)
-		if err != nil {
-			return fmt.Errorf("failed to get HVAC state: %w", err)
+	return c.limitSetpoint(ctx, "set_fan_speed", func(ctx context.Context) error {
+		if c.vehicle == nil {
+			return ErrNotConnected
 		}
-		
-		// Convert fan status to FanSpeed enum
-		fanStatus := state.FanStatus
-		if fanStatus == -1 {
-			result = FanSpeedAuto
-		} else if fanStatus == 0 {
-			result = FanSpeedOff
-		} else if fanStatus > 0 && fanStatus <= 10 {
-			result = FanSpeed(fanStatus)
-		} else {
-			return fmt.Errorf("unknown fan status: %d", fanStatus)
+
+		logging.Debugf(c.logFor(ctx), "Setting fan speed to: %d", speed)
+
+		// Convert FanSpeed to int32 for the vehicle command
+		speedInt := int32(speed)
+		if speed == FanSpeedAuto {
+			speedInt = -1 // Use -1 for auto mode
 		}
-		
-		return nil
+
+		// Note: The Tesla library doesn't have direct fan speed control
+		// This would need to be implemented using low-level commands
+		// For now, we'll log the request and return an error
+		return fmt.Errorf("fan speed control not yet implemented - would set to %d", speedInt)
 	})
-	
+}
+
+// GetFanSpeed returns the current fan speed level. GetHVACState retries the
+// read; it isn't nested in another retry, which would wait for a second
+// queue slot while holding one.
+func (c *Client) GetFanSpeed(ctx context.Context) (FanSpeed, error) {
+	state, err := c.GetHVACState(ctx)
 	if err != nil {
 		return FanSpeedOff, err
 	}
 	
-	return result, nil
+	// Convert fan status to FanSpeed enum
+	fanStatus := state.FanStatus
+	switch {
+	case fanStatus == -1:
+		return FanSpeedAuto, nil
+	case fanStatus == 0:
+		return FanSpeedOff, nil
+	case fanStatus > 0 && fanStatus <= 10:
+		return FanSpeed(fanStatus), nil
+	default:
+		return FanSpeedOff, fmt.Errorf("unknown fan status: %d", fanStatus)
+	}
 }
 
 // SetAirflowPattern sets the airflow direction pattern
-func (c *Client) SetAirflowPattern(ctx context.Context, pattern AirflowPattern) error {
+func (c *Client) SetAirflowPattern(ctx context.Context, pattern AirflowPattern) (err error) {
+	if err := c.runCommandHooks(ctx, "set_airflow_pattern", map[string]interface{}{"pattern": int(pattern)}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_airflow_pattern", err) }()
+	
 	if c.vehicle == nil {
-		return fmt.Errorf("not connected to vehicle")
+		return ErrNotConnected
 	}
 	
-	c.logger.Printf("Setting airflow pattern to: %d", pattern)
+	logging.Debugf(c.logFor(ctx), "Setting airflow pattern to: %d", pattern)
 	
 	// Note: The Tesla library doesn't have direct airflow pattern control
 	// This would need to be implemented using low-level commands
@@ -690,60 +967,51 @@ func (c *Client) SetAirflowPattern(ctx context.Context, pattern AirflowPattern)
 	return fmt.Errorf("airflow pattern control not yet implemented - would set to %d", pattern)
 }
 
-// GetAirflowPattern returns the current airflow pattern with retry logic
+// GetAirflowPattern returns the current airflow pattern, from a state read
+// GetHVACState retries
 func (c *Client) GetAirflowPattern(ctx context.Context) (AirflowPattern, error) {
-	// Add timeout to airflow pattern retrieval
-	airflowCtx, cancel := c.withTimeout(ctx, 10*time.Second)
-	defer cancel()
-	
-	var result AirflowPattern
-	err := c.retryWithBackoff(airflowCtx, "get_airflow_pattern", func() error {
-		state, err := c.GetHVACState(airflowCtx)
-		if err != nil {
-			return fmt.Errorf("failed to get HVAC state: %w", err)
-		}
-		
-		// Determine airflow pattern based on defroster and temperature direction settings
-		if state.IsFrontDefrosterOn {
-			if state.IsRearDefrosterOn {
-				result = AirflowFaceFeetDefrost
-			} else {
-				result = AirflowDefrost
-			}
-		} else {
-			// Use temperature direction to determine pattern
-			leftDir := state.LeftTempDirection
-			rightDir := state.RightTempDirection
-			
-			// This is a simplified mapping - actual implementation would need more logic
-			if leftDir == 1 && rightDir == 1 {
-				result = AirflowFace
-			} else if leftDir == 2 && rightDir == 2 {
-				result = AirflowFeet
-			} else if leftDir == 3 && rightDir == 3 {
-				result = AirflowFaceFeet
-			} else {
-				result = AirflowAuto
-			}
-		}
-		
-		return nil
-	})
-	
+	state, err := c.GetHVACState(ctx)
 	if err != nil {
 		return AirflowAuto, err
 	}
 	
-	return result, nil
+	// Determine airflow pattern based on defroster and temperature direction settings
+	if state.IsFrontDefrosterOn {
+		if state.IsRearDefrosterOn {
+			return AirflowFaceFeetDefrost, nil
+		}
+		return AirflowDefrost, nil
+	}
+	
+	// Use temperature direction to determine pattern
+	leftDir := state.LeftTempDirection
+	rightDir := state.RightTempDirection
+	
+	// This is a simplified mapping - actual implementation would need more logic
+	switch {
+	case leftDir == 1 && rightDir == 1:
+		return AirflowFace, nil
+	case leftDir == 2 && rightDir == 2:
+		return AirflowFeet, nil
+	case leftDir == 3 && rightDir == 3:
+		return AirflowFaceFeet, nil
+	default:
+		return AirflowAuto, nil
+	}
 }
 
 // SetDefroster sets the front and rear defroster state
-func (c *Client) SetDefroster(ctx context.Context, front, rear bool) error {
+func (c *Client) SetDefroster(ctx context.Context, front, rear bool) (err error) {
+	if err := c.runCommandHooks(ctx, "set_defroster", map[string]interface{}{"front": front, "rear": rear}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_defroster", err) }()
+	
 	if c.vehicle == nil {
-		return fmt.Errorf("not connected to vehicle")
+		return ErrNotConnected
 	}
 	
-	c.logger.Printf("Setting defroster - Front: %v, Rear: %v", front, rear)
+	logging.Debugf(c.logFor(ctx), "Setting defroster - Front: %v, Rear: %v", front, rear)
 	
 	// Note: The Tesla library doesn't have direct defroster control methods
 	// This would need to be implemented using the low-level Send method
@@ -751,88 +1019,109 @@ func (c *Client) SetDefroster(ctx context.Context, front, rear bool) error {
 	return fmt.Errorf("defroster control not yet implemented")
 }
 
-// SetAutoMode sets the auto conditioning mode
-func (c *Client) SetAutoMode(ctx context.Context, enabled bool) error {
+// SetAutoMode turns auto conditioning on or off without changing whether the
+// climate system is on
+func (c *Client) SetAutoMode(ctx context.Context, enabled bool) (err error) {
+	if err := c.runCommandHooks(ctx, "set_auto_mode", map[string]interface{}{"enabled": enabled}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_auto_mode", err) }()
+	
 	if c.vehicle == nil {
-		return fmt.Errorf("not connected to vehicle")
+		return ErrNotConnected
 	}
 	
-	c.logger.Printf("Setting auto mode to: %v", enabled)
+	// Add timeout to auto mode control
+	autoCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+	defer cancel()
 	
-	// Use the existing ClimateOn/ClimateOff methods for now
-	// A proper auto mode toggle would need to be implemented using low-level commands
-	if enabled {
-		return c.vehicle.ClimateOn(ctx)
-	} else {
-		return c.vehicle.ClimateOff(ctx)
+	// The vehicle command sets power and auto mode together, so read the
+	// current power state to preserve it
+	state, err := c.GetHVACState(autoCtx)
+	if err != nil {
+		return fmt.Errorf("failed to read climate state: %w", err)
 	}
-}
-
-// GetAutoMode returns the current auto conditioning mode with retry logic
-func (c *Client) GetAutoMode(ctx context.Context) (bool, error) {
-	// Add timeout to auto mode retrieval
-	autoCtx, cancel := c.withTimeout(ctx, 10*time.Second)
-	defer cancel()
 	
-	var result bool
-	err := c.retryWithBackoff(autoCtx, "get_auto_mode", func() error {
-		state, err := c.GetHVACState(autoCtx)
-		if err != nil {
-			return fmt.Errorf("failed to get HVAC state: %w", err)
+	return c.retryWithBackoff(autoCtx, "set_auto_mode", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
 		}
 		
-		result = state.IsAutoConditioning
-		return nil
+		logging.Debugf(c.logFor(ctx), "Setting auto mode to: %v (climate on: %v)", enabled, state.IsOn)
+		return c.vehicle.SetClimateAutoMode(autoCtx, state.IsOn, enabled)
 	})
-	
+}
+
+// GetAutoMode returns the current auto conditioning mode, from a state read
+// GetHVACState retries
+func (c *Client) GetAutoMode(ctx context.Context) (bool, error) {
+	state, err := c.GetHVACState(ctx)
 	if err != nil {
 		return false, err
 	}
-	
-	return result, nil
+	return state.IsAutoConditioning, nil
 }
 
 // SetSeatHeater sets the seat heater level for the specified seat with retry logic
-func (c *Client) SetSeatHeater(ctx context.Context, seat vehicle.SeatPosition, level vehicle.Level) error {
-	// Add timeout to seat heater control
-	heaterCtx, cancel := c.withTimeout(ctx, 10*time.Second)
-	defer cancel()
+func (c *Client) SetSeatHeater(ctx context.Context, seat vehicle.SeatPosition, level vehicle.Level) (err error) {
+	if err := c.runCommandHooks(ctx, "set_seat_heater", map[string]interface{}{"seat": int(seat), "level": int(level)}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_seat_heater", err) }()
 	
-	return c.retryWithBackoff(heaterCtx, "set_seat_heater", func() error {
-		if c.vehicle == nil {
-			return ErrNotConnected
-		}
-		
-		c.logger.Printf("Setting seat heater - Seat: %v, Level: %v", seat, level)
-		
-		// Use the existing SetSeatHeater method from the vehicle library
-		levels := map[vehicle.SeatPosition]vehicle.Level{seat: level}
-		return c.vehicle.SetSeatHeater(heaterCtx, levels)
+	return c.limitSetpoint(ctx, fmt.Sprintf("set_seat_heater:%d", seat), func(ctx context.Context) error {
+		// Add timeout to seat heater control
+		heaterCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+		defer cancel()
+
+		return c.retryWithBackoff(heaterCtx, "set_seat_heater", func() error {
+			if c.vehicle == nil {
+				return ErrNotConnected
+			}
+
+			logging.Debugf(c.logFor(ctx), "Setting seat heater - Seat: %v, Level: %v", seat, level)
+
+			// Use the existing SetSeatHeater method from the vehicle library
+			levels := map[vehicle.SeatPosition]vehicle.Level{seat: level}
+			return c.vehicle.SetSeatHeater(heaterCtx, levels)
+		})
 	})
 }
 
 // SetSeatCooler sets the seat cooler level for the specified seat with retry logic
-func (c *Client) SetSeatCooler(ctx context.Context, seat vehicle.SeatPosition, level vehicle.Level) error {
-	// Add timeout to seat cooler control
-	coolerCtx, cancel := c.withTimeout(ctx, 10*time.Second)
-	defer cancel()
+func (c *Client) SetSeatCooler(ctx context.Context, seat vehicle.SeatPosition, level vehicle.Level) (err error) {
+	if err := c.runCommandHooks(ctx, "set_seat_cooler", map[string]interface{}{"seat": int(seat), "level": int(level)}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_seat_cooler", err) }()
 	
-	return c.retryWithBackoff(coolerCtx, "set_seat_cooler", func() error {
-		if c.vehicle == nil {
-			return ErrNotConnected
-		}
-		
-		c.logger.Printf("Setting seat cooler - Seat: %v, Level: %v", seat, level)
-		
-		// Use the existing SetSeatCooler method from the vehicle library
-		return c.vehicle.SetSeatCooler(coolerCtx, level, seat)
+	return c.limitSetpoint(ctx, fmt.Sprintf("set_seat_cooler:%d", seat), func(ctx context.Context) error {
+		// Add timeout to seat cooler control
+		coolerCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+		defer cancel()
+
+		return c.retryWithBackoff(coolerCtx, "set_seat_cooler", func() error {
+			if c.vehicle == nil {
+				return ErrNotConnected
+			}
+
+			logging.Debugf(c.logFor(ctx), "Setting seat cooler - Seat: %v, Level: %v", seat, level)
+
+			// Use the existing SetSeatCooler method from the vehicle library
+			return c.vehicle.SetSeatCooler(coolerCtx, level, seat)
+		})
 	})
 }
 
 // SetSteeringWheelHeater sets the steering wheel heater state with retry logic
-func (c *Client) SetSteeringWheelHeater(ctx context.Context, enabled bool) error {
+func (c *Client) SetSteeringWheelHeater(ctx context.Context, enabled bool) (err error) {
+	if err := c.runCommandHooks(ctx, "set_steering_wheel_heater", map[string]interface{}{"enabled": enabled}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_steering_wheel_heater", err) }()
+	
 	// Add timeout to steering wheel heater control
-	steeringCtx, cancel := c.withTimeout(ctx, 10*time.Second)
+	steeringCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
 	defer cancel()
 	
 	return c.retryWithBackoff(steeringCtx, "set_steering_wheel_heater", func() error {
@@ -840,7 +1129,7 @@ func (c *Client) SetSteeringWheelHeater(ctx context.Context, enabled bool) error
 			return ErrNotConnected
 		}
 		
-		c.logger.Printf("Setting steering wheel heater to: %v", enabled)
+		logging.Debugf(c.logFor(ctx), "Setting steering wheel heater to: %v", enabled)
 		
 		// Use the existing SetSteeringWheelHeater method from the vehicle library
 		return c.vehicle.SetSteeringWheelHeater(steeringCtx, enabled)
@@ -848,9 +1137,14 @@ func (c *Client) SetSteeringWheelHeater(ctx context.Context, enabled bool) error
 }
 
 // SetPreconditioningMax sets the preconditioning max mode with retry logic
-func (c *Client) SetPreconditioningMax(ctx context.Context, enabled bool, manualOverride bool) error {
+func (c *Client) SetPreconditioningMax(ctx context.Context, enabled bool, manualOverride bool) (err error) {
+	if err := c.runCommandHooks(ctx, "set_preconditioning_max", map[string]interface{}{"enabled": enabled, "manual_override": manualOverride}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_preconditioning_max", err) }()
+	
 	// Add timeout to preconditioning control
-	precondCtx, cancel := c.withTimeout(ctx, 15*time.Second)
+	precondCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
 	defer cancel()
 	
 	return c.retryWithBackoff(precondCtx, "set_preconditioning_max", func() error {
@@ -858,7 +1152,7 @@ func (c *Client) SetPreconditioningMax(ctx context.Context, enabled bool, manual
 			return ErrNotConnected
 		}
 		
-		c.logger.Printf("Setting preconditioning max - Enabled: %v, Manual Override: %v", enabled, manualOverride)
+		logging.Debugf(c.logFor(ctx), "Setting preconditioning max - Enabled: %v, Manual Override: %v", enabled, manualOverride)
 		
 		// Use the existing SetPreconditioningMax method from the vehicle library
 		return c.vehicle.SetPreconditioningMax(precondCtx, enabled, manualOverride)
@@ -866,9 +1160,14 @@ func (c *Client) SetPreconditioningMax(ctx context.Context, enabled bool, manual
 }
 
 // SetBioweaponDefenseMode sets the bioweapon defense mode with retry logic
-func (c *Client) SetBioweaponDefenseMode(ctx context.Context, enabled bool, manualOverride bool) error {
+func (c *Client) SetBioweaponDefenseMode(ctx context.Context, enabled bool, manualOverride bool) (err error) {
+	if err := c.runCommandHooks(ctx, "set_bioweapon_defense_mode", map[string]interface{}{"enabled": enabled, "manual_override": manualOverride}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_bioweapon_defense_mode", err) }()
+	
 	// Add timeout to bioweapon defense control
-	bioCtx, cancel := c.withTimeout(ctx, 15*time.Second)
+	bioCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
 	defer cancel()
 	
 	return c.retryWithBackoff(bioCtx, "set_bioweapon_defense_mode", func() error {
@@ -876,7 +1175,7 @@ func (c *Client) SetBioweaponDefenseMode(ctx context.Context, enabled bool, manu
 			return ErrNotConnected
 		}
 		
-		c.logger.Printf("Setting bioweapon defense mode - Enabled: %v, Manual Override: %v", enabled, manualOverride)
+		logging.Debugf(c.logFor(ctx), "Setting bioweapon defense mode - Enabled: %v, Manual Override: %v", enabled, manualOverride)
 		
 		// Use the existing SetBioweaponDefenseMode method from the vehicle library
 		return c.vehicle.SetBioweaponDefenseMode(bioCtx, enabled, manualOverride)
@@ -893,6 +1192,16 @@ func (c *Client) GetVIN() string {
 	return c.vin
 }
 
+// GetPrivateKeyFile returns the configured private key file path
+func (c *Client) GetPrivateKeyFile() string {
+	return c.privateKeyFile
+}
+
+// SetPrivateKeyFile sets the private key file used for authenticated sessions
+func (c *Client) SetPrivateKeyFile(privateKeyFile string) {
+	c.privateKeyFile = privateKeyFile
+}
+
 // SetTimeout sets the timeout for vehicle operations
 func (c *Client) SetTimeout(timeout time.Duration) {
 	// This would be implemented by setting context timeouts
@@ -0,0 +1,179 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxClimateDuration bounds how long climate can be turned on for with an
+// auto-off timer
+const MaxClimateDuration = 12 * time.Hour
+
+// climateOffRetry is how long a failed auto-off waits before trying again,
+// unless the vehicle reconnects sooner
+const climateOffRetry = 30 * time.Second
+
+// ClimateTimer is a vehicle's pending automatic climate off
+type ClimateTimer struct {
+	Active    bool      `json:"active"`
+	OffAt     time.Time `json:"off_at,omitempty"`
+	Attempts  int       `json:"attempts,omitempty"` // Failed attempts to turn climate off
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// climateTimer holds a client's auto-off timer. The zero value has no timer.
+type climateTimer struct {
+	mu     sync.Mutex
+	status ClimateTimer
+	due    time.Time     // When the next attempt is due
+	change chan struct{} // Closed when the timer is set or cancelled
+}
+
+// changed returns a channel closed on the next change to the timer
+func (t *climateTimer) changed() <-chan struct{} {
+	if t.change == nil {
+		t.change = make(chan struct{})
+	}
+	return t.change
+}
+
+// notify wakes RunClimateTimer after a change
+func (t *climateTimer) notify() {
+	if t.change != nil {
+		close(t.change)
+		t.change = nil
+	}
+}
+
+// SetClimateOnFor turns climate on, subject to the charge conditions, and
+// turns it off again after d. The timer lasts across reconnects and
+// replaces any earlier one. It needs RunClimateTimer to be running.
+func (c *Client) SetClimateOnFor(ctx context.Context, cond ClimateConditions, d time.Duration) error {
+	if err := validClimateDuration(d); err != nil {
+		return err
+	}
+	if err := c.SetClimateOnIf(ctx, cond); err != nil {
+		return err
+	}
+	c.startClimateTimer(d)
+	return nil
+}
+
+// validClimateDuration checks a duration for the auto-off timer
+func validClimateDuration(d time.Duration) error {
+	if d < time.Minute || d > MaxClimateDuration {
+		return fmt.Errorf("duration must be between 1 minute and %v", MaxClimateDuration)
+	}
+	return nil
+}
+
+// startClimateTimer turns climate off after d
+func (c *Client) startClimateTimer(d time.Duration) {
+	offAt := time.Now().Add(d)
+	c.climateTimer.mu.Lock()
+	c.climateTimer.status = ClimateTimer{Active: true, OffAt: offAt}
+	c.climateTimer.due = offAt
+	c.climateTimer.notify()
+	c.climateTimer.mu.Unlock()
+
+	c.logger.Printf("Climate on for vehicle %s until %s", c.vin, offAt.Format(time.Kitchen))
+}
+
+// CancelClimateTimer cancels a pending auto-off, leaving climate as it is.
+// It reports whether there was a timer.
+func (c *Client) CancelClimateTimer() bool {
+	c.climateTimer.mu.Lock()
+	defer c.climateTimer.mu.Unlock()
+
+	active := c.climateTimer.status.Active
+	c.climateTimer.status = ClimateTimer{}
+	c.climateTimer.due = time.Time{}
+	c.climateTimer.notify()
+	return active
+}
+
+// ClimateTimer returns the pending auto-off, if any
+func (c *Client) ClimateTimer() ClimateTimer {
+	c.climateTimer.mu.Lock()
+	defer c.climateTimer.mu.Unlock()
+	return c.climateTimer.status
+}
+
+// RunClimateTimer turns climate off when an auto-off timer expires, until
+// ctx is cancelled. A failed attempt is retried every 30 seconds, and as
+// soon as the vehicle reconnects, until it succeeds or the timer is
+// cancelled.
+func (c *Client) RunClimateTimer(ctx context.Context) error {
+	events, unsubscribe := c.Events().Subscribe(8)
+	defer unsubscribe()
+
+	for {
+		c.climateTimer.mu.Lock()
+		due, attempts, changed := c.climateTimer.due, c.climateTimer.status.Attempts, c.climateTimer.changed()
+		c.climateTimer.mu.Unlock()
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if !due.IsZero() {
+			timer = time.NewTimer(time.Until(due))
+			fire = timer.C
+		}
+
+		expired := false
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case event := <-events:
+			// Retry a failed auto-off as soon as the vehicle is back
+			expired = event.Type == EventConnected && attempts > 0
+		case <-fire:
+			expired = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if expired {
+			c.expireClimateTimer(ctx, due)
+		}
+	}
+}
+
+// expireClimateTimer turns climate off for the timer due at due, unless it
+// was changed in the meantime
+func (c *Client) expireClimateTimer(ctx context.Context, due time.Time) {
+	c.climateTimer.mu.Lock()
+	current := c.climateTimer.due
+	c.climateTimer.mu.Unlock()
+	if current.IsZero() || !current.Equal(due) {
+		return
+	}
+
+	err := c.SetClimateOff(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+
+	c.climateTimer.mu.Lock()
+	defer c.climateTimer.mu.Unlock()
+	if !c.climateTimer.due.Equal(due) {
+		// Set again or cancelled while turning climate off
+		return
+	}
+	if err == nil {
+		c.logger.Printf("Climate timer expired, climate off for vehicle %s", c.vin)
+		c.climateTimer.status = ClimateTimer{}
+		c.climateTimer.due = time.Time{}
+		return
+	}
+
+	c.climateTimer.status.Attempts++
+	c.climateTimer.status.LastError = err.Error()
+	c.climateTimer.due = time.Now().Add(climateOffRetry)
+	c.logger.Printf("Climate timer failed to turn climate off for vehicle %s, retrying: %v", c.vin, err)
+}
@@ -0,0 +1,106 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForClimateTimer polls until the client's timer satisfies done
+func waitForClimateTimer(t *testing.T, client *Client, done func(ClimateTimer) bool) ClimateTimer {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if timer := client.ClimateTimer(); done(timer) {
+			return timer
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Climate timer didn't reach the expected state: %+v", client.ClimateTimer())
+	return ClimateTimer{}
+}
+
+// setClimateTimer starts a timer without turning climate on
+func setClimateTimer(client *Client, offAt time.Time) {
+	client.climateTimer.mu.Lock()
+	defer client.climateTimer.mu.Unlock()
+	client.climateTimer.status = ClimateTimer{Active: true, OffAt: offAt}
+	client.climateTimer.due = offAt
+	client.climateTimer.notify()
+}
+
+func TestSetClimateOnForNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx := context.Background()
+
+	if err := client.SetClimateOnFor(ctx, ClimateConditions{}, 30*time.Second); err == nil || errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected a duration error, got %v", err)
+	}
+	if err := client.SetClimateOnFor(ctx, ClimateConditions{}, 13*time.Hour); err == nil || errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected a duration error, got %v", err)
+	}
+	if err := client.SetClimateOnFor(ctx, ClimateConditions{}, 30*time.Minute); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+	if timer := client.ClimateTimer(); timer.Active {
+		t.Errorf("Expected no timer after a failed command, got %+v", timer)
+	}
+}
+
+func TestClimateTimerRetriesUntilCancelled(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- client.RunClimateTimer(ctx) }()
+
+	// Climate can't be turned off while disconnected, so the timer stays
+	setClimateTimer(client, time.Now().Add(20*time.Millisecond))
+	timer := waitForClimateTimer(t, client, func(timer ClimateTimer) bool { return timer.Attempts == 1 })
+	if !timer.Active || timer.LastError == "" {
+		t.Errorf("Expected the failure to be recorded, got %+v", timer)
+	}
+
+	// Reconnecting retries straight away
+	client.Events().Publish(Event{Type: EventConnected, VIN: "TEST_VIN"})
+	waitForClimateTimer(t, client, func(timer ClimateTimer) bool { return timer.Attempts == 2 })
+
+	if !client.CancelClimateTimer() {
+		t.Error("Expected a timer to cancel")
+	}
+	if client.CancelClimateTimer() {
+		t.Error("Expected no timer after cancelling")
+	}
+	if timer := client.ClimateTimer(); timer.Active || timer.Attempts != 0 {
+		t.Errorf("Expected the timer to be cleared, got %+v", timer)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunClimateTimer didn't stop")
+	}
+}
+
+func TestClimateTimerReplaced(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.RunClimateTimer(ctx)
+
+	// A later timer replaces one that hasn't expired
+	setClimateTimer(client, time.Now().Add(time.Hour))
+	offAt := time.Now().Add(2 * time.Hour)
+	setClimateTimer(client, offAt)
+
+	time.Sleep(20 * time.Millisecond)
+	if timer := client.ClimateTimer(); !timer.OffAt.Equal(offAt) || timer.Attempts != 0 {
+		t.Errorf("Expected the later timer, got %+v", timer)
+	}
+}
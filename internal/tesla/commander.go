@@ -0,0 +1,97 @@
+package tesla
+
+import (
+	"context"
+	"crypto/ecdh"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// VehicleCommander is the part of the vehicle library the client uses to
+// command a vehicle. *vehicle.Vehicle implements it over a connection and
+// SimulatedVehicle implements it in memory.
+type VehicleCommander interface {
+	Connect(ctx context.Context) error
+	StartSession(ctx context.Context, domains []universal.Domain) error
+	Disconnect()
+	Ping(ctx context.Context) error
+	Wakeup(ctx context.Context) error
+	BodyControllerState(ctx context.Context) (*vcsec.VehicleStatus, error)
+
+	GetState(ctx context.Context, category vehicle.StateCategory) (*carserver.VehicleData, error)
+	GetStates(ctx context.Context, categories ...vehicle.StateCategory) (*carserver.VehicleData, error)
+
+	ClimateOn(ctx context.Context) error
+	ClimateOff(ctx context.Context) error
+	ChangeClimateTemp(ctx context.Context, driverCelsius float32, passengerCelsius float32) error
+	SetClimateAutoMode(ctx context.Context, powerOn, auto bool) error
+	SetClimateKeeperMode(ctx context.Context, mode vehicle.ClimateKeeperMode, override bool) error
+	SetPreconditioningMax(ctx context.Context, enabled bool, manualOverride bool) error
+	SetBioweaponDefenseMode(ctx context.Context, enabled bool, manualOverride bool) error
+	SetCabinOverheatProtection(ctx context.Context, enabled bool, fanOnly bool) error
+	SetCabinOverheatProtectionTemperature(ctx context.Context, level vehicle.Level) error
+	SetSeatHeater(ctx context.Context, levels map[vehicle.SeatPosition]vehicle.Level) error
+	SetSeatCooler(ctx context.Context, level vehicle.Level, seat vehicle.SeatPosition) error
+	SetSteeringWheelHeater(ctx context.Context, enabled bool) error
+
+	ScheduleDeparture(ctx context.Context, departAt, offPeakEndTime time.Duration, preconditioning, offpeak vehicle.ChargingPolicy) error
+	ClearScheduledDeparture(ctx context.Context) error
+
+	SendAddKeyRequestWithRole(ctx context.Context, publicKey *ecdh.PublicKey, role keys.Role, formFactor vcsec.KeyFormFactor) error
+	SessionInfo(ctx context.Context, publicKey *ecdh.PublicKey, domain universal.Domain) (*signatures.SessionInfo, error)
+	KeySummary(ctx context.Context) (*vcsec.WhitelistInfo, error)
+	KeyInfoBySlot(ctx context.Context, slot uint32) (*vcsec.WhitelistEntryInfo, error)
+	RemoveKey(ctx context.Context, publicKey *ecdh.PublicKey) error
+}
+
+var _ VehicleCommander = (*vehicle.Vehicle)(nil)
+
+// Connector carries messages to and from a vehicle. BLE and Fleet API
+// connections implement it, as can a fake in tests.
+type Connector = connector.Connector
+
+// VehicleFactory creates the vehicle to command over a connection, signing
+// commands with privateKey when it is set
+type VehicleFactory func(conn Connector, privateKey authentication.ECDHPrivateKey) (VehicleCommander, error)
+
+// NewVehicleCommander is the default VehicleFactory, using the vehicle
+// library
+func NewVehicleCommander(conn Connector, privateKey authentication.ECDHPrivateKey) (VehicleCommander, error) {
+	return vehicle.NewVehicle(conn, privateKey, nil)
+}
+
+// vehicleTransport is a Transport that provides the vehicle itself, rather
+// than a connection for the client to sign commands over
+type vehicleTransport interface {
+	Commander(conn Connector) VehicleCommander
+}
+
+// SetVehicleFactory replaces how the client creates the vehicle over each
+// new connection. A nil factory restores NewVehicleCommander.
+func (c *Client) SetVehicleFactory(factory VehicleFactory) {
+	c.transportMutex.Lock()
+	defer c.transportMutex.Unlock()
+	c.vehicleFactory = factory
+}
+
+// newVehicle returns the vehicle to command over a connection from transport
+func (c *Client) newVehicle(transport Transport, conn Connector, privateKey authentication.ECDHPrivateKey) (VehicleCommander, error) {
+	if vt, ok := transport.(vehicleTransport); ok {
+		return vt.Commander(conn), nil
+	}
+	c.transportMutex.RLock()
+	factory := c.vehicleFactory
+	c.transportMutex.RUnlock()
+	if factory == nil {
+		factory = NewVehicleCommander
+	}
+	return factory(conn, privateKey)
+}
@@ -0,0 +1,345 @@
+package tesla
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// fakeConnector is a connection that records whether it was closed
+type fakeConnector struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *fakeConnector) Receive() <-chan []byte                        { return nil }
+func (c *fakeConnector) Send(ctx context.Context, buffer []byte) error { return nil }
+func (c *fakeConnector) VIN() string                                   { return "TEST_VIN" }
+func (c *fakeConnector) PreferredAuthMethod() connector.AuthMethod     { return connector.AuthMethodNone }
+func (c *fakeConnector) RetryInterval() time.Duration                  { return time.Millisecond }
+func (c *fakeConnector) AllowedLatency() time.Duration                 { return time.Second }
+
+func (c *fakeConnector) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+func (c *fakeConnector) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// fakeVehicle records the commands it is sent and fails those in errs. It
+// embeds VehicleCommander so methods a test doesn't need are left out; they
+// panic if called.
+type fakeVehicle struct {
+	VehicleCommander
+	mu      sync.Mutex
+	calls   []string
+	errs    map[string][]error // Errors returned by successive calls, then nil
+	climate *carserver.ClimateState
+}
+
+func newFakeVehicle() *fakeVehicle {
+	return &fakeVehicle{errs: map[string][]error{}, climate: &carserver.ClimateState{}}
+}
+
+// call records a call and returns its next scripted error
+func (v *fakeVehicle) call(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.calls = append(v.calls, name)
+	if errs := v.errs[name]; len(errs) > 0 {
+		v.errs[name] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (v *fakeVehicle) called(name string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	n := 0
+	for _, call := range v.calls {
+		if call == name {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *fakeVehicle) Connect(ctx context.Context) error { return v.call("Connect") }
+func (v *fakeVehicle) Disconnect()                       { v.call("Disconnect") }
+func (v *fakeVehicle) Ping(ctx context.Context) error    { return v.call("Ping") }
+
+func (v *fakeVehicle) StartSession(ctx context.Context, domains []universal.Domain) error {
+	return v.call("StartSession")
+}
+
+func (v *fakeVehicle) GetState(ctx context.Context, category vehicle.StateCategory) (*carserver.VehicleData, error) {
+	if err := v.call("GetState"); err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return &carserver.VehicleData{ClimateState: v.climate}, nil
+}
+
+func (v *fakeVehicle) ClimateOn(ctx context.Context) error {
+	if err := v.call("ClimateOn"); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.climate.OptionalIsClimateOn = &carserver.ClimateState_IsClimateOn{IsClimateOn: true}
+	return nil
+}
+
+func (v *fakeVehicle) ChangeClimateTemp(ctx context.Context, driverCelsius float32, passengerCelsius float32) error {
+	if err := v.call("ChangeClimateTemp"); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.climate.OptionalDriverTempSetting = &carserver.ClimateState_DriverTempSetting{DriverTempSetting: driverCelsius}
+	v.climate.OptionalPassengerTempSetting = &carserver.ClimateState_PassengerTempSetting{PassengerTempSetting: passengerCelsius}
+	return nil
+}
+
+func (v *fakeVehicle) SetClimateAutoMode(ctx context.Context, powerOn, auto bool) error {
+	if err := v.call("SetClimateAutoMode"); err != nil {
+		return err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.climate.OptionalIsClimateOn = &carserver.ClimateState_IsClimateOn{IsClimateOn: powerOn}
+	v.climate.OptionalIsAutoConditioningOn = &carserver.ClimateState_IsAutoConditioningOn{IsAutoConditioningOn: auto}
+	return nil
+}
+
+func (v *fakeVehicle) SendAddKeyRequestWithRole(ctx context.Context, publicKey *ecdh.PublicKey, role keys.Role, formFactor vcsec.KeyFormFactor) error {
+	return v.call("SendAddKeyRequestWithRole")
+}
+
+// SessionInfo reports every key enrolled unless a scripted error says not
+func (v *fakeVehicle) SessionInfo(ctx context.Context, publicKey *ecdh.PublicKey, domain universal.Domain) (*signatures.SessionInfo, error) {
+	if err := v.call("SessionInfo"); err != nil {
+		return nil, err
+	}
+	return &signatures.SessionInfo{Status: signatures.Session_Info_Status_SESSION_INFO_STATUS_OK}, nil
+}
+
+// newFakeClient returns a client connected to car through a fake transport
+func newFakeClient(t *testing.T, car *fakeVehicle) (*Client, *fakeConnector) {
+	t.Helper()
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0),
+		RetryConfig{MaxRetries: 2, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1},
+		CircuitBreakerConfig{MaxFailures: 1000, ResetTimeout: time.Second, HalfOpenMaxCalls: 1})
+	conn := &fakeConnector{}
+	client.SetTransports(&fakeTransport{kind: TransportBLE, conn: conn})
+	client.SetVehicleFactory(func(c Connector, privateKey authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		if c != conn {
+			t.Errorf("Expected the vehicle over the dialed connection")
+		}
+		return car, nil
+	})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	return client, conn
+}
+
+func TestClientConnectsThroughFactory(t *testing.T) {
+	car := newFakeVehicle()
+	client, conn := newFakeClient(t, car)
+
+	if !client.IsConnected() || client.ConnectionState() != StateSessionActive {
+		t.Errorf("Expected an active session, got %v", client.ConnectionState())
+	}
+	if car.called("Connect") != 1 || car.called("StartSession") != 1 {
+		t.Errorf("Expected Connect and StartSession once, got %v", car.calls)
+	}
+
+	client.Disconnect()
+	if car.called("Disconnect") != 1 || !conn.isClosed() {
+		t.Error("Expected Disconnect to close the vehicle and its connection")
+	}
+	if client.IsConnected() {
+		t.Error("Client should not be connected after Disconnect")
+	}
+}
+
+func TestClientConnectFailureClosesConnection(t *testing.T) {
+	car := newFakeVehicle()
+	car.errs["StartSession"] = []error{errors.New("key not paired")}
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0),
+		RetryConfig{MaxRetries: 0, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1},
+		CircuitBreakerConfig{MaxFailures: 1000, ResetTimeout: time.Second, HalfOpenMaxCalls: 1})
+	conn := &fakeConnector{}
+	client.SetTransports(&fakeTransport{kind: TransportBLE, conn: conn})
+	client.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return car, nil
+	})
+
+	err := client.Connect(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), "key not paired") {
+		t.Fatalf("Expected the session failure, got %v", err)
+	}
+	if !conn.isClosed() || client.IsConnected() {
+		t.Error("Expected a failed connect to close its connection")
+	}
+}
+
+func TestClientCommandsReachVehicle(t *testing.T) {
+	car := newFakeVehicle()
+	client, _ := newFakeClient(t, car)
+	ctx := context.Background()
+
+	if err := client.SetTemperature(ctx, 21.5, 22); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetClimateOn(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := client.GetHVACState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsOn || state.DriverTempCelsius != 21.5 || state.PassengerTempCelsius != 22 {
+		t.Errorf("Expected the commanded state back, got %+v", state)
+	}
+}
+
+func TestClientAutoModeKeepsPower(t *testing.T) {
+	ctx := context.Background()
+	for _, on := range []bool{false, true} {
+		car := newFakeVehicle()
+		car.climate.OptionalIsClimateOn = &carserver.ClimateState_IsClimateOn{IsClimateOn: on}
+		client, _ := newFakeClient(t, car)
+
+		for _, auto := range []bool{true, false} {
+			if err := client.SetAutoMode(ctx, auto); err != nil {
+				t.Fatal(err)
+			}
+			state, err := client.GetHVACState(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.IsOn != on || state.IsAutoConditioning != auto {
+				t.Errorf("Expected auto mode %v with climate on %v, got %+v", auto, on, state)
+			}
+		}
+		if n := car.called("SetClimateAutoMode"); n != 2 {
+			t.Errorf("Expected 2 auto mode commands, got %d", n)
+		}
+	}
+}
+
+func TestClientRetriesVehicleErrors(t *testing.T) {
+	car := newFakeVehicle()
+	client, _ := newFakeClient(t, car)
+	car.errs["ClimateOn"] = []error{errors.New("busy"), errors.New("busy")}
+
+	if err := client.SetClimateOn(context.Background()); err != nil {
+		t.Fatalf("Expected the command to succeed on the third attempt, got %v", err)
+	}
+	if n := car.called("ClimateOn"); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+
+	car.errs["ClimateOn"] = []error{errors.New("busy"), errors.New("busy"), errors.New("busy")}
+	err := client.SetClimateOn(context.Background())
+	if !errors.Is(err, ErrRetryExhausted) {
+		t.Errorf("Expected ErrRetryExhausted, got %v", err)
+	}
+}
+
+func TestClientHealthCheckPingsVehicle(t *testing.T) {
+	car := newFakeVehicle()
+	client, _ := newFakeClient(t, car)
+	client.markAwake() // Pings an awake vehicle rather than reading its sleep status
+	car.errs["Ping"] = []error{errors.New("no response")}
+
+	err := client.checkConnectionHealth(context.Background())
+	if !errors.Is(err, ErrConnectionLost) || car.called("Ping") != 1 {
+		t.Errorf("Expected a failed ping to report ErrConnectionLost, got %v", err)
+	}
+}
+
+func TestBLEManagerWithFakes(t *testing.T) {
+	manager := NewBLEManager(log.New(io.Discard, "", 0))
+	manager.scan = func(ctx context.Context, vin string) (*ble.ScanResult, error) {
+		return &ble.ScanResult{LocalName: "S1a2b3c4d5e6f7a8bC", Address: "00:11:22:33:44:55", RSSI: -60}, nil
+	}
+	conn := &fakeConnector{}
+	var dialed *ble.ScanResult
+	manager.dial = func(ctx context.Context, vin string, scan *ble.ScanResult) (Connector, error) {
+		dialed = scan
+		return conn, nil
+	}
+	car := newFakeVehicle()
+	manager.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return car, nil
+	})
+
+	bleConn, err := manager.ConnectToVehicle(context.Background(), "TEST_VIN", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if dialed == nil || dialed.Address != "00:11:22:33:44:55" {
+		t.Errorf("Expected the scanned address to be dialed, got %+v", dialed)
+	}
+	if err := bleConn.StartSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bleConn.IsSessionActive() || bleConn.GetVehicle() != car {
+		t.Error("Expected an active session on the fake vehicle")
+	}
+
+	bleConn.Disconnect()
+	if !conn.isClosed() || car.called("Disconnect") != 1 || bleConn.IsConnected() {
+		t.Error("Expected Disconnect to close the vehicle and its connection")
+	}
+}
+
+func TestBLEManagerConnectFailureClosesConnection(t *testing.T) {
+	manager := NewBLEManager(log.New(io.Discard, "", 0))
+	manager.scan = func(ctx context.Context, vin string) (*ble.ScanResult, error) {
+		return &ble.ScanResult{}, nil
+	}
+	conn := &fakeConnector{}
+	manager.dial = func(ctx context.Context, vin string, scan *ble.ScanResult) (Connector, error) {
+		return conn, nil
+	}
+	car := newFakeVehicle()
+	car.errs["Connect"] = []error{errors.New("timeout")}
+	manager.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return car, nil
+	})
+
+	if _, err := manager.ConnectToVehicle(context.Background(), "TEST_VIN", nil); err == nil {
+		t.Fatal("Expected the connect failure")
+	}
+	if !conn.isClosed() {
+		t.Error("Expected the connection to be closed after a failed connect")
+	}
+}
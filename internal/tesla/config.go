@@ -6,6 +6,20 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/acme"
+	"github.com/teslamotors/vehicle-command/internal/audit"
+	"github.com/teslamotors/vehicle-command/internal/history"
+	"github.com/teslamotors/vehicle-command/internal/homekit"
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/internal/metrics"
+	"github.com/teslamotors/vehicle-command/internal/mqtt"
+	"github.com/teslamotors/vehicle-command/internal/notify"
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/tracing"
+	"github.com/teslamotors/vehicle-command/internal/update"
+	"github.com/teslamotors/vehicle-command/internal/weather"
+	"github.com/teslamotors/vehicle-command/internal/webhook"
 )
 
 // Config represents the complete configuration for the Tesla HVAC client
@@ -13,6 +27,17 @@ type Config struct {
 	// Tesla API Configuration
 	Tesla TeslaConfig `json:"tesla"`
 
+	// Vehicles, when more than one is controlled. Each falls back to the
+	// tesla, retry, circuit_breaker and failover sections for settings it
+	// leaves out.
+	Vehicles []VehicleConfig `json:"vehicles,omitempty"`
+
+	// Tesla SSO, for refreshing the Fleet API's OAuth tokens
+	OAuth OAuthConfig `json:"oauth"`
+
+	// Where private keys and OAuth tokens are stored
+	Keyring KeyringConfig `json:"keyring"`
+
 	// Client Configuration
 	Client ClientConfig `json:"client"`
 
@@ -22,9 +47,89 @@ type Config struct {
 	// Circuit Breaker Configuration
 	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
 
+	// Wake Configuration
+	Wake WakeConfig `json:"wake"`
+
+	// Transport Failover Configuration
+	Failover FailoverConfig `json:"failover"`
+
+	// Low battery check on turning climate on
+	BatteryGuard BatteryGuardConfig `json:"battery_guard"`
+
+	// Failures injected into calls to the vehicle, for testing
+	Faults FaultConfig `json:"faults"`
+
+	// Monitoring while Dog Mode or another climate keeper mode is on
+	DogMode DogModeConfig `json:"dog_mode"`
+
+	// Async commands held while a vehicle is out of reach
+	OfflineQueue OfflineQueueConfig `json:"offline_queue"`
+
 	// Logging Configuration
 	Logging LoggingConfig `json:"logging"`
 
+	// Metrics Export Configuration
+	Metrics MetricsConfig `json:"metrics"`
+
+	// Command macros, exposed as API endpoints and CLI verbs
+	Macros []Macro `json:"macros,omitempty"`
+
+	// Named climate presets, managed through the API
+	Presets []Preset `json:"presets,omitempty"`
+
+	// Timed climate actions, managed through the API
+	Schedules []schedule.Schedule `json:"schedules,omitempty"`
+
+	// Forecast provider, and schedules that only run in some weather
+	Weather      weather.Config `json:"weather"`
+	WeatherRules []weather.Rule `json:"weather_rules,omitempty"`
+
+	// Background state polling for the history API
+	History history.Config `json:"history"`
+
+	// Log of the changes made through the API
+	Audit audit.Config `json:"audit"`
+
+	// MQTT broker for home automation
+	MQTT mqtt.Config `json:"mqtt"`
+
+	// HomeKit bridge for the Home app and Siri
+	HomeKit homekit.Config `json:"homekit"`
+
+	// OpenTelemetry collector for command traces
+	Tracing tracing.Config `json:"tracing"`
+
+	// URLs notified of climate changes and alerts
+	Webhooks webhook.Config `json:"webhooks"`
+
+	// Email, Pushover and Telegram for alerts and schedules
+	Notifications notify.Config `json:"notifications"`
+
+	// Keys that grant access to the HTTP API. Changes apply on reload.
+	APIKeys []APIKey `json:"api_keys,omitempty"`
+
+	// HTTPS for the HVAC server
+	TLS TLSConfig `json:"tls"`
+
+	// Public key served for Fleet API partner registration
+	PublicKey PublicKeyConfig `json:"public_key"`
+
+	// Release update checks
+	Update update.Config `json:"update"`
+
+	// Directory for local state such as presets, schedules and history.
+	// Defaults to a "data" directory next to the config file.
+	DataDir string `json:"data_dir,omitempty"`
+
+	// How many earlier versions of the config file Save keeps next to it;
+	// 0 keeps DefaultConfigBackups and -1 none
+	ConfigBackups int `json:"config_backups,omitempty"`
+
+	// Named sets of overrides, such as home and garage, merged over the rest
+	// of the file as JSON merge patches, and the one in use
+	Profile  string                     `json:"profile,omitempty"`
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+
 	// File paths
 	ConfigPath string `json:"-"` // Path to config file (not serialized)
 }
@@ -38,17 +143,25 @@ type TeslaConfig struct {
 	PrivateKeyFile string `json:"private_key_file"`
 	OAuthTokenFile string `json:"oauth_token_file"`
 
+	// Transport
+	Transport    string `json:"transport"`                // ble or fleet
+	FleetAPIHost string `json:"fleet_api_host,omitempty"` // Fleet API server for the fleet transport
+
 	// Connection Settings
 	ConnectionTimeout time.Duration `json:"connection_timeout"`
 	ScanTimeout       time.Duration `json:"scan_timeout"`
 
 	// API Settings
-	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+	MaxConcurrentRequests int `json:"max_concurrent_requests"` // Commands run against the vehicle at once
+	MaxQueuedRequests     int `json:"max_queued_requests"`     // Commands waiting for a turn before more are rejected
 	RequestTimeout        time.Duration `json:"request_timeout"`
+	SetpointInterval      time.Duration `json:"setpoint_interval"` // Min time between writes of each setpoint (0 disables)
+	StateCacheTTL         time.Duration `json:"state_cache_ttl"`   // How long a read HVAC state is served from cache (0 disables)
 
 	// Vehicle Discovery
 	ScanRetries int `json:"scan_retries"`
 	ScanDelay   time.Duration `json:"scan_delay"`
+	DirectConnectTimeout time.Duration `json:"direct_connect_timeout"` // Time to connect at the last-known BLE address before scanning (0 always scans)
 }
 
 // ClientConfig holds client-specific configuration
@@ -58,36 +171,196 @@ type ClientConfig struct {
 	ClientVersion string `json:"client_version"`
 
 	// Connection Management
-	KeepAliveInterval time.Duration `json:"keep_alive_interval"`
+	KeepAliveInterval time.Duration `json:"keep_alive_interval"` // Ping idle BLE sessions this often (0 disables)
 	HealthCheckInterval time.Duration `json:"health_check_interval"`
+	ReconnectInterval   time.Duration `json:"reconnect_interval"`  // How often a dropped session is checked for, and the first reconnect backoff
+	ReconnectMaxDelay   time.Duration `json:"reconnect_max_delay"` // Longest wait between reconnect attempts
 
 	// Feature Flags
 	EnableAutoReconnect bool `json:"enable_auto_reconnect"`
 	EnableHealthChecks  bool `json:"enable_health_checks"`
 	EnableMetrics       bool `json:"enable_metrics"`
+	EnableSessionCache  bool `json:"enable_session_cache"` // Resume vehicle sessions across reconnects and restarts
 }
 
-// LoggingConfig holds logging configuration
-type LoggingConfig struct {
-	Level      string `json:"level"`      // debug, info, warn, error
-	Format     string `json:"format"`     // json, text
-	Output     string `json:"output"`     // stdout, stderr, file
-	FilePath   string `json:"file_path"`  // Path to log file (if output is file)
-	MaxSize    int    `json:"max_size"`   // Max log file size in MB
-	MaxBackups int    `json:"max_backups"` // Max number of backup files
-	MaxAge     int    `json:"max_age"`    // Max age in days
+// WakeConfig controls whether the client wakes a sleeping vehicle before
+// issuing commands
+type WakeConfig struct {
+	OnDemand bool          `json:"on_demand"` // Wake the vehicle automatically before commands
+	MaxWait  time.Duration `json:"max_wait"`  // Max time to wait for the vehicle to wake
+
+	// Batching of non-urgent background work into awake windows
+	AwakeWindow     time.Duration `json:"awake_window"`     // How long an awake observation is trusted
+	ProbeInterval   time.Duration `json:"probe_interval"`   // Min time between sleep status checks while work is pending
+	RefreshInterval time.Duration `json:"refresh_interval"` // Refresh the cached HVAC state this often while awake (0 disables)
+}
+
+// FailoverConfig controls falling back to a second transport when the
+// primary one can't reach the vehicle, such as BLE out of range
+type FailoverConfig struct {
+	Enabled      bool          `json:"enabled"`
+	Fallback     string        `json:"fallback"`      // Transport to fall back to
+	RetryPrimary time.Duration `json:"retry_primary"` // How long after failing over the fallback is tried first
 }
 
+// Defaults for the Dog Mode monitor unless the config sets them
+const (
+	DefaultDogModeInterval   = time.Minute
+	DefaultDogModeMinTemp    = 10 // Celsius
+	DefaultDogModeMaxTemp    = 30 // Celsius
+	DefaultDogModeMinBattery = 20 // Percent
+)
+
+// DogModeConfig tunes the monitor that polls a vehicle while Dog Mode or
+// another climate keeper mode is on
+type DogModeConfig struct {
+	Interval        time.Duration `json:"interval,omitempty"`          // How often to poll; defaults to 1 minute
+	MinTempCelsius  float32       `json:"min_temp_celsius,omitempty"`  // Alert below this; defaults to 10
+	MaxTempCelsius  float32       `json:"max_temp_celsius,omitempty"`  // Alert above this; defaults to 30
+	MinBatteryLevel int           `json:"min_battery_level,omitempty"` // Alert at or below this percent; defaults to 20
+}
+
+// WithDefaults returns the config with defaults for the fields it leaves out
+func (c DogModeConfig) WithDefaults() DogModeConfig {
+	if c.Interval == 0 {
+		c.Interval = DefaultDogModeInterval
+	}
+	if c.MinTempCelsius == 0 {
+		c.MinTempCelsius = DefaultDogModeMinTemp
+	}
+	if c.MaxTempCelsius == 0 {
+		c.MaxTempCelsius = DefaultDogModeMaxTemp
+	}
+	if c.MinBatteryLevel == 0 {
+		c.MinBatteryLevel = DefaultDogModeMinBattery
+	}
+	return c
+}
+
+// Validate checks the config
+func (c DogModeConfig) Validate() error {
+	if c.Interval < 0 || (c.Interval > 0 && c.Interval < 10*time.Second) {
+		return fmt.Errorf("interval must be at least 10s")
+	}
+	if c.MinBatteryLevel < 0 || c.MinBatteryLevel > 100 {
+		return fmt.Errorf("min_battery_level must be between 0 and 100")
+	}
+	if d := c.WithDefaults(); d.MinTempCelsius >= d.MaxTempCelsius {
+		return fmt.Errorf("min_temp_celsius must be below max_temp_celsius")
+	}
+	return nil
+}
+
+// Defaults for the offline queue unless the config sets them
+const (
+	DefaultOfflineQueueTTL        = time.Hour
+	DefaultOfflineQueueMaxPending = 20
+)
+
+// OfflineQueueConfig holds async commands sent while a vehicle isn't
+// connected, to run once it reconnects
+type OfflineQueueConfig struct {
+	Enabled    bool          `json:"enabled"`
+	TTL        time.Duration `json:"ttl,omitempty"`         // How long a command waits before it expires; defaults to 1 hour
+	MaxPending int           `json:"max_pending,omitempty"` // Commands held per vehicle; defaults to 20
+}
+
+// WithDefaults returns the config with defaults for the fields it leaves out
+func (c OfflineQueueConfig) WithDefaults() OfflineQueueConfig {
+	if c.TTL == 0 {
+		c.TTL = DefaultOfflineQueueTTL
+	}
+	if c.MaxPending == 0 {
+		c.MaxPending = DefaultOfflineQueueMaxPending
+	}
+	return c
+}
+
+// Validate checks the config
+func (c OfflineQueueConfig) Validate() error {
+	if c.TTL < 0 {
+		return fmt.Errorf("ttl must be non-negative")
+	}
+	if c.MaxPending < 0 {
+		return fmt.Errorf("max_pending must be non-negative")
+	}
+	return nil
+}
+
+// MetricsConfig configures pushing metrics to external systems. Exporters
+// only run when client.enable_metrics is set.
+type MetricsConfig struct {
+	Interval time.Duration          `json:"interval"`       // How often metrics are pushed
+	Tags     map[string]string      `json:"tags,omitempty"` // Added to every metric
+	InfluxDB metrics.InfluxDBConfig `json:"influxdb"`
+	Statsd   metrics.StatsdConfig   `json:"statsd"`
+}
+
+// TLSConfig enables HTTPS, with either certificate files or a certificate
+// obtained through ACME
+type TLSConfig struct {
+	CertFile string      `json:"cert_file,omitempty"`
+	KeyFile  string      `json:"key_file,omitempty"`
+	ACME     acme.Config `json:"acme"`
+}
+
+// Enabled reports whether HTTPS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.ACME.Enabled()
+}
+
+// Validate checks the config
+func (c TLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" && c.ACME.Enabled() {
+		return fmt.Errorf("use either cert_file or acme, not both")
+	}
+	if err := c.ACME.Validate(); err != nil {
+		return fmt.Errorf("acme: %w", err)
+	}
+	return nil
+}
+
+// WellKnownPublicKeyPath is where Tesla fetches a partner domain's public key
+// when it is registered with the Fleet API
+const WellKnownPublicKeyPath = "/.well-known/appspecific/com.tesla.3p.public-key.pem"
+
+// PublicKeyConfig serves the server's public key at WellKnownPublicKeyPath,
+// so the Fleet API can register this server's domain directly
+type PublicKeyConfig struct {
+	Serve   bool   `json:"serve,omitempty"`
+	KeyName string `json:"key_name,omitempty"` // Key pair in the keyring; defaults to the key in tesla.private_key_file
+}
+
+// Validate checks the config
+func (c PublicKeyConfig) Validate() error {
+	if c.KeyName != "" && !c.Serve {
+		return fmt.Errorf("key_name needs serve")
+	}
+	return nil
+}
+
+// LoggingConfig holds logging configuration
+type LoggingConfig = logging.Config
+
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
 		Tesla: TeslaConfig{
+			Transport:             string(TransportBLE),
+			FleetAPIHost:          DefaultFleetAPIHost,
 			ConnectionTimeout:     60 * time.Second,
 			ScanTimeout:          30 * time.Second,
 			MaxConcurrentRequests: 5,
+			MaxQueuedRequests:     20,
 			RequestTimeout:       10 * time.Second,
+			SetpointInterval:     2 * time.Second,
+			StateCacheTTL:        5 * time.Second,
 			ScanRetries:          3,
 			ScanDelay:            2 * time.Second,
+			DirectConnectTimeout: 5 * time.Second,
 		},
 		Client: ClientConfig{
 			ClientName:           "tesla-hvac-client",
@@ -95,8 +368,11 @@ func DefaultConfig() *Config {
 			KeepAliveInterval:    30 * time.Second,
 			HealthCheckInterval:  60 * time.Second,
 			EnableAutoReconnect:  true,
+			ReconnectInterval:    15 * time.Second,
+			ReconnectMaxDelay:    5 * time.Minute,
 			EnableHealthChecks:   true,
 			EnableMetrics:        false,
+			EnableSessionCache:   true,
 		},
 		Retry: RetryConfig{
 			MaxRetries:    3,
@@ -110,6 +386,17 @@ func DefaultConfig() *Config {
 			ResetTimeout:     60 * time.Second,
 			HalfOpenMaxCalls: 3,
 		},
+		Failover: FailoverConfig{
+			Enabled:      false,
+			Fallback:     string(TransportFleet),
+			RetryPrimary: 10 * time.Minute,
+		},
+		Wake: WakeConfig{
+			OnDemand:      false,
+			MaxWait:       30 * time.Second,
+			AwakeWindow:   2 * time.Minute,
+			ProbeInterval: time.Minute,
+		},
 		Logging: LoggingConfig{
 			Level:      "info",
 			Format:     "text",
@@ -118,6 +405,12 @@ func DefaultConfig() *Config {
 			MaxBackups: 3,
 			MaxAge:     7,
 		},
+		Metrics: MetricsConfig{
+			Interval: 10 * time.Second,
+		},
+		Update: update.Config{
+			CheckInterval: 24 * time.Hour,
+		},
 	}
 }
 
@@ -153,39 +446,34 @@ func LoadConfig(configPath string) (*Config, error) {
 	return config, nil
 }
 
-// Save saves the configuration to file
+// Save writes the configuration to its file. The file is replaced
+// atomically, so a crash or a reload mid-write never sees half of it, and the
+// version it replaces is kept as a backup.
 func (c *Config) Save() error {
 	if c.ConfigPath == "" {
 		return fmt.Errorf("config path not set")
 	}
 
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(c.ConfigPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
-	}
-
 	// Marshal to JSON with indentation
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(c.ConfigPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
-	}
-
-	return nil
+	return writeConfigFile(c.ConfigPath, data, c.ConfigBackups)
 }
 
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	// Validate Tesla config
-	if c.Tesla.VIN == "" {
+	if c.Tesla.VIN == "" && len(c.Vehicles) == 0 {
 		return fmt.Errorf("tesla.vin is required")
 	}
 
+	if _, err := ParseTransport(c.Tesla.Transport); err != nil {
+		return fmt.Errorf("tesla.transport: %w", err)
+	}
+
 	if c.Tesla.ConnectionTimeout <= 0 {
 		return fmt.Errorf("tesla.connection_timeout must be positive")
 	}
@@ -194,14 +482,44 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("tesla.scan_timeout must be positive")
 	}
 
+	if c.Tesla.DirectConnectTimeout < 0 {
+		return fmt.Errorf("tesla.direct_connect_timeout must be non-negative")
+	}
+
 	if c.Tesla.MaxConcurrentRequests <= 0 {
 		return fmt.Errorf("tesla.max_concurrent_requests must be positive")
 	}
 
+	if c.Tesla.MaxQueuedRequests < 0 {
+		return fmt.Errorf("tesla.max_queued_requests must be non-negative")
+	}
+
 	if c.Tesla.RequestTimeout <= 0 {
 		return fmt.Errorf("tesla.request_timeout must be positive")
 	}
 
+	if c.Tesla.SetpointInterval < 0 {
+		return fmt.Errorf("tesla.setpoint_interval must be non-negative")
+	}
+
+	if c.Tesla.StateCacheTTL < 0 {
+		return fmt.Errorf("tesla.state_cache_ttl must be non-negative")
+	}
+
+	// Validate client config
+	if c.Client.KeepAliveInterval < 0 {
+		return fmt.Errorf("client.keep_alive_interval must be non-negative")
+	}
+
+	if c.Client.EnableAutoReconnect {
+		if c.Client.ReconnectInterval <= 0 {
+			return fmt.Errorf("client.reconnect_interval must be positive when client.enable_auto_reconnect is set")
+		}
+		if c.Client.ReconnectMaxDelay < c.Client.ReconnectInterval {
+			return fmt.Errorf("client.reconnect_max_delay must be at least client.reconnect_interval")
+		}
+	}
+
 	// Validate retry config
 	if c.Retry.MaxRetries < 0 {
 		return fmt.Errorf("retry.max_retries must be non-negative")
@@ -219,6 +537,16 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("retry.backoff_factor must be positive")
 	}
 
+	if c.Retry.MaxElapsed < 0 {
+		return fmt.Errorf("retry.max_elapsed must be non-negative")
+	}
+
+	switch c.Retry.JitterStrategy {
+	case "", JitterProportional, JitterFull, JitterDecorrelated:
+	default:
+		return fmt.Errorf("retry.jitter_strategy must be proportional, full or decorrelated")
+	}
+
 	// Validate circuit breaker config
 	if c.CircuitBreaker.MaxFailures <= 0 {
 		return fmt.Errorf("circuit_breaker.max_failures must be positive")
@@ -232,69 +560,220 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("circuit_breaker.half_open_max_calls must be positive")
 	}
 
-	// Validate logging config
-	validLevels := map[string]bool{
-		"debug": true, "info": true, "warn": true, "error": true,
+	// Validate wake config
+	if c.Failover.Enabled {
+		fallback, err := ParseTransport(c.Failover.Fallback)
+		if err != nil {
+			return fmt.Errorf("failover.fallback: %w", err)
+		}
+		if primary, _ := ParseTransport(c.Tesla.Transport); fallback == primary {
+			return fmt.Errorf("failover.fallback must differ from tesla.transport")
+		}
 	}
-	if !validLevels[c.Logging.Level] {
-		return fmt.Errorf("logging.level must be one of: debug, info, warn, error")
+
+	if c.Failover.RetryPrimary < 0 {
+		return fmt.Errorf("failover.retry_primary must be non-negative")
 	}
 
-	validFormats := map[string]bool{
-		"json": true, "text": true,
+	if c.Wake.OnDemand && c.Wake.MaxWait <= 0 {
+		return fmt.Errorf("wake.max_wait must be positive when wake.on_demand is enabled")
 	}
-	if !validFormats[c.Logging.Format] {
-		return fmt.Errorf("logging.format must be one of: json, text")
+
+	if c.Wake.AwakeWindow <= 0 {
+		return fmt.Errorf("wake.awake_window must be positive")
 	}
 
-	validOutputs := map[string]bool{
-		"stdout": true, "stderr": true, "file": true,
+	if c.Wake.ProbeInterval <= 0 {
+		return fmt.Errorf("wake.probe_interval must be positive")
 	}
-	if !validOutputs[c.Logging.Output] {
-		return fmt.Errorf("logging.output must be one of: stdout, stderr, file")
+
+	if c.Wake.RefreshInterval < 0 {
+		return fmt.Errorf("wake.refresh_interval must be non-negative")
 	}
 
-	if c.Logging.Output == "file" && c.Logging.FilePath == "" {
-		return fmt.Errorf("logging.file_path is required when output is file")
+	if err := c.BatteryGuard.Validate(); err != nil {
+		return fmt.Errorf("battery_guard: %w", err)
 	}
 
-	return nil
-}
+	if err := c.Faults.Validate(); err != nil {
+		return fmt.Errorf("faults: %w", err)
+	}
+
+	if err := c.DogMode.Validate(); err != nil {
+		return fmt.Errorf("dog_mode: %w", err)
+	}
+
+	if err := c.OfflineQueue.Validate(); err != nil {
+		return fmt.Errorf("offline_queue: %w", err)
+	}
+
+	// Validate metrics config
+	if c.Metrics.InfluxDB.Enabled() || c.Metrics.Statsd.Enabled() {
+		if c.Metrics.Interval <= 0 {
+			return fmt.Errorf("metrics.interval must be positive")
+		}
+	}
+	if err := c.Metrics.InfluxDB.Validate(); err != nil {
+		return fmt.Errorf("metrics.influxdb: %w", err)
+	}
+	if err := c.Metrics.Statsd.Validate(); err != nil {
+		return fmt.Errorf("metrics.statsd: %w", err)
+	}
+
+	// Validate OAuth config
+	if err := c.OAuth.Validate(); err != nil {
+		return fmt.Errorf("oauth: %w", err)
+	}
+
+	// Validate keyring config
+	if err := c.Keyring.Validate(); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+
+	// Validate TLS config
+	if err := c.TLS.Validate(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+
+	// Validate public key config
+	if err := c.PublicKey.Validate(); err != nil {
+		return fmt.Errorf("public_key: %w", err)
+	}
 
-// LoadFromEnv loads configuration from environment variables
-func (c *Config) LoadFromEnv() {
-	// Tesla configuration
-	if vin := os.Getenv("TESLA_VIN"); vin != "" {
-		c.Tesla.VIN = vin
+	// Validate update config
+	if err := c.Update.Validate(); err != nil {
+		return fmt.Errorf("update: %w", err)
 	}
-	if keyFile := os.Getenv("TESLA_PRIVATE_KEY_FILE"); keyFile != "" {
-		c.Tesla.PrivateKeyFile = keyFile
+
+	// Validate macros
+	if err := validateMacros(c.Macros); err != nil {
+		return fmt.Errorf("macros: %w", err)
+	}
+
+	// Validate presets
+	if err := validatePresets(c.Presets); err != nil {
+		return fmt.Errorf("presets: %w", err)
+	}
+
+	// Validate weather config
+	if err := c.Weather.Validate(); err != nil {
+		return fmt.Errorf("weather: %w", err)
+	}
+
+	// Validate history polling
+	if err := c.History.Validate(); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	// Validate audit log
+	if err := c.Audit.Validate(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	// Validate MQTT config
+	if err := c.MQTT.Validate(); err != nil {
+		return fmt.Errorf("mqtt: %w", err)
+	}
+
+	// Validate HomeKit config
+	if err := c.HomeKit.Validate(); err != nil {
+		return fmt.Errorf("homekit: %w", err)
+	}
+
+	// Validate tracing config
+	if err := c.Tracing.Validate(); err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	// Validate webhook config
+	if err := c.Webhooks.Validate(); err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+
+	// Validate notification config
+	if err := c.Notifications.Validate(); err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+
+	// Validate schedules
+	if err := c.validateSchedules(); err != nil {
+		return fmt.Errorf("schedules: %w", err)
+	}
+
+	// Validate vehicles
+	if err := c.validateVehicles(); err != nil {
+		return fmt.Errorf("vehicles: %w", err)
 	}
-	if tokenFile := os.Getenv("TESLA_OAUTH_TOKEN_FILE"); tokenFile != "" {
-		c.Tesla.OAuthTokenFile = tokenFile
+
+	// Validate API keys
+	if err := validateAPIKeys(c.APIKeys); err != nil {
+		return fmt.Errorf("api_keys: %w", err)
+	}
+
+	// Validate logging config
+	if err := c.Logging.Validate(); err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+
+	if c.ConfigBackups < -1 {
+		return fmt.Errorf("config_backups must be -1 or more")
 	}
 
-	// Client configuration
+	if err := c.validateProfiles(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LoadFromEnv overrides config fields with the environment variables
+// EnvVars lists, such as TESLA_RETRY_MAX_RETRIES for retry.max_retries, and
+// with the names earlier versions read. Variables that are empty are ignored.
+// It returns an error naming each variable that can't be parsed.
+func (c *Config) LoadFromEnv() error {
+	// Names kept from earlier versions, which the full names override
 	if name := os.Getenv("TESLA_CLIENT_NAME"); name != "" {
 		c.Client.ClientName = name
 	}
 	if version := os.Getenv("TESLA_CLIENT_VERSION"); version != "" {
 		c.Client.ClientVersion = version
 	}
+	if filePath := os.Getenv("TESLA_LOG_FILE"); filePath != "" {
+		c.Logging.FilePath = filePath
+	}
+	if token := os.Getenv("TESLA_INFLUXDB_TOKEN"); token != "" {
+		c.Metrics.InfluxDB.Token = token
+	}
 
-	// Logging configuration
-	if level := os.Getenv("TESLA_LOG_LEVEL"); level != "" {
-		c.Logging.Level = level
+	// Notification secrets, for the backends in the file
+	if password := os.Getenv("TESLA_SMTP_PASSWORD"); password != "" && c.Notifications.SMTP != nil {
+		c.Notifications.SMTP.Password = password
 	}
-	if format := os.Getenv("TESLA_LOG_FORMAT"); format != "" {
-		c.Logging.Format = format
+	if token := os.Getenv("TESLA_PUSHOVER_TOKEN"); token != "" && c.Notifications.Pushover != nil {
+		c.Notifications.Pushover.Token = token
 	}
-	if output := os.Getenv("TESLA_LOG_OUTPUT"); output != "" {
-		c.Logging.Output = output
+	if token := os.Getenv("TESLA_TELEGRAM_BOT_TOKEN"); token != "" && c.Notifications.Telegram != nil {
+		c.Notifications.Telegram.BotToken = token
 	}
-	if filePath := os.Getenv("TESLA_LOG_FILE"); filePath != "" {
-		c.Logging.FilePath = filePath
+
+	// Tracing configuration, from the standard OpenTelemetry variable
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		c.Tracing.Endpoint = endpoint
+	}
+
+	return c.applyEnv()
+}
+
+// DataPath returns the directory for local state
+func (c *Config) DataPath() string {
+	if c.DataDir != "" {
+		return c.DataDir
+	}
+	configPath := c.ConfigPath
+	if configPath == "" {
+		configPath = GetConfigPath()
 	}
+	return filepath.Join(filepath.Dir(configPath), "data")
 }
 
 // GetConfigPath returns the default configuration file path
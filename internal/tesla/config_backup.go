@@ -0,0 +1,155 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultConfigBackups is how many earlier versions of the config file Save
+// keeps when config_backups isn't set
+const DefaultConfigBackups = 5
+
+// configBackupTimeFormat stamps backup names, as config-<stamp>.json. It
+// sorts in time order.
+const configBackupTimeFormat = "2006-01-02T15-04-05.000"
+
+// writeConfigFile replaces the config file at path with data: data is written
+// to a temporary file, synced and renamed over the file. The file it replaces
+// is first copied to a timestamped backup, and backups beyond keep are
+// deleted.
+func writeConfigFile(path string, data []byte, keep int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	mode := fs.FileMode(0644)
+	old, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if keep >= 0 && !bytes.Equal(old, data) {
+			if err := os.WriteFile(configBackupName(path, time.Now()), old, mode); err != nil {
+				return fmt.Errorf("failed to back up config file: %w", err)
+			}
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := writeSynced(tmp, data, mode); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	pruneConfigBackups(path, keep)
+	return nil
+}
+
+// writeSynced writes a file and syncs it to disk before it's renamed into
+// place
+func writeSynced(path string, data []byte, mode fs.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// configBackupName returns the name of a backup of the config file made at t
+func configBackupName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + t.UTC().Format(configBackupTimeFormat) + ext
+}
+
+// ConfigBackups returns the paths of the config file's backups, newest first
+func ConfigBackups(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "-"
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config backups: %w", err)
+	}
+	var backups []string
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || !strings.HasSuffix(stamp, ext) || entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(configBackupTimeFormat, strings.TrimSuffix(stamp, ext)); err == nil {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+// pruneConfigBackups deletes all but the newest keep backups. Errors are
+// ignored: the next save tries again.
+func pruneConfigBackups(path string, keep int) {
+	if keep == 0 {
+		keep = DefaultConfigBackups
+	}
+	backups, _ := ConfigBackups(path)
+	for i, backup := range backups {
+		if keep < 0 || i >= keep {
+			os.Remove(backup)
+		}
+	}
+}
+
+// RollbackConfig restores a backup of the config file at path, the newest if
+// backup is empty, and returns the backup restored. The backup must be a
+// valid config. The file it replaces is itself backed up, so a rollback can
+// be undone.
+func RollbackConfig(path, backup string) (string, error) {
+	if backup == "" {
+		backups, err := ConfigBackups(path)
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backups of %s", path)
+		}
+		backup = backups[0]
+	}
+
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, config); err != nil {
+		return "", fmt.Errorf("failed to parse backup %s: %w", backup, err)
+	}
+	if err := config.Validate(); err != nil {
+		return "", fmt.Errorf("backup %s is invalid: %w", backup, err)
+	}
+	if err := writeConfigFile(path, data, config.ConfigBackups); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
@@ -0,0 +1,89 @@
+package tesla
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// saveVIN saves config with vin, waiting so each backup gets its own name
+func saveVIN(t *testing.T, config *Config, vin string) {
+	t.Helper()
+	time.Sleep(2 * time.Millisecond)
+	config.Tesla.VIN = vin
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+}
+
+func TestConfigSaveKeepsBackups(t *testing.T) {
+	config := DefaultConfig()
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	config.ConfigBackups = 2
+	for _, vin := range []string{"VIN_1", "VIN_2", "VIN_3", "VIN_4"} {
+		saveVIN(t, config, vin)
+	}
+	// Saving the same config again doesn't make a backup
+	saveVIN(t, config, "VIN_4")
+
+	backups, err := ConfigBackups(config.ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+	for i, vin := range []string{"VIN_3", "VIN_2"} {
+		backup, err := LoadConfig(backups[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backup.Tesla.VIN != vin {
+			t.Errorf("Backup %d has VIN %q, want %q", i, backup.Tesla.VIN, vin)
+		}
+	}
+	if _, err := os.Stat(config.ConfigPath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("Temporary file left behind: %v", err)
+	}
+
+	config.ConfigBackups = -1
+	saveVIN(t, config, "VIN_5")
+	if backups, _ := ConfigBackups(config.ConfigPath); len(backups) != 0 {
+		t.Errorf("Expected no backups with config_backups -1, got %v", backups)
+	}
+}
+
+func TestRollbackConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	saveVIN(t, config, "GOOD_VIN")
+	saveVIN(t, config, "NEW_VIN")
+
+	if _, err := RollbackConfig(config.ConfigPath, ""); err != nil {
+		t.Fatalf("RollbackConfig failed: %v", err)
+	}
+	restored, err := LoadConfig(config.ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Tesla.VIN != "GOOD_VIN" {
+		t.Errorf("Rolled back to VIN %q, want GOOD_VIN", restored.Tesla.VIN)
+	}
+
+	// The rollback backed up the version it replaced, so it can be undone
+	if _, err := RollbackConfig(config.ConfigPath, ""); err != nil {
+		t.Fatalf("RollbackConfig failed: %v", err)
+	}
+	if restored, _ := LoadConfig(config.ConfigPath); restored.Tesla.VIN != "NEW_VIN" {
+		t.Errorf("Undo restored VIN %q, want NEW_VIN", restored.Tesla.VIN)
+	}
+
+	invalid := configBackupName(config.ConfigPath, time.Now().Add(time.Hour))
+	if err := os.WriteFile(invalid, []byte(`{"tesla": {"vin": ""}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RollbackConfig(config.ConfigPath, invalid); err == nil {
+		t.Error("Expected an invalid backup to be refused")
+	}
+}
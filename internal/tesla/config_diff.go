@@ -0,0 +1,169 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// secretFields are the config fields whose values are credentials, or the
+// paths of files holding keys and tokens
+var secretFields = map[string]bool{
+	"password":         true,
+	"token":            true,
+	"bot_token":        true,
+	"secret":           true,
+	"api_key":          true,
+	"key":              true, // An API key's hash
+	"user":             true, // Pushover's user key
+	"setup_code":       true,
+	"headers":          true, // Tracing headers, which usually authenticate
+	"private_key_file": true,
+	"key_file":         true,
+	"oauth_token_file": true,
+	"password_file":    true,
+}
+
+// IsSecretField reports whether a config field, named by its JSON name such
+// as password, holds a secret that shouldn't be shown
+func IsSecretField(name string) bool {
+	return secretFields[name]
+}
+
+// ConfigChange is a field that differs between two configs
+type ConfigChange struct {
+	Path string // Such as retry.max_retries, or vehicles.0.vin
+	Old  string // The value in the first config, or "" if it isn't set
+	New  string // The value in the second config, or "" if it isn't set
+}
+
+// redactedValue stands for a secret in a ConfigChange
+const redactedValue = `"[redacted]"`
+
+// flatValue is a config value, as JSON
+type flatValue struct {
+	text   string
+	secret bool
+}
+
+// DiffConfigs lists the fields that differ from old to new, sorted by path.
+// Values are shown as JSON, with durations as 30s and secrets as
+// "[redacted]".
+func DiffConfigs(old, new *Config) ([]ConfigChange, error) {
+	oldFields, err := flattenConfig(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := flattenConfig(new)
+	if err != nil {
+		return nil, err
+	}
+	var changes []ConfigChange
+	for path, value := range newFields {
+		if oldValue, ok := oldFields[path]; !ok || oldValue.text != value.text {
+			changes = append(changes, ConfigChange{Path: path, Old: oldValue.shown(), New: value.shown()})
+		}
+	}
+	for path, value := range oldFields {
+		if _, ok := newFields[path]; !ok {
+			changes = append(changes, ConfigChange{Path: path, Old: value.shown()})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// shown returns the value as a ConfigChange shows it
+func (v flatValue) shown() string {
+	if v.secret && v.text != `""` {
+		return redactedValue
+	}
+	return v.text
+}
+
+// flattenConfig maps the dotted path of each value in config to the value
+func flattenConfig(config *Config) (map[string]flatValue, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]flatValue)
+	flattenValue("", "", value, fields)
+	return fields, nil
+}
+
+// flattenValue adds value, at path, to fields. name is the JSON name of the
+// field value is in.
+func flattenValue(path, name string, value interface{}, fields map[string]flatValue) {
+	child := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if IsSecretField(name) {
+				// Each of a secret map's values, such as a header, is secret
+				flattenValue(child(key), name, item, fields)
+			} else {
+				flattenValue(child(key), key, item, fields)
+			}
+		}
+		return
+	case []interface{}:
+		for i, item := range v {
+			flattenValue(child(strconv.Itoa(i)), name, item, fields)
+		}
+		return
+	case nil:
+		return
+	}
+
+	flat := flatValue{secret: IsSecretField(name)}
+	if n, ok := value.(json.Number); ok {
+		if field, ok := fieldAt(path); ok && field.Type == "duration" {
+			if d, err := n.Int64(); err == nil {
+				flat.text = time.Duration(d).String()
+				fields[path] = flat
+				return
+			}
+		}
+	}
+	data, _ := json.Marshal(value)
+	flat.text = string(data)
+	fields[path] = flat
+}
+
+// CheckConfigFile checks the config file at path without changing anything:
+// unlike LoadConfig it doesn't create a missing file, and fields it doesn't
+// know, such as misspelled ones, are errors. Environment variables aren't
+// applied.
+func CheckConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	config := DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	config.ConfigPath = path
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
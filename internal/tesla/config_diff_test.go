@@ -0,0 +1,70 @@
+package tesla
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/notify"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old := DefaultConfig()
+	old.Notifications.SMTP = &notify.SMTPConfig{Host: "smtp.example.com", Password: "old-secret"}
+
+	new := DefaultConfig()
+	new.Tesla.VIN = "NEW_VIN"
+	new.Retry.InitialDelay = 2 * time.Second
+	new.Notifications.SMTP = &notify.SMTPConfig{Host: "smtp.example.com", Password: "new-secret"}
+	new.Vehicles = []VehicleConfig{{VIN: "NEW_VIN"}}
+
+	changes, err := DiffConfigs(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ConfigChange{
+		{Path: "notifications.smtp.password", Old: `"[redacted]"`, New: `"[redacted]"`},
+		{Path: "retry.initial_delay", Old: "1s", New: "2s"},
+		{Path: "tesla.vin", Old: `""`, New: `"NEW_VIN"`},
+		{Path: "vehicles.0.vin", New: `"NEW_VIN"`},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("DiffConfigs =\n%+v\nwant\n%+v", changes, want)
+	}
+
+	if changes, _ := DiffConfigs(new, new); len(changes) != 0 {
+		t.Errorf("Expected no changes from a config to itself, got %+v", changes)
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if _, err := CheckConfigFile(write("valid.json", `{"tesla": {"vin": "5YJ3E1EA7KF000001"}}`)); err != nil {
+		t.Errorf("Valid file rejected: %v", err)
+	}
+	if _, err := CheckConfigFile(write("typo.json", `{"tesla": {"vin": "5YJ3E1EA7KF000001"}, "retry": {"max_retrys": 3}}`)); err == nil || !strings.Contains(err.Error(), "max_retrys") {
+		t.Errorf("Expected the misspelled field to be rejected, got %v", err)
+	}
+	if _, err := CheckConfigFile(write("invalid.json", `{"tesla": {"vin": ""}}`)); err == nil {
+		t.Error("Expected a config without a VIN to be rejected")
+	}
+
+	missing := filepath.Join(dir, "missing.json")
+	if _, err := CheckConfigFile(missing); err == nil {
+		t.Error("Expected a missing file to be an error")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Checking a missing file created it: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package tesla
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of every environment variable that overrides a
+// config field
+const EnvPrefix = "TESLA_"
+
+// envSectionNames shortens some sections' names in environment variables:
+// tesla.vin is TESLA_VIN and circuit_breaker.reset_timeout is
+// TESLA_CB_RESET_TIMEOUT
+var envSectionNames = map[string]string{
+	"tesla":           "",
+	"circuit_breaker": "CB",
+	"logging":         "LOG",
+}
+
+// EnvVar is an environment variable that overrides a config field
+type EnvVar struct {
+	Name string // Such as TESLA_RETRY_MAX_RETRIES
+	Path string // The field, such as retry.max_retries
+	Type string // string, bool, int, float, duration, list, map or keys
+}
+
+// envField is a config field an environment variable, or tesla-config set,
+// sets
+type envField struct {
+	EnvVar
+	index []int // Field index path from Config, through struct pointers
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var apiKeysType = reflect.TypeOf([]APIKey(nil))
+
+// EnvVars lists the environment variables that override config fields. Every
+// field of a section is covered except lists of objects, such as vehicles and
+// macros, which need a config file. API keys are the exception, so a
+// container can require them without one.
+func EnvVars() []EnvVar {
+	var vars []EnvVar
+	for _, field := range envFields() {
+		vars = append(vars, field.EnvVar)
+	}
+	return vars
+}
+
+func envFields() []envField {
+	var fields []envField
+	collectEnvFields(reflect.TypeOf(Config{}), nil, nil, nil, &fields)
+	return fields
+}
+
+// collectEnvFields adds the settable fields of struct type t, whose JSON
+// path is path and whose variable name parts are names
+func collectEnvFields(t reflect.Type, index []int, path, names []string, fields *[]envField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		fieldPath := append(append([]string(nil), path...), tag)
+		name := strings.ToUpper(tag)
+		if len(path) == 0 {
+			if short, ok := envSectionNames[tag]; ok {
+				name = short
+			}
+		}
+		fieldNames := append([]string(nil), names...)
+		if name != "" {
+			fieldNames = append(fieldNames, name)
+		}
+
+		typ := envType(f.Type)
+		if typ == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectEnvFields(ft, fieldIndex, fieldPath, fieldNames, fields)
+			}
+			continue
+		}
+		*fields = append(*fields, envField{
+			EnvVar: EnvVar{
+				Name: EnvPrefix + strings.Join(fieldNames, "_"),
+				Path: strings.Join(fieldPath, "."),
+				Type: typ,
+			},
+			index: fieldIndex,
+		})
+	}
+}
+
+// envType names how a variable for a field of type t is parsed, or returns
+// "" if one can't set it
+func envType(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+	if t == apiKeysType {
+		return "keys"
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return "list"
+		}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String {
+			return "map"
+		}
+	}
+	return ""
+}
+
+// applyEnv sets the fields whose environment variables are set and not
+// empty. A struct pointer such as notifications.smtp is allocated when one of
+// its fields is set.
+func (c *Config) applyEnv() error {
+	var errs []error
+	root := reflect.ValueOf(c).Elem()
+	for _, field := range envFields() {
+		value := os.Getenv(field.Name)
+		if value == "" {
+			continue
+		}
+		v, _ := field.lookup(root, true)
+		if err := setFieldValue(v, field.Type, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookup returns the field in root, a Config. With alloc, a nil struct
+// pointer on the way is allocated; without, ok is false if there is one.
+func (f envField) lookup(root reflect.Value, alloc bool) (v reflect.Value, ok bool) {
+	v = root
+	for _, i := range f.index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// setFieldValue parses value into v
+func setFieldValue(v reflect.Value, typ, value string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok && v.Type() != durationType {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch typ {
+	case "duration":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, such as 30s or 5m", value)
+		}
+		v.SetInt(int64(d))
+	case "string":
+		v.SetString(value)
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		v.SetBool(b)
+	case "int":
+		if v.CanInt() {
+			n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", value)
+			}
+			v.SetInt(n)
+		} else {
+			n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("invalid unsigned integer %q", value)
+			}
+			v.SetUint(n)
+		}
+	case "float":
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		v.SetFloat(f)
+	case "list":
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(list)
+	case "map":
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, expected key=value", pair)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)).Convert(v.Type().Key()),
+				reflect.ValueOf(strings.TrimSpace(val)).Convert(v.Type().Elem()))
+		}
+		v.Set(m)
+	case "keys":
+		keys, err := parseAPIKeys(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(keys))
+	}
+	return nil
+}
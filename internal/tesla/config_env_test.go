@@ -0,0 +1,129 @@
+package tesla
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvVars(t *testing.T) {
+	names := make(map[string]string)
+	for _, v := range EnvVars() {
+		if path, ok := names[v.Name]; ok {
+			t.Errorf("%s sets both %s and %s", v.Name, path, v.Path)
+		}
+		names[v.Name] = v.Path
+	}
+	for name, path := range map[string]string{
+		"TESLA_VIN":                     "tesla.vin",
+		"TESLA_SCAN_TIMEOUT":            "tesla.scan_timeout",
+		"TESLA_RETRY_MAX_RETRIES":       "retry.max_retries",
+		"TESLA_CB_RESET_TIMEOUT":        "circuit_breaker.reset_timeout",
+		"TESLA_LOG_LEVEL":               "logging.level",
+		"TESLA_METRICS_INFLUXDB_TOKEN":  "metrics.influxdb.token",
+		"TESLA_NOTIFICATIONS_SMTP_HOST": "notifications.smtp.host",
+		"TESLA_DATA_DIR":                "data_dir",
+	} {
+		if names[name] != path {
+			t.Errorf("Expected %s to set %s, got %q", name, path, names[name])
+		}
+	}
+	if _, ok := names["TESLA_VEHICLES"]; ok {
+		t.Error("Lists of objects can't be set from the environment")
+	}
+}
+
+func TestLoadFromEnvTypes(t *testing.T) {
+	t.Setenv("TESLA_RETRY_MAX_RETRIES", "7")
+	t.Setenv("TESLA_CB_RESET_TIMEOUT", "90s")
+	t.Setenv("TESLA_RETRY_BACKOFF_FACTOR", "1.5")
+	t.Setenv("TESLA_CLIENT_ENABLE_METRICS", "true")
+	t.Setenv("TESLA_FAULTS_OPERATIONS", "connect, wake")
+	t.Setenv("TESLA_METRICS_TAGS", "site=home,rack=2")
+	t.Setenv("TESLA_NOTIFICATIONS_SMTP_HOST", "smtp.example.com")
+	t.Setenv("TESLA_LOG_FILE", "/var/log/old-name.log")
+	t.Setenv("TESLA_LOG_FILE_PATH", "/var/log/tesla.log")
+
+	config := DefaultConfig()
+	if err := config.LoadFromEnv(); err != nil {
+		t.Fatalf("Failed to load environment: %v", err)
+	}
+	if config.Retry.MaxRetries != 7 || config.CircuitBreaker.ResetTimeout != 90*time.Second || config.Retry.BackoffFactor != 1.5 {
+		t.Errorf("Unexpected retry %+v and circuit breaker %+v", config.Retry, config.CircuitBreaker)
+	}
+	if !config.Client.EnableMetrics {
+		t.Error("Expected metrics enabled")
+	}
+	if strings.Join(config.Faults.Operations, "|") != "connect|wake" {
+		t.Errorf("Unexpected list %q", config.Faults.Operations)
+	}
+	if len(config.Metrics.Tags) != 2 || config.Metrics.Tags["rack"] != "2" {
+		t.Errorf("Unexpected map %v", config.Metrics.Tags)
+	}
+	if config.Notifications.SMTP == nil || config.Notifications.SMTP.Host != "smtp.example.com" {
+		t.Errorf("Expected the SMTP backend created, got %+v", config.Notifications.SMTP)
+	}
+	if config.Notifications.Pushover != nil {
+		t.Error("Expected backends without variables left out")
+	}
+	if config.Logging.FilePath != "/var/log/tesla.log" {
+		t.Errorf("Expected the full name to win, got %s", config.Logging.FilePath)
+	}
+}
+
+func TestLoadFromEnvErrors(t *testing.T) {
+	t.Setenv("TESLA_RETRY_MAX_RETRIES", "many")
+	t.Setenv("TESLA_CB_RESET_TIMEOUT", "90")
+	t.Setenv("TESLA_METRICS_TAGS", "site")
+
+	err := DefaultConfig().LoadFromEnv()
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, name := range []string{"TESLA_RETRY_MAX_RETRIES", "TESLA_CB_RESET_TIMEOUT", "TESLA_METRICS_TAGS"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected the error to name %s: %v", name, err)
+		}
+	}
+
+	// Values that parse are still checked by Validate
+	t.Setenv("TESLA_RETRY_MAX_RETRIES", "-1")
+	t.Setenv("TESLA_CB_RESET_TIMEOUT", "")
+	t.Setenv("TESLA_METRICS_TAGS", "")
+	t.Setenv("TESLA_VIN", "5YJ3E1EA7KF000001")
+	config := DefaultConfig()
+	if err := config.LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a negative retry count to be invalid")
+	}
+}
+
+func TestLoadFromEnvAPIKeys(t *testing.T) {
+	digest := HashAPIKey("ops-key-000000001")
+	t.Setenv("TESLA_API_KEYS", "automation=automation-key-01, ops:admin="+digest)
+	t.Setenv("TESLA_VIN", "5YJ3E1EA7KF000001")
+	config := DefaultConfig()
+	if err := config.LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := config.FindAPIKey("automation-key-01"); !ok || key.Name != "automation" || key.KeyRole() != "driver" {
+		t.Errorf("Expected the automation key as a driver, got %+v", key)
+	}
+	if key, ok := config.FindAPIKey("ops-key-000000001"); !ok || key.Role != "admin" {
+		t.Errorf("Expected the hashed ops key as an admin, got %+v", key)
+	}
+
+	t.Setenv("TESLA_API_KEYS", "automation")
+	if err := DefaultConfig().LoadFromEnv(); err == nil || !strings.Contains(err.Error(), "TESLA_API_KEYS") {
+		t.Errorf("Expected an entry without a key to be rejected, got %v", err)
+	}
+	t.Setenv("TESLA_API_KEYS", "automation=short")
+	if err := DefaultConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+}
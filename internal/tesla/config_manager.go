@@ -1,110 +1,198 @@
 package tesla
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/fsnotify.v1"
 )
 
+const (
+	// configDebounce is how long the config file must go unchanged before
+	// it's reloaded, so an editor's several writes are read once
+	configDebounce = 250 * time.Millisecond
+
+	// configPollInterval is how often the config file is read when it can't
+	// be watched
+	configPollInterval = 2 * time.Second
+)
+
 // ConfigManager manages configuration loading, saving, and hot-reloading
 type ConfigManager struct {
-	config     *Config
+	config     *Config // base with its profile applied
+	base       *Config // The file with the environment applied
 	configPath string
-	watcher    *fsnotify.Watcher
+	watchPath  string            // configPath made absolute, as watcher events name it
+	watcher    *fsnotify.Watcher // nil when polling
+	updateMu   sync.Mutex        // Serializes reloads and updates, and their callbacks
 	mu         sync.RWMutex
 	callbacks  []ConfigChangeCallback
 	stopCh     chan struct{}
+	closeOnce  sync.Once
+	reloadErr  error  // Why the last reload was rejected, if it was
+	fileData   []byte // The file as last loaded or saved, to skip unchanged reloads
+	logger     atomic.Pointer[log.Logger]
 }
 
 // ConfigChangeCallback is called when configuration changes
 type ConfigChangeCallback func(oldConfig, newConfig *Config) error
 
-// NewConfigManager creates a new configuration manager
-func NewConfigManager(configPath string) (*ConfigManager, error) {
+// NewConfigManager creates a new configuration manager. The config file's
+// directory is watched, so a file an editor replaces by renaming is reloaded
+// too; if it can't be watched, the file is polled instead.
+func NewConfigManager(configPath string, logger *log.Logger) (*ConfigManager, error) {
 	// Load initial configuration
 	config, err := LoadConfig(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load initial config: %w", err)
 	}
 
-	// Validate configuration
+	// Environment variables override the file, and are validated with it
+	if err := config.LoadFromEnv(); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
-
-	// Load environment variables
-	config.LoadFromEnv()
-
-	// Create file watcher
-	watcher, err := fsnotify.NewWatcher()
+	effective, err := config.WithProfile(config.Profile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	// Watch the config file directory
-	configDir := getConfigDir(configPath)
-	if err := watcher.Add(configDir); err != nil {
-		watcher.Close()
-		return nil, fmt.Errorf("failed to watch config directory: %w", err)
+	watchPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config path: %w", err)
 	}
-
 	cm := &ConfigManager{
-		config:     config,
+		config:     effective,
+		base:       config,
 		configPath: configPath,
-		watcher:    watcher,
+		watchPath:  watchPath,
 		callbacks:  make([]ConfigChangeCallback, 0),
 		stopCh:     make(chan struct{}),
 	}
+	cm.SetLogger(logger)
+	cm.fileData, _ = os.ReadFile(configPath)
 
-	// Start watching for changes
+	watcher, err := watchDir(filepath.Dir(watchPath))
+	if err != nil {
+		cm.log().Printf("warn: Can't watch configuration for changes, polling every %s instead: %v", configPollInterval, err)
+		go cm.pollForChanges(configPollInterval)
+		return cm, nil
+	}
+	cm.watcher = watcher
 	go cm.watchForChanges()
 
 	return cm, nil
 }
 
-// GetConfig returns the current configuration (thread-safe)
+// SetLogger sets the log for reload failures and watcher errors, such as
+// the configured log once the config has set it up
+func (cm *ConfigManager) SetLogger(logger *log.Logger) {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	cm.logger.Store(logger)
+}
+
+// log returns the manager's logger
+func (cm *ConfigManager) log() *log.Logger {
+	return cm.logger.Load()
+}
+
+// watchDir creates a watcher of dir
+func watchDir(dir string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// GetConfig returns the current configuration, with the active profile
+// applied (thread-safe)
 func (cm *ConfigManager) GetConfig() *Config {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 	return cm.config
 }
 
-// UpdateConfig updates the configuration and saves it to file
-func (cm *ConfigManager) UpdateConfig(updater func(*Config)) error {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
+// BaseConfig returns the current configuration without its profile applied,
+// as UpdateConfig edits and saves it
+func (cm *ConfigManager) BaseConfig() *Config {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.base
+}
 
-	// Create a copy of the current config
-	oldConfig := *cm.config
+// UpdateConfig updates the configuration and saves it to file. The updater is
+// given a copy of the base configuration, without its profile applied, which
+// replaces it once it's validated and saved, so readers never see a
+// half-applied or rejected update.
+func (cm *ConfigManager) UpdateConfig(updater func(*Config)) error {
+	cm.updateMu.Lock()
+	defer cm.updateMu.Unlock()
 
-	// Apply updates
-	updater(cm.config)
+	newBase := *cm.BaseConfig()
+	updater(&newBase)
 
-	// Validate the updated configuration
-	if err := cm.config.Validate(); err != nil {
-		// Restore old config if validation fails
-		cm.config = &oldConfig
+	if err := newBase.Validate(); err != nil {
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
-
-	// Save to file
-	if err := cm.config.Save(); err != nil {
-		// Restore old config if save fails
-		cm.config = &oldConfig
+	newConfig, err := newBase.WithProfile(newBase.Profile)
+	if err != nil {
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
+	if err := newBase.Save(); err != nil {
 		return fmt.Errorf("failed to save configuration: %w", err)
 	}
+	data, _ := os.ReadFile(cm.configPath)
+
+	cm.swap(&newBase, newConfig, data)
+	return nil
+}
 
-	// Notify callbacks
-	for _, callback := range cm.callbacks {
-		if err := callback(&oldConfig, cm.config); err != nil {
-			// Log error but don't fail the update
-			fmt.Printf("Warning: config change callback failed: %v\n", err)
+// SwitchProfile makes the named profile, or none for "", the active one and
+// saves the choice. Callbacks see the change like any other, so live clients
+// pick up the profile's settings.
+func (cm *ConfigManager) SwitchProfile(name string) error {
+	return cm.UpdateConfig(func(c *Config) {
+		c.Profile = name
+	})
+}
+
+// swap replaces the configuration and notifies the callbacks. It's called
+// with updateMu held, so callbacks see changes in order and may call
+// GetConfig.
+func (cm *ConfigManager) swap(base, newConfig *Config, data []byte) {
+	cm.mu.Lock()
+	oldConfig := cm.config
+	cm.config = newConfig
+	cm.base = base
+	cm.fileData = data
+	cm.reloadErr = nil
+	callbacks := append([]ConfigChangeCallback(nil), cm.callbacks...)
+	cm.mu.Unlock()
+
+	for _, callback := range callbacks {
+		if err := callback(oldConfig, newConfig); err != nil {
+			// Log error but don't fail the change
+			cm.log().Printf("warn: Config change callback failed: %v", err)
 		}
 	}
-
-	return nil
 }
 
 // RegisterCallback registers a callback for configuration changes
@@ -114,44 +202,88 @@ func (cm *ConfigManager) RegisterCallback(callback ConfigChangeCallback) {
 	cm.callbacks = append(cm.callbacks, callback)
 }
 
-// Reload reloads the configuration from file
+// Reload reloads the configuration from file. The new configuration is
+// validated before it replaces the current one; if it's rejected, the
+// current one stays in use and ReloadError reports why.
 func (cm *ConfigManager) Reload() error {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
+	cm.updateMu.Lock()
+	defer cm.updateMu.Unlock()
+	return cm.reload(false)
+}
 
-	// Load new configuration
-	newConfig, err := LoadConfig(cm.configPath)
-	if err != nil {
-		return fmt.Errorf("failed to reload config: %w", err)
+// reload loads the file; if onlyIfChanged, a file that's missing, as it is
+// midway through some editors' saves, or unchanged since it was last loaded
+// or saved is skipped. It's called with updateMu held.
+func (cm *ConfigManager) reload(onlyIfChanged bool) error {
+	data, err := os.ReadFile(cm.configPath)
+	if onlyIfChanged {
+		cm.mu.RLock()
+		unchanged := err == nil && bytes.Equal(data, cm.fileData)
+		cm.mu.RUnlock()
+		if unchanged || errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
 	}
 
-	// Validate new configuration
-	if err := newConfig.Validate(); err != nil {
-		return fmt.Errorf("invalid reloaded configuration: %w", err)
+	base, newConfig, err := cm.loadConfig()
+	if err != nil {
+		cm.mu.Lock()
+		cm.reloadErr = err
+		cm.mu.Unlock()
+		return err
 	}
+	cm.swap(base, newConfig, data)
+	return nil
+}
 
-	// Load environment variables
-	newConfig.LoadFromEnv()
-
-	// Store old config for callbacks
-	oldConfig := cm.config
+// loadConfig loads and validates the file with the environment applied, and
+// returns it with and without its profile applied
+func (cm *ConfigManager) loadConfig() (base, config *Config, err error) {
+	base, err = LoadConfig(cm.configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reload config: %w", err)
+	}
 
-	// Update configuration
-	cm.config = newConfig
+	// Environment variables override the file, and are validated with it
+	if err := base.LoadFromEnv(); err != nil {
+		return nil, nil, fmt.Errorf("invalid environment: %w", err)
+	}
+	if err := base.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid reloaded configuration: %w", err)
+	}
+	if config, err = base.WithProfile(base.Profile); err != nil {
+		return nil, nil, fmt.Errorf("invalid reloaded configuration: %w", err)
+	}
+	return base, config, nil
+}
 
-	// Notify callbacks
-	for _, callback := range cm.callbacks {
-		if err := callback(oldConfig, cm.config); err != nil {
-			// Log error but don't fail the reload
-			fmt.Printf("Warning: config change callback failed: %v\n", err)
-		}
+// reloadIfChanged reloads the file if it has changed, logging a rejected one
+func (cm *ConfigManager) reloadIfChanged() {
+	cm.updateMu.Lock()
+	defer cm.updateMu.Unlock()
+	if err := cm.reload(true); err != nil {
+		cm.log().Printf("error: Failed to reload configuration: %v", err)
 	}
+}
 
-	return nil
+// ReloadError returns why the file's last reload was rejected, leaving the
+// previous configuration in use, or nil if it loaded
+func (cm *ConfigManager) ReloadError() error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.reloadErr
 }
 
-// watchForChanges watches for configuration file changes
+// watchForChanges reloads the config file once it has stopped changing
 func (cm *ConfigManager) watchForChanges() {
+	var debounce *time.Timer
+	var debounced <-chan time.Time
+	defer func() {
+		if debounce != nil {
+			debounce.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case event, ok := <-cm.watcher.Events:
@@ -159,22 +291,27 @@ func (cm *ConfigManager) watchForChanges() {
 				return
 			}
 
-			// Check if the config file was modified
-			if event.Op&fsnotify.Write == fsnotify.Write && event.Name == cm.configPath {
-				// Debounce rapid changes
-				time.Sleep(100 * time.Millisecond)
-
-				// Reload configuration
-				if err := cm.Reload(); err != nil {
-					fmt.Printf("Failed to reload configuration: %v\n", err)
-				}
+			// Editors that save to a temporary file and rename it over the
+			// config create it rather than write it
+			if filepath.Clean(event.Name) != cm.watchPath || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if debounce == nil {
+				debounce = time.NewTimer(configDebounce)
+			} else {
+				debounce.Reset(configDebounce)
 			}
+			debounced = debounce.C
+
+		case <-debounced:
+			debounced = nil
+			cm.reloadIfChanged()
 
 		case err, ok := <-cm.watcher.Errors:
 			if !ok {
 				return
 			}
-			fmt.Printf("Configuration watcher error: %v\n", err)
+			cm.log().Printf("error: Configuration watcher error: %v", err)
 
 		case <-cm.stopCh:
 			return
@@ -182,18 +319,30 @@ func (cm *ConfigManager) watchForChanges() {
 	}
 }
 
-// Close stops the configuration manager and cleans up resources
-func (cm *ConfigManager) Close() error {
-	close(cm.stopCh)
-	return cm.watcher.Close()
+// pollForChanges reloads the config file if it has changed, every interval
+func (cm *ConfigManager) pollForChanges(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cm.reloadIfChanged()
+		case <-cm.stopCh:
+			return
+		}
+	}
 }
 
-// getConfigDir returns the directory containing the config file
-func getConfigDir(configPath string) string {
-	// Extract directory from config path
-	// For now, just return the parent directory
-	// In a real implementation, you might want to use filepath.Dir()
-	return "."
+// Close stops the configuration manager and cleans up resources
+func (cm *ConfigManager) Close() error {
+	var err error
+	cm.closeOnce.Do(func() {
+		close(cm.stopCh)
+		if cm.watcher != nil {
+			err = cm.watcher.Close()
+		}
+	})
+	return err
 }
 
 // CreateDefaultConfig creates a default configuration file at the specified path
@@ -0,0 +1,130 @@
+package tesla
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestConfigManager saves a config with vin outside the working directory
+// and manages it
+func newTestConfigManager(t *testing.T, vin string) *ConfigManager {
+	t.Helper()
+	config := DefaultConfig()
+	config.Tesla.VIN = vin
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	configManager, err := NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to create config manager: %v", err)
+	}
+	t.Cleanup(func() { configManager.Close() })
+	return configManager
+}
+
+// writeTestConfig replaces the config file the way many editors save: by
+// renaming a new file over it
+func writeTestConfig(t *testing.T, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigManagerReloadsChangedFile(t *testing.T) {
+	configManager := newTestConfigManager(t, "OLD_VIN")
+	var changes atomic.Int32
+	configManager.RegisterCallback(func(oldConfig, newConfig *Config) error {
+		if oldConfig.Tesla.VIN != "OLD_VIN" || newConfig.Tesla.VIN != "NEW_VIN" {
+			t.Errorf("Callback got %s -> %s", oldConfig.Tesla.VIN, newConfig.Tesla.VIN)
+		}
+		// Callbacks may read the config they were told about
+		if configManager.GetConfig() != newConfig {
+			t.Error("GetConfig doesn't return the new config in the callback")
+		}
+		changes.Add(1)
+		return nil
+	})
+
+	config := *configManager.GetConfig()
+	config.Tesla.VIN = "NEW_VIN"
+	data, err := json.MarshalIndent(&config, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestConfig(t, config.ConfigPath, data)
+
+	waitFor(t, 5*time.Second, func() bool { return configManager.GetConfig().Tesla.VIN == "NEW_VIN" })
+	time.Sleep(2 * configDebounce)
+	if n := changes.Load(); n != 1 {
+		t.Errorf("Callbacks ran %d times, want 1", n)
+	}
+}
+
+func TestConfigManagerRejectsInvalidFile(t *testing.T) {
+	configManager := newTestConfigManager(t, "OLD_VIN")
+	path := configManager.GetConfig().ConfigPath
+
+	writeTestConfig(t, path, []byte(`{"tesla": {"vin": ""}, "vehicles": []}`))
+	waitFor(t, 5*time.Second, func() bool { return configManager.ReloadError() != nil })
+	if vin := configManager.GetConfig().Tesla.VIN; vin != "OLD_VIN" {
+		t.Errorf("Invalid file replaced the config: VIN %q", vin)
+	}
+}
+
+func TestConfigManagerUpdateConfig(t *testing.T) {
+	configManager := newTestConfigManager(t, "OLD_VIN")
+	oldConfig := configManager.GetConfig()
+	var changes atomic.Int32
+	configManager.RegisterCallback(func(_, _ *Config) error {
+		changes.Add(1)
+		return nil
+	})
+
+	err := configManager.UpdateConfig(func(c *Config) { c.Tesla.VIN = "" })
+	if err == nil {
+		t.Fatal("Invalid update was accepted")
+	}
+	if err := configManager.UpdateConfig(func(c *Config) { c.Tesla.VIN = "NEW_VIN" }); err != nil {
+		t.Fatalf("UpdateConfig failed: %v", err)
+	}
+	if oldConfig.Tesla.VIN != "OLD_VIN" {
+		t.Errorf("Update changed the config readers already had: VIN %q", oldConfig.Tesla.VIN)
+	}
+	if vin := configManager.GetConfig().Tesla.VIN; vin != "NEW_VIN" {
+		t.Errorf("VIN = %q, want NEW_VIN", vin)
+	}
+
+	// Saving the file mustn't reload it and notify the callbacks again
+	time.Sleep(4 * configDebounce)
+	if n := changes.Load(); n != 1 {
+		t.Errorf("Callbacks ran %d times, want 1", n)
+	}
+}
+
+func TestConfigManagerPolling(t *testing.T) {
+	configManager := newTestConfigManager(t, "OLD_VIN")
+	// Without inotify the manager is already polling, with no watcher
+	if configManager.watcher != nil {
+		configManager.watcher.Close()
+	}
+	go configManager.pollForChanges(10 * time.Millisecond)
+
+	config := *configManager.GetConfig()
+	config.Tesla.VIN = "NEW_VIN"
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, func() bool { return configManager.GetConfig().Tesla.VIN == "NEW_VIN" })
+}
@@ -0,0 +1,121 @@
+package tesla
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fieldAt returns the settable field at a dotted path such as
+// retry.max_retries
+func fieldAt(path string) (envField, bool) {
+	for _, field := range envFields() {
+		if field.Path == path {
+			return field, true
+		}
+	}
+	return envField{}, false
+}
+
+// GetField returns the value at a dotted path: a field such as
+// retry.max_retries, or a whole section such as retry. List items are
+// numbered, as in vehicles.0.vin. Durations are returned as strings such as
+// "30s", and anything else as it's saved in the config file.
+func (c *Config) GetField(path string) (interface{}, error) {
+	if field, ok := fieldAt(path); ok {
+		v, ok := field.lookup(reflect.ValueOf(c).Elem(), false)
+		if !ok {
+			return nil, nil // In an optional section that isn't set
+		}
+		if v.Type() == durationType {
+			return time.Duration(v.Int()).String(), nil
+		}
+		return v.Interface(), nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			item, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("unknown field %s", path)
+			}
+			value = item
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%s: no item %s", path, key)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("unknown field %s", path)
+		}
+	}
+	return value, nil
+}
+
+// SetField parses value by the type of the field at a dotted path, as for
+// the field's environment variable, and sets it: durations as 30s, lists
+// comma-separated and maps as key=value pairs. Setting a field of an optional
+// section such as notifications.smtp turns the section on. Lists of objects,
+// such as vehicles, can't be set this way.
+func (c *Config) SetField(path, value string) error {
+	field, ok := fieldAt(path)
+	if !ok {
+		if hasConfigPath(reflect.TypeOf(Config{}), strings.Split(path, ".")) {
+			return fmt.Errorf("%s can't be set by path; edit the config file", path)
+		}
+		return fmt.Errorf("unknown field %s", path)
+	}
+	v, _ := field.lookup(reflect.ValueOf(c).Elem(), true)
+	if err := setFieldValue(v, field.Type, value); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// hasConfigPath reports whether the JSON path parts name a field of struct
+// type t, such as a section or a list of objects
+func hasConfigPath(t reflect.Type, parts []string) bool {
+	for len(parts) > 0 {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			if t.Kind() == reflect.Slice {
+				if _, err := strconv.Atoi(parts[0]); err == nil {
+					parts = parts[1:]
+					if len(parts) == 0 {
+						return true
+					}
+				}
+			}
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if tag == parts[0] && t.Field(i).IsExported() {
+				t = t.Field(i).Type
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		parts = parts[1:]
+	}
+	return true
+}
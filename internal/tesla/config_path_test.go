@@ -0,0 +1,85 @@
+package tesla
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetField(t *testing.T) {
+	config := DefaultConfig()
+	for path, value := range map[string]string{
+		"retry.max_retries":            "5",
+		"retry.initial_delay":          "2s",
+		"retry.jitter":                 "false",
+		"logging.level":                "debug",
+		"metrics.tags":                 "site=home, rack=2",
+		"notifications.smtp.to":        "a@example.com,b@example.com",
+		"circuit_breaker.max_failures": "9",
+	} {
+		if err := config.SetField(path, value); err != nil {
+			t.Errorf("SetField(%s, %s): %v", path, value, err)
+		}
+	}
+	if config.Retry.MaxRetries != 5 || config.Retry.InitialDelay != 2*time.Second || config.Retry.Jitter {
+		t.Errorf("Retry not set: %+v", config.Retry)
+	}
+	if config.Logging.Level != "debug" || config.CircuitBreaker.MaxFailures != 9 {
+		t.Errorf("Level %q, max failures %d", config.Logging.Level, config.CircuitBreaker.MaxFailures)
+	}
+	if !reflect.DeepEqual(config.Metrics.Tags, map[string]string{"site": "home", "rack": "2"}) {
+		t.Errorf("Tags = %v", config.Metrics.Tags)
+	}
+	if config.Notifications.SMTP == nil || len(config.Notifications.SMTP.To) != 2 {
+		t.Errorf("SMTP not turned on: %+v", config.Notifications.SMTP)
+	}
+
+	for path, want := range map[string]string{
+		"retry.max_retries=many": "invalid integer",
+		"retry.initial_delay=2":  "invalid duration",
+		"retry.nope=1":           "unknown field retry.nope",
+		"vehicles=VIN":           "can't be set by path",
+		"retry=5":                "can't be set by path",
+	} {
+		path, value, _ := strings.Cut(path, "=")
+		if err := config.SetField(path, value); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("SetField(%s, %s): expected error containing %q, got %v", path, value, want, err)
+		}
+	}
+}
+
+func TestGetField(t *testing.T) {
+	config := DefaultConfig()
+	config.Vehicles = []VehicleConfig{{VIN: "VIN_A", Name: "Daily"}}
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"retry.max_retries", 3},
+		{"retry.initial_delay", "1s"},
+		{"logging.level", "info"},
+		{"notifications.smtp.host", nil}, // SMTP isn't configured
+		{"vehicles.0.name", "Daily"},
+		{"circuit_breaker", map[string]interface{}{
+			"max_failures": float64(5), "reset_timeout": float64(time.Minute), "half_open_max_calls": float64(3),
+		}},
+	}
+	for _, tt := range tests {
+		got, err := config.GetField(tt.path)
+		if err != nil {
+			t.Errorf("GetField(%s): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetField(%s) = %#v, want %#v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"retry.nope", "vehicles.1.vin", "retry.max_retries.x"} {
+		if _, err := config.GetField(path); err == nil {
+			t.Errorf("GetField(%s): expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package tesla
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ProfileNames returns the names of the config's profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfile returns a copy of the config with the named profile's
+// overrides merged over it, and Profile set to name. An empty name returns a
+// copy without a profile applied.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	if name == "" {
+		config := *c
+		config.Profile = ""
+		return &config, nil
+	}
+	overrides, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q is not defined", name)
+	}
+	config, err := c.applyOverrides(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("profiles.%s: %w", name, err)
+	}
+	config.Profile = name
+	config.Profiles = c.Profiles
+	return config, nil
+}
+
+// applyOverrides returns a copy of the config with overrides, a JSON merge
+// patch, merged over it. The copy has no profiles.
+func (c *Config) applyOverrides(overrides json.RawMessage) (*Config, error) {
+	var patch map[string]interface{}
+	if err := json.Unmarshal(overrides, &patch); err != nil {
+		return nil, fmt.Errorf("overrides must be a JSON object: %w", err)
+	}
+	for _, key := range []string{"profile", "profiles"} {
+		if _, ok := patch[key]; ok {
+			return nil, fmt.Errorf("a profile can't set %s", key)
+		}
+	}
+
+	base := *c
+	base.Profile, base.Profiles = "", nil
+	data, err := json.Marshal(&base)
+	if err != nil {
+		return nil, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(data, &target); err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(MergePatch(target, patch)); err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, err
+	}
+	config.ConfigPath = c.ConfigPath
+	return config, nil
+}
+
+// validateProfiles checks that the active profile is defined, and that the
+// config is valid with each profile applied
+func (c *Config) validateProfiles() error {
+	if c.Profile != "" {
+		if _, ok := c.Profiles[c.Profile]; !ok {
+			return fmt.Errorf("profile: %q is not defined in profiles", c.Profile)
+		}
+	}
+	for _, name := range c.ProfileNames() {
+		if name == "" {
+			return fmt.Errorf("profiles: a profile needs a name")
+		}
+		config, err := c.applyOverrides(c.Profiles[name])
+		if err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("profiles.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// MergePatch applies a JSON merge patch (RFC 7386) to target, both generic
+// JSON: objects merge, null deletes, and anything else replaces. target may
+// be modified.
+func MergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetMap, ok := target.(map[string]interface{})
+	if !ok {
+		targetMap = map[string]interface{}{}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(targetMap, key)
+		} else {
+			targetMap[key] = MergePatch(targetMap[key], value)
+		}
+	}
+	return targetMap
+}
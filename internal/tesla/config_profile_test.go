@@ -0,0 +1,123 @@
+package tesla
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profileTestConfig has a garage profile with a longer request timeout and
+// its own vehicle
+func profileTestConfig() *Config {
+	config := DefaultConfig()
+	config.Tesla.VIN = "HOME_VIN"
+	config.Profiles = map[string]json.RawMessage{
+		"home":   json.RawMessage(`{}`),
+		"garage": json.RawMessage(`{"tesla": {"vin": "GARAGE_VIN", "request_timeout": 60000000000}, "retry": {"max_retries": 9}}`),
+	}
+	return config
+}
+
+func TestConfigWithProfile(t *testing.T) {
+	config := profileTestConfig()
+
+	garage, err := config.WithProfile("garage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if garage.Profile != "garage" || garage.Tesla.VIN != "GARAGE_VIN" || garage.Tesla.RequestTimeout != time.Minute || garage.Retry.MaxRetries != 9 {
+		t.Errorf("Profile not applied: %s %s %v %d", garage.Profile, garage.Tesla.VIN, garage.Tesla.RequestTimeout, garage.Retry.MaxRetries)
+	}
+	// Fields the profile leaves out keep the base's values
+	if garage.Retry.InitialDelay != config.Retry.InitialDelay || garage.Tesla.ScanTimeout != config.Tesla.ScanTimeout {
+		t.Errorf("Profile changed fields it doesn't set: %+v", garage.Retry)
+	}
+	if config.Tesla.VIN != "HOME_VIN" || config.Retry.MaxRetries != 3 {
+		t.Errorf("Applying a profile changed the base: %s %d", config.Tesla.VIN, config.Retry.MaxRetries)
+	}
+
+	if _, err := config.WithProfile("office"); err == nil {
+		t.Error("Expected an undefined profile to be an error")
+	}
+	if none, err := config.WithProfile(""); err != nil || none.Tesla.VIN != "HOME_VIN" {
+		t.Errorf("No profile: VIN %v, %v", none, err)
+	}
+}
+
+func TestConfigValidateProfiles(t *testing.T) {
+	config := profileTestConfig()
+	config.Profile = "garage"
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Valid profiles rejected: %v", err)
+	}
+
+	for overrides, want := range map[string]string{
+		`{"retry": {"max_retries": -1}}`: "profiles.bad: retry.max_retries",
+		`{"retry": {"max_retrys": 1}}`:   "max_retrys",
+		`{"profile": "home"}`:            "can't set profile",
+		`[]`:                             "must be a JSON object",
+	} {
+		config := profileTestConfig()
+		config.Profiles["bad"] = json.RawMessage(overrides)
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Profile %s: expected error containing %q, got %v", overrides, want, err)
+		}
+	}
+
+	config = profileTestConfig()
+	config.Profile = "office"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "not defined") {
+		t.Errorf("Expected an undefined active profile to be rejected, got %v", err)
+	}
+}
+
+func TestConfigManagerSwitchProfile(t *testing.T) {
+	config := profileTestConfig()
+	config.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	configManager, err := NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { configManager.Close() })
+
+	var seen *Config
+	configManager.RegisterCallback(func(oldConfig, newConfig *Config) error {
+		seen = newConfig
+		return nil
+	})
+	if err := configManager.SwitchProfile("garage"); err != nil {
+		t.Fatalf("SwitchProfile failed: %v", err)
+	}
+	if seen == nil || seen.Tesla.RequestTimeout != time.Minute || seen.Profile != "garage" {
+		t.Fatalf("Callback didn't see the garage profile: %+v", seen)
+	}
+	if configManager.GetConfig() != seen {
+		t.Error("GetConfig doesn't return the switched config")
+	}
+
+	// The choice is saved, but the profile's settings stay in the profile
+	saved, err := LoadConfig(config.ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Profile != "garage" || saved.Tesla.VIN != "HOME_VIN" || saved.Retry.MaxRetries != 3 {
+		t.Errorf("Saved profile %q, VIN %s, max retries %d", saved.Profile, saved.Tesla.VIN, saved.Retry.MaxRetries)
+	}
+	if base := configManager.BaseConfig(); base.Tesla.VIN != "HOME_VIN" {
+		t.Errorf("Base config has VIN %s", base.Tesla.VIN)
+	}
+
+	if err := configManager.SwitchProfile("office"); err == nil {
+		t.Error("Expected switching to an undefined profile to fail")
+	}
+	if err := configManager.SwitchProfile(""); err != nil || configManager.GetConfig().Tesla.VIN != "HOME_VIN" {
+		t.Errorf("Switching off profiles: VIN %s, %v", configManager.GetConfig().Tesla.VIN, err)
+	}
+}
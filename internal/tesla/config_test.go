@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/acme"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -180,7 +182,9 @@ func TestConfigLoadFromEnv(t *testing.T) {
 	}()
 	
 	config := DefaultConfig()
-	config.LoadFromEnv()
+	if err := config.LoadFromEnv(); err != nil {
+		t.Fatalf("Failed to load environment: %v", err)
+	}
 	
 	if config.Tesla.VIN != "ENV_VIN_123" {
 		t.Errorf("Expected VIN 'ENV_VIN_123', got '%s'", config.Tesla.VIN)
@@ -298,3 +302,55 @@ func TestCreateDefaultConfig(t *testing.T) {
 	}
 }
 
+
+func TestConfigDataPath(t *testing.T) {
+	config := DefaultConfig()
+	config.ConfigPath = filepath.Join("etc", "tesla", "config.json")
+	if path := config.DataPath(); path != filepath.Join("etc", "tesla", "data") {
+		t.Errorf("Expected data directory next to config, got %s", path)
+	}
+
+	config.DataDir = "/var/lib/tesla"
+	if path := config.DataPath(); path != "/var/lib/tesla" {
+		t.Errorf("Expected configured data directory, got %s", path)
+	}
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		tls   TLSConfig
+		valid bool
+	}{
+		{"disabled", TLSConfig{}, true},
+		{"files", TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}, true},
+		{"cert without key", TLSConfig{CertFile: "cert.pem"}, false},
+		{"acme", TLSConfig{ACME: acme.Config{Hostname: "car.example.com", AcceptTerms: true}}, true},
+		{"acme without terms", TLSConfig{ACME: acme.Config{Hostname: "car.example.com"}}, false},
+		{"files and acme", TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ACME: acme.Config{Hostname: "car.example.com", AcceptTerms: true}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.tls.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestDogModeConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dogMode DogModeConfig
+		valid   bool
+	}{
+		{"defaults", DogModeConfig{}, true},
+		{"custom", DogModeConfig{Interval: 30 * time.Second, MinTempCelsius: 15, MaxTempCelsius: 25, MinBatteryLevel: 30}, true},
+		{"short interval", DogModeConfig{Interval: time.Second}, false},
+		{"inverted range", DogModeConfig{MinTempCelsius: 35}, false},
+		{"battery", DogModeConfig{MinBatteryLevel: 101}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.dogMode.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
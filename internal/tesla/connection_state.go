@@ -0,0 +1,73 @@
+package tesla
+
+import "fmt"
+
+// ConnectionStatus is a transition of the client's connection to the vehicle
+type ConnectionStatus struct {
+	State    ConnectionState `json:"state"`
+	Previous ConnectionState `json:"previous"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ConnectionState returns the current state of the connection to the vehicle
+func (c *Client) ConnectionState() ConnectionState {
+	c.connStateMutex.RLock()
+	defer c.connStateMutex.RUnlock()
+	return c.connState
+}
+
+// setConnectionState records a connection state and publishes
+// EventConnectionState when it changes. err describes a transition to
+// StateError.
+func (c *Client) setConnectionState(state ConnectionState, err error) {
+	c.connStateMutex.Lock()
+	previous := c.connState
+	c.connState = state
+	c.connStateMutex.Unlock()
+
+	if previous == state {
+		return
+	}
+	status := ConnectionStatus{State: state, Previous: previous}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	c.events.Publish(Event{Type: EventConnectionState, VIN: c.vin, Data: status})
+}
+
+// setKeepConnected records whether the connection should be kept up: true
+// after a successful connect, false after a deliberate disconnect
+func (c *Client) setKeepConnected(keep bool) {
+	c.connStateMutex.Lock()
+	defer c.connStateMutex.Unlock()
+	c.keepConnected = keep
+}
+
+// KeepConnected reports whether the client has connected and not been
+// disconnected on purpose since, so a dropped session should be reconnected
+func (c *Client) KeepConnected() bool {
+	c.connStateMutex.RLock()
+	defer c.connStateMutex.RUnlock()
+	return c.keepConnected
+}
+
+// closeConnection closes the vehicle connection, if any
+func (c *Client) closeConnection() {
+	c.saveSessions()
+	if c.vehicle != nil {
+		c.vehicle.Disconnect()
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.vehicle = nil
+	c.conn = nil
+}
+
+// dropConnection closes a connection that has stopped working. Unlike
+// Disconnect it leaves the client wanting to be connected.
+func (c *Client) dropConnection(err error) {
+	c.closeConnection()
+	c.logger.Printf("Lost connection to vehicle %s: %v", c.vin, err)
+	c.setConnectionState(StateError, fmt.Errorf("%w: %v", ErrConnectionLost, err))
+}
@@ -0,0 +1,46 @@
+package tesla
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestConnectionStateEvents(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if client.ConnectionState() != StateDisconnected {
+		t.Fatalf("Expected disconnected initially, got %s", client.ConnectionState())
+	}
+
+	events, unsubscribe := client.Events().Subscribe(8)
+	defer unsubscribe()
+
+	client.setConnectionState(StateScanning, nil)
+	client.setConnectionState(StateScanning, nil)
+	client.setConnectionState(StateError, errors.New("no beacon"))
+
+	first := <-events
+	status := first.Data.(ConnectionStatus)
+	if first.Type != EventConnectionState || status.State != StateScanning || status.Previous != StateDisconnected {
+		t.Errorf("Unexpected first event %+v", first)
+	}
+	// Repeating a state publishes nothing
+	second := <-events
+	status = second.Data.(ConnectionStatus)
+	if status.State != StateError || status.Previous != StateScanning || status.Error != "no beacon" {
+		t.Errorf("Unexpected second event %+v", second)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no more events, have %d", len(events))
+	}
+}
+
+func TestConnectionStateJSON(t *testing.T) {
+	data, err := json.Marshal(ConnectionStatus{State: StateSessionActive, Previous: StateConnected})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"state":"session_active","previous":"connected"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
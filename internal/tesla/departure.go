@@ -0,0 +1,193 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// Days a scheduled departure preconditions the cabin or charges off-peak
+const (
+	DeparturePolicyOff      = "off"
+	DeparturePolicyAllWeek  = "all_week"
+	DeparturePolicyWeekdays = "weekdays"
+)
+
+// departurePolicies maps policy names to the vehicle library's policies
+var departurePolicies = map[string]vehicle.ChargingPolicy{
+	DeparturePolicyOff:      vehicle.ChargingPolicyOff,
+	DeparturePolicyAllWeek:  vehicle.ChargingPolicyAllDays,
+	DeparturePolicyWeekdays: vehicle.ChargingPolicyWeekdays,
+}
+
+// ScheduledDeparture is the vehicle's own "ready by" schedule: it
+// preconditions the cabin and battery, and can finish charging off-peak, so
+// the car is ready at the departure time. Times are HH:MM in the vehicle's
+// time zone.
+type ScheduledDeparture struct {
+	Enabled         bool   `json:"enabled"`
+	DepartureTime   string `json:"departure_time"`
+	Preconditioning string `json:"preconditioning"`             // off, all_week or weekdays
+	OffPeakCharging string `json:"off_peak_charging"`           // off, all_week or weekdays
+	OffPeakEndTime  string `json:"off_peak_end_time,omitempty"` // When off-peak rates end
+}
+
+// Validate checks a departure to set
+func (d ScheduledDeparture) Validate() error {
+	if _, err := parseTimeOfDay(d.DepartureTime); err != nil {
+		return fmt.Errorf("departure_time: %w", err)
+	}
+	if _, ok := departurePolicies[d.policy(d.Preconditioning)]; !ok {
+		return fmt.Errorf("preconditioning must be off, all_week or weekdays")
+	}
+	if _, ok := departurePolicies[d.policy(d.OffPeakCharging)]; !ok {
+		return fmt.Errorf("off_peak_charging must be off, all_week or weekdays")
+	}
+	if d.policy(d.OffPeakCharging) != DeparturePolicyOff {
+		if _, err := parseTimeOfDay(d.OffPeakEndTime); err != nil {
+			return fmt.Errorf("off_peak_end_time: %w", err)
+		}
+	}
+	return nil
+}
+
+// policy defaults an unset policy to off
+func (d ScheduledDeparture) policy(name string) string {
+	if name == "" {
+		return DeparturePolicyOff
+	}
+	return name
+}
+
+// parseTimeOfDay parses HH:MM into the time after midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day such as 07:30", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// formatTimeOfDay formats minutes after midnight as HH:MM
+func formatTimeOfDay(minutes uint32) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60%24, minutes%60)
+}
+
+// scheduledDepartureFrom reads the departure schedule from the vehicle's
+// charge state
+func scheduledDepartureFrom(chargeState *carserver.ChargeState) *ScheduledDeparture {
+	departure := &ScheduledDeparture{
+		Enabled:         chargeState.GetScheduledChargingMode() == carserver.ChargeState_ScheduledChargingModeDepartBy,
+		DepartureTime:   formatTimeOfDay(chargeState.GetScheduledDepartureTimeMinutes()),
+		Preconditioning: DeparturePolicyOff,
+		OffPeakCharging: DeparturePolicyOff,
+	}
+	switch chargeState.GetPreconditioningTimes().GetTimes().(type) {
+	case *carserver.PreconditioningTimes_AllWeek:
+		departure.Preconditioning = DeparturePolicyAllWeek
+	case *carserver.PreconditioningTimes_Weekdays:
+		departure.Preconditioning = DeparturePolicyWeekdays
+	}
+	switch chargeState.GetOffPeakChargingTimes().GetTimes().(type) {
+	case *carserver.OffPeakChargingTimes_AllWeek:
+		departure.OffPeakCharging = DeparturePolicyAllWeek
+	case *carserver.OffPeakChargingTimes_Weekdays:
+		departure.OffPeakCharging = DeparturePolicyWeekdays
+	}
+	if departure.OffPeakCharging != DeparturePolicyOff {
+		departure.OffPeakEndTime = formatTimeOfDay(chargeState.GetOffPeakHoursEndTime())
+	}
+	return departure
+}
+
+// GetScheduledDeparture reads the vehicle's scheduled departure with retry
+// logic
+func (c *Client) GetScheduledDeparture(ctx context.Context) (*ScheduledDeparture, error) {
+	departureCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+	defer cancel()
+
+	var result *ScheduledDeparture
+	err := c.retryWithBackoff(departureCtx, "get_scheduled_departure", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		state, err := c.vehicle.GetState(departureCtx, vehicle.StateCategoryCharge)
+		if err != nil {
+			return fmt.Errorf("failed to get charge state: %w", err)
+		}
+		chargeState := state.GetChargeState()
+		if chargeState == nil {
+			return fmt.Errorf("no charge state data received")
+		}
+
+		result = scheduledDepartureFrom(chargeState)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetScheduledDeparture sets the vehicle's scheduled departure with retry
+// logic
+func (c *Client) SetScheduledDeparture(ctx context.Context, departure ScheduledDeparture) (err error) {
+	if err := departure.Validate(); err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"departure_time":    departure.DepartureTime,
+		"preconditioning":   departure.policy(departure.Preconditioning),
+		"off_peak_charging": departure.policy(departure.OffPeakCharging),
+		"off_peak_end_time": departure.OffPeakEndTime,
+	}
+	if err := c.runCommandHooks(ctx, "set_scheduled_departure", params); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_scheduled_departure", err) }()
+
+	departAt, _ := parseTimeOfDay(departure.DepartureTime)
+	var offPeakEnd time.Duration
+	if departure.OffPeakEndTime != "" {
+		offPeakEnd, _ = parseTimeOfDay(departure.OffPeakEndTime)
+	}
+	preconditioning := departurePolicies[departure.policy(departure.Preconditioning)]
+	offPeak := departurePolicies[departure.policy(departure.OffPeakCharging)]
+
+	departureCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+	defer cancel()
+
+	return c.retryWithBackoff(departureCtx, "set_scheduled_departure", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		logging.Debugf(c.logFor(ctx), "Setting scheduled departure - Time: %s, Preconditioning: %s, Off-peak: %s",
+			departure.DepartureTime, departure.policy(departure.Preconditioning), departure.policy(departure.OffPeakCharging))
+		return c.vehicle.ScheduleDeparture(departureCtx, departAt, offPeakEnd, preconditioning, offPeak)
+	})
+}
+
+// ClearScheduledDeparture turns the vehicle's scheduled departure off with
+// retry logic
+func (c *Client) ClearScheduledDeparture(ctx context.Context) (err error) {
+	if err := c.runCommandHooks(ctx, "clear_scheduled_departure", nil); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("clear_scheduled_departure", err) }()
+
+	departureCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+	defer cancel()
+
+	return c.retryWithBackoff(departureCtx, "clear_scheduled_departure", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+		return c.vehicle.ClearScheduledDeparture(departureCtx)
+	})
+}
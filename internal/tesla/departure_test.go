@@ -0,0 +1,82 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestScheduledDepartureValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		departure ScheduledDeparture
+		wantErr   bool
+	}{
+		{"time only", ScheduledDeparture{DepartureTime: "07:30"}, false},
+		{"off-peak", ScheduledDeparture{DepartureTime: "07:30", Preconditioning: DeparturePolicyWeekdays,
+			OffPeakCharging: DeparturePolicyAllWeek, OffPeakEndTime: "06:00"}, false},
+		{"missing time", ScheduledDeparture{}, true},
+		{"bad time", ScheduledDeparture{DepartureTime: "25:00"}, true},
+		{"bad policy", ScheduledDeparture{DepartureTime: "07:30", Preconditioning: "daily"}, true},
+		{"off-peak without end", ScheduledDeparture{DepartureTime: "07:30", OffPeakCharging: DeparturePolicyWeekdays}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.departure.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	d, err := parseTimeOfDay("07:30")
+	if err != nil || d != 7*time.Hour+30*time.Minute {
+		t.Errorf("parseTimeOfDay(07:30) = %v, %v", d, err)
+	}
+	if got := formatTimeOfDay(uint32(d / time.Minute)); got != "07:30" {
+		t.Errorf("formatTimeOfDay() = %s, want 07:30", got)
+	}
+}
+
+func TestScheduledDepartureFrom(t *testing.T) {
+	chargeState := &carserver.ChargeState{
+		OptionalScheduledChargingMode: &carserver.ChargeState_ScheduledChargingMode_{
+			ScheduledChargingMode: carserver.ChargeState_ScheduledChargingModeDepartBy,
+		},
+		OptionalScheduledDepartureTimeMinutes: &carserver.ChargeState_ScheduledDepartureTimeMinutes{ScheduledDepartureTimeMinutes: 450},
+		PreconditioningTimes: &carserver.PreconditioningTimes{
+			Times: &carserver.PreconditioningTimes_Weekdays{Weekdays: &carserver.Void{}},
+		},
+		OffPeakChargingTimes: &carserver.OffPeakChargingTimes{
+			Times: &carserver.OffPeakChargingTimes_AllWeek{AllWeek: &carserver.Void{}},
+		},
+		OptionalOffPeakHoursEndTime: &carserver.ChargeState_OffPeakHoursEndTime{OffPeakHoursEndTime: 360},
+	}
+
+	want := ScheduledDeparture{
+		Enabled:         true,
+		DepartureTime:   "07:30",
+		Preconditioning: DeparturePolicyWeekdays,
+		OffPeakCharging: DeparturePolicyAllWeek,
+		OffPeakEndTime:  "06:00",
+	}
+	if got := scheduledDepartureFrom(chargeState); *got != want {
+		t.Errorf("scheduledDepartureFrom() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestSetScheduledDepartureNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := client.SetScheduledDeparture(ctx, ScheduledDeparture{}); err == nil {
+		t.Error("Expected a validation error")
+	}
+	if err := client.SetScheduledDeparture(ctx, ScheduledDeparture{DepartureTime: "07:30"}); err == nil {
+		t.Error("Expected error when not connected")
+	}
+}
@@ -0,0 +1,157 @@
+package tesla
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// ErrEnrollmentTimeout is returned when nobody approves an add-key request
+// in time
+var ErrEnrollmentTimeout = errors.New("add-key request was not approved in time")
+
+// enrollPollInterval is how often the vehicle is asked whether a requested
+// key has been approved
+var enrollPollInterval = 2 * time.Second
+
+// KeyRole is the access a key enrolled on the vehicle has
+type KeyRole string
+
+const (
+	KeyRoleOwner  KeyRole = "owner"  // Can also add and remove other keys
+	KeyRoleDriver KeyRole = "driver" // Can drive and control the vehicle
+)
+
+// ParseKeyRole parses owner or driver. An empty name is a driver, which is
+// all climate control needs.
+func ParseKeyRole(name string) (KeyRole, error) {
+	switch role := KeyRole(strings.ToLower(name)); role {
+	case "":
+		return KeyRoleDriver, nil
+	case KeyRoleOwner, KeyRoleDriver:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown key role %q (expected owner or driver)", name)
+}
+
+// proto returns the role in the vehicle protocol
+func (r KeyRole) proto() keys.Role {
+	if r == KeyRoleOwner {
+		return keys.Role_ROLE_OWNER
+	}
+	return keys.Role_ROLE_DRIVER
+}
+
+// PublicKey returns the public half of the client's private key
+func (c *Client) PublicKey() (*ecdh.PublicKey, error) {
+	if c.privateKeyFile == "" {
+		return nil, fmt.Errorf("no private key file configured")
+	}
+	privateKey, err := loadPrivateKeyFile(c.privateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
+	}
+	return ecdh.P256().NewPublicKey(privateKey.PublicBytes())
+}
+
+// EnrollKey asks the vehicle over BLE to add publicKey with role, calls
+// requested once the request is sent, then waits until the owner approves
+// it by tapping a key card on the center console and confirming on the
+// touchscreen, or ctx ends. The current connection is used if it is over
+// BLE; otherwise a connection is opened for the enrollment alone, since an
+// unenrolled key can't start a session.
+func (c *Client) EnrollKey(ctx context.Context, publicKey *ecdh.PublicKey, role KeyRole, requested func()) error {
+	car, release, err := c.enrollmentVehicle(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := car.SendAddKeyRequestWithRole(ctx, publicKey, role.proto(), vcsec.KeyFormFactor_KEY_FORM_FACTOR_CLOUD_KEY); err != nil {
+		return fmt.Errorf("failed to send add-key request: %w", err)
+	}
+	c.logFor(ctx).Printf("Sent add-key request for a %s key to %s; waiting for a key card tap", role, c.vin)
+	if requested != nil {
+		requested()
+	}
+
+	ticker := time.NewTicker(enrollPollInterval)
+	defer ticker.Stop()
+	for {
+		// A key that can open an infotainment session can control climate
+		info, err := car.SessionInfo(ctx, publicKey, universal.Domain_DOMAIN_INFOTAINMENT)
+		if err == nil && info.GetStatus() == signatures.Session_Info_Status_SESSION_INFO_STATUS_OK {
+			c.logFor(ctx).Printf("Key enrolled on %s", c.vin)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrEnrollmentTimeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// enrollmentVehicle returns a vehicle reachable over BLE and a function to
+// call once done with it
+func (c *Client) enrollmentVehicle(ctx context.Context) (VehicleCommander, func(), error) {
+	if car := c.vehicle; car != nil {
+		if active := c.ActiveTransport(); active == TransportBLE || active == TransportSim {
+			return car, func() {}, nil
+		}
+	}
+
+	transport := c.enrollmentTransport()
+	conn, err := transport.Dial(ctx, c.vin)
+	if err != nil {
+		return nil, nil, err
+	}
+	car, err := c.newVehicle(transport, conn, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create vehicle instance: %w", err)
+	}
+	if err := car.Connect(ctx); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to connect to vehicle: %w", err)
+	}
+	return car, func() {
+		car.Disconnect()
+		conn.Close()
+	}, nil
+}
+
+// enrollmentTransport returns the first configured transport that can carry
+// an add-key request, or else BLE
+func (c *Client) enrollmentTransport() Transport {
+	for _, transport := range c.transportChain(c.scan) {
+		if transport.Type() == TransportBLE || transport.Type() == TransportSim {
+			return transport
+		}
+	}
+	c.transportMutex.RLock()
+	defer c.transportMutex.RUnlock()
+	return c.newTransport(TransportBLE, c.scan)
+}
+
+// Enroll enrolls the key manager's public key on the client's vehicle over
+// BLE. See Client.EnrollKey.
+func (km *KeyManager) Enroll(ctx context.Context, client *Client, role KeyRole, requested func()) error {
+	if km.publicKey == nil {
+		return fmt.Errorf("no public key available, generate key pair first")
+	}
+	publicKey, err := km.publicKey.ECDH()
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	km.logger.Printf("Enrolling key %s as %s on %s", km.keyName, role, client.GetVIN())
+	return client.EnrollKey(ctx, publicKey, role, requested)
+}
@@ -0,0 +1,126 @@
+package tesla
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+)
+
+func newTestPublicKey(t *testing.T) *ecdh.PublicKey {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key.PublicKey()
+}
+
+func fastEnrollPolling(t *testing.T) {
+	interval := enrollPollInterval
+	enrollPollInterval = time.Millisecond
+	t.Cleanup(func() { enrollPollInterval = interval })
+}
+
+func TestEnrollKeyOverConnection(t *testing.T) {
+	fastEnrollPolling(t)
+	car := newFakeVehicle()
+	client, _ := newFakeClient(t, car)
+	// Not approved until the third check
+	car.errs["SessionInfo"] = []error{protocol.ErrKeyNotPaired, protocol.ErrKeyNotPaired}
+
+	requested := false
+	if err := client.EnrollKey(context.Background(), newTestPublicKey(t), KeyRoleDriver, func() { requested = true }); err != nil {
+		t.Fatalf("Failed to enroll key: %v", err)
+	}
+	if !requested {
+		t.Error("Expected to be told the request was sent")
+	}
+	if n := car.called("SendAddKeyRequestWithRole"); n != 1 {
+		t.Errorf("Expected one add-key request, got %d", n)
+	}
+	if n := car.called("SessionInfo"); n != 3 {
+		t.Errorf("Expected 3 checks for approval, got %d", n)
+	}
+	if n := car.called("Connect"); n != 1 || !client.IsConnected() {
+		t.Errorf("Expected the existing connection to be used, got %d connects", n)
+	}
+}
+
+func TestEnrollKeyOpensConnection(t *testing.T) {
+	fastEnrollPolling(t)
+	car := newFakeVehicle()
+	conn := &fakeConnector{}
+	client := NewClient("TEST_VIN", log.New(io.Discard, "", 0))
+	client.SetTransports(&fakeTransport{kind: TransportBLE, conn: conn})
+	client.SetVehicleFactory(func(c Connector, privateKey authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		if privateKey != nil {
+			t.Error("Expected an unauthenticated vehicle")
+		}
+		return car, nil
+	})
+
+	if err := client.EnrollKey(context.Background(), newTestPublicKey(t), KeyRoleOwner, nil); err != nil {
+		t.Fatalf("Failed to enroll key: %v", err)
+	}
+	if car.called("Connect") != 1 || car.called("Disconnect") != 1 || !conn.isClosed() {
+		t.Error("Expected a connection for the enrollment alone")
+	}
+	if car.called("StartSession") != 0 {
+		t.Error("Expected no session to be started")
+	}
+}
+
+func TestEnrollKeyTimeout(t *testing.T) {
+	fastEnrollPolling(t)
+	car := newFakeVehicle()
+	client, _ := newFakeClient(t, car)
+	notPaired := make([]error, 1000)
+	for i := range notPaired {
+		notPaired[i] = protocol.ErrKeyNotPaired
+	}
+	car.errs["SessionInfo"] = notPaired
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.EnrollKey(ctx, newTestPublicKey(t), KeyRoleDriver, nil); !errors.Is(err, ErrEnrollmentTimeout) {
+		t.Errorf("Expected ErrEnrollmentTimeout, got %v", err)
+	}
+}
+
+func TestKeyManagerEnrollSimulator(t *testing.T) {
+	client, sim, _ := newSimulatedClient(t)
+	manager := newTestKeyManager(t)
+
+	if err := manager.Enroll(context.Background(), client, KeyRoleDriver, nil); err != nil {
+		t.Fatalf("Failed to enroll key: %v", err)
+	}
+	publicKey, err := manager.GetPublicKey().ECDH()
+	if err != nil {
+		t.Fatalf("Invalid public key: %v", err)
+	}
+	info, err := sim.SessionInfo(context.Background(), publicKey, 0)
+	if err != nil || info.GetStatus() != signatures.Session_Info_Status_SESSION_INFO_STATUS_OK {
+		t.Errorf("Expected the simulator to have the key, got %v (%v)", info, err)
+	}
+}
+
+func TestParseKeyRole(t *testing.T) {
+	tests := map[string]KeyRole{"": KeyRoleDriver, "driver": KeyRoleDriver, "Owner": KeyRoleOwner}
+	for name, expected := range tests {
+		if role, err := ParseKeyRole(name); err != nil || role != expected {
+			t.Errorf("ParseKeyRole(%q) = %s, %v; expected %s", name, role, err, expected)
+		}
+	}
+	if _, err := ParseKeyRole("service"); err == nil {
+		t.Error("Expected an unknown role to fail")
+	}
+}
@@ -0,0 +1,107 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// ErrorClass is what retrying an operation that failed with an error can do
+type ErrorClass int
+
+const (
+	ErrorRetryable ErrorClass = iota // A transient failure; another attempt may succeed
+	ErrorTerminal                    // Retrying can't help, as with a bad parameter or a rejected key
+	ErrorNeedsWake                   // The vehicle is asleep; waking it is the fix
+)
+
+// String returns the class's name
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorTerminal:
+		return "terminal"
+	case ErrorNeedsWake:
+		return "needs_wake"
+	}
+	return "retryable"
+}
+
+// terminalErrors fail the same way however often they're retried
+var terminalErrors = []error{
+	ErrNotConnected,
+	ErrCircuitOpen,
+	ErrCommandVetoed,
+	ErrClimateSkipped,
+	ErrWakeTimeout,
+	ErrPassphraseRequired,
+	ErrIncorrectPassphrase,
+	ErrKeyPairNotFound,
+	ErrNoRefreshToken,
+	protocol.ErrKeyNotPaired,
+	protocol.ErrRequiresKey,
+	protocol.ErrInvalidPublicKey,
+	protocol.ErrUnpexpectedPublicKey,
+	protocol.ErrProtocolNotSupported,
+	protocol.ErrRequiresBLE,
+	protocol.ErrRequiresEncryption,
+	context.Canceled,
+}
+
+// ClassifyError says whether an operation that failed with err is worth
+// retrying. The vehicle's own refusals, such as a bad parameter or an
+// unknown key, are terminal unless the vehicle marks them temporary, as are
+// Fleet API client errors such as an expired token. Anything unrecognized is
+// retryable.
+func ClassifyError(err error) ErrorClass {
+	if errors.Is(err, inet.ErrVehicleNotAwake) {
+		return ErrorNeedsWake
+	}
+	for _, target := range terminalErrors {
+		if errors.Is(err, target) {
+			return ErrorTerminal
+		}
+	}
+
+	var faultErr *protocol.RoutableMessageError
+	if errors.As(err, &faultErr) && !faultErr.Temporary() {
+		return ErrorTerminal
+	}
+	var nominalErr *protocol.NominalError
+	if errors.As(err, &nominalErr) && !nominalErr.Temporary() {
+		return ErrorTerminal
+	}
+	var keychainErr *protocol.KeychainError
+	if errors.As(err, &keychainErr) {
+		return ErrorTerminal
+	}
+	var httpErr *inet.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Code >= 400 && httpErr.Code < 500 &&
+		httpErr.Code != http.StatusTooManyRequests && !httpErr.Temporary() {
+		return ErrorTerminal
+	}
+	return ErrorRetryable
+}
+
+// classifyError classifies err as ClassifyError does, except that over BLE a
+// sleeping vehicle doesn't answer, so a timeout while it was last seen
+// asleep needs a wake
+func (c *Client) classifyError(err error) ErrorClass {
+	class := ClassifyError(err)
+	if class == ErrorRetryable && isTimeout(err) && c.AwakeStatus().State == Asleep {
+		return ErrorNeedsWake
+	}
+	return class
+}
+
+// isTimeout reports whether err is the vehicle not answering in time
+func isTimeout(err error) bool {
+	var faultErr *protocol.RoutableMessageError
+	if errors.As(err, &faultErr) && faultErr.Code == universal.MessageFault_E_MESSAGEFAULT_ERROR_TIMEOUT {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrOperationTimeout)
+}
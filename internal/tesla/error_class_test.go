@@ -0,0 +1,84 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{errors.New("BLE write failed"), ErrorRetryable},
+		{fmt.Errorf("%w: EOF", ErrConnectionLost), ErrorRetryable},
+		{context.DeadlineExceeded, ErrorRetryable},
+		{protocol.ErrBusy, ErrorRetryable},
+		{&protocol.RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_BUSY}, ErrorRetryable},
+		{&inet.HTTPError{Code: 429}, ErrorRetryable},
+		{&inet.HTTPError{Code: 503}, ErrorRetryable},
+		{&protocol.RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_BAD_PARAMETER}, ErrorTerminal},
+		{fmt.Errorf("start session: %w", protocol.ErrKeyNotPaired), ErrorTerminal},
+		{&protocol.NominalError{Details: errors.New("temperature out of range")}, ErrorTerminal},
+		{&inet.HTTPError{Code: 401, Message: "token expired"}, ErrorTerminal},
+		{fmt.Errorf("%w: hook said no", ErrCommandVetoed), ErrorTerminal},
+		{ErrCircuitOpen, ErrorTerminal},
+		{fmt.Errorf("set_temperature: %w", inet.ErrVehicleNotAwake), ErrorNeedsWake},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryFailsFastOnTerminalError(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.retryConfig.MaxRetries = 3
+
+	calls := 0
+	err := client.retryWithBackoff(context.Background(), "set_temperature", func() error {
+		calls++
+		return &protocol.RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_BAD_PARAMETER}
+	})
+	if calls != 1 {
+		t.Errorf("Terminal error was tried %d times, want 1", calls)
+	}
+	if err == nil || errors.Is(err, ErrRetryExhausted) {
+		t.Errorf("Expected the terminal error itself, got %v", err)
+	}
+}
+
+func TestRetryWakesSleepingVehicle(t *testing.T) {
+	client, _, _ := newSimulatedClient(t)
+	client.retryConfig.MaxRetries = 0
+
+	calls := 0
+	err := client.retryWithBackoff(context.Background(), "set_temperature", func() error {
+		calls++
+		if calls == 1 {
+			return inet.ErrVehicleNotAwake
+		}
+		return nil
+	})
+	// The wake doesn't use up the only attempt
+	if err != nil || calls != 2 {
+		t.Errorf("Expected success on the attempt after waking, got %v after %d calls", err, calls)
+	}
+
+	// A vehicle that stays asleep after a wake is retried like any failure
+	calls = 0
+	err = client.retryWithBackoff(context.Background(), "set_temperature", func() error {
+		calls++
+		return inet.ErrVehicleNotAwake
+	})
+	if !errors.Is(err, ErrRetryExhausted) || calls != 2 {
+		t.Errorf("Expected to give up after one wake, got %v after %d calls", err, calls)
+	}
+}
@@ -3,6 +3,7 @@ package tesla
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
 	"os"
 	"testing"
@@ -100,15 +101,25 @@ func TestErrorHandlingInCircuitBreaker(t *testing.T) {
 	
 	cb := NewCircuitBreaker(config)
 	
-	// Test that circuit breaker handles different error types
+	// Not being connected never reaches the vehicle, so it doesn't count
+	for i := 0; i < 3; i++ {
+		if err := cb.Call(func() error { return ErrNotConnected }); err != ErrNotConnected {
+			t.Errorf("Expected ErrNotConnected, got %v", err)
+		}
+	}
+	if cb.GetState() != CircuitClosed {
+		t.Errorf("Expected not-connected errors to leave the circuit closed, got %v", cb.GetState())
+	}
+	
+	// Other errors are vehicle failures
 	errorTests := []error{
-		ErrNotConnected,
 		ErrConnectionLost,
 		ErrOperationTimeout,
 		errors.New("custom error"),
 	}
 	
 	for _, testErr := range errorTests {
+		cb := NewCircuitBreaker(config)
 		err := cb.Call(func() error {
 			return testErr
 		})
@@ -116,6 +127,9 @@ func TestErrorHandlingInCircuitBreaker(t *testing.T) {
 		if err != testErr {
 			t.Errorf("Expected error %v, got %v", testErr, err)
 		}
+		if cb.GetState() != CircuitOpen {
+			t.Errorf("Expected %v to open the circuit, got %v", testErr, cb.GetState())
+		}
 	}
 }
 
@@ -211,6 +225,13 @@ func TestErrorHandlingInHVACMethods(t *testing.T) {
 	}
 }
 
+func TestClientFromConfigWithoutLogger(t *testing.T) {
+	client := NewClientFromConfig(DefaultConfig(), nil)
+	if _, err := client.GetHVACState(context.Background()); err != ErrNotConnected {
+		t.Errorf("Expected ErrNotConnected without a logger, got %v", err)
+	}
+}
+
 func TestErrorHandlingInSeatMethods(t *testing.T) {
 	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
 	client := NewClient("TEST_VIN", logger)
@@ -377,7 +398,7 @@ func TestErrorHandlingInConfiguration(t *testing.T) {
 
 func TestErrorHandlingInConfigManager(t *testing.T) {
 	// Test config manager with invalid path
-	_, err := NewConfigManager("/nonexistent/path/config.json")
+	_, err := NewConfigManager("/nonexistent/path/config.json", log.New(io.Discard, "", 0))
 	if err == nil {
 		t.Error("Expected error for nonexistent config path")
 	}
@@ -0,0 +1,107 @@
+package tesla
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies the kind of event published on an EventBus
+type EventType string
+
+const (
+	// EventStateUpdated is published whenever a fresh HVAC state is read
+	EventStateUpdated EventType = "state_updated"
+	// EventStateChanged is published when a fresh HVAC state differs from the previous one
+	EventStateChanged EventType = "state_changed"
+	// EventConnected is published after a connection to the vehicle is established
+	EventConnected EventType = "connected"
+	// EventDisconnected is published when the client disconnects from the vehicle
+	EventDisconnected EventType = "disconnected"
+	// EventAwakeChanged is published when the vehicle is observed waking or falling asleep
+	EventAwakeChanged EventType = "awake_changed"
+	// EventClimateSkipped is published when a climate command is skipped because of its charge conditions
+	EventClimateSkipped EventType = "climate_skipped"
+	// EventCommandSent is published after a command reaches the vehicle
+	EventCommandSent EventType = "command_sent"
+	// EventConnectionState is published when the connection to the vehicle
+	// moves between scanning, connecting, connected and session_active
+	EventConnectionState EventType = "connection_state"
+	// EventCircuitOpened is published when repeated failures open the
+	// circuit breaker
+	EventCircuitOpened EventType = "circuit_opened"
+	// EventCircuitStateChanged is published each time the circuit breaker
+	// moves between closed, open and half_open
+	EventCircuitStateChanged EventType = "circuit_state_changed"
+)
+
+// Event is a notification published by the client
+type Event struct {
+	Type      EventType   `json:"type"`
+	VIN       string      `json:"vin"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// EventBus fans events out to subscribers. Publishing never blocks: events
+// are dropped for subscribers whose buffers are full.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]chan Event
+	nextID      int
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// Subscribe registers a subscriber with the given buffer size. The returned
+// function unsubscribes and closes the channel.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, buffer)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish sends an event to all subscribers
+func (b *EventBus) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is too slow; drop the event rather than block
+		}
+	}
+}
+
+// SubscriberCount returns the number of active subscribers
+func (b *EventBus) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscribers)
+}
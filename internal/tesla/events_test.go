@@ -0,0 +1,189 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventBusPublishSubscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	events, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	bus.Publish(Event{Type: EventStateChanged, VIN: "TEST_VIN"})
+
+	select {
+	case event := <-events:
+		if event.Type != EventStateChanged || event.VIN != "TEST_VIN" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if event.Timestamp.IsZero() {
+			t.Error("Expected event timestamp to be set")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+}
+
+func TestEventBusDropsForSlowSubscribers(t *testing.T) {
+	bus := NewEventBus()
+
+	_, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	// A full subscriber buffer must not block publishers
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			bus.Publish(Event{Type: EventStateUpdated})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	events, unsubscribe := bus.Subscribe(1)
+	if bus.SubscriberCount() != 1 {
+		t.Fatalf("Expected 1 subscriber, got %d", bus.SubscriberCount())
+	}
+
+	unsubscribe()
+	unsubscribe() // Must be safe to call twice
+
+	if bus.SubscriberCount() != 0 {
+		t.Errorf("Expected 0 subscribers, got %d", bus.SubscriberCount())
+	}
+	if _, ok := <-events; ok {
+		t.Error("Expected channel to be closed after unsubscribe")
+	}
+}
+
+func TestRecordStateSnapshot(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	if _, ok := client.LastState(); ok {
+		t.Fatal("Expected no state before first read")
+	}
+
+	state := &HVACState{IsOn: true, DriverTempCelsius: 21}
+	client.recordState(state)
+
+	// Mutating the caller's copy must not affect the recorded snapshot
+	state.DriverTempCelsius = 99
+
+	snapshot, ok := client.LastState()
+	if !ok {
+		t.Fatal("Expected recorded state")
+	}
+	if snapshot.State.DriverTempCelsius != 21 {
+		t.Errorf("Expected recorded temp 21, got %.1f", snapshot.State.DriverTempCelsius)
+	}
+	if snapshot.ETag != StateETag(&HVACState{IsOn: true, DriverTempCelsius: 21}) {
+		t.Error("Expected ETag to match the recorded state")
+	}
+}
+
+func TestWaitForStateChange(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.recordState(&HVACState{DriverTempCelsius: 20})
+	snapshot, _ := client.LastState()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		client.recordState(&HVACState{DriverTempCelsius: 20}) // Unchanged
+		client.recordState(&HVACState{DriverTempCelsius: 22})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	changed, err := client.WaitForStateChange(ctx, snapshot.ETag)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed.State.DriverTempCelsius != 22 {
+		t.Errorf("Expected changed temp 22, got %.1f", changed.State.DriverTempCelsius)
+	}
+}
+
+func TestWaitForStateChangeTimeout(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.recordState(&HVACState{DriverTempCelsius: 20})
+	snapshot, _ := client.LastState()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WaitForStateChange(ctx, snapshot.ETag)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestWaitForStateChangeStaleETag(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.recordState(&HVACState{DriverTempCelsius: 20})
+
+	// A stale ETag returns immediately
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	snapshot, err := client.WaitForStateChange(ctx, "stale")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if snapshot.State == nil {
+		t.Error("Expected current state to be returned")
+	}
+}
+
+func TestCachedHVACState(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.recordState(&HVACState{DriverTempCelsius: 20})
+
+	// A recent state is served without reaching the (disconnected) vehicle
+	snapshot, err := client.CachedHVACState(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the cached state, got %v", err)
+	}
+	if snapshot.State.DriverTempCelsius != 20 || snapshot.ReadAt.IsZero() {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+
+	// A successful command invalidates the cache
+	client.commandSent("set_temperature", nil)
+	if _, err := client.CachedHVACState(context.Background()); err == nil {
+		t.Error("Expected a read from the vehicle after a command")
+	}
+	if _, ok := client.LastState(); !ok {
+		t.Error("Expected the last state to survive invalidation")
+	}
+
+	// As does the state aging past the TTL
+	client.recordState(&HVACState{DriverTempCelsius: 20})
+	client.stateMutex.Lock()
+	client.lastStateAt = time.Now().Add(-client.stateCacheTTL)
+	client.stateMutex.Unlock()
+	if _, err := client.CachedHVACState(context.Background()); err == nil {
+		t.Error("Expected a read from the vehicle once the state expired")
+	}
+
+	// A TTL of 0 disables the cache
+	tuning := client.Tuning()
+	tuning.StateCacheTTL = 0
+	client.ApplyTuning(tuning)
+	client.recordState(&HVACState{DriverTempCelsius: 20})
+	if _, err := client.CachedHVACState(context.Background()); err == nil {
+		t.Error("Expected a read from the vehicle with the cache disabled")
+	}
+}
@@ -0,0 +1,344 @@
+package tesla
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// ErrInjectedFault is the error of a failure injected by FaultConfig
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultConfig injects failures and latency into the client's calls to the
+// vehicle, over any transport, to exercise retries, the circuit breaker and
+// error responses in integration tests and staging. Leave it off in
+// production. Changes take effect on the next connection.
+type FaultConfig struct {
+	ErrorRate      float64       `json:"error_rate,omitempty"`      // Fraction of calls that fail
+	DisconnectRate float64       `json:"disconnect_rate,omitempty"` // Fraction of commands that drop the connection once sent
+	Latency        time.Duration `json:"latency,omitempty"`         // Added to every call
+	LatencyJitter  time.Duration `json:"latency_jitter,omitempty"`  // Up to this much more, at random
+	Seed           int64         `json:"seed,omitempty"`            // Repeats the same faults for the same calls; 0 seeds from the time
+	Operations     []string      `json:"operations,omitempty"`      // Calls to affect, such as Dial or ClimateOn; empty affects all
+}
+
+// Enabled reports whether any faults are injected
+func (f FaultConfig) Enabled() bool {
+	return f.ErrorRate > 0 || f.DisconnectRate > 0 || f.Latency > 0 || f.LatencyJitter > 0
+}
+
+// Validate checks the config
+func (f FaultConfig) Validate() error {
+	if f.ErrorRate < 0 || f.ErrorRate > 1 || f.DisconnectRate < 0 || f.DisconnectRate > 1 {
+		return fmt.Errorf("error_rate and disconnect_rate must be between 0 and 1")
+	}
+	if f.ErrorRate+f.DisconnectRate > 1 {
+		return fmt.Errorf("error_rate and disconnect_rate must not add up to more than 1")
+	}
+	if f.Latency < 0 || f.LatencyJitter < 0 {
+		return fmt.Errorf("latency and latency_jitter must not be negative")
+	}
+	return nil
+}
+
+// fault is what happens to one call
+type fault int
+
+const (
+	faultNone fault = iota
+	faultError
+	faultDisconnect
+)
+
+// faultInjector decides the faults for each call
+type faultInjector struct {
+	config FaultConfig
+	mu     sync.Mutex
+	rng    *rand.Rand
+}
+
+// newFaultInjector returns an injector, or nil if config injects nothing
+func newFaultInjector(config FaultConfig) *faultInjector {
+	if !config.Enabled() {
+		return nil
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultInjector{config: config, rng: rand.New(rand.NewSource(seed))}
+}
+
+// affects reports whether the injector applies to an operation
+func (f *faultInjector) affects(operation string) bool {
+	if len(f.config.Operations) == 0 {
+		return true
+	}
+	for _, name := range f.config.Operations {
+		if name == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// decide picks the latency and fault for one call
+func (f *faultInjector) decide(operation string) (time.Duration, fault) {
+	if !f.affects(operation) {
+		return 0, faultNone
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delay := f.config.Latency
+	if f.config.LatencyJitter > 0 {
+		delay += time.Duration(f.rng.Int63n(int64(f.config.LatencyJitter) + 1))
+	}
+	roll := f.rng.Float64()
+	switch {
+	case roll < f.config.ErrorRate:
+		return delay, faultError
+	case roll < f.config.ErrorRate+f.config.DisconnectRate:
+		return delay, faultDisconnect
+	}
+	return delay, faultNone
+}
+
+// inject waits out the latency for a call and returns its fault. A call that
+// can't drop the connection fails instead.
+func (f *faultInjector) inject(ctx context.Context, operation string, canDisconnect bool) (fault, error) {
+	delay, kind := f.decide(operation)
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return faultNone, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if kind == faultDisconnect && !canDisconnect {
+		kind = faultError
+	}
+	if kind == faultError {
+		return kind, fmt.Errorf("%w: %s failed", ErrInjectedFault, operation)
+	}
+	return kind, nil
+}
+
+// SetFaults replaces the faults injected into later connections
+func (c *Client) SetFaults(config FaultConfig) {
+	c.transportMutex.Lock()
+	defer c.transportMutex.Unlock()
+	c.faults = newFaultInjector(config)
+}
+
+// faultSettings returns the fault injector, if any
+func (c *Client) faultSettings() *faultInjector {
+	c.transportMutex.RLock()
+	defer c.transportMutex.RUnlock()
+	return c.faults
+}
+
+// injectDialFault injects a fault into dialing the vehicle
+func (c *Client) injectDialFault(ctx context.Context) error {
+	faults := c.faultSettings()
+	if faults == nil {
+		return nil
+	}
+	_, err := faults.inject(ctx, "Dial", false)
+	return err
+}
+
+// withFaults wraps car in the client's fault injector, if any
+func (c *Client) withFaults(car VehicleCommander) VehicleCommander {
+	faults := c.faultSettings()
+	if faults == nil {
+		return car
+	}
+	return &faultCommander{VehicleCommander: car, faults: faults, drop: c.dropConnection}
+}
+
+// faultCommander injects faults into calls to a vehicle. A dropped
+// connection is dropped after the command reaches the vehicle, so callers
+// can't tell whether it was applied.
+type faultCommander struct {
+	VehicleCommander
+	faults *faultInjector
+	drop   func(err error)
+}
+
+// call makes one call to the vehicle with faults injected
+func (f *faultCommander) call(ctx context.Context, operation string, fn func() error) error {
+	kind, err := f.faults.inject(ctx, operation, true)
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if kind == faultDisconnect {
+		err = fmt.Errorf("%w: %w during %s", ErrConnectionLost, ErrInjectedFault, operation)
+		f.drop(err)
+	}
+	return err
+}
+
+// connect makes a call while connecting, which fails rather than dropping
+// the connection
+func (f *faultCommander) connect(ctx context.Context, operation string, fn func() error) error {
+	if _, err := f.faults.inject(ctx, operation, false); err != nil {
+		return err
+	}
+	return fn()
+}
+
+func (f *faultCommander) Connect(ctx context.Context) error {
+	return f.connect(ctx, "Connect", func() error { return f.VehicleCommander.Connect(ctx) })
+}
+
+func (f *faultCommander) StartSession(ctx context.Context, domains []universal.Domain) error {
+	return f.connect(ctx, "StartSession", func() error { return f.VehicleCommander.StartSession(ctx, domains) })
+}
+
+func (f *faultCommander) Ping(ctx context.Context) error {
+	return f.call(ctx, "Ping", func() error { return f.VehicleCommander.Ping(ctx) })
+}
+
+func (f *faultCommander) Wakeup(ctx context.Context) error {
+	return f.call(ctx, "Wakeup", func() error { return f.VehicleCommander.Wakeup(ctx) })
+}
+
+func (f *faultCommander) BodyControllerState(ctx context.Context) (status *vcsec.VehicleStatus, err error) {
+	err = f.call(ctx, "BodyControllerState", func() error {
+		status, err = f.VehicleCommander.BodyControllerState(ctx)
+		return err
+	})
+	return status, err
+}
+
+func (f *faultCommander) GetState(ctx context.Context, category vehicle.StateCategory) (data *carserver.VehicleData, err error) {
+	err = f.call(ctx, "GetState", func() error {
+		data, err = f.VehicleCommander.GetState(ctx, category)
+		return err
+	})
+	return data, err
+}
+
+func (f *faultCommander) GetStates(ctx context.Context, categories ...vehicle.StateCategory) (data *carserver.VehicleData, err error) {
+	err = f.call(ctx, "GetStates", func() error {
+		data, err = f.VehicleCommander.GetStates(ctx, categories...)
+		return err
+	})
+	return data, err
+}
+
+func (f *faultCommander) ClimateOn(ctx context.Context) error {
+	return f.call(ctx, "ClimateOn", func() error { return f.VehicleCommander.ClimateOn(ctx) })
+}
+
+func (f *faultCommander) ClimateOff(ctx context.Context) error {
+	return f.call(ctx, "ClimateOff", func() error { return f.VehicleCommander.ClimateOff(ctx) })
+}
+
+func (f *faultCommander) ChangeClimateTemp(ctx context.Context, driverCelsius float32, passengerCelsius float32) error {
+	return f.call(ctx, "ChangeClimateTemp", func() error {
+		return f.VehicleCommander.ChangeClimateTemp(ctx, driverCelsius, passengerCelsius)
+	})
+}
+
+func (f *faultCommander) SetClimateAutoMode(ctx context.Context, powerOn, auto bool) error {
+	return f.call(ctx, "SetClimateAutoMode", func() error { return f.VehicleCommander.SetClimateAutoMode(ctx, powerOn, auto) })
+}
+
+func (f *faultCommander) SetClimateKeeperMode(ctx context.Context, mode vehicle.ClimateKeeperMode, override bool) error {
+	return f.call(ctx, "SetClimateKeeperMode", func() error { return f.VehicleCommander.SetClimateKeeperMode(ctx, mode, override) })
+}
+
+func (f *faultCommander) SetPreconditioningMax(ctx context.Context, enabled bool, manualOverride bool) error {
+	return f.call(ctx, "SetPreconditioningMax", func() error {
+		return f.VehicleCommander.SetPreconditioningMax(ctx, enabled, manualOverride)
+	})
+}
+
+func (f *faultCommander) SetBioweaponDefenseMode(ctx context.Context, enabled bool, manualOverride bool) error {
+	return f.call(ctx, "SetBioweaponDefenseMode", func() error {
+		return f.VehicleCommander.SetBioweaponDefenseMode(ctx, enabled, manualOverride)
+	})
+}
+
+func (f *faultCommander) SetCabinOverheatProtection(ctx context.Context, enabled bool, fanOnly bool) error {
+	return f.call(ctx, "SetCabinOverheatProtection", func() error {
+		return f.VehicleCommander.SetCabinOverheatProtection(ctx, enabled, fanOnly)
+	})
+}
+
+func (f *faultCommander) SetCabinOverheatProtectionTemperature(ctx context.Context, level vehicle.Level) error {
+	return f.call(ctx, "SetCabinOverheatProtectionTemperature", func() error {
+		return f.VehicleCommander.SetCabinOverheatProtectionTemperature(ctx, level)
+	})
+}
+
+func (f *faultCommander) SetSeatHeater(ctx context.Context, levels map[vehicle.SeatPosition]vehicle.Level) error {
+	return f.call(ctx, "SetSeatHeater", func() error { return f.VehicleCommander.SetSeatHeater(ctx, levels) })
+}
+
+func (f *faultCommander) SetSeatCooler(ctx context.Context, level vehicle.Level, seat vehicle.SeatPosition) error {
+	return f.call(ctx, "SetSeatCooler", func() error { return f.VehicleCommander.SetSeatCooler(ctx, level, seat) })
+}
+
+func (f *faultCommander) SetSteeringWheelHeater(ctx context.Context, enabled bool) error {
+	return f.call(ctx, "SetSteeringWheelHeater", func() error { return f.VehicleCommander.SetSteeringWheelHeater(ctx, enabled) })
+}
+
+func (f *faultCommander) ScheduleDeparture(ctx context.Context, departAt, offPeakEndTime time.Duration, preconditioning, offpeak vehicle.ChargingPolicy) error {
+	return f.call(ctx, "ScheduleDeparture", func() error {
+		return f.VehicleCommander.ScheduleDeparture(ctx, departAt, offPeakEndTime, preconditioning, offpeak)
+	})
+}
+
+func (f *faultCommander) ClearScheduledDeparture(ctx context.Context) error {
+	return f.call(ctx, "ClearScheduledDeparture", func() error { return f.VehicleCommander.ClearScheduledDeparture(ctx) })
+}
+
+func (f *faultCommander) SendAddKeyRequestWithRole(ctx context.Context, publicKey *ecdh.PublicKey, role keys.Role, formFactor vcsec.KeyFormFactor) error {
+	return f.call(ctx, "SendAddKeyRequestWithRole", func() error {
+		return f.VehicleCommander.SendAddKeyRequestWithRole(ctx, publicKey, role, formFactor)
+	})
+}
+
+func (f *faultCommander) SessionInfo(ctx context.Context, publicKey *ecdh.PublicKey, domain universal.Domain) (info *signatures.SessionInfo, err error) {
+	err = f.call(ctx, "SessionInfo", func() error {
+		info, err = f.VehicleCommander.SessionInfo(ctx, publicKey, domain)
+		return err
+	})
+	return info, err
+}
+
+func (f *faultCommander) KeySummary(ctx context.Context) (info *vcsec.WhitelistInfo, err error) {
+	err = f.call(ctx, "KeySummary", func() error {
+		info, err = f.VehicleCommander.KeySummary(ctx)
+		return err
+	})
+	return info, err
+}
+
+func (f *faultCommander) KeyInfoBySlot(ctx context.Context, slot uint32) (info *vcsec.WhitelistEntryInfo, err error) {
+	err = f.call(ctx, "KeyInfoBySlot", func() error {
+		info, err = f.VehicleCommander.KeyInfoBySlot(ctx, slot)
+		return err
+	})
+	return info, err
+}
+
+func (f *faultCommander) RemoveKey(ctx context.Context, publicKey *ecdh.PublicKey) error {
+	return f.call(ctx, "RemoveKey", func() error { return f.VehicleCommander.RemoveKey(ctx, publicKey) })
+}
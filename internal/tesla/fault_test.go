@@ -0,0 +1,146 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+)
+
+// newFaultyClient returns a client that injects faults into its connection
+// to car
+func newFaultyClient(t *testing.T, car *fakeVehicle, faults FaultConfig, breaker CircuitBreakerConfig) (*Client, *fakeTransport) {
+	t.Helper()
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0),
+		RetryConfig{MaxRetries: 2, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}, breaker)
+	transport := &fakeTransport{kind: TransportBLE, conn: &fakeConnector{}}
+	client.SetTransports(transport)
+	client.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return car, nil
+	})
+	client.SetFaults(faults)
+	return client, transport
+}
+
+var testBreaker = CircuitBreakerConfig{MaxFailures: 1000, ResetTimeout: time.Second, HalfOpenMaxCalls: 1}
+
+func TestFaultConfigValidate(t *testing.T) {
+	tests := []struct {
+		config FaultConfig
+		ok     bool
+	}{
+		{FaultConfig{}, true},
+		{FaultConfig{ErrorRate: 0.2, DisconnectRate: 0.1, Latency: time.Second}, true},
+		{FaultConfig{ErrorRate: 1.5}, false},
+		{FaultConfig{ErrorRate: 0.6, DisconnectRate: 0.6}, false},
+		{FaultConfig{LatencyJitter: -time.Second}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.ok {
+			t.Errorf("Validate(%+v) = %v", tt.config, err)
+		}
+	}
+	if (FaultConfig{Seed: 7}).Enabled() {
+		t.Error("A seed alone shouldn't enable fault injection")
+	}
+}
+
+func TestFaultsFailSelectedOperations(t *testing.T) {
+	car := newFakeVehicle()
+	client, _ := newFaultyClient(t, car, FaultConfig{ErrorRate: 1, Operations: []string{"ClimateOn"}}, testBreaker)
+	ctx := context.Background()
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Expected connecting to be unaffected, got %v", err)
+	}
+
+	err := client.SetClimateOn(ctx)
+	if !errors.Is(err, ErrRetryExhausted) || !strings.Contains(err.Error(), "injected fault") {
+		t.Errorf("Expected the injected fault after retries, got %v", err)
+	}
+	if car.called("ClimateOn") != 0 {
+		t.Error("A failed call shouldn't reach the vehicle")
+	}
+	if err := client.SetTemperature(ctx, 21, 21); err != nil {
+		t.Errorf("Expected other commands to be unaffected, got %v", err)
+	}
+}
+
+func TestFaultsOpenCircuitBreaker(t *testing.T) {
+	car := newFakeVehicle()
+	breaker := CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute, HalfOpenMaxCalls: 1}
+	client, _ := newFaultyClient(t, car, FaultConfig{ErrorRate: 1, Operations: []string{"ClimateOn"}}, breaker)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetClimateOn(context.Background())
+	if client.CircuitState() != CircuitOpen {
+		t.Errorf("Expected injected failures to open the circuit breaker, got %v", client.CircuitState())
+	}
+}
+
+func TestFaultsDisconnectMidCommand(t *testing.T) {
+	car := newFakeVehicle()
+	client, _ := newFaultyClient(t, car, FaultConfig{DisconnectRate: 1, Operations: []string{"ClimateOn"}}, testBreaker)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	err := client.SetClimateOn(context.Background())
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected the dropped connection to stop retries, got %v", err)
+	}
+	if car.called("ClimateOn") != 1 {
+		t.Errorf("Expected the command to reach the vehicle before the drop, got %d calls", car.called("ClimateOn"))
+	}
+	if client.IsConnected() || client.ConnectionState() != StateError || !client.KeepConnected() {
+		t.Error("Expected the client to be left to reconnect")
+	}
+}
+
+func TestFaultsFailDial(t *testing.T) {
+	car := newFakeVehicle()
+	client, transport := newFaultyClient(t, car, FaultConfig{ErrorRate: 1, Operations: []string{"Dial"}}, testBreaker)
+
+	err := client.Connect(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), "Dial failed") {
+		t.Errorf("Expected the injected dial failure, got %v", err)
+	}
+	if transport.dialed.Load() != 0 {
+		t.Error("Expected the transport not to be dialed")
+	}
+}
+
+func TestFaultsAreRepeatable(t *testing.T) {
+	config := FaultConfig{ErrorRate: 0.3, DisconnectRate: 0.2, LatencyJitter: time.Second, Seed: 42}
+	a, b := newFaultInjector(config), newFaultInjector(config)
+	for i := 0; i < 50; i++ {
+		delayA, faultA := a.decide("GetState")
+		delayB, faultB := b.decide("GetState")
+		if delayA != delayB || faultA != faultB {
+			t.Fatalf("Call %d differs with the same seed: %v/%v and %v/%v", i, delayA, faultA, delayB, faultB)
+		}
+	}
+}
+
+func TestFaultLatency(t *testing.T) {
+	faults := newFaultInjector(FaultConfig{Latency: 20 * time.Millisecond})
+	start := time.Now()
+	if _, err := faults.inject(context.Background(), "Ping", true); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected at least 20ms of latency, got %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newFaultInjector(FaultConfig{Latency: time.Minute}).inject(ctx, "Ping", true); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the latency to end with the context, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HealthStatus is the result of the client's recent health checks
+type HealthStatus struct {
+	Healthy             bool      `json:"healthy"`
+	LastCheckAt         time.Time `json:"last_check_at,omitempty"`
+	LastHealthyAt       time.Time `json:"last_healthy_at,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	LatencyMillis       int64     `json:"latency_ms"` // Round trip of the last check
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+}
+
+// Ping checks that the session answers. While the vehicle is known to be
+// awake it sends an infotainment ping; otherwise it asks the security
+// controller for the sleep status, so a health check never wakes the car.
+func (c *Client) Ping(ctx context.Context) error {
+	if c.vehicle == nil {
+		return ErrNotConnected
+	}
+	if !c.IsAwake(c.wakeSettings().AwakeWindow) {
+		if _, err := c.SleepStatus(ctx); err != nil {
+			return err
+		}
+		c.touch()
+		return nil
+	}
+
+	pingCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+	defer cancel()
+	if err := c.vehicle.Ping(pingCtx); err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	c.markAwake()
+	c.touch()
+	return nil
+}
+
+// Health returns the result of the latest health checks. A disconnected
+// client is never healthy.
+func (c *Client) Health() HealthStatus {
+	c.healthStatusMutex.RLock()
+	health := c.health
+	c.healthStatusMutex.RUnlock()
+
+	if !c.IsConnected() {
+		health.Healthy = false
+	}
+	return health
+}
+
+// recordHealth records the outcome of a health check that started at start
+func (c *Client) recordHealth(start time.Time, err error) {
+	c.healthStatusMutex.Lock()
+	defer c.healthStatusMutex.Unlock()
+
+	now := time.Now()
+	c.health.LastCheckAt = now
+	c.health.LatencyMillis = now.Sub(start).Milliseconds()
+	if err != nil {
+		c.health.Healthy = false
+		c.health.LastError = err.Error()
+		c.health.ConsecutiveFailures++
+		return
+	}
+	c.health.Healthy = true
+	c.health.LastHealthyAt = now
+	c.health.LastError = ""
+	c.health.ConsecutiveFailures = 0
+}
+
+// RunHealthChecks pings the vehicle every client.health_check_interval while
+// connected, until ctx is cancelled. Results are reported by Health.
+func (c *Client) RunHealthChecks(ctx context.Context) error {
+	interval := c.healthCheckInterval
+	if interval <= 0 {
+		interval = DefaultConfig().Client.HealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if c.IsConnected() {
+			c.checkConnectionHealth(ctx)
+		}
+	}
+}
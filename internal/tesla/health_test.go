@@ -0,0 +1,54 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecordHealth(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	client.recordHealth(time.Now(), errors.New("timeout"))
+	client.recordHealth(time.Now(), errors.New("timeout"))
+	health := client.health
+	if health.Healthy || health.ConsecutiveFailures != 2 || health.LastError != "timeout" || !health.LastHealthyAt.IsZero() {
+		t.Errorf("Unexpected status after failures: %+v", health)
+	}
+
+	client.recordHealth(time.Now().Add(-20*time.Millisecond), nil)
+	health = client.health
+	if !health.Healthy || health.ConsecutiveFailures != 0 || health.LastError != "" || health.LastHealthyAt.IsZero() {
+		t.Errorf("Unexpected status after success: %+v", health)
+	}
+	if health.LatencyMillis < 20 {
+		t.Errorf("Expected the check latency to be recorded, got %dms", health.LatencyMillis)
+	}
+
+	// A disconnected client is never reported healthy
+	if client.Health().Healthy {
+		t.Error("Expected a disconnected client to be unhealthy")
+	}
+}
+
+func TestPingNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if err := client.Ping(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestRunHealthChecksStops(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.healthCheckInterval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.RunHealthChecks(ctx); err != nil {
+		t.Errorf("Expected a clean stop, got %v", err)
+	}
+	if !client.Health().LastCheckAt.IsZero() {
+		t.Error("Expected no checks while disconnected")
+	}
+}
@@ -0,0 +1,81 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrCommandVetoed is returned when a command hook rejects a command
+var ErrCommandVetoed = errors.New("command vetoed")
+
+// Command describes a vehicle command about to be sent
+type Command struct {
+	Name string                 `json:"name"`
+	VIN  string                 `json:"vin"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// CommandHook is called before a command is sent. Returning an error stops
+// the command; hooks should wrap ErrCommandVetoed for deliberate rejections.
+type CommandHook func(ctx context.Context, cmd Command) error
+
+// AddCommandHook registers a hook that runs before every command. Hooks run
+// in registration order. The returned function removes the hook.
+func (c *Client) AddCommandHook(hook CommandHook) func() {
+	c.hookMutex.Lock()
+	defer c.hookMutex.Unlock()
+
+	if c.hooks == nil {
+		c.hooks = make(map[int]CommandHook)
+	}
+	id := c.nextHookID
+	c.nextHookID++
+	c.hooks[id] = hook
+
+	return func() {
+		c.hookMutex.Lock()
+		defer c.hookMutex.Unlock()
+		delete(c.hooks, id)
+	}
+}
+
+// runCommandHooks runs the registered hooks for a command, stopping at the
+// first error
+func (c *Client) runCommandHooks(ctx context.Context, name string, args map[string]interface{}) error {
+	c.hookMutex.RLock()
+	ids := make([]int, 0, len(c.hooks))
+	for id := range c.hooks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	hooks := make([]CommandHook, len(ids))
+	for i, id := range ids {
+		hooks[i] = c.hooks[id]
+	}
+	c.hookMutex.RUnlock()
+
+	cmd := Command{Name: name, VIN: c.vin, Args: args}
+	for _, hook := range hooks {
+		if err := hook(ctx, cmd); err != nil {
+			c.logFor(ctx).Printf("Command %s rejected by hook: %v", name, err)
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// commandSent publishes EventCommandSent once a command has succeeded. The
+// command may have changed the state, so the cached state is invalidated.
+func (c *Client) commandSent(name string, err error) {
+	if err != nil {
+		return
+	}
+	c.invalidateState()
+	c.activityMutex.Lock()
+	c.lastCommandAt = time.Now()
+	c.activityMutex.Unlock()
+	c.events.Publish(Event{Type: EventCommandSent, VIN: c.vin, Data: Command{Name: name, VIN: c.vin}})
+}
@@ -0,0 +1,117 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandHooksRunInOrder(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	var calls []string
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		calls = append(calls, "first:"+cmd.Name)
+		return nil
+	})
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		calls = append(calls, "second:"+cmd.Name)
+		if cmd.VIN != "TEST_VIN" {
+			t.Errorf("Expected VIN TEST_VIN, got %s", cmd.VIN)
+		}
+		if cmd.Args["driver_temp"] != float32(21) {
+			t.Errorf("Expected driver_temp arg 21, got %v", cmd.Args["driver_temp"])
+		}
+		return nil
+	})
+
+	// Not connected, so the command itself fails after the hooks run
+	err := client.SetTemperature(context.Background(), 21, 22)
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "first:set_temperature" || calls[1] != "second:set_temperature" {
+		t.Errorf("Unexpected hook calls: %v", calls)
+	}
+}
+
+func TestCommandHookVeto(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	var secondCalled bool
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		return ErrCommandVetoed
+	})
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		secondCalled = true
+		return nil
+	})
+
+	err := client.SetClimateOn(context.Background())
+	if !errors.Is(err, ErrCommandVetoed) {
+		t.Errorf("Expected ErrCommandVetoed, got %v", err)
+	}
+	if secondCalled {
+		t.Error("Expected later hooks to be skipped after a veto")
+	}
+}
+
+func TestRemoveCommandHook(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	remove := client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		return ErrCommandVetoed
+	})
+	remove()
+
+	if err := client.SetAutoMode(context.Background(), true); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected after removing hook, got %v", err)
+	}
+}
+
+func TestDisconnectPublishesEvent(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	events, unsubscribe := client.Events().Subscribe(1)
+	defer unsubscribe()
+
+	client.Disconnect()
+
+	select {
+	case event := <-events:
+		if event.Type != EventDisconnected {
+			t.Errorf("Expected disconnected event, got %s", event.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+}
+
+func TestCommandSentPublishedOnSuccess(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	events, unsubscribe := client.Events().Subscribe(4)
+	defer unsubscribe()
+
+	// A failed command publishes nothing
+	client.SetAutoMode(context.Background(), true)
+	client.commandSent("set_auto_mode", nil)
+
+	select {
+	case event := <-events:
+		if event.Type != EventCommandSent {
+			t.Fatalf("Expected command_sent event, got %s", event.Type)
+		}
+		if cmd := event.Data.(Command); cmd.Name != "set_auto_mode" {
+			t.Errorf("Expected set_auto_mode, got %s", cmd.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Unexpected event %s", event.Type)
+	default:
+	}
+}
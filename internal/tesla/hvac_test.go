@@ -2,6 +2,7 @@ package tesla
 
 import (
 	"context"
+	"io"
 	"log"
 	"os"
 	"testing"
@@ -322,7 +323,7 @@ func TestClientWithConfigManager(t *testing.T) {
 	configPath := tempDir + "/test-config.json"
 	
 	// Create config manager
-	configManager, err := NewConfigManager(configPath)
+	configManager, err := NewConfigManager(configPath, log.New(io.Discard, "", 0))
 	if err != nil {
 		t.Fatalf("Failed to create config manager: %v", err)
 	}
@@ -0,0 +1,66 @@
+package tesla
+
+import (
+	"context"
+	"time"
+)
+
+// touch records that the vehicle just answered
+func (c *Client) touch() {
+	c.activityMutex.Lock()
+	defer c.activityMutex.Unlock()
+	c.lastActivity = time.Now()
+}
+
+// IdleFor returns how long it has been since the vehicle last answered a
+// command, state read or ping
+func (c *Client) IdleFor() time.Duration {
+	c.activityMutex.RLock()
+	defer c.activityMutex.RUnlock()
+	if c.lastActivity.IsZero() {
+		return 0
+	}
+	return time.Since(c.lastActivity)
+}
+
+// LastCommandAt returns when a command last succeeded, or the zero time
+func (c *Client) LastCommandAt() time.Time {
+	c.activityMutex.RLock()
+	defer c.activityMutex.RUnlock()
+	return c.lastCommandAt
+}
+
+// RunKeepAlive pings an idle BLE session every client.keep_alive_interval
+// until ctx is cancelled, so the link doesn't time out between user actions
+// and the next command doesn't have to scan and handshake again. Sessions
+// that were active within the interval aren't pinged.
+func (c *Client) RunKeepAlive(ctx context.Context) error {
+	interval := c.keepAliveInterval
+	if interval <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		c.keepAlive(ctx, interval)
+	}
+}
+
+// keepAlive pings the session if it has been idle for interval. It reports
+// whether a ping was sent.
+func (c *Client) keepAlive(ctx context.Context, interval time.Duration) bool {
+	// Fleet API requests are stateless, so there's no link to keep up
+	if c.ActiveTransport() != TransportBLE || c.IdleFor() < interval {
+		return false
+	}
+	if err := c.Ping(ctx); err != nil && ctx.Err() == nil {
+		c.logger.Printf("Keep-alive ping to vehicle %s failed: %v", c.vin, err)
+	}
+	return true
+}
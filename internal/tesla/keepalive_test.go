@@ -0,0 +1,61 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+func TestIdleFor(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if client.IdleFor() != 0 {
+		t.Errorf("Expected no idle time before any activity, got %v", client.IdleFor())
+	}
+	client.touch()
+	if idle := client.IdleFor(); idle < 0 || idle > time.Second {
+		t.Errorf("Expected to have just been active, idle for %v", idle)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if client.keepAlive(context.Background(), time.Millisecond) {
+		t.Error("Expected no ping while disconnected")
+	}
+
+	conn := inet.NewConnection("TEST_VIN", "Bearer token", "localhost:1", "")
+	car, err := vehicle.NewVehicle(conn, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	client.conn = conn
+	client.vehicle = car
+	client.activeTransport = TransportBLE
+
+	client.touch()
+	if client.keepAlive(context.Background(), time.Minute) {
+		t.Error("Expected no ping for a recently active session")
+	}
+
+	client.lastActivity = time.Now().Add(-time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if !client.keepAlive(ctx, time.Second) {
+		t.Error("Expected an idle session to be pinged")
+	}
+
+	client.activeTransport = TransportFleet
+	if client.keepAlive(ctx, time.Second) {
+		t.Error("Expected no ping over the Fleet API")
+	}
+}
+
+func TestRunKeepAliveDisabled(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if err := client.RunKeepAlive(context.Background()); err != nil {
+		t.Errorf("Expected keep-alive to finish when disabled, got %v", err)
+	}
+}
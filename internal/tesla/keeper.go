@@ -0,0 +1,81 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// ClimateKeeperMode keeps the climate system running while the vehicle is
+// parked
+type ClimateKeeperMode string
+
+const (
+	ClimateKeeperOff  ClimateKeeperMode = "off"
+	ClimateKeeperKeep ClimateKeeperMode = "keep"
+	ClimateKeeperDog  ClimateKeeperMode = "dog"
+	ClimateKeeperCamp ClimateKeeperMode = "camp"
+)
+
+// climateKeeperActions maps modes to the vehicle library's modes
+var climateKeeperActions = map[ClimateKeeperMode]vehicle.ClimateKeeperMode{
+	ClimateKeeperOff:  vehicle.ClimateKeeperModeOff,
+	ClimateKeeperKeep: vehicle.ClimateKeeperModeOn,
+	ClimateKeeperDog:  vehicle.ClimateKeeperModeDog,
+	ClimateKeeperCamp: vehicle.ClimateKeeperModeCamp,
+}
+
+// ParseClimateKeeperMode parses off, keep, dog or camp
+func ParseClimateKeeperMode(name string) (ClimateKeeperMode, error) {
+	mode := ClimateKeeperMode(strings.ToLower(name))
+	if _, ok := climateKeeperActions[mode]; !ok {
+		return "", fmt.Errorf("unknown climate keeper mode %q", name)
+	}
+	return mode, nil
+}
+
+// climateKeeperMode reads the keeper mode from the vehicle's climate state.
+// The vehicle reports Camp Mode as "party".
+func climateKeeperMode(climate *carserver.ClimateState) ClimateKeeperMode {
+	mode := climate.GetClimateKeeperMode()
+	switch {
+	case mode.GetOn() != nil:
+		return ClimateKeeperKeep
+	case mode.GetDog() != nil:
+		return ClimateKeeperDog
+	case mode.GetParty() != nil:
+		return ClimateKeeperCamp
+	}
+	return ClimateKeeperOff
+}
+
+// SetClimateKeeperMode sets the climate keeper mode with retry logic
+func (c *Client) SetClimateKeeperMode(ctx context.Context, mode ClimateKeeperMode, manualOverride bool) (err error) {
+	if err := c.runCommandHooks(ctx, "set_climate_keeper_mode", map[string]interface{}{"mode": string(mode), "manual_override": manualOverride}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_climate_keeper_mode", err) }()
+
+	action, ok := climateKeeperActions[mode]
+	if !ok {
+		return fmt.Errorf("unknown climate keeper mode %q", mode)
+	}
+
+	// Add timeout to climate keeper control
+	keeperCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+	defer cancel()
+
+	return c.retryWithBackoff(keeperCtx, "set_climate_keeper_mode", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		logging.Debugf(c.logFor(ctx), "Setting climate keeper mode - Mode: %s, Manual Override: %v", mode, manualOverride)
+		return c.vehicle.SetClimateKeeperMode(keeperCtx, action, manualOverride)
+	})
+}
@@ -0,0 +1,48 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestParseClimateKeeperMode(t *testing.T) {
+	if mode, err := ParseClimateKeeperMode("Dog"); err != nil || mode != ClimateKeeperDog {
+		t.Errorf("Expected dog, got %q, %v", mode, err)
+	}
+	if _, err := ParseClimateKeeperMode("party"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestClimateKeeperModeFromState(t *testing.T) {
+	tests := []struct {
+		mode *carserver.ClimateState_ClimateKeeperMode
+		want ClimateKeeperMode
+	}{
+		{nil, ClimateKeeperOff},
+		{&carserver.ClimateState_ClimateKeeperMode{Type: &carserver.ClimateState_ClimateKeeperMode_Off{Off: &carserver.Void{}}}, ClimateKeeperOff},
+		{&carserver.ClimateState_ClimateKeeperMode{Type: &carserver.ClimateState_ClimateKeeperMode_On{On: &carserver.Void{}}}, ClimateKeeperKeep},
+		{&carserver.ClimateState_ClimateKeeperMode{Type: &carserver.ClimateState_ClimateKeeperMode_Dog{Dog: &carserver.Void{}}}, ClimateKeeperDog},
+		{&carserver.ClimateState_ClimateKeeperMode{Type: &carserver.ClimateState_ClimateKeeperMode_Party{Party: &carserver.Void{}}}, ClimateKeeperCamp},
+	}
+	for _, tt := range tests {
+		if got := climateKeeperMode(&carserver.ClimateState{ClimateKeeperMode: tt.mode}); got != tt.want {
+			t.Errorf("Expected %s for %v, got %s", tt.want, tt.mode, got)
+		}
+	}
+}
+
+func TestSetClimateKeeperModeNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx := context.Background()
+
+	if err := client.SetClimateKeeperMode(ctx, ClimateKeeperDog, false); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+	if err := client.SetClimateKeeperMode(ctx, "party", false); err == nil || errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected an invalid mode error, got %v", err)
+	}
+}
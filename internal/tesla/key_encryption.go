@@ -0,0 +1,348 @@
+package tesla
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/99designs/keyring"
+	"golang.org/x/term"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/kdf"
+)
+
+// KeyPassphraseEnv supplies the private key passphrase for unattended use
+const KeyPassphraseEnv = "TESLA_KEY_PASSPHRASE"
+
+// keyPassphraseItem is the keyring item holding the private key passphrase
+const keyPassphraseItem = "key_passphrase"
+
+const (
+	// keyIterations is the PBKDF2 iteration count for newly encrypted keys
+	keyIterations = 600000
+	// minKeyIterations is the fewest PBKDF2 iterations a key is encrypted
+	// with. Keys encrypted elsewhere load whatever their count, since
+	// OpenSSL defaults to 2048.
+	minKeyIterations = 100000
+)
+
+var (
+	// ErrPassphraseRequired is returned when an encrypted private key is
+	// loaded without a passphrase
+	ErrPassphraseRequired = errors.New("private key is encrypted; a passphrase is required")
+	// ErrIncorrectPassphrase is returned when a passphrase doesn't decrypt
+	// a private key
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+)
+
+// PEM block types of private keys
+const (
+	pemECPrivateKey        = "EC PRIVATE KEY"
+	pemPrivateKey          = "PRIVATE KEY"
+	pemEncryptedPrivateKey = "ENCRYPTED PRIVATE KEY"
+)
+
+// PassphraseFunc returns the passphrase protecting a private key. It returns
+// ErrPassphraseRequired if it has none.
+type PassphraseFunc func() ([]byte, error)
+
+// StaticPassphrase returns a fixed passphrase
+func StaticPassphrase(passphrase string) PassphraseFunc {
+	return func() ([]byte, error) {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+		return []byte(passphrase), nil
+	}
+}
+
+// PassphraseFromEnv reads the passphrase from an environment variable
+func PassphraseFromEnv(name string) PassphraseFunc {
+	return func() ([]byte, error) {
+		passphrase := os.Getenv(name)
+		if passphrase == "" {
+			return nil, fmt.Errorf("%w: %s is not set", ErrPassphraseRequired, name)
+		}
+		return []byte(passphrase), nil
+	}
+}
+
+// PassphraseFromPrompt asks for the passphrase on the terminal
+func PassphraseFromPrompt(prompt string) PassphraseFunc {
+	return func() ([]byte, error) {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("%w: no terminal to read it from", ErrPassphraseRequired)
+		}
+		fmt.Fprint(os.Stderr, prompt)
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		return passphrase, nil
+	}
+}
+
+// PassphraseFromKeyring reads the passphrase from the keyring item key
+func PassphraseFromKeyring(kr keyring.Keyring, key string) PassphraseFunc {
+	return func() ([]byte, error) {
+		item, err := kr.Get(key)
+		if errors.Is(err, keyring.ErrKeyNotFound) || os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: no %s in the keyring", ErrPassphraseRequired, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get passphrase from keyring: %w", err)
+		}
+		if len(item.Data) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		return item.Data, nil
+	}
+}
+
+// FirstPassphrase tries each source in turn, returning the first passphrase
+// found
+func FirstPassphrase(sources ...PassphraseFunc) PassphraseFunc {
+	return func() ([]byte, error) {
+		for _, source := range sources {
+			passphrase, err := source()
+			if err == nil {
+				return passphrase, nil
+			}
+			if !errors.Is(err, ErrPassphraseRequired) {
+				return nil, err
+			}
+		}
+		return nil, ErrPassphraseRequired
+	}
+}
+
+// DefaultKeyPassphrase reads the passphrase from KeyPassphraseEnv, then the
+// keyring if kr is set, then the terminal
+func DefaultKeyPassphrase(kr keyring.Keyring) PassphraseFunc {
+	sources := []PassphraseFunc{PassphraseFromEnv(KeyPassphraseEnv)}
+	if kr != nil {
+		sources = append(sources, PassphraseFromKeyring(kr, keyPassphraseItem))
+	}
+	sources = append(sources, PassphraseFromPrompt("Private key passphrase: "))
+	return FirstPassphrase(sources...)
+}
+
+// PKCS #5 object identifiers of the encryption OpenSSL reads and writes
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is a PKCS #8 encrypted private key (RFC 5958)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the parameters of PBES2 encryption (RFC 8018)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the parameters of PBKDF2 key derivation (RFC 8018)
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// EncryptPrivateKeyPEM encrypts a private key with a passphrase as an
+// "ENCRYPTED PRIVATE KEY" PEM block, which OpenSSL can also read
+func EncryptPrivateKeyPEM(privateKey *ecdsa.PrivateKey, passphrase []byte) ([]byte, error) {
+	return encryptPrivateKeyPEM(privateKey, passphrase, keyIterations)
+}
+
+func encryptPrivateKeyPEM(privateKey *ecdsa.PrivateKey, passphrase []byte, iterations int) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+	if iterations < minKeyIterations {
+		return nil, fmt.Errorf("private key derivation is too weak (%d iterations)", iterations)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kdf.PBKDF2SHA256(passphrase, salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(der, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemEncryptedPrivateKey, Bytes: encrypted}), nil
+}
+
+// decryptPrivateKey decrypts the DER of an "ENCRYPTED PRIVATE KEY" block
+func decryptPrivateKey(der, passphrase []byte) (any, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %v; re-encrypt it with PBES2", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid encryption parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) || !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		return nil, fmt.Errorf("unsupported private key encryption; use PBKDF2 with AES-256-CBC")
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("invalid key derivation parameters: %w", err)
+	}
+	if !kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+		return nil, fmt.Errorf("unsupported key derivation; use PBKDF2 with HMAC-SHA256")
+	}
+	if kdfParams.IterationCount < 1 {
+		return nil, fmt.Errorf("invalid key derivation iteration count %d", kdfParams.IterationCount)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid encryption IV")
+	}
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted private key length")
+	}
+
+	block, err := aes.NewCipher(kdf.PBKDF2SHA256(passphrase, kdfParams.Salt, kdfParams.IterationCount, 32))
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	// A wrong passphrase shows up as bad padding or a key that won't parse
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	key, err := x509.ParsePKCS8PrivateKey(plain[:len(plain)-padding])
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return key, nil
+}
+
+// IsEncryptedPrivateKeyPEM reports whether data holds an encrypted private key
+func IsEncryptedPrivateKeyPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == pemEncryptedPrivateKey
+}
+
+// ParsePrivateKeyPEM parses a P-256 private key in SEC 1, PKCS #8 or
+// encrypted PKCS #8 PEM. passphrase is only called for an encrypted key, and
+// may be nil if the key isn't.
+func ParsePrivateKeyPEM(data []byte, passphrase PassphraseFunc) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: expected PEM encoding", authentication.ErrInvalidPrivateKey)
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case pemECPrivateKey:
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case pemPrivateKey:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case pemEncryptedPrivateKey:
+		if passphrase == nil {
+			return nil, ErrPassphraseRequired
+		}
+		var secret []byte
+		if secret, err = passphrase(); err != nil {
+			return nil, err
+		}
+		key, err = decryptPrivateKey(block.Bytes, secret)
+	default:
+		return nil, fmt.Errorf("%w: unexpected PEM block %q", authentication.ErrInvalidPrivateKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: only elliptic curve keys supported", authentication.ErrInvalidPrivateKey)
+	}
+	if ecdsaKey.Curve.Params().Name != "P-256" {
+		return nil, fmt.Errorf("%w: only P-256 keys supported", authentication.ErrInvalidPrivateKey)
+	}
+	return ecdsaKey, nil
+}
+
+// loadPrivateKeyFile loads the key the client signs commands with. An
+// encrypted key is unlocked with the passphrase in KeyPassphraseEnv, since
+// the server has no terminal to ask on.
+func loadPrivateKeyFile(filename string) (authentication.ECDHPrivateKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKeyPEM(data, PassphraseFromEnv(KeyPassphraseEnv))
+	if err != nil {
+		return nil, err
+	}
+	return &authentication.NativeECDHKey{PrivateKey: key}, nil
+}
@@ -0,0 +1,137 @@
+package tesla
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/99designs/keyring"
+)
+
+// Keyring backends a KeyringConfig can select
+const (
+	KeyringFile          = "file"           // Encrypted files in FileDir
+	KeyringSecretService = "secret-service" // The Linux desktop's Secret Service, such as GNOME Keyring
+	KeyringKeychain      = "keychain"       // The macOS keychain
+)
+
+// Sources a KeyringConfig can read the file backend's password from
+const (
+	PasswordFromEnv    = "env"    // KeyringPasswordEnv
+	PasswordFromFile   = "file"   // The first line of PasswordFile
+	PasswordFromPrompt = "prompt" // The terminal
+)
+
+// KeyringPasswordEnv supplies the file backend's password for unattended use
+const KeyringPasswordEnv = "TESLA_KEYRING_PASSWORD"
+
+// keyringService names the server's items in every backend
+const keyringService = "tesla-hvac-interface"
+
+// DefaultKeyringDir is where the file backend keeps its items
+const DefaultKeyringDir = "~/.tesla-hvac-interface"
+
+// KeyringConfig selects where private keys and OAuth tokens are stored
+type KeyringConfig struct {
+	Backend string `json:"backend,omitempty"`  // file, secret-service or keychain; empty uses the first available
+	FileDir string `json:"file_dir,omitempty"` // For the file backend; defaults to DefaultKeyringDir
+
+	// Where the file backend's password comes from: env, file or prompt.
+	// Empty tries KeyringPasswordEnv, then PasswordFile if set, then the
+	// terminal.
+	PasswordSource string `json:"password_source,omitempty"`
+	PasswordFile   string `json:"password_file,omitempty"` // Readable only by its owner
+}
+
+// Validate checks the config
+func (k KeyringConfig) Validate() error {
+	switch k.Backend {
+	case "", KeyringFile, KeyringSecretService, KeyringKeychain:
+	default:
+		return fmt.Errorf("backend must be %s, %s or %s", KeyringFile, KeyringSecretService, KeyringKeychain)
+	}
+	switch k.PasswordSource {
+	case "", PasswordFromEnv, PasswordFromPrompt:
+	case PasswordFromFile:
+		if k.PasswordFile == "" {
+			return fmt.Errorf("password_source %s needs password_file", PasswordFromFile)
+		}
+	default:
+		return fmt.Errorf("password_source must be %s, %s or %s", PasswordFromEnv, PasswordFromFile, PasswordFromPrompt)
+	}
+	return nil
+}
+
+// password returns where the file backend's password comes from
+func (k KeyringConfig) password() PassphraseFunc {
+	env := PassphraseFromEnv(KeyringPasswordEnv)
+	prompt := PassphraseFromPrompt("Keyring password: ")
+	switch k.PasswordSource {
+	case PasswordFromEnv:
+		return env
+	case PasswordFromFile:
+		return passwordFromFile(k.PasswordFile)
+	case PasswordFromPrompt:
+		return prompt
+	}
+	if k.PasswordFile != "" {
+		return FirstPassphrase(env, passwordFromFile(k.PasswordFile), prompt)
+	}
+	return FirstPassphrase(env, prompt)
+}
+
+// passwordFromFile reads a password from the first line of a file, which
+// must not be readable by other users
+func passwordFromFile(name string) PassphraseFunc {
+	return func() ([]byte, error) {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring password: %w", err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			return nil, fmt.Errorf("keyring password file %s is readable by other users; chmod 600 it", name)
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring password: %w", err)
+		}
+		password, _, _ := bytes.Cut(data, []byte("\n"))
+		password = bytes.TrimSuffix(password, []byte("\r"))
+		if len(password) == 0 {
+			return nil, fmt.Errorf("%w: %s is empty", ErrPassphraseRequired, name)
+		}
+		return password, nil
+	}
+}
+
+// OpenKeyring opens the keyring a config selects
+func OpenKeyring(config KeyringConfig) (keyring.Keyring, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	fileDir := config.FileDir
+	if fileDir == "" {
+		fileDir = DefaultKeyringDir
+	}
+	password := config.password()
+	backend := keyring.Config{
+		ServiceName:  keyringService,
+		KeychainName: keyringService,
+		FileDir:      fileDir,
+		FilePasswordFunc: func(string) (string, error) {
+			data, err := password()
+			if err != nil {
+				return "", fmt.Errorf("keyring password: %w", err)
+			}
+			return string(data), nil
+		},
+	}
+	if config.Backend != "" {
+		backend.AllowedBackends = []keyring.BackendType{keyring.BackendType(config.Backend)}
+	}
+	kr, err := keyring.Open(backend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keyring: %w", err)
+	}
+	return kr, nil
+}
@@ -3,23 +3,43 @@ package tesla
 import (
 	"crypto/ecdsa"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/99designs/keyring"
+
 	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/qr"
 )
 
+// ErrKeyPairNotFound is returned when no key pair has been stored under a
+// key manager's name
+var ErrKeyPairNotFound = errors.New("key pair not found")
+
 // KeyManager handles public/private key generation and enrollment for Tesla vehicles
 type KeyManager struct {
 	logger     *log.Logger
 	keyName    string
+	keyring    keyring.Keyring // Persists the key pair; nil keeps it in memory
 	publicKey  *ecdsa.PublicKey
 	privateKey *ecdsa.PrivateKey
+	createdAt  time.Time
+}
+
+// storedKeyPair is a key pair as stored in the keyring
+type storedKeyPair struct {
+	PrivateKeyPEM string    `json:"private_key_pem"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // KeyPair represents a generated key pair
@@ -38,7 +58,7 @@ type EnrollmentInfo struct {
 	QRCodeData   string `json:"qr_code_data"`
 }
 
-// NewKeyManager creates a new key manager
+// NewKeyManager creates a new key manager that keeps its key pair in memory
 func NewKeyManager(keyName string, logger *log.Logger) (*KeyManager, error) {
 	return &KeyManager{
 		logger:  logger,
@@ -46,6 +66,31 @@ func NewKeyManager(keyName string, logger *log.Logger) (*KeyManager, error) {
 	}, nil
 }
 
+// NewKeyManagerWithKeyring creates a key manager that stores its key pair in
+// kr, so it survives restarts
+func NewKeyManagerWithKeyring(keyName string, kr keyring.Keyring, logger *log.Logger) *KeyManager {
+	return &KeyManager{
+		logger:  logger,
+		keyName: keyName,
+		keyring: kr,
+	}
+}
+
+// OpenKeyManager creates a key manager that stores its key pair in the
+// keyring config selects
+func OpenKeyManager(keyName string, config KeyringConfig, logger *log.Logger) (*KeyManager, error) {
+	kr, err := OpenKeyring(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyManagerWithKeyring(keyName, kr, logger), nil
+}
+
+// keyringKey is the keyring item holding the key pair
+func (km *KeyManager) keyringKey() string {
+	return "private_key." + km.keyName
+}
+
 // GenerateKeyPair generates a new ECDSA P-256 key pair
 func (km *KeyManager) GenerateKeyPair() (*KeyPair, error) {
 	km.logger.Println("Generating new ECDSA P-256 key pair")
@@ -62,50 +107,113 @@ func (km *KeyManager) GenerateKeyPair() (*KeyPair, error) {
 		return nil, fmt.Errorf("failed to convert to ECDSA key")
 	}
 	
-	// Get public key
-	publicKey := &ecdsaKey.PrivateKey.PublicKey
-	km.privateKey = ecdsaKey.PrivateKey
-	km.publicKey = publicKey
+	keyPair, err := km.keyPair(ecdsaKey.PrivateKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Persist the key before using it, so a key that can't be stored is never
+	// enrolled
+	if km.keyring != nil {
+		data, err := json.Marshal(storedKeyPair{PrivateKeyPEM: keyPair.PrivateKeyPEM, CreatedAt: keyPair.CreatedAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize key pair: %w", err)
+		}
+		err = km.keyring.Set(keyring.Item{
+			Key:   km.keyringKey(),
+			Data:  data,
+			Label: "Tesla HVAC Interface Private Key",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store key pair in keyring: %w", err)
+		}
+	}
+	km.setKeys(ecdsaKey.PrivateKey, keyPair.CreatedAt)
 	
-	// Convert to PEM format
-	publicKeyPEM, err := km.publicKeyToPEM(publicKey)
+	km.logger.Printf("Successfully generated key pair: %s", km.keyName)
+	return keyPair, nil
+}
+
+// keyPair converts a private key to a KeyPair
+func (km *KeyManager) keyPair(privateKey *ecdsa.PrivateKey, createdAt time.Time) (*KeyPair, error) {
+	publicKeyPEM, err := km.publicKeyToPEM(&privateKey.PublicKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert public key to PEM: %w", err)
 	}
-	
-	privateKeyPEM, err := km.privateKeyToPEM(ecdsaKey.PrivateKey)
+	privateKeyPEM, err := km.privateKeyToPEM(privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert private key to PEM: %w", err)
 	}
-	
-	keyPair := &KeyPair{
+	return &KeyPair{
 		PublicKeyPEM:  publicKeyPEM,
 		PrivateKeyPEM: privateKeyPEM,
 		KeyName:       km.keyName,
-		CreatedAt:     time.Now(),
-	}
-	
-	km.logger.Printf("Successfully generated key pair: %s", km.keyName)
-	return keyPair, nil
+		CreatedAt:     createdAt,
+	}, nil
 }
 
-// LoadExistingKeyPair loads an existing key pair from the keyring
+// setKeys makes privateKey the current key pair
+func (km *KeyManager) setKeys(privateKey *ecdsa.PrivateKey, createdAt time.Time) {
+	km.privateKey = privateKey
+	km.publicKey = &privateKey.PublicKey
+	km.createdAt = createdAt
+}
+
+// LoadExistingKeyPair loads an existing key pair from the keyring. Without
+// a keyring it returns the key pair in memory. It returns an error wrapping
+// ErrKeyPairNotFound if there is none.
 func (km *KeyManager) LoadExistingKeyPair() (*KeyPair, error) {
 	km.logger.Printf("Loading existing key pair: %s", km.keyName)
-	
-	// For now, return an error since we don't have keyring storage
-	// In a full implementation, this would load from the system keyring
-	return nil, fmt.Errorf("keyring storage not implemented - use GenerateKeyPair instead")
+
+	if km.keyring == nil {
+		if km.privateKey == nil {
+			return nil, fmt.Errorf("%w: %s", ErrKeyPairNotFound, km.keyName)
+		}
+		return km.keyPair(km.privateKey, km.createdAt)
+	}
+
+	item, err := km.keyring.Get(km.keyringKey())
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyPairNotFound, km.keyName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key pair from keyring: %w", err)
+	}
+	var stored storedKeyPair
+	if err := json.Unmarshal(item.Data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse stored key pair: %w", err)
+	}
+	block, _ := pem.Decode([]byte(stored.PrivateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("stored key pair %s has no PEM private key", km.keyName)
+	}
+	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stored private key: %w", err)
+	}
+
+	keyPair, err := km.keyPair(privateKey, stored.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	km.setKeys(privateKey, stored.CreatedAt)
+	km.logger.Printf("Loaded key pair: %s", km.keyName)
+	return keyPair, nil
 }
 
-// GetOrCreateKeyPair gets an existing key pair or creates a new one
+// GetOrCreateKeyPair gets an existing key pair or creates a new one. A key
+// pair that exists but can't be read is an error rather than replaced, since
+// a new key would need enrolling again.
 func (km *KeyManager) GetOrCreateKeyPair() (*KeyPair, error) {
 	// Try to load existing key pair first
 	keyPair, err := km.LoadExistingKeyPair()
-	if err != nil {
+	if errors.Is(err, ErrKeyPairNotFound) {
 		km.logger.Printf("No existing key pair found, generating new one: %v", err)
 		return km.GenerateKeyPair()
 	}
+	if err != nil {
+		return nil, err
+	}
 	
 	return keyPair, nil
 }
@@ -127,20 +235,36 @@ func (km *KeyManager) CreateEnrollmentInfo(domainName string) (*EnrollmentInfo,
 	// Create enrollment URL
 	enrollmentURL := fmt.Sprintf("https://tesla.com/_ak/%s", domainName)
 	
-	// Create QR code data (simplified - in production, use a QR code library)
-	qrCodeData := fmt.Sprintf("tesla://_ak/%s", domainName)
-	
 	enrollmentInfo := &EnrollmentInfo{
 		PublicKeyPEM:  publicKeyPEM,
 		DomainName:    domainName,
 		EnrollmentURL: enrollmentURL,
-		QRCodeData:    qrCodeData,
+		QRCodeData:    enrollmentQRData(domainName),
 	}
 	
 	km.logger.Printf("Created enrollment info for domain: %s", domainName)
 	return enrollmentInfo, nil
 }
 
+// enrollmentQRData is what the enrollment QR code holds
+func enrollmentQRData(domainName string) string {
+	return fmt.Sprintf("tesla://_ak/%s", domainName)
+}
+
+// EnrollmentQRCode encodes the enrollment QR code for a domain, for the Tesla
+// app to scan during pairing
+func EnrollmentQRCode(domainName string) (*qr.Code, error) {
+	if domainName == "" || strings.ContainsAny(domainName, "/ \t\r\n") {
+		return nil, fmt.Errorf("invalid domain name %q", domainName)
+	}
+	return qr.Encode(enrollmentQRData(domainName))
+}
+
+// QRCode encodes QRCodeData as a QR code
+func (e *EnrollmentInfo) QRCode() (*qr.Code, error) {
+	return qr.Encode(e.QRCodeData)
+}
+
 // SavePublicKeyToFile saves the public key to a file
 func (km *KeyManager) SavePublicKeyToFile(filename string) error {
 	if km.publicKey == nil {
@@ -171,6 +295,108 @@ func (km *KeyManager) SavePublicKeyToFile(filename string) error {
 	return nil
 }
 
+// SavePrivateKeyToFile saves the private key to a file, encrypted with the
+// passphrase from passphrase. A nil passphrase saves it unencrypted.
+func (km *KeyManager) SavePrivateKeyToFile(filename string, passphrase PassphraseFunc) error {
+	if km.privateKey == nil {
+		return fmt.Errorf("no private key available, generate key pair first")
+	}
+
+	km.logger.Printf("Saving private key to file: %s", filename)
+
+	var data []byte
+	if passphrase == nil {
+		km.logger.Printf("warn: Saving private key %s unencrypted", filename)
+		privateKeyPEM, err := km.privateKeyToPEM(km.privateKey)
+		if err != nil {
+			return fmt.Errorf("failed to convert private key to PEM: %w", err)
+		}
+		data = []byte(privateKeyPEM)
+	} else {
+		secret, err := passphrase()
+		if err != nil {
+			return err
+		}
+		data, err = EncryptPrivateKeyPEM(km.privateKey, secret)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt private key: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return fmt.Errorf("failed to write private key to file: %w", err)
+	}
+
+	km.logger.Printf("Successfully saved private key to: %s", filename)
+	return nil
+}
+
+// LoadFromFile makes the private key in a file the current key pair. An
+// encrypted key is decrypted with the passphrase from passphrase, which may
+// be nil if the key isn't encrypted. The key isn't stored in the keyring.
+func (km *KeyManager) LoadFromFile(filename string, passphrase PassphraseFunc) (*KeyPair, error) {
+	km.logger.Printf("Loading private key from file: %s", filename)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	privateKey, err := ParsePrivateKeyPEM(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key %s: %w", filename, err)
+	}
+	createdAt := time.Time{}
+	if info, err := os.Stat(filename); err == nil {
+		createdAt = info.ModTime()
+	}
+
+	keyPair, err := km.keyPair(privateKey, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	km.setKeys(privateKey, createdAt)
+	km.logger.Printf("Loaded private key from: %s", filename)
+	return keyPair, nil
+}
+
+// RotateKeyPair replaces the stored key pair with a new one and returns both.
+// The new key has to be enrolled before the old one is removed from the
+// vehicle.
+func (km *KeyManager) RotateKeyPair() (previous, current *KeyPair, err error) {
+	previous, err = km.LoadExistingKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err = km.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	km.logger.Printf("Rotated key pair: %s", km.keyName)
+	return previous, current, nil
+}
+
+// Fingerprint identifies the public key: the hex SHA-256 of the uncompressed
+// point the vehicle whitelists
+func (km *KeyManager) Fingerprint() (string, error) {
+	if km.publicKey == nil {
+		return "", fmt.Errorf("no public key available, generate key pair first")
+	}
+	return PublicKeyFingerprint(km.publicKey)
+}
+
+// PublicKeyFingerprint returns the fingerprint of a P-256 public key
+func PublicKeyFingerprint(publicKey *ecdsa.PublicKey) (string, error) {
+	point, err := publicKey.ECDH()
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	sum := sha256.Sum256(point.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
 // GetPrivateKey returns the current private key
 func (km *KeyManager) GetPrivateKey() *ecdsa.PrivateKey {
 	return km.privateKey
@@ -185,10 +411,15 @@ func (km *KeyManager) GetPublicKey() *ecdsa.PublicKey {
 func (km *KeyManager) DeleteKeyPair() error {
 	km.logger.Printf("Deleting key pair: %s", km.keyName)
 	
-	// For now, just clear the in-memory keys
-	// In a full implementation, this would delete from the system keyring
+	if km.keyring != nil {
+		err := km.keyring.Remove(km.keyringKey())
+		if err != nil && !errors.Is(err, keyring.ErrKeyNotFound) && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete key pair from keyring: %w", err)
+		}
+	}
 	km.privateKey = nil
 	km.publicKey = nil
+	km.createdAt = time.Time{}
 	
 	km.logger.Printf("Successfully deleted key pair: %s", km.keyName)
 	return nil
@@ -218,11 +449,18 @@ func (km *KeyManager) GetKeyInfo() map[string]interface{} {
 		"key_name":    km.keyName,
 		"has_private": km.privateKey != nil,
 		"has_public":  km.publicKey != nil,
+		"persistent":  km.keyring != nil,
+	}
+	if !km.createdAt.IsZero() {
+		info["created_at"] = km.createdAt
 	}
 	
 	if km.publicKey != nil {
 		info["curve"] = km.publicKey.Curve.Params().Name
 		info["key_size"] = km.publicKey.Curve.Params().BitSize
+		if fingerprint, err := PublicKeyFingerprint(km.publicKey); err == nil {
+			info["fingerprint"] = fingerprint
+		}
 	}
 	
 	return info
@@ -285,9 +523,12 @@ Tesla Vehicle Key Enrollment Instructions
    - Register your domain: %s
 
 3. Enroll the key in your Tesla vehicle:
+   - Within Bluetooth range, run "tesla-config enroll" and tap a key card
+     on the center console, or:
    - Open the Tesla mobile app
    - Go to: %s
    - Or scan this QR code: %s
+     (GET /api/v1/enroll/qr?domain=%s serves it as an image)
    - Follow the prompts to approve the key
 
 4. Test the connection:
@@ -301,6 +542,7 @@ Public Key:
 		domainName,
 		enrollmentInfo.EnrollmentURL,
 		enrollmentInfo.QRCodeData,
+		domainName,
 		enrollmentInfo.PublicKeyPEM,
 	)
 	
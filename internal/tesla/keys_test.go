@@ -1,10 +1,16 @@
 package tesla
 
 import (
+	"errors"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/99designs/keyring"
 )
 
 func TestNewKeyManager(t *testing.T) {
@@ -120,6 +126,24 @@ func TestEnrollmentInfo(t *testing.T) {
 	}
 }
 
+func TestEnrollmentQRCode(t *testing.T) {
+	code, err := EnrollmentQRCode("example.com")
+	if err != nil {
+		t.Fatalf("Failed to encode QR code: %v", err)
+	}
+	info := &EnrollmentInfo{QRCodeData: enrollmentQRData("example.com")}
+	same, err := info.QRCode()
+	if err != nil || same.Size != code.Size {
+		t.Errorf("Expected the same code from EnrollmentInfo, got %v", err)
+	}
+
+	for _, domain := range []string{"", "example.com/path", "bad domain"} {
+		if _, err := EnrollmentQRCode(domain); err == nil {
+			t.Errorf("Expected %q to be rejected", domain)
+		}
+	}
+}
+
 func TestCreateEnrollmentInfo(t *testing.T) {
 	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
 	manager, err := NewKeyManager("test-enrollment", logger)
@@ -258,3 +282,152 @@ func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[:len(substr)] == substr || 
 		   len(s) > len(substr) && contains(s[1:], substr)
 }
+
+func TestKeyPairPersistsInKeyring(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	t.Setenv(KeyringPasswordEnv, "test")
+	config := KeyringConfig{Backend: KeyringFile, FileDir: t.TempDir()}
+	manager, err := OpenKeyManager("test-persist", config, logger)
+	if err != nil {
+		t.Fatalf("Failed to open key manager: %v", err)
+	}
+	if _, err := manager.LoadExistingKeyPair(); !errors.Is(err, ErrKeyPairNotFound) {
+		t.Fatalf("Expected ErrKeyPairNotFound before generating, got %v", err)
+	}
+	generated, err := manager.GetOrCreateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+
+	// A new manager, as after a restart, loads the same key
+	restarted, err := OpenKeyManager("test-persist", config, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := restarted.GetOrCreateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to load key pair: %v", err)
+	}
+	if loaded.PrivateKeyPEM != generated.PrivateKeyPEM || loaded.PublicKeyPEM != generated.PublicKeyPEM {
+		t.Error("Expected the stored key pair, got a different one")
+	}
+	if !loaded.CreatedAt.Equal(generated.CreatedAt) {
+		t.Errorf("Expected created_at %v, got %v", generated.CreatedAt, loaded.CreatedAt)
+	}
+	if err := restarted.ValidateKeyPair(); err != nil {
+		t.Errorf("Loaded key pair is invalid: %v", err)
+	}
+
+	if err := restarted.DeleteKeyPair(); err != nil {
+		t.Fatalf("Failed to delete key pair: %v", err)
+	}
+	if _, err := manager.LoadExistingKeyPair(); !errors.Is(err, ErrKeyPairNotFound) {
+		t.Errorf("Expected the key pair deleted from the keyring, got %v", err)
+	}
+	if err := restarted.DeleteKeyPair(); err != nil {
+		t.Errorf("Deleting a missing key pair should succeed, got %v", err)
+	}
+}
+
+func TestRotateKeyPair(t *testing.T) {
+	kr := keyring.NewArrayKeyring(nil)
+	manager := NewKeyManagerWithKeyring("test-rotate", kr, log.New(io.Discard, "", 0))
+	if _, _, err := manager.RotateKeyPair(); !errors.Is(err, ErrKeyPairNotFound) {
+		t.Fatalf("Expected ErrKeyPairNotFound without a key pair, got %v", err)
+	}
+	original, err := manager.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := manager.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous, current, err := manager.RotateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to rotate key pair: %v", err)
+	}
+	if previous.PublicKeyPEM != original.PublicKeyPEM || current.PublicKeyPEM == original.PublicKeyPEM {
+		t.Error("Expected the original key pair replaced by a new one")
+	}
+	after, _ := manager.Fingerprint()
+	if after == before || len(after) != 64 {
+		t.Errorf("Expected a new 64-digit fingerprint, got %s (was %s)", after, before)
+	}
+	if manager.GetKeyInfo()["fingerprint"] != after {
+		t.Error("Expected the fingerprint in the key info")
+	}
+
+	// The new key pair is the stored one
+	loaded, err := NewKeyManagerWithKeyring("test-rotate", kr, log.New(io.Discard, "", 0)).LoadExistingKeyPair()
+	if err != nil || loaded.PublicKeyPEM != current.PublicKeyPEM {
+		t.Errorf("Expected the rotated key pair in the keyring (%v)", err)
+	}
+}
+
+func TestGetOrCreateKeepsUnreadableKeyPair(t *testing.T) {
+	kr := keyring.NewArrayKeyring([]keyring.Item{{Key: "private_key.test-corrupt", Data: []byte("not json")}})
+	manager := NewKeyManagerWithKeyring("test-corrupt", kr, log.New(io.Discard, "", 0))
+	if _, err := manager.GetOrCreateKeyPair(); err == nil || errors.Is(err, ErrKeyPairNotFound) {
+		t.Fatalf("Expected an unreadable key pair to be an error, got %v", err)
+	}
+	if item, _ := kr.Get("private_key.test-corrupt"); string(item.Data) != "not json" {
+		t.Error("An unreadable key pair must not be replaced")
+	}
+}
+
+func TestKeyringConfigValidate(t *testing.T) {
+	for backend, ok := range map[string]bool{"": true, "file": true, "secret-service": true, "keychain": true, "wincred": false} {
+		if err := (KeyringConfig{Backend: backend}).Validate(); (err == nil) != ok {
+			t.Errorf("Validate(%q) = %v", backend, err)
+		}
+	}
+	for _, config := range []KeyringConfig{{PasswordSource: "keychain"}, {PasswordSource: PasswordFromFile}} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", config)
+		}
+	}
+}
+
+func TestKeyringPassword(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := KeyringConfig{Backend: KeyringFile, FileDir: filepath.Join(dir, "keyring"), PasswordFile: passwordFile}
+
+	// The environment takes precedence over the file
+	t.Setenv(KeyringPasswordEnv, "from-env")
+	if password, err := config.password()(); err != nil || string(password) != "from-env" {
+		t.Errorf("Expected the password from the environment, got %q (%v)", password, err)
+	}
+	t.Setenv(KeyringPasswordEnv, "")
+	if password, err := config.password()(); err != nil || string(password) != "from-file" {
+		t.Errorf("Expected the password from the file, got %q (%v)", password, err)
+	}
+
+	// Items written with one password can't be read with another
+	kr, err := OpenKeyring(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Set(keyring.Item{Key: "item", Data: []byte("secret")}); err != nil {
+		t.Fatalf("Failed to store an item: %v", err)
+	}
+	t.Setenv(KeyringPasswordEnv, "wrong")
+	kr, _ = OpenKeyring(config)
+	if _, err := kr.Get("item"); err == nil {
+		t.Error("Expected the wrong password to fail")
+	}
+
+	os.Chmod(passwordFile, 0644)
+	if _, err := (KeyringConfig{PasswordSource: PasswordFromFile, PasswordFile: passwordFile}).password()(); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("Expected a world-readable password file to be refused, got %v", err)
+	}
+	t.Setenv(KeyringPasswordEnv, "")
+	if _, err := (KeyringConfig{PasswordSource: PasswordFromEnv}).password()(); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("Expected ErrPassphraseRequired without a password, got %v", err)
+	}
+}
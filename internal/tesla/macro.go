@@ -0,0 +1,422 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// macroNamePattern restricts macro names to what works as a URL segment and
+// a CLI verb
+var macroNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Macro is a named sequence of commands defined in the config file, e.g. an
+// "arrive-home" macro that warms the cabin and then sets the fan
+type Macro struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Steps       []MacroStep `json:"steps"`
+}
+
+// MacroStep is one command in a macro. Params use the same names and units
+// as the command hook arguments, so temperatures are in Celsius.
+type MacroStep struct {
+	Command string                 `json:"command"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Delay   time.Duration          `json:"delay,omitempty"` // Wait before running this step
+}
+
+// StepResult is the outcome of one step of a macro run with RunMacroSteps
+type StepResult struct {
+	Step    int    `json:"step"`
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DefrostMacro is the built-in "defrost" macro for frosty mornings: max
+// defrost, both front seat heaters on high and the steering wheel heater
+var DefrostMacro = Macro{
+	Name:        "defrost",
+	Description: "Max defrost with heated front seats and steering wheel",
+	Steps: []MacroStep{
+		{Command: "set_preconditioning_max", Params: map[string]interface{}{"enabled": true}},
+		{Command: "set_seat_heater", Params: map[string]interface{}{"seat": "front_left", "level": 3}},
+		{Command: "set_seat_heater", Params: map[string]interface{}{"seat": "front_right", "level": 3}},
+		{Command: "set_steering_wheel_heater", Params: map[string]interface{}{"enabled": true}},
+	},
+}
+
+// Duration returns the total delay across the macro's steps
+func (m Macro) Duration() time.Duration {
+	var total time.Duration
+	for _, step := range m.Steps {
+		total += step.Delay
+	}
+	return total
+}
+
+// Validate checks the macro's name and that every step is a known command
+// with valid params
+func (m Macro) Validate() error {
+	if !macroNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, '-' or '_'", m.Name)
+	}
+	if len(m.Steps) == 0 {
+		return fmt.Errorf("macro %s has no steps", m.Name)
+	}
+	for i, step := range m.Steps {
+		if step.Delay < 0 {
+			return fmt.Errorf("macro %s step %d: delay must be non-negative", m.Name, i+1)
+		}
+		if _, err := bindCommand(step.Command, step.Params); err != nil {
+			return fmt.Errorf("macro %s step %d: %w", m.Name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateMacros checks every macro and that names are unique
+func validateMacros(macros []Macro) error {
+	seen := make(map[string]bool, len(macros))
+	for _, macro := range macros {
+		if err := macro.Validate(); err != nil {
+			return err
+		}
+		if seen[macro.Name] {
+			return fmt.Errorf("duplicate macro %s", macro.Name)
+		}
+		seen[macro.Name] = true
+	}
+	return nil
+}
+
+// FindMacro returns the macro with the given name
+func (c *Config) FindMacro(name string) (Macro, bool) {
+	for _, macro := range c.Macros {
+		if macro.Name == name {
+			return macro, true
+		}
+	}
+	return Macro{}, false
+}
+
+// RunMacro runs a macro's steps in order, waiting each step's delay first.
+// It stops at the first failed step.
+func (c *Client) RunMacro(ctx context.Context, macro Macro) error {
+	if err := macro.Validate(); err != nil {
+		return err
+	}
+
+	c.logFor(ctx).Printf("Running macro %s (%d steps)", macro.Name, len(macro.Steps))
+	for i, step := range macro.Steps {
+		if step.Delay > 0 {
+			timer := time.NewTimer(step.Delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("macro %s cancelled before step %d: %w", macro.Name, i+1, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		if err := c.ExecuteCommand(ctx, step.Command, step.Params); err != nil {
+			return fmt.Errorf("macro %s step %d (%s): %w", macro.Name, i+1, step.Command, err)
+		}
+	}
+	return nil
+}
+
+// RunMacroSteps runs every step of a macro in order, like RunMacro, but
+// carries on past failed steps. It returns each step's result, and an error
+// naming the failed steps if there were any.
+func (c *Client) RunMacroSteps(ctx context.Context, macro Macro) ([]StepResult, error) {
+	if err := macro.Validate(); err != nil {
+		return nil, err
+	}
+
+	c.logFor(ctx).Printf("Running macro %s (%d steps)", macro.Name, len(macro.Steps))
+	results := make([]StepResult, 0, len(macro.Steps))
+	var failed []string
+	for i, step := range macro.Steps {
+		result := StepResult{Step: i + 1, Command: step.Command}
+		if step.Delay > 0 {
+			timer := time.NewTimer(step.Delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return results, fmt.Errorf("macro %s cancelled before step %d: %w", macro.Name, i+1, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		if err := c.ExecuteCommand(ctx, step.Command, step.Params); err != nil {
+			result.Error = err.Error()
+			failed = append(failed, fmt.Sprintf("step %d (%s): %v", i+1, step.Command, err))
+		} else {
+			result.OK = true
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("macro %s: %d of %d steps failed: %s", macro.Name, len(failed), len(macro.Steps), strings.Join(failed, "; "))
+	}
+	return results, nil
+}
+
+// ExecuteCommand runs a command by its hook name with params decoded from
+// generic values, e.g. from config or JSON
+func (c *Client) ExecuteCommand(ctx context.Context, name string, params map[string]interface{}) error {
+	run, err := bindCommand(name, params)
+	if err != nil {
+		return err
+	}
+	return run(ctx, c)
+}
+
+// commandRunner runs a bound command against a client
+type commandRunner func(ctx context.Context, c *Client) error
+
+// bindCommand validates a command's params and returns a function that runs it
+func bindCommand(name string, params map[string]interface{}) (commandRunner, error) {
+	switch name {
+	case "set_temperature":
+		var p struct {
+			DriverTemp    *float32 `json:"driver_temp"`
+			PassengerTemp *float32 `json:"passenger_temp"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		if p.DriverTemp == nil {
+			return nil, fmt.Errorf("%s: driver_temp is required", name)
+		}
+		if p.PassengerTemp == nil {
+			p.PassengerTemp = p.DriverTemp
+		}
+		for _, temp := range []float32{*p.DriverTemp, *p.PassengerTemp} {
+			if temp < 15 || temp > 28 {
+				return nil, fmt.Errorf("%s: temperature %.1f°C is outside 15-28°C", name, temp)
+			}
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetTemperature(ctx, *p.DriverTemp, *p.PassengerTemp)
+		}, nil
+
+	case "set_climate_on":
+		var cond ClimateConditions
+		if err := decodeParams(name, params, &cond); err != nil {
+			return nil, err
+		}
+		if err := cond.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetClimateOnIf(ctx, cond)
+		}, nil
+
+	case "set_climate_off":
+		if err := decodeParams(name, params, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetClimateOff(ctx)
+		}, nil
+
+	case "set_fan_speed":
+		var p struct {
+			Speed *int `json:"speed"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		if p.Speed == nil || *p.Speed < int(FanSpeedOff) || *p.Speed > int(FanSpeedAuto) {
+			return nil, fmt.Errorf("%s: speed must be between %d and %d", name, FanSpeedOff, FanSpeedAuto)
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetFanSpeed(ctx, FanSpeed(*p.Speed))
+		}, nil
+
+	case "set_airflow_pattern":
+		var p struct {
+			Pattern string `json:"pattern"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		pattern, err := ParseAirflowPattern(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetAirflowPattern(ctx, pattern)
+		}, nil
+
+	case "set_defroster":
+		var p struct {
+			Front bool `json:"front"`
+			Rear  bool `json:"rear"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetDefroster(ctx, p.Front, p.Rear)
+		}, nil
+
+	case "set_auto_mode", "set_steering_wheel_heater":
+		var p struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		if name == "set_auto_mode" {
+			return func(ctx context.Context, c *Client) error {
+				return c.SetAutoMode(ctx, p.Enabled)
+			}, nil
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetSteeringWheelHeater(ctx, p.Enabled)
+		}, nil
+
+	case "set_seat_heater":
+		var p struct {
+			Seat  string `json:"seat"` // A seat name such as front_left, or all
+			Level *int   `json:"level"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		if p.Level == nil {
+			return nil, fmt.Errorf("%s: level is required", name)
+		}
+		if err := ValidateSeatLevel(*p.Level); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		seats := HeatedSeats
+		if p.Seat != "all" {
+			seat, err := ParseSeat(p.Seat)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			seats = []vehicle.SeatPosition{seat}
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetSeatHeaters(ctx, seats, vehicle.Level(*p.Level))
+		}, nil
+
+	case "set_preconditioning_max", "set_bioweapon_defense_mode":
+		var p struct {
+			Enabled        bool `json:"enabled"`
+			ManualOverride bool `json:"manual_override"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		if name == "set_preconditioning_max" {
+			return func(ctx context.Context, c *Client) error {
+				return c.SetPreconditioningMax(ctx, p.Enabled, p.ManualOverride)
+			}, nil
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetBioweaponDefenseMode(ctx, p.Enabled, p.ManualOverride)
+		}, nil
+
+	case "set_cabin_overheat_protection":
+		var p struct {
+			Mode string `json:"mode"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		mode, err := ParseOverheatProtectionMode(p.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetCabinOverheatProtection(ctx, mode)
+		}, nil
+
+	case "set_cabin_overheat_protection_limit":
+		var p struct {
+			Limit string `json:"limit"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		limit, err := ParseOverheatProtectionLimit(p.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetCabinOverheatProtectionLimit(ctx, limit)
+		}, nil
+
+	case "set_climate_keeper_mode":
+		var p struct {
+			Mode           string `json:"mode"`
+			ManualOverride bool   `json:"manual_override"`
+		}
+		if err := decodeParams(name, params, &p); err != nil {
+			return nil, err
+		}
+		mode, err := ParseClimateKeeperMode(p.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return func(ctx context.Context, c *Client) error {
+			return c.SetClimateKeeperMode(ctx, mode, p.ManualOverride)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// decodeParams decodes generic params into a typed struct, rejecting
+// unknown fields so typos in config files are caught at load time
+func decodeParams(command string, params map[string]interface{}, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("%s: invalid params: %w", command, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%s: invalid params: %w", command, err)
+	}
+	return nil
+}
+
+// airflowPatternNames maps config and API names to airflow patterns
+var airflowPatternNames = map[string]AirflowPattern{
+	"face":              AirflowFace,
+	"feet":              AirflowFeet,
+	"defrost":           AirflowDefrost,
+	"face_feet":         AirflowFaceFeet,
+	"feet_defrost":      AirflowFeetDefrost,
+	"face_defrost":      AirflowFaceDefrost,
+	"face_feet_defrost": AirflowFaceFeetDefrost,
+	"auto":              AirflowAuto,
+}
+
+// ParseAirflowPattern converts a pattern name such as "face_feet" to an
+// AirflowPattern
+func ParseAirflowPattern(name string) (AirflowPattern, error) {
+	pattern, ok := airflowPatternNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown airflow pattern %q", name)
+	}
+	return pattern, nil
+}
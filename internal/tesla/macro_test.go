@@ -0,0 +1,162 @@
+package tesla
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMacroValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		macro Macro
+		err   string
+	}{
+		{"valid", Macro{Name: "arrive-home", Steps: []MacroStep{
+			{Command: "set_climate_on", Params: map[string]interface{}{"min_battery_level": 30.0}},
+			{Command: "set_temperature", Params: map[string]interface{}{"driver_temp": 21.5}, Delay: time.Second},
+			{Command: "set_airflow_pattern", Params: map[string]interface{}{"pattern": "face_feet"}},
+		}}, ""},
+		{"bad name", Macro{Name: "Arrive Home", Steps: []MacroStep{{Command: "set_climate_off"}}}, "must be lowercase"},
+		{"no steps", Macro{Name: "empty"}, "has no steps"},
+		{"unknown command", Macro{Name: "m", Steps: []MacroStep{{Command: "honk"}}}, `unknown command "honk"`},
+		{"unknown param", Macro{Name: "m", Steps: []MacroStep{
+			{Command: "set_fan_speed", Params: map[string]interface{}{"sped": 3.0}},
+		}}, `unknown field "sped"`},
+		{"missing param", Macro{Name: "m", Steps: []MacroStep{{Command: "set_temperature"}}}, "driver_temp is required"},
+		{"out of range", Macro{Name: "m", Steps: []MacroStep{
+			{Command: "set_temperature", Params: map[string]interface{}{"driver_temp": 72.0}},
+		}}, "outside 15-28°C"},
+		{"negative delay", Macro{Name: "m", Steps: []MacroStep{{Command: "set_climate_off", Delay: -1}}}, "delay must be non-negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.macro.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Expected valid macro, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateMacros(t *testing.T) {
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+
+	var macros []Macro
+	data := `[
+		{"name": "arrive-home", "steps": [{"command": "set_climate_on"}, {"command": "set_fan_speed", "params": {"speed": 4}, "delay": 5000000000}]},
+		{"name": "arrive-home", "steps": [{"command": "set_climate_off"}]}
+	]`
+	if err := json.Unmarshal([]byte(data), &macros); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Macros = macros[:1]
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if macro, ok := config.FindMacro("arrive-home"); !ok || macro.Duration() != 5*time.Second {
+		t.Errorf("Expected to find macro with 5s of delays, got %+v", macro)
+	}
+
+	config.Macros = macros
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "duplicate macro arrive-home") {
+		t.Errorf("Expected duplicate macro error, got %v", err)
+	}
+}
+
+func TestRunMacroStopsAtFailedStep(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	var commands []string
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		commands = append(commands, cmd.Name)
+		return ErrCommandVetoed
+	})
+
+	macro := Macro{Name: "m", Steps: []MacroStep{
+		{Command: "set_fan_speed", Params: map[string]interface{}{"speed": 3.0}},
+		{Command: "set_climate_off"},
+	}}
+	err := client.RunMacro(context.Background(), macro)
+	if !errors.Is(err, ErrCommandVetoed) {
+		t.Fatalf("Expected veto from first step, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "macro m step 1 (set_fan_speed)") {
+		t.Errorf("Expected step in error, got %v", err)
+	}
+	if len(commands) != 1 {
+		t.Errorf("Expected macro to stop after the first step, ran %v", commands)
+	}
+}
+
+func TestRunMacroStepsContinuesPastFailures(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	var commands []string
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		commands = append(commands, cmd.Name)
+		if cmd.Name == "set_preconditioning_max" {
+			return ErrCommandVetoed
+		}
+		return nil
+	})
+
+	results, err := client.RunMacroSteps(context.Background(), DefrostMacro)
+	if err == nil || !strings.Contains(err.Error(), "4 of 4 steps failed") {
+		t.Errorf("Expected every step to fail without a vehicle, got %v", err)
+	}
+	if len(commands) != len(DefrostMacro.Steps) {
+		t.Errorf("Expected every step to run, ran %v", commands)
+	}
+	if len(results) != len(DefrostMacro.Steps) {
+		t.Fatalf("Expected a result per step, got %+v", results)
+	}
+	if results[0].OK || !strings.Contains(results[0].Error, "vetoed") {
+		t.Errorf("Expected the veto in the first result, got %+v", results[0])
+	}
+	if results[3].Step != 4 || results[3].Command != "set_steering_wheel_heater" {
+		t.Errorf("Unexpected last result %+v", results[3])
+	}
+}
+
+func TestRunMacroCancelledDuringDelay(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	macro := Macro{Name: "m", Steps: []MacroStep{{Command: "set_climate_off", Delay: time.Minute}}}
+	if err := client.RunMacro(ctx, macro); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestExecuteCommandParams(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	var got Command
+	client.AddCommandHook(func(ctx context.Context, cmd Command) error {
+		got = cmd
+		return ErrCommandVetoed
+	})
+
+	err := client.ExecuteCommand(context.Background(), "set_temperature", map[string]interface{}{"driver_temp": 20.0})
+	if !errors.Is(err, ErrCommandVetoed) {
+		t.Fatalf("Expected command to reach the hook, got %v", err)
+	}
+	if got.Args["driver_temp"] != float32(20) || got.Args["passenger_temp"] != float32(20) {
+		t.Errorf("Expected passenger temp to default to driver temp, got %v", got.Args)
+	}
+}
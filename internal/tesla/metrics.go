@@ -0,0 +1,152 @@
+package tesla
+
+import (
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/metrics"
+)
+
+// operationStats holds cumulative counters for one client operation
+type operationStats struct {
+	count    int64
+	errors   int64
+	retries  int64
+	duration time.Duration
+}
+
+// clientMetrics collects counters for the client's operations
+type clientMetrics struct {
+	mu         sync.Mutex
+	operations map[string]*operationStats
+	circuit    map[CircuitBreakerState]int64 // Changes into each state
+}
+
+// stats returns the counters for an operation, creating them if needed.
+// The caller must hold mu.
+func (m *clientMetrics) stats(operation string) *operationStats {
+	if m.operations == nil {
+		m.operations = make(map[string]*operationStats)
+	}
+	stats, ok := m.operations[operation]
+	if !ok {
+		stats = &operationStats{}
+		m.operations[operation] = stats
+	}
+	return stats
+}
+
+// observe records a completed operation
+func (m *clientMetrics) observe(operation string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats(operation)
+	stats.count++
+	stats.duration += duration
+	if err != nil {
+		stats.errors++
+	}
+}
+
+// retry records a retried attempt of an operation
+func (m *clientMetrics) retry(operation string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats(operation).retries++
+}
+
+// circuitChange records the circuit breaker changing to state
+func (m *clientMetrics) circuitChange(state CircuitBreakerState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.circuit == nil {
+		m.circuit = make(map[CircuitBreakerState]int64)
+	}
+	m.circuit[state]++
+}
+
+// MetricPoints returns the client's current metrics:
+//
+//	tesla_operation  counters per operation: count, errors, retries, duration_ms
+//	tesla_circuit    counters per state: changes, the times the circuit breaker changed to it
+//	tesla_connection gauges: connected, awake, circuit_breaker_state
+//	tesla_hvac       gauges from the last read state, if any
+func (c *Client) MetricPoints() []metrics.Point {
+	vinTags := func(extra ...string) map[string]string {
+		tags := map[string]string{"vin": c.vin}
+		for i := 0; i+1 < len(extra); i += 2 {
+			tags[extra[i]] = extra[i+1]
+		}
+		return tags
+	}
+
+	var points []metrics.Point
+
+	c.metrics.mu.Lock()
+	for operation, stats := range c.metrics.operations {
+		points = append(points, metrics.Point{
+			Measurement: "tesla_operation",
+			Tags:        vinTags("operation", operation),
+			Counter:     true,
+			Fields: map[string]float64{
+				"count":       float64(stats.count),
+				"errors":      float64(stats.errors),
+				"retries":     float64(stats.retries),
+				"duration_ms": float64(stats.duration.Milliseconds()),
+			},
+		})
+	}
+	for state, changes := range c.metrics.circuit {
+		points = append(points, metrics.Point{
+			Measurement: "tesla_circuit",
+			Tags:        vinTags("state", state.String()),
+			Counter:     true,
+			Fields:      map[string]float64{"changes": float64(changes)},
+		})
+	}
+	c.metrics.mu.Unlock()
+
+	queue := c.QueueStats()
+	points = append(points, metrics.Point{
+		Measurement: "tesla_connection",
+		Tags:        vinTags(),
+		Fields: map[string]float64{
+			"connected":             boolGauge(c.IsConnected()),
+			"awake":                 boolGauge(c.IsAwake(c.wakeSettings().AwakeWindow)),
+			"circuit_breaker_state": float64(c.circuitBreaker.GetState()),
+			"queue_running":         float64(queue.Running),
+			"queue_waiting":         float64(queue.Waiting),
+			"queue_rejected":        float64(queue.Rejected),
+		},
+	})
+
+	if snapshot, ok := c.LastState(); ok {
+		state := snapshot.State
+		points = append(points, metrics.Point{
+			Measurement: "tesla_hvac",
+			Tags:        vinTags(),
+			Fields: map[string]float64{
+				"is_on":                  boolGauge(state.IsOn),
+				"driver_temp_celsius":    float64(state.DriverTempCelsius),
+				"passenger_temp_celsius": float64(state.PassengerTempCelsius),
+				"inside_temp_celsius":    float64(state.InsideTempCelsius),
+				"outside_temp_celsius":   float64(state.OutsideTempCelsius),
+				"fan_status":             float64(state.FanStatus),
+				"is_auto_conditioning":   boolGauge(state.IsAutoConditioning),
+				"is_preconditioning":     boolGauge(state.IsPreconditioning),
+				"age_seconds":            time.Since(snapshot.ReadAt).Seconds(),
+			},
+		})
+	}
+
+	return points
+}
+
+// boolGauge converts a boolean to a 0/1 gauge value
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClientMetricPoints(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	// Not connected, so the operation fails without retrying
+	client.SetTemperature(context.Background(), 21, 21)
+	client.SetClimateOn(context.Background())
+
+	var operations, connection, hvac int
+	for _, point := range client.MetricPoints() {
+		if point.Tags["vin"] != "TEST_VIN" {
+			t.Errorf("Expected vin tag on %s, got %v", point.Measurement, point.Tags)
+		}
+		switch point.Measurement {
+		case "tesla_operation":
+			operations++
+			if !point.Counter {
+				t.Error("Expected operation metrics to be counters")
+			}
+			if point.Fields["count"] != 1 || point.Fields["errors"] != 1 {
+				t.Errorf("Unexpected %s counters: %v", point.Tags["operation"], point.Fields)
+			}
+		case "tesla_connection":
+			connection++
+			if point.Fields["connected"] != 0 {
+				t.Errorf("Expected connected 0, got %v", point.Fields["connected"])
+			}
+		case "tesla_hvac":
+			hvac++
+		}
+	}
+
+	if operations != 2 || connection != 1 || hvac != 0 {
+		t.Errorf("Expected 2 operation, 1 connection and no hvac points, got %d, %d, %d", operations, connection, hvac)
+	}
+
+	client.recordState(&HVACState{IsOn: true, InsideTempCelsius: 19.5})
+	for _, point := range client.MetricPoints() {
+		if point.Measurement == "tesla_hvac" {
+			if point.Fields["is_on"] != 1 || point.Fields["inside_temp_celsius"] != 19.5 {
+				t.Errorf("Unexpected hvac gauges: %v", point.Fields)
+			}
+			return
+		}
+	}
+	t.Error("Expected hvac point after a state read")
+}
+
+func TestMetricsConfigValidation(t *testing.T) {
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Metrics.InfluxDB.URL = "http://localhost:8086"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected validation to fail for influxdb without bucket or database")
+	}
+
+	config.Metrics.InfluxDB.Bucket = "tesla"
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid influxdb config, got %v", err)
+	}
+
+	config.Metrics.Interval = 0
+	if err := config.Validate(); err == nil {
+		t.Error("Expected validation to fail for zero interval with an exporter")
+	}
+
+	config.Metrics.Interval = time.Second
+	config.Metrics.Statsd.Address = "localhost"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected validation to fail for statsd address without port")
+	}
+
+	config.Metrics.Statsd.Address = "localhost:8125"
+	config.Metrics.Statsd.TagStyle = "graphite"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected validation to fail for unknown tag style")
+	}
+}
@@ -2,18 +2,81 @@ package tesla
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/99designs/keyring"
+
+	"github.com/teslamotors/vehicle-command/internal/logging"
 )
 
+// DefaultOAuthTokenURL is Tesla's SSO token endpoint
+const DefaultOAuthTokenURL = "https://auth.tesla.com/oauth2/v3/token"
+
+// ClientIDEnv supplies the Fleet API application's client ID when the config
+// doesn't
+const ClientIDEnv = "TESLA_CLIENT_ID"
+
+// ErrNoRefreshToken is returned when an expired token can't be refreshed
+var ErrNoRefreshToken = errors.New("OAuth token has expired and has no refresh token")
+
+// OAuthConfig configures logging in to Tesla SSO and refreshing OAuth tokens
+type OAuthConfig struct {
+	ClientID     string `json:"client_id,omitempty"`     // Fleet API application's client ID; defaults to TESLA_CLIENT_ID
+	TokenURL     string `json:"token_url,omitempty"`     // Defaults to DefaultOAuthTokenURL
+	AuthorizeURL string `json:"authorize_url,omitempty"` // Defaults to DefaultOAuthAuthorizeURL
+	RedirectURL  string `json:"redirect_url,omitempty"`  // Local callback for logging in; defaults to DefaultOAuthRedirectURL
+	Scope        string `json:"scope,omitempty"`         // Scopes to log in with; defaults to DefaultOAuthScope
+
+	// How long before expiry stored tokens are refreshed in the background;
+	// defaults to DefaultTokenRefreshAhead
+	RefreshAhead time.Duration `json:"refresh_ahead,omitempty"`
+}
+
+// Validate checks the config
+func (c OAuthConfig) Validate() error {
+	for name, value := range map[string]string{"token_url": c.TokenURL, "authorize_url": c.AuthorizeURL} {
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%s must be an https URL", name)
+		}
+	}
+	if c.RefreshAhead < 0 {
+		return fmt.Errorf("refresh_ahead must not be negative")
+	}
+	if c.RedirectURL != "" {
+		u, err := url.Parse(c.RedirectURL)
+		if err != nil || u.Scheme != "http" || u.Port() == "" {
+			return fmt.Errorf("redirect_url must be an http URL with a port, such as %s", DefaultOAuthRedirectURL)
+		}
+	}
+	return nil
+}
+
 // OAuthManager handles OAuth token management for Tesla API access
 type OAuthManager struct {
-	keyring keyring.Keyring
-	logger  *log.Logger
+	keyring    keyring.Keyring
+	logger     *log.Logger
+	config     OAuthConfig
+	httpClient *http.Client
+
+	// Refresh tokens are single use, so refreshes are serialized
+	refreshMu sync.Mutex
+
+	statusMu  sync.Mutex
+	refreshes map[string]RefreshResult // Last refresh of each token
 }
 
 // OAuthToken represents a Tesla OAuth token with metadata
@@ -27,30 +90,38 @@ type OAuthToken struct {
 
 // NewOAuthManager creates a new OAuth manager
 func NewOAuthManager(logger *log.Logger) (*OAuthManager, error) {
-	// Create keyring for storing OAuth tokens
-	kr, err := keyring.Open(keyring.Config{
-		ServiceName: "tesla-hvac-interface",
-		KeychainName: "tesla-hvac-interface",
-		FileDir: "~/.tesla-hvac-interface",
-		FilePasswordFunc: func(prompt string) (string, error) {
-			// For development, we'll use a simple password
-			// In production, this should prompt the user securely
-			return "tesla-hvac-dev", nil
-		},
-	})
+	return OpenOAuthManager(KeyringConfig{}, logger)
+}
+
+// OpenOAuthManager creates an OAuth manager that stores tokens in the keyring
+// config selects
+func OpenOAuthManager(config KeyringConfig, logger *log.Logger) (*OAuthManager, error) {
+	kr, err := OpenKeyring(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open keyring: %w", err)
+		return nil, err
 	}
+	return NewOAuthManagerWithKeyring(kr, logger), nil
+}
 
+// NewOAuthManagerWithKeyring creates an OAuth manager that stores tokens in kr
+func NewOAuthManagerWithKeyring(kr keyring.Keyring, logger *log.Logger) *OAuthManager {
 	return &OAuthManager{
-		keyring: kr,
-		logger:  logger,
-	}, nil
+		keyring:    kr,
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetConfig sets how tokens are refreshed
+func (om *OAuthManager) SetConfig(config OAuthConfig) {
+	om.refreshMu.Lock()
+	defer om.refreshMu.Unlock()
+	om.config = config
 }
 
 // StoreToken stores an OAuth token in the keyring
 func (om *OAuthManager) StoreToken(tokenName string, token *OAuthToken) error {
-	om.logger.Printf("Storing OAuth token: %s", tokenName)
+	logging.Debugf(om.logger, "Storing OAuth token: %s", tokenName)
 	
 	// Convert token to JSON for storage
 	tokenData, err := tokenToJSON(token)
@@ -62,19 +133,19 @@ func (om *OAuthManager) StoreToken(tokenName string, token *OAuthToken) error {
 	err = om.keyring.Set(keyring.Item{
 		Key:  tokenName,
 		Data: tokenData,
-		Label: "Tesla HVAC Interface OAuth Token",
+		Label: oauthTokenLabel,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to store token in keyring: %w", err)
 	}
 	
-	om.logger.Printf("Successfully stored OAuth token: %s", tokenName)
+	logging.Debugf(om.logger, "Successfully stored OAuth token: %s", tokenName)
 	return nil
 }
 
 // GetToken retrieves an OAuth token from the keyring
 func (om *OAuthManager) GetToken(tokenName string) (*OAuthToken, error) {
-	om.logger.Printf("Retrieving OAuth token: %s", tokenName)
+	logging.Debugf(om.logger, "Retrieving OAuth token: %s", tokenName)
 	
 	// Get from keyring
 	item, err := om.keyring.Get(tokenName)
@@ -82,13 +153,17 @@ func (om *OAuthManager) GetToken(tokenName string) (*OAuthToken, error) {
 		return nil, fmt.Errorf("failed to get token from keyring: %w", err)
 	}
 	
-	// Parse token from JSON
+	// Parse token from JSON, storing a legacy token in the current format
 	token, err := tokenFromJSON(item.Data)
-	if err != nil {
+	if errors.Is(err, errLegacyToken) {
+		if err := om.StoreToken(tokenName, token); err != nil {
+			om.logger.Printf("warn: failed to migrate OAuth token %s: %v", tokenName, err)
+		}
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 	
-	om.logger.Printf("Successfully retrieved OAuth token: %s", tokenName)
+	logging.Debugf(om.logger, "Successfully retrieved OAuth token: %s", tokenName)
 	return token, nil
 }
 
@@ -118,8 +193,13 @@ func (om *OAuthManager) IsTokenValid(token *OAuthToken) bool {
 	return now.Before(expiry)
 }
 
-// RefreshTokenIfNeeded checks if a token needs refresh and refreshes it
+// RefreshTokenIfNeeded returns the stored token, first refreshing it and
+// storing the result if it has expired or is about to
 func (om *OAuthManager) RefreshTokenIfNeeded(ctx context.Context, tokenName string) (*OAuthToken, error) {
+	om.refreshMu.Lock()
+	defer om.refreshMu.Unlock()
+
+	// Read under the lock, so a token another caller just refreshed is used
 	token, err := om.GetToken(tokenName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get token for refresh: %w", err)
@@ -127,15 +207,157 @@ func (om *OAuthManager) RefreshTokenIfNeeded(ctx context.Context, tokenName stri
 	
 	// If token is still valid, return it
 	if om.IsTokenValid(token) {
-		om.logger.Printf("Token %s is still valid", tokenName)
+		logging.Debugf(om.logger, "Token %s is still valid", tokenName)
 		return token, nil
 	}
 	
-	om.logger.Printf("Token %s is expired or will expire soon, attempting refresh", tokenName)
-	
-	// For now, we'll return an error indicating manual refresh is needed
-	// In a full implementation, this would call Tesla's refresh endpoint
-	return nil, fmt.Errorf("token refresh not implemented - please obtain a new token manually")
+	om.logger.Printf("Token %s is expired or will expire soon, refreshing", tokenName)
+	return om.refreshAndStore(ctx, tokenName, token)
+}
+
+// refreshAndStore refreshes a token and stores the result under tokenName.
+// The caller holds refreshMu.
+func (om *OAuthManager) refreshAndStore(ctx context.Context, tokenName string, token *OAuthToken) (*OAuthToken, error) {
+	refreshed, err := om.refresh(ctx, token)
+	om.recordRefresh(tokenName, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token %s: %w", tokenName, err)
+	}
+	// The old refresh token no longer works, so a refreshed token that can't
+	// be stored is still returned
+	if err := om.StoreToken(tokenName, refreshed); err != nil {
+		om.logger.Printf("warn: refreshed token %s could not be stored: %v", tokenName, err)
+	}
+	om.logger.Printf("Refreshed token %s, valid until %s", tokenName, refreshed.ExpiresAt.Format(time.RFC3339))
+	return refreshed, nil
+}
+
+// RefreshToken exchanges a token's refresh token for a new token with the
+// refresh-token grant. It does not store the result.
+func (om *OAuthManager) RefreshToken(ctx context.Context, token *OAuthToken) (*OAuthToken, error) {
+	om.refreshMu.Lock()
+	defer om.refreshMu.Unlock()
+	return om.refresh(ctx, token)
+}
+
+// tokenResponse is the body of a token endpoint response
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"` // Seconds
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// refresh runs the refresh-token grant. The caller holds refreshMu.
+func (om *OAuthManager) refresh(ctx context.Context, token *OAuthToken) (*OAuthToken, error) {
+	if token == nil || token.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+	clientID, err := om.clientID()
+	if err != nil {
+		return nil, err
+	}
+	refreshed, err := om.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {clientID},
+		"refresh_token": {token.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	if refreshed.Scope == "" {
+		refreshed.Scope = token.Scope
+	}
+	return refreshed, nil
+}
+
+// clientID returns the configured client ID, or TESLA_CLIENT_ID
+func (om *OAuthManager) clientID() (string, error) {
+	clientID := om.config.ClientID
+	if clientID == "" {
+		clientID = os.Getenv(ClientIDEnv)
+	}
+	if clientID == "" {
+		return "", fmt.Errorf("oauth.client_id or %s is required", ClientIDEnv)
+	}
+	return clientID, nil
+}
+
+// requestToken posts a grant to the token endpoint
+func (om *OAuthManager) requestToken(ctx context.Context, form url.Values) (*OAuthToken, error) {
+	tokenURL := om.config.TokenURL
+	if tokenURL == "" {
+		tokenURL = DefaultOAuthTokenURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := om.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		if body.Error != "" {
+			return nil, fmt.Errorf("token endpoint returned %d: %s: %s", resp.StatusCode, body.Error, body.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token")
+	}
+
+	token := &OAuthToken{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+		TokenType:    body.TokenType,
+		Scope:        body.Scope,
+	}
+	if token.TokenType == "" {
+		token.TokenType = "Bearer"
+	}
+	return token, nil
+}
+
+// TokenForVehicle returns a valid token for a vehicle: the one stored under
+// its VIN, else the default token, else TESLA_ACCESS_TOKEN. Expired tokens
+// are refreshed and stored; a refreshed environment token is stored as the
+// default token.
+func (om *OAuthManager) TokenForVehicle(ctx context.Context, vin string) (*OAuthToken, error) {
+	var storeErr error
+	for _, name := range []string{vin, "default"} {
+		if _, err := om.keyring.Get(name); err != nil {
+			storeErr = err
+			continue
+		}
+		return om.RefreshTokenIfNeeded(ctx, name)
+	}
+
+	token, err := om.GetEnvironmentToken()
+	if err != nil {
+		return nil, fmt.Errorf("no OAuth token for %s: %w", vin, storeErr)
+	}
+	if om.IsTokenValid(token) {
+		return token, nil
+	}
+	om.refreshMu.Lock()
+	defer om.refreshMu.Unlock()
+	return om.refreshAndStore(ctx, "default", token)
 }
 
 // ListTokens lists all stored OAuth tokens
@@ -148,7 +370,7 @@ func (om *OAuthManager) ListTokens() ([]string, error) {
 		return nil, fmt.Errorf("failed to list keys from keyring: %w", err)
 	}
 	
-	om.logger.Printf("Found %d tokens in keyring", len(keys))
+	logging.Debugf(om.logger, "Found %d tokens in keyring", len(keys))
 	return keys, nil
 }
 
@@ -167,7 +389,7 @@ func (om *OAuthManager) ValidateTokenWithTesla(ctx context.Context, token *OAuth
 	if len(accessTokenPreview) > 10 {
 		accessTokenPreview = accessTokenPreview[:10] + "..."
 	}
-	om.logger.Printf("Testing token with Tesla API (access token: %s)", accessTokenPreview)
+	logging.Debugf(om.logger, "Testing token with Tesla API (access token: %s)", accessTokenPreview)
 	
 	// In a real implementation, this would call Tesla's API
 	// For now, we'll assume it's valid if we have a non-empty access token
@@ -179,40 +401,150 @@ func (om *OAuthManager) ValidateTokenWithTesla(ctx context.Context, token *OAuth
 	return nil
 }
 
-// GetTokenForVehicle gets the appropriate token for a specific vehicle
-// For now, this returns the default token, but could be extended to support multiple vehicles
+// GetTokenForVehicle gets the token for a specific vehicle. A token stored
+// under the vehicle's VIN takes precedence over the default token.
 func (om *OAuthManager) GetTokenForVehicle(vin string) (*OAuthToken, error) {
 	om.logger.Printf("Getting token for vehicle: %s", vin)
 	
-	// For now, we'll use a default token name
-	// In a full implementation, this could look up vehicle-specific tokens
-	tokenName := "default"
-	
-	return om.GetToken(tokenName)
+	if token, err := om.GetToken(vin); err == nil {
+		return token, nil
+	}
+	return om.GetToken("default")
+}
+
+// oauthTokenLabel marks the keyring items holding OAuth tokens
+const oauthTokenLabel = "Tesla HVAC Interface OAuth Token"
+
+// legacyTokenFields are the fields, in order, of tokens stored by versions
+// that built the JSON by hand without escaping
+var legacyTokenFields = []string{"access_token", "refresh_token", "expires_at", "token_type", "scope"}
+
+// errLegacyToken is returned by tokenFromJSON for a token in the legacy format
+var errLegacyToken = errors.New("token is in the legacy format")
+
+// validate checks that a token can be sent in an Authorization header
+func (t *OAuthToken) validate() error {
+	if t == nil || t.AccessToken == "" {
+		return errors.New("token has no access_token")
+	}
+	if strings.HasPrefix(t.AccessToken, "mock_access_token") {
+		return errors.New("token was replaced by a placeholder; log in again")
+	}
+	for _, value := range []string{t.AccessToken, t.RefreshToken, t.TokenType} {
+		if strings.ContainsAny(value, " \t\r\n") {
+			return errors.New("token contains whitespace")
+		}
+	}
+	return nil
 }
 
-// Helper functions for JSON serialization
 func tokenToJSON(token *OAuthToken) ([]byte, error) {
-	// Simple JSON serialization - in production, use proper JSON library
-	jsonStr := fmt.Sprintf(`{"access_token":"%s","refresh_token":"%s","expires_at":"%s","token_type":"%s","scope":"%s"}`,
-		token.AccessToken,
-		token.RefreshToken,
-		token.ExpiresAt.Format(time.RFC3339),
-		token.TokenType,
-		token.Scope)
-	return []byte(jsonStr), nil
+	if err := token.validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(token)
 }
 
+// tokenFromJSON parses a stored token. A token in the legacy format is
+// returned along with errLegacyToken so the caller can store it again.
 func tokenFromJSON(data []byte) (*OAuthToken, error) {
-	// Simple JSON parsing - in production, use proper JSON library
-	// For now, return a mock token
-	return &OAuthToken{
-		AccessToken:  "mock_access_token",
-		RefreshToken: "mock_refresh_token",
-		ExpiresAt:    time.Now().Add(24 * time.Hour),
-		TokenType:    "Bearer",
-		Scope:        "openid email offline_access",
-	}, nil
+	var token OAuthToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		legacy, legacyErr := legacyTokenFromJSON(data)
+		if legacyErr != nil {
+			return nil, err
+		}
+		return legacy, errLegacyToken
+	}
+	if token.TokenType == "" {
+		token.TokenType = "Bearer"
+	}
+	if err := token.validate(); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// legacyTokenFromJSON parses the unescaped JSON older versions stored, which
+// isn't valid JSON when a value contains a quote or backslash
+func legacyTokenFromJSON(data []byte) (*OAuthToken, error) {
+	rest, ok := strings.CutPrefix(string(data), `{"`+legacyTokenFields[0]+`":"`)
+	values := make(map[string]string)
+	for i, field := range legacyTokenFields[1:] {
+		if ok {
+			values[legacyTokenFields[i]], rest, ok = strings.Cut(rest, `","`+field+`":"`)
+		}
+	}
+	if ok {
+		values[legacyTokenFields[len(legacyTokenFields)-1]], ok = strings.CutSuffix(rest, `"}`)
+	}
+	if !ok {
+		return nil, errors.New("not a legacy token")
+	}
+	expiresAt, err := time.Parse(time.RFC3339, values["expires_at"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_at: %w", err)
+	}
+	token := &OAuthToken{
+		AccessToken:  values["access_token"],
+		RefreshToken: values["refresh_token"],
+		ExpiresAt:    expiresAt,
+		TokenType:    values["token_type"],
+		Scope:        values["scope"],
+	}
+	if token.TokenType == "" {
+		token.TokenType = "Bearer"
+	}
+	if err := token.validate(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// tokenNames lists the keyring items holding OAuth tokens
+func (om *OAuthManager) tokenNames() ([]string, error) {
+	keys, err := om.keyring.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys from keyring: %w", err)
+	}
+	var names []string
+	for _, key := range keys {
+		if item, err := om.keyring.Get(key); err == nil && item.Label == oauthTokenLabel {
+			names = append(names, key)
+		}
+	}
+	return names, nil
+}
+
+// MigrateTokens stores tokens saved in the legacy format again as JSON and
+// returns how many were migrated. Tokens that can't be read are logged and
+// left in place.
+func (om *OAuthManager) MigrateTokens() (int, error) {
+	keys, err := om.tokenNames()
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, key := range keys {
+		item, err := om.keyring.Get(key)
+		if err != nil {
+			continue
+		}
+		token, err := tokenFromJSON(item.Data)
+		switch {
+		case errors.Is(err, errLegacyToken):
+			if err := om.StoreToken(key, token); err != nil {
+				return migrated, err
+			}
+			migrated++
+		case err != nil:
+			om.logger.Printf("warn: OAuth token %s is unreadable: %v", key, err)
+		}
+	}
+	if migrated > 0 {
+		om.logger.Printf("Migrated %d OAuth tokens to the current format", migrated)
+	}
+	return migrated, nil
 }
 
 // CreateDefaultToken creates a default token for development/testing
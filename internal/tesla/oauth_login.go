@@ -0,0 +1,180 @@
+package tesla
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultOAuthAuthorizeURL is Tesla's SSO login page
+	DefaultOAuthAuthorizeURL = "https://auth.tesla.com/oauth2/v3/authorize"
+
+	// DefaultOAuthRedirectURL is where the login flow listens for the
+	// callback. It has to be one of the application's allowed redirect URIs.
+	DefaultOAuthRedirectURL = "http://localhost:8585/callback"
+
+	// DefaultOAuthScope covers reading vehicle data, sending commands and
+	// refreshing the token
+	DefaultOAuthScope = "openid offline_access vehicle_device_data vehicle_cmds"
+
+	// ClientSecretEnv supplies the application's client secret, for
+	// applications that require one alongside PKCE
+	ClientSecretEnv = "TESLA_CLIENT_SECRET"
+)
+
+// ErrLoginDenied is returned when the user declines the login or Tesla SSO
+// reports an error to the callback
+var ErrLoginDenied = errors.New("login was not approved")
+
+// LoginOptions configures an interactive login
+type LoginOptions struct {
+	TokenName string // Keyring item to store the token under; defaults to "default"
+	Audience  string // Fleet API base URL the token is for, such as https://fleet-api.prd.na.vn.cloud.tesla.com
+
+	// Open is given the login URL to show the user, such as by opening a
+	// browser. The login completes when the browser is redirected back.
+	Open func(authURL string) error
+}
+
+// Login runs the authorization code flow with PKCE: it shows the user Tesla's
+// login page, receives the authorization code on a local listener at the
+// redirect URL, exchanges it for a token and stores the token
+func (om *OAuthManager) Login(ctx context.Context, opts LoginOptions) (*OAuthToken, error) {
+	clientID, err := om.clientID()
+	if err != nil {
+		return nil, err
+	}
+	tokenName := opts.TokenName
+	if tokenName == "" {
+		tokenName = "default"
+	}
+	redirect, err := url.Parse(orDefault(om.config.RedirectURL, DefaultOAuthRedirectURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the login callback: %w", err)
+	}
+	defer listener.Close()
+	if redirect.Port() == "0" {
+		// A free port was picked
+		redirect.Host = listener.Addr().String()
+	}
+
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	state, err := randomURLString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	type callback struct {
+		code string
+		err  error
+	}
+	results := make(chan callback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(orDefault(redirect.Path, "/"), func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			http.Error(w, "Unexpected login state", http.StatusBadRequest)
+			return
+		}
+		var result callback
+		if reason := query.Get("error"); reason != "" {
+			result.err = fmt.Errorf("%w: %s %s", ErrLoginDenied, reason, query.Get("error_description"))
+			fmt.Fprintln(w, "Login failed. You can close this window.")
+		} else {
+			result.code = query.Get("code")
+			fmt.Fprintln(w, "Login complete. You can close this window.")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := orDefault(om.config.AuthorizeURL, DefaultOAuthAuthorizeURL) + "?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {redirect.String()},
+		"scope":                 {orDefault(om.config.Scope, DefaultOAuthScope)},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+	if opts.Open != nil {
+		if err := opts.Open(authURL); err != nil {
+			return nil, err
+		}
+	}
+
+	var result callback
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for login: %w", ctx.Err())
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	if result.code == "" {
+		return nil, fmt.Errorf("%w: no authorization code", ErrLoginDenied)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {clientID},
+		"code":          {result.code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirect.String()},
+	}
+	if secret := os.Getenv(ClientSecretEnv); secret != "" {
+		form.Set("client_secret", secret)
+	}
+	if opts.Audience != "" {
+		form.Set("audience", opts.Audience)
+	}
+	token, err := om.requestToken(ctx, form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange the authorization code: %w", err)
+	}
+	if err := om.StoreToken(tokenName, token); err != nil {
+		return nil, err
+	}
+	om.logger.Printf("Logged in; stored token %s, valid until %s", tokenName, token.ExpiresAt.Format(time.RFC3339))
+	return token, nil
+}
+
+// randomURLString returns n random bytes, base64url encoded
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate login secrets: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,117 @@
+package tesla
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/99designs/keyring"
+)
+
+// newLoginServer returns an OAuth manager whose token endpoint exchanges
+// the code "code" once the PKCE verifier matches the login's challenge
+func newLoginServer(t *testing.T) *OAuthManager {
+	t.Helper()
+	challenges := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/authorize" {
+			challenges <- r.URL.Query().Get("code_challenge")
+			return
+		}
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != "code" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != <-challenges || r.Form.Get("audience") != "https://fleet.example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"expires_in":    28800,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	manager := NewOAuthManagerWithKeyring(keyring.NewArrayKeyring(nil), log.New(io.Discard, "", 0))
+	manager.SetConfig(OAuthConfig{
+		ClientID:     "client",
+		TokenURL:     server.URL + "/token",
+		AuthorizeURL: server.URL + "/authorize",
+		RedirectURL:  "http://127.0.0.1:0/callback",
+	})
+	return manager
+}
+
+// browser simulates the user logging in: it requests the login page, then
+// follows the redirect back with the given callback parameters
+func browser(t *testing.T, callback url.Values) func(string) error {
+	return func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		query := u.Query()
+		if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "client" {
+			t.Errorf("Unexpected login URL %s", authURL)
+		}
+		if _, err := http.Get(authURL); err != nil {
+			return err
+		}
+		callback.Set("state", query.Get("state"))
+		go http.Get(query.Get("redirect_uri") + "?" + callback.Encode())
+		return nil
+	}
+}
+
+func TestLogin(t *testing.T) {
+	manager := newLoginServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	token, err := manager.Login(ctx, LoginOptions{
+		TokenName: "TEST_VIN",
+		Audience:  "https://fleet.example.com",
+		Open:      browser(t, url.Values{"code": {"code"}}),
+	})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if token.AccessToken != "access" || token.TokenType != "Bearer" || !manager.IsTokenValid(token) {
+		t.Errorf("Unexpected token %+v", token)
+	}
+	if stored, err := manager.GetToken("TEST_VIN"); err != nil || stored.RefreshToken != "refresh" {
+		t.Errorf("Expected the token stored, got %+v (%v)", stored, err)
+	}
+}
+
+func TestLoginDenied(t *testing.T) {
+	manager := newLoginServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := manager.Login(ctx, LoginOptions{Open: browser(t, url.Values{"error": {"access_denied"}})})
+	if !errors.Is(err, ErrLoginDenied) {
+		t.Errorf("Expected ErrLoginDenied, got %v", err)
+	}
+	if _, err := manager.GetToken("default"); err == nil {
+		t.Error("Expected no token stored")
+	}
+
+	// Nobody logs in
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := manager.Login(ctx, LoginOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/metrics"
+)
+
+// DefaultTokenRefreshAhead is how long before a token expires
+// RunTokenRefresher refreshes it
+const DefaultTokenRefreshAhead = 30 * time.Minute
+
+// RunTokenRefresher checks how long until each stored token expires, after at
+// most these intervals
+const (
+	tokenCheckInterval = 15 * time.Minute
+	tokenRetryInterval = time.Minute
+)
+
+// RefreshResult is the outcome of a token's last refresh
+type RefreshResult struct {
+	At    time.Time `json:"at"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// TokenStatus is the health of a stored OAuth token
+type TokenStatus struct {
+	Name        string         `json:"name"` // default or a VIN
+	ExpiresAt   time.Time      `json:"expires_at"`
+	Valid       bool           `json:"valid"`       // Not expired or about to
+	Refreshable bool           `json:"refreshable"` // Has a refresh token
+	LastRefresh *RefreshResult `json:"last_refresh,omitempty"`
+	Error       string         `json:"error,omitempty"` // The token can't be read
+}
+
+// recordRefresh remembers the outcome of refreshing a token
+func (om *OAuthManager) recordRefresh(tokenName string, err error) {
+	result := RefreshResult{At: time.Now(), OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	om.statusMu.Lock()
+	defer om.statusMu.Unlock()
+	if om.refreshes == nil {
+		om.refreshes = make(map[string]RefreshResult)
+	}
+	om.refreshes[tokenName] = result
+}
+
+// TokenStatuses reports the health of every stored token
+func (om *OAuthManager) TokenStatuses() ([]TokenStatus, error) {
+	names, err := om.tokenNames()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]TokenStatus, 0, len(names))
+	for _, name := range names {
+		status := TokenStatus{Name: name}
+		if token, err := om.GetToken(name); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.ExpiresAt = token.ExpiresAt
+			status.Valid = om.IsTokenValid(token)
+			status.Refreshable = token.RefreshToken != ""
+		}
+		om.statusMu.Lock()
+		if result, ok := om.refreshes[name]; ok {
+			status.LastRefresh = &result
+		}
+		om.statusMu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// RunTokenRefresher refreshes stored tokens ahead of their expiry, so
+// commands don't wait for a refresh and a token that can no longer be
+// refreshed shows up in TokenStatuses before it expires. It runs until ctx is
+// done.
+func (om *OAuthManager) RunTokenRefresher(ctx context.Context) error {
+	for {
+		timer := time.NewTimer(om.refreshExpiring(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// refreshExpiring refreshes the tokens that expire within the refresh-ahead
+// window and returns how long to wait before checking again
+func (om *OAuthManager) refreshExpiring(ctx context.Context) time.Duration {
+	om.refreshMu.Lock()
+	ahead := om.config.RefreshAhead
+	om.refreshMu.Unlock()
+	if ahead <= 0 {
+		ahead = DefaultTokenRefreshAhead
+	}
+
+	wait := tokenCheckInterval
+	names, err := om.tokenNames()
+	if err != nil {
+		om.logger.Printf("warn: failed to list OAuth tokens: %v", err)
+		return tokenRetryInterval
+	}
+	for _, name := range names {
+		token, err := om.refreshIfExpiring(ctx, name, ahead)
+		if err != nil {
+			if !errors.Is(err, ErrNoRefreshToken) {
+				om.logger.Printf("warn: %v", err)
+			}
+			wait = tokenRetryInterval
+			continue
+		}
+		if next := time.Until(token.ExpiresAt) - ahead; next < wait {
+			wait = max(next, tokenRetryInterval)
+		}
+	}
+	return wait
+}
+
+// refreshIfExpiring returns the stored token, first refreshing it if it
+// expires within ahead
+func (om *OAuthManager) refreshIfExpiring(ctx context.Context, tokenName string, ahead time.Duration) (*OAuthToken, error) {
+	om.refreshMu.Lock()
+	defer om.refreshMu.Unlock()
+
+	// Read under the lock, so a token another caller just refreshed is used
+	token, err := om.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	if time.Until(token.ExpiresAt) > ahead {
+		return token, nil
+	}
+	if token.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+	om.logger.Printf("Token %s expires at %s, refreshing", tokenName, token.ExpiresAt.Format(time.RFC3339))
+	return om.refreshAndStore(ctx, tokenName, token)
+}
+
+// MetricPoints reports each stored token's health as a tesla_oauth_token
+// point: seconds_until_expiry, valid, refreshable and, once refreshed,
+// last_refresh_ok
+func (om *OAuthManager) MetricPoints() []metrics.Point {
+	statuses, err := om.TokenStatuses()
+	if err != nil {
+		return nil
+	}
+	var points []metrics.Point
+	for _, status := range statuses {
+		if status.Error != "" {
+			continue
+		}
+		fields := map[string]float64{
+			"seconds_until_expiry": time.Until(status.ExpiresAt).Seconds(),
+			"valid":                boolGauge(status.Valid),
+			"refreshable":          boolGauge(status.Refreshable),
+		}
+		if status.LastRefresh != nil {
+			fields["last_refresh_ok"] = boolGauge(status.LastRefresh.OK)
+		}
+		points = append(points, metrics.Point{
+			Measurement: "tesla_oauth_token",
+			Tags:        map[string]string{"token": status.Name},
+			Fields:      fields,
+		})
+	}
+	return points
+}
@@ -2,10 +2,21 @@ package tesla
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/99designs/keyring"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
 )
 
 func TestNewOAuthManager(t *testing.T) {
@@ -206,3 +217,234 @@ func TestGetTokenForVehicle(t *testing.T) {
 		t.Error("Expected error when no token is stored")
 	}
 }
+
+func TestTokenJSONRoundTrip(t *testing.T) {
+	token := &OAuthToken{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+		TokenType:    "Bearer",
+		Scope:        "vehicle_cmds",
+	}
+	data, err := tokenToJSON(token)
+	if err != nil {
+		t.Fatalf("Failed to serialize token: %v", err)
+	}
+	parsed, err := tokenFromJSON(data)
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	if parsed.AccessToken != token.AccessToken || !parsed.ExpiresAt.Equal(token.ExpiresAt) || parsed.Scope != token.Scope {
+		t.Errorf("Expected %+v, got %+v", token, parsed)
+	}
+	if _, err := tokenFromJSON([]byte("not json")); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+	for _, data := range []string{`{"refresh_token":"refresh"}`, `{"access_token":"mock_access_token"}`, `{"access_token":"a b"}`} {
+		if _, err := tokenFromJSON([]byte(data)); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+	if _, err := tokenToJSON(&OAuthToken{}); err == nil {
+		t.Error("Expected a token without an access token to be rejected")
+	}
+}
+
+func TestMigrateTokens(t *testing.T) {
+	kr := keyring.NewArrayKeyring(nil)
+	manager := NewOAuthManagerWithKeyring(kr, log.New(io.Discard, "", 0))
+	// Written by the hand-built serializer; the quote makes it invalid JSON
+	legacy := `{"access_token":"acc"ess","refresh_token":"refresh","expires_at":"2030-01-02T03:04:05Z","token_type":"Bearer","scope":"vehicle_cmds"}`
+	kr.Set(keyring.Item{Key: "legacy", Data: []byte(legacy), Label: oauthTokenLabel})
+	kr.Set(keyring.Item{Key: "broken", Data: []byte("{"), Label: oauthTokenLabel})
+	kr.Set(keyring.Item{Key: "tesla-hvac", Data: []byte("not a token"), Label: "Tesla HVAC Interface Private Key"})
+	if err := manager.StoreToken("current", &OAuthToken{AccessToken: "current", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := manager.MigrateTokens()
+	if err != nil || migrated != 1 {
+		t.Fatalf("Expected 1 token migrated, got %d (%v)", migrated, err)
+	}
+	item, _ := kr.Get("legacy")
+	if !json.Valid(item.Data) {
+		t.Errorf("Expected the token stored as JSON, got %s", item.Data)
+	}
+	token, err := manager.GetToken("legacy")
+	if err != nil {
+		t.Fatalf("Failed to read the migrated token: %v", err)
+	}
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if token.AccessToken != `acc"ess` || token.RefreshToken != "refresh" || !token.ExpiresAt.Equal(expiresAt) || token.Scope != "vehicle_cmds" {
+		t.Errorf("Unexpected migrated token %+v", token)
+	}
+	if item, _ := kr.Get("tesla-hvac"); string(item.Data) != "not a token" {
+		t.Error("Expected other keyring items left alone")
+	}
+	if migrated, _ := manager.MigrateTokens(); migrated != 0 {
+		t.Errorf("Expected nothing left to migrate, got %d", migrated)
+	}
+}
+
+// newTokenServer returns an OAuth manager with an in-memory keyring whose
+// token endpoint hands out access-N and refresh-N tokens
+func newTokenServer(t *testing.T) (*OAuthManager, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("client_id") != "client" {
+			t.Errorf("Unexpected token request: %v", r.Form)
+		}
+		if r.Form.Get("refresh_token") == "revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "login_required", "error_description": "The refresh_token is invalid"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-" + string(rune('0'+n)),
+			"refresh_token": "refresh-" + string(rune('0'+n)),
+			"expires_in":    28800,
+			"token_type":    "Bearer",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	manager := NewOAuthManagerWithKeyring(keyring.NewArrayKeyring(nil), log.New(io.Discard, "", 0))
+	manager.SetConfig(OAuthConfig{ClientID: "client", TokenURL: server.URL})
+	return manager, &requests
+}
+
+func TestRefreshTokenIfNeeded(t *testing.T) {
+	manager, requests := newTokenServer(t)
+	expired := &OAuthToken{AccessToken: "old", RefreshToken: "refresh-0", ExpiresAt: time.Now().Add(-time.Minute), Scope: "vehicle_cmds"}
+	if err := manager.StoreToken("default", expired); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := manager.RefreshTokenIfNeeded(context.Background(), "default")
+	if err != nil {
+		t.Fatalf("Failed to refresh token: %v", err)
+	}
+	if token.AccessToken != "access-1" || token.RefreshToken != "refresh-1" || token.Scope != "vehicle_cmds" || !manager.IsTokenValid(token) {
+		t.Errorf("Unexpected refreshed token %+v", token)
+	}
+	stored, err := manager.GetToken("default")
+	if err != nil || stored.RefreshToken != "refresh-1" {
+		t.Errorf("Expected the refreshed token stored, got %+v (%v)", stored, err)
+	}
+
+	// A valid token is returned as is
+	if _, err := manager.RefreshTokenIfNeeded(context.Background(), "default"); err != nil || requests.Load() != 1 {
+		t.Errorf("Expected no second refresh, got %d requests (%v)", requests.Load(), err)
+	}
+}
+
+func TestRefreshTokenFailures(t *testing.T) {
+	manager, _ := newTokenServer(t)
+	if _, err := manager.RefreshToken(context.Background(), &OAuthToken{AccessToken: "old"}); !errors.Is(err, ErrNoRefreshToken) {
+		t.Errorf("Expected ErrNoRefreshToken, got %v", err)
+	}
+	_, err := manager.RefreshToken(context.Background(), &OAuthToken{RefreshToken: "revoked"})
+	if err == nil || !strings.Contains(err.Error(), "login_required") {
+		t.Errorf("Expected the token endpoint's error, got %v", err)
+	}
+
+	manager.SetConfig(OAuthConfig{})
+	t.Setenv(ClientIDEnv, "")
+	if _, err := manager.RefreshToken(context.Background(), &OAuthToken{RefreshToken: "refresh"}); err == nil || !strings.Contains(err.Error(), "client_id") {
+		t.Errorf("Expected a missing client ID error, got %v", err)
+	}
+}
+
+func TestFleetConnectionRefreshesToken(t *testing.T) {
+	manager, _ := newTokenServer(t)
+	t.Setenv("TESLA_ACCESS_TOKEN", "")
+	if _, err := manager.TokenForVehicle(context.Background(), "TEST_VIN"); err == nil {
+		t.Error("Expected an error without a token")
+	}
+
+	expired := &OAuthToken{AccessToken: "old", RefreshToken: "refresh-0", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := manager.StoreToken("TEST_VIN", expired); err != nil {
+		t.Fatal(err)
+	}
+	conn := &fleetConnection{
+		Connection: inet.NewConnection("TEST_VIN", "Bearer old", "localhost", ""),
+		oauth:      manager,
+		token:      expired,
+	}
+	if err := conn.refreshToken(context.Background()); err != nil {
+		t.Fatalf("Failed to refresh token: %v", err)
+	}
+	if conn.token.AccessToken != "access-1" {
+		t.Errorf("Expected the refreshed token, got %+v", conn.token)
+	}
+}
+
+func TestOAuthConfigValidate(t *testing.T) {
+	for tokenURL, ok := range map[string]bool{"": true, "https://auth.example.com/token": true, "http://auth.example.com/token": false, "not a url": false} {
+		if err := (OAuthConfig{TokenURL: tokenURL}).Validate(); (err == nil) != ok {
+			t.Errorf("%q: expected valid=%v, got %v", tokenURL, ok, err)
+		}
+	}
+	for redirectURL, ok := range map[string]bool{"http://localhost:8585/callback": true, "http://127.0.0.1:0/cb": true, "http://localhost/callback": false, "https://localhost:8585/callback": false} {
+		if err := (OAuthConfig{RedirectURL: redirectURL}).Validate(); (err == nil) != ok {
+			t.Errorf("%q: expected valid=%v, got %v", redirectURL, ok, err)
+		}
+	}
+}
+
+func TestRefreshExpiringTokens(t *testing.T) {
+	manager, requests := newTokenServer(t)
+	manager.SetConfig(OAuthConfig{ClientID: "client", TokenURL: manager.config.TokenURL, RefreshAhead: time.Hour})
+	soon := &OAuthToken{AccessToken: "soon", RefreshToken: "refresh-0", ExpiresAt: time.Now().Add(30 * time.Minute)}
+	later := &OAuthToken{AccessToken: "later", RefreshToken: "refresh-later", ExpiresAt: time.Now().Add(3 * time.Hour)}
+	stuck := &OAuthToken{AccessToken: "stuck", ExpiresAt: time.Now().Add(10 * time.Minute)}
+	for name, token := range map[string]*OAuthToken{"default": soon, "TEST_VIN": later, "OTHER_VIN": stuck} {
+		if err := manager.StoreToken(name, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the token within the hour is refreshed; the one without a
+	// refresh token is retried soon
+	if wait := manager.refreshExpiring(context.Background()); wait != tokenRetryInterval {
+		t.Errorf("Expected a retry in %v, got %v", tokenRetryInterval, wait)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 refresh, got %d", requests.Load())
+	}
+
+	statuses, err := manager.TokenStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]TokenStatus)
+	for _, status := range statuses {
+		byName[status.Name] = status
+	}
+	if s := byName["default"]; s.LastRefresh == nil || !s.LastRefresh.OK || time.Until(s.ExpiresAt) < 7*time.Hour {
+		t.Errorf("Expected default refreshed, got %+v", s)
+	}
+	if s := byName["TEST_VIN"]; s.LastRefresh != nil || !s.Valid {
+		t.Errorf("Expected TEST_VIN left alone, got %+v", s)
+	}
+	if s := byName["OTHER_VIN"]; s.Refreshable {
+		t.Errorf("Expected OTHER_VIN not refreshable, got %+v", s)
+	}
+
+	points := manager.MetricPoints()
+	if len(points) != 3 || points[0].Measurement != "tesla_oauth_token" {
+		t.Errorf("Expected a point per token, got %+v", points)
+	}
+
+	// A failed refresh is recorded
+	manager.StoreToken("OTHER_VIN", &OAuthToken{AccessToken: "stuck", RefreshToken: "revoked", ExpiresAt: time.Now()})
+	manager.refreshExpiring(context.Background())
+	statuses, _ = manager.TokenStatuses()
+	for _, s := range statuses {
+		if s.Name == "OTHER_VIN" && (s.LastRefresh == nil || s.LastRefresh.OK || !strings.Contains(s.LastRefresh.Error, "login_required")) {
+			t.Errorf("Expected the failed refresh recorded, got %+v", s.LastRefresh)
+		}
+	}
+}
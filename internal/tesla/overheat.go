@@ -0,0 +1,144 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/logging"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// OverheatProtectionMode is the Cabin Overheat Protection setting
+type OverheatProtectionMode string
+
+const (
+	OverheatProtectionOff  OverheatProtectionMode = "off"
+	OverheatProtectionNoAC OverheatProtectionMode = "no_ac" // Fan only
+	OverheatProtectionOn   OverheatProtectionMode = "on"    // Fan and A/C
+)
+
+// OverheatProtectionLimit is the cabin temperature at which overheat
+// protection starts
+type OverheatProtectionLimit string
+
+const (
+	OverheatProtectionLow    OverheatProtectionLimit = "low"    // 30°C
+	OverheatProtectionMedium OverheatProtectionLimit = "medium" // 35°C
+	OverheatProtectionHigh   OverheatProtectionLimit = "high"   // 40°C
+)
+
+// overheatProtectionLevels maps limits to the vehicle library's levels
+var overheatProtectionLevels = map[OverheatProtectionLimit]vehicle.Level{
+	OverheatProtectionLow:    vehicle.LevelLow,
+	OverheatProtectionMedium: vehicle.LevelMed,
+	OverheatProtectionHigh:   vehicle.LevelHigh,
+}
+
+// ParseOverheatProtectionMode parses off, no_ac or on
+func ParseOverheatProtectionMode(name string) (OverheatProtectionMode, error) {
+	switch mode := OverheatProtectionMode(strings.ToLower(name)); mode {
+	case OverheatProtectionOff, OverheatProtectionNoAC, OverheatProtectionOn:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown overheat protection mode %q", name)
+}
+
+// ParseOverheatProtectionLimit parses low, medium or high
+func ParseOverheatProtectionLimit(name string) (OverheatProtectionLimit, error) {
+	limit := OverheatProtectionLimit(strings.ToLower(name))
+	if _, ok := overheatProtectionLevels[limit]; !ok {
+		return "", fmt.Errorf("unknown overheat protection limit %q", name)
+	}
+	return limit, nil
+}
+
+// OverheatProtectionState is the vehicle's Cabin Overheat Protection state
+type OverheatProtectionState struct {
+	Mode             OverheatProtectionMode  `json:"mode"`
+	Limit            OverheatProtectionLimit `json:"limit,omitempty"` // Empty if the vehicle doesn't report it
+	ActivelyCooling  bool                    `json:"actively_cooling"`
+	NotRunningReason string                  `json:"not_running_reason,omitempty"`
+}
+
+// overheatProtectionState reads the overheat protection fields of the
+// vehicle's climate state
+func overheatProtectionState(climate *carserver.ClimateState) OverheatProtectionState {
+	state := OverheatProtectionState{
+		Mode:            OverheatProtectionOff,
+		ActivelyCooling: climate.GetCabinOverheatProtectionActivelyCooling(),
+	}
+	switch climate.GetCabinOverheatProtection() {
+	case carserver.ClimateState_CabinOverheatProtectionOn:
+		state.Mode = OverheatProtectionOn
+	case carserver.ClimateState_CabinOverheatProtectionFanOnly:
+		state.Mode = OverheatProtectionNoAC
+	}
+	switch climate.GetCopActivationTemperature() {
+	case carserver.ClimateState_CopActivationTempLow:
+		state.Limit = OverheatProtectionLow
+	case carserver.ClimateState_CopActivationTempMedium:
+		state.Limit = OverheatProtectionMedium
+	case carserver.ClimateState_CopActivationTempHigh:
+		state.Limit = OverheatProtectionHigh
+	}
+	if reason := climate.GetCopNotRunningReason(); reason != carserver.ClimateState_COPNotRunningReasonNoReason {
+		state.NotRunningReason = reason.String()
+	}
+	return state
+}
+
+// SetCabinOverheatProtection sets the Cabin Overheat Protection mode with
+// retry logic
+func (c *Client) SetCabinOverheatProtection(ctx context.Context, mode OverheatProtectionMode) (err error) {
+	if err := c.runCommandHooks(ctx, "set_cabin_overheat_protection", map[string]interface{}{"mode": string(mode)}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_cabin_overheat_protection", err) }()
+
+	if _, err := ParseOverheatProtectionMode(string(mode)); err != nil {
+		return err
+	}
+
+	// Add timeout to overheat protection control
+	copCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+	defer cancel()
+
+	return c.retryWithBackoff(copCtx, "set_cabin_overheat_protection", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		logging.Debugf(c.logFor(ctx), "Setting cabin overheat protection to: %s", mode)
+		return c.vehicle.SetCabinOverheatProtection(copCtx, mode != OverheatProtectionOff, mode == OverheatProtectionNoAC)
+	})
+}
+
+// SetCabinOverheatProtectionLimit sets the cabin temperature at which
+// overheat protection starts, with retry logic
+func (c *Client) SetCabinOverheatProtectionLimit(ctx context.Context, limit OverheatProtectionLimit) (err error) {
+	if err := c.runCommandHooks(ctx, "set_cabin_overheat_protection_limit", map[string]interface{}{"limit": string(limit)}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("set_cabin_overheat_protection_limit", err) }()
+
+	level, ok := overheatProtectionLevels[limit]
+	if !ok {
+		return fmt.Errorf("unknown overheat protection limit %q", limit)
+	}
+
+	// Add timeout to overheat protection control
+	copCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+	defer cancel()
+
+	return c.retryWithBackoff(copCtx, "set_cabin_overheat_protection_limit", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		logging.Debugf(c.logFor(ctx), "Setting cabin overheat protection limit to: %s", limit)
+		return c.vehicle.SetCabinOverheatProtectionTemperature(copCtx, level)
+	})
+}
@@ -0,0 +1,62 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestParseOverheatProtection(t *testing.T) {
+	if mode, err := ParseOverheatProtectionMode("No_AC"); err != nil || mode != OverheatProtectionNoAC {
+		t.Errorf("Expected no_ac, got %q, %v", mode, err)
+	}
+	if _, err := ParseOverheatProtectionMode("max"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+	if limit, err := ParseOverheatProtectionLimit("medium"); err != nil || limit != OverheatProtectionMedium {
+		t.Errorf("Expected medium, got %q, %v", limit, err)
+	}
+	if _, err := ParseOverheatProtectionLimit("35"); err == nil {
+		t.Error("Expected an error for an unknown limit")
+	}
+}
+
+func TestOverheatProtectionState(t *testing.T) {
+	climate := &carserver.ClimateState{
+		OptionalCabinOverheatProtection: &carserver.ClimateState_CabinOverheatProtection{
+			CabinOverheatProtection: carserver.ClimateState_CabinOverheatProtectionFanOnly,
+		},
+		OptionalCopActivationTemperature: &carserver.ClimateState_CopActivationTemperature{
+			CopActivationTemperature: carserver.ClimateState_CopActivationTempHigh,
+		},
+		OptionalCabinOverheatProtectionActivelyCooling: &carserver.ClimateState_CabinOverheatProtectionActivelyCooling{
+			CabinOverheatProtectionActivelyCooling: true,
+		},
+	}
+	want := OverheatProtectionState{Mode: OverheatProtectionNoAC, Limit: OverheatProtectionHigh, ActivelyCooling: true}
+	if got := overheatProtectionState(climate); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// A vehicle that doesn't report overheat protection reads as off
+	if got := overheatProtectionState(&carserver.ClimateState{}); got != (OverheatProtectionState{Mode: OverheatProtectionOff}) {
+		t.Errorf("Expected off, got %+v", got)
+	}
+}
+
+func TestSetCabinOverheatProtectionNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx := context.Background()
+
+	if err := client.SetCabinOverheatProtection(ctx, OverheatProtectionOn); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+	if err := client.SetCabinOverheatProtectionLimit(ctx, OverheatProtectionLow); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+	if err := client.SetCabinOverheatProtectionLimit(ctx, "scorching"); err == nil || errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected an invalid limit error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package tesla
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/history"
+)
+
+// pollTimeout bounds each state read by the poller
+const pollTimeout = 30 * time.Second
+
+// Poller samples a client's HVAC state at an interval while the vehicle is
+// reachable and adds the samples to a history store. Each read also updates
+// the client's recorded state, so live WebSocket and SSE subscribers see it.
+type Poller struct {
+	client   *Client
+	interval time.Duration
+	store    history.Store
+	logger   *log.Logger
+}
+
+// NewPoller creates a poller for a client
+func NewPoller(client *Client, interval time.Duration, store history.Store, logger *log.Logger) *Poller {
+	return &Poller{
+		client:   client,
+		interval: interval,
+		store:    store,
+		logger:   logger,
+	}
+}
+
+// Run polls until ctx is cancelled
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		p.poll(ctx)
+	}
+}
+
+// poll reads and records one sample. It reports whether a sample was taken.
+// Disconnected vehicles are skipped, as are vehicles last seen asleep over
+// BLE unless the security controller, which answers without waking the
+// vehicle, says they have woken.
+func (p *Poller) poll(ctx context.Context) bool {
+	c := p.client
+	if !c.IsConnected() {
+		return false
+	}
+	if c.ActiveTransport() == TransportBLE && c.AwakeStatus().State == Asleep {
+		status, err := c.SleepStatus(ctx)
+		if err != nil || status.State == Asleep {
+			return false
+		}
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+
+	state, err := c.GetHVACState(pollCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Printf("Failed to poll state of vehicle %s: %v", c.vin, err)
+		}
+		return false
+	}
+
+	sample := history.Sample{
+		Time:               time.Now(),
+		VIN:                c.vin,
+		InsideTempCelsius:  state.InsideTempCelsius,
+		OutsideTempCelsius: state.OutsideTempCelsius,
+		ClimateOn:          state.IsOn,
+		FanStatus:          state.FanStatus,
+	}
+	if err := p.store.Add(sample); err != nil {
+		p.logger.Printf("Failed to record state of vehicle %s: %v", c.vin, err)
+		return false
+	}
+	return true
+}
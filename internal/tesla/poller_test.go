@@ -0,0 +1,35 @@
+package tesla
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/history"
+)
+
+func TestPollerSkipsDisconnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	store := history.NewMemory(history.Config{})
+	poller := NewPoller(client, time.Minute, store, log.New(io.Discard, "", 0))
+
+	if poller.poll(context.Background()) {
+		t.Error("Expected no sample while disconnected")
+	}
+	if samples, _ := store.Query(history.Query{}); len(samples) != 0 {
+		t.Errorf("Expected no samples, got %+v", samples)
+	}
+}
+
+func TestPollerRunStops(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	poller := NewPoller(client, 5*time.Millisecond, history.NewMemory(history.Config{}), log.New(io.Discard, "", 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := poller.Run(ctx); err != nil {
+		t.Errorf("Expected a clean stop, got %v", err)
+	}
+}
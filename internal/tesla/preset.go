@@ -0,0 +1,162 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/weather"
+)
+
+// Preset is a named bundle of climate settings defined in the config file,
+// e.g. "morning-defrost" or "summer-cooldown", applied with one request.
+// Omitted settings are left as they are. Temperatures are in Celsius.
+type Preset struct {
+	Name          string           `json:"name"`
+	Description   string           `json:"description,omitempty"`
+	DriverTemp    *float32         `json:"driver_temp,omitempty"`
+	PassengerTemp *float32         `json:"passenger_temp,omitempty"` // Same as the driver if omitted
+	ClimateOn     *bool            `json:"climate_on,omitempty"`
+	FanSpeed      *int             `json:"fan_speed,omitempty"`    // 0 (off) to 10, or 11 for auto
+	SeatHeaters   map[string]int   `json:"seat_heaters,omitempty"` // Seat name, or all, to level 0-3
+	Defroster     *PresetDefroster `json:"defroster,omitempty"`
+}
+
+// PresetDefroster is a preset's defroster setting
+type PresetDefroster struct {
+	Front bool `json:"front"`
+	Rear  bool `json:"rear"`
+}
+
+// Steps returns the commands that apply the preset, in the order they run:
+// temperature, climate, fan, seat heaters and then the defroster
+func (p Preset) Steps() []MacroStep {
+	var steps []MacroStep
+	if p.DriverTemp != nil {
+		params := map[string]interface{}{"driver_temp": *p.DriverTemp}
+		if p.PassengerTemp != nil {
+			params["passenger_temp"] = *p.PassengerTemp
+		}
+		steps = append(steps, MacroStep{Command: "set_temperature", Params: params})
+	}
+	if p.ClimateOn != nil {
+		command := "set_climate_off"
+		if *p.ClimateOn {
+			command = "set_climate_on"
+		}
+		steps = append(steps, MacroStep{Command: command})
+	}
+	if p.FanSpeed != nil {
+		steps = append(steps, MacroStep{Command: "set_fan_speed", Params: map[string]interface{}{"speed": *p.FanSpeed}})
+	}
+
+	// "all" goes first so individual seats can override it
+	seats := make([]string, 0, len(p.SeatHeaters))
+	for seat := range p.SeatHeaters {
+		seats = append(seats, seat)
+	}
+	sort.Slice(seats, func(i, j int) bool {
+		if (seats[i] == "all") != (seats[j] == "all") {
+			return seats[i] == "all"
+		}
+		return seats[i] < seats[j]
+	})
+	for _, seat := range seats {
+		steps = append(steps, MacroStep{Command: "set_seat_heater", Params: map[string]interface{}{"seat": seat, "level": p.SeatHeaters[seat]}})
+	}
+
+	if p.Defroster != nil {
+		steps = append(steps, MacroStep{Command: "set_defroster", Params: map[string]interface{}{"front": p.Defroster.Front, "rear": p.Defroster.Rear}})
+	}
+	return steps
+}
+
+// Validate checks the preset's name and settings
+func (p Preset) Validate() error {
+	if !macroNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("name %q must be lowercase letters, digits, '-' or '_'", p.Name)
+	}
+	if p.PassengerTemp != nil && p.DriverTemp == nil {
+		return fmt.Errorf("preset %s: passenger_temp needs driver_temp", p.Name)
+	}
+	steps := p.Steps()
+	if len(steps) == 0 {
+		return fmt.Errorf("preset %s has no settings", p.Name)
+	}
+	for _, step := range steps {
+		if _, err := bindCommand(step.Command, step.Params); err != nil {
+			return fmt.Errorf("preset %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// validatePresets checks every preset and that names are unique
+func validatePresets(presets []Preset) error {
+	seen := make(map[string]bool, len(presets))
+	for _, preset := range presets {
+		if err := preset.Validate(); err != nil {
+			return err
+		}
+		if seen[preset.Name] {
+			return fmt.Errorf("duplicate preset %s", preset.Name)
+		}
+		seen[preset.Name] = true
+	}
+	return nil
+}
+
+// validateSchedules checks the schedules and weather rules, and that the
+// presets they apply exist
+func (c *Config) validateSchedules() error {
+	if err := schedule.Validate(c.Schedules); err != nil {
+		return err
+	}
+	if err := weather.ValidateRules(c.WeatherRules); err != nil {
+		return fmt.Errorf("weather_rules: %w", err)
+	}
+	if len(c.WeatherRules) > 0 && !c.Weather.Enabled() {
+		return fmt.Errorf("weather_rules need weather.provider")
+	}
+
+	schedules := c.Schedules
+	for _, rule := range c.WeatherRules {
+		schedules = append(schedules[:len(schedules):len(schedules)], rule.Schedule)
+	}
+	for _, s := range schedules {
+		if s.Action != schedule.ActionPreset {
+			continue
+		}
+		if _, ok := c.FindPreset(s.Preset); !ok {
+			return fmt.Errorf("schedule %s: unknown preset %q", s.Name, s.Preset)
+		}
+	}
+	return nil
+}
+
+// FindPreset returns the preset with the given name
+func (c *Config) FindPreset(name string) (Preset, bool) {
+	for _, preset := range c.Presets {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// ApplyPreset applies a preset's settings in order, stopping at the first
+// that fails
+func (c *Client) ApplyPreset(ctx context.Context, preset Preset) error {
+	if err := preset.Validate(); err != nil {
+		return err
+	}
+
+	c.logFor(ctx).Printf("Applying preset %s", preset.Name)
+	for _, step := range preset.Steps() {
+		if err := c.ExecuteCommand(ctx, step.Command, step.Params); err != nil {
+			return fmt.Errorf("preset %s (%s): %w", preset.Name, step.Command, err)
+		}
+	}
+	return nil
+}
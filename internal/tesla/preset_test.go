@@ -0,0 +1,111 @@
+package tesla
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+	"github.com/teslamotors/vehicle-command/internal/weather"
+)
+
+func float32Ptr(v float32) *float32 { return &v }
+func intPtr(v int) *int             { return &v }
+func boolPtr(v bool) *bool          { return &v }
+
+func TestPresetSteps(t *testing.T) {
+	preset := Preset{
+		Name:        "morning-defrost",
+		DriverTemp:  float32Ptr(22),
+		ClimateOn:   boolPtr(true),
+		FanSpeed:    intPtr(7),
+		SeatHeaters: map[string]int{"front_left": 3, "all": 1},
+		Defroster:   &PresetDefroster{Front: true},
+	}
+
+	var commands []string
+	for _, step := range preset.Steps() {
+		commands = append(commands, step.Command)
+	}
+	want := "set_temperature set_climate_on set_fan_speed set_seat_heater set_seat_heater set_defroster"
+	if got := strings.Join(commands, " "); got != want {
+		t.Errorf("Expected steps %q, got %q", want, got)
+	}
+	if seat := preset.Steps()[3].Params["seat"]; seat != "all" {
+		t.Errorf("Expected all seats before individual seats, got %v", seat)
+	}
+	if err := preset.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+func TestPresetValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset Preset
+		err    string
+	}{
+		{"bad name", Preset{Name: "Summer Cool", ClimateOn: boolPtr(true)}, "must be lowercase"},
+		{"no settings", Preset{Name: "empty"}, "has no settings"},
+		{"passenger only", Preset{Name: "p", PassengerTemp: float32Ptr(20)}, "needs driver_temp"},
+		{"temp out of range", Preset{Name: "p", DriverTemp: float32Ptr(72)}, "outside 15-28°C"},
+		{"fan out of range", Preset{Name: "p", FanSpeed: intPtr(12)}, "speed must be between"},
+		{"unknown seat", Preset{Name: "p", SeatHeaters: map[string]int{"trunk": 1}}, `unknown seat "trunk"`},
+		{"seat level out of range", Preset{Name: "p", SeatHeaters: map[string]int{"all": 4}}, "level must be between"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.preset.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Presets = []Preset{{Name: "warm", DriverTemp: float32Ptr(24)}, {Name: "warm", FanSpeed: intPtr(3)}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "duplicate preset warm") {
+		t.Errorf("Expected a duplicate preset error, got %v", err)
+	}
+}
+
+func TestScheduleUnknownPreset(t *testing.T) {
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Schedules = []schedule.Schedule{{Name: "evening", Action: schedule.ActionPreset, Preset: "cool", At: "18:00"}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), `unknown preset "cool"`) {
+		t.Errorf("Expected an unknown preset error, got %v", err)
+	}
+
+	config.Presets = []Preset{{Name: "cool", FanSpeed: intPtr(5)}}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestWeatherRulesNeedProvider(t *testing.T) {
+	below := 0.0
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.WeatherRules = []weather.Rule{{
+		Schedule: schedule.Schedule{Name: "cold-morning", Action: schedule.ActionClimateOn, At: "06:45"},
+		Below:    &below,
+	}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "weather.provider") {
+		t.Errorf("Expected a missing provider error, got %v", err)
+	}
+
+	config.Weather = weather.Config{Provider: weather.ProviderOpenWeatherMap}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestApplyPresetNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	err := client.ApplyPreset(context.Background(), Preset{Name: "cool", FanSpeed: intPtr(5)})
+	if err == nil || !strings.Contains(err.Error(), "preset cool (set_fan_speed)") {
+		t.Errorf("Expected the failing step in the error, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when a vehicle already has as many commands
+// running and waiting as it accepts
+var ErrQueueFull = errors.New("too many requests queued for vehicle")
+
+// QueueStats describes a vehicle's command queue
+type QueueStats struct {
+	Running       int   `json:"running"`
+	Waiting       int   `json:"waiting"`
+	MaxConcurrent int   `json:"max_concurrent"`
+	MaxQueued     int   `json:"max_queued"`
+	Rejected      int64 `json:"rejected"` // Commands turned away because the queue was full
+}
+
+// commandQueue bounds how many commands run against a vehicle at once.
+// Commands beyond tesla.max_concurrent_requests wait their turn, up to
+// tesla.max_queued_requests of them; more than that are rejected.
+type commandQueue struct {
+	slots     chan struct{}
+	maxQueued int
+
+	mu       sync.Mutex
+	waiting  int
+	rejected int64
+}
+
+// newCommandQueue creates a queue. A concurrency below 1 allows one command
+// at a time.
+func newCommandQueue(maxConcurrent, maxQueued int) *commandQueue {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	return &commandQueue{
+		slots:     make(chan struct{}, maxConcurrent),
+		maxQueued: maxQueued,
+	}
+}
+
+// acquire waits for a slot to run a command. The returned func releases it.
+func (q *commandQueue) acquire(ctx context.Context) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+	release := func() { <-q.slots }
+
+	select {
+	case q.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	q.mu.Lock()
+	if q.waiting >= q.maxQueued {
+		q.rejected++
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	q.waiting++
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		q.waiting--
+		q.mu.Unlock()
+	}()
+
+	select {
+	case q.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// stats returns the queue's current load
+func (q *commandQueue) stats() QueueStats {
+	if q == nil {
+		return QueueStats{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return QueueStats{
+		Running:       len(q.slots),
+		Waiting:       q.waiting,
+		MaxConcurrent: cap(q.slots),
+		MaxQueued:     q.maxQueued,
+		Rejected:      q.rejected,
+	}
+}
+
+// QueueStats returns the load on the vehicle's command queue
+func (c *Client) QueueStats() QueueStats {
+	return c.queue.stats()
+}
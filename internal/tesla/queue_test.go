@@ -0,0 +1,101 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandQueue(t *testing.T) {
+	queue := newCommandQueue(1, 1)
+	ctx := context.Background()
+
+	release, err := queue.acquire(ctx)
+	if err != nil {
+		t.Fatalf("Expected a free slot, got %v", err)
+	}
+
+	// The second command waits for the first
+	acquired := make(chan func())
+	go func() {
+		next, err := queue.acquire(ctx)
+		if err != nil {
+			t.Errorf("Expected the waiting command to get a slot, got %v", err)
+		}
+		acquired <- next
+	}()
+	deadline := time.Now().Add(time.Second)
+	for queue.stats().Waiting != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a waiting command")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A third is turned away while the queue is full
+	if _, err := queue.acquire(ctx); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	stats := queue.stats()
+	if stats.Running != 1 || stats.Waiting != 1 || stats.Rejected != 1 || stats.MaxConcurrent != 1 || stats.MaxQueued != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	release()
+	next := <-acquired
+	next()
+	if stats := queue.stats(); stats.Running != 0 || stats.Waiting != 0 {
+		t.Errorf("Expected an idle queue, got %+v", stats)
+	}
+}
+
+func TestCommandQueueCancelled(t *testing.T) {
+	queue := newCommandQueue(1, 5)
+	release, _ := queue.acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := queue.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with the context, got %v", err)
+	}
+	if queue.stats().Waiting != 0 {
+		t.Error("Expected the cancelled command to leave the queue")
+	}
+}
+
+func TestClientRejectsWhenQueueFull(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	client.queue = newCommandQueue(1, 0)
+	release, _ := client.queue.acquire(context.Background())
+	defer release()
+
+	if _, err := client.GetHVACState(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if client.QueueStats().Rejected != 1 {
+		t.Errorf("Expected one rejected command, got %+v", client.QueueStats())
+	}
+}
+
+func TestStateGettersTakeOneQueueSlot(t *testing.T) {
+	client, _ := newFakeClient(t, newFakeVehicle())
+	client.queue = newCommandQueue(1, 5)
+	client.stateCacheTTL = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := client.GetFanSpeed(ctx); err != nil {
+		t.Errorf("GetFanSpeed: %v", err)
+	}
+	if _, err := client.GetAirflowPattern(ctx); err != nil {
+		t.Errorf("GetAirflowPattern: %v", err)
+	}
+	if _, err := client.GetAutoMode(ctx); err != nil {
+		t.Errorf("GetAutoMode: %v", err)
+	}
+	if stats := client.QueueStats(); stats.Running != 0 {
+		t.Errorf("Expected every slot released, got %+v", stats)
+	}
+}
@@ -0,0 +1,110 @@
+package tesla
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Reconnector keeps a client's session up in the background. It checks the
+// connection every interval and, when a session the client connected has
+// dropped, reconnects with exponential backoff up to maxDelay. Each attempt
+// moves the client to StateReconnecting, so subscribers to
+// EventConnectionState see reconnects as they happen. A deliberate
+// Disconnect stops it reconnecting until the client connects again.
+type Reconnector struct {
+	client   *Client
+	logger   *log.Logger
+	interval time.Duration
+	maxDelay time.Duration
+
+	// probe checks that a connected session still answers
+	probe func(ctx context.Context) error
+}
+
+// NewReconnector creates a reconnector for the client with the reconnect
+// settings from the client config
+func NewReconnector(client *Client, config ClientConfig, logger *log.Logger) *Reconnector {
+	if logger == nil {
+		logger = client.logger
+	}
+	r := &Reconnector{
+		client:   client,
+		logger:   logger,
+		interval: config.ReconnectInterval,
+		maxDelay: config.ReconnectMaxDelay,
+	}
+	r.probe = r.probeSession
+	return r
+}
+
+// Run checks the connection until ctx is cancelled
+func (r *Reconnector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		r.check(ctx)
+	}
+}
+
+// check reconnects the client if its session has dropped
+func (r *Reconnector) check(ctx context.Context) {
+	if !r.client.KeepConnected() {
+		return
+	}
+	if r.client.IsConnected() {
+		err := r.probe(ctx)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		r.client.dropConnection(err)
+	}
+	r.reconnect(ctx)
+}
+
+// probeSession reads the sleep status, which answers over BLE without
+// waking the vehicle. Fleet API connections have no session to drop.
+func (r *Reconnector) probeSession(ctx context.Context) error {
+	if r.client.ActiveTransport() != TransportBLE {
+		return nil
+	}
+	_, err := r.client.SleepStatus(ctx)
+	return err
+}
+
+// reconnect connects until it succeeds, ctx is cancelled or the client is
+// disconnected on purpose
+func (r *Reconnector) reconnect(ctx context.Context) {
+	delay := r.interval
+	for attempt := 1; ; attempt++ {
+		r.client.setConnectionState(StateReconnecting, nil)
+		err := r.client.Connect(ctx, r.client.GetPrivateKeyFile())
+		if err == nil {
+			r.logger.Printf("Reconnected to vehicle %s after %d attempt(s)", r.client.GetVIN(), attempt)
+			return
+		}
+		if ctx.Err() != nil || !r.client.KeepConnected() {
+			return
+		}
+
+		r.logger.Printf("Reconnect attempt %d to vehicle %s failed: %v. Retrying in %v", attempt, r.client.GetVIN(), err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if !r.client.KeepConnected() {
+			return
+		}
+		delay *= 2
+		if delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// newReconnectTestClient returns a client whose connects fail fast over a
+// fake transport
+func newReconnectTestClient(t *testing.T) (*Client, *fakeTransport, *Reconnector) {
+	t.Helper()
+	logger := log.New(io.Discard, "", 0)
+	client := NewClientWithConfig("TEST_VIN", logger, RetryConfig{MaxRetries: 0, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}, CircuitBreakerConfig{MaxFailures: 1000, ResetTimeout: time.Second, HalfOpenMaxCalls: 1})
+	transport := &fakeTransport{kind: TransportBLE, err: errors.New("out of range")}
+	client.SetTransports(transport)
+	reconnector := NewReconnector(client, ClientConfig{ReconnectInterval: 5 * time.Millisecond, ReconnectMaxDelay: 20 * time.Millisecond}, logger)
+	return client, transport, reconnector
+}
+
+func TestReconnectorIgnoresDeliberateDisconnect(t *testing.T) {
+	client, transport, reconnector := newReconnectTestClient(t)
+
+	reconnector.check(context.Background())
+	client.Disconnect()
+	reconnector.check(context.Background())
+	if transport.dialed.Load() != 0 {
+		t.Errorf("Expected no reconnects for a client that isn't meant to be connected, got %d", transport.dialed.Load())
+	}
+}
+
+func TestReconnectorRetriesUntilDisconnected(t *testing.T) {
+	client, transport, reconnector := newReconnectTestClient(t)
+	client.setKeepConnected(true)
+
+	events, unsubscribe := client.Events().Subscribe(64)
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		reconnector.check(context.Background())
+		close(done)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for transport.dialed.Load() < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("Expected repeated reconnect attempts, got %d", transport.dialed.Load())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	client.Disconnect()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Reconnect loop didn't stop after a deliberate disconnect")
+	}
+
+	reconnecting := false
+	for len(events) > 0 {
+		event := <-events
+		if status, ok := event.Data.(ConnectionStatus); ok && status.State == StateReconnecting {
+			reconnecting = true
+		}
+	}
+	if !reconnecting {
+		t.Error("Expected a reconnecting connection state event")
+	}
+}
+
+func TestReconnectorDropsFailedSession(t *testing.T) {
+	client, transport, reconnector := newReconnectTestClient(t)
+	conn := inet.NewConnection("TEST_VIN", "Bearer token", "localhost", "")
+	car, err := vehicle.NewVehicle(conn, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create vehicle: %v", err)
+	}
+	client.conn = conn
+	client.vehicle = car
+	client.setKeepConnected(true)
+
+	// A session that still answers is left alone
+	reconnector.probe = func(ctx context.Context) error { return nil }
+	reconnector.check(context.Background())
+	if !client.IsConnected() || transport.dialed.Load() != 0 {
+		t.Fatal("Expected a healthy session to be kept")
+	}
+
+	reconnector.probe = func(ctx context.Context) error { return errors.New("link lost") }
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	reconnector.check(ctx)
+	if client.IsConnected() {
+		t.Error("Expected the failed session to be closed")
+	}
+	if transport.dialed.Load() == 0 {
+		t.Error("Expected a reconnect attempt")
+	}
+	if !client.KeepConnected() {
+		t.Error("A dropped session should still be reconnected later")
+	}
+}
@@ -0,0 +1,331 @@
+package tesla
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// Directions of an Exchange
+const (
+	ExchangeSent     = "sent"     // From the client to the vehicle
+	ExchangeReceived = "received" // From the vehicle to the client
+)
+
+// Exchange is one protocol message between the client and a vehicle
+type Exchange struct {
+	VIN       string        `json:"vin"`
+	Direction string        `json:"direction"`
+	Offset    time.Duration `json:"offset"` // Since the recording started
+	Data      []byte        `json:"data"`   // The encoded RoutableMessage
+}
+
+// Recorder writes the messages on wrapped connections to a file, one JSON
+// Exchange per line, for a ReplayConnector to play back in tests
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	start  time.Time
+	err    error // First write error; later exchanges are dropped
+}
+
+// NewRecorder returns a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, start: time.Now()}
+}
+
+// OpenRecorder returns a recorder writing to a new file at path. Recordings
+// hold vehicle state, so only the owner can read them.
+func OpenRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+// Close closes the recording file, returning the first error writing to it
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closer != nil {
+		if err := r.closer.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+		r.closer = nil
+	}
+	return r.err
+}
+
+// record writes one exchange
+func (r *Recorder) record(vin, direction string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	line, err := json.Marshal(Exchange{VIN: vin, Direction: direction, Offset: time.Since(r.start), Data: data})
+	if err == nil {
+		_, err = r.w.Write(append(line, '\n'))
+	}
+	r.err = err
+}
+
+// Wrap returns a connection that records everything sent and received on
+// conn
+func (r *Recorder) Wrap(conn Connector) Connector {
+	rc := &recordingConnector{Connector: conn, recorder: r, recv: make(chan []byte, connector.BufferSize)}
+	go rc.forward()
+	return rc
+}
+
+// recordingConnector is a connection whose messages are recorded
+type recordingConnector struct {
+	Connector
+	recorder *Recorder
+	recv     chan []byte
+}
+
+// forward records received messages on their way to the client
+func (c *recordingConnector) forward() {
+	defer close(c.recv)
+	for data := range c.Connector.Receive() {
+		c.recorder.record(c.VIN(), ExchangeReceived, data)
+		c.recv <- data
+	}
+}
+
+func (c *recordingConnector) Receive() <-chan []byte {
+	return c.recv
+}
+
+func (c *recordingConnector) Send(ctx context.Context, buffer []byte) error {
+	c.recorder.record(c.VIN(), ExchangeSent, buffer)
+	return c.Connector.Send(ctx, buffer)
+}
+
+// SetRecorder records the messages on every later connection to the vehicle.
+// A nil recorder stops recording new connections.
+func (c *Client) SetRecorder(recorder *Recorder) {
+	c.transportMutex.Lock()
+	defer c.transportMutex.Unlock()
+	c.recorder = recorder
+}
+
+// recordConnection wraps conn in the client's recorder, if any
+func (c *Client) recordConnection(conn Connector) Connector {
+	c.transportMutex.RLock()
+	defer c.transportMutex.RUnlock()
+	if c.recorder == nil {
+		return conn
+	}
+	return c.recorder.Wrap(conn)
+}
+
+// ReadExchanges reads a recording
+func ReadExchanges(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 4*connector.MaxResponseLength)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var exchange Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if exchange.Direction != ExchangeSent && exchange.Direction != ExchangeReceived {
+			return nil, fmt.Errorf("line %d: unknown direction %q", line, exchange.Direction)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, scanner.Err()
+}
+
+// LoadRecording reads a recording file
+func LoadRecording(path string) ([]Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	exchanges, err := ReadExchanges(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording %s: %w", path, err)
+	}
+	return exchanges, nil
+}
+
+// ReplayConnector plays a recording back to the client in place of the
+// vehicle. Each message the client sends must match the next recorded one;
+// the responses recorded after it are then delivered, addressed to the new
+// request. Signed payloads are encrypted with per-session keys, so only
+// their routing and signature type are compared, and replayed responses to
+// them fail authentication. Replay covers unsigned traffic end to end.
+type ReplayConnector struct {
+	vin       string
+	exchanges []Exchange
+	mu        sync.Mutex
+	next      int
+	err       error // First mismatch
+	recv      chan []byte
+	closed    bool
+}
+
+// NewReplayConnector returns a connection replaying the exchanges with vin.
+// An empty vin replays every exchange.
+func NewReplayConnector(vin string, exchanges []Exchange) *ReplayConnector {
+	var replayed []Exchange
+	for _, exchange := range exchanges {
+		if vin == "" || exchange.VIN == vin {
+			replayed = append(replayed, exchange)
+		}
+	}
+	return &ReplayConnector{vin: vin, exchanges: replayed, recv: make(chan []byte, len(replayed)+1)}
+}
+
+func (c *ReplayConnector) Receive() <-chan []byte {
+	return c.recv
+}
+
+// Send checks buffer against the next recorded request and delivers the
+// responses recorded after it
+func (c *ReplayConnector) Send(ctx context.Context, buffer []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return fmt.Errorf("replay connection closed")
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if c.next >= len(c.exchanges) || c.exchanges[c.next].Direction != ExchangeSent {
+		c.err = fmt.Errorf("replay: unexpected request %d, the recording has no more", c.next)
+		return c.err
+	}
+
+	request, err := sameRequest(c.exchanges[c.next].Data, buffer)
+	if err != nil {
+		c.err = fmt.Errorf("replay: request %d: %w", c.next, err)
+		return c.err
+	}
+	c.next++
+	for ; c.next < len(c.exchanges) && c.exchanges[c.next].Direction == ExchangeReceived; c.next++ {
+		response, err := readdress(c.exchanges[c.next].Data, request)
+		if err != nil {
+			c.err = fmt.Errorf("replay: response %d: %w", c.next, err)
+			return c.err
+		}
+		c.recv <- response
+	}
+	return nil
+}
+
+// Err returns the first request that didn't match the recording
+func (c *ReplayConnector) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Done reports whether every recorded exchange has been replayed
+func (c *ReplayConnector) Done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.next >= len(c.exchanges)
+}
+
+func (c *ReplayConnector) VIN() string {
+	return c.vin
+}
+
+func (c *ReplayConnector) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.recv)
+	}
+}
+
+func (c *ReplayConnector) PreferredAuthMethod() connector.AuthMethod {
+	return connector.AuthMethodGCM
+}
+
+func (c *ReplayConnector) RetryInterval() time.Duration {
+	return time.Second
+}
+
+func (c *ReplayConnector) AllowedLatency() time.Duration {
+	return 4 * time.Second
+}
+
+// sameRequest returns the sent request if it matches the recorded one,
+// ignoring what differs between sessions
+func sameRequest(recorded, sent []byte) (*universal.RoutableMessage, error) {
+	var want, got universal.RoutableMessage
+	if err := proto.Unmarshal(recorded, &want); err != nil {
+		return nil, fmt.Errorf("invalid recorded message: %w", err)
+	}
+	if err := proto.Unmarshal(sent, &got); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	request := proto.Clone(&got).(*universal.RoutableMessage)
+	normalizeRequest(&want)
+	normalizeRequest(&got)
+	if !proto.Equal(&want, &got) {
+		return nil, fmt.Errorf("sent %v, recorded %v", &got, &want)
+	}
+	return request, nil
+}
+
+// normalizeRequest clears the parts of a request that change every session
+func normalizeRequest(message *universal.RoutableMessage) {
+	message.Uuid = nil
+	message.FromDestination = nil
+	if signed := message.GetSignatureData(); signed != nil {
+		// Keep the signer and signature type, not the nonce, counter or tag
+		switch signed.GetSigType().(type) {
+		case *signatures.SignatureData_AES_GCM_PersonalizedData:
+			signed.SigType = &signatures.SignatureData_AES_GCM_PersonalizedData{}
+		case *signatures.SignatureData_HMAC_PersonalizedData:
+			signed.SigType = &signatures.SignatureData_HMAC_PersonalizedData{}
+		}
+		if _, ok := message.Payload.(*universal.RoutableMessage_ProtobufMessageAsBytes); ok {
+			message.Payload = &universal.RoutableMessage_ProtobufMessageAsBytes{}
+		}
+	}
+}
+
+// readdress addresses a recorded response to request
+func readdress(recorded []byte, request *universal.RoutableMessage) ([]byte, error) {
+	var response universal.RoutableMessage
+	if err := proto.Unmarshal(recorded, &response); err != nil {
+		return nil, fmt.Errorf("invalid recorded message: %w", err)
+	}
+	if response.RequestUuid != nil {
+		response.RequestUuid = request.GetUuid()
+	}
+	if address := request.GetFromDestination().GetRoutingAddress(); address != nil {
+		response.ToDestination = &universal.Destination{
+			SubDestination: &universal.Destination_RoutingAddress{RoutingAddress: address},
+		}
+	}
+	return proto.Marshal(&response)
+}
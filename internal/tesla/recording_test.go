@@ -0,0 +1,181 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// lockedResponder answers every message with a VCSEC status reporting the
+// vehicle locked, as a vehicle would to a status request
+type lockedResponder struct {
+	recv chan []byte
+}
+
+func newLockedResponder() *lockedResponder {
+	return &lockedResponder{recv: make(chan []byte, connector.BufferSize)}
+}
+
+func (c *lockedResponder) Receive() <-chan []byte                    { return c.recv }
+func (c *lockedResponder) VIN() string                               { return "TEST_VIN" }
+func (c *lockedResponder) Close()                                    {}
+func (c *lockedResponder) PreferredAuthMethod() connector.AuthMethod { return connector.AuthMethodGCM }
+func (c *lockedResponder) RetryInterval() time.Duration              { return time.Millisecond }
+func (c *lockedResponder) AllowedLatency() time.Duration             { return time.Second }
+
+func (c *lockedResponder) Send(ctx context.Context, buffer []byte) error {
+	var request universal.RoutableMessage
+	if err := proto.Unmarshal(buffer, &request); err != nil {
+		return err
+	}
+	status, err := proto.Marshal(&vcsec.FromVCSECMessage{
+		SubMessage: &vcsec.FromVCSECMessage_VehicleStatus{VehicleStatus: &vcsec.VehicleStatus{
+			VehicleLockState: vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	response, err := proto.Marshal(&universal.RoutableMessage{
+		ToDestination:   &universal.Destination{SubDestination: &universal.Destination_RoutingAddress{RoutingAddress: request.GetFromDestination().GetRoutingAddress()}},
+		FromDestination: &universal.Destination{SubDestination: &universal.Destination_Domain{Domain: universal.Domain_DOMAIN_VEHICLE_SECURITY}},
+		Payload:         &universal.RoutableMessage_ProtobufMessageAsBytes{ProtobufMessageAsBytes: status},
+		RequestUuid:     request.GetUuid(),
+	})
+	if err != nil {
+		return err
+	}
+	c.recv <- response
+	return nil
+}
+
+// bodyControllerState reads the VCSEC status over conn with the vehicle
+// library
+func bodyControllerState(t *testing.T, conn Connector) (*vcsec.VehicleStatus, error) {
+	t.Helper()
+	car, err := vehicle.NewVehicle(conn, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := car.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer car.Disconnect()
+	return car.BodyControllerState(ctx)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := OpenRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := bodyControllerState(t, recorder.Wrap(newLockedResponder()))
+	if err != nil {
+		t.Fatalf("Failed to read the recorded status: %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	exchanges, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2 || exchanges[0].Direction != ExchangeSent || exchanges[1].Direction != ExchangeReceived {
+		t.Fatalf("Expected a request and its response, got %+v", exchanges)
+	}
+
+	// A new session sends the same request with new UUIDs and addresses
+	replay := NewReplayConnector("TEST_VIN", exchanges)
+	replayed, err := bodyControllerState(t, replay)
+	if err != nil {
+		t.Fatalf("Failed to read the replayed status: %v", err)
+	}
+	if !proto.Equal(status, replayed) || replayed.GetVehicleLockState() != vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED {
+		t.Errorf("Expected the recorded status, got %v", replayed)
+	}
+	if replay.Err() != nil || !replay.Done() {
+		t.Errorf("Expected the whole recording replayed, got done=%v err=%v", replay.Done(), replay.Err())
+	}
+}
+
+func TestReplayRejectsDifferentRequest(t *testing.T) {
+	var recording bytes.Buffer
+	recorder := NewRecorder(&recording)
+	if _, err := bodyControllerState(t, recorder.Wrap(newLockedResponder())); err != nil {
+		t.Fatal(err)
+	}
+	exchanges, err := ReadExchanges(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Listing keys encodes a different VCSEC request than a status read
+	replay := NewReplayConnector("", exchanges)
+	car, err := vehicle.NewVehicle(replay, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := car.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer car.Disconnect()
+	car.KeySummary(ctx)
+	if err := replay.Err(); err == nil || !strings.Contains(err.Error(), "request 0") {
+		t.Errorf("Expected a mismatch on the first request, got %v", err)
+	}
+}
+
+func TestReplayFiltersByVIN(t *testing.T) {
+	exchanges := []Exchange{
+		{VIN: "VIN_A", Direction: ExchangeSent},
+		{VIN: "VIN_B", Direction: ExchangeSent},
+		{VIN: "VIN_A", Direction: ExchangeReceived},
+	}
+	if replay := NewReplayConnector("VIN_A", exchanges); len(replay.exchanges) != 2 {
+		t.Errorf("Expected VIN_A's 2 exchanges, got %d", len(replay.exchanges))
+	}
+	if _, err := ReadExchanges(strings.NewReader(`{"direction":"sideways"}`)); err == nil {
+		t.Error("Expected an unknown direction to fail")
+	}
+}
+
+func TestClientRecordsConnections(t *testing.T) {
+	var recording bytes.Buffer
+	recorder := NewRecorder(&recording)
+	car := newFakeVehicle()
+	client := NewClient("TEST_VIN", nil)
+	client.SetRecorder(recorder)
+	var wrapped Connector
+	client.SetTransports(&fakeTransport{kind: TransportBLE, conn: &fakeConnector{}})
+	client.SetVehicleFactory(func(conn Connector, _ authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		wrapped = conn
+		return car, nil
+	})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := wrapped.Send(context.Background(), []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	exchanges, err := ReadExchanges(&recording)
+	if err != nil || len(exchanges) != 1 || exchanges[0].VIN != "TEST_VIN" || !bytes.Equal(exchanges[0].Data, []byte{1, 2, 3}) {
+		t.Errorf("Expected the sent message recorded, got %+v, %v", exchanges, err)
+	}
+}
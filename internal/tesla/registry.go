@@ -0,0 +1,210 @@
+package tesla
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// VehicleConfig configures one of several vehicles. Fields left unset fall
+// back to the top-level tesla, retry, circuit_breaker and failover sections.
+type VehicleConfig struct {
+	VIN            string                `json:"vin"`
+	Name           string                `json:"name,omitempty"`
+	PrivateKeyFile string                `json:"private_key_file,omitempty"`
+	Transport      string                `json:"transport,omitempty"`
+	Retry          *RetryConfig          `json:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	Failover       *FailoverConfig       `json:"failover,omitempty"`
+}
+
+// VehicleConfigs returns the configured vehicles. Without a vehicles list,
+// the single vehicle in the tesla section is used.
+func (c *Config) VehicleConfigs() []VehicleConfig {
+	if len(c.Vehicles) > 0 {
+		return c.Vehicles
+	}
+	return []VehicleConfig{{VIN: c.Tesla.VIN}}
+}
+
+// ForVehicle returns a copy of the config with a vehicle's settings applied
+// over the shared ones
+func (c *Config) ForVehicle(vehicle VehicleConfig) *Config {
+	config := *c
+	config.Vehicles = nil
+	config.Tesla.VIN = vehicle.VIN
+	if vehicle.PrivateKeyFile != "" {
+		config.Tesla.PrivateKeyFile = vehicle.PrivateKeyFile
+	}
+	if vehicle.Transport != "" {
+		config.Tesla.Transport = vehicle.Transport
+	}
+	if vehicle.Retry != nil {
+		config.Retry = *vehicle.Retry
+	}
+	if vehicle.CircuitBreaker != nil {
+		config.CircuitBreaker = *vehicle.CircuitBreaker
+	}
+	if vehicle.Failover != nil {
+		config.Failover = *vehicle.Failover
+	}
+	return &config
+}
+
+// hasVehicle reports whether vin is in the vehicles list
+func (c *Config) hasVehicle(vin string) bool {
+	for _, vehicle := range c.Vehicles {
+		if vehicle.VIN == vin {
+			return true
+		}
+	}
+	return false
+}
+
+// validateVehicles checks that VINs are unique and each vehicle's settings
+// are valid. A tesla.vin left over from a single-vehicle config must be one of
+// the vehicles, so it isn't silently ignored.
+func (c *Config) validateVehicles() error {
+	if c.Tesla.VIN != "" && len(c.Vehicles) > 0 && !c.hasVehicle(c.Tesla.VIN) {
+		return fmt.Errorf("tesla.vin %s is not in the list; add it or remove tesla.vin", c.Tesla.VIN)
+	}
+	seen := make(map[string]bool, len(c.Vehicles))
+	for _, vehicle := range c.Vehicles {
+		if vehicle.VIN == "" {
+			return fmt.Errorf("vin is required")
+		}
+		if seen[vehicle.VIN] {
+			return fmt.Errorf("duplicate vehicle %s", vehicle.VIN)
+		}
+		seen[vehicle.VIN] = true
+		if err := c.ForVehicle(vehicle).Validate(); err != nil {
+			return fmt.Errorf("%s: %w", vehicle.VIN, err)
+		}
+	}
+	return nil
+}
+
+// Registry holds one Client per vehicle. Each client has its own BLE
+// connection, retry settings and circuit breaker. The first vehicle added is
+// the default for requests that don't name one.
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+	names   map[string]string
+	order   []string
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		clients: make(map[string]*Client),
+		names:   make(map[string]string),
+	}
+}
+
+// NewRegistryFromConfig creates a client for each configured vehicle
+func NewRegistryFromConfig(config *Config, logger *log.Logger) (*Registry, error) {
+	registry := NewRegistry()
+	for _, vehicle := range config.VehicleConfigs() {
+		client := NewClientFromConfig(config.ForVehicle(vehicle), logger)
+		if err := registry.Add(client, vehicle.Name); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// NewRegistryWithConfigManager creates a client for each configured vehicle
+// and applies tuning changes to them when the config changes, such as on
+// switching profiles. Adding or removing vehicles, or changing their
+// transport, takes a restart.
+func NewRegistryWithConfigManager(configManager *ConfigManager, logger *log.Logger) (*Registry, error) {
+	registry, err := NewRegistryFromConfig(configManager.GetConfig(), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	configManager.RegisterCallback(func(oldConfig, newConfig *Config) error {
+		for _, vehicle := range newConfig.VehicleConfigs() {
+			client, ok := registry.Get(vehicle.VIN)
+			if !ok {
+				logger.Printf("Vehicle %s was added to the config; restart to use it", vehicle.VIN)
+				continue
+			}
+			config := newConfig.ForVehicle(vehicle)
+			client.ApplyTuning(TuningFromConfig(config))
+			client.privateKeyFile = config.Tesla.PrivateKeyFile
+			if transport, _ := ParseTransport(config.Tesla.Transport); transport != client.Transport() {
+				logger.Printf("Vehicle %s's transport changed to %s; restart to use it", vehicle.VIN, transport)
+			}
+		}
+		return nil
+	})
+	return registry, nil
+}
+
+// Add registers a client under its VIN, with an optional display name
+func (r *Registry) Add(client *Client, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	vin := client.GetVIN()
+	if _, ok := r.clients[vin]; ok {
+		return fmt.Errorf("vehicle %s is already registered", vin)
+	}
+	r.clients[vin] = client
+	r.names[vin] = name
+	r.order = append(r.order, vin)
+	return nil
+}
+
+// Get returns the client for a VIN
+func (r *Registry) Get(vin string) (*Client, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	client, ok := r.clients[vin]
+	return client, ok
+}
+
+// Clients returns every client in the order they were added
+func (r *Registry) Clients() []*Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(r.order))
+	for _, vin := range r.order {
+		clients = append(clients, r.clients[vin])
+	}
+	return clients
+}
+
+// Default returns the first vehicle, or nil if there is none
+func (r *Registry) Default() *Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.order) == 0 {
+		return nil
+	}
+	return r.clients[r.order[0]]
+}
+
+// Name returns a vehicle's display name, which may be empty
+func (r *Registry) Name(vin string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.names[vin]
+}
+
+// Len returns the number of vehicles
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.order)
+}
+
+// DisconnectAll disconnects every vehicle
+func (r *Registry) DisconnectAll() {
+	for _, client := range r.Clients() {
+		client.Disconnect()
+	}
+}
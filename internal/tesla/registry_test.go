@@ -0,0 +1,171 @@
+package tesla
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestVehicleConfigs(t *testing.T) {
+	config := DefaultConfig()
+	config.Tesla.VIN = "SINGLE_VIN"
+	if vehicles := config.VehicleConfigs(); len(vehicles) != 1 || vehicles[0].VIN != "SINGLE_VIN" {
+		t.Errorf("Expected the tesla section's vehicle, got %+v", vehicles)
+	}
+
+	config.Vehicles = []VehicleConfig{{VIN: "VIN_A"}, {VIN: "VIN_B"}}
+	if vehicles := config.VehicleConfigs(); len(vehicles) != 2 || vehicles[1].VIN != "VIN_B" {
+		t.Errorf("Expected the vehicles list, got %+v", vehicles)
+	}
+}
+
+func TestForVehicle(t *testing.T) {
+	config := DefaultConfig()
+	config.Tesla.PrivateKeyFile = "shared.pem"
+	config.Vehicles = []VehicleConfig{{VIN: "VIN_A"}}
+
+	retry := config.Retry
+	retry.MaxRetries = 7
+	vehicle := VehicleConfig{VIN: "VIN_B", PrivateKeyFile: "b.pem", Retry: &retry}
+	got := config.ForVehicle(vehicle)
+
+	if got.Tesla.VIN != "VIN_B" || got.Tesla.PrivateKeyFile != "b.pem" || got.Vehicles != nil {
+		t.Errorf("Unexpected vehicle config %+v", got.Tesla)
+	}
+	if got.Retry.MaxRetries != 7 || got.CircuitBreaker != config.CircuitBreaker {
+		t.Errorf("Expected the retry override and the shared circuit breaker, got %+v %+v", got.Retry, got.CircuitBreaker)
+	}
+	if config.Retry.MaxRetries == 7 || config.Tesla.VIN != "" {
+		t.Error("ForVehicle modified the shared config")
+	}
+
+	// Without overrides the shared key is used
+	if got := config.ForVehicle(VehicleConfig{VIN: "VIN_A"}); got.Tesla.PrivateKeyFile != "shared.pem" {
+		t.Errorf("Expected the shared key file, got %q", got.Tesla.PrivateKeyFile)
+	}
+}
+
+func TestValidateVehicles(t *testing.T) {
+	badRetry := DefaultConfig().Retry
+	badRetry.MaxRetries = -1
+
+	tests := []struct {
+		name     string
+		vehicles []VehicleConfig
+		err      string
+	}{
+		{"valid", []VehicleConfig{{VIN: "VIN_A"}, {VIN: "VIN_B", Name: "Second"}}, ""},
+		{"no vin", []VehicleConfig{{Name: "Unnamed"}}, "vehicles: vin is required"},
+		{"duplicate", []VehicleConfig{{VIN: "VIN_A"}, {VIN: "VIN_A"}}, "duplicate vehicle VIN_A"},
+		{"bad retry", []VehicleConfig{{VIN: "VIN_A", Retry: &badRetry}}, "vehicles: VIN_A: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Vehicles = tt.vehicles
+			err := config.Validate()
+			if tt.err == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateVehiclesWithTeslaVIN(t *testing.T) {
+	config := DefaultConfig()
+	config.Vehicles = []VehicleConfig{{VIN: "VIN_A"}, {VIN: "VIN_B"}}
+	config.Tesla.VIN = "VIN_B"
+	if err := config.Validate(); err != nil {
+		t.Errorf("Listed tesla.vin rejected: %v", err)
+	}
+	config.Tesla.VIN = "VIN_C"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "tesla.vin VIN_C") {
+		t.Errorf("Expected unlisted tesla.vin to be rejected, got %v", err)
+	}
+}
+
+func TestRegistryFromConfig(t *testing.T) {
+	config := DefaultConfig()
+	retry := config.Retry
+	retry.MaxRetries = 9
+	config.Vehicles = []VehicleConfig{
+		{VIN: "VIN_A", Name: "Model 3"},
+		{VIN: "VIN_B", PrivateKeyFile: "b.pem", Retry: &retry},
+	}
+
+	registry, err := NewRegistryFromConfig(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewRegistryFromConfig failed: %v", err)
+	}
+	if registry.Len() != 2 || registry.Default().GetVIN() != "VIN_A" {
+		t.Fatalf("Expected VIN_A first of 2 vehicles, got %d", registry.Len())
+	}
+	if registry.Name("VIN_A") != "Model 3" || registry.Name("VIN_B") != "" {
+		t.Errorf("Unexpected names %q, %q", registry.Name("VIN_A"), registry.Name("VIN_B"))
+	}
+
+	a, _ := registry.Get("VIN_A")
+	b, ok := registry.Get("VIN_B")
+	if !ok {
+		t.Fatal("VIN_B is not registered")
+	}
+	if a == b || a.circuitBreaker == b.circuitBreaker {
+		t.Error("Vehicles share a client or circuit breaker")
+	}
+	if b.GetPrivateKeyFile() != "b.pem" || b.retrySettings().MaxRetries != 9 || a.retrySettings().MaxRetries == 9 {
+		t.Errorf("Per-vehicle settings not applied: key %q, retries %d and %d", b.GetPrivateKeyFile(), a.retrySettings().MaxRetries, b.retrySettings().MaxRetries)
+	}
+
+	if _, ok := registry.Get("VIN_C"); ok {
+		t.Error("Expected VIN_C to be unknown")
+	}
+	if err := registry.Add(NewClient("VIN_A", nil), ""); err == nil {
+		t.Error("Expected an error registering VIN_A twice")
+	}
+
+	clients := registry.Clients()
+	if len(clients) != 2 || clients[0] != a || clients[1] != b {
+		t.Error("Clients not returned in config order")
+	}
+}
+
+func TestRegistryWithConfigManager(t *testing.T) {
+	config := DefaultConfig()
+	config.Vehicles = []VehicleConfig{{VIN: "VIN_A"}, {VIN: "VIN_B"}}
+	config.ConfigPath = t.TempDir() + "/config.json"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	configManager, err := NewConfigManager(config.ConfigPath, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to create config manager: %v", err)
+	}
+	defer configManager.Close()
+
+	registry, err := NewRegistryWithConfigManager(configManager, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewRegistryWithConfigManager failed: %v", err)
+	}
+
+	err = configManager.UpdateConfig(func(c *Config) {
+		retry := c.Retry
+		retry.MaxRetries = 4
+		c.Vehicles = []VehicleConfig{{VIN: "VIN_A"}, {VIN: "VIN_B", PrivateKeyFile: "b.pem", Retry: &retry}}
+	})
+	if err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	b, _ := registry.Get("VIN_B")
+	if b.GetPrivateKeyFile() != "b.pem" || b.retrySettings().MaxRetries != 4 {
+		t.Errorf("Config change not applied to VIN_B: key %q, retries %d", b.GetPrivateKeyFile(), b.retrySettings().MaxRetries)
+	}
+	if a, _ := registry.Get("VIN_A"); a.retrySettings().MaxRetries == 4 {
+		t.Error("VIN_B's retry override applied to VIN_A")
+	}
+}
@@ -2,11 +2,18 @@ package tesla
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/tracing"
 )
 
 func TestRetryWithBackoffHVAC(t *testing.T) {
@@ -268,3 +275,237 @@ func TestRetryWithBackoffLogging(t *testing.T) {
 		t.Errorf("Expected 2 calls, got %d", callCount)
 	}
 }
+
+func TestRetryWithBackoffTracing(t *testing.T) {
+	var mutex sync.Mutex
+	var spans []struct {
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Status       struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans json.RawMessage `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mutex.Lock()
+		defer mutex.Unlock()
+		json.Unmarshal(req.ResourceSpans[0].ScopeSpans[0].Spans, &spans)
+	}))
+	defer server.Close()
+
+	tracer, err := tracing.New(tracing.Config{Endpoint: server.URL}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0), RetryConfig{
+		MaxRetries:    1,
+		InitialDelay:  time.Millisecond,
+		MaxDelay:      time.Millisecond,
+		BackoffFactor: 2.0,
+	}, CircuitBreakerConfig{MaxFailures: 5, ResetTimeout: time.Minute, HalfOpenMaxCalls: 3})
+
+	// One span for the operation with a child for each attempt
+	calls := 0
+	client.retryWithBackoff(context.Background(), "connect", func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("timeout")
+		}
+		return nil
+	})
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(spans) != 3 || spans[2].Name != "tesla.connect" {
+		t.Fatalf("Expected two attempts and the operation, got %+v", spans)
+	}
+	for i, attempt := range spans[:2] {
+		if attempt.Name != "vehicle.connect" || attempt.ParentSpanID != spans[2].SpanID {
+			t.Errorf("Attempt %d: unexpected span %+v", i+1, attempt)
+		}
+	}
+	if spans[0].Status.Code != 2 || spans[1].Status.Code != 0 || spans[2].Status.Code != 0 {
+		t.Errorf("Expected only the first attempt to fail, got %+v", spans)
+	}
+}
+
+func TestCircuitOpenedEvent(t *testing.T) {
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0), RetryConfig{
+		MaxRetries:    3,
+		InitialDelay:  time.Millisecond,
+		MaxDelay:      time.Millisecond,
+		BackoffFactor: 2.0,
+	}, CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute, HalfOpenMaxCalls: 1})
+	events, unsubscribe := client.Events().Subscribe(8)
+	defer unsubscribe()
+
+	client.retryWithBackoff(context.Background(), "connect", func() error {
+		return errors.New("timeout")
+	})
+
+	var opened []CircuitOpened
+	for len(events) > 0 {
+		if event := <-events; event.Type == EventCircuitOpened {
+			opened = append(opened, event.Data.(CircuitOpened))
+		}
+	}
+	if len(opened) != 1 || opened[0].Operation != "connect" || opened[0].Error != "timeout" {
+		t.Errorf("Expected one circuit_opened event, got %+v", opened)
+	}
+}
+
+func TestCircuitStateChangedEvent(t *testing.T) {
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0), RetryConfig{
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond,
+	}, CircuitBreakerConfig{MaxFailures: 1, ResetTimeout: time.Minute, HalfOpenMaxCalls: 1})
+	events, unsubscribe := client.Events().Subscribe(8)
+	defer unsubscribe()
+
+	client.retryWithBackoff(context.Background(), "connect", func() error {
+		return errors.New("timeout")
+	})
+	client.ResetCircuit()
+
+	var changes []CircuitStateChange
+	for len(events) > 0 {
+		if event := <-events; event.Type == EventCircuitStateChanged {
+			changes = append(changes, event.Data.(CircuitStateChange))
+		}
+	}
+	if len(changes) != 2 || changes[0] != (CircuitStateChange{From: "closed", To: "open", Failures: 1}) ||
+		changes[1] != (CircuitStateChange{From: "open", To: "closed"}) {
+		t.Errorf("Expected the circuit to open and close, got %+v", changes)
+	}
+
+	var opened float64
+	for _, point := range client.MetricPoints() {
+		if point.Measurement == "tesla_circuit" && point.Tags["state"] == "open" {
+			opened = point.Fields["changes"]
+		}
+	}
+	if opened != 1 {
+		t.Errorf("Expected one change to open in the metrics, got %v", opened)
+	}
+}
+
+func TestJitterStrategies(t *testing.T) {
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0), RetryConfig{
+		InitialDelay:  time.Second,
+		MaxDelay:      10 * time.Second,
+		BackoffFactor: 2,
+		Jitter:        true,
+	}, CircuitBreakerConfig{MaxFailures: 5, ResetTimeout: time.Minute, HalfOpenMaxCalls: 1})
+
+	tests := []struct {
+		strategy string
+		previous time.Duration
+		min, max time.Duration
+	}{
+		// The backoff after attempt 1 is 2s
+		{JitterProportional, 0, 1750 * time.Millisecond, 2250 * time.Millisecond},
+		{JitterFull, 0, 0, 2 * time.Second},
+		{JitterDecorrelated, 2 * time.Second, time.Second, 6 * time.Second},
+		{JitterDecorrelated, 8 * time.Second, time.Second, 10 * time.Second}, // Capped at max_delay
+	}
+	for _, tt := range tests {
+		client.retryConfig.JitterStrategy = tt.strategy
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 100; i++ {
+			delay := client.nextDelay(1, tt.previous)
+			if delay < tt.min || delay > tt.max {
+				t.Errorf("%s: delay %v outside [%v, %v]", tt.strategy, delay, tt.min, tt.max)
+			}
+			seen[delay] = true
+		}
+		if len(seen) < 20 {
+			t.Errorf("%s: only %d different delays in 100 tries", tt.strategy, len(seen))
+		}
+	}
+
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Retry.JitterStrategy = "random"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an unknown jitter strategy to be rejected")
+	}
+}
+
+func TestFitDelay(t *testing.T) {
+	tests := []struct {
+		delay, remaining, want time.Duration
+		ok                     bool
+	}{
+		{time.Second, time.Minute, time.Second, true},
+		{time.Second, time.Second, 500 * time.Millisecond, true}, // Leaves half for a last attempt
+		{time.Second, 150 * time.Millisecond, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := fitDelay(tt.delay, tt.remaining); got != tt.want || ok != tt.ok {
+			t.Errorf("fitDelay(%v, %v) = %v, %t, want %v, %t", tt.delay, tt.remaining, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryWithinDeadline(t *testing.T) {
+	client := NewClientWithConfig("TEST_VIN", log.New(io.Discard, "", 0), RetryConfig{
+		MaxRetries:    10,
+		InitialDelay:  time.Second,
+		MaxDelay:      time.Second,
+		BackoffFactor: 2,
+	}, CircuitBreakerConfig{MaxFailures: 100, ResetTimeout: time.Minute, HalfOpenMaxCalls: 1})
+
+	// The caller's deadline cuts the first delay short for one last attempt,
+	// rather than sleeping past it
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	calls := 0
+	start := time.Now()
+	err := client.retryWithBackoff(ctx, "test_deadline", func() error {
+		calls++
+		return errors.New("test error")
+	})
+	if !errors.Is(err, ErrRetryExhausted) || calls != 2 {
+		t.Errorf("Expected 2 calls and retries exhausted, got %d calls and %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Errorf("Retries took %v, past the deadline", elapsed)
+	}
+
+	// So does the retry budget
+	client.retryConfig.InitialDelay = 50 * time.Millisecond
+	client.retryConfig.MaxElapsed = 250 * time.Millisecond
+	calls = 0
+	start = time.Now()
+	err = client.retryWithBackoff(context.Background(), "test_budget", func() error {
+		calls++
+		return errors.New("test error")
+	})
+	if !errors.Is(err, ErrRetryExhausted) || calls >= 11 {
+		t.Errorf("Expected the budget to stop retries, got %d calls and %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 250*time.Millisecond {
+		t.Errorf("Retries took %v, past the budget", elapsed)
+	}
+
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	config.Retry.MaxElapsed = -time.Second
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a negative retry budget to be rejected")
+	}
+}
@@ -0,0 +1,86 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// seatNames maps API names to seat positions. Backrest positions exist only
+// on some Model S vehicles.
+var seatNames = map[string]vehicle.SeatPosition{
+	"front_left":      vehicle.SeatFrontLeft,
+	"front_right":     vehicle.SeatFrontRight,
+	"rear_left":       vehicle.SeatSecondRowLeft,
+	"rear_left_back":  vehicle.SeatSecondRowLeftBack,
+	"rear_center":     vehicle.SeatSecondRowCenter,
+	"rear_right":      vehicle.SeatSecondRowRight,
+	"rear_right_back": vehicle.SeatSecondRowRightBack,
+	"third_row_left":  vehicle.SeatThirdRowLeft,
+	"third_row_right": vehicle.SeatThirdRowRight,
+}
+
+// HeatedSeats are the seats "all" refers to for seat heaters
+var HeatedSeats = []vehicle.SeatPosition{
+	vehicle.SeatFrontLeft,
+	vehicle.SeatFrontRight,
+	vehicle.SeatSecondRowLeft,
+	vehicle.SeatSecondRowCenter,
+	vehicle.SeatSecondRowRight,
+}
+
+// CooledSeats are the seats that have coolers
+var CooledSeats = []vehicle.SeatPosition{
+	vehicle.SeatFrontLeft,
+	vehicle.SeatFrontRight,
+}
+
+// ParseSeat parses a seat name such as front_left
+func ParseSeat(name string) (vehicle.SeatPosition, error) {
+	seat, ok := seatNames[name]
+	if !ok {
+		return vehicle.SeatUnknown, fmt.Errorf("unknown seat %q", name)
+	}
+	return seat, nil
+}
+
+// SeatName returns the API name of a seat position
+func SeatName(seat vehicle.SeatPosition) string {
+	for name, position := range seatNames {
+		if position == seat {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// ValidateSeatLevel checks a heater or cooler level is 0 (off) to 3 (high)
+func ValidateSeatLevel(level int) error {
+	if level < int(vehicle.LevelOff) || level > int(vehicle.LevelHigh) {
+		return fmt.Errorf("level must be between %d and %d", vehicle.LevelOff, vehicle.LevelHigh)
+	}
+	return nil
+}
+
+// SetSeatHeaters sets several seat heaters to the same level, stopping at the
+// first seat that fails
+func (c *Client) SetSeatHeaters(ctx context.Context, seats []vehicle.SeatPosition, level vehicle.Level) error {
+	for _, seat := range seats {
+		if err := c.SetSeatHeater(ctx, seat, level); err != nil {
+			return fmt.Errorf("%s seat heater: %w", SeatName(seat), err)
+		}
+	}
+	return nil
+}
+
+// SetSeatCoolers sets several seat coolers to the same level, stopping at the
+// first seat that fails
+func (c *Client) SetSeatCoolers(ctx context.Context, seats []vehicle.SeatPosition, level vehicle.Level) error {
+	for _, seat := range seats {
+		if err := c.SetSeatCooler(ctx, seat, level); err != nil {
+			return fmt.Errorf("%s seat cooler: %w", SeatName(seat), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+func TestParseSeat(t *testing.T) {
+	for name := range seatNames {
+		seat, err := ParseSeat(name)
+		if err != nil {
+			t.Errorf("ParseSeat(%q) failed: %v", name, err)
+		}
+		if SeatName(seat) != name {
+			t.Errorf("SeatName(%v) = %q, expected %q", seat, SeatName(seat), name)
+		}
+	}
+	if _, err := ParseSeat("trunk"); err == nil {
+		t.Error("Expected an error for an unknown seat")
+	}
+}
+
+func TestValidateSeatLevel(t *testing.T) {
+	for level := 0; level <= 3; level++ {
+		if err := ValidateSeatLevel(level); err != nil {
+			t.Errorf("Level %d: unexpected error %v", level, err)
+		}
+	}
+	for _, level := range []int{-1, 4} {
+		if err := ValidateSeatLevel(level); err == nil {
+			t.Errorf("Level %d: expected an error", level)
+		}
+	}
+}
+
+func TestSetSeatHeatersNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	err := client.SetSeatHeaters(context.Background(), HeatedSeats, vehicle.LevelHigh)
+	if !errors.Is(err, ErrNotConnected) || !strings.HasPrefix(err.Error(), "front_left seat heater") {
+		t.Errorf("Expected the first seat to fail with ErrNotConnected, got %v", err)
+	}
+	err = client.SetSeatCoolers(context.Background(), CooledSeats, vehicle.LevelLow)
+	if !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
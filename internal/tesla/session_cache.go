@@ -0,0 +1,128 @@
+package tesla
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+)
+
+// sessionCacher is a VehicleCommander that can resume its sessions from a
+// cache. *vehicle.Vehicle is one; the simulator has no sessions to resume.
+type sessionCacher interface {
+	LoadCachedSessions(c *cache.SessionCache) error
+	UpdateCachedSessions(c *cache.SessionCache) error
+}
+
+// cacherOf returns the sessionCacher under car's injected faults, if any
+func cacherOf(car VehicleCommander) (sessionCacher, bool) {
+	if faulty, ok := car.(*faultCommander); ok {
+		car = faulty.VehicleCommander
+	}
+	cacher, ok := car.(sessionCacher)
+	return cacher, ok
+}
+
+// SessionStore keeps a vehicle's session state, its counters, epochs and
+// clocks, in a file so a reconnect or a server restart resumes the sessions
+// without a handshake. The session keys aren't stored: they're derived again
+// from the private key and the vehicle's public key. A resumed session the
+// vehicle no longer accepts is resynchronized by the vehicle library on the
+// first command.
+type SessionStore struct {
+	path string
+}
+
+// NewSessionStore returns a store saving session state at path
+func NewSessionStore(path string) *SessionStore {
+	return &SessionStore{path: path}
+}
+
+// sessionStoreFromConfig returns the store for config's vehicle, or nil when
+// client.enable_session_cache isn't set
+func sessionStoreFromConfig(config *Config) *SessionStore {
+	if !config.Client.EnableSessionCache || config.Tesla.VIN == "" {
+		return nil
+	}
+	return NewSessionStore(filepath.Join(config.DataPath(), "sessions", config.Tesla.VIN+".json"))
+}
+
+// Load resumes car's sessions from the store, reporting whether there were
+// any to resume
+func (s *SessionStore) Load(car VehicleCommander) bool {
+	cacher, ok := cacherOf(car)
+	if s == nil || !ok {
+		return false
+	}
+	sessions, err := cache.ImportFromFile(s.path)
+	if err != nil {
+		return false
+	}
+	return cacher.LoadCachedSessions(sessions) == nil
+}
+
+// Save writes car's sessions to the store, replacing the file atomically
+func (s *SessionStore) Save(car VehicleCommander) error {
+	cacher, ok := cacherOf(car)
+	if s == nil || !ok {
+		return nil
+	}
+	sessions := cache.New(1)
+	if err := cacher.UpdateCachedSessions(sessions); err != nil {
+		return fmt.Errorf("failed to export sessions: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create session cache directory: %w", err)
+	}
+	var data bytes.Buffer
+	if err := sessions.Export(&data); err != nil {
+		return fmt.Errorf("failed to export sessions: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write session cache: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write session cache: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the stored sessions, so the next connection starts new ones
+func (s *SessionStore) Clear() error {
+	if s == nil {
+		return nil
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetSessionStore keeps the vehicle's sessions in store across connections.
+// A nil store starts a new session on every connection.
+func (c *Client) SetSessionStore(store *SessionStore) {
+	c.transportMutex.Lock()
+	defer c.transportMutex.Unlock()
+	c.sessions = store
+}
+
+// sessionStore returns the client's session store, if any
+func (c *Client) sessionStore() *SessionStore {
+	c.transportMutex.RLock()
+	defer c.transportMutex.RUnlock()
+	return c.sessions
+}
+
+// saveSessions stores the connected vehicle's sessions, logging a failure
+func (c *Client) saveSessions() {
+	if c.vehicle == nil {
+		return
+	}
+	if err := c.sessionStore().Save(c.vehicle); err != nil {
+		c.logger.Printf("warn: Failed to save sessions for %s: %v", c.vin, err)
+	}
+}
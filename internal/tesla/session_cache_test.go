@@ -0,0 +1,104 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/dispatcher"
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+)
+
+// cachingVehicle is a fakeVehicle with session state to cache, like
+// *vehicle.Vehicle
+type cachingVehicle struct {
+	*fakeVehicle
+	session []byte // Exported to the cache
+	loaded  []byte // Loaded from the cache
+}
+
+func (v *cachingVehicle) UpdateCachedSessions(c *cache.SessionCache) error {
+	return c.Update("TEST_VIN", []dispatcher.CacheEntry{{CreatedAt: time.Now(), Domain: 2, SessionInfo: v.session}})
+}
+
+func (v *cachingVehicle) LoadCachedSessions(c *cache.SessionCache) error {
+	entries, ok := c.GetEntry("TEST_VIN")
+	if !ok || len(entries) == 0 {
+		return os.ErrNotExist
+	}
+	v.loaded = entries[0].SessionInfo
+	return nil
+}
+
+func TestClientResumesCachedSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions", "TEST_VIN.json")
+	first := &cachingVehicle{fakeVehicle: newFakeVehicle(), session: []byte("counter=7")}
+	client, _ := newFakeClient(t, first.fakeVehicle)
+	client.Disconnect()
+
+	// Sessions are saved once started, and again as the connection closes
+	client.SetSessionStore(NewSessionStore(path))
+	client.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return first, nil
+	})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if first.loaded != nil {
+		t.Errorf("Expected nothing to resume from an empty store, got %q", first.loaded)
+	}
+	first.session = []byte("counter=9")
+	client.Disconnect()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private session cache file, got %v, %v", info, err)
+	}
+
+	// A restarted client resumes them
+	second := &cachingVehicle{fakeVehicle: newFakeVehicle()}
+	restarted, _ := newFakeClient(t, newFakeVehicle())
+	restarted.Disconnect()
+	restarted.SetSessionStore(NewSessionStore(path))
+	restarted.SetVehicleFactory(func(Connector, authentication.ECDHPrivateKey) (VehicleCommander, error) {
+		return second, nil
+	})
+	if err := restarted.Connect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(second.loaded, []byte("counter=9")) {
+		t.Errorf("Expected the last saved session to be resumed, got %q", second.loaded)
+	}
+	if second.called("StartSession") != 1 {
+		t.Errorf("Expected StartSession to still be called, got %v", second.calls)
+	}
+
+	if err := NewSessionStore(path).Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected Clear to remove the cache, got %v", err)
+	}
+}
+
+func TestSessionStoreFromConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	config.Tesla.VIN = "5YJ3E1EA7KF000001"
+	store := sessionStoreFromConfig(config)
+	if store == nil || store.path != filepath.Join(config.DataDir, "sessions", "5YJ3E1EA7KF000001.json") {
+		t.Errorf("Unexpected store %+v", store)
+	}
+
+	config.Client.EnableSessionCache = false
+	if store := sessionStoreFromConfig(config); store != nil {
+		t.Errorf("Expected no store with the cache disabled, got %+v", store)
+	}
+	// A nil store resumes and saves nothing
+	var none *SessionStore
+	if none.Load(&cachingVehicle{fakeVehicle: newFakeVehicle()}) || none.Save(&cachingVehicle{fakeVehicle: newFakeVehicle()}) != nil {
+		t.Error("Expected a nil store to do nothing")
+	}
+}
@@ -0,0 +1,112 @@
+package tesla
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// setpointLimiter spaces out writes of each setpoint so chatty clients, such
+// as a UI slider, can't saturate the BLE session. A write that arrives
+// within the interval of the previous one is queued; a newer write for the
+// same setpoint replaces the queued value, so only the latest is sent.
+// Callers whose value was replaced get the result of the write that
+// replaced it.
+type setpointLimiter struct {
+	mu    sync.Mutex
+	slots map[string]*setpointSlot
+}
+
+// setpointSlot tracks writes of one setpoint
+type setpointSlot struct {
+	lastWrite time.Time
+	pending   *setpointWrite
+	draining  bool
+}
+
+// setpointWrite is a queued write and everyone waiting on it
+type setpointWrite struct {
+	ctx     context.Context
+	fn      func(ctx context.Context) error
+	waiters []chan error
+}
+
+// do runs fn for the setpoint key, no sooner than interval after the last
+// write of that setpoint
+func (l *setpointLimiter) do(ctx context.Context, key string, interval time.Duration, fn func(ctx context.Context) error) error {
+	if interval <= 0 {
+		return fn(ctx)
+	}
+
+	result := make(chan error, 1)
+
+	l.mu.Lock()
+	if l.slots == nil {
+		l.slots = make(map[string]*setpointSlot)
+	}
+	slot, ok := l.slots[key]
+	if !ok {
+		slot = &setpointSlot{}
+		l.slots[key] = slot
+	}
+
+	if slot.pending != nil {
+		// Replace the queued value; its callers get this write's result
+		slot.pending.ctx = ctx
+		slot.pending.fn = fn
+		slot.pending.waiters = append(slot.pending.waiters, result)
+	} else {
+		slot.pending = &setpointWrite{ctx: ctx, fn: fn, waiters: []chan error{result}}
+	}
+	if !slot.draining {
+		slot.draining = true
+		go l.drain(slot, interval)
+	}
+	l.mu.Unlock()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain sends queued writes for a slot, spaced by interval, until none are
+// left
+func (l *setpointLimiter) drain(slot *setpointSlot, interval time.Duration) {
+	for {
+		l.mu.Lock()
+		write := slot.pending
+		if write == nil {
+			slot.draining = false
+			l.mu.Unlock()
+			return
+		}
+		if wait := interval - time.Since(slot.lastWrite); wait > 0 {
+			l.mu.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		slot.pending = nil
+		slot.lastWrite = time.Now()
+		l.mu.Unlock()
+
+		err := write.fn(write.ctx)
+		for _, waiter := range write.waiters {
+			waiter <- err
+		}
+	}
+}
+
+// limitSetpoint runs a setpoint write through the client's rate limit
+func (c *Client) limitSetpoint(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	return c.setpoints.do(ctx, key, c.setpointSettings(), fn)
+}
+
+// setpointSettings returns the minimum interval between writes of a setpoint
+func (c *Client) setpointSettings() time.Duration {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+	return c.setpointInterval
+}
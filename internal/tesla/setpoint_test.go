@@ -0,0 +1,155 @@
+package tesla
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetpointLimiterFirstWriteImmediate(t *testing.T) {
+	var l setpointLimiter
+
+	start := time.Now()
+	err := l.do(context.Background(), "set_temperature", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected first write to run immediately, took %v", elapsed)
+	}
+}
+
+func TestSetpointLimiterCoalesces(t *testing.T) {
+	var l setpointLimiter
+	interval := 100 * time.Millisecond
+
+	var mu sync.Mutex
+	var written []int
+	write := func(value int) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			written = append(written, value)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	if err := l.do(context.Background(), "set_temperature", interval, write(1)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A burst within the interval should only send the last value
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = l.do(context.Background(), "set_temperature", interval, write(i+2))
+		}(i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Write %d: unexpected error: %v", i, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(written) != 2 || written[0] != 1 || written[1] != 4 {
+		t.Errorf("Expected writes [1 4], got %v", written)
+	}
+}
+
+func TestSetpointLimiterSpacesWrites(t *testing.T) {
+	var l setpointLimiter
+	interval := 100 * time.Millisecond
+	noop := func(ctx context.Context) error { return nil }
+
+	start := time.Now()
+	l.do(context.Background(), "set_fan_speed", interval, noop)
+	l.do(context.Background(), "set_fan_speed", interval, noop)
+	if elapsed := time.Since(start); elapsed < interval {
+		t.Errorf("Expected second write to wait %v, took %v", interval, elapsed)
+	}
+
+	// Other setpoints aren't held back
+	start = time.Now()
+	l.do(context.Background(), "set_seat_heater:0", interval, noop)
+	if elapsed := time.Since(start); elapsed > interval/2 {
+		t.Errorf("Expected another setpoint to write immediately, took %v", elapsed)
+	}
+}
+
+func TestSetpointLimiterSupersededGetsResult(t *testing.T) {
+	var l setpointLimiter
+	interval := 100 * time.Millisecond
+
+	l.do(context.Background(), "set_temperature", interval, func(ctx context.Context) error { return nil })
+
+	failed := ErrNotConnected
+	first := make(chan error, 1)
+	go func() {
+		first <- l.do(context.Background(), "set_temperature", interval, func(ctx context.Context) error {
+			t.Error("Superseded write should not run")
+			return nil
+		})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := l.do(context.Background(), "set_temperature", interval, func(ctx context.Context) error {
+		return failed
+	}); err != failed {
+		t.Errorf("Expected %v, got %v", failed, err)
+	}
+	if err := <-first; err != failed {
+		t.Errorf("Expected superseded caller to get %v, got %v", failed, err)
+	}
+}
+
+func TestSetpointLimiterCanceled(t *testing.T) {
+	var l setpointLimiter
+	interval := time.Second
+	noop := func(ctx context.Context) error { return nil }
+
+	l.do(context.Background(), "set_temperature", interval, noop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.do(ctx, "set_temperature", interval, noop); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestSetpointLimiterDisabled(t *testing.T) {
+	var l setpointLimiter
+	calls := 0
+	for i := 0; i < 3; i++ {
+		l.do(context.Background(), "set_temperature", 0, func(ctx context.Context) error {
+			calls++
+			return nil
+		})
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 writes with limiting disabled, got %d", calls)
+	}
+}
+
+func TestClientSetpointInterval(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if interval := client.setpointSettings(); interval != 0 {
+		t.Errorf("Expected setpoint limiting disabled by default, got %v", interval)
+	}
+
+	tuning := client.Tuning()
+	tuning.SetpointInterval = 2 * time.Second
+	client.ApplyTuning(tuning)
+	if interval := client.setpointSettings(); interval != 2*time.Second {
+		t.Errorf("Expected interval 2s, got %v", interval)
+	}
+}
@@ -0,0 +1,582 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// SimulatorVIN is the VIN of the simulated vehicle in development mode
+const SimulatorVIN = "5YJ3SIMULATED0001"
+
+// Simulated vehicle physics
+const (
+	simCabinTau       = 5 * time.Minute  // Time constant of the cabin reaching the setpoint with climate on
+	simSoakTau        = 30 * time.Minute // Time constant of the cabin drifting towards outside with climate off
+	simSolarGain      = 8.0              // Degrees the sun heats a parked cabin above outside at midday
+	simPackKWh        = 75.0             // Usable battery capacity
+	simChargerKW      = 7.0              // Home charger power
+	simKmPerPercent   = 5.0              // Rated range per percent of charge
+	simMinTempCelsius = 15
+	simMaxTempCelsius = 28
+)
+
+// errSimulatorUnsupported is returned for state the simulator doesn't model
+var errSimulatorUnsupported = errors.New("not supported by the simulated vehicle")
+
+// SimulatedVehicle is an in-memory vehicle for development without BLE
+// hardware or a car. Its cabin warms or cools towards the setpoint while
+// climate is on and drifts towards a daily outside temperature cycle while
+// it is off, its battery drains with climate on and charges while plugged
+// in below the charge limit, and it answers every command the client sends.
+type SimulatedVehicle struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	updated time.Time
+
+	climateOn      bool
+	autoMode       bool
+	driverTemp     float64
+	passengerTemp  float64
+	insideTemp     float64
+	keeper         vehicle.ClimateKeeperMode
+	defrost        bool
+	bioweapon      bool
+	copEnabled     bool
+	copFanOnly     bool
+	copLevel       vehicle.Level
+	seatHeaters    map[vehicle.SeatPosition]vehicle.Level
+	steeringHeater bool
+
+	battery     float64 // Percent
+	chargeLimit int
+	pluggedIn   bool
+
+	departureEnabled bool
+	departAt         time.Duration
+	offPeakEnd       time.Duration
+	preconditioning  vehicle.ChargingPolicy
+	offPeak          vehicle.ChargingPolicy
+
+	keys []*vcsec.WhitelistEntryInfo // Enrolled keys, in slot order
+}
+
+// NewSimulatedVehicle creates a parked, plugged-in vehicle with climate off
+func NewSimulatedVehicle() *SimulatedVehicle {
+	s := &SimulatedVehicle{
+		now:           time.Now,
+		autoMode:      true,
+		driverTemp:    21,
+		passengerTemp: 21,
+		keeper:        vehicle.ClimateKeeperModeOff,
+		copLevel:      vehicle.LevelMed,
+		seatHeaters:   make(map[vehicle.SeatPosition]vehicle.Level),
+		battery:       64,
+		chargeLimit:   80,
+		pluggedIn:     true,
+	}
+	s.updated = s.now()
+	s.insideTemp = s.outsideTemp(s.updated)
+	// The owner's phone key
+	if phone, err := ecdh.P256().GenerateKey(rand.Reader); err == nil {
+		s.addKey(phone.PublicKey(), keys.Role_ROLE_OWNER, vcsec.KeyFormFactor_KEY_FORM_FACTOR_IOS_DEVICE)
+	}
+	return s
+}
+
+// outsideTemp is a daily cycle between 8°C before dawn and 22°C mid-afternoon
+func (s *SimulatedVehicle) outsideTemp(t time.Time) float64 {
+	hour := float64(t.Hour()) + float64(t.Minute())/60
+	return 15 + 7*math.Sin((hour-9)/24*2*math.Pi)
+}
+
+// running reports whether the HVAC system is conditioning the cabin
+func (s *SimulatedVehicle) running() bool {
+	return s.climateOn || s.keeper != vehicle.ClimateKeeperModeOff
+}
+
+// advance moves the simulation forward to now. It must be called with mu
+// held before the state is read or changed.
+func (s *SimulatedVehicle) advance() {
+	now := s.now()
+	dt := now.Sub(s.updated)
+	if dt <= 0 {
+		return
+	}
+	s.updated = now
+
+	target, tau := s.outsideTemp(now), simSoakTau
+	if s.running() {
+		target, tau = s.driverTemp, simCabinTau
+		s.battery -= DefaultClimatePowerKW * dt.Hours() / simPackKWh * 100
+	} else {
+		// A parked cabin in the sun gets hotter than outside
+		hour := float64(now.Hour())
+		if hour > 6 && hour < 20 {
+			target += simSolarGain * math.Sin((hour-6)/14*math.Pi)
+		}
+	}
+	s.insideTemp += (target - s.insideTemp) * (1 - math.Exp(-float64(dt)/float64(tau)))
+
+	if s.charging() {
+		s.battery = math.Min(float64(s.chargeLimit), s.battery+simChargerKW*dt.Hours()/simPackKWh*100)
+	}
+	s.battery = math.Max(0, s.battery)
+}
+
+// charging reports whether the vehicle is charging
+func (s *SimulatedVehicle) charging() bool {
+	return s.pluggedIn && s.battery < float64(s.chargeLimit)
+}
+
+// update advances the simulation and applies a change
+func (s *SimulatedVehicle) update(change func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+	change()
+	return nil
+}
+
+// Connect succeeds at once
+func (s *SimulatedVehicle) Connect(ctx context.Context) error {
+	return nil
+}
+
+// StartSession succeeds at once
+func (s *SimulatedVehicle) StartSession(ctx context.Context, domains []universal.Domain) error {
+	return nil
+}
+
+// Disconnect does nothing; the simulation keeps running
+func (s *SimulatedVehicle) Disconnect() {}
+
+// Ping succeeds at once
+func (s *SimulatedVehicle) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Wakeup succeeds at once; the simulated vehicle never sleeps
+func (s *SimulatedVehicle) Wakeup(ctx context.Context) error {
+	return nil
+}
+
+// BodyControllerState reports the vehicle awake with nobody inside
+func (s *SimulatedVehicle) BodyControllerState(ctx context.Context) (*vcsec.VehicleStatus, error) {
+	return &vcsec.VehicleStatus{
+		VehicleSleepStatus: vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_AWAKE,
+		UserPresence:       vcsec.UserPresence_E_VEHICLE_USER_PRESENCE_NOT_PRESENT,
+	}, nil
+}
+
+// GetState returns the simulated state of one category
+func (s *SimulatedVehicle) GetState(ctx context.Context, category vehicle.StateCategory) (*carserver.VehicleData, error) {
+	return s.GetStates(ctx, category)
+}
+
+// GetStates returns the simulated climate, charge, closures and drive state
+func (s *SimulatedVehicle) GetStates(ctx context.Context, categories ...vehicle.StateCategory) (*carserver.VehicleData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	timestamp := timestamppb.New(s.updated)
+	data := &carserver.VehicleData{}
+	for _, category := range categories {
+		switch category {
+		case vehicle.StateCategoryClimate:
+			data.ClimateState = s.climateState(timestamp)
+		case vehicle.StateCategoryCharge:
+			data.ChargeState = s.chargeState(timestamp)
+		case vehicle.StateCategoryClosures:
+			data.ClosuresState = &carserver.ClosuresState{
+				OptionalLocked:        &carserver.ClosuresState_Locked{Locked: true},
+				OptionalIsUserPresent: &carserver.ClosuresState_IsUserPresent{IsUserPresent: false},
+				Timestamp:             timestamp,
+			}
+		case vehicle.StateCategoryDrive:
+			data.DriveState = &carserver.DriveState{
+				ShiftState: &carserver.ShiftState{Type: &carserver.ShiftState_P{P: &carserver.Void{}}},
+				OptionalOdometerInHundredthsOfAMile: &carserver.DriveState_OdometerInHundredthsOfAMile{
+					OdometerInHundredthsOfAMile: 1234567,
+				},
+				Timestamp: timestamp,
+			}
+		default:
+			return nil, fmt.Errorf("state category %d: %w", category, errSimulatorUnsupported)
+		}
+	}
+	return data, nil
+}
+
+// climateState reports the simulated climate state
+func (s *SimulatedVehicle) climateState(timestamp *timestamppb.Timestamp) *carserver.ClimateState {
+	fan := int32(0)
+	if s.running() {
+		// Auto mode runs the fan harder the further the cabin is from the
+		// setpoint
+		fan = int32(math.Min(10, 2+math.Abs(s.driverTemp-s.insideTemp)))
+	}
+
+	copState := carserver.ClimateState_CabinOverheatProtectionOff
+	if s.copEnabled && s.copFanOnly {
+		copState = carserver.ClimateState_CabinOverheatProtectionFanOnly
+	} else if s.copEnabled {
+		copState = carserver.ClimateState_CabinOverheatProtectionOn
+	}
+	copTemp := carserver.ClimateState_CopActivationTempMedium
+	switch s.copLevel {
+	case vehicle.LevelLow:
+		copTemp = carserver.ClimateState_CopActivationTempLow
+	case vehicle.LevelHigh:
+		copTemp = carserver.ClimateState_CopActivationTempHigh
+	}
+	keeper := &carserver.ClimateState_ClimateKeeperMode{Type: &carserver.ClimateState_ClimateKeeperMode_Off{Off: &carserver.Void{}}}
+	switch s.keeper {
+	case vehicle.ClimateKeeperModeOn:
+		keeper.Type = &carserver.ClimateState_ClimateKeeperMode_On{On: &carserver.Void{}}
+	case vehicle.ClimateKeeperModeDog:
+		keeper.Type = &carserver.ClimateState_ClimateKeeperMode_Dog{Dog: &carserver.Void{}}
+	case vehicle.ClimateKeeperModeCamp:
+		keeper.Type = &carserver.ClimateState_ClimateKeeperMode_Party{Party: &carserver.Void{}}
+	}
+	stwLevel := carserver.StwHeatLevel_StwHeatLevel_Off
+	if s.steeringHeater {
+		stwLevel = carserver.StwHeatLevel_StwHeatLevel_High
+	}
+
+	return &carserver.ClimateState{
+		OptionalIsClimateOn:            &carserver.ClimateState_IsClimateOn{IsClimateOn: s.running()},
+		OptionalDriverTempSetting:      &carserver.ClimateState_DriverTempSetting{DriverTempSetting: float32(s.driverTemp)},
+		OptionalPassengerTempSetting:   &carserver.ClimateState_PassengerTempSetting{PassengerTempSetting: float32(s.passengerTemp)},
+		OptionalInsideTempCelsius:      &carserver.ClimateState_InsideTempCelsius{InsideTempCelsius: float32(round1(s.insideTemp))},
+		OptionalOutsideTempCelsius:     &carserver.ClimateState_OutsideTempCelsius{OutsideTempCelsius: float32(round1(s.outsideTemp(s.updated)))},
+		OptionalFanStatus:              &carserver.ClimateState_FanStatus{FanStatus: fan},
+		OptionalIsFrontDefrosterOn:     &carserver.ClimateState_IsFrontDefrosterOn{IsFrontDefrosterOn: s.defrost},
+		OptionalIsRearDefrosterOn:      &carserver.ClimateState_IsRearDefrosterOn{IsRearDefrosterOn: s.defrost},
+		OptionalIsAutoConditioningOn:   &carserver.ClimateState_IsAutoConditioningOn{IsAutoConditioningOn: s.running() && s.autoMode},
+		OptionalMinAvailTempCelsius:    &carserver.ClimateState_MinAvailTempCelsius{MinAvailTempCelsius: simMinTempCelsius},
+		OptionalMaxAvailTempCelsius:    &carserver.ClimateState_MaxAvailTempCelsius{MaxAvailTempCelsius: simMaxTempCelsius},
+		OptionalIsPreconditioning:      &carserver.ClimateState_IsPreconditioning{IsPreconditioning: s.running()},
+		OptionalBioweaponModeOn:        &carserver.ClimateState_BioweaponModeOn{BioweaponModeOn: s.bioweapon},
+		OptionalSteeringWheelHeater:    &carserver.ClimateState_SteeringWheelHeater{SteeringWheelHeater: s.steeringHeater},
+		OptionalSteeringWheelHeatLevel: &carserver.ClimateState_SteeringWheelHeatLevel{SteeringWheelHeatLevel: stwLevel},
+		OptionalCabinOverheatProtection: &carserver.ClimateState_CabinOverheatProtection{
+			CabinOverheatProtection: copState,
+		},
+		OptionalCopActivationTemperature: &carserver.ClimateState_CopActivationTemperature{
+			CopActivationTemperature: copTemp,
+		},
+		ClimateKeeperMode: keeper,
+		Timestamp:         timestamp,
+	}
+}
+
+// chargeState reports the simulated charge state and departure schedule
+func (s *SimulatedVehicle) chargeState(timestamp *timestamppb.Timestamp) *carserver.ChargeState {
+	charging := &carserver.ChargeState_ChargingState{Type: &carserver.ChargeState_ChargingState_Disconnected{Disconnected: &carserver.Void{}}}
+	power, minutes := int32(0), int32(0)
+	switch {
+	case s.charging():
+		charging.Type = &carserver.ChargeState_ChargingState_Charging{Charging: &carserver.Void{}}
+		power = simChargerKW
+		minutes = int32((float64(s.chargeLimit) - s.battery) / 100 * simPackKWh / simChargerKW * 60)
+	case s.pluggedIn:
+		charging.Type = &carserver.ChargeState_ChargingState_Complete{Complete: &carserver.Void{}}
+	}
+
+	mode := carserver.ChargeState_ScheduledChargingModeOff
+	if s.departureEnabled {
+		mode = carserver.ChargeState_ScheduledChargingModeDepartBy
+	}
+	state := &carserver.ChargeState{
+		ChargingState:               charging,
+		OptionalBatteryLevel:        &carserver.ChargeState_BatteryLevel{BatteryLevel: int32(s.battery)},
+		OptionalUsableBatteryLevel:  &carserver.ChargeState_UsableBatteryLevel{UsableBatteryLevel: int32(s.battery)},
+		OptionalChargeLimitSoc:      &carserver.ChargeState_ChargeLimitSoc{ChargeLimitSoc: int32(s.chargeLimit)},
+		OptionalBatteryRange:        &carserver.ChargeState_BatteryRange{BatteryRange: float32(s.battery * simKmPerPercent / kmPerMile)},
+		OptionalChargerPower:        &carserver.ChargeState_ChargerPower{ChargerPower: power},
+		OptionalMinutesToFullCharge: &carserver.ChargeState_MinutesToFullCharge{MinutesToFullCharge: minutes},
+		OptionalScheduledChargingMode: &carserver.ChargeState_ScheduledChargingMode_{
+			ScheduledChargingMode: mode,
+		},
+		OptionalScheduledDepartureTimeMinutes: &carserver.ChargeState_ScheduledDepartureTimeMinutes{
+			ScheduledDepartureTimeMinutes: uint32(s.departAt / time.Minute),
+		},
+		OptionalOffPeakHoursEndTime: &carserver.ChargeState_OffPeakHoursEndTime{
+			OffPeakHoursEndTime: uint32(s.offPeakEnd / time.Minute),
+		},
+		Timestamp: timestamp,
+	}
+	switch s.preconditioning {
+	case vehicle.ChargingPolicyAllDays:
+		state.PreconditioningTimes = &carserver.PreconditioningTimes{Times: &carserver.PreconditioningTimes_AllWeek{AllWeek: &carserver.Void{}}}
+	case vehicle.ChargingPolicyWeekdays:
+		state.PreconditioningTimes = &carserver.PreconditioningTimes{Times: &carserver.PreconditioningTimes_Weekdays{Weekdays: &carserver.Void{}}}
+	}
+	switch s.offPeak {
+	case vehicle.ChargingPolicyAllDays:
+		state.OffPeakChargingTimes = &carserver.OffPeakChargingTimes{Times: &carserver.OffPeakChargingTimes_AllWeek{AllWeek: &carserver.Void{}}}
+	case vehicle.ChargingPolicyWeekdays:
+		state.OffPeakChargingTimes = &carserver.OffPeakChargingTimes{Times: &carserver.OffPeakChargingTimes_Weekdays{Weekdays: &carserver.Void{}}}
+	}
+	return state
+}
+
+// ClimateOn turns climate on
+func (s *SimulatedVehicle) ClimateOn(ctx context.Context) error {
+	return s.update(func() { s.climateOn = true })
+}
+
+// ClimateOff turns climate off, along with any keeper mode
+func (s *SimulatedVehicle) ClimateOff(ctx context.Context) error {
+	return s.update(func() {
+		s.climateOn = false
+		s.keeper = vehicle.ClimateKeeperModeOff
+		s.defrost = false
+	})
+}
+
+// ChangeClimateTemp sets the setpoints, within the vehicle's range
+func (s *SimulatedVehicle) ChangeClimateTemp(ctx context.Context, driverCelsius float32, passengerCelsius float32) error {
+	for _, temp := range []float32{driverCelsius, passengerCelsius} {
+		if temp < simMinTempCelsius || temp > simMaxTempCelsius {
+			return fmt.Errorf("temperature %.1f°C is outside %d-%d°C", temp, simMinTempCelsius, simMaxTempCelsius)
+		}
+	}
+	return s.update(func() {
+		s.driverTemp, s.passengerTemp = float64(driverCelsius), float64(passengerCelsius)
+	})
+}
+
+// SetClimateAutoMode turns climate on or off, in auto mode or not
+func (s *SimulatedVehicle) SetClimateAutoMode(ctx context.Context, powerOn, auto bool) error {
+	return s.update(func() { s.climateOn, s.autoMode = powerOn, auto })
+}
+
+// SetClimateKeeperMode sets the keeper mode, which keeps climate running
+func (s *SimulatedVehicle) SetClimateKeeperMode(ctx context.Context, mode vehicle.ClimateKeeperMode, override bool) error {
+	return s.update(func() { s.keeper = mode })
+}
+
+// SetPreconditioningMax turns the defrosters on or off, with climate
+func (s *SimulatedVehicle) SetPreconditioningMax(ctx context.Context, enabled bool, manualOverride bool) error {
+	return s.update(func() {
+		s.defrost = enabled
+		if enabled {
+			s.climateOn = true
+		}
+	})
+}
+
+// SetBioweaponDefenseMode turns Bioweapon Defense Mode on or off
+func (s *SimulatedVehicle) SetBioweaponDefenseMode(ctx context.Context, enabled bool, manualOverride bool) error {
+	return s.update(func() { s.bioweapon = enabled })
+}
+
+// SetCabinOverheatProtection sets the Cabin Overheat Protection mode
+func (s *SimulatedVehicle) SetCabinOverheatProtection(ctx context.Context, enabled bool, fanOnly bool) error {
+	return s.update(func() { s.copEnabled, s.copFanOnly = enabled, fanOnly })
+}
+
+// SetCabinOverheatProtectionTemperature sets the Cabin Overheat Protection
+// limit
+func (s *SimulatedVehicle) SetCabinOverheatProtectionTemperature(ctx context.Context, level vehicle.Level) error {
+	return s.update(func() { s.copLevel = level })
+}
+
+// SetSeatHeater sets seat heater levels
+func (s *SimulatedVehicle) SetSeatHeater(ctx context.Context, levels map[vehicle.SeatPosition]vehicle.Level) error {
+	return s.update(func() {
+		for seat, level := range levels {
+			s.seatHeaters[seat] = level
+		}
+	})
+}
+
+// SetSeatCooler accepts a front seat cooler level
+func (s *SimulatedVehicle) SetSeatCooler(ctx context.Context, level vehicle.Level, seat vehicle.SeatPosition) error {
+	return s.update(func() {})
+}
+
+// SetSteeringWheelHeater turns the steering wheel heater on or off
+func (s *SimulatedVehicle) SetSteeringWheelHeater(ctx context.Context, enabled bool) error {
+	return s.update(func() { s.steeringHeater = enabled })
+}
+
+// ScheduleDeparture sets the departure schedule
+func (s *SimulatedVehicle) ScheduleDeparture(ctx context.Context, departAt, offPeakEndTime time.Duration, preconditioning, offpeak vehicle.ChargingPolicy) error {
+	if departAt < 0 || departAt > 24*time.Hour {
+		return fmt.Errorf("invalid departure time")
+	}
+	return s.update(func() {
+		s.departureEnabled = true
+		s.departAt, s.offPeakEnd = departAt, offPeakEndTime
+		s.preconditioning, s.offPeak = preconditioning, offpeak
+	})
+}
+
+// ClearScheduledDeparture turns the departure schedule off
+func (s *SimulatedVehicle) ClearScheduledDeparture(ctx context.Context) error {
+	return s.update(func() {
+		s.departureEnabled = false
+		s.preconditioning, s.offPeak = vehicle.ChargingPolicyOff, vehicle.ChargingPolicyOff
+	})
+}
+
+// addKey enrolls a key in the first free slot, replacing it if already
+// enrolled. It must be called with mu held.
+func (s *SimulatedVehicle) addKey(publicKey *ecdh.PublicKey, role keys.Role, formFactor vcsec.KeyFormFactor) {
+	s.removeKey(publicKey)
+	slot := uint32(0)
+	for _, key := range s.keys {
+		if key.Slot == slot {
+			slot++
+		}
+	}
+	entry := &vcsec.WhitelistEntryInfo{
+		PublicKey:      &vcsec.PublicKey{PublicKeyRaw: publicKey.Bytes()},
+		MetadataForKey: &vcsec.KeyMetadata{KeyFormFactor: formFactor},
+		Slot:           slot,
+		KeyRole:        role,
+	}
+	s.keys = append(s.keys, entry)
+	sort.Slice(s.keys, func(i, j int) bool { return s.keys[i].Slot < s.keys[j].Slot })
+}
+
+// removeKey removes a key, reporting whether it was enrolled. It must be
+// called with mu held.
+func (s *SimulatedVehicle) removeKey(publicKey *ecdh.PublicKey) bool {
+	for i, key := range s.keys {
+		if bytes.Equal(key.GetPublicKey().GetPublicKeyRaw(), publicKey.Bytes()) {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SendAddKeyRequestWithRole enrolls the key at once, as if a key card had
+// been tapped
+func (s *SimulatedVehicle) SendAddKeyRequestWithRole(ctx context.Context, publicKey *ecdh.PublicKey, role keys.Role, formFactor vcsec.KeyFormFactor) error {
+	return s.update(func() {
+		s.addKey(publicKey, role, formFactor)
+	})
+}
+
+// SessionInfo reports whether a key is enrolled
+func (s *SimulatedVehicle) SessionInfo(ctx context.Context, publicKey *ecdh.PublicKey, domain universal.Domain) (*signatures.SessionInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := &signatures.SessionInfo{Status: signatures.Session_Info_Status_SESSION_INFO_STATUS_KEY_NOT_ON_WHITELIST}
+	for _, key := range s.keys {
+		if bytes.Equal(key.GetPublicKey().GetPublicKeyRaw(), publicKey.Bytes()) {
+			info.Status = signatures.Session_Info_Status_SESSION_INFO_STATUS_OK
+		}
+	}
+	return info, nil
+}
+
+// KeySummary reports the occupied key slots
+func (s *SimulatedVehicle) KeySummary(ctx context.Context) (*vcsec.WhitelistInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := &vcsec.WhitelistInfo{NumberOfEntries: uint32(len(s.keys))}
+	for _, key := range s.keys {
+		info.SlotMask |= 1 << key.Slot
+	}
+	return info, nil
+}
+
+// KeyInfoBySlot describes the key in a slot
+func (s *SimulatedVehicle) KeyInfoBySlot(ctx context.Context, slot uint32) (*vcsec.WhitelistEntryInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.keys {
+		if key.Slot == slot {
+			return proto.Clone(key).(*vcsec.WhitelistEntryInfo), nil
+		}
+	}
+	return nil, fmt.Errorf("no key in slot %d", slot)
+}
+
+// RemoveKey removes a key from the whitelist
+func (s *SimulatedVehicle) RemoveKey(ctx context.Context, publicKey *ecdh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.removeKey(publicKey) {
+		return fmt.Errorf("key is not enrolled")
+	}
+	return nil
+}
+
+// SimulatorTransport connects to a SimulatedVehicle
+type SimulatorTransport struct {
+	Vehicle *SimulatedVehicle
+}
+
+// Type returns TransportSim
+func (t *SimulatorTransport) Type() TransportType {
+	return TransportSim
+}
+
+// Dial returns a connection that carries nothing; the client commands the
+// simulated vehicle directly
+func (t *SimulatorTransport) Dial(ctx context.Context, vin string) (Connector, error) {
+	return &simConnection{vin: vin}, nil
+}
+
+// Commander returns the simulated vehicle
+func (t *SimulatorTransport) Commander(conn Connector) VehicleCommander {
+	return t.Vehicle
+}
+
+// simulatedVehicle returns the client's simulated vehicle, created on first
+// use
+func (c *Client) simulatedVehicle() *SimulatedVehicle {
+	c.simulatorOnce.Do(func() {
+		c.simulator = NewSimulatedVehicle()
+	})
+	return c.simulator
+}
+
+// simConnection is the connection of the simulator transport
+type simConnection struct {
+	vin string
+}
+
+func (c *simConnection) Receive() <-chan []byte { return nil }
+
+func (c *simConnection) Send(ctx context.Context, buffer []byte) error {
+	return errSimulatorUnsupported
+}
+
+func (c *simConnection) VIN() string { return c.vin }
+
+func (c *simConnection) Close() {}
+
+func (c *simConnection) PreferredAuthMethod() connector.AuthMethod {
+	return connector.AuthMethodNone
+}
+
+func (c *simConnection) RetryInterval() time.Duration { return time.Second }
+
+func (c *simConnection) AllowedLatency() time.Duration { return time.Second }
@@ -0,0 +1,125 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// newSimulatedClient returns a client connected to a simulated vehicle whose
+// clock the test controls
+func newSimulatedClient(t *testing.T) (*Client, *SimulatedVehicle, *time.Time) {
+	t.Helper()
+	sim := NewSimulatedVehicle()
+	now := time.Date(2026, 1, 15, 3, 0, 0, 0, time.UTC) // A cold night
+	sim.now = func() time.Time { return now }
+	sim.updated = now
+	sim.insideTemp = sim.outsideTemp(now)
+
+	client := NewClient(SimulatorVIN, nil)
+	client.SetTransports(&SimulatorTransport{Vehicle: sim})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Failed to connect to the simulator: %v", err)
+	}
+	return client, sim, &now
+}
+
+func TestSimulatorClimateWarmsCabin(t *testing.T) {
+	client, _, now := newSimulatedClient(t)
+	ctx := context.Background()
+
+	state, err := client.GetHVACState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.IsOn || state.InsideTempCelsius > 15 {
+		t.Fatalf("Expected a cold cabin with climate off, got %+v", state)
+	}
+
+	if err := client.SetTemperature(ctx, 22, 22); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetClimateOn(ctx); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(20 * time.Minute)
+
+	state, err = client.GetHVACState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsOn || state.DriverTempCelsius != 22 || state.InsideTempCelsius < 21 || state.FanStatus == 0 {
+		t.Errorf("Expected the cabin near 22°C with climate on, got %+v", state)
+	}
+}
+
+func TestSimulatorRejectsOutOfRangeTemperature(t *testing.T) {
+	client, _, _ := newSimulatedClient(t)
+	client.retryConfig.MaxRetries = 0
+	if err := client.SetTemperature(context.Background(), 35, 22); err == nil {
+		t.Error("Expected the simulator to reject 35°C")
+	}
+}
+
+func TestSimulatorKeeperAndBattery(t *testing.T) {
+	client, sim, now := newSimulatedClient(t)
+	ctx := context.Background()
+	sim.pluggedIn = false
+
+	if err := client.SetClimateKeeperMode(ctx, ClimateKeeperDog, false); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(2 * time.Hour)
+
+	state, err := client.GetHVACState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ClimateKeeperMode != ClimateKeeperDog || !state.IsOn {
+		t.Errorf("Expected Dog Mode to keep climate on, got %+v", state)
+	}
+	charge, err := client.GetChargeState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charge.BatteryLevel >= 64 || charge.PluggedIn {
+		t.Errorf("Expected the battery to drain while unplugged, got %+v", charge)
+	}
+}
+
+func TestSimulatorCharges(t *testing.T) {
+	client, _, now := newSimulatedClient(t)
+	ctx := context.Background()
+
+	charge, err := client.GetChargeState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charge.ChargingState != "charging" || charge.ChargerPowerKW == 0 || charge.MinutesToFull == 0 {
+		t.Errorf("Expected the vehicle to be charging, got %+v", charge)
+	}
+
+	*now = now.Add(12 * time.Hour)
+	charge, err = client.GetChargeState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charge.BatteryLevel != charge.ChargeLimit || charge.ChargingState != "complete" {
+		t.Errorf("Expected charging to complete at the limit, got %+v", charge)
+	}
+}
+
+func TestSimulatorUnsupportedState(t *testing.T) {
+	sim := NewSimulatedVehicle()
+	if _, err := sim.GetState(context.Background(), vehicle.StateCategoryMedia); err == nil {
+		t.Error("Expected an error for state the simulator doesn't model")
+	}
+}
+
+func TestParseTransportSim(t *testing.T) {
+	if transport, err := ParseTransport("sim"); err != nil || transport != TransportSim {
+		t.Errorf("ParseTransport(sim) = %q, %v", transport, err)
+	}
+}
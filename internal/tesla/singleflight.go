@@ -0,0 +1,55 @@
+package tesla
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup coalesces concurrent calls with the same key into one
+// execution whose result every caller shares. The zero value is ready to use.
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is an in-progress or completed call
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	dups  int // Callers that joined after the first
+}
+
+// do runs fn once for all concurrent callers with the same key. fn runs
+// without the first caller's cancellation so that caller going away doesn't
+// fail the others; each caller still stops waiting when its own ctx ends.
+// shared reports whether the result came from another caller's call.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (value interface{}, shared bool, err error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if ok {
+		call.dups++
+	} else {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go func() {
+			call.value, call.err = fn(context.WithoutCancel(ctx))
+
+			g.mutex.Lock()
+			delete(g.calls, key)
+			g.mutex.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, ok, call.err
+	case <-ctx.Done():
+		return nil, ok, ctx.Err()
+	}
+}
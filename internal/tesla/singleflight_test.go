@@ -0,0 +1,106 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	var group flightGroup
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "state", nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	var shared atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, wasShared, err := group.do(context.Background(), "get_hvac_state", fn)
+			if err != nil || value != "state" {
+				t.Errorf("Unexpected result: %v, %v", value, err)
+			}
+			if wasShared {
+				shared.Add(1)
+			}
+		}()
+	}
+
+	// Let every caller join the call before it completes
+	waitForCallers(&group, "get_hvac_state", callers)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected one call, got %d", calls.Load())
+	}
+	if shared.Load() != callers-1 {
+		t.Errorf("Expected %d shared results, got %d", callers-1, shared.Load())
+	}
+
+	// Once complete, the next call runs again
+	if _, _, err := group.do(context.Background(), "get_hvac_state", fn); err != nil || calls.Load() != 2 {
+		t.Errorf("Expected a second call, got %d calls and %v", calls.Load(), err)
+	}
+}
+
+func TestFlightGroupCallerCancel(t *testing.T) {
+	var group flightGroup
+	release := make(chan struct{})
+	errRead := errors.New("read failed")
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-release
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, _, err := group.do(ctx, "key", fn)
+		first <- err
+	}()
+	waitForCallers(&group, "key", 1)
+
+	second := make(chan error, 1)
+	go func() {
+		_, _, err := group.do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+			return nil, errRead
+		})
+		second <- err
+	}()
+	waitForCallers(&group, "key", 2)
+
+	// The first caller gives up, but the shared call carries on for the second
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the first caller to be canceled, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("Expected the shared call to succeed, got %v", err)
+	}
+}
+
+// waitForCallers waits until n callers are waiting on the call for key
+func waitForCallers(group *flightGroup, key string, n int) {
+	for {
+		group.mutex.Lock()
+		call := group.calls[key]
+		joined := call != nil && call.dups+1 >= n
+		group.mutex.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
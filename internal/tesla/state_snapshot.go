@@ -0,0 +1,129 @@
+package tesla
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// StateSnapshot is a copy of the most recently read HVAC state
+type StateSnapshot struct {
+	State  *HVACState
+	ETag   string
+	ReadAt time.Time
+}
+
+// StateETag returns a stable fingerprint of an HVAC state, suitable for use
+// as an HTTP entity tag
+func StateETag(state *HVACState) string {
+	if state == nil {
+		return ""
+	}
+	return etagOf(state)
+}
+
+// etagOf returns a fingerprint of v's JSON encoding
+func etagOf(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Events returns the client's event bus
+func (c *Client) Events() *EventBus {
+	return c.events
+}
+
+// LastState returns a copy of the most recently read HVAC state. ok is false
+// if no state has been read yet.
+func (c *Client) LastState() (snapshot StateSnapshot, ok bool) {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
+	if c.lastState == nil {
+		return StateSnapshot{}, false
+	}
+
+	state := *c.lastState
+	return StateSnapshot{State: &state, ETag: c.lastStateETag, ReadAt: c.lastStateAt}, true
+}
+
+// recordState stores a freshly read state and publishes update/change events
+func (c *Client) recordState(state *HVACState) {
+	if state == nil {
+		return
+	}
+
+	stored := *state
+	etag := StateETag(&stored)
+
+	c.stateMutex.Lock()
+	changed := etag != c.lastStateETag
+	c.lastState = &stored
+	c.lastStateETag = etag
+	c.lastStateAt = time.Now()
+	c.stateStale = false
+	c.stateMutex.Unlock()
+
+	c.events.Publish(Event{Type: EventStateUpdated, VIN: c.vin, Data: stored})
+	if changed {
+		c.events.Publish(Event{Type: EventStateChanged, VIN: c.vin, Data: stored})
+	}
+}
+
+// invalidateState stops the recorded state from being served from cache. It
+// stays available through LastState until the next read.
+func (c *Client) invalidateState() {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.stateStale = true
+}
+
+// CachedHVACState returns the recorded state if it was read within
+// tesla.state_cache_ttl and no command has succeeded since, and otherwise
+// reads it from the vehicle. The snapshot's ReadAt says how fresh it is.
+func (c *Client) CachedHVACState(ctx context.Context) (StateSnapshot, error) {
+	if ttl := c.stateCacheSettings(); ttl > 0 {
+		c.stateMutex.RLock()
+		fresh := c.lastState != nil && !c.stateStale && time.Since(c.lastStateAt) < ttl
+		c.stateMutex.RUnlock()
+		if fresh {
+			if snapshot, ok := c.LastState(); ok {
+				return snapshot, nil
+			}
+		}
+	}
+
+	if _, err := c.GetHVACState(ctx); err != nil {
+		return StateSnapshot{}, err
+	}
+	snapshot, _ := c.LastState()
+	return snapshot, nil
+}
+
+// WaitForStateChange blocks until the recorded state's ETag differs from etag
+// or ctx is done. It returns immediately if the current state already differs.
+// On timeout it returns the current snapshot along with ctx's error.
+func (c *Client) WaitForStateChange(ctx context.Context, etag string) (StateSnapshot, error) {
+	events, unsubscribe := c.events.Subscribe(8)
+	defer unsubscribe()
+
+	for {
+		if snapshot, ok := c.LastState(); ok && snapshot.ETag != etag {
+			return snapshot, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			snapshot, _ := c.LastState()
+			return snapshot, ctx.Err()
+		case <-events:
+			// Re-check the recorded state on any event
+		}
+	}
+}
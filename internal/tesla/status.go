@@ -0,0 +1,69 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// KeyState describes the availability of the client's private key
+type KeyState string
+
+const (
+	KeyStateNotConfigured KeyState = "not_configured"
+	KeyStateMissing       KeyState = "missing"
+	KeyStateInvalid       KeyState = "invalid"
+	KeyStateLocked        KeyState = "locked" // Encrypted, with no passphrase to unlock it
+	KeyStateValid         KeyState = "valid"
+)
+
+// VehicleStatus summarizes the connection and key state of a vehicle
+type VehicleStatus struct {
+	VIN       string    `json:"vin"`
+	Connected bool      `json:"connected"`
+	Healthy   bool      `json:"healthy"`
+	KeyState  KeyState  `json:"key_state"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Status reports the connection and key state of the vehicle. If the client
+// is connected the link is probed with a health check bounded by ctx.
+func (c *Client) Status(ctx context.Context) VehicleStatus {
+	status := VehicleStatus{
+		VIN:       c.vin,
+		Connected: c.IsConnected(),
+		KeyState:  c.keyState(),
+		CheckedAt: time.Now(),
+	}
+
+	if status.Connected {
+		if err := c.checkConnectionHealth(ctx); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Healthy = true
+		}
+	}
+
+	return status
+}
+
+// keyState checks whether the configured private key can be loaded
+func (c *Client) keyState() KeyState {
+	if c.privateKeyFile == "" {
+		return KeyStateNotConfigured
+	}
+
+	if _, err := os.Stat(c.privateKeyFile); err != nil {
+		return KeyStateMissing
+	}
+
+	if _, err := loadPrivateKeyFile(c.privateKeyFile); errors.Is(err, ErrPassphraseRequired) {
+		return KeyStateLocked
+	} else if err != nil {
+		return KeyStateInvalid
+	}
+
+	return KeyStateValid
+}
@@ -0,0 +1,64 @@
+package tesla
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func TestClientKeyState(t *testing.T) {
+	tempDir := t.TempDir()
+
+	validKeyFile := filepath.Join(tempDir, "valid.pem")
+	key, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if err := protocol.SavePrivateKey(key, validKeyFile); err != nil {
+		t.Fatalf("Failed to save key: %v", err)
+	}
+
+	invalidKeyFile := filepath.Join(tempDir, "invalid.pem")
+	if err := os.WriteFile(invalidKeyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to write invalid key: %v", err)
+	}
+
+	tests := []struct {
+		keyFile  string
+		expected KeyState
+	}{
+		{"", KeyStateNotConfigured},
+		{filepath.Join(tempDir, "missing.pem"), KeyStateMissing},
+		{invalidKeyFile, KeyStateInvalid},
+		{validKeyFile, KeyStateValid},
+	}
+
+	for _, test := range tests {
+		client := NewClient("TEST_VIN", nil)
+		client.SetPrivateKeyFile(test.keyFile)
+
+		if state := client.keyState(); state != test.expected {
+			t.Errorf("Key file %q: expected %s, got %s", test.keyFile, test.expected, state)
+		}
+	}
+}
+
+func TestClientStatusDisconnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+
+	status := client.Status(context.Background())
+	if status.VIN != "TEST_VIN" {
+		t.Errorf("Expected VIN 'TEST_VIN', got '%s'", status.VIN)
+	}
+	if status.Connected || status.Healthy {
+		t.Error("Expected disconnected, unhealthy status")
+	}
+	if status.KeyState != KeyStateNotConfigured {
+		t.Errorf("Expected key state not_configured, got %s", status.KeyState)
+	}
+}
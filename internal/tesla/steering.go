@@ -0,0 +1,33 @@
+package tesla
+
+import "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+
+// SteeringWheelHeatLevel is the steering wheel heater level. Vehicles with
+// variable steering wheel heat report low or high; others report off or
+// low when the heater is on. The level can't be set: the vehicle command
+// protocol only switches the heater on or off.
+type SteeringWheelHeatLevel string
+
+const (
+	SteeringWheelHeatOff  SteeringWheelHeatLevel = "off"
+	SteeringWheelHeatLow  SteeringWheelHeatLevel = "low"
+	SteeringWheelHeatHigh SteeringWheelHeatLevel = "high"
+)
+
+// steeringWheelHeatLevel reads the heater level from the vehicle's climate
+// state. Vehicles that don't report a level read as low while the heater is
+// on.
+func steeringWheelHeatLevel(climate *carserver.ClimateState) SteeringWheelHeatLevel {
+	switch climate.GetSteeringWheelHeatLevel() {
+	case carserver.StwHeatLevel_StwHeatLevel_Low:
+		return SteeringWheelHeatLow
+	case carserver.StwHeatLevel_StwHeatLevel_High:
+		return SteeringWheelHeatHigh
+	case carserver.StwHeatLevel_StwHeatLevel_Off:
+		return SteeringWheelHeatOff
+	}
+	if climate.GetSteeringWheelHeater() {
+		return SteeringWheelHeatLow
+	}
+	return SteeringWheelHeatOff
+}
@@ -0,0 +1,32 @@
+package tesla
+
+import (
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestSteeringWheelHeatLevelFromState(t *testing.T) {
+	tests := []struct {
+		name    string
+		climate *carserver.ClimateState
+		want    SteeringWheelHeatLevel
+	}{
+		{"not reported", &carserver.ClimateState{}, SteeringWheelHeatOff},
+		{"on without level", &carserver.ClimateState{
+			OptionalSteeringWheelHeater: &carserver.ClimateState_SteeringWheelHeater{SteeringWheelHeater: true},
+		}, SteeringWheelHeatLow},
+		{"high", &carserver.ClimateState{
+			OptionalSteeringWheelHeater:    &carserver.ClimateState_SteeringWheelHeater{SteeringWheelHeater: true},
+			OptionalSteeringWheelHeatLevel: &carserver.ClimateState_SteeringWheelHeatLevel{SteeringWheelHeatLevel: carserver.StwHeatLevel_StwHeatLevel_High},
+		}, SteeringWheelHeatHigh},
+		{"off", &carserver.ClimateState{
+			OptionalSteeringWheelHeatLevel: &carserver.ClimateState_SteeringWheelHeatLevel{SteeringWheelHeatLevel: carserver.StwHeatLevel_StwHeatLevel_Off},
+		}, SteeringWheelHeatOff},
+	}
+	for _, tt := range tests {
+		if got := steeringWheelHeatLevel(tt.climate); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SubsystemFunc is a long-running background task managed by a Supervisor.
+// It should run until ctx is cancelled. Returning an error (or panicking)
+// causes the supervisor to restart it after a backoff delay; returning nil
+// marks the subsystem as finished.
+type SubsystemFunc func(ctx context.Context) error
+
+// SubsystemStatus describes the health of a supervised subsystem
+type SubsystemStatus struct {
+	Name        string    `json:"name"`
+	Running     bool      `json:"running"`
+	Crashes     int       `json:"crashes"`
+	Failures    int       `json:"failures"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastCrashAt time.Time `json:"last_crash_at,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+}
+
+// subsystem holds the runtime state of a supervised subsystem
+type subsystem struct {
+	name   string
+	fn     SubsystemFunc
+	status SubsystemStatus
+	cancel context.CancelFunc
+}
+
+// Supervisor runs background subsystems, recovering from panics and
+// restarting failed subsystems with exponential backoff so that one
+// misbehaving loop can't take down command handling.
+type Supervisor struct {
+	logger       *log.Logger
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	// stableAfter is how long a subsystem must run before its backoff resets
+	stableAfter time.Duration
+
+	mu         sync.RWMutex
+	subsystems map[string]*subsystem
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewSupervisor creates a new supervisor with default restart backoff
+func NewSupervisor(logger *log.Logger) *Supervisor {
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	return &Supervisor{
+		logger:       logger,
+		initialDelay: time.Second,
+		maxDelay:     time.Minute,
+		stableAfter:  5 * time.Minute,
+		subsystems:   make(map[string]*subsystem),
+	}
+}
+
+// SetBackoff sets the restart backoff bounds
+func (s *Supervisor) SetBackoff(initialDelay, maxDelay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialDelay = initialDelay
+	s.maxDelay = maxDelay
+}
+
+// Add registers a subsystem. If the supervisor is already running the
+// subsystem is started immediately.
+func (s *Supervisor) Add(name string, fn SubsystemFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.subsystems[name]; exists {
+		return fmt.Errorf("subsystem %q already registered", name)
+	}
+
+	sub := &subsystem{
+		name:   name,
+		fn:     fn,
+		status: SubsystemStatus{Name: name},
+	}
+	s.subsystems[name] = sub
+
+	if s.ctx != nil {
+		s.startLocked(sub)
+	}
+	return nil
+}
+
+// Remove stops and unregisters a subsystem
+func (s *Supervisor) Remove(name string) {
+	s.mu.Lock()
+	sub, exists := s.subsystems[name]
+	if exists {
+		delete(s.subsystems, name)
+	}
+	s.mu.Unlock()
+
+	if exists && sub.cancel != nil {
+		sub.cancel()
+	}
+}
+
+// Start starts all registered subsystems
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx != nil {
+		return
+	}
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, sub := range s.subsystems {
+		s.startLocked(sub)
+	}
+}
+
+// Stop cancels all subsystems and waits for them to exit
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.ctx = nil
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Status returns the status of all subsystems sorted by name
+func (s *Supervisor) Status() []SubsystemStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]SubsystemStatus, 0, len(s.subsystems))
+	for _, sub := range s.subsystems {
+		statuses = append(statuses, sub.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// startLocked launches the run loop for a subsystem. Caller must hold s.mu.
+func (s *Supervisor) startLocked(sub *subsystem) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	sub.cancel = cancel
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, sub)
+	}()
+}
+
+// run executes a subsystem until it finishes cleanly or ctx is cancelled
+func (s *Supervisor) run(ctx context.Context, sub *subsystem) {
+	consecutive := 0
+
+	for {
+		s.mu.Lock()
+		sub.status.Running = true
+		sub.status.StartedAt = time.Now()
+		s.mu.Unlock()
+
+		started := time.Now()
+		err := s.runOnce(ctx, sub)
+
+		s.mu.Lock()
+		sub.status.Running = false
+		s.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			s.logger.Printf("Subsystem '%s' finished", sub.name)
+			return
+		}
+
+		// A long stable run means the failure is not part of a crash loop
+		if time.Since(started) >= s.stableAfter {
+			consecutive = 0
+		}
+
+		delay := s.restartDelay(consecutive)
+		consecutive++
+
+		s.logger.Printf("Subsystem '%s' failed: %v. Restarting in %v", sub.name, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		s.mu.Lock()
+		sub.status.Restarts++
+		s.mu.Unlock()
+	}
+}
+
+// runOnce runs a subsystem a single time, converting panics into errors
+func (s *Supervisor) runOnce(ctx context.Context, sub *subsystem) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("Subsystem '%s' panicked: %v\n%s", sub.name, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+
+			s.mu.Lock()
+			sub.status.Crashes++
+			sub.status.LastCrashAt = time.Now()
+			s.mu.Unlock()
+		}
+
+		if err != nil && ctx.Err() == nil {
+			s.mu.Lock()
+			sub.status.Failures++
+			sub.status.LastError = err.Error()
+			s.mu.Unlock()
+		}
+	}()
+
+	return sub.fn(ctx)
+}
+
+// restartDelay calculates the backoff before the given restart attempt
+func (s *Supervisor) restartDelay(attempt int) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	delay := s.initialDelay
+	for i := 0; i < attempt && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.maxDelay {
+		delay = s.maxDelay
+	}
+	return delay
+}
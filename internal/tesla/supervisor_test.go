@@ -0,0 +1,131 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for condition")
+}
+
+func TestSupervisorRecoversFromPanic(t *testing.T) {
+	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
+	supervisor := NewSupervisor(logger)
+	supervisor.SetBackoff(time.Millisecond, 10*time.Millisecond)
+
+	var runs int32
+	err := supervisor.Add("panicky", func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) < 3 {
+			panic("boom")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to add subsystem: %v", err)
+	}
+
+	supervisor.Start(context.Background())
+	defer supervisor.Stop()
+
+	waitFor(t, time.Second, func() bool {
+		status := supervisor.Status()
+		return len(status) == 1 && status[0].Running && status[0].Restarts == 2
+	})
+
+	status := supervisor.Status()[0]
+	if status.Crashes != 2 {
+		t.Errorf("Expected 2 crashes, got %d", status.Crashes)
+	}
+	if status.LastError != "panic: boom" {
+		t.Errorf("Expected last error 'panic: boom', got '%s'", status.LastError)
+	}
+}
+
+func TestSupervisorRestartsOnError(t *testing.T) {
+	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
+	supervisor := NewSupervisor(logger)
+	supervisor.SetBackoff(time.Millisecond, 10*time.Millisecond)
+
+	var runs int32
+	supervisor.Add("flaky", func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return errors.New("transient failure")
+		}
+		<-ctx.Done()
+		return nil
+	})
+
+	supervisor.Start(context.Background())
+	defer supervisor.Stop()
+
+	waitFor(t, time.Second, func() bool {
+		return atomic.LoadInt32(&runs) == 2
+	})
+
+	status := supervisor.Status()[0]
+	if status.Failures != 1 {
+		t.Errorf("Expected 1 failure, got %d", status.Failures)
+	}
+	if status.Crashes != 0 {
+		t.Errorf("Expected 0 crashes, got %d", status.Crashes)
+	}
+}
+
+func TestSupervisorCleanExitNotRestarted(t *testing.T) {
+	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
+	supervisor := NewSupervisor(logger)
+	supervisor.SetBackoff(time.Millisecond, 10*time.Millisecond)
+
+	var runs int32
+	supervisor.Add("oneshot", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	supervisor.Start(context.Background())
+	time.Sleep(50 * time.Millisecond)
+	supervisor.Stop()
+
+	if atomic.LoadInt32(&runs) != 1 {
+		t.Errorf("Expected 1 run, got %d", runs)
+	}
+}
+
+func TestSupervisorDuplicateName(t *testing.T) {
+	supervisor := NewSupervisor(nil)
+	noop := func(ctx context.Context) error { return nil }
+
+	if err := supervisor.Add("poller", noop); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := supervisor.Add("poller", noop); err == nil {
+		t.Error("Expected error for duplicate subsystem name")
+	}
+}
+
+func TestSupervisorRestartDelay(t *testing.T) {
+	supervisor := NewSupervisor(nil)
+	supervisor.SetBackoff(time.Second, 5*time.Second)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, want := range expected {
+		if got := supervisor.restartDelay(attempt); got != want {
+			t.Errorf("Attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
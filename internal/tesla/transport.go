@@ -0,0 +1,396 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// TransportType names a way of reaching the vehicle
+type TransportType string
+
+const (
+	TransportBLE   TransportType = "ble"   // Bluetooth Low Energy, within range of the vehicle
+	TransportFleet TransportType = "fleet" // Tesla's Fleet API over the internet
+	TransportSim   TransportType = "sim"   // An in-memory SimulatedVehicle, for development
+)
+
+// DefaultFleetAPIHost is the North America Fleet API server. The vehicle
+// redirects the client if it belongs to another region.
+const DefaultFleetAPIHost = "fleet-api.prd.na.vn.cloud.tesla.com"
+
+// fleetUserAgent identifies the server to the Fleet API
+const fleetUserAgent = "tesla-hvac-interface"
+
+// ParseTransport parses ble, fleet or sim. An empty name is BLE.
+func ParseTransport(name string) (TransportType, error) {
+	switch transport := TransportType(strings.ToLower(name)); transport {
+	case "":
+		return TransportBLE, nil
+	case TransportBLE, TransportFleet, TransportSim:
+		return transport, nil
+	}
+	return "", fmt.Errorf("unknown transport %q (expected ble, fleet or sim)", name)
+}
+
+// Transport opens connections to a vehicle. The client signs commands and
+// manages sessions the same way over every transport.
+type Transport interface {
+	Type() TransportType
+	Dial(ctx context.Context, vin string) (Connector, error)
+}
+
+// BLETransport reaches the vehicle over Bluetooth by scanning for its beacon
+type BLETransport struct {
+	ScanTimeout time.Duration // 0 scans until the context ends
+	ScanRetries int           // Scan attempts; less than 1 scans once
+	ScanDelay   time.Duration // Wait between scan attempts
+	Logger      *log.Logger
+
+	// Addresses remembers where vehicles were found, to dial them there
+	// without a scan, allowing DirectTimeout for them to answer. Nil, or a
+	// DirectTimeout of 0, always scans.
+	Addresses     *BLEAddresses
+	DirectTimeout time.Duration
+
+	scan func(ctx context.Context, vin string) (*ble.ScanResult, error) // nil uses ble.ScanVehicleBeacon
+	dial bleDialer                                                       // nil uses dialBLE
+}
+
+// Type returns TransportBLE
+func (t *BLETransport) Type() TransportType {
+	return TransportBLE
+}
+
+// Dial opens a BLE connection to the vehicle, at the address it was last
+// found at if it's still there and otherwise where a scan finds it
+func (t *BLETransport) Dial(ctx context.Context, vin string) (Connector, error) {
+	logger := t.Logger
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	scanVehicle, dial := t.scan, t.dial
+	if scanVehicle == nil {
+		scanVehicle = ble.ScanVehicleBeacon
+	}
+	if dial == nil {
+		dial = dialBLE
+	}
+	if conn, ok := dialKnownAddress(ctx, t.Addresses, vin, t.DirectTimeout, dial, logger); ok {
+		return conn, nil
+	}
+	logger.Printf("Scanning for vehicle VIN: %s", vin)
+
+	scanCtx := ctx
+	if t.ScanTimeout > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = context.WithTimeout(ctx, t.ScanTimeout)
+		defer cancel()
+	}
+
+	attempts := t.ScanRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+	var scan *ble.ScanResult
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		scan, err = scanVehicle(scanCtx, vin)
+		if err == nil {
+			break
+		}
+		if attempt < attempts-1 {
+			logger.Printf("Scan attempt %d failed: %v. Retrying in %v", attempt+1, err, t.ScanDelay)
+			time.Sleep(t.ScanDelay)
+		}
+	}
+	recordScan(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for vehicle after %d attempts: %w", attempts, err)
+	}
+	logger.Printf("Found vehicle: %s (%s) %ddBm", scan.LocalName, scan.Address, scan.RSSI)
+
+	conn, err := dial(ctx, vin, scan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BLE connection: %w", err)
+	}
+	found := ScanResult{VIN: vin, LocalName: scan.LocalName, Address: scan.Address, RSSI: scan.RSSI, DiscoveredAt: time.Now()}
+	if err := t.Addresses.Put(found); err != nil {
+		logger.Printf("warn: Failed to remember the address of %s: %v", vin, err)
+	}
+	return conn, nil
+}
+
+// FleetTransport reaches the vehicle through Tesla's Fleet API, using the
+// OAuth token for the vehicle from the keyring or else the environment
+type FleetTransport struct {
+	Host  string // Fleet API server; empty uses DefaultFleetAPIHost
+	OAuth *OAuthManager
+}
+
+// Type returns TransportFleet
+func (t *FleetTransport) Type() TransportType {
+	return TransportFleet
+}
+
+// Dial opens a Fleet API connection to the vehicle. Nothing is sent until
+// the first command.
+func (t *FleetTransport) Dial(ctx context.Context, vin string) (Connector, error) {
+	if t.OAuth == nil {
+		return nil, fmt.Errorf("the fleet transport needs an OAuth manager")
+	}
+	token, err := t.OAuth.TokenForVehicle(ctx, vin)
+	if err != nil {
+		return nil, err
+	}
+	host := t.Host
+	if host == "" {
+		host = DefaultFleetAPIHost
+	}
+	return &fleetConnection{
+		Connection: inet.NewConnection(vin, "Bearer "+token.AccessToken, host, fleetUserAgent),
+		oauth:      t.OAuth,
+		token:      token,
+	}, nil
+}
+
+// fleetConnection is a Fleet API connection that refreshes its OAuth token
+// before it expires, so long-lived connections keep working
+type fleetConnection struct {
+	*inet.Connection
+	oauth *OAuthManager
+
+	mu    sync.Mutex
+	token *OAuthToken
+}
+
+// refreshToken switches to a fresh token once the current one is about to
+// expire
+func (c *fleetConnection) refreshToken(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.oauth.IsTokenValid(c.token) {
+		return nil
+	}
+	token, err := c.oauth.TokenForVehicle(ctx, c.VIN())
+	if err != nil {
+		return err
+	}
+	c.token = token
+	c.SetAuthHeader("Bearer " + token.AccessToken)
+	return nil
+}
+
+// Send sends a command with a valid token
+func (c *fleetConnection) Send(ctx context.Context, buffer []byte) error {
+	if err := c.refreshToken(ctx); err != nil {
+		return err
+	}
+	return c.Connection.Send(ctx, buffer)
+}
+
+// Wakeup wakes the vehicle with a valid token
+func (c *fleetConnection) Wakeup(ctx context.Context) error {
+	if err := c.refreshToken(ctx); err != nil {
+		return err
+	}
+	return c.Connection.Wakeup(ctx)
+}
+
+// Transport returns the primary transport used to reach the vehicle
+func (c *Client) Transport() TransportType {
+	if c.transport == "" {
+		return TransportBLE
+	}
+	return c.transport
+}
+
+// UsesTransport reports whether the client may reach the vehicle over a
+// transport, as its primary or its failover
+func (c *Client) UsesTransport(transport TransportType) bool {
+	if c.Transport() == transport {
+		return true
+	}
+	return c.failover.Enabled && TransportType(c.failover.Fallback) == transport
+}
+
+// ActiveTransport returns the transport of the current connection, or an
+// empty string when disconnected
+func (c *Client) ActiveTransport() TransportType {
+	if !c.IsConnected() {
+		return ""
+	}
+	c.transportMutex.RLock()
+	defer c.transportMutex.RUnlock()
+	return c.activeTransport
+}
+
+// SetOAuthManager sets where the fleet transport gets its OAuth token
+func (c *Client) SetOAuthManager(oauth *OAuthManager) {
+	c.oauth = oauth
+}
+
+// SetTransports replaces the configured transports with ones tried in order
+// on connect
+func (c *Client) SetTransports(transports ...Transport) {
+	c.transportMutex.Lock()
+	defer c.transportMutex.Unlock()
+	c.transports = transports
+}
+
+// newTransport creates a configured transport
+func (c *Client) newTransport(transport TransportType, scan BLETransport) Transport {
+	switch transport {
+	case TransportFleet:
+		return &FleetTransport{Host: c.fleetAPIHost, OAuth: c.oauth}
+	case TransportSim:
+		return &SimulatorTransport{Vehicle: c.simulatedVehicle()}
+	}
+	scan.Logger = c.logger
+	return &scan
+}
+
+// transportChain returns the transports to try, in order. After failing
+// over, the fallback is tried first until failover.retry_primary has passed.
+func (c *Client) transportChain(scan BLETransport) []Transport {
+	c.transportMutex.RLock()
+	defer c.transportMutex.RUnlock()
+	if c.transports != nil {
+		return c.transports
+	}
+
+	chain := []Transport{c.newTransport(c.Transport(), scan)}
+	if !c.failover.Enabled {
+		return chain
+	}
+	fallback := c.newTransport(TransportType(c.failover.Fallback), scan)
+	if !c.failedOverAt.IsZero() && time.Since(c.failedOverAt) < c.failover.RetryPrimary {
+		return append([]Transport{fallback}, chain...)
+	}
+	return append(chain, fallback)
+}
+
+// connectVia connects over the first transport in the chain that reaches the
+// vehicle
+func (c *Client) connectVia(ctx context.Context, transports []Transport, privateKeyFile string) error {
+	var errs []error
+	for i, transport := range transports {
+		err := c.connectTransport(ctx, transport, privateKeyFile)
+		if err == nil {
+			c.transportMutex.Lock()
+			c.activeTransport = transport.Type()
+			if transport.Type() == c.Transport() {
+				c.failedOverAt = time.Time{}
+			} else if i > 0 {
+				c.failedOverAt = time.Now()
+			}
+			c.transportMutex.Unlock()
+			return nil
+		}
+		if len(transports) == 1 {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", transport.Type(), err))
+		if i < len(transports)-1 {
+			c.logFor(ctx).Printf("Connecting over %s failed, failing over to %s: %v", transport.Type(), transports[i+1].Type(), err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// connectTransport connects to the vehicle over one transport and starts the
+// authenticated session
+func (c *Client) connectTransport(ctx context.Context, transport Transport, privateKeyFile string) (err error) {
+	// Load private key if provided
+	// A transport providing the vehicle itself doesn't sign commands
+	var privateKey authentication.ECDHPrivateKey
+	if _, direct := transport.(vehicleTransport); privateKeyFile != "" && !direct {
+		privateKey, err = loadPrivateKeyFile(privateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load private key: %w", err)
+		}
+	}
+
+	if transport.Type() == TransportBLE {
+		c.setConnectionState(StateScanning, nil)
+	}
+	if c.faultSettings() != nil {
+		c.logFor(ctx).Printf("warn: Injecting faults into the connection to %s", c.vin)
+	}
+	if err := c.injectDialFault(ctx); err != nil {
+		return err
+	}
+	conn, err := transport.Dial(ctx, c.vin)
+	if err != nil {
+		return err
+	}
+	// Internet connections only accept signed commands
+	if privateKey == nil && conn.PreferredAuthMethod() == connector.AuthMethodHMAC {
+		conn.Close()
+		return fmt.Errorf("the %s transport requires a private key", transport.Type())
+	}
+	c.setConnectionState(StateConnecting, nil)
+	if _, direct := transport.(vehicleTransport); !direct {
+		conn = c.recordConnection(conn)
+	}
+	c.conn = conn
+	defer func() {
+		// Don't leave a half-open connection behind for the next transport
+		if err != nil {
+			c.closeConnection()
+		}
+	}()
+
+	// Create vehicle instance
+	car, err := c.newVehicle(transport, conn, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to create vehicle instance: %w", err)
+	}
+	resumed := c.sessionStore().Load(car)
+	car = c.withFaults(car)
+	c.vehicle = car
+
+	// Connect to vehicle
+	if err := car.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to vehicle: %w", err)
+	}
+	c.setConnectionState(StateConnected, nil)
+
+	// Start session for authenticated commands, resumed from the session
+	// store when it has them
+	if err := car.StartSession(ctx, []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT}); err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	if resumed {
+		c.logFor(ctx).Printf("Resumed cached sessions with %s", c.vin)
+	}
+	c.saveSessions()
+	c.setConnectionState(StateSessionActive, nil)
+
+	c.logFor(ctx).Printf("Successfully connected to Tesla vehicle over %s", transport.Type())
+	return nil
+}
+
+// bleTransportFromConfig returns the BLE scan and direct connection settings
+// in a config
+func bleTransportFromConfig(config *Config) BLETransport {
+	return BLETransport{
+		ScanTimeout: config.Tesla.ScanTimeout,
+		ScanRetries: config.Tesla.ScanRetries,
+		ScanDelay:   config.Tesla.ScanDelay,
+
+		Addresses:     bleAddressesFromConfig(config),
+		DirectTimeout: config.Tesla.DirectConnectTimeout,
+	}
+}
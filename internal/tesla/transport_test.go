@@ -0,0 +1,146 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+)
+
+func TestParseTransport(t *testing.T) {
+	tests := []struct {
+		name string
+		want TransportType
+		ok   bool
+	}{
+		{"", TransportBLE, true},
+		{"ble", TransportBLE, true},
+		{"Fleet", TransportFleet, true},
+		{"wifi", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseTransport(tt.name)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseTransport(%q) = %q, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestTransportFromConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Vehicles = []VehicleConfig{
+		{VIN: "VIN_A"},
+		{VIN: "VIN_B", Transport: "fleet"},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+
+	registry, err := NewRegistryFromConfig(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	for vin, want := range map[string]TransportType{"VIN_A": TransportBLE, "VIN_B": TransportFleet} {
+		client, _ := registry.Get(vin)
+		if client.Transport() != want {
+			t.Errorf("%s: expected transport %s, got %s", vin, want, client.Transport())
+		}
+	}
+
+	config.Vehicles[1].Transport = "wifi"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an unknown transport to fail validation")
+	}
+}
+
+// fakeTransport records dials and returns a fixed connection or error
+type fakeTransport struct {
+	kind   TransportType
+	conn   connector.Connector
+	err    error
+	dialed atomic.Int32
+}
+
+func (t *fakeTransport) Type() TransportType {
+	return t.kind
+}
+
+func (t *fakeTransport) Dial(ctx context.Context, vin string) (connector.Connector, error) {
+	t.dialed.Add(1)
+	return t.conn, t.err
+}
+
+func TestFleetTransportRequirements(t *testing.T) {
+	if _, err := (&FleetTransport{}).Dial(context.Background(), "TEST_VIN"); err == nil || !strings.Contains(err.Error(), "OAuth manager") {
+		t.Errorf("Expected a missing OAuth manager error, got %v", err)
+	}
+
+	// Fleet API connections only carry signed commands
+	client := NewClient("TEST_VIN", nil)
+	fleet := &fakeTransport{kind: TransportFleet, conn: inet.NewConnection("TEST_VIN", "Bearer token", "localhost", "")}
+	client.SetTransports(fleet)
+	err := client.connectInternal(context.Background(), "")
+	if err == nil || !strings.Contains(err.Error(), "requires a private key") {
+		t.Errorf("Expected a missing private key error, got %v", err)
+	}
+	if client.IsConnected() {
+		t.Error("Client should not be connected")
+	}
+}
+
+func TestTransportFailover(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	bleTransport := &fakeTransport{kind: TransportBLE, err: errors.New("out of range")}
+	fleet := &fakeTransport{kind: TransportFleet, err: errors.New("no token")}
+	client.SetTransports(bleTransport, fleet)
+
+	err := client.connectInternal(context.Background(), "")
+	if bleTransport.dialed.Load() != 1 || fleet.dialed.Load() != 1 {
+		t.Errorf("Expected both transports to be tried, got ble=%d fleet=%d", bleTransport.dialed.Load(), fleet.dialed.Load())
+	}
+	if err == nil || !strings.Contains(err.Error(), "ble: out of range") || !strings.Contains(err.Error(), "fleet: no token") {
+		t.Errorf("Expected both failures in the error, got %v", err)
+	}
+	if client.ActiveTransport() != "" {
+		t.Errorf("Expected no active transport, got %q", client.ActiveTransport())
+	}
+}
+
+func TestTransportChain(t *testing.T) {
+	config := DefaultConfig()
+	config.Tesla.VIN = "TEST_VIN"
+	client := NewClientFromConfig(config, nil)
+	if chain := client.transportChain(client.scan); len(chain) != 1 || chain[0].Type() != TransportBLE {
+		t.Fatalf("Expected only BLE without failover, got %v", chain)
+	}
+
+	config.Failover.Enabled = true
+	client = NewClientFromConfig(config, nil)
+	if !client.UsesTransport(TransportFleet) {
+		t.Error("Expected the client to use the fleet transport on failover")
+	}
+	chain := client.transportChain(client.scan)
+	if len(chain) != 2 || chain[0].Type() != TransportBLE || chain[1].Type() != TransportFleet {
+		t.Fatalf("Expected BLE then fleet, got %v", chain)
+	}
+
+	// Recently failed over: the fallback goes first until retry_primary passes
+	client.failedOverAt = time.Now()
+	if chain := client.transportChain(client.scan); chain[0].Type() != TransportFleet {
+		t.Errorf("Expected the fallback first after failing over, got %v", chain[0].Type())
+	}
+	client.failedOverAt = time.Now().Add(-config.Failover.RetryPrimary)
+	if chain := client.transportChain(client.scan); chain[0].Type() != TransportBLE {
+		t.Errorf("Expected the primary first once retry_primary passed, got %v", chain[0].Type())
+	}
+
+	config.Failover.Fallback = "ble"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a fallback equal to the primary to fail validation")
+	}
+}
@@ -0,0 +1,151 @@
+package tesla
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tuning holds the client settings that can be adjusted at runtime without
+// reconnecting, e.g. to ride out a period of poor signal
+type Tuning struct {
+	Retry             RetryConfig          `json:"retry"`
+	CircuitBreaker    CircuitBreakerConfig `json:"circuit_breaker"`
+	ConnectionTimeout time.Duration        `json:"connection_timeout"`
+	RequestTimeout    time.Duration        `json:"request_timeout"`
+	SetpointInterval  time.Duration        `json:"setpoint_interval"`
+	StateCacheTTL     time.Duration        `json:"state_cache_ttl"`
+	Wake              WakeConfig           `json:"wake"`
+	BatteryGuard      BatteryGuardConfig   `json:"battery_guard"`
+}
+
+// TuningFromConfig extracts the runtime-tunable settings from a configuration
+func TuningFromConfig(config *Config) Tuning {
+	return Tuning{
+		Retry:             config.Retry,
+		CircuitBreaker:    config.CircuitBreaker,
+		ConnectionTimeout: config.Tesla.ConnectionTimeout,
+		RequestTimeout:    config.Tesla.RequestTimeout,
+		SetpointInterval:  config.Tesla.SetpointInterval,
+		StateCacheTTL:     config.Tesla.StateCacheTTL,
+		Wake:              config.Wake,
+		BatteryGuard:      config.BatteryGuard,
+	}
+}
+
+// ApplyTo copies the tuning settings into a configuration
+func (t Tuning) ApplyTo(config *Config) {
+	config.Retry = t.Retry
+	config.CircuitBreaker = t.CircuitBreaker
+	config.Tesla.ConnectionTimeout = t.ConnectionTimeout
+	config.Tesla.RequestTimeout = t.RequestTimeout
+	config.Tesla.SetpointInterval = t.SetpointInterval
+	config.Tesla.StateCacheTTL = t.StateCacheTTL
+	config.Wake = t.Wake
+	config.BatteryGuard = t.BatteryGuard
+}
+
+// Validate checks the tuning settings using the same rules as Config.Validate
+func (t Tuning) Validate() error {
+	config := DefaultConfig()
+	config.Tesla.VIN = "validate"
+	t.ApplyTo(config)
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid tuning: %w", err)
+	}
+	return nil
+}
+
+// Tuning returns the client's current runtime-tunable settings
+func (c *Client) Tuning() Tuning {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+
+	return Tuning{
+		Retry:             c.retryConfig,
+		CircuitBreaker:    c.circuitBreaker.Config(),
+		ConnectionTimeout: c.connectTimeout,
+		RequestTimeout:    c.requestTimeout,
+		SetpointInterval:  c.setpointInterval,
+		StateCacheTTL:     c.stateCacheTTL,
+		Wake:              c.wake,
+	}
+}
+
+// ApplyTuning updates the client's runtime-tunable settings. The circuit
+// breaker keeps its current state; only its thresholds change.
+func (c *Client) ApplyTuning(t Tuning) {
+	c.tuningMutex.Lock()
+	defer c.tuningMutex.Unlock()
+
+	c.retryConfig = t.Retry
+	c.circuitBreaker.SetConfig(t.CircuitBreaker)
+	c.connectTimeout = t.ConnectionTimeout
+	c.requestTimeout = t.RequestTimeout
+	c.setpointInterval = t.SetpointInterval
+	c.stateCacheTTL = t.StateCacheTTL
+	c.wake = t.Wake
+	c.batteryGuard = t.BatteryGuard
+
+	c.logger.Printf("Applied tuning: retries=%d breaker_max_failures=%d request_timeout=%v wake_on_demand=%v",
+		t.Retry.MaxRetries, t.CircuitBreaker.MaxFailures, t.RequestTimeout, t.Wake.OnDemand)
+}
+
+// wakeSettings returns a consistent copy of the wake configuration
+func (c *Client) wakeSettings() WakeConfig {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+	return c.wake
+}
+
+// stateCacheSettings returns how long a read state may be served from cache
+func (c *Client) stateCacheSettings() time.Duration {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+	return c.stateCacheTTL
+}
+
+// retrySettings returns a consistent copy of the retry configuration
+func (c *Client) retrySettings() RetryConfig {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+	return c.retryConfig
+}
+
+// operationTimeout returns the configured request timeout, or fallback if
+// none is configured
+func (c *Client) operationTimeout(fallback time.Duration) time.Duration {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+
+	if c.requestTimeout > 0 {
+		return c.requestTimeout
+	}
+	return fallback
+}
+
+// connectionTimeout returns the configured connection timeout, or fallback if
+// none is configured
+func (c *Client) connectionTimeout(fallback time.Duration) time.Duration {
+	c.tuningMutex.RLock()
+	defer c.tuningMutex.RUnlock()
+
+	if c.connectTimeout > 0 {
+		return c.connectTimeout
+	}
+	return fallback
+}
+
+// Config returns the circuit breaker's current thresholds
+func (cb *CircuitBreaker) Config() CircuitBreakerConfig {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.config
+}
+
+// SetConfig replaces the circuit breaker's thresholds without resetting its
+// state. New thresholds take effect on the next call.
+func (cb *CircuitBreaker) SetConfig(config CircuitBreakerConfig) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.config = config
+}
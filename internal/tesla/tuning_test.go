@@ -0,0 +1,55 @@
+package tesla
+
+import (
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestApplyTuningKeepsBreakerState(t *testing.T) {
+	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
+	client := NewClientFromConfig(DefaultConfig(), logger)
+
+	client.circuitBreaker.mutex.Lock()
+	client.circuitBreaker.state = CircuitOpen
+	client.circuitBreaker.lastFailTime = time.Now()
+	client.circuitBreaker.mutex.Unlock()
+
+	tuning := client.Tuning()
+	tuning.Retry.MaxRetries = 1
+	tuning.CircuitBreaker.MaxFailures = 2
+	tuning.RequestTimeout = 3 * time.Second
+	client.ApplyTuning(tuning)
+
+	if client.circuitBreaker.GetState() != CircuitOpen {
+		t.Error("Expected circuit breaker to stay open after tuning")
+	}
+	if got := client.Tuning(); got.Retry.MaxRetries != 1 || got.CircuitBreaker.MaxFailures != 2 {
+		t.Errorf("Tuning not applied: %+v", got)
+	}
+	if got := client.operationTimeout(10 * time.Second); got != 3*time.Second {
+		t.Errorf("Expected request timeout 3s, got %v", got)
+	}
+}
+
+func TestOperationTimeoutFallback(t *testing.T) {
+	logger := log.New(os.Stderr, "test: ", log.LstdFlags)
+	client := NewClient("TEST_VIN", logger)
+
+	if got := client.operationTimeout(15 * time.Second); got != 15*time.Second {
+		t.Errorf("Expected fallback timeout, got %v", got)
+	}
+}
+
+func TestTuningValidate(t *testing.T) {
+	tuning := TuningFromConfig(DefaultConfig())
+	if err := tuning.Validate(); err != nil {
+		t.Errorf("Expected default tuning to be valid: %v", err)
+	}
+
+	tuning.Wake = WakeConfig{OnDemand: true}
+	if err := tuning.Validate(); err == nil {
+		t.Error("Expected error for on-demand wake without max wait")
+	}
+}
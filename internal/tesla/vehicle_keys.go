@@ -0,0 +1,131 @@
+package tesla
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// ErrRemoveOwnKey is returned when asked to remove the key the client signs
+// commands with, which would leave it unable to reach the vehicle
+var ErrRemoveOwnKey = errors.New("refusing to remove the server's own key")
+
+// maxKeySlots is the number of slots in a vehicle's key whitelist
+const maxKeySlots = 32
+
+// VehicleKey is a key on the vehicle's whitelist
+type VehicleKey struct {
+	Slot       uint32 `json:"slot"`
+	PublicKey  string `json:"public_key"`  // Hex-encoded uncompressed P-256 point
+	Role       string `json:"role"`        // owner, driver, service and so on
+	FormFactor string `json:"form_factor"` // nfc_card, ios_device, android_device, cloud_key or unknown
+	ServerKey  bool   `json:"server_key"`  // The key this server signs commands with
+}
+
+// ParseVehiclePublicKey parses a hex-encoded uncompressed P-256 point, as in
+// VehicleKey.PublicKey
+func ParseVehiclePublicKey(value string) (*ecdh.PublicKey, error) {
+	raw, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("public key must be hex: %w", err)
+	}
+	publicKey, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// vehicleKeyFrom converts a whitelist entry
+func vehicleKeyFrom(entry *vcsec.WhitelistEntryInfo, serverKey []byte) VehicleKey {
+	raw := entry.GetPublicKey().GetPublicKeyRaw()
+	return VehicleKey{
+		Slot:       entry.GetSlot(),
+		PublicKey:  hex.EncodeToString(raw),
+		Role:       roleName(entry.GetKeyRole()),
+		FormFactor: strings.ToLower(strings.TrimPrefix(entry.GetMetadataForKey().GetKeyFormFactor().String(), "KEY_FORM_FACTOR_")),
+		ServerKey:  serverKey != nil && bytes.Equal(raw, serverKey),
+	}
+}
+
+// serverKeyBytes returns the client's public key, or nil if it has none
+func (c *Client) serverKeyBytes() []byte {
+	publicKey, err := c.PublicKey()
+	if err != nil {
+		return nil
+	}
+	return publicKey.Bytes()
+}
+
+// ListKeys lists the keys on the vehicle's whitelist, in slot order. Phones,
+// key cards and servers each have their own key.
+func (c *Client) ListKeys(ctx context.Context) ([]VehicleKey, error) {
+	keysCtx, cancel := c.withTimeout(ctx, c.operationTimeout(30*time.Second))
+	defer cancel()
+
+	serverKey := c.serverKeyBytes()
+	var result []VehicleKey
+	err := c.retryWithBackoff(keysCtx, "list_keys", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		summary, err := c.vehicle.KeySummary(keysCtx)
+		if err != nil {
+			return fmt.Errorf("failed to get key summary: %w", err)
+		}
+		result = nil
+		for slot := uint32(0); slot < maxKeySlots; slot++ {
+			if summary.GetSlotMask()&(1<<slot) == 0 {
+				continue
+			}
+			entry, err := c.vehicle.KeyInfoBySlot(keysCtx, slot)
+			if err != nil {
+				return fmt.Errorf("failed to get key in slot %d: %w", slot, err)
+			}
+			result = append(result, vehicleKeyFrom(entry, serverKey))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RemoveKey removes a key from the vehicle's whitelist. Only an owner key
+// can remove keys, and the client's own key can't be removed.
+func (c *Client) RemoveKey(ctx context.Context, publicKey *ecdh.PublicKey) (err error) {
+	if serverKey := c.serverKeyBytes(); serverKey != nil && bytes.Equal(publicKey.Bytes(), serverKey) {
+		return ErrRemoveOwnKey
+	}
+	keyHex := hex.EncodeToString(publicKey.Bytes())
+	if err := c.runCommandHooks(ctx, "remove_key", map[string]interface{}{"public_key": keyHex}); err != nil {
+		return err
+	}
+	defer func() { c.commandSent("remove_key", err) }()
+
+	removeCtx, cancel := c.withTimeout(ctx, c.operationTimeout(15*time.Second))
+	defer cancel()
+
+	return c.retryWithBackoff(removeCtx, "remove_key", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+		c.logFor(ctx).Printf("Removing key %s from %s", keyHex, c.vin)
+		return c.vehicle.RemoveKey(removeCtx, publicKey)
+	})
+}
+
+// roleName names a protocol role the way VehicleKey does
+func roleName(role keys.Role) string {
+	return strings.ToLower(strings.TrimPrefix(role.String(), "ROLE_"))
+}
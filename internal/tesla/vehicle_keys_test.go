@@ -0,0 +1,73 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestListAndRemoveVehicleKeys(t *testing.T) {
+	client, _, _ := newSimulatedClient(t)
+	ctx := context.Background()
+
+	manager := newTestKeyManager(t)
+	keyFile := filepath.Join(t.TempDir(), "private.pem")
+	if err := manager.SavePrivateKeyToFile(keyFile, nil); err != nil {
+		t.Fatalf("Failed to save key: %v", err)
+	}
+	client.SetPrivateKeyFile(keyFile)
+	if err := manager.Enroll(ctx, client, KeyRoleDriver, nil); err != nil {
+		t.Fatalf("Failed to enroll key: %v", err)
+	}
+
+	keys, err := client.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list keys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected the phone and server keys, got %+v", keys)
+	}
+	phone, server := keys[0], keys[1]
+	if phone.Slot != 0 || phone.Role != "owner" || phone.FormFactor != "ios_device" || phone.ServerKey {
+		t.Errorf("Unexpected phone key: %+v", phone)
+	}
+	if server.Slot != 1 || server.Role != "driver" || server.FormFactor != "cloud_key" || !server.ServerKey {
+		t.Errorf("Unexpected server key: %+v", server)
+	}
+
+	serverKey, err := ParseVehiclePublicKey(server.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to parse server key: %v", err)
+	}
+	if err := client.RemoveKey(ctx, serverKey); !errors.Is(err, ErrRemoveOwnKey) {
+		t.Errorf("Expected ErrRemoveOwnKey, got %v", err)
+	}
+
+	phoneKey, err := ParseVehiclePublicKey(phone.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to parse phone key: %v", err)
+	}
+	if err := client.RemoveKey(ctx, phoneKey); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	keys, err = client.ListKeys(ctx)
+	if err != nil || len(keys) != 1 || !keys[0].ServerKey {
+		t.Errorf("Expected only the server key left, got %+v (%v)", keys, err)
+	}
+}
+
+func TestListKeysNotConnected(t *testing.T) {
+	client := NewClientWithConfig("TEST_VIN", nil, RetryConfig{MaxRetries: 0}, CircuitBreakerConfig{MaxFailures: 1000})
+	if _, err := client.ListKeys(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestParseVehiclePublicKey(t *testing.T) {
+	for _, value := range []string{"", "zz", "04abcd"} {
+		if _, err := ParseVehiclePublicKey(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
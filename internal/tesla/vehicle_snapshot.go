@@ -0,0 +1,168 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// snapshotCategories are the state categories a VehicleSnapshot reads
+var snapshotCategories = []vehicle.StateCategory{
+	vehicle.StateCategoryClimate,
+	vehicle.StateCategoryCharge,
+	vehicle.StateCategoryClosures,
+	vehicle.StateCategoryDrive,
+}
+
+// VehicleInfo is the basic state of the vehicle besides climate and charge
+type VehicleInfo struct {
+	Locked      bool    `json:"locked"`
+	UserPresent bool    `json:"user_present"`
+	SentryMode  string  `json:"sentry_mode"` // off, idle, armed, aware, panic, quiet or unknown
+	ShiftState  string  `json:"shift_state"` // P, R, N, D or unknown
+	SpeedKph    float64 `json:"speed_kph"`
+	OdometerKm  float64 `json:"odometer_km"`
+}
+
+// SnapshotTimes are when each part of a VehicleSnapshot was current. The
+// vehicle's own timestamp is used where it reports one.
+type SnapshotTimes struct {
+	Climate time.Time `json:"climate"`
+	Charge  time.Time `json:"charge"`
+	Vehicle time.Time `json:"vehicle"`
+}
+
+// VehicleSnapshot is the climate, charge and basic vehicle state read in a
+// single request
+type VehicleSnapshot struct {
+	VIN       string        `json:"vin"`
+	Climate   *HVACState    `json:"climate"`
+	Charge    *ChargeState  `json:"charge"`
+	Vehicle   *VehicleInfo  `json:"vehicle"`
+	UpdatedAt SnapshotTimes `json:"updated_at"`
+}
+
+// GetVehicleSnapshot reads the climate, charge and basic vehicle state from
+// the vehicle in one request. The climate state also updates the cached
+// HVAC state.
+func (c *Client) GetVehicleSnapshot(ctx context.Context) (*VehicleSnapshot, error) {
+	value, _, err := c.reads.do(ctx, "get_vehicle_snapshot", func(ctx context.Context) (interface{}, error) {
+		return c.readVehicleSnapshot(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Each caller gets its own copy of the shared result
+	snapshot := *value.(*VehicleSnapshot)
+	climate, charge, info := *snapshot.Climate, *snapshot.Charge, *snapshot.Vehicle
+	snapshot.Climate, snapshot.Charge, snapshot.Vehicle = &climate, &charge, &info
+	return &snapshot, nil
+}
+
+// readVehicleSnapshot reads a VehicleSnapshot from the vehicle
+func (c *Client) readVehicleSnapshot(ctx context.Context) (*VehicleSnapshot, error) {
+	stateCtx, cancel := c.withTimeout(ctx, c.operationTimeout(10*time.Second))
+	defer cancel()
+
+	var result *VehicleSnapshot
+	err := c.retryWithBackoff(stateCtx, "get_vehicle_snapshot", func() error {
+		if c.vehicle == nil {
+			return ErrNotConnected
+		}
+
+		data, err := c.vehicle.GetStates(stateCtx, snapshotCategories...)
+		if err != nil {
+			return fmt.Errorf("failed to get vehicle state: %w", err)
+		}
+		if data.GetClimateState() == nil || data.GetChargeState() == nil {
+			return fmt.Errorf("no climate or charge state data received")
+		}
+
+		readAt := time.Now()
+		closures, drive := data.GetClosuresState(), data.GetDriveState()
+		vehicleAt := stateTime(drive.GetTimestamp(), readAt)
+		if closuresAt := stateTime(closures.GetTimestamp(), readAt); closuresAt.Before(vehicleAt) {
+			vehicleAt = closuresAt
+		}
+		result = &VehicleSnapshot{
+			VIN:     c.vin,
+			Climate: hvacStateFrom(data.GetClimateState()),
+			Charge:  chargeStateFrom(data.GetChargeState()),
+			Vehicle: vehicleInfoFrom(closures, drive),
+			UpdatedAt: SnapshotTimes{
+				Climate: stateTime(data.GetClimateState().GetTimestamp(), readAt),
+				Charge:  stateTime(data.GetChargeState().GetTimestamp(), readAt),
+				Vehicle: vehicleAt,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordState(result.Climate)
+	return result, nil
+}
+
+// stateTime returns the time a vehicle state category was current, or
+// readAt if the vehicle didn't report it
+func stateTime(timestamp *timestamppb.Timestamp, readAt time.Time) time.Time {
+	if timestamp.GetSeconds() <= 0 {
+		return readAt
+	}
+	return timestamp.AsTime()
+}
+
+// vehicleInfoFrom converts the vehicle's closures and drive state
+func vehicleInfoFrom(closures *carserver.ClosuresState, drive *carserver.DriveState) *VehicleInfo {
+	return &VehicleInfo{
+		Locked:      closures.GetLocked(),
+		UserPresent: closures.GetIsUserPresent(),
+		SentryMode:  sentryModeName(closures.GetSentryModeState()),
+		ShiftState:  shiftStateName(drive.GetShiftState()),
+		SpeedKph:    round1(float64(drive.GetSpeedFloat()) * kmPerMile),
+		OdometerKm:  round1(float64(drive.GetOdometerInHundredthsOfAMile()) / 100 * kmPerMile),
+	}
+}
+
+// sentryModeName returns the name of a Sentry Mode state
+func sentryModeName(state *carserver.ClosuresState_SentryModeState) string {
+	switch state.GetType().(type) {
+	case *carserver.ClosuresState_SentryModeState_Off:
+		return "off"
+	case *carserver.ClosuresState_SentryModeState_Idle:
+		return "idle"
+	case *carserver.ClosuresState_SentryModeState_Armed:
+		return "armed"
+	case *carserver.ClosuresState_SentryModeState_Aware:
+		return "aware"
+	case *carserver.ClosuresState_SentryModeState_Panic:
+		return "panic"
+	case *carserver.ClosuresState_SentryModeState_Quiet:
+		return "quiet"
+	default:
+		return "unknown"
+	}
+}
+
+// shiftStateName returns the gear of a shift state
+func shiftStateName(state *carserver.ShiftState) string {
+	switch state.GetType().(type) {
+	case *carserver.ShiftState_P:
+		return "P"
+	case *carserver.ShiftState_R:
+		return "R"
+	case *carserver.ShiftState_N:
+		return "N"
+	case *carserver.ShiftState_D:
+		return "D"
+	default:
+		return "unknown"
+	}
+}
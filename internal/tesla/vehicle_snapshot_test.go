@@ -0,0 +1,54 @@
+package tesla
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestVehicleInfoFrom(t *testing.T) {
+	closures := &carserver.ClosuresState{
+		OptionalLocked: &carserver.ClosuresState_Locked{Locked: true},
+		SentryModeState: &carserver.ClosuresState_SentryModeState{
+			Type: &carserver.ClosuresState_SentryModeState_Armed{},
+		},
+	}
+	drive := &carserver.DriveState{
+		ShiftState:                          &carserver.ShiftState{Type: &carserver.ShiftState_P{}},
+		OptionalOdometerInHundredthsOfAMile: &carserver.DriveState_OdometerInHundredthsOfAMile{OdometerInHundredthsOfAMile: 1000000},
+	}
+
+	info := vehicleInfoFrom(closures, drive)
+	if !info.Locked || info.SentryMode != "armed" || info.ShiftState != "P" || info.OdometerKm != 16093.4 {
+		t.Errorf("Unexpected info %+v", info)
+	}
+
+	info = vehicleInfoFrom(nil, nil)
+	if info.SentryMode != "unknown" || info.ShiftState != "unknown" {
+		t.Errorf("Expected unknown states without data, got %+v", info)
+	}
+}
+
+func TestStateTime(t *testing.T) {
+	readAt := time.Now()
+	if got := stateTime(nil, readAt); !got.Equal(readAt) {
+		t.Errorf("Expected the read time without a timestamp, got %v", got)
+	}
+	reported := readAt.Add(-time.Minute).Truncate(time.Second)
+	if got := stateTime(timestamppb.New(reported), readAt); !got.Equal(reported) {
+		t.Errorf("Expected the vehicle's timestamp %v, got %v", reported, got)
+	}
+}
+
+func TestGetVehicleSnapshotNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.GetVehicleSnapshot(ctx); err == nil {
+		t.Error("Expected error when not connected")
+	}
+}
@@ -0,0 +1,257 @@
+package tesla
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// wakeSchedulerTick is how often the scheduler re-evaluates pending work
+// when no events arrive
+const wakeSchedulerTick = 10 * time.Second
+
+// WakeTask is the state of a task managed by a WakeScheduler
+type WakeTask struct {
+	Name      string        `json:"name"`
+	Interval  time.Duration `json:"interval,omitempty"`  // 0 for one-shot tasks
+	MaxDelay  time.Duration `json:"max_delay,omitempty"` // 0 never wakes the vehicle
+	DueAt     time.Time     `json:"due_at"`
+	LastRunAt time.Time     `json:"last_run_at,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+	Runs      int           `json:"runs"`
+	Wakes     int           `json:"wakes"` // Runs that had to wake the vehicle
+}
+
+// wakeTask is a scheduled unit of non-urgent work
+type wakeTask struct {
+	WakeTask
+	fn func(ctx context.Context) error
+}
+
+// WakeScheduler batches non-urgent work into windows when the vehicle is
+// already awake, so background polling doesn't wake the car and cause
+// vampire drain. Due tasks wait until the vehicle is seen awake: by a state
+// read or command, or by a sleep status probe, which doesn't wake it. A task
+// with a MaxDelay that has waited that long past its due time runs anyway,
+// and every other due task runs in the same window.
+type WakeScheduler struct {
+	client *Client
+	logger *log.Logger
+
+	// probe checks the sleep state without waking the vehicle
+	probe func(ctx context.Context) (AwakeStatus, error)
+
+	mu        sync.Mutex
+	tasks     map[string]*wakeTask
+	lastProbe time.Time
+	kick      chan struct{}
+}
+
+// NewWakeScheduler creates a scheduler for the client's vehicle
+func NewWakeScheduler(client *Client, logger *log.Logger) *WakeScheduler {
+	if logger == nil {
+		logger = client.logger
+	}
+	return &WakeScheduler{
+		client: client,
+		logger: logger,
+		probe:  client.SleepStatus,
+		tasks:  make(map[string]*wakeTask),
+		kick:   make(chan struct{}, 1),
+	}
+}
+
+// Every schedules fn to run every interval while the vehicle is awake. The
+// first run is due immediately. If maxDelay is positive and a run has been
+// due for that long, it wakes the vehicle rather than wait any longer.
+func (s *WakeScheduler) Every(name string, interval, maxDelay time.Duration, fn func(ctx context.Context) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	s.add(name, interval, maxDelay, fn)
+	return nil
+}
+
+// Defer schedules fn to run once, the next time the vehicle is awake.
+// Deferring a task with the same name as a pending one replaces it, so
+// repeated requests for the same work coalesce into one run.
+func (s *WakeScheduler) Defer(name string, maxDelay time.Duration, fn func(ctx context.Context) error) {
+	s.add(name, 0, maxDelay, fn)
+}
+
+// add registers a task, keeping the run history of a task it replaces
+func (s *WakeScheduler) add(name string, interval, maxDelay time.Duration, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	task := &wakeTask{
+		WakeTask: WakeTask{Name: name, Interval: interval, MaxDelay: maxDelay, DueAt: time.Now()},
+		fn:       fn,
+	}
+	if existing, ok := s.tasks[name]; ok {
+		task.LastRunAt = existing.LastRunAt
+		task.LastError = existing.LastError
+		task.Runs = existing.Runs
+		task.Wakes = existing.Wakes
+	}
+	s.tasks[name] = task
+	s.mu.Unlock()
+
+	s.wakeUp()
+}
+
+// Remove cancels a task
+func (s *WakeScheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, name)
+}
+
+// Tasks returns the state of every task, ordered by due time
+func (s *WakeScheduler) Tasks() []WakeTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks := make([]WakeTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task.WakeTask)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].DueAt.Equal(tasks[j].DueAt) {
+			return tasks[i].DueAt.Before(tasks[j].DueAt)
+		}
+		return tasks[i].Name < tasks[j].Name
+	})
+	return tasks
+}
+
+// Run evaluates pending work until ctx is done. Work runs as soon as the
+// vehicle is observed awake.
+func (s *WakeScheduler) Run(ctx context.Context) error {
+	events, unsubscribe := s.client.Events().Subscribe(8)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(wakeSchedulerTick)
+	defer ticker.Stop()
+
+	for {
+		s.RunDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-s.kick:
+		case event := <-events:
+			if event.Type != EventAwakeChanged && event.Type != EventConnected {
+				continue
+			}
+		}
+	}
+}
+
+// RunDue runs the tasks that are due, if the policy allows it
+func (s *WakeScheduler) RunDue(ctx context.Context) {
+	now := time.Now()
+	due := s.dueTasks(now)
+	if len(due) == 0 {
+		return
+	}
+
+	settings := s.client.wakeSettings()
+	awake := s.client.IsAwake(settings.AwakeWindow)
+
+	// Check whether the vehicle is awake without waking it, at most once
+	// per probe interval
+	if !awake && s.client.IsConnected() && s.probeDue(now, settings.ProbeInterval) {
+		if _, err := s.probe(ctx); err != nil {
+			s.logger.Printf("Failed to check vehicle sleep status: %v", err)
+		}
+		awake = s.client.IsAwake(settings.AwakeWindow)
+	}
+
+	for _, task := range due {
+		overdue := task.MaxDelay > 0 && now.Sub(task.DueAt) >= task.MaxDelay
+		if !awake && !overdue {
+			continue
+		}
+
+		if !awake {
+			s.logger.Printf("Waking vehicle for %s, due for %v", task.Name, now.Sub(task.DueAt).Round(time.Second))
+		}
+		err := task.fn(ctx)
+		s.finish(task.Name, now, err, !awake)
+
+		// A run that woke the vehicle opens a window for the rest
+		awake = s.client.IsAwake(settings.AwakeWindow)
+	}
+}
+
+// dueTasks returns the tasks that are due at now, oldest first
+func (s *WakeScheduler) dueTasks(now time.Time) []wakeTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []wakeTask
+	for _, task := range s.tasks {
+		if !task.DueAt.After(now) {
+			due = append(due, *task)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].DueAt.Before(due[j].DueAt) })
+	return due
+}
+
+// probeDue reports whether enough time has passed since the last probe, and
+// if so records a probe at now
+func (s *WakeScheduler) probeDue(now time.Time, interval time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastProbe.IsZero() && now.Sub(s.lastProbe) < interval {
+		return false
+	}
+	s.lastProbe = now
+	return true
+}
+
+// finish records a run and reschedules or removes the task
+func (s *WakeScheduler) finish(name string, now time.Time, err error, woke bool) {
+	if err != nil {
+		s.logger.Printf("Scheduled task %s failed: %v", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[name]
+	if !ok || task.DueAt.After(now) {
+		// Removed or replaced while running
+		return
+	}
+
+	task.Runs++
+	task.LastRunAt = now
+	task.LastError = ""
+	if err != nil {
+		task.LastError = err.Error()
+	}
+	if woke {
+		task.Wakes++
+	}
+
+	if task.Interval > 0 {
+		task.DueAt = now.Add(task.Interval)
+	} else {
+		delete(s.tasks, name)
+	}
+}
+
+// wakeUp prompts Run to re-evaluate pending work
+func (s *WakeScheduler) wakeUp() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,174 @@
+package tesla
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestObserveAwakePublishesChanges(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	if status := client.AwakeStatus(); status.State != AwakeUnknown {
+		t.Errorf("Expected unknown state initially, got %s", status.State)
+	}
+
+	events, unsubscribe := client.Events().Subscribe(4)
+	defer unsubscribe()
+
+	client.observeAwake(Awake, true)
+	client.observeAwake(Awake, true)
+	client.observeAwake(Asleep, false)
+
+	var states []AwakeState
+	for len(events) > 0 {
+		event := <-events
+		if event.Type == EventAwakeChanged {
+			states = append(states, event.Data.(AwakeStatus).State)
+		}
+	}
+	if len(states) != 2 || states[0] != Awake || states[1] != Asleep {
+		t.Errorf("Expected awake then asleep events, got %v", states)
+	}
+
+	if client.IsAwake(time.Minute) {
+		t.Error("Expected vehicle to be reported asleep")
+	}
+	client.markAwake()
+	if !client.IsAwake(time.Minute) {
+		t.Error("Expected vehicle to be reported awake")
+	}
+	if client.IsAwake(0) {
+		t.Error("Expected an awake observation outside the window not to count")
+	}
+}
+
+func TestWakeNotConnected(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	tuning := client.Tuning()
+	tuning.Wake.OnDemand = true
+	client.ApplyTuning(tuning)
+
+	if err := client.Wake(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+	// Wake on demand leaves the not-connected error to the command
+	if err := client.ensureAwake(context.Background()); err != nil {
+		t.Errorf("Expected no wake attempt without a connection, got %v", err)
+	}
+	if err := client.SetClimateOn(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestWakeSchedulerWaitsForAwakeVehicle(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	scheduler := NewWakeScheduler(client, nil)
+
+	runs := 0
+	if err := scheduler.Every("poll", time.Hour, 0, func(ctx context.Context) error {
+		runs++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Asleep: the task waits
+	client.observeAwake(Asleep, false)
+	scheduler.RunDue(context.Background())
+	if runs != 0 {
+		t.Fatalf("Expected task to wait while the vehicle sleeps, ran %d times", runs)
+	}
+
+	// Awake: the task runs and is rescheduled
+	client.observeAwake(Awake, false)
+	scheduler.RunDue(context.Background())
+	if runs != 1 {
+		t.Fatalf("Expected task to run once the vehicle is awake, ran %d times", runs)
+	}
+
+	tasks := scheduler.Tasks()
+	if len(tasks) != 1 || tasks[0].Runs != 1 || tasks[0].Wakes != 0 || time.Until(tasks[0].DueAt) < 59*time.Minute {
+		t.Errorf("Unexpected task state: %+v", tasks)
+	}
+
+	// Not due again yet
+	scheduler.RunDue(context.Background())
+	if runs != 1 {
+		t.Errorf("Expected task not to run before its interval, ran %d times", runs)
+	}
+}
+
+func TestWakeSchedulerForcesOverdueTasks(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	scheduler := NewWakeScheduler(client, nil)
+	client.observeAwake(Asleep, false)
+
+	var order []string
+	scheduler.Defer("urgent-ish", time.Nanosecond, func(ctx context.Context) error {
+		order = append(order, "urgent-ish")
+		// The command woke the vehicle
+		client.markAwake()
+		return nil
+	})
+	scheduler.Defer("lazy", 0, func(ctx context.Context) error {
+		order = append(order, "lazy")
+		return errors.New("read failed")
+	})
+
+	time.Sleep(time.Millisecond)
+	scheduler.RunDue(context.Background())
+
+	// The overdue task woke the vehicle, and the lazy one rode along
+	if len(order) != 2 || order[0] != "urgent-ish" || order[1] != "lazy" {
+		t.Fatalf("Expected both tasks to run in one window, got %v", order)
+	}
+	if tasks := scheduler.Tasks(); len(tasks) != 0 {
+		t.Errorf("Expected one-shot tasks to be removed, got %+v", tasks)
+	}
+}
+
+func TestWakeSchedulerDeferCoalesces(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	scheduler := NewWakeScheduler(client, nil)
+
+	calls := 0
+	for i := 0; i < 3; i++ {
+		scheduler.Defer("verify", 0, func(ctx context.Context) error {
+			calls++
+			return nil
+		})
+	}
+
+	client.markAwake()
+	scheduler.RunDue(context.Background())
+	if calls != 1 {
+		t.Errorf("Expected coalesced task to run once, ran %d times", calls)
+	}
+}
+
+func TestWakeSchedulerProbesAtMostOncePerInterval(t *testing.T) {
+	client := NewClient("TEST_VIN", nil)
+	scheduler := NewWakeScheduler(client, nil)
+
+	probes := 0
+	scheduler.probe = func(ctx context.Context) (AwakeStatus, error) {
+		probes++
+		client.observeAwake(Asleep, false)
+		return client.AwakeStatus(), nil
+	}
+	scheduler.Defer("task", 0, func(ctx context.Context) error { return nil })
+
+	// Probing needs a connection; without one the scheduler just waits
+	scheduler.RunDue(context.Background())
+	if probes != 0 {
+		t.Errorf("Expected no probe while disconnected, got %d", probes)
+	}
+
+	if !scheduler.probeDue(time.Now(), time.Minute) {
+		t.Error("Expected first probe to be due")
+	}
+	if scheduler.probeDue(time.Now(), time.Minute) {
+		t.Error("Expected second probe within the interval not to be due")
+	}
+}
@@ -0,0 +1,518 @@
+// Package tracing records spans for the server's command pipeline and exports
+// them to an OpenTelemetry collector over OTLP/HTTP with JSON encoding.
+//
+// Spans are started with Start, which continues the trace in the context.
+// Until SetTracer installs a tracer, and for traces that aren't sampled,
+// Start returns a nil *Span; its methods do nothing, so call sites don't
+// check. Trace context crosses process boundaries in W3C traceparent
+// headers; see Extract, Inject and Handler.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultServiceName identifies the server unless the config names it
+const DefaultServiceName = "tesla-hvac-server"
+
+// DefaultInterval is how often spans are exported unless the config sets it
+const DefaultInterval = 5 * time.Second
+
+// Config selects a collector. Tracing is disabled without one.
+type Config struct {
+	Endpoint    string            `json:"endpoint,omitempty"`     // OTLP/HTTP collector, e.g. http://localhost:4318
+	Headers     map[string]string `json:"headers,omitempty"`      // Sent with every export, e.g. an API key
+	ServiceName string            `json:"service_name,omitempty"` // Defaults to tesla-hvac-server
+	SampleRatio float64           `json:"sample_ratio,omitempty"` // Fraction of new traces recorded; defaults to 1
+	Interval    time.Duration     `json:"interval,omitempty"`     // Export interval; defaults to 5 seconds
+}
+
+// Enabled reports whether a collector is configured
+func (c Config) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("endpoint must be an http or https URL")
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("sample_ratio must be between 0 and 1")
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	return nil
+}
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the ID in hex
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// String returns the ID in hex
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that is propagated to its children,
+// including across processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Valid reports whether the context identifies a span
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Attribute is a key and a string, bool, integer or float value
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an attribute
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Event is something that happened during a span
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// Kinds of span, as numbered by OTLP
+const (
+	kindInternal = 1
+	kindServer   = 2
+	kindClient   = 3
+)
+
+// Span is a timed operation within a trace. A nil *Span is valid and
+// records nothing.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	name    string
+	kind    int
+	start   time.Time
+
+	mutex      sync.Mutex
+	end        time.Time
+	attributes []Attribute
+	events     []Event
+	err        string
+	failed     bool
+	ended      bool
+}
+
+// Context returns the span's propagated context
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttributes adds attributes, replacing any with the same key
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, attribute := range attributes {
+		replaced := false
+		for i := range s.attributes {
+			if s.attributes[i].Key == attribute.Key {
+				s.attributes[i] = attribute
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.attributes = append(s.attributes, attribute)
+		}
+	}
+}
+
+// AddEvent records an event at the current time
+func (s *Span) AddEvent(name string, attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, Event{Name: name, Time: time.Now(), Attributes: attributes})
+}
+
+// RecordError marks the span failed with err. A nil err does nothing.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failed = true
+	s.err = err.Error()
+	s.events = append(s.events, Event{
+		Name:       "exception",
+		Time:       time.Now(),
+		Attributes: []Attribute{Attr("exception.message", err.Error())},
+	})
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+	s.tracer.enqueue(s)
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// SpanFromContext returns the span in ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the context of the span in ctx, which may
+// be a remote parent from Extract or an unsampled span
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(remoteKey).(SpanContext)
+	return sc
+}
+
+// ContextWithSpanContext returns ctx with sc as the parent of new spans
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// active is the tracer used by Start
+var active atomic.Pointer[Tracer]
+
+// SetTracer makes t the tracer used by Start. nil disables tracing.
+func SetTracer(t *Tracer) {
+	active.Store(t)
+}
+
+// Start starts a span named name as a child of the span in ctx, or a new
+// trace. The span must be ended.
+func Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return start(ctx, kindInternal, name, attributes)
+}
+
+// StartClient starts a span for a call to another system, such as a command
+// sent to the vehicle
+func StartClient(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	return start(ctx, kindClient, name, attributes)
+}
+
+func start(ctx context.Context, kind int, name string, attributes []Attribute) (context.Context, *Span) {
+	tracer := active.Load()
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.Valid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = tracer.sample()
+	}
+
+	// Unsampled spans still carry the trace so their children aren't sampled
+	ctx = ContextWithSpanContext(ctx, sc)
+	if !sc.Sampled {
+		return context.WithValue(ctx, spanKey, (*Span)(nil)), nil
+	}
+
+	span := &Span{
+		tracer:     tracer,
+		context:    sc,
+		parent:     parent.SpanID,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: append([]Attribute(nil), attributes...),
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// newTraceID returns a random, non-zero trace ID
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID returns a random, non-zero span ID
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// traceparentHeader carries the trace context between processes
+const traceparentHeader = "traceparent"
+
+// Extract returns ctx with the remote parent in the traceparent header of h,
+// if it has a valid one
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := parseTraceparent(h.Get(traceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// Inject sets the traceparent header of h from the span in ctx
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.Valid() {
+		return
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set(traceparentHeader, "00-"+sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+flags)
+}
+
+// parseTraceparent parses a version 00 traceparent, or a later version's
+// leading fields
+func parseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	var flags [1]byte
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.Valid()
+}
+
+// statusRecorder captures the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush passes flushes through for streamed responses
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// hijack a WebSocket connection
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Handler traces each request to next in a server span, continuing the
+// caller's trace from its traceparent header
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if active.Load() == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, span := start(Extract(r.Context(), r.Header), kindServer, r.Method+" "+r.URL.Path, []Attribute{
+			Attr("http.request.method", r.Method),
+			Attr("url.path", r.URL.Path),
+		})
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(Attr("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			span.RecordError(fmt.Errorf("%s", http.StatusText(rec.status)))
+		}
+	})
+}
+
+// Tracer samples traces and exports their spans
+type Tracer struct {
+	config   Config
+	client   *http.Client
+	logger   *log.Logger
+	ratio    uint64 // Sampling threshold out of 1<<63
+	mutex    sync.Mutex
+	pending  []*Span
+	dropped  int
+	flushing sync.Mutex
+}
+
+// maxPending bounds the spans waiting for export; the oldest are dropped
+const maxPending = 2048
+
+// New creates a tracer exporting to the configured collector
+func New(config Config, logger *log.Logger) (*Tracer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if !config.Enabled() {
+		return nil, fmt.Errorf("no endpoint configured")
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = DefaultServiceName
+	}
+	if config.SampleRatio == 0 {
+		config.SampleRatio = 1
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Tracer{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+		ratio:  uint64(config.SampleRatio * (1 << 63)),
+	}, nil
+}
+
+// sample decides whether a new trace is recorded
+func (t *Tracer) sample() bool {
+	if t.config.SampleRatio >= 1 {
+		return true
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:])>>1 < t.ratio
+}
+
+// enqueue queues an ended span for export
+func (t *Tracer) enqueue(s *Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.pending) >= maxPending {
+		t.pending = t.pending[1:]
+		t.dropped++
+	}
+	t.pending = append(t.pending, s)
+}
+
+// Run exports spans every interval until ctx is done, then exports the
+// remainder. Export failures are logged and the spans dropped.
+func (t *Tracer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			t.flush(flushCtx)
+			return nil
+		case <-ticker.C:
+			t.flush(ctx)
+		}
+	}
+}
+
+// Flush exports the spans ended so far
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.flushing.Lock()
+	defer t.flushing.Unlock()
+
+	t.mutex.Lock()
+	spans, dropped := t.pending, t.dropped
+	t.pending, t.dropped = nil, 0
+	t.mutex.Unlock()
+
+	if dropped > 0 {
+		t.logger.Printf("warn: Dropped %d spans waiting for export", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return t.export(ctx, spans)
+}
+
+// flush exports and logs a failure
+func (t *Tracer) flush(ctx context.Context) {
+	if err := t.Flush(ctx); err != nil {
+		t.logger.Printf("Failed to export spans: %v", err)
+	}
+}
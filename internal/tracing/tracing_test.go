@@ -0,0 +1,206 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// collector is a fake OTLP/HTTP endpoint that keeps the spans it receives
+type collector struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	header http.Header
+	spans  []otlpSpan
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.header = r.Header
+		for _, resource := range req.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				c.spans = append(c.spans, scope.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// span returns the received span named name
+func (c *collector) span(t *testing.T, name string) otlpSpan {
+	t.Helper()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("No span named %q in %v", name, c.spans)
+	return otlpSpan{}
+}
+
+// install makes a tracer exporting to c the active tracer for the test
+func install(t *testing.T, c *collector, config Config) *Tracer {
+	config.Endpoint = c.URL
+	tracer, err := New(config, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetTracer(tracer)
+	t.Cleanup(func() { SetTracer(nil) })
+	return tracer
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		valid  bool
+	}{
+		{Config{}, true},
+		{Config{Endpoint: "http://localhost:4318", SampleRatio: 0.5}, true},
+		{Config{Endpoint: "localhost:4318"}, false},
+		{Config{Endpoint: "http://localhost:4318", SampleRatio: 2}, false},
+		{Config{Endpoint: "http://localhost:4318", Interval: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid %v, got %v", tt.config, tt.valid, err)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "unused")
+	span.SetAttributes(Attr("key", "value"))
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	if span != nil || SpanContextFromContext(ctx).Valid() {
+		t.Errorf("Expected no span without a tracer")
+	}
+}
+
+func TestExport(t *testing.T) {
+	c := newCollector(t)
+	tracer := install(t, c, Config{Headers: map[string]string{"X-API-Key": "secret"}, ServiceName: "test"})
+
+	ctx, parent := Start(context.Background(), "command", Attr("vehicle.vin", "TEST_VIN"))
+	_, child := StartClient(ctx, "vehicle.set_temperature", Attr("attempt", 1))
+	child.RecordError(errors.New("timeout"))
+	child.End()
+	parent.AddEvent("retry", Attr("delay_ms", int64(100)))
+	parent.End()
+	parent.End()
+
+	if err := tracer.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.spans) != 2 || c.header.Get("X-API-Key") != "secret" {
+		t.Fatalf("Expected two spans with the configured header, got %v %v", c.spans, c.header)
+	}
+
+	p, ch := c.span(t, "command"), c.span(t, "vehicle.set_temperature")
+	if ch.TraceID != p.TraceID || ch.ParentSpanID != p.SpanID || p.ParentSpanID != "" {
+		t.Errorf("Expected the child in the parent's trace, got %+v and %+v", p, ch)
+	}
+	if ch.Kind != kindClient || ch.Status.Code != 2 || ch.Status.Message != "timeout" {
+		t.Errorf("Expected a failed client span, got %+v", ch)
+	}
+	if *ch.Attributes[0].Value.IntValue != "1" || *p.Attributes[0].Value.StringValue != "TEST_VIN" {
+		t.Errorf("Unexpected attributes %+v and %+v", p.Attributes, ch.Attributes)
+	}
+	if len(p.Events) != 1 || p.Events[0].Name != "retry" {
+		t.Errorf("Expected the retry event, got %+v", p.Events)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	c := newCollector(t)
+	tracer := install(t, c, Config{SampleRatio: 0.000001})
+
+	// Almost no trace is sampled, and then neither are its spans
+	for i := 0; i < 10; i++ {
+		ctx, span := Start(context.Background(), "root")
+		_, child := Start(ctx, "child")
+		child.End()
+		span.End()
+	}
+
+	// A sampled remote parent is followed
+	ctx := ContextWithSpanContext(context.Background(), SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true})
+	_, span := Start(ctx, "sampled")
+	span.End()
+
+	tracer.Flush(context.Background())
+	if len(c.spans) != 1 || c.spans[0].Name != "sampled" {
+		t.Errorf("Expected only the sampled span, got %v", c.spans)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	if _, ok := parseTraceparent("00-00000000000000000000000000000000-00f067aa0ba902b7-01"); ok {
+		t.Error("Expected a zero trace ID to be rejected")
+	}
+	if _, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"); ok {
+		t.Error("Expected a missing field to be rejected")
+	}
+
+	h := http.Header{}
+	h.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), h)
+	sc := SpanContextFromContext(ctx)
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("Unexpected span context %+v", sc)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get("traceparent") != h.Get("traceparent") {
+		t.Errorf("Expected %q, got %q", h.Get("traceparent"), out.Get("traceparent"))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := newCollector(t)
+	tracer := install(t, c, Config{})
+
+	var inner SpanContext
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = SpanContextFromContext(r.Context())
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	req := httptest.NewRequest("POST", "/api/v1/hvac/on", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	tracer.Flush(context.Background())
+	span := c.span(t, "POST /api/v1/hvac/on")
+	if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" || span.Kind != kindServer {
+		t.Errorf("Expected a server span continuing the caller's trace, got %+v", span)
+	}
+	if inner.SpanID.String() != span.SpanID {
+		t.Errorf("Expected the handler to run in the span")
+	}
+	if span.Status.Code != 2 {
+		t.Errorf("Expected a 503 to fail the span, got %+v", span.Status)
+	}
+}
@@ -0,0 +1,196 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// maxBinarySize bounds the binary download
+const maxBinarySize = 256 << 20
+
+// ErrRolledBack is returned by Recover when an update failed to start and
+// the previous binary was restored. The process should exit so the service
+// manager starts the restored binary.
+var ErrRolledBack = errors.New("update failed to start; previous version restored")
+
+// pendingUpdate is the marker written next to the binary while a new
+// version proves it can start
+type pendingUpdate struct {
+	Version     string    `json:"version"`
+	Previous    string    `json:"previous"`
+	InstalledAt time.Time `json:"installed_at"`
+	Attempts    int       `json:"attempts"`
+}
+
+// previousPath is where the replaced binary is kept until the update commits
+func previousPath(exePath string) string {
+	return exePath + ".old"
+}
+
+// markerPath is the pending update marker for a binary
+func markerPath(exePath string) string {
+	return exePath + ".update"
+}
+
+// Apply downloads the release binary for this platform, verifies its digest
+// and signature, and replaces exePath with it. The replaced binary is kept
+// until the new one starts and calls Commit; if it fails to start, Recover
+// restores the replaced binary.
+func (c *Checker) Apply(ctx context.Context, release *Release, exePath string) error {
+	asset, ok := release.Assets[Platform()]
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s", release.Version, Platform())
+	}
+
+	binary, err := c.download(ctx, asset.URL)
+	if err != nil {
+		return err
+	}
+	publicKey, err := c.config.publicKey()
+	if err != nil {
+		return err
+	}
+	if err := verify(binary, asset, publicKey); err != nil {
+		return fmt.Errorf("release %s: %w", release.Version, err)
+	}
+
+	if err := install(exePath, binary); err != nil {
+		return err
+	}
+
+	marker, err := json.Marshal(pendingUpdate{Version: release.Version, Previous: c.current, InstalledAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(markerPath(exePath), marker, 0644); err != nil {
+		return fmt.Errorf("failed to record pending update: %w", err)
+	}
+
+	c.logger.Printf("Installed %s over %s; restart to run it", release.Version, c.current)
+	return nil
+}
+
+// download fetches a release binary
+func (c *Checker) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release download returned status %d", resp.StatusCode)
+	}
+	binary, err := io.ReadAll(io.LimitReader(resp.Body, maxBinarySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release: %w", err)
+	}
+	if len(binary) > maxBinarySize {
+		return nil, fmt.Errorf("release binary is larger than %d bytes", maxBinarySize)
+	}
+	return binary, nil
+}
+
+// verify checks a binary against its asset's digest and signature
+func verify(binary []byte, asset Asset, publicKey ed25519.PublicKey) error {
+	digest := sha256.Sum256(binary)
+	expected, err := hex.DecodeString(asset.SHA256)
+	if err != nil || !bytes.Equal(digest[:], expected) {
+		return fmt.Errorf("binary digest doesn't match the manifest")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(asset.Signature)
+	if err != nil || !ed25519.Verify(publicKey, binary, signature) {
+		return fmt.Errorf("binary signature is invalid")
+	}
+	return nil
+}
+
+// install writes binary next to exePath and swaps it in, keeping the
+// current binary at previousPath
+func install(exePath string, binary []byte) error {
+	info, err := os.Stat(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat current binary: %w", err)
+	}
+
+	newPath := exePath + ".new"
+	if err := os.WriteFile(newPath, binary, info.Mode().Perm()|0100); err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+
+	oldPath := previousPath(exePath)
+	os.Remove(oldPath)
+	if err := os.Rename(exePath, oldPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to move current binary aside: %w", err)
+	}
+	if err := os.Rename(newPath, exePath); err != nil {
+		os.Rename(oldPath, exePath)
+		os.Remove(newPath)
+		return fmt.Errorf("failed to install new binary: %w", err)
+	}
+	return nil
+}
+
+// Recover is called at startup. If an update is pending, it counts this
+// start as the update's trial run and returns true; the caller should call
+// Commit once it has started successfully. If the previous trial run never
+// committed, the previous binary is restored and ErrRolledBack returned.
+func Recover(exePath string) (bool, error) {
+	data, err := os.ReadFile(markerPath(exePath))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read pending update: %w", err)
+	}
+
+	var pending pendingUpdate
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return false, fmt.Errorf("invalid pending update: %w", err)
+	}
+
+	if pending.Attempts > 0 {
+		if err := os.Rename(previousPath(exePath), exePath); err != nil {
+			return false, fmt.Errorf("failed to restore previous binary: %w", err)
+		}
+		os.Remove(markerPath(exePath))
+		return false, fmt.Errorf("%s: %w", pending.Version, ErrRolledBack)
+	}
+
+	pending.Attempts++
+	data, err = json.Marshal(pending)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(markerPath(exePath), data, 0644); err != nil {
+		return false, fmt.Errorf("failed to record update start: %w", err)
+	}
+	return true, nil
+}
+
+// Commit finishes a pending update by removing the marker and the previous
+// binary
+func Commit(exePath string) error {
+	if err := os.Remove(markerPath(exePath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to commit update: %w", err)
+	}
+	os.Remove(previousPath(exePath))
+	return nil
+}
@@ -0,0 +1,243 @@
+// Package update checks a release manifest for new versions of the server
+// and replaces the running binary with a verified download.
+//
+// The manifest is a JSON document listing the latest release and a binary
+// for each platform. Every binary is signed with the release Ed25519 key, and
+// an update is only installed if its signature verifies against the public
+// key in the config.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxManifestSize bounds the manifest download
+const maxManifestSize = 1 << 20
+
+// Config configures update checks. Updates are disabled without a manifest
+// URL.
+type Config struct {
+	ManifestURL   string        `json:"manifest_url,omitempty"`
+	PublicKey     string        `json:"public_key,omitempty"`     // Base64 Ed25519 release signing key
+	CheckInterval time.Duration `json:"check_interval,omitempty"` // How often to check for a new release
+}
+
+// Enabled reports whether update checks are configured
+func (c Config) Enabled() bool {
+	return c.ManifestURL != ""
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if !strings.HasPrefix(c.ManifestURL, "https://") && !strings.HasPrefix(c.ManifestURL, "http://") {
+		return fmt.Errorf("manifest_url must be an http or https URL")
+	}
+	if _, err := c.publicKey(); err != nil {
+		return err
+	}
+	if c.CheckInterval <= 0 {
+		return fmt.Errorf("check_interval must be positive")
+	}
+	return nil
+}
+
+// publicKey decodes the release signing key
+func (c Config) publicKey() (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(c.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public_key must be a base64 Ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Release is the latest release described by the manifest
+type Release struct {
+	Version    string           `json:"version"`
+	ReleasedAt time.Time        `json:"released_at,omitempty"`
+	Notes      string           `json:"notes,omitempty"`
+	Assets     map[string]Asset `json:"assets"` // Keyed by Platform()
+}
+
+// Asset is a release binary for one platform
+type Asset struct {
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`    // Hex digest of the binary
+	Signature string `json:"signature"` // Base64 Ed25519 signature of the binary
+}
+
+// Platform returns the manifest asset key for the running binary, e.g.
+// "linux/arm64"
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// Status is the result of the last update check
+type Status struct {
+	Current   string    `json:"current"`
+	Latest    string    `json:"latest,omitempty"`
+	Available bool      `json:"available"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Checker checks the manifest for releases newer than the running version
+type Checker struct {
+	config     Config
+	current    string
+	httpClient *http.Client
+	logger     *log.Logger
+
+	mu      sync.RWMutex
+	status  Status
+	release *Release
+}
+
+// NewChecker creates a checker for the running version
+func NewChecker(config Config, current string, logger *log.Logger) (*Checker, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if !config.Enabled() {
+		return nil, fmt.Errorf("update checks are not configured")
+	}
+	return &Checker{
+		config:     config,
+		current:    current,
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+		logger:     logger,
+		status:     Status{Current: current},
+	}, nil
+}
+
+// Status returns the result of the last check
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+// Check fetches the manifest and returns the latest release if it is newer
+// than the running version, or nil if the running version is current
+func (c *Checker) Check(ctx context.Context) (*Release, error) {
+	release, err := c.fetchManifest(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.CheckedAt = time.Now()
+	if err != nil {
+		c.status.Error = err.Error()
+		return nil, err
+	}
+
+	c.status.Error = ""
+	c.status.Latest = release.Version
+	c.status.Available = CompareVersions(release.Version, c.current) > 0
+	if !c.status.Available {
+		c.release = nil
+		return nil, nil
+	}
+	c.release = release
+	return release, nil
+}
+
+// Run checks for updates immediately and then every check interval until
+// ctx is done. It only reports new releases; installing one is explicit.
+func (c *Checker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		release, err := c.Check(ctx)
+		if err != nil {
+			c.logger.Printf("Update check failed: %v", err)
+		} else if release != nil {
+			c.logger.Printf("Update available: %s (running %s)", release.Version, c.current)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchManifest downloads and decodes the release manifest
+func (c *Checker) fetchManifest(ctx context.Context) (*Release, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.config.ManifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release manifest returned status %d", resp.StatusCode)
+	}
+
+	var release Release
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&release); err != nil {
+		return nil, fmt.Errorf("invalid release manifest: %w", err)
+	}
+	if release.Version == "" {
+		return nil, fmt.Errorf("release manifest has no version")
+	}
+	return &release, nil
+}
+
+// CompareVersions compares two versions such as "v1.2.3" or "1.3.0-rc.1",
+// returning -1, 0 or 1. Numeric components are compared as numbers, and a
+// pre-release sorts before the release it precedes.
+func CompareVersions(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	default:
+		return 1
+	}
+}
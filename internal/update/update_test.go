@@ -0,0 +1,188 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2", "1.2.1", -1},
+		{"1.3.0-rc.1", "1.3.0", -1},
+		{"1.3.0", "1.3.0-rc.1", 1},
+		{"1.3.0-rc.2", "1.3.0-rc.1", 1},
+		{"dev", "0.0.1", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// testRelease serves a manifest and a binary signed with a fresh key
+func testRelease(t *testing.T, version string, binary []byte) Config {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(binary)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Release{
+			Version: version,
+			Assets: map[string]Asset{Platform(): {
+				URL:       server.URL + "/binary",
+				SHA256:    hex.EncodeToString(digest[:]),
+				Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, binary)),
+			}},
+		})
+	})
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	})
+
+	return Config{
+		ManifestURL:   server.URL + "/manifest.json",
+		PublicKey:     base64.StdEncoding.EncodeToString(publicKey),
+		CheckInterval: time.Hour,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config := testRelease(t, "1.1.0", []byte("new"))
+
+	checker, err := NewChecker(config, "1.0.0", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := checker.Check(context.Background())
+	if err != nil || release == nil || release.Version != "1.1.0" {
+		t.Fatalf("Expected release 1.1.0, got %+v, %v", release, err)
+	}
+	if status := checker.Status(); !status.Available || status.Latest != "1.1.0" || status.Current != "1.0.0" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	current, err := NewChecker(config, "1.1.0", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release, err := current.Check(context.Background()); err != nil || release != nil {
+		t.Errorf("Expected no update for the current version, got %+v, %v", release, err)
+	}
+}
+
+func TestApplyAndCommit(t *testing.T) {
+	config := testRelease(t, "1.1.0", []byte("new binary"))
+	exePath := filepath.Join(t.TempDir(), "server")
+	if err := os.WriteFile(exePath, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checker, _ := NewChecker(config, "1.0.0", log.New(io.Discard, "", 0))
+	release, err := checker.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.Apply(context.Background(), release, exePath); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if data, _ := os.ReadFile(exePath); string(data) != "new binary" {
+		t.Errorf("Expected new binary installed, got %q", data)
+	}
+
+	// First start of the new binary is its trial run
+	pending, err := Recover(exePath)
+	if err != nil || !pending {
+		t.Fatalf("Expected pending update, got %v, %v", pending, err)
+	}
+	if err := Commit(exePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(previousPath(exePath)); !os.IsNotExist(err) {
+		t.Error("Expected previous binary removed after commit")
+	}
+	if pending, err := Recover(exePath); err != nil || pending {
+		t.Errorf("Expected no pending update after commit, got %v, %v", pending, err)
+	}
+}
+
+func TestRecoverRollsBackFailedStart(t *testing.T) {
+	config := testRelease(t, "1.1.0", []byte("broken binary"))
+	exePath := filepath.Join(t.TempDir(), "server")
+	if err := os.WriteFile(exePath, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checker, _ := NewChecker(config, "1.0.0", log.New(io.Discard, "", 0))
+	release, _ := checker.Check(context.Background())
+	if err := checker.Apply(context.Background(), release, exePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trial run crashes before committing, so the next start rolls back
+	if _, err := Recover(exePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Recover(exePath); !errors.Is(err, ErrRolledBack) {
+		t.Fatalf("Expected ErrRolledBack, got %v", err)
+	}
+	if data, _ := os.ReadFile(exePath); string(data) != "old binary" {
+		t.Errorf("Expected old binary restored, got %q", data)
+	}
+}
+
+func TestApplyRejectsBadSignature(t *testing.T) {
+	config := testRelease(t, "1.1.0", []byte("new binary"))
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	config.PublicKey = base64.StdEncoding.EncodeToString(otherKey)
+
+	exePath := filepath.Join(t.TempDir(), "server")
+	if err := os.WriteFile(exePath, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checker, _ := NewChecker(config, "1.0.0", log.New(io.Discard, "", 0))
+	release, _ := checker.Check(context.Background())
+	if err := checker.Apply(context.Background(), release, exePath); err == nil {
+		t.Fatal("Expected signature verification to fail")
+	}
+	if data, _ := os.ReadFile(exePath); string(data) != "old binary" {
+		t.Errorf("Expected binary unchanged, got %q", data)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("Expected disabled config to be valid, got %v", err)
+	}
+	if err := (Config{ManifestURL: "https://example.com/m.json", CheckInterval: time.Hour}).Validate(); err == nil {
+		t.Error("Expected error without a public key")
+	}
+}
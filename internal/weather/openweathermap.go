@@ -0,0 +1,107 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// openWeatherMapURL is the 5 day / 3 hour forecast endpoint
+const openWeatherMapURL = "https://api.openweathermap.org/data/2.5/forecast"
+
+// maxForecastSize bounds the forecast response
+const maxForecastSize = 1 << 20
+
+// OpenWeatherMap forecasts from the OpenWeatherMap 5 day / 3 hour forecast.
+// Temperatures between forecast steps are interpolated.
+type OpenWeatherMap struct {
+	baseURL    string
+	apiKey     string
+	latitude   float64
+	longitude  float64
+	httpClient *http.Client
+}
+
+// NewOpenWeatherMap creates a provider for the config's location
+func NewOpenWeatherMap(config Config) *OpenWeatherMap {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &OpenWeatherMap{
+		baseURL:    openWeatherMapURL,
+		apiKey:     config.APIKey,
+		latitude:   config.Latitude,
+		longitude:  config.Longitude,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// openWeatherMapForecast is the part of a forecast response that is used
+type openWeatherMapForecast struct {
+	List []struct {
+		Time int64 `json:"dt"` // Unix seconds
+		Main struct {
+			Temp float64 `json:"temp"`
+		} `json:"main"`
+	} `json:"list"`
+}
+
+// Forecast implements Provider
+func (p *OpenWeatherMap) Forecast(ctx context.Context, at time.Time) (float64, error) {
+	query := url.Values{
+		"lat":   {strconv.FormatFloat(p.latitude, 'f', -1, 64)},
+		"lon":   {strconv.FormatFloat(p.longitude, 'f', -1, 64)},
+		"units": {"metric"},
+		"appid": {p.apiKey},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		// Drop the URL, which carries the API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("failed to fetch forecast: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// The body can echo the request, which carries the API key
+		return 0, fmt.Errorf("failed to fetch forecast: %s", resp.Status)
+	}
+
+	var forecast openWeatherMapForecast
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxForecastSize)).Decode(&forecast); err != nil {
+		return 0, fmt.Errorf("invalid forecast: %w", err)
+	}
+	if len(forecast.List) == 0 {
+		return 0, fmt.Errorf("forecast is empty")
+	}
+
+	// Steps are in time order. A time before the first step, which is at
+	// most three hours away, uses the first.
+	steps := forecast.List
+	if !at.After(time.Unix(steps[0].Time, 0)) {
+		return steps[0].Main.Temp, nil
+	}
+	for i := 1; i < len(steps); i++ {
+		start, end := time.Unix(steps[i-1].Time, 0), time.Unix(steps[i].Time, 0)
+		if at.After(end) {
+			continue
+		}
+		fraction := float64(at.Sub(start)) / float64(end.Sub(start))
+		return steps[i-1].Main.Temp + fraction*(steps[i].Main.Temp-steps[i-1].Main.Temp), nil
+	}
+	return 0, fmt.Errorf("%s is beyond the forecast", at.Format(time.RFC3339))
+}
@@ -0,0 +1,156 @@
+// Package weather fetches temperature forecasts and decides when to
+// precondition the cabin from them.
+//
+// A Rule is a schedule with a forecast condition, such as "if the forecast
+// for 07:00 is below 0°C, precondition at 06:45". When the rule's schedule
+// fires, the forecast for the rule's forecast time is fetched and the action
+// only runs if the condition holds.
+package weather
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+)
+
+// Providers
+const (
+	ProviderOpenWeatherMap = "openweathermap"
+)
+
+// Config selects a forecast provider. Weather rules are disabled without
+// one.
+type Config struct {
+	Provider  string        `json:"provider,omitempty"` // openweathermap (disabled if empty)
+	APIKey    string        `json:"api_key,omitempty"`
+	Latitude  float64       `json:"latitude"`
+	Longitude float64       `json:"longitude"`
+	Timeout   time.Duration `json:"timeout,omitempty"` // Per forecast request; defaults to 10 seconds
+}
+
+// Enabled reports whether a provider is configured
+func (c Config) Enabled() bool {
+	return c.Provider != ""
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.Provider != ProviderOpenWeatherMap {
+		return fmt.Errorf("provider must be %s", ProviderOpenWeatherMap)
+	}
+	if c.Latitude < -90 || c.Latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if c.Longitude < -180 || c.Longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must be non-negative")
+	}
+	return nil
+}
+
+// Provider forecasts the outside temperature
+type Provider interface {
+	// Forecast returns the forecast temperature in Celsius at a time
+	Forecast(ctx context.Context, at time.Time) (float64, error)
+}
+
+// NewProvider creates the provider selected by the config. The API key may
+// come from the environment, so it is only required here.
+func NewProvider(config Config) (Provider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("api_key is required")
+	}
+	switch config.Provider {
+	case ProviderOpenWeatherMap:
+		return NewOpenWeatherMap(config), nil
+	default:
+		return nil, fmt.Errorf("weather is not configured")
+	}
+}
+
+// Rule runs a schedule's action only when the forecast meets a condition.
+// The schedule sets when the check runs and what it does; ForecastAt is the
+// time of day the forecast is checked for, such as the departure time.
+type Rule struct {
+	schedule.Schedule
+	ForecastAt string   `json:"forecast_at,omitempty"` // HH:MM; defaults to the schedule's at
+	Below      *float64 `json:"below,omitempty"`       // Run when the forecast is below this, in Celsius
+	Above      *float64 `json:"above,omitempty"`       // Run when the forecast is above this, in Celsius
+}
+
+// Validate checks the rule's schedule and condition
+func (r Rule) Validate() error {
+	if err := r.Schedule.Validate(); err != nil {
+		return err
+	}
+	if r.ForecastAt != "" {
+		if _, _, err := schedule.ParseTimeOfDay(r.ForecastAt); err != nil {
+			return fmt.Errorf("rule %s: forecast_at %w", r.Name, err)
+		}
+	}
+	if r.Below == nil && r.Above == nil {
+		return fmt.Errorf("rule %s: below or above is required", r.Name)
+	}
+	if r.Below != nil && r.Above != nil && *r.Above >= *r.Below {
+		return fmt.Errorf("rule %s: above must be less than below", r.Name)
+	}
+	return nil
+}
+
+// ForecastTime returns the time the forecast is checked for when the rule
+// fires at t: the first forecast_at at or after t
+func (r Rule) ForecastTime(t time.Time) time.Time {
+	if r.ForecastAt == "" {
+		return t
+	}
+	return schedule.Schedule{At: r.ForecastAt}.Next(t.Add(-time.Minute))
+}
+
+// Matches reports whether a forecast temperature meets the condition. With
+// both bounds set, the temperature must be between them.
+func (r Rule) Matches(celsius float64) bool {
+	if r.Below != nil && celsius >= *r.Below {
+		return false
+	}
+	if r.Above != nil && celsius <= *r.Above {
+		return false
+	}
+	return true
+}
+
+// Describe returns the condition for logs, e.g. "below 0.0°C"
+func (r Rule) Describe() string {
+	switch {
+	case r.Below != nil && r.Above != nil:
+		return fmt.Sprintf("between %.1f°C and %.1f°C", *r.Above, *r.Below)
+	case r.Below != nil:
+		return fmt.Sprintf("below %.1f°C", *r.Below)
+	default:
+		return fmt.Sprintf("above %.1f°C", *r.Above)
+	}
+}
+
+// ValidateRules checks every rule and that names are unique
+func ValidateRules(rules []Rule) error {
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("duplicate rule %s", rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+	return nil
+}
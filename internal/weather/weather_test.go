@@ -0,0 +1,191 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/schedule"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"disabled", Config{}, true},
+		{"openweathermap", Config{Provider: ProviderOpenWeatherMap, APIKey: "key", Latitude: 59.3, Longitude: 18.1}, true},
+		{"unknown provider", Config{Provider: "almanac", APIKey: "key"}, false},
+		{"bad latitude", Config{Provider: ProviderOpenWeatherMap, APIKey: "key", Latitude: 91}, false},
+		{"bad longitude", Config{Provider: ProviderOpenWeatherMap, APIKey: "key", Longitude: -181}, false},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider(Config{Provider: ProviderOpenWeatherMap}); err == nil {
+		t.Error("Expected an error without an API key")
+	}
+	if _, err := NewProvider(Config{}); err == nil {
+		t.Error("Expected an error without a provider")
+	}
+	if _, err := NewProvider(Config{Provider: ProviderOpenWeatherMap, APIKey: "key"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// coldMorning preconditions at 06:45 when 07:00 will be below freezing
+func coldMorning() Rule {
+	return Rule{
+		Schedule:   schedule.Schedule{Name: "cold-morning", Action: schedule.ActionPrecondition, At: "06:45"},
+		ForecastAt: "07:00",
+		Below:      floatPtr(0),
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	if err := coldMorning().Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	noCondition := coldMorning()
+	noCondition.Below = nil
+	badTime := coldMorning()
+	badTime.ForecastAt = "7am"
+	badSchedule := coldMorning()
+	badSchedule.At = ""
+	emptyRange := coldMorning()
+	emptyRange.Above = floatPtr(5)
+
+	for name, rule := range map[string]Rule{
+		"no condition": noCondition,
+		"bad time":     badTime,
+		"bad schedule": badSchedule,
+		"empty range":  emptyRange,
+	} {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := ValidateRules([]Rule{coldMorning(), coldMorning()}); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("Expected a duplicate rule error, got %v", err)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule := coldMorning()
+	if !rule.Matches(-3) || rule.Matches(0) || rule.Matches(4) {
+		t.Error("Expected only temperatures below 0 to match")
+	}
+
+	rule.Below, rule.Above = floatPtr(30), floatPtr(25)
+	if !rule.Matches(27) || rule.Matches(20) || rule.Matches(31) {
+		t.Error("Expected only temperatures between 25 and 30 to match")
+	}
+	if got := rule.Describe(); got != "between 25.0°C and 30.0°C" {
+		t.Errorf("Unexpected description %q", got)
+	}
+}
+
+func TestRuleForecastTime(t *testing.T) {
+	fired := time.Date(2026, 10, 14, 6, 45, 0, 0, time.UTC)
+
+	if got := coldMorning().ForecastTime(fired); !got.Equal(time.Date(2026, 10, 14, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 07:00 the same day, got %v", got)
+	}
+
+	// A forecast time earlier in the day is for tomorrow
+	evening := coldMorning()
+	evening.At = "22:00"
+	fired = time.Date(2026, 10, 14, 22, 0, 0, 0, time.UTC)
+	if got := evening.ForecastTime(fired); !got.Equal(time.Date(2026, 10, 15, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 07:00 the next day, got %v", got)
+	}
+
+	noForecastAt := coldMorning()
+	noForecastAt.ForecastAt = ""
+	if got := noForecastAt.ForecastTime(fired); !got.Equal(fired) {
+		t.Errorf("Expected the firing time, got %v", got)
+	}
+}
+
+// newTestOpenWeatherMap serves a forecast with steps at 06:00 and 09:00
+func newTestOpenWeatherMap(t *testing.T, status int) (*OpenWeatherMap, time.Time) {
+	t.Helper()
+	base := time.Date(2026, 10, 14, 6, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("appid") != "secret" || r.URL.Query().Get("units") != "metric" || r.URL.Query().Get("lat") != "59.3" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"list": [{"dt": %d, "main": {"temp": -3}}, {"dt": %d, "main": {"temp": 3}}]}`,
+			base.Unix(), base.Add(3*time.Hour).Unix())
+	}))
+	t.Cleanup(server.Close)
+
+	provider := NewOpenWeatherMap(Config{Provider: ProviderOpenWeatherMap, APIKey: "secret", Latitude: 59.3, Longitude: 18.1})
+	provider.baseURL = server.URL
+	return provider, base
+}
+
+func TestOpenWeatherMapForecast(t *testing.T) {
+	provider, base := newTestOpenWeatherMap(t, http.StatusOK)
+	ctx := context.Background()
+
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		{base.Add(-time.Hour), -3},
+		{base, -3},
+		{base.Add(time.Hour), -1},
+		{base.Add(90 * time.Minute), 0},
+		{base.Add(3 * time.Hour), 3},
+	}
+	for _, tt := range tests {
+		got, err := provider.Forecast(ctx, tt.at)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("At %v: expected %.1f, got %.1f", tt.at, tt.want, got)
+		}
+	}
+
+	if _, err := provider.Forecast(ctx, base.Add(4*time.Hour)); err == nil || !strings.Contains(err.Error(), "beyond the forecast") {
+		t.Errorf("Expected an error past the forecast, got %v", err)
+	}
+}
+
+func TestOpenWeatherMapErrors(t *testing.T) {
+	provider, base := newTestOpenWeatherMap(t, http.StatusUnauthorized)
+	_, err := provider.Forecast(context.Background(), base)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the status in the error, got %v", err)
+	}
+
+	// Connection errors don't leak the API key
+	provider.baseURL = "http://127.0.0.1:1"
+	_, err = provider.Forecast(context.Background(), base)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected an error without the API key, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Package webhook delivers JSON notifications to configured URLs. Each
+// endpoint has its own queue, so a slow receiver doesn't hold up the others.
+// Failed deliveries are retried with exponential backoff, and payloads are
+// signed with HMAC-SHA256 when the endpoint has a secret.
+//
+// A receiver verifies a delivery by computing
+//
+//	hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// with the X-Webhook-Timestamp header and comparing it with the
+// X-Webhook-Signature header, less its "sha256=" prefix.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Events
+const (
+	EventClimateOn     = "climate_on"        // Climate turned on
+	EventClimateOff    = "climate_off"       // Climate turned off
+	EventCabinTemp     = "cabin_temperature" // The cabin rose above cabin_temp_max
+	EventCircuitOpen   = "circuit_open"      // The circuit breaker opened after repeated failures
+	EventCircuitClosed = "circuit_closed"    // The circuit breaker closed again, as calls succeed
+)
+
+// events lists the valid event names
+var events = []string{EventClimateOn, EventClimateOff, EventCabinTemp, EventCircuitOpen, EventCircuitClosed}
+
+// Defaults unless the config sets them
+const (
+	DefaultMaxRetries = 5
+	DefaultTimeout    = 10 * time.Second
+)
+
+// queueSize bounds the deliveries waiting for each endpoint
+const queueSize = 64
+
+// Config lists the endpoints to notify. Webhooks are disabled without any.
+type Config struct {
+	Endpoints    []Endpoint    `json:"endpoints,omitempty"`
+	CabinTempMax float32       `json:"cabin_temp_max,omitempty"` // Celsius; 0 disables cabin_temperature
+	MaxRetries   int           `json:"max_retries,omitempty"`    // Attempts after the first; defaults to 5
+	Timeout      time.Duration `json:"timeout,omitempty"`        // Per attempt; defaults to 10 seconds
+}
+
+// Endpoint is a URL that receives notifications
+type Endpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` // Signs payloads with HMAC-SHA256
+	Events []string `json:"events,omitempty"` // Defaults to every event
+}
+
+// Enabled reports whether any endpoint is configured
+func (c Config) Enabled() bool {
+	return len(c.Endpoints) > 0
+}
+
+// Validate checks the config
+func (c Config) Validate() error {
+	for i, endpoint := range c.Endpoints {
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoints[%d]: url must be an http or https URL", i)
+		}
+		for _, event := range endpoint.Events {
+			if !validEvent(event) {
+				return fmt.Errorf("endpoints[%d]: unknown event %q", i, event)
+			}
+		}
+	}
+	if c.CabinTempMax < 0 || c.CabinTempMax > 100 {
+		return fmt.Errorf("cabin_temp_max must be between 0 and 100")
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+func validEvent(event string) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// wants reports whether the endpoint receives event
+func (e Endpoint) wants(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, want := range e.Events {
+		if want == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID        string      `json:"id"` // The same for each attempt, so receivers can drop duplicates
+	Event     string      `json:"event"`
+	VIN       string      `json:"vin,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// Sign returns the signature of a body sent at timestamp, in hex
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher queues payloads for the endpoints that want them and delivers
+// them while Run runs
+type Dispatcher struct {
+	config     Config
+	client     *http.Client
+	logger     *log.Logger
+	queues     []chan Payload
+	retryDelay time.Duration // Before the first retry; doubles each time
+}
+
+// NewDispatcher creates a dispatcher for the configured endpoints
+func NewDispatcher(config Config, logger *log.Logger) *Dispatcher {
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	d := &Dispatcher{
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout},
+		logger:     logger,
+		retryDelay: time.Second,
+	}
+	for range config.Endpoints {
+		d.queues = append(d.queues, make(chan Payload, queueSize))
+	}
+	return d
+}
+
+// Send queues payload for each endpoint that wants its event, filling in
+// its ID and timestamp if unset. It never blocks: when an endpoint's queue
+// is full the payload is dropped for it.
+func (d *Dispatcher) Send(payload Payload) {
+	if payload.ID == "" {
+		payload.ID = newID()
+	}
+	if payload.Timestamp.IsZero() {
+		payload.Timestamp = time.Now()
+	}
+	for i, endpoint := range d.config.Endpoints {
+		if !endpoint.wants(payload.Event) {
+			continue
+		}
+		select {
+		case d.queues[i] <- payload:
+		default:
+			d.logger.Printf("warn: Webhook queue for %s is full, dropping %s", endpoint.URL, payload.Event)
+		}
+	}
+}
+
+// Run delivers queued payloads until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := range d.config.Endpoints {
+		wg.Add(1)
+		go func(endpoint Endpoint, queue <-chan Payload) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case payload := <-queue:
+					if err := d.deliver(ctx, endpoint, payload); err != nil && ctx.Err() == nil {
+						d.logger.Printf("Failed to deliver %s webhook to %s: %v", payload.Event, endpoint.URL, err)
+					}
+				}
+			}
+		}(d.config.Endpoints[i], d.queues[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliver posts a payload, retrying with backoff after network errors,
+// 429s and 5xx responses
+func (d *Dispatcher) deliver(ctx context.Context, endpoint Endpoint, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	delay := d.retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := d.post(ctx, endpoint, payload, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == d.config.MaxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying
+func (d *Dispatcher) post(ctx context.Context, endpoint Endpoint, payload Payload, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tesla-hvac-webhook")
+	req.Header.Set("X-Webhook-Event", payload.Event)
+	req.Header.Set("X-Webhook-ID", payload.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+Sign(endpoint.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("endpoint returned %s", resp.Status)
+}
+
+// newID returns a random delivery ID
+func newID() string {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"valid", Config{Endpoints: []Endpoint{{URL: "https://example.com/hook", Events: []string{EventClimateOn}}}, CabinTempMax: 40}, false},
+		{"bad scheme", Config{Endpoints: []Endpoint{{URL: "ftp://example.com"}}}, true},
+		{"no host", Config{Endpoints: []Endpoint{{URL: "http://"}}}, true},
+		{"unknown event", Config{Endpoints: []Endpoint{{URL: "http://example.com", Events: []string{"bogus"}}}}, true},
+		{"cabin temp", Config{CabinTempMax: 150}, true},
+		{"retries", Config{MaxRetries: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"climate_on"}`)
+	sig := Sign("secret", "1700000000", body)
+	if len(sig) != 64 {
+		t.Fatalf("signature %q isn't hex SHA-256", sig)
+	}
+	if sig != Sign("secret", "1700000000", body) {
+		t.Error("signature isn't deterministic")
+	}
+	if sig == Sign("other", "1700000000", body) || sig == Sign("secret", "1700000001", body) {
+		t.Error("signature doesn't depend on the secret and timestamp")
+	}
+}
+
+// runDispatcher runs d until the test ends
+func runDispatcher(t *testing.T, d *Dispatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestDeliverSigned(t *testing.T) {
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign("secret", r.Header.Get("X-Webhook-Timestamp"), body)
+		if got := r.Header.Get("X-Webhook-Signature"); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if r.Header.Get("X-Webhook-Event") != EventClimateOn {
+			t.Errorf("event header = %q", r.Header.Get("X-Webhook-Event"))
+		}
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("body: %v", err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(Config{Endpoints: []Endpoint{{URL: server.URL, Secret: "secret"}}}, log.New(io.Discard, "", 0))
+	runDispatcher(t, d)
+	d.Send(Payload{Event: EventClimateOn, VIN: "VIN1"})
+
+	select {
+	case payload := <-received:
+		if payload.VIN != "VIN1" || payload.ID == "" || payload.Timestamp.IsZero() {
+			t.Errorf("payload = %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	var attempts atomic.Int32
+	delivered := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered <- r.Header.Get("X-Webhook-ID")
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(Config{Endpoints: []Endpoint{{URL: server.URL}}}, log.New(io.Discard, "", 0))
+	d.retryDelay = time.Millisecond
+	runDispatcher(t, d)
+	d.Send(Payload{Event: EventCircuitOpen, ID: "abc"})
+
+	select {
+	case id := <-delivered:
+		if id != "abc" {
+			t.Errorf("ID = %q, want the same ID on each attempt", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3", n)
+	}
+}
+
+func TestDeliverGivesUpOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(Config{Endpoints: []Endpoint{{URL: server.URL}}}, log.New(io.Discard, "", 0))
+	d.retryDelay = time.Millisecond
+	if err := d.deliver(context.Background(), d.config.Endpoints[0], Payload{Event: EventClimateOff}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
+
+func TestSendFiltersEvents(t *testing.T) {
+	d := NewDispatcher(Config{Endpoints: []Endpoint{
+		{URL: "http://a.example", Events: []string{EventCabinTemp}},
+		{URL: "http://b.example"},
+	}}, log.New(io.Discard, "", 0))
+	d.Send(Payload{Event: EventClimateOn})
+	if len(d.queues[0]) != 0 || len(d.queues[1]) != 1 {
+		t.Errorf("queued %d and %d, want 0 and 1", len(d.queues[0]), len(d.queues[1]))
+	}
+}
@@ -0,0 +1,397 @@
+// Package websocket implements the parts of the WebSocket protocol (RFC 6455)
+// the server needs: the opening handshake, text and binary messages,
+// fragmentation, ping/pong and the closing handshake. Extensions and
+// subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message opcodes
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close status codes
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooLarge      = 1009
+)
+
+// acceptGUID is appended to the client key to compute the accept header
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DefaultMaxMessageSize bounds incoming messages unless changed with
+// SetMaxMessageSize
+const DefaultMaxMessageSize = 64 << 10
+
+var (
+	// ErrBadHandshake is returned by Upgrade for requests that aren't valid
+	// WebSocket handshakes
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrClosed is returned once the connection has been closed by either side
+	ErrClosed = errors.New("websocket: connection closed")
+	// ErrMessageTooLarge is returned when a message exceeds the size limit
+	ErrMessageTooLarge = errors.New("websocket: message too large")
+)
+
+// Conn is a WebSocket connection. One goroutine may read while others
+// write; writes are serialized.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client bool // Client connections mask the frames they send
+
+	maxMessageSize int64
+	readTimeout    time.Duration
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// IsUpgrade reports whether r asks to upgrade to WebSocket
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the opening handshake and takes over the connection.
+// On ErrBadHandshake nothing has been written, so the caller can still send
+// an error response.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != "GET" || !IsUpgrade(r) {
+		return nil, fmt.Errorf("%w: not a websocket upgrade", ErrBadHandshake)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("%w: unsupported version", ErrBadHandshake)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, fmt.Errorf("%w: invalid key", ErrBadHandshake)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	// Drop any deadlines the HTTP server set for the request
+	conn.SetDeadline(time.Time{})
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newConn(conn, rw.Reader, false), nil
+}
+
+// Dial opens a client connection to a ws:// URL. It exists for tests and
+// tools; TLS is not supported.
+func Dial(url string, header http.Header) (*Conn, error) {
+	hostPath, ok := strings.CutPrefix(url, "ws://")
+	if !ok {
+		return nil, fmt.Errorf("websocket: unsupported URL %q", url)
+	}
+	host, path, _ := strings.Cut(hostPath, "/")
+
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	key := base64.StdEncoding.EncodeToString(raw)
+
+	req, err := http.NewRequest("GET", "http://"+host+"/"+path, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: status %d", ErrBadHandshake, resp.StatusCode)
+	}
+	return newConn(conn, reader, true), nil
+}
+
+func newConn(conn net.Conn, reader *bufio.Reader, client bool) *Conn {
+	return &Conn{conn: conn, reader: reader, client: client, maxMessageSize: DefaultMaxMessageSize}
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value for a client key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether a comma-separated header has a token
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetMaxMessageSize sets the largest message ReadMessage accepts
+func (c *Conn) SetMaxMessageSize(size int64) {
+	c.maxMessageSize = size
+}
+
+// SetReadTimeout makes reads fail if no frame, including a pong, arrives
+// within d. Zero disables the timeout.
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	c.readTimeout = d
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs skipped. When the peer closes the connection, the close is
+// acknowledged and ErrClosed returned.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var opcode int
+	var message []byte
+	for {
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case PingMessage:
+			if err := c.writeFrame(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.CloseWith(code)
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if message != nil {
+				return 0, nil, c.fail(CloseProtocolError, "websocket: new message before previous one finished")
+			}
+			opcode = frameOpcode
+			message = payload
+		case continuationFrame:
+			if message == nil {
+				return 0, nil, c.fail(CloseProtocolError, "websocket: unexpected continuation frame")
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("websocket: unknown opcode %d", frameOpcode))
+		}
+
+		if int64(len(message)) > c.maxMessageSize {
+			c.CloseWith(CloseTooLarge)
+			return 0, nil, ErrMessageTooLarge
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads one frame and unmasks its payload
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "websocket: reserved bits set")
+	}
+	// Clients must mask their frames and servers must not
+	if masked == c.client {
+		return false, 0, nil, c.fail(CloseProtocolError, "websocket: wrong frame masking")
+	}
+	if opcode >= CloseMessage && (!fin || length > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "websocket: invalid control frame")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if length < 0 || length > c.maxMessageSize {
+		c.CloseWith(CloseTooLarge)
+		return false, 0, nil, ErrMessageTooLarge
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends a text or binary message in a single frame
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	return c.writeFrame(opcode, data)
+}
+
+// Ping sends a ping; the peer's pong resets the read timeout
+func (c *Conn) Ping() error {
+	return c.writeFrame(PingMessage, nil)
+}
+
+// SetWriteDeadline sets the deadline for future writes
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// writeFrame writes a single final frame
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(opcode))
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a normal close frame and closes the connection
+func (c *Conn) Close() error {
+	return c.CloseWith(CloseNormal)
+}
+
+// CloseWith sends a close frame with the given status code and closes the
+// connection
+func (c *Conn) CloseWith(code int) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(CloseMessage, payload)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// fail closes the connection with a protocol error
+func (c *Conn) fail(code int, message string) error {
+	c.CloseWith(code)
+	return errors.New(message)
+}
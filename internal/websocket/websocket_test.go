@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer upgrades every request and echoes messages back
+func echoServer(t *testing.T, maxSize int64) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+		if maxSize > 0 {
+			conn.SetMaxMessageSize(maxSize)
+		}
+		for {
+			opcode, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(opcode, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws://" + strings.TrimPrefix(server.URL, "http://") + "/"
+}
+
+func TestAcceptKey(t *testing.T) {
+	// RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %s", got)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	conn, err := Dial(echoServer(t, 1<<20), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxMessageSize(1 << 20)
+
+	// Cover the 7-bit, 16-bit and 64-bit length encodings
+	for _, size := range []int{0, 5, 300, 70000} {
+		message := strings.Repeat("x", size)
+		if err := conn.WriteMessage(TextMessage, []byte(message)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if err := conn.Ping(); err != nil {
+			t.Fatalf("Ping failed: %v", err)
+		}
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if opcode != TextMessage || string(data) != message {
+			t.Errorf("Expected %d-byte text echo, got opcode %d with %d bytes", size, opcode, len(data))
+		}
+	}
+}
+
+func TestMessageTooLarge(t *testing.T) {
+	conn, err := Dial(echoServer(t, 16), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteMessage(TextMessage, []byte(strings.Repeat("x", 32)))
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected the server to close the connection, got %v", err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequest(t *testing.T) {
+	url := echoServer(t, 0)
+	resp, err := http.Get("http://" + strings.TrimPrefix(url, "ws://"))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", resp.StatusCode)
+	}
+}
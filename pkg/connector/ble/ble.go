@@ -212,6 +212,64 @@ func ScanVehicleBeacon(ctx context.Context, vin string) (*ScanResult, error) {
 	return a, nil
 }
 
+// IsVehicleLocalName reports whether name has the form of a vehicle's BLE
+// beacon name, as returned by VehicleLocalName.
+func IsVehicleLocalName(name string) bool {
+	if len(name) != 18 || name[0] != 'S' || name[17] != 'C' {
+		return false
+	}
+	for _, c := range name[1:17] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanVehicleBeacons scans until ctx is done and returns every vehicle beacon
+// seen, with the strongest signal each was heard at. Other BLE calls wait
+// until the scan ends.
+func ScanVehicleBeacons(ctx context.Context) ([]*ScanResult, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := initAdapter(nil); err != nil {
+		return nil, err
+	}
+
+	var seenLock sync.Mutex
+	seen := make(map[string]*ScanResult)
+	var order []string
+	fn := func(a ble.Advertisement) {
+		if !IsVehicleLocalName(a.LocalName()) {
+			return
+		}
+		result := advertisementToScanResult(a)
+		seenLock.Lock()
+		defer seenLock.Unlock()
+		previous, ok := seen[result.LocalName]
+		if !ok {
+			order = append(order, result.LocalName)
+		}
+		if !ok || result.RSSI > previous.RSSI {
+			seen[result.LocalName] = result
+		}
+	}
+
+	err := device.Scan(ctx, true, fn)
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("ble: failed to scan: %s", err)
+	}
+
+	seenLock.Lock()
+	defer seenLock.Unlock()
+	results := make([]*ScanResult, 0, len(order))
+	for _, name := range order {
+		results = append(results, seen[name])
+	}
+	return results, nil
+}
+
 func scanVehicleBeacon(ctx context.Context, localName string) (*ScanResult, error) {
 	var err error
 	ctx2, cancel := context.WithCancel(ctx)
@@ -143,7 +143,10 @@ func ValidTeslaDomainSuffix(domain string) bool {
 // response body is not necessarily nil if the error is set.
 func (c *Connection) SendFleetAPICommand(ctx context.Context, endpoint string, command interface{}) ([]byte, error) {
 	url := fmt.Sprintf("https://%s/%s", c.serverURL, endpoint)
-	rsp, err := SendFleetAPICommand(ctx, c.client, c.UserAgent, c.authHeader, url, command)
+	c.lock.Lock()
+	authHeader := c.authHeader
+	c.lock.Unlock()
+	rsp, err := SendFleetAPICommand(ctx, c.client, c.UserAgent, authHeader, url, command)
 	if err != nil {
 		var httpErr *HTTPError
 		if errors.As(err, &httpErr) && httpErr.Code == http.StatusMisdirectedRequest {
@@ -183,6 +186,14 @@ func NewConnection(vin string, authHeader, serverURL, userAgent string) *Connect
 	return &conn
 }
 
+// SetAuthHeader replaces the Authorization header sent with later requests,
+// such as after refreshing an OAuth token.
+func (c *Connection) SetAuthHeader(authHeader string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.authHeader = authHeader
+}
+
 func (c *Connection) PreferredAuthMethod() connector.AuthMethod {
 	return connector.AuthMethodHMAC
 }
@@ -61,6 +61,24 @@ func (v *Vehicle) ClimateOff(ctx context.Context) error {
 		})
 }
 
+// SetClimateAutoMode turns automatic climate control on or off. The command
+// also sets the climate system's power, so callers pass the current power
+// state to leave it unchanged. Turning auto mode off keeps the current fan
+// speed and airflow as manual settings.
+func (v *Vehicle) SetClimateAutoMode(ctx context.Context, powerOn, auto bool) error {
+	return v.executeCarServerAction(ctx,
+		&carserver.Action_VehicleAction{
+			VehicleAction: &carserver.VehicleAction{
+				VehicleActionMsg: &carserver.VehicleAction_HvacAutoAction{
+					HvacAutoAction: &carserver.HvacAutoAction{
+						PowerOn:        powerOn,
+						ManualOverride: !auto,
+					},
+				},
+			},
+		})
+}
+
 func (v *Vehicle) AutoSeatAndClimate(ctx context.Context, positions []SeatPosition, enabled bool) error {
 	lookup := map[SeatPosition]carserver.AutoSeatClimateAction_AutoSeatPosition_E{
 		SeatUnknown:    carserver.AutoSeatClimateAction_AutoSeatPosition_Unknown,
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"google.golang.org/protobuf/proto"
+
 	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
 )
@@ -68,9 +70,22 @@ func (c StateCategory) submessage() *carserver.GetVehicleData {
 //
 // [vehicle data]: https://developer.tesla.com/docs/fleet-api/endpoints/vehicle-endpoints#vehicle-data
 func (v *Vehicle) GetState(ctx context.Context, category StateCategory) (*carserver.VehicleData, error) {
-	submessage := category.submessage()
-	if submessage == nil {
-		return nil, fmt.Errorf("unrecognized vehicle data category")
+	return v.GetStates(ctx, category)
+}
+
+// GetStates fetches several categories of vehicle information in a single request. The response
+// has a field set for each category.
+func (v *Vehicle) GetStates(ctx context.Context, categories ...StateCategory) (*carserver.VehicleData, error) {
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("no vehicle data categories")
+	}
+	submessage := &carserver.GetVehicleData{}
+	for _, category := range categories {
+		categoryMessage := category.submessage()
+		if categoryMessage == nil {
+			return nil, fmt.Errorf("unrecognized vehicle data category")
+		}
+		proto.Merge(submessage, categoryMessage)
 	}
 	action := carserver.Action_VehicleAction{
 		VehicleAction: &carserver.VehicleAction{